@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// ActorKind tells people from systems among actors.
+type ActorKind string
+
+const (
+	ActorUser    ActorKind = "user"
+	ActorService ActorKind = "service"
+)
+
+// Actor is who makes a change: a user or a service. Stores and services
+// with an actor (see ParcelStore.WithActor) record it with every change
+// they make, in the status and address histories and the change feed,
+// so that who changed a parcel, and when, can be answered later.
+type Actor struct {
+	Kind ActorKind
+	// ID names the actor, e.g. a login or "admin key 3".
+	ID string
+}
+
+// IsZero reports whether a is no actor at all.
+func (a Actor) IsZero() bool {
+	return a == Actor{}
+}
+
+// String returns the form actors are recorded in, e.g. "user:alice", or
+// "" for the zero Actor.
+func (a Actor) String() string {
+	if a.IsZero() {
+		return ""
+	}
+	return string(a.Kind) + ":" + a.ID
+}
+
+// ActorOf returns the actor of requests made as who: the API key, or
+// the role alone if there is none.
+func ActorOf(who Principal) Actor {
+	return Actor{Kind: ActorService, ID: who.String()}
+}
+
+type actorKey struct{}
+
+// ContextWithActor returns a copy of ctx carrying a.
+func ContextWithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, a)
+}
+
+// ActorFromContext returns the actor attached by ContextWithActor.
+func ActorFromContext(ctx context.Context) (Actor, bool) {
+	a, ok := ctx.Value(actorKey{}).(Actor)
+	return a, ok
+}
+
+// WithActor returns a copy of the store that records a as the actor of
+// every change it makes; see Actor.
+//
+// Status and address history entries get the actor from the store that
+// adds them. The change feed is written by triggers, which read it from
+// the mutation_actor table: the store fills it in each transaction
+// before its first write, and empties it again before the commit, so
+// other connections never see it. Writes outside a transaction run in
+// one of their own for that. Only statements run through the store are
+// attributed; changes made by other means have no actor.
+func (s ParcelStore) WithActor(a Actor) ParcelStore {
+	s.actor = a
+	return s
+}
+
+// Actor returns the actor of the store; see WithActor.
+func (s ParcelStore) Actor() Actor {
+	return s.actor
+}
+
+// actorQuerier runs the writes of store with its actor recorded in
+// mutation_actor; reads go straight to q.
+type actorQuerier struct {
+	querier
+	store ParcelStore
+}
+
+func (a actorQuerier) Exec(query string, args ...any) (sql.Result, error) {
+	if a.store.tx == nil {
+		var res sql.Result
+		err := a.store.InTx(func(tx ParcelStore) error {
+			var err error
+			res, err = tx.conn().Exec(query, args...)
+			return err
+		})
+		return res, err
+	}
+	if err := a.store.recordActor(a.querier); err != nil {
+		return nil, err
+	}
+	return a.querier.Exec(query, args...)
+}
+
+// recordActor sets the actor of the transaction of the store to its own
+// unless it is already.
+func (s ParcelStore) recordActor(q querier) error {
+	actor := s.actor.String()
+	if *s.recorded == actor {
+		return nil
+	}
+	query := `INSERT INTO mutation_actor (id, actor) VALUES (1, :actor)
+ON CONFLICT (id) DO UPDATE SET actor = excluded.actor`
+	if _, err := q.Exec(query, sql.Named("actor", actor)); err != nil {
+		return fmt.Errorf("failed to record actor %q: %w", actor, err)
+	}
+	*s.recorded = actor
+	return nil
+}
+
+// clearActor empties mutation_actor before the transaction of the store
+// commits.
+func (s ParcelStore) clearActor() error {
+	if *s.recorded == "" {
+		return nil
+	}
+	if _, err := s.tx.Exec("DELETE FROM mutation_actor"); err != nil {
+		return fmt.Errorf("failed to clear actor: %w", err)
+	}
+	*s.recorded = ""
+	return nil
+}
+
+// WithActor returns a copy of the service whose changes are recorded as
+// made by a; see ParcelStore.WithActor.
+func (s ParcelService) WithActor(a Actor) ParcelService {
+	s.store = s.store.WithActor(a)
+	return s
+}
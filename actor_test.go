@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestActorContext verifies carrying an actor in a context.
+func TestActorContext(t *testing.T) {
+	_, ok := ActorFromContext(context.Background())
+	assert.False(t, ok)
+
+	alice := Actor{Kind: ActorUser, ID: "alice"}
+	a, ok := ActorFromContext(ContextWithActor(context.Background(), alice))
+	require.True(t, ok)
+	assert.Equal(t, alice, a)
+	assert.Equal(t, "user:alice", a.String())
+	assert.Equal(t, "", Actor{}.String())
+	assert.Equal(t, "service:admin key 3", ActorOf(Principal{Role: RoleAdmin, KeyID: 3}).String())
+}
+
+// TestStoreActor verifies that the actor of a store is recorded in the
+// histories and the change feed, per write within a transaction, and
+// never left behind for other writes.
+func TestStoreActor(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	alice := store.WithActor(Actor{Kind: ActorUser, ID: "alice"})
+	bot := store.WithActor(Actor{Kind: ActorService, ID: "sorter"})
+
+	// change
+	number, err := alice.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, alice.SetAddress(number, "new address"))
+	require.NoError(t, bot.AddHistory(StatusChange{Number: number, Status: ParcelStatusSent, ChangedAt: "2024-03-01T03:00:00Z"}))
+	require.NoError(t, alice.InTx(func(tx ParcelStore) error {
+		if err := tx.SetStatus(number, ParcelStatusSent); err != nil {
+			return err
+		}
+		return tx.WithActor(bot.Actor()).SetStatus(number, ParcelStatusDelivered)
+	}))
+	require.NoError(t, store.SetStatus(number, ParcelStatusSent))
+	other, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, bot.Delete(other))
+
+	// check
+	history, err := store.GetHistory(number)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "service:sorter", history[0].Actor)
+
+	addresses, err := store.GetAddressHistory(number)
+	require.NoError(t, err)
+	require.NotEmpty(t, addresses)
+	assert.Equal(t, "user:alice", addresses[len(addresses)-1].Actor)
+
+	changes, err := store.GetChangesSince(0, 0)
+	require.NoError(t, err)
+	var actors []string
+	for _, c := range changes {
+		actors = append(actors, string(c.Op)+" "+c.Actor)
+	}
+	assert.Equal(t, []string{
+		"create user:alice",
+		"update user:alice",
+		"update user:alice",
+		"update service:sorter",
+		"update ",
+		"create ",
+		"delete service:sorter",
+	}, actors)
+
+	var left int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM mutation_actor").Scan(&left))
+	assert.Zero(t, left)
+}
+
+// TestHTTPActor verifies that API changes are recorded as made by the
+// actor of the request, or else by its principal.
+func TestHTTPActor(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	_, err := service.Register(1000, "test")
+	require.NoError(t, err)
+	h := NewHTTPHandler(service)
+	put := func(ctx context.Context, address string) {
+		rec := httptest.NewRecorder()
+		body := `{"address": "` + address + `"}`
+		req := httptest.NewRequest(http.MethodPut, "/parcels/1/address", strings.NewReader(body)).WithContext(ctx)
+		h.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	// change
+	ctx := ContextWithPrincipal(context.Background(), Principal{Role: RoleAdmin, KeyID: 7})
+	put(ctx, "first")
+	put(ContextWithActor(ctx, Actor{Kind: ActorUser, ID: "bob"}), "second")
+
+	// check
+	rec := doRequest(t, h, http.MethodGet, "/parcels/1/address-history", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var history []addressHistoryJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&history))
+	require.Len(t, history, 3)
+	assert.Equal(t, "", history[0].Actor)
+	assert.Equal(t, "service:admin key 7", history[1].Actor)
+	assert.Equal(t, "user:bob", history[2].Actor)
+}
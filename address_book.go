@@ -0,0 +1,333 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxSavedAddressLabelLength is the maximum length of the label of a
+// saved address, in characters.
+const MaxSavedAddressLabelLength = 64
+
+var (
+	// ErrSavedAddressNotFound indicates that the client has no saved
+	// address with the requested id, or no default address.
+	ErrSavedAddressNotFound = newError(CodeSavedAddressNotFound, "saved address not found")
+	// ErrInvalidSavedAddress indicates a saved address without a label or
+	// an address, or with a label longer than MaxSavedAddressLabelLength.
+	ErrInvalidSavedAddress = newError(CodeInvalidSavedAddress, "invalid saved address")
+)
+
+// SavedAddress is an entry of the address book of a client, which
+// parcels can be registered to instead of typing the address again; see
+// ParcelService.RegisterToSavedAddress.
+type SavedAddress struct {
+	ID     int
+	Client int
+	// Label names the address for the client, e.g. "home".
+	Label   string
+	Address string
+	// Default marks the address parcels go to when none is given; a client
+	// has at most one, and the first address saved becomes it.
+	Default   bool
+	CreatedAt string
+	UpdatedAt string
+}
+
+// validate trims the label and address of a and checks that both are
+// given.
+func (a *SavedAddress) validate() error {
+	a.Label, a.Address = strings.TrimSpace(a.Label), strings.TrimSpace(a.Address)
+	switch {
+	case a.Label == "":
+		return fmt.Errorf("%w: label is required", ErrInvalidSavedAddress)
+	case utf8.RuneCountInString(a.Label) > MaxSavedAddressLabelLength:
+		return fmt.Errorf("%w: label is longer than %d characters", ErrInvalidSavedAddress, MaxSavedAddressLabelLength)
+	case a.Address == "":
+		return fmt.Errorf("%w: address is required", ErrInvalidSavedAddress)
+	}
+	return nil
+}
+
+// savedAddressColumns lists the columns scanned by scanSavedAddress, in
+// order.
+const savedAddressColumns = "id, client, label, address, is_default, created_at, updated_at"
+
+// scanSavedAddress scans a row of savedAddressColumns and decrypts the
+// address.
+func (s ParcelStore) scanSavedAddress(row interface{ Scan(...any) error }) (SavedAddress, error) {
+	var a SavedAddress
+	if err := row.Scan(&a.ID, &a.Client, &a.Label, &a.Address, &a.Default, &a.CreatedAt, &a.UpdatedAt); err != nil {
+		return a, err
+	}
+	var err error
+	a.Address, err = s.open(a.Address, purposeAddress)
+	return a, err
+}
+
+// AddSavedAddress adds a to the address book of its client and returns
+// its id. The address passes through the store's address validator like
+// a parcel address.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidSavedAddress (wrapped) if a fails validation, and
+//     the validator's error if it rejects the address.
+//   - The first address of a client becomes its default; a default
+//     address replaces the previous one.
+//   - Runs in one transaction; wraps and returns any SQL error.
+func (s ParcelStore) AddSavedAddress(a SavedAddress) (int, error) {
+	if err := s.check(); err != nil {
+		return 0, err
+	}
+	if err := a.validate(); err != nil {
+		return 0, fmt.Errorf("failed to save address of client %d: %w", pii(a.Client), err)
+	}
+	address, err := s.validateAddress(a.Address)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save address of client %d: %w", pii(a.Client), err)
+	}
+	sealed, err := s.sealAddress(address)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save address of client %d: %w", pii(a.Client), err)
+	}
+
+	err = s.InTx(func(tx ParcelStore) error {
+		query := `INSERT INTO client_address (client, label, address, is_default, created_at, updated_at)
+VALUES (:client, :label, :address,
+    :default OR NOT EXISTS (SELECT 1 FROM client_address WHERE client = :client), :created_at, :created_at)`
+		res, err := tx.conn().Exec(query, sql.Named("client", a.Client), sql.Named("label", a.Label),
+			sql.Named("address", sealed), sql.Named("default", a.Default), sql.Named("created_at", a.CreatedAt))
+		if err != nil {
+			return fmt.Errorf("failed to save address of client %d: %w", pii(a.Client), err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get id of saved address of client %d: %w", pii(a.Client), err)
+		}
+		a.ID = int(id)
+		if !a.Default {
+			return nil
+		}
+		return tx.clearDefaultAddress(a)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return a.ID, nil
+}
+
+// clearDefaultAddress clears the default flag of the addresses of the
+// client of a other than a.
+func (s ParcelStore) clearDefaultAddress(a SavedAddress) error {
+	query := "UPDATE client_address SET is_default = 0 WHERE client = :client AND id != :id AND is_default"
+	if _, err := s.conn().Exec(query, sql.Named("client", a.Client), sql.Named("id", a.ID)); err != nil {
+		return fmt.Errorf("failed to clear default address of client %d: %w", pii(a.Client), err)
+	}
+	return nil
+}
+
+// UpdateSavedAddress replaces the label, address and default flag of the
+// saved address a.ID of a.Client.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidSavedAddress (wrapped) if a fails validation, and
+//     the validator's error if it rejects the address.
+//   - Returns ErrSavedAddressNotFound (wrapped) if the client has no such
+//     address.
+//   - A default address replaces the previous one; clearing the flag
+//     leaves the client without a default.
+//   - Runs in one transaction; wraps and returns any SQL error.
+func (s ParcelStore) UpdateSavedAddress(a SavedAddress) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	if err := a.validate(); err != nil {
+		return fmt.Errorf("failed to update saved address %d: %w", a.ID, err)
+	}
+	address, err := s.validateAddress(a.Address)
+	if err != nil {
+		return fmt.Errorf("failed to update saved address %d: %w", a.ID, err)
+	}
+	sealed, err := s.sealAddress(address)
+	if err != nil {
+		return fmt.Errorf("failed to update saved address %d: %w", a.ID, err)
+	}
+
+	return s.InTx(func(tx ParcelStore) error {
+		query := `UPDATE client_address SET label = :label, address = :address, is_default = :default,
+    updated_at = :updated_at WHERE id = :id AND client = :client`
+		res, err := tx.conn().Exec(query, sql.Named("label", a.Label), sql.Named("address", sealed),
+			sql.Named("default", a.Default), sql.Named("updated_at", a.UpdatedAt), sql.Named("id", a.ID),
+			sql.Named("client", a.Client))
+		if err != nil {
+			return fmt.Errorf("failed to update saved address %d: %w", a.ID, err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to update saved address %d: %w", a.ID, err)
+		} else if n == 0 {
+			return fmt.Errorf("failed to update saved address %d: %w", a.ID, ErrSavedAddressNotFound)
+		}
+		if !a.Default {
+			return nil
+		}
+		return tx.clearDefaultAddress(a)
+	})
+}
+
+// DeleteSavedAddress removes the saved address id from the address book
+// of client. Deleting the default address leaves the client without one.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrSavedAddressNotFound (wrapped) if the client has no such
+//     address.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) DeleteSavedAddress(client, id int) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	res, err := s.conn().Exec("DELETE FROM client_address WHERE id = :id AND client = :client",
+		sql.Named("id", id), sql.Named("client", client))
+	if err != nil {
+		return fmt.Errorf("failed to delete saved address %d: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to delete saved address %d: %w", id, err)
+	} else if n == 0 {
+		return fmt.Errorf("failed to delete saved address %d: %w", id, ErrSavedAddressNotFound)
+	}
+	return nil
+}
+
+// GetSavedAddress returns the saved address id of client, or its default
+// address if id is 0.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrSavedAddressNotFound (wrapped) if the client has no such
+//     address, including addresses of other clients.
+//   - Wraps and returns any SQL or decryption error.
+func (s ParcelStore) GetSavedAddress(client, id int) (SavedAddress, error) {
+	if err := s.check(); err != nil {
+		return SavedAddress{}, err
+	}
+
+	q := selectFrom("client_address", savedAddressColumns).Where("client = ?", client)
+	if id == 0 {
+		q = q.Where("is_default")
+	} else {
+		q = q.Where("id = ?", id)
+	}
+	query, args := q.build()
+	a, err := s.scanSavedAddress(s.conn().QueryRow(query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return a, fmt.Errorf("failed to get saved address %d of client %d: %w", id, pii(client), ErrSavedAddressNotFound)
+	}
+	if err != nil {
+		return a, fmt.Errorf("failed to scan saved address row with id %d: %w", id, err)
+	}
+	return a, nil
+}
+
+// ListSavedAddresses returns the address book of client, ordered by
+// label.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if the client has saved no addresses.
+//   - Wraps and returns any SQL or decryption errors.
+func (s ParcelStore) ListSavedAddresses(client int) ([]SavedAddress, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query, args := selectFrom("client_address", savedAddressColumns).Where("client = ?", client).
+		OrderBy("label", "id").build()
+	rows, err := s.conn().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for saved addresses of client %d: %w", pii(client), err)
+	}
+	defer rows.Close()
+
+	res := []SavedAddress{}
+	for rows.Next() {
+		a, err := s.scanSavedAddress(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan one of saved address rows of client %d: %w", pii(client), err)
+		}
+		res = append(res, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate saved address rows of client %d: %w", pii(client), err)
+	}
+	return res, nil
+}
+
+// SaveAddress adds a to the address book of its client and returns it
+// as stored; see ParcelStore.AddSavedAddress.
+func (s ParcelService) SaveAddress(a SavedAddress) (SavedAddress, error) {
+	a.CreatedAt = s.timestamp(time.Now())
+	var saved SavedAddress
+	err := s.store.InTx(func(tx ParcelStore) error {
+		id, err := tx.AddSavedAddress(a)
+		if err != nil {
+			return err
+		}
+		saved, err = tx.GetSavedAddress(a.Client, id)
+		return err
+	})
+	return saved, err
+}
+
+// UpdateSavedAddress changes the saved address a.ID of a.Client and
+// returns it as stored; see ParcelStore.UpdateSavedAddress.
+func (s ParcelService) UpdateSavedAddress(a SavedAddress) (SavedAddress, error) {
+	a.UpdatedAt = s.timestamp(time.Now())
+	var saved SavedAddress
+	err := s.store.InTx(func(tx ParcelStore) error {
+		if err := tx.UpdateSavedAddress(a); err != nil {
+			return err
+		}
+		var err error
+		saved, err = tx.GetSavedAddress(a.Client, a.ID)
+		return err
+	})
+	return saved, err
+}
+
+// DeleteSavedAddress removes the saved address id of client.
+func (s ParcelService) DeleteSavedAddress(client, id int) error {
+	return s.store.DeleteSavedAddress(client, id)
+}
+
+// SavedAddresses returns the address book of client, ordered by label.
+func (s ParcelService) SavedAddresses(client int) ([]SavedAddress, error) {
+	return s.store.ListSavedAddresses(client)
+}
+
+// RegisterToSavedAddress registers draft like RegisterParcel, to the
+// saved address id of its client, or to the client's default address if
+// id is 0; the saved address replaces draft.Address.
+//
+// Behaviour:
+//   - Returns ErrSavedAddressNotFound (wrapped) if the client has no
+//     address id.
+//   - If id is 0 and the client has no default address, draft is
+//     registered as it is.
+func (s ParcelService) RegisterToSavedAddress(draft Parcel, id int) (Parcel, error) {
+	a, err := s.store.GetSavedAddress(draft.Client, id)
+	switch {
+	case err == nil:
+		draft.Address = a.Address
+	case id != 0 || !errors.Is(err, ErrSavedAddressNotFound):
+		return draft, err
+	}
+	return s.RegisterParcel(draft)
+}
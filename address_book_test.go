@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSavedAddresses checks the address book of a client: validation,
+// the single default address and that clients only see their own.
+func TestSavedAddresses(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+
+	// check
+	tests := []struct {
+		name    string
+		address SavedAddress
+	}{
+		{"no label", SavedAddress{Client: 1000, Label: " ", Address: "Red Square"}},
+		{"long label", SavedAddress{Client: 1000, Label: strings.Repeat("x", MaxSavedAddressLabelLength+1), Address: "Red Square"}},
+		{"no address", SavedAddress{Client: 1000, Label: "home", Address: " "}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.SaveAddress(tt.address)
+			assert.ErrorIs(t, err, ErrInvalidSavedAddress)
+		})
+	}
+
+	home, err := service.SaveAddress(SavedAddress{Client: 1000, Label: " home ", Address: "Red Square"})
+	require.NoError(t, err)
+	assert.Equal(t, "home", home.Label)
+	assert.True(t, home.Default)
+	work, err := service.SaveAddress(SavedAddress{Client: 1000, Label: "work", Address: "Gorky Park"})
+	require.NoError(t, err)
+	assert.False(t, work.Default)
+
+	work.Default = true
+	work, err = service.UpdateSavedAddress(work)
+	require.NoError(t, err)
+	assert.True(t, work.Default)
+	assert.NotEmpty(t, work.UpdatedAt)
+	book, err := service.SavedAddresses(1000)
+	require.NoError(t, err)
+	require.Len(t, book, 2)
+	assert.False(t, book[0].Default)
+	assert.Equal(t, work, book[1])
+
+	_, err = service.UpdateSavedAddress(SavedAddress{ID: home.ID, Client: 2000, Label: "mine", Address: "Hermitage"})
+	assert.ErrorIs(t, err, ErrSavedAddressNotFound)
+	assert.ErrorIs(t, service.DeleteSavedAddress(2000, home.ID), ErrSavedAddressNotFound)
+	book, err = service.SavedAddresses(2000)
+	require.NoError(t, err)
+	assert.Empty(t, book)
+
+	require.NoError(t, service.DeleteSavedAddress(1000, work.ID))
+	_, err = service.store.GetSavedAddress(1000, 0)
+	assert.ErrorIs(t, err, ErrSavedAddressNotFound)
+}
+
+// TestRegisterToSavedAddress verifies that parcels are registered to the
+// saved address given, or to the default one.
+func TestRegisterToSavedAddress(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+
+	// check
+	_, err := service.RegisterToSavedAddress(Parcel{Client: 1000}, 0)
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+
+	home, err := service.SaveAddress(SavedAddress{Client: 1000, Label: "home", Address: "Red Square"})
+	require.NoError(t, err)
+	work, err := service.SaveAddress(SavedAddress{Client: 1000, Label: "work", Address: "Gorky Park"})
+	require.NoError(t, err)
+
+	parcel, err := service.RegisterToSavedAddress(Parcel{Client: 1000}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, home.Address, parcel.Address)
+	parcel, err = service.RegisterToSavedAddress(Parcel{Client: 1000, Address: "ignored"}, work.ID)
+	require.NoError(t, err)
+	assert.Equal(t, work.Address, parcel.Address)
+	_, err = service.RegisterToSavedAddress(Parcel{Client: 2000}, work.ID)
+	assert.ErrorIs(t, err, ErrSavedAddressNotFound)
+}
+
+// TestSavedAddressesEncryptedAndErased verifies that saved addresses are
+// encrypted at rest and erased with the data of their client.
+func TestSavedAddressesEncryptedAndErased(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db).WithFieldEncryption(getTestKeyRing(t, "a"))
+	service := NewParcelService(store, NewEventBus())
+	saved, err := service.SaveAddress(SavedAddress{Client: 1000, Label: "home", Address: "Red Square"})
+	require.NoError(t, err)
+
+	// check
+	var stored string
+	require.NoError(t, db.QueryRow("SELECT address FROM client_address WHERE id = ?", saved.ID).Scan(&stored))
+	assert.NotContains(t, stored, "Red Square")
+	assert.Equal(t, "Red Square", saved.Address)
+
+	_, err = store.EraseClient(1000, time.Now(), 0)
+	require.NoError(t, err)
+	book, err := service.SavedAddresses(1000)
+	require.NoError(t, err)
+	assert.Empty(t, book)
+}
+
+// TestSavedAddressesHTTP checks the address book endpoints and
+// registration by saved address over HTTP.
+func TestSavedAddressesHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service)
+
+	// check
+	rec := doRequest(t, h, http.MethodPost, "/clients/1000/addresses", `{"label": "home", "address": "Red Square"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var home savedAddressJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&home))
+	path := fmt.Sprintf("/clients/1000/addresses/%d", home.ID)
+	assert.Equal(t, path, rec.Header().Get("Location"))
+	assert.True(t, home.Default)
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodPost, "/clients/1000/addresses", `{"label": "x"}`).Code)
+
+	rec = doRequest(t, h, http.MethodPut, path, `{"label": "home", "address": "Hermitage", "default": true}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequest(t, h, http.MethodGet, "/clients/1000/addresses", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var book []savedAddressJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&book))
+	require.Len(t, book, 1)
+	assert.Equal(t, "Hermitage", book[0].Address)
+
+	rec = doRequest(t, h, http.MethodPost, "/parcels", `{"client": 1000}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var parcel parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&parcel))
+	assert.Equal(t, "Hermitage", parcel.Address)
+	assert.Equal(t, http.StatusNotFound,
+		doRequest(t, h, http.MethodPost, "/parcels", `{"client": 1000, "saved_address": 999}`).Code)
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodPost, "/parcels", `{"client": 2000}`).Code)
+
+	assert.Equal(t, http.StatusNoContent, doRequest(t, h, http.MethodDelete, path, "").Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodDelete, path, "").Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodGet, "/clients/1000/orders", "").Code)
+
+	other := NewAuthorizedService(service, Principal{Role: RoleClient, Client: 2000})
+	_, err := other.SavedAddresses(1000)
+	assert.ErrorIs(t, err, ErrForbidden)
+	courier := NewAuthorizedService(service, Principal{Role: RoleCourier})
+	_, err = courier.SaveAddress(SavedAddress{Client: 1000, Label: "home", Address: "Red Square"})
+	assert.ErrorIs(t, err, ErrForbidden)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// AddressChangePolicy decides which parcels SetAddress may redirect, e.g.
+// as the contract with the carrier says. The zero value allows changes to
+// registered parcels only.
+type AddressChangePolicy struct {
+	// AfterDispatch also allows changing the address of parcels in transit
+	// (sent or cleared through customs), for carriers that redirect them.
+	// Each such change is recorded in the "address_changes" audit table.
+	AfterDispatch bool
+	// Window, if positive, also allows changing the address of a parcel
+	// that is not delivered yet within Window of its registration,
+	// whatever its status. Changes after dispatch are audited as above.
+	// A parcel whose creation time does not parse is outside the window.
+	Window time.Duration
+}
+
+// allows reports whether the address of a parcel in status may change.
+// The window is only consulted, through inWindow, when the status alone
+// does not decide.
+func (p AddressChangePolicy) allows(status string, inWindow func(window time.Duration) (bool, error)) (bool, error) {
+	switch {
+	case status == ParcelStatusRegistered, p.AfterDispatch && inTransit(status):
+		return true, nil
+	case p.Window <= 0, status == ParcelStatusDelivered:
+		return false, nil
+	default:
+		return inWindow(p.Window)
+	}
+}
+
+// inAddressChangeWindow reports whether the parcel with the given number
+// was registered at most window before now. A creation time that does not
+// parse is outside the window.
+func (s ParcelStore) inAddressChangeWindow(number int, now time.Time, window time.Duration) (bool, error) {
+	var createdAt string
+	query := "SELECT created_at FROM parcel WHERE number = :number"
+	if err := s.conn().QueryRow(query, sql.Named("number", number)).Scan(&createdAt); err != nil {
+		return false, fmt.Errorf("failed to get creation time of parcel with number %d: %w", number, err)
+	}
+	created, err := time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return false, nil
+	}
+	return now.Sub(created) <= window, nil
+}
+
+// WithAddressChangePolicy returns a copy of the store that applies policy
+// in SetAddress.
+func (s ParcelStore) WithAddressChangePolicy(policy AddressChangePolicy) ParcelStore {
+	s.addressPolicy = policy
+	return s
+}
+
+// AddressChange is the audit entry of an address changed after dispatch.
+type AddressChange struct {
+	ID         int
+	Number     int
+	Status     string
+	OldAddress string
+	NewAddress string
+	ChangedAt  string
+}
+
+// addAddressChange records c in the "address_changes" audit table.
+func (s ParcelStore) addAddressChange(c AddressChange) error {
+	oldAddress, err := s.sealAddress(c.OldAddress)
+	if err != nil {
+		return fmt.Errorf("failed to audit address change of parcel %d: %w", c.Number, err)
+	}
+	newAddress, err := s.sealAddress(c.NewAddress)
+	if err != nil {
+		return fmt.Errorf("failed to audit address change of parcel %d: %w", c.Number, err)
+	}
+	query := `INSERT INTO address_changes (parcel_number, status, old_address, new_address, changed_at)
+VALUES (:number, :status, :old_address, :new_address, :changed_at)`
+	_, err = s.conn().Exec(query, sql.Named("number", c.Number), sql.Named("status", c.Status),
+		sql.Named("old_address", oldAddress), sql.Named("new_address", newAddress),
+		sql.Named("changed_at", FormatTimestamp(time.Now(), DefaultTimestampPrecision)))
+	if err != nil {
+		return fmt.Errorf("failed to audit address change of parcel %d: %w", c.Number, err)
+	}
+	return nil
+}
+
+// ListAddressChanges returns the changes of the address of a parcel made
+// after dispatch, oldest first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if the address never changed after dispatch.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) ListAddressChanges(number int) ([]AddressChange, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, status, old_address, new_address, changed_at FROM address_changes
+WHERE parcel_number = :number ORDER BY id`
+	rows, err := s.conn().Query(query, sql.Named("number", number))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for address changes of parcel %d: %w", number, err)
+	}
+	defer rows.Close()
+
+	res := []AddressChange{}
+	for rows.Next() {
+		c := AddressChange{Number: number}
+		if err := rows.Scan(&c.ID, &c.Status, &c.OldAddress, &c.NewAddress, &c.ChangedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan one of address change rows of parcel %d: %w", number, err)
+		}
+		if c.OldAddress, err = s.open(c.OldAddress, purposeAddress); err != nil {
+			return nil, fmt.Errorf("failed to read address changes of parcel %d: %w", number, err)
+		}
+		if c.NewAddress, err = s.open(c.NewAddress, purposeAddress); err != nil {
+			return nil, fmt.Errorf("failed to read address changes of parcel %d: %w", number, err)
+		}
+		res = append(res, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate address change rows of parcel %d: %w", number, err)
+	}
+	return res, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAddressChangePolicy checks that sent parcels are redirected only
+// when the policy allows it, and that such changes are audited.
+func TestAddressChangePolicy(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	add := func(status string) int {
+		p := getTestParcel()
+		p.Status = status
+		number, err := store.Add(p)
+		require.NoError(t, err)
+		return number
+	}
+	registered, sent, delivered := add(ParcelStatusRegistered), add(ParcelStatusSent), add(ParcelStatusDelivered)
+
+	// check
+	require.ErrorIs(t, store.SetAddress(sent, "redirect"), ErrRequireRegistered)
+
+	redirecting := store.WithAddressChangePolicy(AddressChangePolicy{AfterDispatch: true})
+	require.NoError(t, redirecting.SetAddress(registered, "new"))
+	require.NoError(t, redirecting.SetAddress(sent, "redirect"))
+	require.ErrorIs(t, redirecting.SetAddress(delivered, "too late"), ErrRequireRegistered)
+
+	parcel, err := store.Get(sent)
+	require.NoError(t, err)
+	assert.Equal(t, "redirect", parcel.Address)
+
+	changes, err := store.ListAddressChanges(sent)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, ParcelStatusSent, changes[0].Status)
+	assert.Equal(t, "test", changes[0].OldAddress)
+	assert.Equal(t, "redirect", changes[0].NewAddress)
+	assert.NotEmpty(t, changes[0].ChangedAt)
+
+	changes, err = store.ListAddressChanges(registered)
+	require.NoError(t, err)
+	assert.Empty(t, changes, "changes before dispatch are not audited")
+}
+
+// TestAddressChangeWindow checks that within the window of the policy the
+// address of a parcel changes whatever its status, until it is delivered.
+func TestAddressChangeWindow(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db).WithAddressChangePolicy(AddressChangePolicy{Window: 30 * time.Minute})
+
+	add := func(status string, age time.Duration) int {
+		p := getTestParcel()
+		p.Status = status
+		p.CreatedAt = FormatTimestamp(time.Now().Add(-age), DefaultTimestampPrecision)
+		number, err := store.Add(p)
+		require.NoError(t, err)
+		return number
+	}
+	fresh, stale := add(ParcelStatusSent, 10*time.Minute), add(ParcelStatusSent, time.Hour)
+	delivered := add(ParcelStatusDelivered, time.Minute)
+	registered := add(ParcelStatusRegistered, time.Hour)
+
+	// check
+	require.NoError(t, store.SetAddress(fresh, "redirect"))
+	require.ErrorIs(t, store.SetAddress(stale, "redirect"), ErrRequireRegistered)
+	require.ErrorIs(t, store.SetAddress(delivered, "too late"), ErrRequireRegistered)
+	require.NoError(t, store.SetAddress(registered, "new"))
+
+	changes, err := store.ListAddressChanges(fresh)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, ParcelStatusSent, changes[0].Status)
+}
+
+// TestAddressChangeWindowWhenCreationTimeInvalid checks that a creation
+// time that does not parse only matters when the window decides, and then
+// counts as outside it.
+func TestAddressChangeWindowWhenCreationTimeInvalid(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db).WithAddressChangePolicy(AddressChangePolicy{Window: 30 * time.Minute})
+
+	add := func(status string) int {
+		p := getTestParcel()
+		p.Status = status
+		number, err := store.Add(p)
+		require.NoError(t, err)
+		_, err = db.Exec("UPDATE parcel SET created_at = ? WHERE number = ?", "yesterday", number)
+		require.NoError(t, err)
+		return number
+	}
+	registered, sent := add(ParcelStatusRegistered), add(ParcelStatusSent)
+
+	// check
+	require.NoError(t, store.SetAddress(registered, "new"))
+	require.ErrorIs(t, store.SetAddress(sent, "redirect"), ErrRequireRegistered)
+}
+
+// TestAddressChangeRace checks that a parcel sent while its new address
+// is being validated keeps its address.
+func TestAddressChangeRace(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	number, err := NewParcelStore(db).Add(getTestParcel())
+	require.NoError(t, err)
+	store := NewParcelStore(db).WithAddressValidator(AddressValidatorFunc(func(address string) (string, error) {
+		_, err := db.Exec("UPDATE parcel SET status = ? WHERE number = ?", ParcelStatusSent, number)
+		return address, err
+	}))
+
+	// check
+	require.ErrorIs(t, store.SetAddress(number, "redirect"), ErrRequireRegistered)
+	stored, err := store.Get(number)
+	require.NoError(t, err)
+	assert.Equal(t, getTestParcel().Address, stored.Address)
+}
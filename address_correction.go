@@ -0,0 +1,149 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNoCorrection indicates that CorrectAddresses was called without a
+// correction function.
+var ErrNoCorrection = errors.New("no address correction function")
+
+// AddressFilter selects the registered parcels processed by
+// CorrectAddresses. Zero-valued fields do not restrict the selection.
+type AddressFilter struct {
+	// Client limits the selection to one client.
+	Client int
+	// Contains limits the selection to addresses containing this substring.
+	Contains string
+}
+
+// AddressCorrection describes a single address rewritten (or, in dry-run
+// mode, one that would be rewritten) by CorrectAddresses.
+type AddressCorrection struct {
+	Number     int
+	OldAddress string
+	NewAddress string
+}
+
+// CorrectAddresses applies fix to the address of every registered parcel
+// matching filter, e.g. to repair a street name misspelled by an import.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrNoCorrection if fix is nil.
+//   - Only parcels with status `registered` are considered; parcels whose
+//     address fix leaves unchanged are skipped.
+//   - Each corrected address goes through the store's AddressValidator
+//     (see WithAddressValidator); one it rejects fails the whole call.
+//   - Like SetAddress, re-geocodes each corrected address (see
+//     WithGeocoder) and detaches the parcel from its pickup point.
+//   - With dryRun set, returns the corrections without writing anything.
+//   - Otherwise updates every address and records each change in the
+//     "address_correction" audit table within one transaction, so either
+//     all rows are corrected or none are.
+//   - Wraps and returns any SQL errors; the transaction is rolled back.
+func (s ParcelStore) CorrectAddresses(filter AddressFilter, fix func(string) string, dryRun bool) ([]AddressCorrection, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	if fix == nil {
+		return nil, ErrNoCorrection
+	}
+
+	var res []AddressCorrection
+	err := s.InTx(func(tx ParcelStore) error {
+		var err error
+		res, err = tx.correctAddresses(filter, fix, dryRun)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// correctAddresses implements CorrectAddresses; it must run inside InTx.
+func (s ParcelStore) correctAddresses(filter AddressFilter, fix func(string) string, dryRun bool) ([]AddressCorrection, error) {
+	// addresses may be encrypted (see WithFieldEncryption), so Contains is
+	// matched after reading
+	query := `SELECT number, address FROM parcel
+WHERE status = :status AND (:client = 0 OR client = :client)
+ORDER BY number`
+	rows, err := s.conn().Query(query, sql.Named("status", ParcelStatusRegistered),
+		sql.Named("client", filter.Client))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for address correction: %w", err)
+	}
+	defer rows.Close()
+
+	var res []AddressCorrection
+	for rows.Next() {
+		var c AddressCorrection
+
+		if err := rows.Scan(&c.Number, &c.OldAddress); err != nil {
+			return nil, fmt.Errorf("failed to scan one of parcel rows for address correction: %w", err)
+		}
+		if c.OldAddress, err = s.open(c.OldAddress, purposeAddress); err != nil {
+			return nil, fmt.Errorf("failed to read parcel rows for address correction: %w", err)
+		}
+		if !strings.Contains(c.OldAddress, filter.Contains) {
+			continue
+		}
+		c.NewAddress, err = s.validateAddress(fix(c.OldAddress))
+		if err != nil {
+			return nil, fmt.Errorf("failed to correct address for parcel with number %d: %w", c.Number, err)
+		}
+		if c.NewAddress != c.OldAddress {
+			res = append(res, c)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate parcel rows for address correction: %w", err)
+	}
+	rows.Close()
+
+	if dryRun {
+		return res, nil
+	}
+
+	correctedAt := FormatTimestamp(time.Now(), DefaultTimestampPrecision)
+	queryUpdate := `UPDATE parcel SET address = :address, latitude = :latitude, longitude = :longitude, pickup_point = 0
+WHERE number = :number`
+	queryAudit := `INSERT INTO address_correction (parcel_number, old_address, new_address, corrected_at)
+VALUES (:number, :old_address, :new_address, :corrected_at)`
+	for _, c := range res {
+		oldAddress, err := s.sealAddress(c.OldAddress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to correct address for parcel with number %d: %w", c.Number, err)
+		}
+		newAddress, err := s.sealAddress(c.NewAddress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to correct address for parcel with number %d: %w", c.Number, err)
+		}
+		coordinates, err := s.geocode(c.NewAddress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to correct address for parcel with number %d: %w", c.Number, err)
+		}
+		latitude, longitude := nullCoordinates(coordinates)
+
+		s.invalidateParcel(c.Number)
+		_, err = s.conn().Exec(queryUpdate, sql.Named("address", newAddress), sql.Named("latitude", latitude),
+			sql.Named("longitude", longitude), sql.Named("number", c.Number))
+		if err != nil {
+			return nil, fmt.Errorf("failed to correct address for parcel with number %d: %w", c.Number, err)
+		}
+		if err := s.addAddressHistory(c.Number, c.NewAddress, ParcelStatusRegistered, correctedAt); err != nil {
+			return nil, err
+		}
+		_, err = s.conn().Exec(queryAudit, sql.Named("number", c.Number), sql.Named("old_address", oldAddress),
+			sql.Named("new_address", newAddress), sql.Named("corrected_at", correctedAt))
+		if err != nil {
+			return nil, fmt.Errorf("failed to audit address correction for parcel with number %d: %w", c.Number, err)
+		}
+	}
+	return res, nil
+}
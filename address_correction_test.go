@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCorrectAddresses verifies dry-run and applied corrections, including
+// that parcels already sent are left untouched and every change is audited.
+func TestCorrectAddresses(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	addresses := []string{"Pskov, Pushkina st., 5", "Pskov, Lenina st., 1", "Pskov, Pushkina st., 7"}
+	numbers := make([]int, len(addresses))
+	for i, address := range addresses {
+		parcel := getTestParcel()
+		parcel.Address = address
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers[i] = id
+	}
+	require.NoError(t, store.SetStatus(numbers[2], ParcelStatusSent))
+
+	fix := strings.NewReplacer("Pushkina", "Pushkin").Replace
+	filter := AddressFilter{Contains: "Pushkina"}
+
+	// dry run
+	corrections, err := store.CorrectAddresses(filter, fix, true)
+	require.NoError(t, err)
+	require.Len(t, corrections, 1)
+	assert.Equal(t, AddressCorrection{Number: numbers[0], OldAddress: addresses[0], NewAddress: "Pskov, Pushkin st., 5"}, corrections[0])
+
+	stored, err := store.Get(numbers[0])
+	require.NoError(t, err)
+	require.Equal(t, addresses[0], stored.Address)
+
+	// apply
+	corrections, err = store.CorrectAddresses(filter, fix, false)
+	require.NoError(t, err)
+	require.Len(t, corrections, 1)
+
+	// check
+	stored, err = store.Get(numbers[0])
+	require.NoError(t, err)
+	assert.Equal(t, "Pskov, Pushkin st., 5", stored.Address)
+
+	stored, err = store.Get(numbers[2])
+	require.NoError(t, err)
+	assert.Equal(t, addresses[2], stored.Address)
+
+	var audited int
+	err = db.QueryRow("SELECT COUNT(*) FROM address_correction WHERE parcel_number = ?", numbers[0]).Scan(&audited)
+	require.NoError(t, err)
+	assert.Equal(t, 1, audited)
+}
+
+// TestCorrectAddressesValidated verifies that corrected addresses are
+// normalised, rejected like SetAddress rejects them and re-geocoded.
+func TestCorrectAddressesValidated(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db).WithAddressValidator(BasicAddressNormalizer{}).WithGeocoder(testGeocoder)
+	parcel := getTestParcel()
+	parcel.Address = "Red Square"
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	// check
+	_, err = store.CorrectAddresses(AddressFilter{}, func(string) string { return " " }, true)
+	require.ErrorIs(t, err, ErrInvalidAddress)
+
+	corrections, err := store.CorrectAddresses(AddressFilter{}, func(string) string { return " Gorky   Park " }, false)
+	require.NoError(t, err)
+	require.Len(t, corrections, 1)
+	assert.Equal(t, "Gorky Park", corrections[0].NewAddress)
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, "Gorky Park", stored.Address)
+	require.NotNil(t, stored.Coordinates)
+	assert.Equal(t, testGeocoder["Gorky Park"], *stored.Coordinates)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// AddressHistoryEntry is one address a parcel had: the address, the
+// status of the parcel when it was set, the RFC 3339 time it was set and
+// who set it (see Actor.String).
+type AddressHistoryEntry struct {
+	Address string
+	Status  string
+	SetAt   string
+	Actor   string
+}
+
+// addAddressHistory records that the parcel got address at setAt from the
+// actor of the store; it must run in the transaction that sets the address.
+func (s ParcelStore) addAddressHistory(number int, address, status, setAt string) error {
+	address, err := s.sealAddress(address)
+	if err != nil {
+		return fmt.Errorf("failed to record address history of parcel with number %d: %w", number, err)
+	}
+	query := `INSERT INTO parcel_address_history (parcel_number, address, status, set_at, actor)
+VALUES (:number, :address, :status, :set_at, :actor)`
+	_, err = s.conn().Exec(query, sql.Named("number", number), sql.Named("address", address),
+		sql.Named("status", status), sql.Named("set_at", setAt), sql.Named("actor", s.actor.String()))
+	if err != nil {
+		return fmt.Errorf("failed to record address history of parcel with number %d: %w", number, err)
+	}
+	return nil
+}
+
+// GetAddressHistory returns every address the parcel has had, from the
+// one it was registered with to the current one.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice for an unknown parcel.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) GetAddressHistory(number int) ([]AddressHistoryEntry, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT address, status, set_at, actor FROM parcel_address_history
+WHERE parcel_number = :number ORDER BY id`
+	rows, err := s.conn().Query(query, sql.Named("number", number))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for address history of parcel %d: %w", number, err)
+	}
+	defer rows.Close()
+
+	res := []AddressHistoryEntry{}
+	for rows.Next() {
+		var e AddressHistoryEntry
+		if err := rows.Scan(&e.Address, &e.Status, &e.SetAt, &e.Actor); err != nil {
+			return nil, fmt.Errorf("failed to scan one of address history rows of parcel %d: %w", number, err)
+		}
+		if e.Address, err = s.open(e.Address, purposeAddress); err != nil {
+			return nil, fmt.Errorf("failed to read address history of parcel %d: %w", number, err)
+		}
+		res = append(res, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate address history rows of parcel %d: %w", number, err)
+	}
+	return res, nil
+}
+
+// AddressHistory returns every address the parcel has had, oldest first.
+func (s ParcelService) AddressHistory(number int) ([]AddressHistoryEntry, error) {
+	if _, err := s.store.Get(number); err != nil {
+		return nil, mapError(err)
+	}
+	return s.store.GetAddressHistory(number)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAddressHistory checks that the registered address and every later
+// change, including bulk corrections and redirects, are kept.
+func TestAddressHistory(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db).WithAddressChangePolicy(AddressChangePolicy{AfterDispatch: true})
+	number, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// check
+	require.NoError(t, store.SetAddress(number, "first"))
+	_, err = store.CorrectAddresses(AddressFilter{}, func(a string) string { return strings.ToUpper(a) }, false)
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(number, ParcelStatusSent))
+	require.NoError(t, store.SetAddress(number, "redirect"))
+
+	history, err := store.GetAddressHistory(number)
+	require.NoError(t, err)
+	var addresses, statuses []string
+	for _, e := range history {
+		addresses = append(addresses, e.Address)
+		statuses = append(statuses, e.Status)
+		assert.NotEmpty(t, e.SetAt)
+	}
+	assert.Equal(t, []string{"test", "first", "FIRST", "redirect"}, addresses)
+	assert.Equal(t, []string{ParcelStatusRegistered, ParcelStatusRegistered, ParcelStatusRegistered, ParcelStatusSent}, statuses)
+
+	// a refused change leaves no trace
+	require.NoError(t, store.SetStatus(number, ParcelStatusDelivered))
+	require.Error(t, store.SetAddress(number, "too late"))
+	history, err = store.GetAddressHistory(number)
+	require.NoError(t, err)
+	assert.Len(t, history, 4)
+}
+
+// TestAddressHistoryHTTP checks /parcels/{number}/address-history.
+func TestAddressHistoryHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test"})
+	require.NoError(t, err)
+	require.NoError(t, service.ChangeAddress(parcel.Number, "new"))
+	h := NewHTTPHandler(service)
+
+	// check
+	rec := doRequest(t, h, http.MethodGet, fmt.Sprintf("/parcels/%d/address-history", parcel.Number), "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var history []addressHistoryJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&history))
+	require.Len(t, history, 2)
+	assert.Equal(t, "test", history[0].Address)
+	assert.Equal(t, "new", history[1].Address)
+
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodGet, "/parcels/999/address-history", "").Code)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInvalidAddress indicates that an address was rejected by the
+// store's AddressValidator.
+var ErrInvalidAddress = newError(CodeInvalidAddress, "invalid address")
+
+// maxAddressLength is the size of the "address" column.
+const maxAddressLength = 512
+
+// AddressValidator checks a delivery address before it is stored and
+// returns it in normalised form. Implementations report rejected
+// addresses with an error wrapping ErrInvalidAddress.
+type AddressValidator interface {
+	ValidateAddress(address string) (string, error)
+}
+
+// AddressValidatorFunc adapts a function to AddressValidator.
+type AddressValidatorFunc func(address string) (string, error)
+
+// ValidateAddress calls f(address).
+func (f AddressValidatorFunc) ValidateAddress(address string) (string, error) {
+	return f(address)
+}
+
+// ChainAddressValidators returns a validator running each of validators
+// in turn on the output of the previous one.
+func ChainAddressValidators(validators ...AddressValidator) AddressValidator {
+	return AddressValidatorFunc(func(address string) (string, error) {
+		for _, v := range validators {
+			var err error
+			address, err = v.ValidateAddress(address)
+			if err != nil {
+				return "", err
+			}
+		}
+		return address, nil
+	})
+}
+
+// WithAddressValidator returns a copy of the store that passes every
+// address given to Add and SetAddress through v and stores the result.
+func (s ParcelStore) WithAddressValidator(v AddressValidator) ParcelStore {
+	s.addresses = v
+	return s
+}
+
+// validateAddress runs the store's validator, if any, on address.
+func (s ParcelStore) validateAddress(address string) (string, error) {
+	if s.addresses == nil {
+		return address, nil
+	}
+	return s.addresses.ValidateAddress(address)
+}
+
+// BasicAddressNormalizer is a built-in AddressValidator that collapses
+// runs of whitespace, trims the address and rejects addresses that are
+// empty, too long, contain control characters or have no letters.
+type BasicAddressNormalizer struct {
+	// MinLength is the minimum length in characters after normalisation;
+	// zero means any non-empty address is long enough.
+	MinLength int
+}
+
+// ValidateAddress implements AddressValidator.
+func (n BasicAddressNormalizer) ValidateAddress(address string) (string, error) {
+	if !utf8.ValidString(address) {
+		return "", fmt.Errorf("%w: not valid UTF-8", ErrInvalidAddress)
+	}
+	for _, r := range address {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return "", fmt.Errorf("%w: contains control character %U", ErrInvalidAddress, r)
+		}
+	}
+
+	normalised := strings.Join(strings.Fields(address), " ")
+	length := utf8.RuneCountInString(normalised)
+	switch {
+	case normalised == "":
+		return "", fmt.Errorf("%w: empty", ErrInvalidAddress)
+	case length < n.MinLength:
+		return "", fmt.Errorf("%w: %q is shorter than %d characters", ErrInvalidAddress, pii(normalised), n.MinLength)
+	case length > maxAddressLength:
+		return "", fmt.Errorf("%w: longer than %d characters", ErrInvalidAddress, maxAddressLength)
+	case strings.IndexFunc(normalised, unicode.IsLetter) < 0:
+		return "", fmt.Errorf("%w: %q has no letters", ErrInvalidAddress, pii(normalised))
+	}
+	return normalised, nil
+}
+
+// GeocodingValidator is an example AddressValidator backed by an external
+// geocoder: it accepts the address if the geocoder finds it. The address
+// itself is returned unchanged; chain it after BasicAddressNormalizer.
+type GeocodingValidator struct {
+	Geocoder Geocoder
+}
+
+// ValidateAddress implements AddressValidator. Errors reaching the
+// geocoder are returned as they are, so an outage does not look like a
+// rejected address.
+func (g GeocodingValidator) ValidateAddress(address string) (string, error) {
+	c, err := g.Geocoder.Geocode(address)
+	if err != nil {
+		return "", err
+	}
+	if c == nil {
+		return "", fmt.Errorf("%w: %q not found by geocoder", ErrInvalidAddress, pii(address))
+	}
+	return address, nil
+}
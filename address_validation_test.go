@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBasicAddressNormalizer verifies normalisation and rejection of
+// malformed addresses.
+func TestBasicAddressNormalizer(t *testing.T) {
+	n := BasicAddressNormalizer{MinLength: 5}
+
+	address, err := n.ValidateAddress("  Псков,\tул. Пушкина,\n д. 5 ")
+	require.NoError(t, err)
+	assert.Equal(t, "Псков, ул. Пушкина, д. 5", address)
+
+	for _, invalid := range []string{"", "   ", "12345", "a b", "Main\x00street 1", "\xff\xfe street"} {
+		_, err := n.ValidateAddress(invalid)
+		assert.ErrorIs(t, err, ErrInvalidAddress, "%q", invalid)
+	}
+}
+
+// TestAddressValidatorOnWrite ensures that Add and SetAddress store the
+// normalised address and reject invalid ones.
+func TestAddressValidatorOnWrite(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db).WithAddressValidator(BasicAddressNormalizer{})
+	parcel := getTestParcel()
+	parcel.Address = "  Main   street 1 "
+
+	// add
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	parcel.Address = ""
+	_, err = store.Add(parcel)
+	require.ErrorIs(t, err, ErrInvalidAddress)
+
+	// set address
+	require.ErrorIs(t, store.SetAddress(id, " \t "), ErrInvalidAddress)
+	require.NoError(t, store.SetAddress(id, "Second  street 2"))
+
+	// check
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, "Second street 2", stored.Address)
+}
+
+// TestGeocodingValidator verifies the example adapter against a fake
+// geocoding service.
+func TestGeocodingValidator(t *testing.T) {
+	// prepare
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("q") == "Baker Street 221B" {
+			w.Write([]byte(`[{"lat": "51.52", "lon": "-0.15"}]`))
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+	v := ChainAddressValidators(BasicAddressNormalizer{}, GeocodingValidator{Geocoder: NominatimGeocoder{Endpoint: srv.URL}})
+
+	// check
+	address, err := v.ValidateAddress(" Baker  Street 221B ")
+	require.NoError(t, err)
+	assert.Equal(t, "Baker Street 221B", address)
+
+	_, err = v.ValidateAddress("Nowhere 0")
+	require.ErrorIs(t, err, ErrInvalidAddress)
+
+	srv.Close()
+	_, err = v.ValidateAddress("Baker Street 221B")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidAddress)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Periods of the materialised delivery analytics.
+const (
+	AnalyticsDaily  = "day"
+	AnalyticsWeekly = "week"
+)
+
+// ErrUnknownAnalyticsPeriod indicates a period other than AnalyticsDaily
+// and AnalyticsWeekly.
+var ErrUnknownAnalyticsPeriod = errors.New("unknown analytics period")
+
+// deliveryTimeBounds are the upper bounds of the delivery time histogram
+// buckets; a last bucket holds the longer deliveries. The histogram table
+// stores bucket indexes, so changing the bounds requires a full refresh.
+var deliveryTimeBounds = []time.Duration{
+	24 * time.Hour,
+	2 * 24 * time.Hour,
+	3 * 24 * time.Hour,
+	5 * 24 * time.Hour,
+	7 * 24 * time.Hour,
+}
+
+// DeliverySummary aggregates the parcels delivered in one day or week
+// (starting on Monday), by the date of their first delivered entry of the
+// status history (UTC).
+type DeliverySummary struct {
+	// Start is the day, or the Monday of the week, as YYYY-MM-DD.
+	Start     string
+	Delivered int
+	// AverageDuration is the mean time from registration to delivery.
+	AverageDuration time.Duration
+	// OnTime and Late count the parcels that had a deadline.
+	OnTime, Late int
+}
+
+// HistogramBucket counts the deliveries that took at least Min and less
+// than Max; Max is zero for the last, unbounded, bucket.
+type HistogramBucket struct {
+	Min, Max time.Duration
+	Count    int
+}
+
+// firstDeliveries selects the delivery time, duration in seconds and
+// deadline of the parcels first delivered at or after :from. It relies on
+// the (status, changed_at) index of the history rather than scanning it.
+const firstDeliveries = `WITH delivery AS (
+    SELECT h.changed_at AS delivered_at,
+        (julianday(h.changed_at) - julianday(p.created_at)) * 86400 AS seconds,
+        p.due_at
+    FROM parcel_status_history h JOIN parcel p ON p.number = h.parcel_number
+    WHERE h.status = :delivered AND h.changed_at >= :from
+        AND NOT EXISTS (SELECT 1 FROM parcel_status_history e
+            WHERE e.parcel_number = h.parcel_number AND e.status = :delivered
+                AND (e.changed_at < h.changed_at OR e.changed_at = h.changed_at AND e.id < h.id))
+)
+`
+
+// RefreshDeliveryAnalytics recomputes the materialised delivery analytics
+// (see GetDeliverySummary and GetDeliveryTimeHistogram) from the week of
+// since onwards. A zero since rebuilds them entirely.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Parcels archived since the rows were computed drop out of the
+//     recomputed rows; older rows keep them.
+//   - Runs in one transaction; wraps and returns any SQL errors.
+func (s ParcelStore) RefreshDeliveryAnalytics(since time.Time) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	from := ""
+	if !since.IsZero() {
+		from = weekStart(since)
+	}
+	return s.InTx(func(tx ParcelStore) error {
+		return refreshDeliveryAnalytics(tx.conn(), from)
+	})
+}
+
+// refreshDeliveryAnalytics replaces the analytics rows of the days and
+// weeks starting at or after from, a Monday as YYYY-MM-DD or "" for all.
+func refreshDeliveryAnalytics(q querier, from string) error {
+	for _, table := range []string{"delivery_summary WHERE start", "delivery_histogram WHERE day"} {
+		if _, err := q.Exec("DELETE FROM "+table+" >= :from", sql.Named("from", from)); err != nil {
+			return fmt.Errorf("failed to clear delivery analytics from %q: %w", from, err)
+		}
+	}
+
+	summary := firstDeliveries + `INSERT INTO delivery_summary (period, start, delivered, total_seconds, on_time, late)
+SELECT :period, %s AS start, COUNT(*), SUM(seconds),
+    COUNT(CASE WHEN due_at != '' AND delivered_at <= due_at THEN 1 END),
+    COUNT(CASE WHEN due_at != '' AND delivered_at > due_at THEN 1 END)
+FROM delivery GROUP BY start`
+	starts := map[string]string{
+		AnalyticsDaily:  "substr(delivered_at, 1, 10)",
+		AnalyticsWeekly: "date(delivered_at, '-6 days', 'weekday 1')",
+	}
+	for _, period := range []string{AnalyticsDaily, AnalyticsWeekly} {
+		_, err := q.Exec(fmt.Sprintf(summary, starts[period]), sql.Named("period", period),
+			sql.Named("delivered", ParcelStatusDelivered), sql.Named("from", from))
+		if err != nil {
+			return fmt.Errorf("failed to refresh %s delivery summary: %w", period, err)
+		}
+	}
+
+	var bucket strings.Builder
+	bucket.WriteString("CASE")
+	for i, bound := range deliveryTimeBounds {
+		fmt.Fprintf(&bucket, " WHEN seconds < %d THEN %d", int64(bound/time.Second), i)
+	}
+	fmt.Fprintf(&bucket, " ELSE %d END", len(deliveryTimeBounds))
+	histogram := firstDeliveries + `INSERT INTO delivery_histogram (day, bucket, count)
+SELECT substr(delivered_at, 1, 10) AS day, ` + bucket.String() + ` AS bucket, COUNT(*)
+FROM delivery GROUP BY day, bucket`
+	_, err := q.Exec(histogram, sql.Named("delivered", ParcelStatusDelivered), sql.Named("from", from))
+	if err != nil {
+		return fmt.Errorf("failed to refresh delivery time histogram: %w", err)
+	}
+	return nil
+}
+
+// materialiseDeliveryAnalytics computes the analytics of the deliveries
+// made before migration 22 created their tables.
+func materialiseDeliveryAnalytics(tx *sql.Tx) error {
+	return refreshDeliveryAnalytics(timeoutQuerier{q: tx}, "")
+}
+
+// GetDeliverySummary returns the materialised daily or weekly delivery
+// summaries starting in [from, to), oldest first. A zero bound leaves
+// that side open. The rows are as fresh as the last
+// RefreshDeliveryAnalytics (see AnalyticsJob).
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrUnknownAnalyticsPeriod (wrapped) for a period other than
+//     AnalyticsDaily and AnalyticsWeekly.
+//   - Periods without deliveries are omitted.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) GetDeliverySummary(period string, from, to time.Time) ([]DeliverySummary, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	if period != AnalyticsDaily && period != AnalyticsWeekly {
+		return nil, fmt.Errorf("failed to get delivery summary: %w %q", ErrUnknownAnalyticsPeriod, period)
+	}
+
+	cond, args := dayRange("start", from, to)
+	query := "SELECT start, delivered, total_seconds, on_time, late FROM delivery_summary WHERE period = :period AND " +
+		cond + " ORDER BY start"
+	args = append(args, sql.Named("period", period))
+	var res []DeliverySummary
+	err := s.scanReport(period+" delivery summary", query, args, func(rows *sql.Rows) error {
+		var d DeliverySummary
+		var seconds float64
+		if err := rows.Scan(&d.Start, &d.Delivered, &seconds, &d.OnTime, &d.Late); err != nil {
+			return err
+		}
+		if d.Delivered > 0 {
+			d.AverageDuration = time.Duration(seconds / float64(d.Delivered) * float64(time.Second)).Round(time.Second)
+		}
+		res = append(res, d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetDeliveryTimeHistogram returns how long the parcels delivered on the
+// days in [from, to) took from registration, from the materialised
+// histogram. A zero bound leaves that side open. Every bucket is
+// returned, the shortest first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) GetDeliveryTimeHistogram(from, to time.Time) ([]HistogramBucket, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	res := make([]HistogramBucket, len(deliveryTimeBounds)+1)
+	for i := range res {
+		if i > 0 {
+			res[i].Min = deliveryTimeBounds[i-1]
+		}
+		if i < len(deliveryTimeBounds) {
+			res[i].Max = deliveryTimeBounds[i]
+		}
+	}
+
+	cond, args := dayRange("day", from, to)
+	query := "SELECT bucket, SUM(count) FROM delivery_histogram WHERE " + cond + " GROUP BY bucket"
+	err := s.scanReport("delivery time histogram", query, args, func(rows *sql.Rows) error {
+		var bucket, n int
+		if err := rows.Scan(&bucket, &n); err != nil {
+			return err
+		}
+		if bucket >= 0 && bucket < len(res) {
+			res[bucket].Count = n
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// dayRange returns the condition selecting the YYYY-MM-DD column in the
+// days of [from, to), and its arguments.
+func dayRange(column string, from, to time.Time) (string, []any) {
+	cond := "1 = 1"
+	var args []any
+	if !from.IsZero() {
+		cond += " AND " + column + " >= :from"
+		args = append(args, sql.Named("from", from.UTC().Format(time.DateOnly)))
+	}
+	if !to.IsZero() {
+		cond += " AND " + column + " < :to"
+		args = append(args, sql.Named("to", to.UTC().Format(time.DateOnly)))
+	}
+	return cond, args
+}
+
+// weekStart returns the Monday of the week of t (UTC) as YYYY-MM-DD.
+func weekStart(t time.Time) string {
+	t = t.UTC()
+	offset := (int(t.Weekday()) + 6) % 7
+	return t.AddDate(0, 0, -offset).Format(time.DateOnly)
+}
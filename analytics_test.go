@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDeliveryAnalytics checks the materialised summaries and histogram,
+// including that reads only see refreshed data and that a partial
+// refresh keeps older rows.
+func TestDeliveryAnalytics(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	monday := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	deliver := func(createdAt time.Time, due, took time.Duration) {
+		p := getTestParcel()
+		p.Status = ParcelStatusDelivered
+		p.CreatedAt = FormatTimestamp(createdAt, DefaultTimestampPrecision)
+		if due > 0 {
+			p.DueAt = FormatTimestamp(createdAt.Add(due), DefaultTimestampPrecision)
+		}
+		number, err := store.Add(p)
+		require.NoError(t, err)
+		for _, after := range []time.Duration{took, took + time.Hour} {
+			require.NoError(t, store.AddHistory(StatusChange{Number: number, Status: ParcelStatusDelivered,
+				ChangedAt: FormatTimestamp(createdAt.Add(after), DefaultTimestampPrecision)}))
+		}
+	}
+	deliver(monday, 48*time.Hour, 12*time.Hour)                    // Monday, on time
+	deliver(monday.Add(-24*time.Hour), 24*time.Hour, 36*time.Hour) // Monday, late
+	deliver(monday, 0, 10*24*time.Hour)                            // Thursday of the next week
+
+	// check
+	days, err := store.GetDeliverySummary(AnalyticsDaily, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, days, "not refreshed yet")
+
+	require.NoError(t, store.RefreshDeliveryAnalytics(time.Time{}))
+	days, err = store.GetDeliverySummary(AnalyticsDaily, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, []DeliverySummary{
+		{Start: "2024-03-04", Delivered: 2, AverageDuration: 24 * time.Hour, OnTime: 1, Late: 1},
+		{Start: "2024-03-14", Delivered: 1, AverageDuration: 10 * 24 * time.Hour},
+	}, days)
+
+	weeks, err := store.GetDeliverySummary(AnalyticsWeekly, monday, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, weeks, 2)
+	assert.Equal(t, "2024-03-04", weeks[0].Start)
+	assert.Equal(t, "2024-03-11", weeks[1].Start)
+
+	histogram, err := store.GetDeliveryTimeHistogram(monday, monday.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, histogram, len(deliveryTimeBounds)+1)
+	assert.Equal(t, HistogramBucket{Max: 24 * time.Hour, Count: 1}, histogram[0])
+	assert.Equal(t, HistogramBucket{Min: 24 * time.Hour, Max: 48 * time.Hour, Count: 1}, histogram[1])
+	assert.Equal(t, 0, histogram[len(histogram)-1].Count)
+	histogram, err = store.GetDeliveryTimeHistogram(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, HistogramBucket{Min: 7 * 24 * time.Hour, Count: 1}, histogram[len(histogram)-1])
+
+	// a partial refresh recomputes from the week of since only
+	_, err = db.Exec("DELETE FROM parcel")
+	require.NoError(t, err)
+	require.NoError(t, store.RefreshDeliveryAnalytics(monday.Add(8*24*time.Hour)))
+	days, err = store.GetDeliverySummary(AnalyticsDaily, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, days, 1)
+	assert.Equal(t, "2024-03-04", days[0].Start)
+
+	_, err = store.GetDeliverySummary("month", time.Time{}, time.Time{})
+	assert.ErrorIs(t, err, ErrUnknownAnalyticsPeriod)
+}
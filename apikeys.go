@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix starts every issued API key, so leaked keys are easy to
+// recognise in logs and secret scanners.
+const APIKeyPrefix = "trk_"
+
+var (
+	// ErrInvalidAPIKey indicates a missing, unknown or revoked API key.
+	ErrInvalidAPIKey = newError(CodeInvalidAPIKey, "invalid api key")
+	// ErrUnknownRole indicates a role without permissions.
+	ErrUnknownRole = errors.New("unknown role")
+)
+
+// APIKey describes an issued key. The key itself is only returned once,
+// by IssueAPIKey or RotateAPIKey; the database keeps its SHA-256 hash.
+type APIKey struct {
+	ID        int
+	Name      string
+	Principal Principal
+	CreatedAt string
+	// RevokedAt is empty while the key is valid.
+	RevokedAt string
+}
+
+// hashAPIKey returns the hex SHA-256 of key. Keys are random, so a fast
+// unsalted hash is enough to make a stolen table useless.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// newAPIKey returns a fresh random key.
+func newAPIKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	return APIKeyPrefix + hex.EncodeToString(b), nil
+}
+
+// IssueAPIKey creates a key named name that authenticates as who and
+// returns its description together with the key. The KeyID of who is
+// ignored; the principal of the new key carries its own id.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrUnknownRole (wrapped) if who has an unknown role.
+//   - Wraps and returns any error from key generation or the INSERT.
+func (s ParcelStore) IssueAPIKey(name string, who Principal) (APIKey, string, error) {
+	k := APIKey{Name: name, Principal: who, CreatedAt: FormatTimestamp(time.Now(), DefaultTimestampPrecision)}
+
+	if err := s.check(); err != nil {
+		return k, "", err
+	}
+	if _, ok := rolePermissions[who.Role]; !ok {
+		return k, "", fmt.Errorf("failed to issue api key %q: %w %q", name, ErrUnknownRole, who.Role)
+	}
+
+	key, err := newAPIKey()
+	if err != nil {
+		return k, "", err
+	}
+
+	query := `INSERT INTO api_key (name, key_hash, role, client, created_at)
+VALUES (:name, :key_hash, :role, :client, :created_at)`
+	res, err := s.conn().Exec(query, sql.Named("name", name), sql.Named("key_hash", hashAPIKey(key)),
+		sql.Named("role", string(who.Role)), sql.Named("client", who.Client), sql.Named("created_at", k.CreatedAt))
+	if err != nil {
+		return k, "", fmt.Errorf("failed to issue api key %q: %w", name, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return k, "", fmt.Errorf("failed to get id of api key %q: %w", name, err)
+	}
+	k.ID = int(id)
+	k.Principal.KeyID = k.ID
+	return k, key, nil
+}
+
+// RevokeAPIKey revokes the key with the given id; revoking a revoked key
+// keeps its original revocation time.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns sql.ErrNoRows (wrapped) if no such key exists.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) RevokeAPIKey(id int) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	return s.InTx(func(tx ParcelStore) error {
+		if _, err := tx.getAPIKey(id); err != nil {
+			return err
+		}
+		query := "UPDATE api_key SET revoked_at = :now WHERE id = :id AND revoked_at = ''"
+		_, err := tx.conn().Exec(query, sql.Named("now", FormatTimestamp(time.Now(), DefaultTimestampPrecision)),
+			sql.Named("id", id))
+		if err != nil {
+			return fmt.Errorf("failed to revoke api key %d: %w", id, err)
+		}
+		return nil
+	})
+}
+
+// RotateAPIKey revokes the key with the given id and issues a new key
+// with the same name and principal.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns sql.ErrNoRows (wrapped) if no such key exists.
+//   - Returns ErrInvalidAPIKey (wrapped) if the key is already revoked.
+//   - Wraps and returns any SQL error; on error the old key stays valid.
+func (s ParcelStore) RotateAPIKey(id int) (APIKey, string, error) {
+	var k APIKey
+	var key string
+
+	if err := s.check(); err != nil {
+		return k, "", err
+	}
+
+	err := s.InTx(func(tx ParcelStore) error {
+		old, err := tx.getAPIKey(id)
+		if err != nil {
+			return err
+		}
+		if old.RevokedAt != "" {
+			return fmt.Errorf("failed to rotate api key %d: %w: revoked at %s", id, ErrInvalidAPIKey, old.RevokedAt)
+		}
+		if err := tx.RevokeAPIKey(id); err != nil {
+			return err
+		}
+		k, key, err = tx.IssueAPIKey(old.Name, old.Principal)
+		return err
+	})
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	return k, key, nil
+}
+
+// GetAPIKeys returns every issued key, revoked ones included, oldest first.
+func (s ParcelStore) GetAPIKeys() ([]APIKey, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.conn().Query("SELECT " + apiKeyColumns + " FROM api_key ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var res []APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan one of api key rows: %w", err)
+		}
+		res = append(res, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate api key rows: %w", err)
+	}
+	return res, nil
+}
+
+// AuthenticateAPIKey returns the principal of a valid key.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidAPIKey (wrapped) if the key is unknown or revoked.
+//   - Wraps and returns any other SQL error.
+func (s ParcelStore) AuthenticateAPIKey(key string) (Principal, error) {
+	if err := s.check(); err != nil {
+		return Principal{}, err
+	}
+
+	query := "SELECT " + apiKeyColumns + " FROM api_key WHERE key_hash = :key_hash"
+	k, err := scanAPIKey(s.conn().QueryRow(query, sql.Named("key_hash", hashAPIKey(key))))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Principal{}, fmt.Errorf("failed to authenticate: %w", ErrInvalidAPIKey)
+	}
+	if err != nil {
+		return Principal{}, fmt.Errorf("failed to authenticate: %w", err)
+	}
+	if k.RevokedAt != "" {
+		return Principal{}, fmt.Errorf("failed to authenticate with api key %d: %w: revoked", k.ID, ErrInvalidAPIKey)
+	}
+	return k.Principal, nil
+}
+
+// getAPIKey returns the key with the given id.
+func (s ParcelStore) getAPIKey(id int) (APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_key WHERE id = :id"
+	k, err := scanAPIKey(s.conn().QueryRow(query, sql.Named("id", id)))
+	if err != nil {
+		return k, fmt.Errorf("failed to scan api key row with id %d: %w", id, err)
+	}
+	return k, nil
+}
+
+// apiKeyColumns lists the "api_key" columns in the order scanAPIKey expects.
+const apiKeyColumns = "id, name, role, client, created_at, revoked_at"
+
+func scanAPIKey(row rowScanner) (APIKey, error) {
+	var k APIKey
+	var role string
+	err := row.Scan(&k.ID, &k.Name, &role, &k.Principal.Client, &k.CreatedAt, &k.RevokedAt)
+	k.Principal.Role = Role(role)
+	k.Principal.KeyID = k.ID
+	return k, err
+}
+
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx carrying who.
+func ContextWithPrincipal(ctx context.Context, who Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, who)
+}
+
+// PrincipalFromContext returns the principal attached by APIKeyAuth.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	who, ok := ctx.Value(principalKey{}).(Principal)
+	return who, ok
+}
+
+// AllowAnonymous returns middleware that attaches who to requests that
+// carry no principal, so that the API serves them without an API key.
+// It is meant for development only: every caller acts as who.
+func AllowAnonymous(who Principal) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := PrincipalFromContext(r.Context()); !ok {
+				r = r.WithContext(ContextWithPrincipal(r.Context(), who))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// APIKeyAuth returns middleware that authenticates each request by the
+// API key in "Authorization: Bearer <key>" or "X-API-Key: <key>" and
+// attaches its principal to the request context. Requests without a
+// valid key are answered with 401 Unauthorized.
+func APIKeyAuth(store ParcelStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("X-API-Key")
+			if auth := r.Header.Get("Authorization"); auth != "" {
+				scheme, token, _ := strings.Cut(auth, " ")
+				if strings.EqualFold(scheme, "Bearer") {
+					key = strings.TrimSpace(token)
+				}
+			}
+
+			if key == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, ErrInvalidAPIKey)
+				return
+			}
+			who, err := store.AuthenticateAPIKey(key)
+			if errors.Is(err, ErrInvalidAPIKey) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, ErrInvalidAPIKey)
+				return
+			}
+			if err != nil {
+				writeServiceError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), who)))
+		})
+	}
+}
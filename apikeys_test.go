@@ -0,0 +1,126 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAPIKeyLifecycle verifies issuing, authenticating, rotating and
+// revoking API keys.
+func TestAPIKeyLifecycle(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	who := Principal{Role: RoleClient, Client: 1000}
+
+	// issue
+	key, secret, err := store.IssueAPIKey("shop", who)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(secret, APIKeyPrefix))
+
+	got, err := store.AuthenticateAPIKey(secret)
+	require.NoError(t, err)
+	who.KeyID = key.ID
+	assert.Equal(t, who, got)
+
+	// rotate
+	rotated, newSecret, err := store.RotateAPIKey(key.ID)
+	require.NoError(t, err)
+	assert.NotEqual(t, key.ID, rotated.ID)
+	assert.Equal(t, "shop", rotated.Name)
+
+	_, err = store.AuthenticateAPIKey(secret)
+	require.ErrorIs(t, err, ErrInvalidAPIKey)
+	_, err = store.AuthenticateAPIKey(newSecret)
+	require.NoError(t, err)
+	_, _, err = store.RotateAPIKey(key.ID)
+	require.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	// revoke
+	require.NoError(t, store.RevokeAPIKey(rotated.ID))
+	_, err = store.AuthenticateAPIKey(newSecret)
+	require.ErrorIs(t, err, ErrInvalidAPIKey)
+	require.ErrorIs(t, store.RevokeAPIKey(42), sql.ErrNoRows)
+
+	// check
+	keys, err := store.GetAPIKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.NotEmpty(t, keys[0].RevokedAt)
+	assert.NotEmpty(t, keys[1].RevokedAt)
+
+	_, _, err = store.IssueAPIKey("nobody", Principal{Role: "guest"})
+	require.ErrorIs(t, err, ErrUnknownRole)
+}
+
+// TestAPIKeyAuth verifies that the middleware rejects unauthenticated
+// calls, scopes clients to their own parcels and leaves the tracking page
+// public.
+func TestAPIKeyAuth(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	own, err := service.Register(1000, "own")
+	require.NoError(t, err)
+	_, err = service.Register(2000, "foreign")
+	require.NoError(t, err)
+	_, clientKey, err := service.store.IssueAPIKey("shop", Principal{Role: RoleClient, Client: 1000})
+	require.NoError(t, err)
+	h := NewHTTPHandler(service, APIKeyAuth(service.store))
+
+	request := func(method, target, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// check
+	rec := request(http.MethodGet, "/parcels", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/parcels", APIKeyPrefix+"bogus").Code)
+
+	rec = request(http.MethodGet, "/parcels", clientKey)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var parcels []parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&parcels))
+	require.Len(t, parcels, 1)
+	assert.Equal(t, own.Number, parcels[0].Number)
+
+	assert.Equal(t, http.StatusForbidden, request(http.MethodGet, "/parcels?client=2000", clientKey).Code)
+	assert.Equal(t, http.StatusForbidden, request(http.MethodDelete, "/parcels/1", clientKey).Code)
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/?code="+own.TrackingCode, "").Code)
+}
+
+// TestAnonymousRequests verifies that the API refuses requests no
+// middleware authenticated, unless AllowAnonymous lets them in.
+func TestAnonymousRequests(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	request := func(h http.Handler, method, target string) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec.Code
+	}
+
+	// check
+	h := NewHTTPHandler(service)
+	assert.Equal(t, http.StatusUnauthorized, request(h, http.MethodGet, "/parcels"))
+	assert.Equal(t, http.StatusUnauthorized, request(h, http.MethodDelete, "/parcels/1"))
+	assert.Equal(t, http.StatusUnauthorized, request(h, http.MethodGet, "/audit/export"))
+	assert.Equal(t, http.StatusOK, request(h, http.MethodGet, "/healthz"))
+
+	h = NewHTTPHandler(service, AllowAnonymous(Principal{Role: RoleAdmin}))
+	assert.Equal(t, http.StatusOK, request(h, http.MethodGet, "/parcels"))
+}
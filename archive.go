@@ -0,0 +1,122 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// archiveBatchSize is the number of parcels moved per transaction by
+// Archive, keeping write locks short on a busy database.
+const archiveBatchSize = 500
+
+// Archive moves delivered parcels that were delivered more than olderThan
+// ago from "parcel" into "parcel_archive" and returns how many were moved.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - The delivery time is taken from the status history, falling back to
+//     created_at for parcels without a `delivered` history entry.
+//   - Parcels are moved in batches of archiveBatchSize, each in its own
+//     transaction; on error, batches already committed stay archived.
+//   - Status history is kept, so archived parcels retain their history.
+//   - With foreign keys on (see Options.ForeignKeys), archived parcels
+//     leave their routes and orders.
+//   - Wraps and returns any SQL or encoding errors.
+func (s ParcelStore) Archive(olderThan time.Duration) (int, error) {
+	return s.archive(time.Now().Add(-olderThan), archiveBatchSize)
+}
+
+// archive moves parcels delivered before cutoff, batch at a time.
+func (s ParcelStore) archive(cutoff time.Time, batch int) (int, error) {
+	if err := s.check(); err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for {
+		var moved int
+		err := s.InTx(func(tx ParcelStore) error {
+			var err error
+			moved, err = tx.archiveBatch(cutoff, batch)
+			return err
+		})
+		total += moved
+		if err != nil {
+			return total, err
+		}
+		if moved < batch {
+			return total, nil
+		}
+	}
+}
+
+// archiveBatch moves up to batch parcels; it must run inside InTx.
+func (s ParcelStore) archiveBatch(cutoff time.Time, batch int) (int, error) {
+	query := "SELECT " + parcelColumns + ` FROM parcel
+WHERE status = :delivered
+    AND COALESCE(
+        (SELECT MAX(changed_at) FROM parcel_status_history
+        WHERE parcel_number = parcel.number AND status = :delivered),
+        created_at) < :cutoff
+ORDER BY seq
+LIMIT :batch`
+	parcels, err := s.queryParcels("archival", query, sql.Named("delivered", ParcelStatusDelivered),
+		sql.Named("cutoff", FormatTimestamp(cutoff, DefaultTimestampPrecision)), sql.Named("batch", batch))
+	if err != nil {
+		return 0, err
+	}
+
+	archivedAt := FormatTimestamp(time.Now(), DefaultTimestampPrecision)
+	queryInsert := `INSERT INTO parcel_archive (number, client, data, archived_at)
+VALUES (:number, :client, :data, :archived_at)`
+	queryDelete := "DELETE FROM parcel WHERE number = :number"
+	for _, p := range parcels {
+		sealed, err := s.sealParcel(p)
+		if err != nil {
+			return 0, fmt.Errorf("failed to archive parcel with number %d: %w", p.Number, err)
+		}
+		data, err := json.Marshal(sealed)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode parcel with number %d for archive: %w", p.Number, err)
+		}
+
+		_, err = s.conn().Exec(queryInsert, sql.Named("number", p.Number), sql.Named("client", p.Client),
+			sql.Named("data", string(data)), sql.Named("archived_at", archivedAt))
+		if err != nil {
+			return 0, fmt.Errorf("failed to archive parcel with number %d: %w", p.Number, err)
+		}
+		s.invalidateParcel(p.Number)
+		_, err = s.conn().Exec(queryDelete, sql.Named("number", p.Number))
+		if err != nil {
+			return 0, fmt.Errorf("failed to remove archived parcel with number %d: %w", p.Number, err)
+		}
+	}
+	return len(parcels), nil
+}
+
+// GetArchived retrieves an archived parcel by its number.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns sql.ErrNoRows (wrapped) if the parcel is not archived.
+//   - Wraps and returns any SQL or decoding errors.
+func (s ParcelStore) GetArchived(number int) (Parcel, error) {
+	var p Parcel
+
+	if err := s.check(); err != nil {
+		return p, err
+	}
+
+	var data string
+	query := "SELECT data FROM parcel_archive WHERE number = :number"
+	err := s.conn().QueryRow(query, sql.Named("number", number)).Scan(&data)
+	if err != nil {
+		return p, fmt.Errorf("failed to scan archived parcel row with number %d: %w", number, err)
+	}
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		return p, fmt.Errorf("failed to decode archived parcel with number %d: %w", number, err)
+	}
+	return s.openParcel(p)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestArchive verifies that only parcels delivered before the cutoff are
+// moved, across several batches, and remain retrievable from the archive.
+func TestArchive(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	now := time.Now()
+
+	old := getTestParcel()
+	old.Status = ParcelStatusDelivered
+	old.CreatedAt = FormatTimestamp(now.Add(-48*time.Hour), DefaultTimestampPrecision)
+
+	var archived []Parcel
+	for i := 0; i < 5; i++ {
+		old.PublicID = getTestPublicID(t)
+		id, err := store.Add(old)
+		require.NoError(t, err)
+		p := old
+		p.Number, p.TrackingCode, p.ClientRef = id, NewTrackingCode(trackingYear(p.CreatedAt), id), i+1
+		archived = append(archived, p)
+	}
+
+	recent := getTestParcel()
+	recent.Status = ParcelStatusDelivered
+	recentID, err := store.Add(recent)
+	require.NoError(t, err)
+
+	notDelivered := old
+	notDelivered.Status = ParcelStatusSent
+	notDelivered.PublicID = ""
+	sentID, err := store.Add(notDelivered)
+	require.NoError(t, err)
+
+	// archive
+	moved, err := store.archive(now.Add(-24*time.Hour), 2)
+	require.NoError(t, err)
+	require.Equal(t, len(archived), moved)
+
+	// check
+	for _, p := range archived {
+		_, err := store.Get(p.Number)
+		require.ErrorIs(t, err, sql.ErrNoRows)
+
+		stored, err := store.GetArchived(p.Number)
+		require.NoError(t, err)
+		assert.Equal(t, p, stored)
+	}
+	for _, id := range []int{recentID, sentID} {
+		_, err := store.Get(id)
+		require.NoError(t, err)
+	}
+
+	_, err = store.GetArchived(recentID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
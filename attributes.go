@@ -0,0 +1,175 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// ErrInvalidAttribute indicates that a parcel attribute is not registered
+// with the store or its value does not match the registered definition.
+var ErrInvalidAttribute = newError(CodeInvalidAttribute, "invalid parcel attribute")
+
+var attrKey = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// AttrType is the type of value an attribute holds. Values are stored as
+// strings; the type decides which strings are accepted.
+type AttrType int
+
+const (
+	AttrString AttrType = iota
+	AttrInt
+	AttrBool
+)
+
+// AttrDef registers a deployment-specific parcel attribute, e.g. a locker
+// code, with its type and an optional extra validation.
+type AttrDef struct {
+	Key      string
+	Type     AttrType
+	Validate func(value string) error
+}
+
+// check reports whether value is acceptable for the attribute.
+func (d AttrDef) check(value string) error {
+	var err error
+	switch d.Type {
+	case AttrInt:
+		_, err = strconv.Atoi(value)
+	case AttrBool:
+		_, err = strconv.ParseBool(value)
+	}
+	if err == nil && d.Validate != nil {
+		err = d.Validate(value)
+	}
+	if err != nil {
+		return fmt.Errorf("%w %q: %v", ErrInvalidAttribute, d.Key, err)
+	}
+	return nil
+}
+
+// Attributes holds the extensible attributes of a parcel, stored in the
+// JSON "attributes" column. Use the typed accessors to read them.
+type Attributes map[string]string
+
+// String returns the attribute value and whether it is set.
+func (a Attributes) String(key string) (string, bool) {
+	v, ok := a[key]
+	return v, ok
+}
+
+// Int returns the attribute parsed as an int; ok is false if the
+// attribute is unset or not an integer.
+func (a Attributes) Int(key string) (int, bool) {
+	v, ok := a[key]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(v)
+	return n, err == nil
+}
+
+// Bool returns the attribute parsed as a bool; ok is false if the
+// attribute is unset or not a boolean.
+func (a Attributes) Bool(key string) (bool, bool) {
+	v, ok := a[key]
+	if !ok {
+		return false, false
+	}
+	b, err := strconv.ParseBool(v)
+	return b, err == nil
+}
+
+// encodeAttributes returns the JSON stored for a; nil and empty maps
+// are stored as "{}".
+func encodeAttributes(a Attributes) (string, error) {
+	if len(a) == 0 {
+		return "{}", nil
+	}
+	data, err := json.Marshal(a)
+	return string(data), err
+}
+
+// decodeAttributes parses the stored JSON; an empty object yields nil.
+func decodeAttributes(data string) (Attributes, error) {
+	var a Attributes
+	if err := json.Unmarshal([]byte(data), &a); err != nil {
+		return nil, err
+	}
+	if len(a) == 0 {
+		return nil, nil
+	}
+	return a, nil
+}
+
+// WithAttributes returns a copy of the store that accepts the given
+// attribute definitions in Add and SetAttr. Attributes without a
+// definition are rejected.
+func (s ParcelStore) WithAttributes(defs ...AttrDef) ParcelStore {
+	attrs := make(map[string]AttrDef, len(s.attrs)+len(defs))
+	for k, d := range s.attrs {
+		attrs[k] = d
+	}
+	for _, d := range defs {
+		attrs[d.Key] = d
+	}
+	s.attrs = attrs
+	return s
+}
+
+// validateAttr checks key and value against the registered definitions.
+func (s ParcelStore) validateAttr(key, value string) error {
+	def, ok := s.attrs[key]
+	if !ok || !attrKey.MatchString(key) {
+		return fmt.Errorf("%w %q: not registered", ErrInvalidAttribute, key)
+	}
+	return def.check(value)
+}
+
+// SetAttr sets one attribute of a parcel, leaving the others untouched.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidAttribute (wrapped) if key is not registered with
+//     WithAttributes or value does not match its definition.
+//   - Returns sql.ErrNoRows (wrapped) if the parcel does not exist.
+//   - Wraps and returns any SQL error from the UPDATE.
+func (s ParcelStore) SetAttr(number int, key, value string) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	if err := s.validateAttr(key, value); err != nil {
+		return fmt.Errorf("failed to set attribute for parcel with number %d: %w", number, err)
+	}
+
+	s.invalidateParcel(number)
+	// key is validated against attrKey, so it is safe inside the JSON path.
+	query := "UPDATE parcel SET attributes = json_set(attributes, :path, :value) WHERE number = :number"
+	res, err := s.conn().Exec(query, sql.Named("path", "$."+key), sql.Named("value", value),
+		sql.Named("number", number))
+	if err != nil {
+		return fmt.Errorf("failed to set attribute %q for parcel with number %d: %w", key, number, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("failed to set attribute %q for parcel with number %d: %w", key, number, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// GetAttr returns one attribute of a parcel and whether it is set.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns sql.ErrNoRows (wrapped) if the parcel does not exist.
+//   - Wraps and returns any SQL errors.
+func (s ParcelStore) GetAttr(number int, key string) (string, bool, error) {
+	p, err := s.Get(number)
+	if err != nil {
+		return "", false, err
+	}
+	v, ok := p.Attributes.String(key)
+	return v, ok, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getAttrTestStore returns a store with a locker code and a fragile flag
+// registered.
+func getAttrTestStore(t *testing.T) ParcelStore {
+	t.Helper()
+	db := getTestDB(t)
+	t.Cleanup(func() { db.Close() })
+
+	return NewParcelStore(db).WithAttributes(
+		AttrDef{Key: "locker_code", Type: AttrString, Validate: func(v string) error {
+			if len(v) != 4 {
+				return errors.New("must be 4 characters")
+			}
+			return nil
+		}},
+		AttrDef{Key: "fragile", Type: AttrBool},
+		AttrDef{Key: "floor", Type: AttrInt},
+	)
+}
+
+// TestAddGetWithAttributes verifies that attributes round-trip and are
+// readable through the typed accessors.
+func TestAddGetWithAttributes(t *testing.T) {
+	// prepare
+	store, parcel := getAttrTestStore(t), getTestParcel()
+	parcel.Attributes = Attributes{"locker_code": "A1B2", "fragile": "true"}
+	parcel.PublicID = getTestPublicID(t)
+
+	// add
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	parcel.Number, parcel.TrackingCode = id, NewTrackingCode(trackingYear(parcel.CreatedAt), id)
+	parcel.ClientRef = 1
+
+	// set
+	require.NoError(t, store.SetAttr(id, "floor", "7"))
+	parcel.Attributes["floor"] = "7"
+
+	// check
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, parcel, stored)
+
+	fragile, ok := stored.Attributes.Bool("fragile")
+	assert.True(t, ok)
+	assert.True(t, fragile)
+	floor, ok := stored.Attributes.Int("floor")
+	assert.True(t, ok)
+	assert.Equal(t, 7, floor)
+
+	code, ok, err := store.GetAttr(id, "locker_code")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "A1B2", code)
+}
+
+// TestSetAttrWhenInvalid ensures that unregistered keys, mistyped values
+// and missing parcels are rejected.
+func TestSetAttrWhenInvalid(t *testing.T) {
+	// prepare
+	store, parcel := getAttrTestStore(t), getTestParcel()
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	// set
+	require.ErrorIs(t, store.SetAttr(id, "unknown", "x"), ErrInvalidAttribute)
+	require.ErrorIs(t, store.SetAttr(id, "floor", "seventh"), ErrInvalidAttribute)
+	require.ErrorIs(t, store.SetAttr(id, "locker_code", "A1"), ErrInvalidAttribute)
+	require.ErrorIs(t, store.SetAttr(id+1, "floor", "1"), sql.ErrNoRows)
+
+	parcel.Attributes = Attributes{"fragile": "maybe"}
+	_, err = store.Add(parcel)
+	require.ErrorIs(t, err, ErrInvalidAttribute)
+
+	// check
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	assert.Nil(t, stored.Attributes)
+}
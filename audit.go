@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// AuditDriver is the name of the database/sql driver that passes every
+// statement to SQLite after auditing it with DefaultSQLAudit. Select it
+// with the driver setting of the configuration (see DatabaseConfig) to
+// debug a deployment; the test suite runs on it throughout.
+const AuditDriver = "sqlite-audit"
+
+// DefaultSQLAudit audits the statements of AuditDriver and logs every
+// violation it finds.
+var DefaultSQLAudit = &SQLAudit{
+	OnViolation: func(v AuditViolation) { log.Printf("sql audit: %s", v) },
+}
+
+func init() {
+	db, err := sql.Open(driver, "")
+	if err != nil {
+		panic(err)
+	}
+	sql.Register(AuditDriver, auditDriver{next: db.Driver(), audit: DefaultSQLAudit})
+}
+
+// AuditViolation is a statement that appears to carry values in its text
+// rather than as parameters.
+type AuditViolation struct {
+	Query  string
+	Reason string
+}
+
+func (v AuditViolation) String() string {
+	return fmt.Sprintf("%s: %q", v.Reason, v.Query)
+}
+
+// SQLAudit checks that statements reading or writing data pass their
+// values as parameters. A statement cannot tell a constant from an
+// interpolated value, so the audit compares executions instead: the text
+// of a statement built from constants is the same every time, whereas
+// one with a value interpolated into it changes with the value.
+//
+// Behaviour:
+//   - Audits SELECT, INSERT, UPDATE, DELETE, REPLACE, VALUES and WITH
+//     statements only; schema changes and pragmas are not user input.
+//   - Reports a statement whose literals, strings and numbers alike,
+//     differ from those of an earlier statement that is the same
+//     otherwise, once per such statement.
+//   - Reports a statement followed by another in the same text, the
+//     shape of an injected "; DROP TABLE".
+//
+// An SQLAudit remembers the shape of every statement it has seen, so it
+// is meant for debugging and tests rather than for production. It is
+// safe for concurrent use.
+type SQLAudit struct {
+	// OnViolation, if set, is called with every violation as it is found.
+	OnViolation func(AuditViolation)
+
+	mu         sync.Mutex
+	seen       map[string]string
+	reported   map[string]bool
+	violations []AuditViolation
+}
+
+// Check audits query and reports whether it is free of violations.
+func (a *SQLAudit) Check(query string) bool {
+	shape, literals, stacked, ok := scanStatement(query)
+	if !ok {
+		return true
+	}
+
+	a.mu.Lock()
+	var found []AuditViolation
+	if stacked {
+		found = append(found, AuditViolation{Query: query, Reason: "more than one statement"})
+	}
+	if a.seen == nil {
+		a.seen, a.reported = make(map[string]string), make(map[string]bool)
+	}
+	if prev, ok := a.seen[shape]; !ok {
+		a.seen[shape] = literals
+	} else if prev != literals && !a.reported[shape] {
+		a.reported[shape] = true
+		found = append(found, AuditViolation{Query: query, Reason: "literals vary between executions"})
+	}
+	a.violations = append(a.violations, found...)
+	a.mu.Unlock()
+
+	if a.OnViolation != nil {
+		for _, v := range found {
+			a.OnViolation(v)
+		}
+	}
+	return len(found) == 0
+}
+
+// Violations returns the violations found so far, oldest first.
+func (a *SQLAudit) Violations() []AuditViolation {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]AuditViolation(nil), a.violations...)
+}
+
+// auditedKeywords are the statements an SQLAudit checks.
+var auditedKeywords = map[string]bool{
+	"SELECT": true, "INSERT": true, "UPDATE": true, "DELETE": true,
+	"REPLACE": true, "VALUES": true, "WITH": true,
+}
+
+// scanStatement returns query with its literals replaced by "?", the
+// literals themselves, and whether another statement follows the first.
+// ok is false if query is not a statement SQLAudit checks.
+func scanStatement(query string) (shape, literals string, stacked, ok bool) {
+	var b, lits strings.Builder
+	ended := false
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			i += end
+			continue
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end + 4
+			}
+			continue
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		if ended {
+			stacked = true
+		}
+
+		switch {
+		case c == ';':
+			ended = true
+			i++
+		case c == '\'':
+			end := quoteEnd(query, i, '\'')
+			lits.WriteString(query[i:end])
+			lits.WriteByte(0)
+			b.WriteByte('?')
+			i = end
+		case c == '"' || c == '`':
+			end := quoteEnd(query, i, c)
+			b.WriteString(query[i:end])
+			i = end
+		case c == '[':
+			end := strings.IndexByte(query[i:], ']')
+			if end < 0 {
+				end = len(query) - i - 1
+			}
+			b.WriteString(query[i : i+end+1])
+			i += end + 1
+		case isDigit(c) || c == '.' && i+1 < len(query) && isDigit(query[i+1]):
+			end := i + 1
+			for end < len(query) && (isWordByte(query[end]) || query[end] == '.') {
+				end++
+			}
+			lits.WriteString(query[i:end])
+			lits.WriteByte(0)
+			b.WriteByte('?')
+			i = end
+		case isWordByte(c) || c == ':' || c == '@' || c == '$' || c == '?':
+			end := i + 1
+			for end < len(query) && isWordByte(query[end]) {
+				end++
+			}
+			b.WriteString(query[i:end])
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	keyword, _, _ := strings.Cut(strings.TrimLeft(b.String(), " \t\n\r("), " ")
+	if !auditedKeywords[strings.ToUpper(strings.TrimSpace(keyword))] {
+		return "", "", false, false
+	}
+	return b.String(), lits.String(), stacked, true
+}
+
+// quoteEnd returns the index just past the quoted string or identifier
+// starting at query[start], a doubled quote being part of it.
+func quoteEnd(query string, start int, quote byte) int {
+	for i := start + 1; i < len(query); i++ {
+		if query[i] != quote {
+			continue
+		}
+		if i+1 < len(query) && query[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(query)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// auditDriver opens connections of next whose statements are checked by
+// audit before they run.
+type auditDriver struct {
+	next  sqldriver.Driver
+	audit *SQLAudit
+}
+
+func (d auditDriver) Open(name string) (sqldriver.Conn, error) {
+	conn, err := d.next.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return auditConn{Conn: conn, audit: d.audit}, nil
+}
+
+// auditConn audits every statement prepared or run on Conn, passing on
+// the optional interfaces Conn implements.
+type auditConn struct {
+	sqldriver.Conn
+	audit *SQLAudit
+}
+
+// Unwrap returns the connection of the underlying driver, e.g. for
+// sql.Conn.Raw.
+func (c auditConn) Unwrap() sqldriver.Conn {
+	return c.Conn
+}
+
+func (c auditConn) Prepare(query string) (sqldriver.Stmt, error) {
+	c.audit.Check(query)
+	return c.Conn.Prepare(query)
+}
+
+func (c auditConn) PrepareContext(ctx context.Context, query string) (sqldriver.Stmt, error) {
+	c.audit.Check(query)
+	if p, ok := c.Conn.(sqldriver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c auditConn) ExecContext(ctx context.Context, query string, args []sqldriver.NamedValue) (sqldriver.Result, error) {
+	e, ok := c.Conn.(sqldriver.ExecerContext)
+	if !ok {
+		return nil, sqldriver.ErrSkip
+	}
+	c.audit.Check(query)
+	return e.ExecContext(ctx, query, args)
+}
+
+func (c auditConn) QueryContext(ctx context.Context, query string, args []sqldriver.NamedValue) (sqldriver.Rows, error) {
+	q, ok := c.Conn.(sqldriver.QueryerContext)
+	if !ok {
+		return nil, sqldriver.ErrSkip
+	}
+	c.audit.Check(query)
+	return q.QueryContext(ctx, query, args)
+}
+
+func (c auditConn) BeginTx(ctx context.Context, opts sqldriver.TxOptions) (sqldriver.Tx, error) {
+	if b, ok := c.Conn.(sqldriver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c auditConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(sqldriver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Operations of audit entries: the changes of the parcel row, from the
+// change feed, and the entries of the histories and status overrides.
+const (
+	AuditCreate   = "create"
+	AuditUpdate   = "update"
+	AuditDelete   = "delete"
+	AuditStatus   = "status"
+	AuditAddress  = "address"
+	AuditOverride = "override"
+)
+
+// auditOperations lists the operations of audit entries, for validation.
+var auditOperations = []string{AuditCreate, AuditUpdate, AuditDelete, AuditStatus, AuditAddress, AuditOverride}
+
+// Limits of the number of entries returned by ListAuditEntries.
+const (
+	DefaultAuditLimit = 1000
+	MaxAuditLimit     = 100_000
+)
+
+// AuditEntry is a change to a parcel and who made it.
+type AuditEntry struct {
+	// At is the RFC 3339 time of the change.
+	At string
+	// Actor made the change (see Actor.String); empty if unknown.
+	Actor     string
+	Number    int
+	Operation string
+	// Detail describes the change: the status set, the statuses and
+	// reason of an override, the note of a status change. Addresses are
+	// left out; see GetAddressHistory.
+	Detail string
+}
+
+// AuditFilter selects audit entries; zero fields select everything.
+type AuditFilter struct {
+	Actor     string
+	Number    int
+	Operation string
+	// From and To bound the time of entries, From inclusive and To
+	// exclusive.
+	From, To time.Time
+	// Limit bounds the entries returned; zero means DefaultAuditLimit.
+	Limit int
+}
+
+// auditLog is the union of the audit records, with the columns of
+// AuditEntry.
+const auditLog = `(SELECT changed_at AS at, actor, parcel_number AS number, op AS operation, '' AS detail
+    FROM parcel_change
+UNION ALL SELECT changed_at, actor, parcel_number, 'status',
+    CASE WHEN note = '' THEN status ELSE status || ': ' || note END
+    FROM parcel_status_history
+UNION ALL SELECT set_at, actor, parcel_number, 'address', status FROM parcel_address_history
+UNION ALL SELECT overridden_at, actor, parcel_number, 'override', old_status || ' -> ' || new_status || ': ' || reason
+    FROM status_override) AS audit`
+
+// ListAuditEntries returns the audit entries the filter selects, oldest
+// first, for compliance reviews: who created, changed or deleted which
+// parcel, and when. The entries are assembled from the change feed (see
+// GetChangesSince), the status and address histories and the status
+// overrides; actors are those recorded with them (see WithActor), and
+// entries from before actors were recorded have none.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidFilter (wrapped) for an unknown operation, a
+//     negative limit or From after To.
+//   - Limits above MaxAuditLimit are lowered to it.
+//   - Returns an empty slice if no entry matches.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) ListAuditEntries(f AuditFilter) ([]AuditEntry, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	q := selectFrom(auditLog, "at, actor, number, operation, detail")
+	if f.Actor != "" {
+		q = q.Where("actor = ?", f.Actor)
+	}
+	if f.Number != 0 {
+		q = q.Where("number = ?", f.Number)
+	}
+	if f.Operation != "" {
+		if !contains(auditOperations, f.Operation) {
+			return nil, fmt.Errorf("failed to list audit entries: %w: operation %q", ErrInvalidFilter, f.Operation)
+		}
+		q = q.Where("operation = ?", f.Operation)
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && f.From.After(f.To) {
+		return nil, fmt.Errorf("failed to list audit entries: %w: from %s after to %s", ErrInvalidFilter,
+			f.From.Format(time.RFC3339), f.To.Format(time.RFC3339))
+	}
+	if !f.From.IsZero() {
+		q = q.Where("at >= ?", FormatTimestamp(f.From, DefaultTimestampPrecision))
+	}
+	if !f.To.IsZero() {
+		q = q.Where("at < ?", FormatTimestamp(f.To, DefaultTimestampPrecision))
+	}
+	switch {
+	case f.Limit < 0:
+		return nil, fmt.Errorf("failed to list audit entries: %w: limit %d", ErrInvalidFilter, f.Limit)
+	case f.Limit == 0:
+		f.Limit = DefaultAuditLimit
+	}
+	query, args := q.OrderBy("at", "number").Limit(min(f.Limit, MaxAuditLimit)).build()
+
+	rows, err := s.conn().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	res := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.At, &e.Actor, &e.Number, &e.Operation, &e.Detail); err != nil {
+			return nil, fmt.Errorf("failed to scan one of audit entries: %w", err)
+		}
+		res = append(res, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate audit entries: %w", err)
+	}
+	return res, nil
+}
+
+// AuditCSV returns entries as CSV records, the first of which is the
+// header.
+func AuditCSV(entries []AuditEntry) [][]string {
+	res := [][]string{{"at", "actor", "parcel", "operation", "detail"}}
+	for _, e := range entries {
+		res = append(res, []string{e.At, e.Actor, strconv.Itoa(e.Number), e.Operation, e.Detail})
+	}
+	return res
+}
+
+// AuditEntries returns the audit entries the filter selects; see
+// ParcelStore.ListAuditEntries.
+func (s ParcelService) AuditEntries(f AuditFilter) ([]AuditEntry, error) {
+	return s.store.ListAuditEntries(f)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestListAuditEntries verifies that the audit log gathers changes from
+// every record with their actors, and filters them.
+func TestListAuditEntries(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	alice := store.WithActor(Actor{Kind: ActorUser, ID: "alice"})
+	bob := store.WithActor(Actor{Kind: ActorUser, ID: "bob"})
+
+	number, err := alice.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, bob.SetAddress(number, "new address"))
+	require.NoError(t, bob.AddHistory(StatusChange{Number: number, Status: ParcelStatusSent,
+		ChangedAt: FormatTimestamp(time.Now(), DefaultTimestampPrecision), Note: "night shift"}))
+	other, err := alice.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, bob.Delete(other))
+
+	// check
+	entries, err := store.ListAuditEntries(AuditFilter{Actor: "user:bob"})
+	require.NoError(t, err)
+	var ops []string
+	for _, e := range entries {
+		ops = append(ops, e.Operation)
+	}
+	assert.ElementsMatch(t, []string{AuditUpdate, AuditAddress, AuditStatus, AuditDelete}, ops)
+
+	entries, err = store.ListAuditEntries(AuditFilter{Number: number, Operation: AuditStatus})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "sent: night shift", entries[0].Detail)
+	assert.Equal(t, "user:bob", entries[0].Actor)
+
+	entries, err = store.ListAuditEntries(AuditFilter{Number: other})
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+	entries, err = store.ListAuditEntries(AuditFilter{From: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	entries, err = store.ListAuditEntries(AuditFilter{Limit: 2})
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	_, err = store.ListAuditEntries(AuditFilter{Operation: "rename"})
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+	_, err = store.ListAuditEntries(AuditFilter{Limit: -1})
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+	_, err = store.ListAuditEntries(AuditFilter{From: time.Now(), To: time.Now().Add(-time.Hour)})
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+}
+
+// TestAuditHTTP verifies /audit, its CSV export and that only admins
+// read the audit log.
+func TestAuditHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	_, err := service.WithActor(Actor{Kind: ActorUser, ID: "alice"}).Register(1000, "test")
+	require.NoError(t, err)
+	h := NewHTTPHandler(service)
+
+	// check
+	rec := doRequest(t, h, http.MethodGet, "/audit?actor=user:alice&operation=create", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var entries []auditEntryJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, 1, entries[0].Number)
+
+	rec = doRequest(t, h, http.MethodGet, "/audit/export?actor=user:alice&from=2000-01-01", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/csv")
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	require.NoError(t, err)
+	require.Greater(t, len(records), 1)
+	assert.Equal(t, []string{"at", "actor", "parcel", "operation", "detail"}, records[0])
+	assert.Equal(t, "user:alice", records[1][1])
+
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodGet, "/audit?from=yesterday", "").Code)
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodGet, "/audit?operation=rename", "").Code)
+
+	_, err = NewAuthorizedService(service, Principal{Role: RoleOperator}).AuditEntries(AuditFilter{})
+	assert.ErrorIs(t, err, ErrForbidden)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain fails the suite if any statement run on a test database (see
+// getTestDB) interpolated its values, as a guard over the queries built
+// at run time.
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if violations := DefaultSQLAudit.Violations(); len(violations) > 0 && code == 0 {
+		fmt.Fprintf(os.Stderr, "FAIL: %d statements failed the SQL audit\n", len(violations))
+		code = 1
+	}
+	os.Exit(code)
+}
+
+// TestScanStatement verifies how statements are reduced to their shape
+// and literals.
+func TestScanStatement(t *testing.T) {
+	tests := []struct {
+		query    string
+		shape    string
+		literals string
+		stacked  bool
+		ok       bool
+	}{
+		{query: "SELECT * FROM parcel WHERE number = :number", shape: "SELECT * FROM parcel WHERE number = :number", ok: true},
+		{query: "SELECT * FROM parcel WHERE status = 'it''s' LIMIT 10", shape: "SELECT * FROM parcel WHERE status = ? LIMIT ?", literals: "'it''s'\x0010\x00", ok: true},
+		{query: `SELECT "a 1", p2, x1 FROM t -- 'comment'`, shape: `SELECT "a 1", p2, x1 FROM t `, ok: true},
+		{query: "  (SELECT 1.5e3)", shape: "  (SELECT ?)", literals: "1.5e3\x00", ok: true},
+		{query: "DELETE FROM parcel WHERE status = 'x'; DROP TABLE parcel; --';", shape: "DELETE FROM parcel WHERE status = ? DROP TABLE parcel ", literals: "'x'\x00", stacked: true, ok: true},
+		{query: "UPDATE parcel SET status = ?; ", shape: "UPDATE parcel SET status = ? ", ok: true},
+		{query: "PRAGMA user_version = 3"},
+		{query: "CREATE TABLE t (status TEXT DEFAULT 'x')"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			shape, literals, stacked, ok := scanStatement(tt.query)
+			assert.Equal(t, tt.ok, ok)
+			if !tt.ok {
+				return
+			}
+			assert.Equal(t, tt.shape, shape)
+			assert.Equal(t, tt.literals, literals)
+			assert.Equal(t, tt.stacked, stacked)
+		})
+	}
+}
+
+// auditConnector opens connections of the SQLite driver audited by audit.
+type auditConnector struct {
+	audit *SQLAudit
+}
+
+func (c auditConnector) Connect(context.Context) (sqldriver.Conn, error) {
+	return c.Driver().Open(":memory:")
+}
+
+func (c auditConnector) Driver() sqldriver.Driver {
+	db, _ := sql.Open(driver, "")
+	return auditDriver{next: db.Driver(), audit: c.audit}
+}
+
+// TestSQLAudit verifies that statements interpolating values are reported
+// once each, whether run directly or prepared, and parameterised ones are
+// not.
+func TestSQLAudit(t *testing.T) {
+	// prepare
+	var reported []AuditViolation
+	audit := &SQLAudit{OnViolation: func(v AuditViolation) { reported = append(reported, v) }}
+	db := sql.OpenDB(auditConnector{audit: audit})
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err := db.Exec("CREATE TABLE parcel (number INTEGER, status TEXT DEFAULT 'registered')")
+	require.NoError(t, err)
+
+	// run
+	for i, status := range []string{"sent", "delivered", "sent'; --"} {
+		_, err = db.Exec("INSERT INTO parcel (number, status) VALUES (?, ?)", i, status)
+		require.NoError(t, err)
+		_, err = db.Exec(fmt.Sprintf("UPDATE parcel SET status = 'registered' WHERE number = %d", i))
+		require.NoError(t, err)
+		stmt, err := db.Prepare("SELECT count(*) FROM parcel WHERE status = '" + status + "'")
+		if err == nil {
+			stmt.Close()
+		}
+	}
+	_, err = db.Exec("SELECT 1; SELECT 2")
+	require.NoError(t, err)
+
+	// check
+	violations := audit.Violations()
+	assert.Equal(t, reported, violations)
+	require.Len(t, violations, 3)
+	assert.Equal(t, "UPDATE parcel SET status = 'registered' WHERE number = 1", violations[0].Query)
+	assert.Equal(t, "literals vary between executions", violations[0].Reason)
+	assert.Equal(t, "SELECT count(*) FROM parcel WHERE status = 'delivered'", violations[1].Query)
+	assert.Equal(t, "more than one statement", violations[2].Reason)
+	assert.True(t, audit.Check("SELECT 1"))
+}
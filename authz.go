@@ -0,0 +1,1086 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrForbidden indicates that the caller's role does not permit the
+// requested operation on the parcel.
+var ErrForbidden = newError(CodeForbidden, "operation not permitted")
+
+// Role is what a caller of the service is allowed to do.
+type Role string
+
+const (
+	// RoleOperator registers parcels, takes payments and dispatches them.
+	RoleOperator Role = "operator"
+	// RoleCourier delivers dispatched parcels.
+	RoleCourier Role = "courier"
+	// RoleAdmin may do everything an operator may, delete parcels and
+	// force their status.
+	RoleAdmin Role = "admin"
+	// RoleClient sees and manages only the parcels of its own client.
+	RoleClient Role = "client"
+)
+
+// Operation is a permission checked by AuthorizedService.
+type Operation string
+
+const (
+	OpRegister      Operation = "register"
+	OpView          Operation = "view"
+	OpList          Operation = "list"
+	OpSend          Operation = "send"    // registered → sent → customs_cleared
+	OpDeliver       Operation = "deliver" // sent or customs_cleared → delivered
+	OpChangeAddress Operation = "change_address"
+	OpSetPayment    Operation = "set_payment"
+	OpDelete        Operation = "delete"
+	OpViewRoutes    Operation = "view_routes"
+	OpPlanRoutes    Operation = "plan_routes" // create routes, add, remove and reorder stops
+	OpManagePoints  Operation = "manage_pickup_points"
+	OpManageDepots  Operation = "manage_warehouses"
+	OpScan          Operation = "scan"            // record where a parcel is
+	OpSearch        Operation = "search"          // find parcels of any client by address
+	OpComment       Operation = "comment"         // read and write internal comments on parcels
+	OpOverride      Operation = "override_status" // force any status, bypassing the lifecycle
+	OpRepack        Operation = "repack"          // split and merge parcels at the warehouse
+	OpClaim         Operation = "claim"           // file and read insurance claims against parcels
+	OpSettleClaims  Operation = "settle_claims"   // list, approve, reject and pay claims
+	OpManageRules   Operation = "manage_rules"    // add and lift content restrictions
+	OpHold          Operation = "hold"            // place and release holds of any kind
+	OpReadChanges   Operation = "read_changes"    // read the change feed of all parcels
+	OpReadAudit     Operation = "read_audit"      // read and export the audit log
+	OpWorkQueue     Operation = "work_queue"      // report, assign and resolve ops work items
+	OpAddressBook   Operation = "address_book"    // manage the saved addresses of clients
+)
+
+// rolePermissions lists the operations each role may perform. Clients
+// are additionally restricted to their own parcels.
+var rolePermissions = map[Role][]Operation{
+	RoleOperator: {OpRegister, OpView, OpList, OpSend, OpChangeAddress, OpSetPayment,
+		OpViewRoutes, OpPlanRoutes, OpManagePoints, OpScan, OpSearch, OpComment, OpRepack, OpClaim, OpHold, OpWorkQueue, OpAddressBook},
+	RoleCourier: {OpView, OpList, OpDeliver, OpViewRoutes, OpScan, OpComment},
+	RoleAdmin: {OpRegister, OpView, OpList, OpSend, OpChangeAddress, OpSetPayment, OpDelete,
+		OpViewRoutes, OpPlanRoutes, OpManagePoints, OpManageDepots, OpScan, OpSearch, OpComment, OpOverride,
+		OpRepack, OpClaim, OpSettleClaims, OpManageRules, OpHold, OpReadChanges, OpReadAudit, OpWorkQueue, OpAddressBook},
+	RoleClient: {OpRegister, OpView, OpList, OpChangeAddress, OpClaim, OpAddressBook},
+}
+
+// Principal identifies the caller of an AuthorizedService.
+type Principal struct {
+	Role Role
+	// Client is the client the caller acts for; used only with RoleClient.
+	Client int
+	// KeyID is the API key the caller authenticated with, 0 if none.
+	KeyID int
+}
+
+// String describes the principal for audit entries, e.g. "admin" or
+// "admin key 3".
+func (p Principal) String() string {
+	s := string(p.Role)
+	if p.Role == RoleClient {
+		s += " " + strconv.Itoa(p.Client)
+	}
+	if p.KeyID != 0 {
+		s += " key " + strconv.Itoa(p.KeyID)
+	}
+	return s
+}
+
+// Can reports whether the principal's role permits op.
+func (p Principal) Can(op Operation) bool {
+	for _, allowed := range rolePermissions[p.Role] {
+		if allowed == op {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizedService wraps a ParcelService and checks every call against
+// the permissions of a Principal before it reaches the store. Denied
+// calls return ErrForbidden (wrapped).
+type AuthorizedService struct {
+	service ParcelService
+	who     Principal
+}
+
+// NewAuthorizedService returns service restricted to what who may do.
+func NewAuthorizedService(service ParcelService, who Principal) AuthorizedService {
+	return AuthorizedService{service: service, who: who}
+}
+
+// can checks that the principal's role permits op.
+func (a AuthorizedService) can(op Operation) error {
+	if !a.who.Can(op) {
+		return fmt.Errorf("%w: role %q cannot %s", ErrForbidden, a.who.Role, op)
+	}
+	return nil
+}
+
+// authorize checks that the principal may perform op on parcels of client.
+func (a AuthorizedService) authorize(op Operation, client int) error {
+	if err := a.can(op); err != nil {
+		return err
+	}
+	if a.who.Role == RoleClient && client != a.who.Client {
+		return fmt.Errorf("%w: client %d cannot %s parcels of client %d", ErrForbidden, pii(a.who.Client), op, pii(client))
+	}
+	return nil
+}
+
+// authorizeParcel checks that the principal may perform op on the parcel
+// with the given number and returns the parcel.
+func (a AuthorizedService) authorizeParcel(op Operation, number int) (Parcel, error) {
+	if err := a.can(op); err != nil {
+		return Parcel{}, err
+	}
+	parcel, err := a.service.Get(number)
+	if err != nil {
+		return parcel, err
+	}
+	return parcel, a.authorize(op, parcel.Client)
+}
+
+// own returns the parcels the principal may see: for a client only its
+// own, for other roles all of them.
+func (a AuthorizedService) own(parcels []Parcel) []Parcel {
+	if a.who.Role != RoleClient {
+		return parcels
+	}
+	res := parcels[:0]
+	for _, p := range parcels {
+		if p.Client == a.who.Client {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// AllowDuplicates returns a copy that skips the duplicate check on
+// Register; see ParcelService.AllowDuplicates.
+func (a AuthorizedService) AllowDuplicates() AuthorizedService {
+	a.service = a.service.AllowDuplicates()
+	return a
+}
+
+// Register registers a parcel; see ParcelService.RegisterParcel.
+func (a AuthorizedService) Register(draft Parcel) (Parcel, error) {
+	if err := a.authorize(OpRegister, draft.Client); err != nil {
+		return Parcel{}, err
+	}
+	return a.service.RegisterParcel(draft)
+}
+
+// RegisterToSavedAddress registers a parcel to a saved address of its
+// client; it requires OpRegister.
+func (a AuthorizedService) RegisterToSavedAddress(draft Parcel, id int) (Parcel, error) {
+	if err := a.authorize(OpRegister, draft.Client); err != nil {
+		return Parcel{}, err
+	}
+	return a.service.RegisterToSavedAddress(draft, id)
+}
+
+// SaveParcelTemplate saves a parcel template of a client; it requires
+// OpRegister.
+func (a AuthorizedService) SaveParcelTemplate(t ParcelTemplate) (ParcelTemplate, error) {
+	if err := a.authorize(OpRegister, t.Client); err != nil {
+		return ParcelTemplate{}, err
+	}
+	return a.service.SaveParcelTemplate(t)
+}
+
+// ParcelTemplate returns the parcel template with the given id; it
+// requires OpRegister on its client.
+func (a AuthorizedService) ParcelTemplate(id int) (ParcelTemplate, error) {
+	if err := a.can(OpRegister); err != nil {
+		return ParcelTemplate{}, err
+	}
+	t, err := a.service.ParcelTemplate(id)
+	if err != nil {
+		return t, err
+	}
+	if err := a.authorize(OpRegister, t.Client); err != nil {
+		return ParcelTemplate{}, err
+	}
+	return t, nil
+}
+
+// ParcelTemplates returns the parcel templates of a client; it requires
+// OpRegister.
+func (a AuthorizedService) ParcelTemplates(client int) ([]ParcelTemplate, error) {
+	if err := a.authorize(OpRegister, client); err != nil {
+		return nil, err
+	}
+	return a.service.ParcelTemplates(client)
+}
+
+// DeleteParcelTemplate deletes a parcel template; it requires OpRegister
+// on its client.
+func (a AuthorizedService) DeleteParcelTemplate(id int) error {
+	if _, err := a.ParcelTemplate(id); err != nil {
+		return err
+	}
+	return a.service.DeleteParcelTemplate(id)
+}
+
+// RegisterFromTemplate registers a parcel from a template; it requires
+// OpRegister on its client.
+func (a AuthorizedService) RegisterFromTemplate(id int) (Parcel, error) {
+	if _, err := a.ParcelTemplate(id); err != nil {
+		return Parcel{}, err
+	}
+	return a.service.RegisterFromTemplate(id)
+}
+
+// ScheduleRegistration schedules the registration of a parcel of a
+// client; it requires OpRegister.
+func (a AuthorizedService) ScheduleRegistration(draft Parcel, at time.Time) (ParcelDraft, error) {
+	if err := a.authorize(OpRegister, draft.Client); err != nil {
+		return ParcelDraft{}, err
+	}
+	return a.service.ScheduleRegistration(draft, at)
+}
+
+// SaveDraft saves a parcel draft of a client; it requires OpRegister.
+func (a AuthorizedService) SaveDraft(draft Parcel) (ParcelDraft, error) {
+	if err := a.authorize(OpRegister, draft.Client); err != nil {
+		return ParcelDraft{}, err
+	}
+	return a.service.SaveDraft(draft)
+}
+
+// UpdateDraft changes a parcel draft; it requires OpRegister on its
+// client.
+func (a AuthorizedService) UpdateDraft(id int, parcel Parcel) (ParcelDraft, error) {
+	if _, err := a.Draft(id); err != nil {
+		return ParcelDraft{}, err
+	}
+	return a.service.UpdateDraft(id, parcel)
+}
+
+// ConfirmDraft registers the parcel of a draft; it requires OpRegister on
+// its client.
+func (a AuthorizedService) ConfirmDraft(id int) (Parcel, error) {
+	if _, err := a.Draft(id); err != nil {
+		return Parcel{}, err
+	}
+	return a.service.ConfirmDraft(id)
+}
+
+// Draft returns the parcel draft with the given id; it requires
+// OpRegister on its client.
+func (a AuthorizedService) Draft(id int) (ParcelDraft, error) {
+	if err := a.can(OpRegister); err != nil {
+		return ParcelDraft{}, err
+	}
+	d, err := a.service.Draft(id)
+	if err != nil {
+		return d, err
+	}
+	if err := a.authorize(OpRegister, d.Parcel.Client); err != nil {
+		return ParcelDraft{}, err
+	}
+	return d, nil
+}
+
+// Drafts returns the parcel drafts of a client; it requires OpRegister.
+func (a AuthorizedService) Drafts(client int) ([]ParcelDraft, error) {
+	if err := a.authorize(OpRegister, client); err != nil {
+		return nil, err
+	}
+	return a.service.Drafts(client)
+}
+
+// DiscardDraft deletes a parcel draft; it requires OpRegister on its
+// client.
+func (a AuthorizedService) DiscardDraft(id int) error {
+	if _, err := a.Draft(id); err != nil {
+		return err
+	}
+	return a.service.DiscardDraft(id)
+}
+
+// SaveAddress adds an address to the address book of a client; it
+// requires OpAddressBook.
+func (a AuthorizedService) SaveAddress(addr SavedAddress) (SavedAddress, error) {
+	if err := a.authorize(OpAddressBook, addr.Client); err != nil {
+		return SavedAddress{}, err
+	}
+	return a.service.SaveAddress(addr)
+}
+
+// UpdateSavedAddress changes a saved address of a client; it requires
+// OpAddressBook.
+func (a AuthorizedService) UpdateSavedAddress(addr SavedAddress) (SavedAddress, error) {
+	if err := a.authorize(OpAddressBook, addr.Client); err != nil {
+		return SavedAddress{}, err
+	}
+	return a.service.UpdateSavedAddress(addr)
+}
+
+// DeleteSavedAddress removes a saved address of a client; it requires
+// OpAddressBook.
+func (a AuthorizedService) DeleteSavedAddress(client, id int) error {
+	if err := a.authorize(OpAddressBook, client); err != nil {
+		return err
+	}
+	return a.service.DeleteSavedAddress(client, id)
+}
+
+// SavedAddresses returns the address book of a client; it requires
+// OpAddressBook.
+func (a AuthorizedService) SavedAddresses(client int) ([]SavedAddress, error) {
+	if err := a.authorize(OpAddressBook, client); err != nil {
+		return nil, err
+	}
+	return a.service.SavedAddresses(client)
+}
+
+// Get returns the parcel with the given number.
+func (a AuthorizedService) Get(number int) (Parcel, error) {
+	return a.authorizeParcel(OpView, number)
+}
+
+// GetByTrackingCode returns the parcel with the given tracking code.
+func (a AuthorizedService) GetByTrackingCode(code string) (Parcel, error) {
+	if err := a.can(OpView); err != nil {
+		return Parcel{}, err
+	}
+	parcel, err := a.service.GetByTrackingCode(code)
+	if err != nil {
+		return parcel, err
+	}
+	if err := a.authorize(OpView, parcel.Client); err != nil {
+		return Parcel{}, err
+	}
+	return parcel, nil
+}
+
+// GetByPublicID returns the parcel with the given public ID.
+func (a AuthorizedService) GetByPublicID(id string) (Parcel, error) {
+	if err := a.can(OpView); err != nil {
+		return Parcel{}, err
+	}
+	parcel, err := a.service.GetByPublicID(id)
+	if err != nil {
+		return parcel, err
+	}
+	if err := a.authorize(OpView, parcel.Client); err != nil {
+		return Parcel{}, err
+	}
+	return parcel, nil
+}
+
+// History returns the status history of the parcel.
+func (a AuthorizedService) History(number int) ([]StatusChange, error) {
+	if _, err := a.authorizeParcel(OpView, number); err != nil {
+		return nil, err
+	}
+	return a.service.History(number)
+}
+
+// AddressHistory returns every address the parcel has had.
+func (a AuthorizedService) AddressHistory(number int) ([]AddressHistoryEntry, error) {
+	if _, err := a.authorizeParcel(OpView, number); err != nil {
+		return nil, err
+	}
+	return a.service.AddressHistory(number)
+}
+
+// Label writes the shipping label of the parcel to w.
+func (a AuthorizedService) Label(number int, w io.Writer) error {
+	parcel, err := a.authorizeParcel(OpView, number)
+	if err != nil {
+		return err
+	}
+	return RenderLabel(w, parcel)
+}
+
+// FindParcels returns the parcels matching filter. A client only ever
+// sees its own parcels, whatever the filter asks for.
+func (a AuthorizedService) FindParcels(filter ParcelFilter) ([]Parcel, error) {
+	if a.who.Role == RoleClient {
+		if filter.Client != 0 && filter.Client != a.who.Client {
+			return nil, fmt.Errorf("%w: client %d cannot %s parcels of client %d", ErrForbidden, pii(a.who.Client), OpList, pii(filter.Client))
+		}
+		filter.Client = a.who.Client
+	}
+	if err := a.authorize(OpList, filter.Client); err != nil {
+		return nil, err
+	}
+	return a.service.FindParcels(filter)
+}
+
+// ParcelSummary returns the parcel summary of client, or of every client
+// if it is 0. A client only ever sees its own.
+func (a AuthorizedService) ParcelSummary(client int, period ReportPeriod) ([]SummaryCount, error) {
+	if a.who.Role == RoleClient && client == 0 {
+		client = a.who.Client
+	}
+	if err := a.authorize(OpList, client); err != nil {
+		return nil, err
+	}
+	return a.service.ParcelSummary(client, period)
+}
+
+// Nearby returns the undelivered parcels near a position. A client only
+// sees its own parcels.
+func (a AuthorizedService) Nearby(lat, lon, radius float64) ([]Parcel, error) {
+	if err := a.can(OpList); err != nil {
+		return nil, err
+	}
+	parcels, err := a.service.Nearby(lat, lon, radius)
+	if err != nil {
+		return nil, err
+	}
+	return a.own(parcels), nil
+}
+
+// Search finds parcels of any client by address, which requires
+// OpSearch.
+func (a AuthorizedService) Search(query string, limit int) ([]Parcel, error) {
+	if err := a.can(OpSearch); err != nil {
+		return nil, err
+	}
+	return a.service.Search(query, limit)
+}
+
+// NextStatus advances the parcel. Sending and clearing customs require
+// OpSend and delivering requires OpDeliver.
+func (a AuthorizedService) NextStatus(number int) error {
+	if err := a.authorizeAdvance(number); err != nil {
+		return err
+	}
+	return a.service.NextStatus(number)
+}
+
+// SetStatus moves the parcel to its current or next status; see
+// ParcelService.SetStatus. Setting "delivered" requires OpDeliver and
+// any other status OpSend.
+func (a AuthorizedService) SetStatus(number int, status string) error {
+	op := OpSend
+	if status == ParcelStatusDelivered {
+		op = OpDeliver
+	}
+	if _, err := a.authorizeParcel(op, number); err != nil {
+		return err
+	}
+	return a.service.SetStatus(number, status)
+}
+
+// authorizeAdvance checks that the principal may move the parcel to its
+// next status: sending and clearing customs require OpSend, delivering
+// OpDeliver.
+func (a AuthorizedService) authorizeAdvance(number int) error {
+	parcel, err := a.service.Get(number)
+	if err != nil {
+		return err
+	}
+
+	op := OpDeliver
+	switch nextStatus(parcel) {
+	case ParcelStatusSent, ParcelStatusCustomsCleared:
+		op = OpSend
+	}
+	return a.authorize(op, parcel.Client)
+}
+
+// Subscribe registers h for the events of the parcels the principal may
+// view; see ParcelService.Subscribe.
+func (a AuthorizedService) Subscribe(h func(Event)) (unsubscribe func(), err error) {
+	if err := a.can(OpView); err != nil {
+		return nil, err
+	}
+	return a.service.Subscribe(func(e Event) {
+		if a.authorize(OpView, e.Parcel.Client) == nil {
+			h(e)
+		}
+	}), nil
+}
+
+// SetCustomsDeclaration sets the customs declaration of the parcel; it
+// requires OpRegister.
+func (a AuthorizedService) SetCustomsDeclaration(number int, reference string, hsCodes []string) error {
+	if _, err := a.authorizeParcel(OpRegister, number); err != nil {
+		return err
+	}
+	return a.service.SetCustomsDeclaration(number, reference, hsCodes)
+}
+
+// ChangeAddress changes the delivery address of the parcel.
+func (a AuthorizedService) ChangeAddress(number int, address string) error {
+	if _, err := a.authorizeParcel(OpChangeAddress, number); err != nil {
+		return err
+	}
+	return a.service.ChangeAddress(number, address)
+}
+
+// Reschedule sets the delivery window of the parcel. Whoever may change
+// its address may choose when it is delivered.
+func (a AuthorizedService) Reschedule(number int, w DeliveryWindow) error {
+	if _, err := a.authorizeParcel(OpChangeAddress, number); err != nil {
+		return err
+	}
+	return a.service.Reschedule(number, w)
+}
+
+// DeliverySlots returns the delivery slots on day with the room left.
+func (a AuthorizedService) DeliverySlots(day string) ([]SlotAvailability, error) {
+	if err := a.can(OpView); err != nil {
+		return nil, err
+	}
+	return a.service.DeliverySlots(day)
+}
+
+// holdOperation returns the operation a hold of kind takes: OpHold, or
+// for a client OpChangeAddress if it asks to hold its own parcel.
+func (a AuthorizedService) holdOperation(kind string) Operation {
+	if a.who.Role == RoleClient && strings.TrimSpace(kind) == HoldCustomer {
+		return OpChangeAddress
+	}
+	return OpHold
+}
+
+// Hold puts the parcel on hold; it requires OpHold, except that clients
+// may place a HoldCustomer on their own parcels. The actor is completed
+// as for ForceSetStatus.
+func (a AuthorizedService) Hold(number int, kind, reason, actor string) (Hold, error) {
+	if _, err := a.authorizeParcel(a.holdOperation(kind), number); err != nil {
+		return Hold{}, err
+	}
+	if actor = strings.TrimSpace(actor); actor == "" {
+		actor = a.who.String()
+	} else {
+		actor += " (" + a.who.String() + ")"
+	}
+	return a.service.Hold(number, kind, reason, actor)
+}
+
+// Release takes the parcel off hold; it requires the operation placing
+// its hold takes, so clients may only release holds they could place.
+func (a AuthorizedService) Release(number int) error {
+	parcel, err := a.authorizeParcel(OpView, number)
+	if err != nil {
+		return err
+	}
+	if _, err := a.authorizeParcel(a.holdOperation(parcel.Hold.Kind), number); err != nil {
+		return err
+	}
+	return a.service.Release(number)
+}
+
+// SetPaymentStatus changes the payment status of the parcel.
+func (a AuthorizedService) SetPaymentStatus(number int, status string) error {
+	if _, err := a.authorizeParcel(OpSetPayment, number); err != nil {
+		return err
+	}
+	return a.service.SetPaymentStatus(number, status)
+}
+
+// Delete removes a registered parcel.
+func (a AuthorizedService) Delete(number int) error {
+	if _, err := a.authorizeParcel(OpDelete, number); err != nil {
+		return err
+	}
+	return a.service.Delete(number)
+}
+
+// DeleteMany deletes a batch of registered parcels; see
+// ParcelService.DeleteMany. It takes OpDelete, which no client has, so
+// the parcels need no further checks.
+func (a AuthorizedService) DeleteMany(numbers []int) (DeleteReport, error) {
+	if err := a.can(OpDelete); err != nil {
+		return DeleteReport{}, err
+	}
+	return a.service.DeleteMany(numbers)
+}
+
+// CreateRoute creates an empty delivery route.
+func (a AuthorizedService) CreateRoute(courier, day string) (Route, error) {
+	if err := a.can(OpPlanRoutes); err != nil {
+		return Route{}, err
+	}
+	return a.service.CreateRoute(courier, day)
+}
+
+// Route returns the delivery route with the given id.
+func (a AuthorizedService) Route(id int) (Route, error) {
+	if err := a.can(OpViewRoutes); err != nil {
+		return Route{}, err
+	}
+	return a.service.Route(id)
+}
+
+// Routes returns the delivery routes of day.
+func (a AuthorizedService) Routes(day string) ([]Route, error) {
+	if err := a.can(OpViewRoutes); err != nil {
+		return nil, err
+	}
+	return a.service.Routes(day)
+}
+
+// AddRouteStop appends a parcel to the route.
+func (a AuthorizedService) AddRouteStop(route, number int) error {
+	if err := a.can(OpPlanRoutes); err != nil {
+		return err
+	}
+	return a.service.AddRouteStop(route, number)
+}
+
+// RemoveRouteStop takes a parcel off the route.
+func (a AuthorizedService) RemoveRouteStop(route, number int) error {
+	if err := a.can(OpPlanRoutes); err != nil {
+		return err
+	}
+	return a.service.RemoveRouteStop(route, number)
+}
+
+// ReorderRoute changes the order of the stops of the route.
+func (a AuthorizedService) ReorderRoute(route int, numbers []int) error {
+	if err := a.can(OpPlanRoutes); err != nil {
+		return err
+	}
+	return a.service.ReorderRoute(route, numbers)
+}
+
+// CompleteRouteStop delivers the parcel of a stop; it requires OpDeliver.
+func (a AuthorizedService) CompleteRouteStop(route, number int) error {
+	if err := a.can(OpDeliver); err != nil {
+		return err
+	}
+	return a.service.CompleteRouteStop(route, number)
+}
+
+// PickupPoints returns every pickup point.
+func (a AuthorizedService) PickupPoints() ([]PickupPoint, error) {
+	if err := a.can(OpView); err != nil {
+		return nil, err
+	}
+	return a.service.PickupPoints()
+}
+
+// PickupPoint returns the pickup point with the given id.
+func (a AuthorizedService) PickupPoint(id int) (PickupPoint, error) {
+	if err := a.can(OpView); err != nil {
+		return PickupPoint{}, err
+	}
+	return a.service.PickupPoint(id)
+}
+
+// AddPickupPoint creates a pickup point.
+func (a AuthorizedService) AddPickupPoint(p PickupPoint) (PickupPoint, error) {
+	if err := a.can(OpManagePoints); err != nil {
+		return p, err
+	}
+	return a.service.AddPickupPoint(p)
+}
+
+// AwaitingPickup returns the parcels awaiting pickup at the point. A
+// client only sees its own parcels.
+func (a AuthorizedService) AwaitingPickup(point int) ([]Parcel, error) {
+	if err := a.can(OpList); err != nil {
+		return nil, err
+	}
+	parcels, err := a.service.AwaitingPickup(point)
+	if err != nil {
+		return nil, err
+	}
+	return a.own(parcels), nil
+}
+
+// ChangesSince returns the changes of all parcels after cursor.
+func (a AuthorizedService) ChangesSince(cursor int64, limit int) ([]Change, error) {
+	if err := a.can(OpReadChanges); err != nil {
+		return nil, err
+	}
+	return a.service.ChangesSince(cursor, limit)
+}
+
+// AuditEntries returns the audit entries the filter selects.
+func (a AuthorizedService) AuditEntries(f AuditFilter) ([]AuditEntry, error) {
+	if err := a.can(OpReadAudit); err != nil {
+		return nil, err
+	}
+	return a.service.AuditEntries(f)
+}
+
+// Warehouses returns every warehouse.
+func (a AuthorizedService) Warehouses() ([]Warehouse, error) {
+	if err := a.can(OpView); err != nil {
+		return nil, err
+	}
+	return a.service.Warehouses()
+}
+
+// AddWarehouse creates a warehouse.
+func (a AuthorizedService) AddWarehouse(w Warehouse) (Warehouse, error) {
+	if err := a.can(OpManageDepots); err != nil {
+		return w, err
+	}
+	return a.service.AddWarehouse(w)
+}
+
+// RecordLocation records where the parcel was scanned.
+func (a AuthorizedService) RecordLocation(number, warehouse int, description string) (Location, error) {
+	if _, err := a.authorizeParcel(OpScan, number); err != nil {
+		return Location{}, err
+	}
+	return a.service.RecordLocation(number, warehouse, description)
+}
+
+// CurrentLocation returns where the parcel was last scanned.
+func (a AuthorizedService) CurrentLocation(number int) (Location, error) {
+	if _, err := a.authorizeParcel(OpView, number); err != nil {
+		return Location{}, err
+	}
+	return a.service.CurrentLocation(number)
+}
+
+// Locations returns the movement trail of the parcel.
+func (a AuthorizedService) Locations(number int) ([]Location, error) {
+	if _, err := a.authorizeParcel(OpView, number); err != nil {
+		return nil, err
+	}
+	return a.service.Locations(number)
+}
+
+// RecordScan records a scan of the parcel; see ParcelService.RecordScan.
+// Scanners are trusted to drive the lifecycle, so OpScan is all it takes.
+func (a AuthorizedService) RecordScan(number int, scanType string, location Location, at time.Time) (Scan, error) {
+	if _, err := a.authorizeParcel(OpScan, number); err != nil {
+		return Scan{}, err
+	}
+	return a.service.RecordScan(number, scanType, location, at)
+}
+
+// SyncScans applies a batch of offline scans of a courier device; see
+// ParcelService.SyncScans. Like RecordScan, it takes OpScan, which no
+// client has, so the parcels need no further checks.
+func (a AuthorizedService) SyncScans(device string, events []OfflineScan) ([]SyncResult, error) {
+	if err := a.can(OpScan); err != nil {
+		return nil, err
+	}
+	return a.service.SyncScans(device, events)
+}
+
+// Scans returns the scan events of the parcel.
+func (a AuthorizedService) Scans(number int) ([]Scan, error) {
+	if _, err := a.authorizeParcel(OpView, number); err != nil {
+		return nil, err
+	}
+	return a.service.Scans(number)
+}
+
+// AddComment leaves a comment on the parcel. Comments are internal to
+// staff, so clients may neither write nor read them.
+func (a AuthorizedService) AddComment(number int, author, text string) (Comment, error) {
+	if _, err := a.authorizeParcel(OpComment, number); err != nil {
+		return Comment{}, err
+	}
+	return a.service.AddComment(number, author, text)
+}
+
+// Comments returns the comments of the parcel.
+func (a AuthorizedService) Comments(number int) ([]Comment, error) {
+	if _, err := a.authorizeParcel(OpComment, number); err != nil {
+		return nil, err
+	}
+	return a.service.Comments(number)
+}
+
+// DeliverWithProof delivers the parcel with a proof of delivery, which
+// requires OpDeliver.
+func (a AuthorizedService) DeliverWithProof(number int, proof Proof) error {
+	if _, err := a.authorizeParcel(OpDeliver, number); err != nil {
+		return err
+	}
+	return a.service.DeliverWithProof(number, proof)
+}
+
+// Proof returns the proof of delivery of the parcel.
+func (a AuthorizedService) Proof(number int) (Proof, error) {
+	if _, err := a.authorizeParcel(OpView, number); err != nil {
+		return Proof{}, err
+	}
+	return a.service.Proof(number)
+}
+
+// ProofContent returns the image of the proof of delivery of the parcel.
+func (a AuthorizedService) ProofContent(number int) ([]byte, string, error) {
+	if _, err := a.authorizeParcel(OpView, number); err != nil {
+		return nil, "", err
+	}
+	return a.service.ProofContent(number)
+}
+
+// ForceSetStatus sets any status of the parcel; it requires OpOverride.
+// The audit entry names actor and the principal, or only the principal
+// if actor is empty.
+func (a AuthorizedService) ForceSetStatus(number int, status, reason, actor string) error {
+	if _, err := a.authorizeParcel(OpOverride, number); err != nil {
+		return err
+	}
+	if actor = strings.TrimSpace(actor); actor == "" {
+		actor = a.who.String()
+	} else {
+		actor += " (" + a.who.String() + ")"
+	}
+	return a.service.ForceSetStatus(number, status, reason, actor)
+}
+
+// ConfirmDeliveryCode checks the delivery code of the parcel; it requires
+// OpDeliver.
+func (a AuthorizedService) ConfirmDeliveryCode(number int, code string) error {
+	if _, err := a.authorizeParcel(OpDeliver, number); err != nil {
+		return err
+	}
+	return a.service.ConfirmDeliveryCode(number, code)
+}
+
+// OverrideDeliveryCode lets the parcel be delivered without its code; it
+// requires OpOverride. The actor is completed as for ForceSetStatus.
+func (a AuthorizedService) OverrideDeliveryCode(number int, reason, actor string) error {
+	if _, err := a.authorizeParcel(OpOverride, number); err != nil {
+		return err
+	}
+	if actor = strings.TrimSpace(actor); actor == "" {
+		actor = a.who.String()
+	} else {
+		actor += " (" + a.who.String() + ")"
+	}
+	return a.service.OverrideDeliveryCode(number, reason, actor)
+}
+
+// StatusOverrides returns the status overrides of the parcel; it
+// requires OpOverride.
+func (a AuthorizedService) StatusOverrides(number int) ([]StatusOverride, error) {
+	if _, err := a.authorizeParcel(OpOverride, number); err != nil {
+		return nil, err
+	}
+	return a.service.StatusOverrides(number)
+}
+
+// Split splits the parcel into pieces; it requires OpRepack.
+func (a AuthorizedService) Split(number, pieces int) ([]Parcel, error) {
+	if _, err := a.authorizeParcel(OpRepack, number); err != nil {
+		return nil, err
+	}
+	return a.service.Split(number, pieces)
+}
+
+// Merge consolidates the parcels into one; it requires OpRepack.
+func (a AuthorizedService) Merge(numbers []int) (Parcel, error) {
+	if err := a.can(OpRepack); err != nil {
+		return Parcel{}, err
+	}
+	return a.service.Merge(numbers)
+}
+
+// Links returns the split and merge links of the parcel.
+func (a AuthorizedService) Links(number int) ([]ParcelLink, error) {
+	if _, err := a.authorizeParcel(OpView, number); err != nil {
+		return nil, err
+	}
+	return a.service.Links(number)
+}
+
+// authorizeOrder checks that the principal may perform op on the order
+// with the given id and returns the order.
+func (a AuthorizedService) authorizeOrder(op Operation, id int) (Order, error) {
+	if err := a.can(op); err != nil {
+		return Order{}, err
+	}
+	order, err := a.service.Order(id)
+	if err != nil {
+		return order, err
+	}
+	return order, a.authorize(op, order.Client)
+}
+
+// CreateOrder creates an empty order for client; it requires OpRegister.
+func (a AuthorizedService) CreateOrder(client int) (Order, error) {
+	if err := a.authorize(OpRegister, client); err != nil {
+		return Order{}, err
+	}
+	return a.service.CreateOrder(client)
+}
+
+// Order returns the order with the given id.
+func (a AuthorizedService) Order(id int) (Order, error) {
+	return a.authorizeOrder(OpView, id)
+}
+
+// GetByOrder returns the parcels of the order.
+func (a AuthorizedService) GetByOrder(id int) ([]Parcel, error) {
+	if _, err := a.authorizeOrder(OpView, id); err != nil {
+		return nil, err
+	}
+	return a.service.GetByOrder(id)
+}
+
+// AddOrderParcel adds a parcel to the order; it requires OpRegister.
+func (a AuthorizedService) AddOrderParcel(id, number int) error {
+	if _, err := a.authorizeOrder(OpRegister, id); err != nil {
+		return err
+	}
+	return a.service.AddOrderParcel(id, number)
+}
+
+// RemoveOrderParcel takes a parcel out of the order; it requires
+// OpRegister.
+func (a AuthorizedService) RemoveOrderParcel(id, number int) error {
+	if _, err := a.authorizeOrder(OpRegister, id); err != nil {
+		return err
+	}
+	return a.service.RemoveOrderParcel(id, number)
+}
+
+// FileClaim files a claim against the parcel; it requires OpClaim.
+func (a AuthorizedService) FileClaim(number int, kind string, amount int, description string) (Claim, error) {
+	if _, err := a.authorizeParcel(OpClaim, number); err != nil {
+		return Claim{}, err
+	}
+	return a.service.FileClaim(number, kind, amount, description)
+}
+
+// ParcelClaims returns the claims against the parcel; it requires OpClaim.
+func (a AuthorizedService) ParcelClaims(number int) ([]Claim, error) {
+	if _, err := a.authorizeParcel(OpClaim, number); err != nil {
+		return nil, err
+	}
+	return a.service.ParcelClaims(number)
+}
+
+// Claim returns the claim with the given id; it requires OpClaim on its
+// parcel.
+func (a AuthorizedService) Claim(id int) (Claim, error) {
+	if err := a.can(OpClaim); err != nil {
+		return Claim{}, err
+	}
+	c, err := a.service.Claim(id)
+	if err != nil {
+		return c, err
+	}
+	if _, err := a.authorizeParcel(OpClaim, c.Number); err != nil {
+		return Claim{}, err
+	}
+	return c, nil
+}
+
+// ClaimsByStatus returns the claims in status; it requires OpSettleClaims.
+func (a AuthorizedService) ClaimsByStatus(status string) ([]Claim, error) {
+	if err := a.can(OpSettleClaims); err != nil {
+		return nil, err
+	}
+	return a.service.ClaimsByStatus(status)
+}
+
+// OpenClaims returns the claims awaiting a decision; it requires
+// OpSettleClaims.
+func (a AuthorizedService) OpenClaims() ([]Claim, error) {
+	if err := a.can(OpSettleClaims); err != nil {
+		return nil, err
+	}
+	return a.service.OpenClaims()
+}
+
+// ApproveClaim approves an open claim; it requires OpSettleClaims.
+func (a AuthorizedService) ApproveClaim(id, payout int, note string) (Claim, error) {
+	if err := a.can(OpSettleClaims); err != nil {
+		return Claim{}, err
+	}
+	return a.service.ApproveClaim(id, payout, note)
+}
+
+// RejectClaim rejects an open claim; it requires OpSettleClaims.
+func (a AuthorizedService) RejectClaim(id int, reason string) (Claim, error) {
+	if err := a.can(OpSettleClaims); err != nil {
+		return Claim{}, err
+	}
+	return a.service.RejectClaim(id, reason)
+}
+
+// PayClaim records the payout of an approved claim; it requires
+// OpSettleClaims.
+func (a AuthorizedService) PayClaim(id int) (Claim, error) {
+	if err := a.can(OpSettleClaims); err != nil {
+		return Claim{}, err
+	}
+	return a.service.PayClaim(id)
+}
+
+// ReportWorkItem queues a work item about the parcel; it requires
+// OpWorkQueue.
+func (a AuthorizedService) ReportWorkItem(number int, kind, detail string) (WorkItem, error) {
+	if err := a.can(OpWorkQueue); err != nil {
+		return WorkItem{}, err
+	}
+	return a.service.ReportWorkItem(number, kind, detail)
+}
+
+// WorkItem returns the work item with the given id; it requires
+// OpWorkQueue.
+func (a AuthorizedService) WorkItem(id int) (WorkItem, error) {
+	if err := a.can(OpWorkQueue); err != nil {
+		return WorkItem{}, err
+	}
+	return a.service.WorkItem(id)
+}
+
+// WorkItems returns the work items f selects; it requires OpWorkQueue.
+func (a AuthorizedService) WorkItems(f WorkItemFilter) ([]WorkItem, error) {
+	if err := a.can(OpWorkQueue); err != nil {
+		return nil, err
+	}
+	return a.service.WorkItems(f)
+}
+
+// AssignWorkItem assigns the work item to an operator; it requires
+// OpWorkQueue.
+func (a AuthorizedService) AssignWorkItem(id int, operator string) (WorkItem, error) {
+	if err := a.can(OpWorkQueue); err != nil {
+		return WorkItem{}, err
+	}
+	return a.service.AssignWorkItem(id, operator)
+}
+
+// ResolveWorkItem closes the work item; it requires OpWorkQueue.
+func (a AuthorizedService) ResolveWorkItem(id int, state, resolution string) (WorkItem, error) {
+	if err := a.can(OpWorkQueue); err != nil {
+		return WorkItem{}, err
+	}
+	return a.service.ResolveWorkItem(id, state, resolution)
+}
+
+// ContentRestrictions returns every content restriction, so that parcels
+// can be checked before registration; it requires OpRegister.
+func (a AuthorizedService) ContentRestrictions() ([]ContentRestriction, error) {
+	if err := a.can(OpRegister); err != nil {
+		return nil, err
+	}
+	return a.service.ContentRestrictions()
+}
+
+// AddContentRestriction forbids a content category for a zone; it
+// requires OpManageRules.
+func (a AuthorizedService) AddContentRestriction(category, zone string) (ContentRestriction, error) {
+	if err := a.can(OpManageRules); err != nil {
+		return ContentRestriction{}, err
+	}
+	return a.service.AddContentRestriction(category, zone)
+}
+
+// DeleteContentRestriction lifts a content restriction; it requires
+// OpManageRules.
+func (a AuthorizedService) DeleteContentRestriction(id int) error {
+	if err := a.can(OpManageRules); err != nil {
+		return err
+	}
+	return a.service.DeleteContentRestriction(id)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAuthorizedServiceRoles verifies the per-role permissions along a
+// parcel's lifecycle.
+func TestAuthorizedServiceRoles(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	operator := NewAuthorizedService(service, Principal{Role: RoleOperator})
+	courier := NewAuthorizedService(service, Principal{Role: RoleCourier})
+	admin := NewAuthorizedService(service, Principal{Role: RoleAdmin})
+
+	// register
+	_, err := courier.Register(Parcel{Client: 1000, Address: "test"})
+	require.ErrorIs(t, err, ErrForbidden)
+	parcel, err := operator.Register(Parcel{Client: 1000, Address: "test", Payment: PaymentPaid})
+	require.NoError(t, err)
+
+	// advance
+	require.ErrorIs(t, courier.NextStatus(parcel.Number), ErrForbidden)
+	require.NoError(t, operator.NextStatus(parcel.Number))
+	require.ErrorIs(t, operator.NextStatus(parcel.Number), ErrForbidden)
+	require.ErrorIs(t, admin.NextStatus(parcel.Number), ErrForbidden)
+	require.NoError(t, courier.NextStatus(parcel.Number))
+
+	// delete
+	other, err := operator.Register(Parcel{Client: 1000, Address: "test"})
+	require.NoError(t, err)
+	require.ErrorIs(t, operator.Delete(other.Number), ErrForbidden)
+	require.NoError(t, admin.Delete(other.Number))
+
+	// check
+	stored, err := courier.Get(parcel.Number)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusDelivered, stored.Status)
+}
+
+// TestAuthorizedServiceClient ensures that a client only sees and changes
+// its own parcels.
+func TestAuthorizedServiceClient(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	own, err := service.Register(1000, "own")
+	require.NoError(t, err)
+	foreign, err := service.Register(2000, "foreign")
+	require.NoError(t, err)
+	client := NewAuthorizedService(service, Principal{Role: RoleClient, Client: 1000})
+
+	// check
+	_, err = client.Get(own.Number)
+	require.NoError(t, err)
+	_, err = client.Get(foreign.Number)
+	require.ErrorIs(t, err, ErrForbidden)
+	_, err = client.GetByTrackingCode(foreign.TrackingCode)
+	require.ErrorIs(t, err, ErrForbidden)
+
+	require.NoError(t, client.ChangeAddress(own.Number, "new"))
+	require.ErrorIs(t, client.ChangeAddress(foreign.Number, "new"), ErrForbidden)
+	require.ErrorIs(t, client.SetPaymentStatus(own.Number, PaymentPaid), ErrForbidden)
+
+	parcels, err := client.FindParcels(ParcelFilter{})
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	assert.Equal(t, own.Number, parcels[0].Number)
+	_, err = client.FindParcels(ParcelFilter{Client: 2000})
+	require.ErrorIs(t, err, ErrForbidden)
+
+	_, err = client.Register(Parcel{Client: 2000, Address: "test"})
+	require.ErrorIs(t, err, ErrForbidden)
+}
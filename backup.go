@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// ErrInvalidBackup indicates a backup file that is not an intact tracker
+// database this build can restore.
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// Backup writes a consistent, compacted copy of the database to the file
+// dst while the store stays in use, with VACUUM INTO. Copying the live
+// file instead may catch it mid-write, or miss pages still in the WAL.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store has not been initialised.
+//   - Returns fs.ErrExist (wrapped) if dst already exists.
+//   - Wraps and returns any SQL error from VACUUM INTO; a partial dst may
+//     be left behind then.
+func (s ParcelStore) Backup(dst string) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("failed to back up to %s: %w", dst, fs.ErrExist)
+	}
+	if _, err := s.db.Exec("VACUUM INTO ?", dst); err != nil {
+		return fmt.Errorf("failed to back up to %s: %w", dst, err)
+	}
+	return nil
+}
+
+// Restore replaces the contents of the database with the backup in the
+// file src, with SQLite's online backup API, and brings the restored
+// schema up to date.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store has not been initialised.
+//   - Returns ErrInvalidBackup (wrapped) if src fails PRAGMA
+//     integrity_check, has no "parcel" table, or has a newer schema
+//     version than this build; the database is left untouched then.
+//   - Other connections see the restored data once Restore returns;
+//     cached parcels of both the old and the restored data are dropped.
+//   - Wraps and returns any error from the backup API or Migrate.
+func (s ParcelStore) Restore(src string) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	if err := checkBackup(src); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", src, err)
+	}
+	before, err := s.cacheKeys()
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %w", src, err)
+	}
+
+	conn, err := s.db.Conn(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %w", src, err)
+	}
+	defer conn.Close()
+	err = conn.Raw(func(driverConn any) error {
+		if w, ok := driverConn.(interface{ Unwrap() sqldriver.Conn }); ok {
+			driverConn = w.Unwrap()
+		}
+		c, ok := driverConn.(interface {
+			NewRestore(srcURI string) (*sqlite.Backup, error)
+		})
+		if !ok {
+			return errors.New("driver does not support online backup")
+		}
+		restore, err := c.NewRestore(src)
+		if err != nil {
+			return err
+		}
+		if _, err := restore.Step(-1); err != nil {
+			restore.Finish()
+			return err
+		}
+		return restore.Finish()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %w", src, err)
+	}
+
+	if err := s.Migrate(); err != nil {
+		return err
+	}
+	after, err := s.cacheKeys()
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %w", src, err)
+	}
+	for _, key := range append(before, after...) {
+		s.invalidate(key)
+	}
+	return nil
+}
+
+// checkBackup opens the backup at path read-only and checks that it can be
+// restored; see Restore.
+func checkBackup(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	db, err := sql.Open(driver, "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("%w: integrity check: %s", ErrInvalidBackup, result)
+	}
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'parcel'`).
+		Scan(&tables); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if tables == 0 {
+		return fmt.Errorf("%w: no parcel table", ErrInvalidBackup)
+	}
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("%w: schema version %d is newer than %d", ErrInvalidBackup, version, len(migrations))
+	}
+	return nil
+}
+
+// cacheKeys returns the cache keys of every parcel and client in the
+// database, or nil if the store has no cache.
+func (s ParcelStore) cacheKeys() ([]CacheKey, error) {
+	if s.cache == nil {
+		return nil, nil
+	}
+	rows, err := s.db.Query("SELECT number, client FROM parcel")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []CacheKey
+	for rows.Next() {
+		var number, client int
+		if err := rows.Scan(&number, &client); err != nil {
+			return nil, err
+		}
+		keys = append(keys, CacheKey{ID: number}, CacheKey{Client: true, ID: client})
+	}
+	return keys, rows.Err()
+}
+
+// backupPrefix and backupSuffix frame the names of the files written by
+// BackupJob, around a timestamp that sorts chronologically.
+const (
+	backupPrefix = "tracker-"
+	backupSuffix = ".db"
+)
+
+// BackupJob returns a Job that backs the store up into dir (see Backup),
+// as "tracker-<UTC time>.db", and then deletes all but the newest keep
+// backups there; keep below one keeps them all.
+func BackupJob(store ParcelStore, dir string, keep int) Job {
+	return NewJob("backup", func(context.Context) error {
+		name := backupPrefix + time.Now().UTC().Format("20060102T150405.000Z") + backupSuffix
+		if err := store.Backup(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+		if keep < 1 {
+			return nil
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("failed to list backups: %w", err)
+		}
+		var backups []string
+		for _, e := range entries {
+			if !e.IsDir() && strings.HasPrefix(e.Name(), backupPrefix) && strings.HasSuffix(e.Name(), backupSuffix) {
+				backups = append(backups, e.Name())
+			}
+		}
+		sort.Strings(backups)
+		for len(backups) > keep {
+			if err := os.Remove(filepath.Join(dir, backups[0])); err != nil {
+				return fmt.Errorf("failed to delete old backup: %w", err)
+			}
+			backups = backups[1:]
+		}
+		return nil
+	})
+}
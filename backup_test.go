@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getTestFileStore returns a store on a fresh database file in a
+// temporary directory, with a cache.
+func getTestFileStore(t *testing.T) ParcelStore {
+	t.Helper()
+	store, err := openParcelStore(AuditDriver, filepath.Join(t.TempDir(), "tracker.db"), DefaultOptions())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	require.NoError(t, store.EnsureSchema(context.Background()))
+	return store.WithCache(NewParcelCache(100, time.Minute))
+}
+
+// TestBackupRestore verifies that a backup restores the data at the time
+// it was taken, including for cached parcels.
+func TestBackupRestore(t *testing.T) {
+	// prepare
+	store := getTestFileStore(t)
+	kept, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	dst := filepath.Join(t.TempDir(), "backup.db")
+
+	// backup
+	require.NoError(t, store.Backup(dst))
+	require.ErrorIs(t, store.Backup(dst), fs.ErrExist)
+	added, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	_, err = store.Get(added)
+	require.NoError(t, err)
+	require.NoError(t, store.Delete(kept))
+
+	// restore
+	require.NoError(t, store.Restore(dst))
+
+	// check
+	_, err = store.Get(kept)
+	assert.NoError(t, err)
+	_, err = store.Get(added)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	version, err := store.SchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations), version)
+}
+
+// TestRestoreInvalidBackup ensures that files other than intact tracker
+// databases are rejected without touching the store.
+func TestRestoreInvalidBackup(t *testing.T) {
+	// prepare
+	store := getTestFileStore(t)
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "garbage.db")
+	require.NoError(t, os.WriteFile(garbage, []byte("not a database, just some text"), 0o600))
+	empty := filepath.Join(dir, "empty.db")
+	db, err := sql.Open("sqlite", empty)
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE other (id INTEGER)")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	// check
+	require.ErrorIs(t, store.Restore(garbage), ErrInvalidBackup)
+	require.ErrorIs(t, store.Restore(empty), ErrInvalidBackup)
+	require.ErrorIs(t, store.Restore(filepath.Join(dir, "missing.db")), fs.ErrNotExist)
+	_, err = store.Get(id)
+	assert.NoError(t, err)
+}
+
+// TestBackupJob verifies that the job writes backups and keeps the newest.
+func TestBackupJob(t *testing.T) {
+	// prepare
+	store := getTestFileStore(t)
+	dir := t.TempDir()
+	job := BackupJob(store, dir, 2)
+
+	// run
+	for i := 0; i < 3; i++ {
+		require.NoError(t, job.Run(context.Background()))
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	// check
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Less(t, entries[0].Name(), entries[1].Name())
+	assert.NoError(t, checkBackup(filepath.Join(dir, entries[1].Name())))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"time"
+)
+
+// DeleteRefusal is a parcel DeleteMany left in place, and why.
+type DeleteRefusal struct {
+	Number int
+	// Err is a coded error, e.g. ErrRequireRegistered or ErrParcelNotFound.
+	Err error
+}
+
+// DeleteReport is the outcome of DeleteMany.
+type DeleteReport struct {
+	// Deleted are the parcels deleted, in the order given.
+	Deleted []int
+	// Refused are the parcels that were not, in the order given.
+	Refused []DeleteRefusal
+}
+
+// DeleteMany deletes a batch of parcels, e.g. registrations made in error
+// or by a test, in one transaction, each with the same checks as Delete:
+// only registered parcels are deleted. EventParcelDeleted is published
+// for each of them once the transaction commits.
+//
+// Behaviour:
+//   - A parcel failing a check with a coded error (see ErrorCodeOf), e.g.
+//     ErrRequireRegistered for one already sent or ErrParcelNotFound, is
+//     refused; the rest are still deleted.
+//   - Numbers given more than once count once.
+//   - Any other error rolls the whole batch back and is returned with an
+//     empty report.
+func (s ParcelService) DeleteMany(numbers []int) (DeleteReport, error) {
+	report := DeleteReport{Deleted: []int{}, Refused: []DeleteRefusal{}}
+	var deleted []Parcel
+	seen := make(map[int]bool, len(numbers))
+
+	err := s.store.InTx(func(tx ParcelStore) error {
+		for _, number := range numbers {
+			if seen[number] {
+				continue
+			}
+			seen[number] = true
+
+			parcel, err := tx.Get(number)
+			if err == nil {
+				err = tx.Delete(number)
+			}
+			if err != nil {
+				err = mapError(err)
+				if ErrorCodeOf(err) == "" {
+					return err
+				}
+				report.Refused = append(report.Refused, DeleteRefusal{Number: number, Err: err})
+				continue
+			}
+			report.Deleted = append(report.Deleted, number)
+			deleted = append(deleted, parcel)
+		}
+		return nil
+	})
+	if err != nil {
+		return DeleteReport{Deleted: []int{}, Refused: []DeleteRefusal{}}, err
+	}
+
+	now := s.timestamp(time.Now())
+	for _, parcel := range deleted {
+		s.events.Publish(Event{Type: EventParcelDeleted, Parcel: parcel, At: now})
+	}
+	return report, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDeleteMany verifies that only registered parcels are deleted and
+// the rest are reported as refused.
+func TestDeleteMany(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	var registered []int
+	for i := 0; i < 2; i++ {
+		parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test"})
+		require.NoError(t, err)
+		registered = append(registered, parcel.Number)
+	}
+	sent := getSentParcel(t, service)
+	*published = nil
+
+	// delete
+	report, err := service.DeleteMany([]int{registered[0], sent, 999, registered[1], registered[0]})
+	require.NoError(t, err)
+
+	// check
+	assert.Equal(t, registered, report.Deleted)
+	require.Len(t, report.Refused, 2)
+	assert.Equal(t, sent, report.Refused[0].Number)
+	assert.ErrorIs(t, report.Refused[0].Err, ErrRequireRegistered)
+	assert.Equal(t, 999, report.Refused[1].Number)
+	assert.ErrorIs(t, report.Refused[1].Err, ErrParcelNotFound)
+	for _, number := range registered {
+		_, err := service.Get(number)
+		assert.ErrorIs(t, err, ErrParcelNotFound)
+	}
+	_, err = service.Get(sent)
+	assert.NoError(t, err)
+	require.Len(t, *published, 2)
+	assert.Equal(t, EventParcelDeleted, (*published)[0].Type)
+
+	report, err = service.DeleteMany(nil)
+	require.NoError(t, err)
+	assert.Empty(t, report.Deleted)
+	assert.Empty(t, report.Refused)
+}
+
+// TestHTTPDeleteMany verifies the bulk delete endpoint and its report.
+func TestHTTPDeleteMany(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service)
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test"})
+	require.NoError(t, err)
+	sent := getSentParcel(t, service)
+
+	// check
+	rec := doRequest(t, h, http.MethodPost, "/parcels/delete", fmt.Sprintf(`{"numbers": [%d, %d]}`, parcel.Number, sent))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var res deleteReportJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	assert.Equal(t, []int{parcel.Number}, res.Deleted)
+	require.Len(t, res.Refused, 1)
+	assert.Equal(t, sent, res.Refused[0].Parcel)
+	assert.Equal(t, CodeRequiresRegistered, res.Refused[0].Code)
+
+	rec = doRequest(t, h, http.MethodGet, "/parcels/delete", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache holds the results of ParcelStore.Get and ParcelStore.GetByClient;
+// see WithCache. Writes through a store using the cache invalidate the
+// affected entries, once when they are made and again when their
+// transaction ends, so that a read racing with the transaction cannot
+// cache the old row for long.
+//
+// Implementations must be safe for concurrent use and must not let
+// callers change cached values through the slices they get or put.
+type Cache interface {
+	// Get returns the cached parcels for key.
+	Get(key CacheKey) ([]Parcel, bool)
+	// Put caches parcels under key.
+	Put(key CacheKey, parcels []Parcel)
+	// Invalidate drops the entry for key and, for a parcel, the list of
+	// its client.
+	Invalidate(key CacheKey)
+}
+
+// CacheKey identifies a cached parcel, or the parcel list of a client
+// if Client is set.
+type CacheKey struct {
+	Client bool
+	ID     int
+}
+
+// ParcelCache is an in-process LRU Cache. Entries expire after the TTL,
+// which also bounds how long writes made by other processes to the same
+// database stay unnoticed.
+type ParcelCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	now      func() time.Time
+
+	entries map[CacheKey]*list.Element
+	// lru holds *cacheEntry, most recently used first.
+	lru *list.List
+	// clients maps parcel numbers to their client for the parcels seen,
+	// so that invalidating a parcel also drops its client's list.
+	clients map[int]int
+
+	hits, misses int
+}
+
+type cacheEntry struct {
+	key     CacheKey
+	parcels []Parcel
+	expires time.Time
+}
+
+// CacheStats reports the effectiveness of a ParcelCache.
+type CacheStats struct {
+	Hits, Misses int
+	// Size is the number of cached parcels and client lists.
+	Size int
+}
+
+// NewParcelCache returns a cache holding up to capacity entries, each for
+// at most ttl. capacity must be positive.
+func NewParcelCache(capacity int, ttl time.Duration) *ParcelCache {
+	return &ParcelCache{
+		capacity: capacity,
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  make(map[CacheKey]*list.Element),
+		lru:      list.New(),
+		clients:  make(map[int]int),
+	}
+}
+
+// Stats returns the hit and miss counts and the current size.
+func (c *ParcelCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Hits: c.hits, Misses: c.misses, Size: c.lru.Len()}
+}
+
+// Get returns a copy of the cached parcels for key.
+func (c *ParcelCache) Get(key CacheKey) ([]Parcel, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if ok && c.now().After(el.Value.(*cacheEntry).expires) {
+		c.remove(el)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(el)
+	return cloneParcels(el.Value.(*cacheEntry).parcels), true
+}
+
+// Put caches a copy of parcels under key, evicting the least recently
+// used entry if the cache is full.
+func (c *ParcelCache) Put(key CacheKey, parcels []Parcel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, p := range parcels {
+		c.clients[p.Number] = p.Client
+	}
+	entry := &cacheEntry{key: key, parcels: cloneParcels(parcels), expires: c.now().Add(c.ttl)}
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.capacity {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Invalidate drops the entry for key and, for a parcel, the list of its
+// client.
+func (c *ParcelCache) Invalidate(key CacheKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	if key.Client {
+		return
+	}
+	if client, ok := c.clients[key.ID]; ok {
+		if el, ok := c.entries[CacheKey{Client: true, ID: client}]; ok {
+			c.remove(el)
+		}
+	}
+}
+
+func (c *ParcelCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
+
+// cloneParcels copies parcels deeply enough that callers cannot change
+// the cached values: attributes and coordinates are copied too.
+func cloneParcels(parcels []Parcel) []Parcel {
+	if parcels == nil {
+		return nil
+	}
+	res := make([]Parcel, len(parcels))
+	for i, p := range parcels {
+		if p.Attributes != nil {
+			attrs := make(Attributes, len(p.Attributes))
+			for k, v := range p.Attributes {
+				attrs[k] = v
+			}
+			p.Attributes = attrs
+		}
+		if p.Coordinates != nil {
+			coordinates := *p.Coordinates
+			p.Coordinates = &coordinates
+		}
+		res[i] = p
+	}
+	return res
+}
+
+// WithCache returns a copy of the store that serves Get and GetByClient
+// from cache outside transactions. Attach the cache before deriving other
+// copies of the store (e.g. with WithAddressValidator), so that writes
+// through any of them invalidate it.
+func (s ParcelStore) WithCache(cache Cache) ParcelStore {
+	s.cache = cache
+	return s
+}
+
+// cached returns the parcels for key from the cache, or loads and caches
+// them. Inside a transaction, which may see uncommitted rows, the cache
+// is bypassed.
+func (s ParcelStore) cached(key CacheKey, load func() ([]Parcel, error)) ([]Parcel, error) {
+	if s.cache == nil || s.tx != nil {
+		return load()
+	}
+	if parcels, ok := s.cache.Get(key); ok {
+		return parcels, nil
+	}
+	parcels, err := load()
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Put(key, parcels)
+	return parcels, nil
+}
+
+// invalidateParcel drops the cached parcel and its client's list.
+func (s ParcelStore) invalidateParcel(number int) {
+	s.invalidate(CacheKey{ID: number})
+}
+
+// invalidateClient drops the cached parcel list of the client.
+func (s ParcelStore) invalidateClient(client int) {
+	s.invalidate(CacheKey{Client: true, ID: client})
+}
+
+func (s ParcelStore) invalidate(key CacheKey) {
+	if s.cache == nil {
+		return
+	}
+	s.cache.Invalidate(key)
+	if s.touched != nil {
+		*s.touched = append(*s.touched, key)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParcelCacheLRU checks eviction, expiry and that cached values cannot
+// be changed through the returned copies.
+func TestParcelCacheLRU(t *testing.T) {
+	// prepare
+	cache := NewParcelCache(2, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.Put(CacheKey{ID: 1}, []Parcel{{Number: 1, Attributes: Attributes{"k": "v"}}})
+	cache.Put(CacheKey{ID: 2}, []Parcel{{Number: 2}})
+
+	// use 1, so 2 is evicted by 3
+	got, ok := cache.Get(CacheKey{ID: 1})
+	require.True(t, ok)
+	got[0].Attributes["k"] = "changed"
+	cache.Put(CacheKey{ID: 3}, []Parcel{{Number: 3}})
+
+	// check
+	_, ok = cache.Get(CacheKey{ID: 2})
+	assert.False(t, ok)
+	got, ok = cache.Get(CacheKey{ID: 1})
+	require.True(t, ok)
+	assert.Equal(t, "v", got[0].Attributes["k"])
+
+	now = now.Add(2 * time.Minute)
+	_, ok = cache.Get(CacheKey{ID: 3})
+	assert.False(t, ok)
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 2, Size: 1}, cache.Stats())
+}
+
+// TestStoreCache checks that Get and GetByClient are served from the cache
+// and that writes invalidate the parcel and its client's list.
+func TestStoreCache(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	cache := NewParcelCache(100, time.Minute)
+	store := NewParcelStore(db).WithCache(cache)
+	service := NewParcelService(store, nil)
+
+	parcel := getTestParcel()
+	parcel.Payment = PaymentPaid
+	number, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	// fill
+	_, err = store.Get(number)
+	require.NoError(t, err)
+	list, err := store.GetByClient(parcel.Client)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+
+	// a write behind the store's back is not seen
+	_, err = db.Exec("UPDATE parcel SET address = 'stale' WHERE number = ?", number)
+	require.NoError(t, err)
+	stored, err := store.Get(number)
+	require.NoError(t, err)
+	assert.Equal(t, "test", stored.Address)
+	assert.Equal(t, 1, cache.Stats().Hits)
+
+	// writes through the store invalidate
+	require.NoError(t, service.NextStatus(number))
+	stored, err = store.Get(number)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusSent, stored.Status)
+	list, err = store.GetByClient(parcel.Client)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusSent, list[0].Status)
+
+	second, err := store.Add(parcel)
+	require.NoError(t, err)
+	list, err = store.GetByClient(parcel.Client)
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	require.NoError(t, store.Delete(second))
+	_, err = store.Get(second)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	list, err = store.GetByClient(parcel.Client)
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+}
+
+// TestStoreCacheRollback checks that a rolled back write leaves no stale
+// entry: reads inside the transaction bypass the cache and its keys are
+// invalidated when it ends.
+func TestStoreCacheRollback(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db).WithCache(NewParcelCache(100, time.Minute))
+	number, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// check
+	err = store.InTx(func(tx ParcelStore) error {
+		if err := tx.SetAddress(number, "changed"); err != nil {
+			return err
+		}
+		p, err := tx.Get(number)
+		require.NoError(t, err)
+		assert.Equal(t, "changed", p.Address)
+		return sql.ErrTxDone
+	})
+	require.ErrorIs(t, err, sql.ErrTxDone)
+
+	p, err := store.Get(number)
+	require.NoError(t, err)
+	assert.Equal(t, "test", p.Address)
+}
@@ -0,0 +1,117 @@
+package main
+
+import "fmt"
+
+// ChangeOp is what happened to a parcel in an entry of the change feed.
+type ChangeOp string
+
+const (
+	ChangeCreated ChangeOp = "create"
+	ChangeUpdated ChangeOp = "update"
+	ChangeDeleted ChangeOp = "delete"
+)
+
+// Limits of the number of changes returned by GetChangesSince.
+const (
+	DefaultChangeLimit = 100
+	MaxChangeLimit     = 1000
+)
+
+// Change is an entry of the change feed of parcels.
+type Change struct {
+	// Cursor orders the feed; pass the last one read to GetChangesSince
+	// to read on from it.
+	Cursor int64
+	Number int
+	Op     ChangeOp
+	// At is the RFC 3339 time of the change, to the millisecond.
+	At string
+	// Actor made the change, if it was made by a store with one; see
+	// ParcelStore.WithActor.
+	Actor string
+	// Parcel is the parcel as it is now rather than as the change left
+	// it, so a consumer applying the feed in order ends up with the
+	// current state; nil if the parcel has been deleted since.
+	Parcel *Parcel
+}
+
+// GetChangesSince returns the changes of parcels after cursor, oldest
+// first: every create, update and delete of a parcel row, whatever made
+// it. Triggers record each change in the transaction making it, so a
+// consumer reading on from the cursor of the last change it has seen
+// misses none, e.g. to keep analytics or a cache in sync without
+// reading every parcel again. Cursor 0 reads the feed from the start,
+// where it has a create for every parcel that existed when it was
+// introduced.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - A limit of zero or less means DefaultChangeLimit; limits above
+//     MaxChangeLimit are lowered to it.
+//   - Returns an empty slice if there is no change after cursor.
+//   - Reads the changes and the parcels in one transaction.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) GetChangesSince(cursor int64, limit int) ([]Change, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = DefaultChangeLimit
+	}
+	limit = min(limit, MaxChangeLimit)
+
+	res := []Change{}
+	err := s.InTx(func(tx ParcelStore) error {
+		query, args := selectFrom("parcel_change", "id, parcel_number, op, changed_at, actor").
+			Where("id > ?", cursor).OrderBy("id").Limit(limit).build()
+		rows, err := tx.conn().Query(query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to get cursor for changes since %d: %w", cursor, err)
+		}
+		defer rows.Close()
+
+		var numbers []any
+		seen := make(map[int]bool)
+		for rows.Next() {
+			var c Change
+			if err := rows.Scan(&c.Cursor, &c.Number, &c.Op, &c.At, &c.Actor); err != nil {
+				return fmt.Errorf("failed to scan one of change rows since %d: %w", cursor, err)
+			}
+			res = append(res, c)
+			if !seen[c.Number] {
+				seen[c.Number] = true
+				numbers = append(numbers, c.Number)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to iterate change rows since %d: %w", cursor, err)
+		}
+		if len(numbers) == 0 {
+			return nil
+		}
+
+		query, args = selectFrom("parcel", parcelColumns).WhereIn("number", numbers...).build()
+		parcels, err := tx.queryParcels(fmt.Sprintf("changes since %d", cursor), query, args...)
+		if err != nil {
+			return err
+		}
+		byNumber := make(map[int]*Parcel, len(parcels))
+		for i := range parcels {
+			byNumber[parcels[i].Number] = &parcels[i]
+		}
+		for i := range res {
+			res[i].Parcel = byNumber[res[i].Number]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ChangesSince returns the changes of parcels after cursor; see
+// ParcelStore.GetChangesSince.
+func (s ParcelService) ChangesSince(cursor int64, limit int) ([]Change, error) {
+	return s.store.GetChangesSince(cursor, limit)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetChangesSince verifies that creates, updates and deletes are
+// fed in order, page by page, with the current state of each parcel.
+func TestGetChangesSince(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	kept, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	deleted, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(kept, ParcelStatusSent))
+	require.NoError(t, store.Delete(deleted))
+	err = store.InTx(func(tx ParcelStore) error {
+		if _, err := tx.Add(getTestParcel()); err != nil {
+			return err
+		}
+		return errors.New("rolled back")
+	})
+	require.Error(t, err)
+
+	// check
+	changes, err := store.GetChangesSince(0, 0)
+	require.NoError(t, err)
+	require.Len(t, changes, 4)
+	type entry struct {
+		Number int
+		Op     ChangeOp
+	}
+	var entries []entry
+	for i, c := range changes {
+		entries = append(entries, entry{c.Number, c.Op})
+		assert.NotEmpty(t, c.At)
+		if i > 0 {
+			assert.Greater(t, c.Cursor, changes[i-1].Cursor)
+		}
+	}
+	assert.Equal(t, []entry{{kept, ChangeCreated}, {deleted, ChangeCreated}, {kept, ChangeUpdated},
+		{deleted, ChangeDeleted}}, entries)
+	require.NotNil(t, changes[0].Parcel)
+	assert.Equal(t, ParcelStatusSent, changes[0].Parcel.Status)
+	assert.Nil(t, changes[1].Parcel)
+
+	page, err := store.GetChangesSince(changes[0].Cursor, 2)
+	require.NoError(t, err)
+	assert.Equal(t, changes[1:3], page)
+	page, err = store.GetChangesSince(changes[3].Cursor, 0)
+	require.NoError(t, err)
+	assert.Empty(t, page)
+}
+
+// TestChangesOfAnonymisedParcel verifies that parcels without a tracking
+// code, as left by EraseClient, still feed their updates.
+func TestChangesOfAnonymisedParcel(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	number, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	_, err = db.Exec("UPDATE parcel SET tracking_code = '' WHERE number = ?", number)
+	require.NoError(t, err)
+	changes, err := store.GetChangesSince(0, 0)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+
+	// check
+	require.NoError(t, store.SetStatus(number, ParcelStatusSent))
+	changes, err = store.GetChangesSince(changes[1].Cursor, 0)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, number, changes[0].Number)
+	assert.Equal(t, ChangeUpdated, changes[0].Op)
+}
+
+// TestChangesHTTP verifies that /changes pages through the feed and is
+// reserved to administrators.
+func TestChangesHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	for i := 0; i < 3; i++ {
+		_, err := service.RegisterParcel(getTestParcel())
+		require.NoError(t, err)
+	}
+	h := NewHTTPHandler(service)
+
+	// check
+	rec := doRequest(t, h, http.MethodGet, "/changes?limit=2", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var page changesJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	require.Len(t, page.Changes, 2)
+	assert.Equal(t, "create", page.Changes[0].Op)
+	require.NotNil(t, page.Changes[0].Parcel)
+	assert.Equal(t, page.Changes[1].Cursor, page.NextCursor)
+
+	rec = doRequest(t, h, http.MethodGet, "/changes?since=1000", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	assert.Empty(t, page.Changes)
+	assert.EqualValues(t, 1000, page.NextCursor)
+
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodGet, "/changes?since=x", "").Code)
+
+	operator := NewAuthorizedService(service, Principal{Role: RoleOperator})
+	_, err := operator.ChangesSince(0, 0)
+	assert.ErrorIs(t, err, ErrForbidden)
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxClaimDescriptionLength is the maximum length of the description of a
+// claim in characters.
+const MaxClaimDescriptionLength = 2000
+
+// Kinds of Claim.
+const (
+	// ClaimLost is filed for a sent parcel that never arrived.
+	ClaimLost = "lost"
+	// ClaimDamaged is filed for a parcel delivered damaged.
+	ClaimDamaged = "damaged"
+)
+
+// Statuses of Claim. A claim is filed open, then approved or rejected;
+// an approved claim is paid once the payout is made.
+const (
+	ClaimOpen     = "open"
+	ClaimApproved = "approved"
+	ClaimRejected = "rejected"
+	ClaimPaid     = "paid"
+)
+
+var (
+	// ErrClaimNotFound indicates that no claim exists with the requested id.
+	ErrClaimNotFound = newError(CodeClaimNotFound, "claim not found")
+	// ErrInvalidClaim indicates a claim of an unknown kind, without a
+	// positive amount or a description, against a parcel in the wrong
+	// status for its kind, or against a parcel with an unsettled claim.
+	ErrInvalidClaim = newError(CodeInvalidClaim, "invalid claim")
+	// ErrClaimTransition indicates a claim status change not allowed from
+	// the current status, e.g. paying an open claim.
+	ErrClaimTransition = newError(CodeClaimTransition, "claim status transition not allowed")
+)
+
+// Claim asks for compensation for a lost or damaged parcel.
+type Claim struct {
+	ID     int
+	Number int
+	// Kind is ClaimLost or ClaimDamaged.
+	Kind        string
+	Description string
+	// Amount is what the claimant asks for, like Payout in minor units of
+	// the currency of the parcel.
+	Amount int
+	// Payout is what was approved: at most Amount, and never more than the
+	// declared value of the parcel less earlier payouts.
+	Payout int
+	Status string
+	// Resolution is the note given on approval or the reason of a rejection.
+	Resolution string
+	FiledAt    string
+	// ResolvedAt is empty until the claim is approved or rejected, and is
+	// the time of payment once it is paid.
+	ResolvedAt string
+}
+
+// claimColumns lists the columns scanned by scanClaim, in order.
+const claimColumns = "id, parcel_number, kind, description, amount, payout, status, resolution, filed_at, resolved_at"
+
+// scanClaim scans a row of claimColumns.
+func scanClaim(row interface{ Scan(...any) error }) (Claim, error) {
+	var c Claim
+	err := row.Scan(&c.ID, &c.Number, &c.Kind, &c.Description, &c.Amount, &c.Payout, &c.Status, &c.Resolution,
+		&c.FiledAt, &c.ResolvedAt)
+	return c, err
+}
+
+// addClaim stores c as filed and returns its id.
+func (s ParcelStore) addClaim(c Claim) (int, error) {
+	query := `INSERT INTO parcel_claim (parcel_number, kind, description, amount, status, filed_at)
+VALUES (:number, :kind, :description, :amount, :status, :filed_at)`
+	res, err := s.conn().Exec(query, sql.Named("number", c.Number), sql.Named("kind", c.Kind),
+		sql.Named("description", c.Description), sql.Named("amount", c.Amount), sql.Named("status", c.Status),
+		sql.Named("filed_at", c.FiledAt))
+	if err != nil {
+		return 0, fmt.Errorf("failed to file claim against parcel %d: %w", c.Number, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get id of claim against parcel %d: %w", c.Number, err)
+	}
+	return int(id), nil
+}
+
+// updateClaim stores the status, payout, resolution and resolution time
+// of c.
+func (s ParcelStore) updateClaim(c Claim) error {
+	query := `UPDATE parcel_claim SET status = :status, payout = :payout, resolution = :resolution,
+resolved_at = :resolved_at WHERE id = :id`
+	_, err := s.conn().Exec(query, sql.Named("status", c.Status), sql.Named("payout", c.Payout),
+		sql.Named("resolution", c.Resolution), sql.Named("resolved_at", c.ResolvedAt), sql.Named("id", c.ID))
+	if err != nil {
+		return fmt.Errorf("failed to update claim %d: %w", c.ID, err)
+	}
+	return nil
+}
+
+// GetClaim returns the claim with the given id.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrClaimNotFound (wrapped) if no such claim exists.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) GetClaim(id int) (Claim, error) {
+	if err := s.check(); err != nil {
+		return Claim{}, err
+	}
+
+	query := "SELECT " + claimColumns + " FROM parcel_claim WHERE id = :id"
+	c, err := scanClaim(s.conn().QueryRow(query, sql.Named("id", id)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c, fmt.Errorf("failed to get claim %d: %w", id, ErrClaimNotFound)
+	}
+	if err != nil {
+		return c, fmt.Errorf("failed to scan claim row with id %d: %w", id, err)
+	}
+	return c, nil
+}
+
+// ListClaims returns the claims against a parcel, oldest first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if no claim was filed against the parcel.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) ListClaims(number int) ([]Claim, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + claimColumns + " FROM parcel_claim WHERE parcel_number = :number ORDER BY id"
+	return s.queryClaims(fmt.Sprintf("parcel %d", number), query, sql.Named("number", number))
+}
+
+// GetClaimsByStatus returns the claims in status, oldest first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidClaim (wrapped) for an unknown status.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) GetClaimsByStatus(status string) ([]Claim, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	switch status {
+	case ClaimOpen, ClaimApproved, ClaimRejected, ClaimPaid:
+	default:
+		return nil, fmt.Errorf("failed to get claims: %w: unknown status %q", ErrInvalidClaim, status)
+	}
+
+	query := "SELECT " + claimColumns + " FROM parcel_claim WHERE status = :status ORDER BY id"
+	return s.queryClaims(fmt.Sprintf("status %q", status), query, sql.Named("status", status))
+}
+
+// queryClaims runs a SELECT of claimColumns and scans every resulting
+// row; what describes the selection in error messages.
+func (s ParcelStore) queryClaims(what, query string, args ...any) ([]Claim, error) {
+	rows, err := s.conn().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for claims of %s: %w", what, err)
+	}
+	defer rows.Close()
+
+	res := []Claim{}
+	for rows.Next() {
+		c, err := scanClaim(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan one of claim rows of %s: %w", what, err)
+		}
+		res = append(res, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate claim rows of %s: %w", what, err)
+	}
+	return res, nil
+}
+
+// FileClaim files an open claim of kind for amount against the parcel
+// and returns it. Surrounding white space is trimmed from description.
+// A parcel is claimed lost while it is in transit (sent or cleared
+// through customs) and damaged once it is delivered.
+//
+// Behaviour:
+//   - Returns ErrInvalidClaim (wrapped) for an unknown kind, an amount
+//     that is not positive, an empty description or one longer than
+//     MaxClaimDescriptionLength, a parcel in the wrong status for kind, or
+//     a parcel with an open or approved claim.
+//   - Returns ErrParcelNotFound (wrapped) if the parcel does not exist.
+//   - Queues a WorkItemClaimFiled for the investigation in the same
+//     transaction.
+func (s ParcelService) FileClaim(number int, kind string, amount int, description string) (Claim, error) {
+	c := Claim{Number: number, Kind: kind, Description: strings.TrimSpace(description), Amount: amount,
+		Status: ClaimOpen, FiledAt: s.timestamp(time.Now())}
+
+	switch {
+	case kind != ClaimLost && kind != ClaimDamaged:
+		return c, fmt.Errorf("failed to file claim against parcel %d: %w: unknown kind %q", number, ErrInvalidClaim, kind)
+	case amount <= 0:
+		return c, fmt.Errorf("failed to file claim against parcel %d: %w: amount must be positive", number, ErrInvalidClaim)
+	case c.Description == "":
+		return c, fmt.Errorf("failed to file claim against parcel %d: %w: description is required", number, ErrInvalidClaim)
+	case utf8.RuneCountInString(c.Description) > MaxClaimDescriptionLength:
+		return c, fmt.Errorf("failed to file claim against parcel %d: %w: description is longer than %d characters",
+			number, ErrInvalidClaim, MaxClaimDescriptionLength)
+	}
+
+	err := s.store.InTx(func(tx ParcelStore) error {
+		status, err := tx.getStatus(number)
+		if err != nil {
+			return err
+		}
+		if !claimable(kind, status) {
+			return fmt.Errorf("failed to file claim against parcel %d: %w: %s claims not allowed in status %s",
+				number, ErrInvalidClaim, kind, status)
+		}
+
+		claims, err := tx.ListClaims(number)
+		if err != nil {
+			return err
+		}
+		for _, other := range claims {
+			if other.Status == ClaimOpen || other.Status == ClaimApproved {
+				return fmt.Errorf("failed to file claim against parcel %d: %w: claim %d is %s",
+					number, ErrInvalidClaim, other.ID, other.Status)
+			}
+		}
+
+		if c.ID, err = tx.addClaim(c); err != nil {
+			return err
+		}
+		_, err = tx.AddWorkItem(WorkItem{Number: number, Kind: WorkItemClaimFiled, CreatedAt: c.FiledAt,
+			Detail: fmt.Sprintf("claim %d: %s, amount %d", c.ID, kind, amount)})
+		return err
+	})
+	return c, mapError(err)
+}
+
+// claimable reports whether a claim of kind may be filed against a
+// parcel in status: damaged once delivered, lost while in transit.
+func claimable(kind, status string) bool {
+	if kind == ClaimDamaged {
+		return status == ParcelStatusDelivered
+	}
+	return inTransit(status)
+}
+
+// ApproveClaim approves an open claim for payout, or for the amount
+// claimed if payout is 0, and returns it. The payout is capped by the
+// declared value of the parcel less what earlier claims against it paid
+// out, and by the amount claimed.
+//
+// Behaviour:
+//   - Returns ErrClaimNotFound (wrapped) if the claim does not exist.
+//   - Returns ErrClaimTransition (wrapped) unless the claim is open.
+//   - Returns ErrInvalidClaim (wrapped) for a negative payout.
+func (s ParcelService) ApproveClaim(id, payout int, note string) (Claim, error) {
+	if payout < 0 {
+		return Claim{}, fmt.Errorf("failed to approve claim %d: %w: negative payout", id, ErrInvalidClaim)
+	}
+
+	var c Claim
+	err := s.store.InTx(func(tx ParcelStore) error {
+		var err error
+		if c, err = tx.GetClaim(id); err != nil {
+			return err
+		}
+		if c.Status != ClaimOpen {
+			return fmt.Errorf("failed to approve claim %d: %w: claim is %s", id, ErrClaimTransition, c.Status)
+		}
+		parcel, err := tx.Get(c.Number)
+		if err != nil {
+			return err
+		}
+		claims, err := tx.ListClaims(c.Number)
+		if err != nil {
+			return err
+		}
+
+		limit := parcel.DeclaredValue
+		for _, other := range claims {
+			if other.Status == ClaimApproved || other.Status == ClaimPaid {
+				limit -= other.Payout
+			}
+		}
+		if payout == 0 {
+			payout = c.Amount
+		}
+		c.Payout = max(0, min(payout, c.Amount, limit))
+		c.Status, c.Resolution, c.ResolvedAt = ClaimApproved, strings.TrimSpace(note), s.timestamp(time.Now())
+		return tx.updateClaim(c)
+	})
+	return c, mapError(err)
+}
+
+// RejectClaim rejects an open claim for reason and returns it.
+//
+// Behaviour:
+//   - Returns ErrInvalidClaim (wrapped) for an empty reason.
+//   - Returns ErrClaimNotFound (wrapped) if the claim does not exist.
+//   - Returns ErrClaimTransition (wrapped) unless the claim is open.
+func (s ParcelService) RejectClaim(id int, reason string) (Claim, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return Claim{}, fmt.Errorf("failed to reject claim %d: %w: reason is required", id, ErrInvalidClaim)
+	}
+	return s.resolveClaim(id, ClaimOpen, func(c *Claim) {
+		c.Status, c.Resolution, c.ResolvedAt = ClaimRejected, reason, s.timestamp(time.Now())
+	})
+}
+
+// PayClaim records that the payout of an approved claim was made and
+// returns the claim.
+//
+// Behaviour:
+//   - Returns ErrClaimNotFound (wrapped) if the claim does not exist.
+//   - Returns ErrClaimTransition (wrapped) unless the claim is approved.
+func (s ParcelService) PayClaim(id int) (Claim, error) {
+	return s.resolveClaim(id, ClaimApproved, func(c *Claim) {
+		c.Status, c.ResolvedAt = ClaimPaid, s.timestamp(time.Now())
+	})
+}
+
+// resolveClaim applies change to the claim, which must be in status from.
+func (s ParcelService) resolveClaim(id int, from string, change func(c *Claim)) (Claim, error) {
+	var c Claim
+	err := s.store.InTx(func(tx ParcelStore) error {
+		var err error
+		if c, err = tx.GetClaim(id); err != nil {
+			return err
+		}
+		if c.Status != from {
+			return fmt.Errorf("failed to update claim %d: %w: claim is %s, want %s", id, ErrClaimTransition, c.Status, from)
+		}
+		change(&c)
+		return tx.updateClaim(c)
+	})
+	return c, err
+}
+
+// Claim returns the claim with the given id.
+func (s ParcelService) Claim(id int) (Claim, error) {
+	return s.store.GetClaim(id)
+}
+
+// ParcelClaims returns the claims against the parcel, oldest first.
+func (s ParcelService) ParcelClaims(number int) ([]Claim, error) {
+	if _, err := s.Get(number); err != nil {
+		return nil, err
+	}
+	return s.store.ListClaims(number)
+}
+
+// ClaimsByStatus returns the claims in status, oldest first.
+func (s ParcelService) ClaimsByStatus(status string) ([]Claim, error) {
+	return s.store.GetClaimsByStatus(status)
+}
+
+// OpenClaims returns the claims awaiting a decision, oldest first.
+func (s ParcelService) OpenClaims() ([]Claim, error) {
+	return s.store.GetClaimsByStatus(ClaimOpen)
+}
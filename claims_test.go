@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getClaimableParcel returns a sent parcel with a declared value of 1000.
+func getClaimableParcel(t *testing.T, service ParcelService) Parcel {
+	t.Helper()
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", DeclaredValue: 1000, Payment: PaymentPaid})
+	require.NoError(t, err)
+	require.NoError(t, service.NextStatus(parcel.Number))
+	return parcel
+}
+
+// TestFileClaim checks the validation of claims filed against a parcel.
+func TestFileClaim(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	parcel := getClaimableParcel(t, service)
+	registered, err := service.Register(1000, "test")
+	require.NoError(t, err)
+
+	// check
+	tests := []struct {
+		name        string
+		number      int
+		kind        string
+		amount      int
+		description string
+		err         error
+	}{
+		{"unknown kind", parcel.Number, "stolen", 100, "gone", ErrInvalidClaim},
+		{"no amount", parcel.Number, ClaimLost, 0, "gone", ErrInvalidClaim},
+		{"no description", parcel.Number, ClaimLost, 100, "  ", ErrInvalidClaim},
+		{"long description", parcel.Number, ClaimLost, 100, strings.Repeat("x", MaxClaimDescriptionLength+1), ErrInvalidClaim},
+		{"damaged before delivery", parcel.Number, ClaimDamaged, 100, "broken", ErrInvalidClaim},
+		{"lost before dispatch", registered.Number, ClaimLost, 100, "gone", ErrInvalidClaim},
+		{"missing parcel", 999, ClaimLost, 100, "gone", ErrParcelNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.FileClaim(tt.number, tt.kind, tt.amount, tt.description)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	claim, err := service.FileClaim(parcel.Number, ClaimLost, 1500, " never arrived ")
+	require.NoError(t, err)
+	assert.Equal(t, "never arrived", claim.Description)
+	assert.Equal(t, ClaimOpen, claim.Status)
+	_, err = service.FileClaim(parcel.Number, ClaimLost, 100, "still missing")
+	assert.ErrorIs(t, err, ErrInvalidClaim)
+
+	open, err := service.OpenClaims()
+	require.NoError(t, err)
+	assert.Equal(t, []Claim{claim}, open)
+}
+
+// TestSettleClaim checks approving, rejecting and paying claims, and that
+// payouts never exceed the declared value.
+func TestSettleClaim(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	parcel := getClaimableParcel(t, service)
+
+	// reject
+	claim, err := service.FileClaim(parcel.Number, ClaimLost, 300, "never arrived")
+	require.NoError(t, err)
+	_, err = service.RejectClaim(claim.ID, "")
+	assert.ErrorIs(t, err, ErrInvalidClaim)
+	_, err = service.PayClaim(claim.ID)
+	assert.ErrorIs(t, err, ErrClaimTransition)
+	claim, err = service.RejectClaim(claim.ID, "found at the depot")
+	require.NoError(t, err)
+	assert.Equal(t, ClaimRejected, claim.Status)
+	assert.NotEmpty(t, claim.ResolvedAt)
+
+	// approve
+	require.NoError(t, service.NextStatus(parcel.Number))
+	claim, err = service.FileClaim(parcel.Number, ClaimDamaged, 800, "crushed box")
+	require.NoError(t, err)
+	claim, err = service.ApproveClaim(claim.ID, 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, 800, claim.Payout)
+	_, err = service.ApproveClaim(claim.ID, 0, "")
+	assert.ErrorIs(t, err, ErrClaimTransition)
+	claim, err = service.PayClaim(claim.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ClaimPaid, claim.Status)
+
+	// the second payout is capped by what is left of the declared value
+	claim, err = service.FileClaim(parcel.Number, ClaimDamaged, 500, "contents broken too")
+	require.NoError(t, err)
+	claim, err = service.ApproveClaim(claim.ID, 500, "")
+	require.NoError(t, err)
+	assert.Equal(t, 200, claim.Payout)
+
+	// check
+	claims, err := service.ParcelClaims(parcel.Number)
+	require.NoError(t, err)
+	require.Len(t, claims, 3)
+	assert.Equal(t, []string{ClaimRejected, ClaimPaid, ClaimApproved},
+		[]string{claims[0].Status, claims[1].Status, claims[2].Status})
+	_, err = service.Claim(999)
+	assert.ErrorIs(t, err, ErrClaimNotFound)
+}
+
+// TestClaimsHTTP checks /parcels/{number}/claims and /claims, and that
+// clients cannot settle claims.
+func TestClaimsHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	parcel := getClaimableParcel(t, service)
+	h := NewHTTPHandler(service)
+
+	// check
+	path := fmt.Sprintf("/parcels/%d/claims", parcel.Number)
+	rec := doRequest(t, h, http.MethodPost, path, `{"kind": "lost", "amount": 2000, "description": "never arrived"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var claim claimJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&claim))
+	assert.Equal(t, fmt.Sprintf("/claims/%d", claim.ID), rec.Header().Get("Location"))
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodPost, path, `{"kind": "lost"}`).Code)
+
+	rec = doRequest(t, h, http.MethodGet, "/claims", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var open []claimJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&open))
+	assert.Equal(t, []claimJSON{claim}, open)
+
+	rec = doRequest(t, h, http.MethodPost, fmt.Sprintf("/claims/%d/approve", claim.ID), `{"note": "lost in transit"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&claim))
+	assert.Equal(t, 1000, claim.Payout)
+	assert.Equal(t, http.StatusConflict,
+		doRequest(t, h, http.MethodPost, fmt.Sprintf("/claims/%d/reject", claim.ID), `{"reason": "late"}`).Code)
+	assert.Equal(t, http.StatusOK, doRequest(t, h, http.MethodPost, fmt.Sprintf("/claims/%d/pay", claim.ID), "").Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodGet, "/claims/999", "").Code)
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodGet, "/claims?status=lost", "").Code)
+
+	client := NewAuthorizedService(service, Principal{Role: RoleClient, Client: parcel.Client})
+	claims, err := client.ParcelClaims(parcel.Number)
+	require.NoError(t, err)
+	assert.Len(t, claims, 1)
+	_, err = client.OpenClaims()
+	assert.ErrorIs(t, err, ErrForbidden)
+	other := NewAuthorizedService(service, Principal{Role: RoleClient, Client: 2000})
+	_, err = other.Claim(claim.ID)
+	assert.ErrorIs(t, err, ErrForbidden)
+}
@@ -0,0 +1,921 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrUnknownCommand indicates a command-line subcommand that does not exist.
+var ErrUnknownCommand = errors.New("unknown command")
+
+// commands maps subcommand names to their implementations. Each receives
+// the arguments following its name.
+var commands = map[string]func(args []string) error{
+	"apikey":    cmdAPIKey,
+	"backup":    cmdBackup,
+	"doctor":    cmdDoctor,
+	"dump":      cmdDump,
+	"erase":     cmdErase,
+	"label":     cmdLabel,
+	"load":      cmdLoad,
+	"loadtest":  cmdLoadTest,
+	"openapi":   cmdOpenAPI,
+	"reencrypt": cmdReencrypt,
+	"repair":    cmdRepair,
+	"report":    cmdReport,
+	"restore":   cmdRestore,
+	"restrict":  cmdRestrict,
+	"seed":      cmdSeed,
+	"serve":     cmdServe,
+	"status":    cmdStatus,
+	"tariff":    cmdTariff,
+}
+
+// runCommand runs the named subcommand.
+func runCommand(name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownCommand, name)
+	}
+	return cmd(args)
+}
+
+// openStore opens the tracker database at path with the default options
+// and the encryption keys of EncryptionKeysEnv, if set, and brings its
+// schema up to date.
+func openStore(path string) (ParcelStore, error) {
+	db := DefaultConfig().Database
+	db.Path = path
+	db.EncryptionKeys = os.Getenv(EncryptionKeysEnv)
+	return db.Open()
+}
+
+// cmdLabel renders the shipping label of a parcel:
+//
+//	label -number 42 [-out label-42.png] [-db tracker.db]
+//
+// "-out -" writes the PNG to standard output.
+func cmdLabel(args []string) error {
+	fs := flag.NewFlagSet("label", flag.ContinueOnError)
+	path := fs.String("db", database, "path to the tracker database")
+	number := fs.Int("number", 0, "parcel number")
+	out := fs.String("out", "", `output file, "-" for standard output (default "label-<number>.png")`)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *number <= 0 {
+		return errors.New("label: -number is required")
+	}
+	if *out == "" {
+		*out = fmt.Sprintf("label-%d.png", *number)
+	}
+
+	store, err := openStore(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	service := NewParcelService(store, nil)
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return service.Label(*number, w)
+}
+
+// cmdOpenAPI writes the OpenAPI document of the REST API and, with
+// -client, generates the Go client package from it:
+//
+//	openapi [-o openapi.json] [-client client/client.go]
+//
+// "-o -" (the default) writes the document to standard output. The
+// client package is named after the directory of its file.
+func cmdOpenAPI(args []string) error {
+	fs := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	out := fs.String("o", "-", `output file of the document, "-" for standard output`)
+	client := fs.String("client", "", "output file of the generated client")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	doc := OpenAPI()
+	spec, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode OpenAPI document: %w", err)
+	}
+	spec = append(spec, '\n')
+	if *out == "-" {
+		if _, err := os.Stdout.Write(spec); err != nil {
+			return err
+		}
+	} else if err := os.WriteFile(*out, spec, 0o644); err != nil {
+		return err
+	}
+
+	if *client == "" {
+		return nil
+	}
+	pkg := filepath.Base(filepath.Dir(*client))
+	if abs, err := filepath.Abs(*client); err == nil {
+		pkg = filepath.Base(filepath.Dir(abs))
+	}
+	src, err := GenerateClient(doc, pkg)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*client, src, 0o644)
+}
+
+// cmdReport writes a report as CSV to standard output:
+//
+//	report -kind status|client|day|delivery|overdue [-from 2024-01-01] [-to 2024-02-01] [-lang ru] [-db tracker.db]
+//
+// -from and -to select parcels by registration date (UTC), -to exclusive.
+// With -lang the status report has a "label" column naming each status
+// in that language.
+func cmdReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	path := fs.String("db", database, "path to the tracker database")
+	kind := fs.String("kind", "status", "report: status, client, day, delivery or overdue")
+	from := fs.String("from", "", "first registration date included, YYYY-MM-DD")
+	to := fs.String("to", "", "first registration date excluded, YYYY-MM-DD")
+	lang := fs.String("lang", "", "language of the status labels added to the status report")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var period ReportPeriod
+	for _, bound := range []struct {
+		flag  string
+		value string
+		t     *time.Time
+	}{{"from", *from, &period.From}, {"to", *to, &period.To}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.DateOnly, bound.value)
+		if err != nil {
+			return fmt.Errorf("report: -%s must be a date like 2024-01-31: %w", bound.flag, err)
+		}
+		*bound.t = t
+	}
+
+	store, err := openStore(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	records, err := ReportCSV(store, *kind, period)
+	if err != nil {
+		return err
+	}
+	if *lang != "" && *kind == "status" {
+		labels, err := store.GetLabels(*lang)
+		if err != nil {
+			return err
+		}
+		records[0] = append(records[0], "label")
+		for i, record := range records[1:] {
+			records[i+1] = append(record, labels.Name(record[0]))
+		}
+	}
+	w := csv.NewWriter(os.Stdout)
+	w.WriteAll(records)
+	return w.Error()
+}
+
+// cmdLoadTest measures throughput with each journal mode given (see
+// RunLoadTest) and prints the results as CSV:
+//
+//	loadtest [-parcels 100000] [-clients 1000] [-workers 8] [-duration 10s] [-writes 0.2] [-journal WAL,DELETE]
+//
+// Each mode gets a fresh database in a temporary directory, removed
+// afterwards.
+func cmdLoadTest(args []string) error {
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	parcels := fs.Int("parcels", 100_000, "parcels to seed before measuring")
+	clients := fs.Int("clients", 1000, "clients the parcels are spread over")
+	workers := fs.Int("workers", 8, "concurrent workers")
+	duration := fs.Duration("duration", 10*time.Second, "how long to measure each journal mode")
+	writes := fs.Float64("writes", 0.2, "share of operations adding a parcel, the rest read a client's parcels")
+	journal := fs.String("journal", "WAL,DELETE", "comma-separated journal modes to compare")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *writes < 0 || *writes > 1 {
+		return errors.New("loadtest: -writes must be between 0 and 1")
+	}
+
+	dir, err := os.MkdirTemp("", "loadtest")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"journal_mode", "seeded", "seed_seconds", "reads_per_second", "writes_per_second", "errors"})
+	for _, mode := range strings.Split(*journal, ",") {
+		opts := DefaultOptions()
+		opts.JournalMode = strings.TrimSpace(mode)
+		res, err := RunLoadTest(filepath.Join(dir, opts.JournalMode+".db"), opts, LoadTest{Parcels: *parcels,
+			Clients: *clients, Workers: *workers, Duration: *duration, WriteRatio: *writes})
+		if err != nil {
+			return fmt.Errorf("loadtest: journal mode %s: %w", opts.JournalMode, err)
+		}
+		w.Write([]string{opts.JournalMode, strconv.Itoa(res.Seeded), fmt.Sprintf("%.2f", res.SeedTime.Seconds()),
+			fmt.Sprintf("%.0f", res.ReadsPerSecond()), fmt.Sprintf("%.0f", res.WritesPerSecond()), strconv.Itoa(res.Errors)})
+		w.Flush()
+	}
+	return w.Error()
+}
+
+// cmdSeed adds fabricated parcels to the database (see Fixtures), for
+// integration and demo environments:
+//
+//	seed [-n 1000] [-seed 1] [-clients 50] [-months 6] [-db tracker.db]
+//
+// The same -seed fabricates the same parcels, but for their creation
+// times, which are relative to now.
+func cmdSeed(args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	path := fs.String("db", database, "path to the tracker database")
+	n := fs.Int("n", 1000, "parcels to add")
+	seed := fs.Int64("seed", 1, "seed of the generator")
+	clients := fs.Int("clients", 50, "clients the parcels are spread over")
+	months := fs.Int("months", 6, "months the registrations are spread over")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *n <= 0 || *clients <= 0 || *months <= 0 {
+		return errors.New("seed: -n, -clients and -months must be positive")
+	}
+
+	store, err := openStore(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	fixtures := NewFixtures(*seed, time.Now())
+	fixtures.Clients = *clients
+	fixtures.From = fixtures.To.AddDate(0, -*months, 0)
+	parcels, err := fixtures.Seed(store, *n)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("added %d parcels, numbers %d to %d\n", len(parcels), parcels[0].Number, parcels[len(parcels)-1].Number)
+	return nil
+}
+
+// cmdServe runs the REST API and the tracking page:
+//
+//	serve [-config tracker.yaml] [-addr :8080] [-db tracker.db] [-demo] [-auth=false] [-rate 5 -burst 20] [-pricing]
+//	      [-duplicate-window 10m [-flag-duplicates]] [-geocoder https://nominatim.example/search]
+//	      [-cache 10000] [-redis localhost:6379] [-cache-ttl 1m] [-delivery-codes]
+//
+// The database, listen address, deadlines, notification and backup
+// settings come from the configuration (see LoadConfig), overridden by
+// the flags given.
+// The schema is migrated on startup. SIGINT or SIGTERM shut the server
+// down gracefully (see Serve).
+// With -demo the database defaults to demo.db, which is created, migrated
+// and seeded with sample parcels on first run.
+// API routes require an API key unless authentication is turned off with
+// -auth=false or the http.auth setting, for development only.
+func cmdServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv(ConfigEnv), "YAML configuration file, overridden by TRACKER_* variables and flags")
+	addr := fs.String("addr", "", `listen address (default ":8080")`)
+	path := fs.String("db", "", `path to the tracker database (default from the configuration, or "demo.db" with -demo)`)
+	demo := fs.Bool("demo", false, "create and seed a demo database")
+	auth := fs.Bool("auth", true, "require an API key (see the apikey command) on API routes; -auth=false serves them to anyone as admin, for development only")
+	rate := fs.Float64("rate", 0, "allowed changes per second per caller, 0 for no limit")
+	burst := fs.Int("burst", 20, "changes a caller may make at once before -rate applies")
+	dupWindow := fs.Duration("duplicate-window", 0, "reject repeated registrations to the same address within this window, 0 to allow")
+	flagDups := fs.Bool("flag-duplicates", false, "register suspected duplicates with duplicate_of set instead of rejecting them")
+	geocoder := fs.String("geocoder", "", "Nominatim-style search URL used to store coordinates of addresses")
+	pricing := fs.Bool("pricing", false, "price parcels at registration using the default zone tariff")
+	smtpAddr := fs.String("smtp", "", "SMTP server (host:port) for e-mail notifications")
+	smtpFrom := fs.String("smtp-from", "", `sender of e-mail notifications (default "tracker@localhost")`)
+	cacheSize := fs.Int("cache", 0, "number of parcels and client lists cached in memory, 0 to disable")
+	cacheTTL := fs.Duration("cache-ttl", time.Minute, "how long a cached parcel may be served")
+	redirects := fs.Bool("redirect-after-dispatch", false, "allow changing the address of sent parcels, recording each change")
+	proofDir := fs.String("proof-dir", "", "directory for proof of delivery images instead of the database")
+	deliveryCodes := fs.Bool("delivery-codes", false, "issue a code when a parcel is sent and require it to deliver the parcel")
+	redisAddr := fs.String("redis", "", "Redis server (host:port) shared by instances as parcel cache; -cache sizes the local cache in front of it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := LoadConfig(*configPath, os.LookupEnv)
+	if err != nil {
+		return err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.HTTP.Addr = *addr
+		case "db":
+			cfg.Database.Path = *path
+		case "smtp":
+			cfg.Notifications.SMTP = *smtpAddr
+		case "smtp-from":
+			cfg.Notifications.SMTPFrom = *smtpFrom
+		case "auth":
+			cfg.HTTP.Auth = *auth
+		}
+	})
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	RevealPII(cfg.Log.RevealPII)
+
+	var store ParcelStore
+	if *demo {
+		if *path == "" {
+			cfg.Database.Path = "demo.db"
+		}
+		store, err = openDemoStore(cfg.Database, os.Stdout)
+	} else {
+		store, err = cfg.Database.Open()
+	}
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var local *ParcelCache
+	if *cacheSize > 0 {
+		local = NewParcelCache(*cacheSize, *cacheTTL)
+	}
+	if *redisAddr != "" {
+		cache := NewRedisCache(RedisConfig{Addr: *redisAddr, TTL: *cacheTTL, Local: local,
+			OnError: func(err error) { log.Printf("cache: %v", err) }})
+		go listenRedis(ctx, cache)
+		store = store.WithCache(cache)
+	} else if local != nil {
+		store = store.WithCache(local)
+	}
+	if err := store.Preflight(ctx, cfg.Database.Options()); err != nil {
+		return err
+	}
+
+	addressPolicy := cfg.AddressChange.AddressChangePolicy()
+	addressPolicy.AfterDispatch = addressPolicy.AfterDispatch || *redirects
+	serviceStore := store.WithAddressValidator(BasicAddressNormalizer{}).
+		WithAddressChangePolicy(addressPolicy)
+	if *geocoder != "" {
+		serviceStore = serviceStore.WithGeocoder(NominatimGeocoder{Endpoint: *geocoder})
+	}
+	events := NewEventBus()
+	service := NewParcelService(serviceStore, events).WithSLA(cfg.SLA.SLAPolicy())
+	if *pricing {
+		service = service.WithPricing(nil)
+	}
+	if *dupWindow > 0 {
+		policy := DuplicatePolicy{Window: *dupWindow, Action: DuplicateReject}
+		if *flagDups {
+			policy.Action = DuplicateFlag
+		}
+		service = service.WithDuplicatePolicy(policy)
+	}
+	if *proofDir != "" {
+		service = service.WithProofStorage(DirStorage{Dir: *proofDir})
+	}
+	if *deliveryCodes {
+		service = service.WithDeliveryCodes(DeliveryCodePolicy{MaxAttempts: DefaultDeliveryCodeAttempts})
+	}
+
+	scheduler := NewScheduler(func(job string, err error) {
+		log.Printf("job %s: %v", job, err)
+	})
+	scheduler.Every(time.Minute, OverdueJob(service))
+	scheduler.Every(15*time.Minute, DelayJob(service))
+	scheduler.Every(time.Minute, ActivationJob(service))
+	scheduler.Every(24*time.Hour, ArchiveJob(store, 90*24*time.Hour))
+	scheduler.Every(15*time.Minute, AnalyticsJob(store, 8*24*time.Hour))
+	if b := cfg.Backup; b.Dir != "" {
+		if err := os.MkdirAll(b.Dir, 0o750); err != nil {
+			return fmt.Errorf("failed to create backup directory: %w", err)
+		}
+		if err := scheduler.Every(b.Interval, BackupJob(store, b.Dir, b.Keep)); err != nil {
+			return err
+		}
+	}
+	if n := cfg.Notifications; n.SMTP != "" {
+		notifier := NewNotifier(store, map[string]Channel{
+			ChannelEmail: SMTPChannel{Addr: n.SMTP, From: n.SMTPFrom},
+		}, n.Retry.RetryPolicy())
+		defer notifier.Subscribe(events, func(err error) { log.Printf("notifications: %v", err) })()
+		scheduler.Every(30*time.Second, NotificationJob(notifier))
+	}
+	if err := scheduler.Start(ctx); err != nil {
+		return err
+	}
+	defer scheduler.Stop()
+	service = service.WithLivenessChecks(scheduler.HealthChecks()...)
+
+	var middleware []func(http.Handler) http.Handler
+	if cfg.HTTP.Auth {
+		middleware = append(middleware, APIKeyAuth(store))
+	} else {
+		log.Print("authentication is off: API routes serve anyone as admin")
+		middleware = append(middleware, AllowAnonymous(Principal{Role: RoleAdmin}))
+	}
+	if *rate > 0 {
+		middleware = append(middleware, RateLimit(NewRateLimiter(*rate, *burst)))
+	}
+	if cfg.HTTP.PublicIDsOnly {
+		middleware = append(middleware, PublicIDsOnly)
+	}
+
+	ln, err := net.Listen("tcp", cfg.HTTP.Addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("serving %s on %s", cfg.Database.Path, ln.Addr())
+	if err := Serve(ctx, ln, NewHTTPHandler(service, middleware...), cfg.HTTP.ShutdownTimeout); err != nil {
+		return err
+	}
+	log.Print("shut down")
+	return nil
+}
+
+// listenRedis applies the cache invalidations of other instances until
+// ctx is done, resubscribing after errors.
+func listenRedis(ctx context.Context, cache *RedisCache) {
+	for {
+		err := cache.Listen(ctx)
+		if err == nil {
+			return
+		}
+		log.Printf("cache invalidations: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// cmdBackup writes a consistent copy of the database, safe to take while
+// the server runs (see ParcelStore.Backup):
+//
+//	backup -out tracker-backup.db [-db tracker.db]
+func cmdBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	path := fs.String("db", database, "path to the tracker database")
+	out := fs.String("out", "", "backup file to create")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return errors.New("backup: -out is required")
+	}
+
+	store, err := openStore(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	return store.Backup(*out)
+}
+
+// cmdRestore replaces the contents of the database with a backup (see
+// ParcelStore.Restore):
+//
+//	restore -from tracker-backup.db [-db tracker.db]
+//
+// Running servers see the restored data at once, but may serve parcels
+// from their caches until the entries expire.
+func cmdRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	path := fs.String("db", database, "path to the tracker database")
+	from := fs.String("from", "", "backup file to restore")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" {
+		return errors.New("restore: -from is required")
+	}
+
+	store, err := openStore(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	return store.Restore(*from)
+}
+
+// cmdDump exports every row of the database as line-delimited JSON (see
+// ParcelStore.DumpJSONL), to the file -out or to standard output:
+//
+//	dump [-out tracker.jsonl] [-db tracker.db]
+func cmdDump(args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	path := fs.String("db", database, "path to the tracker database")
+	out := fs.String("out", "", "dump file to create (default: standard output)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := openStore(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if *out == "" {
+		return store.DumpJSONL(os.Stdout)
+	}
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := store.DumpJSONL(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// cmdLoad imports a dump written by dump into a database without parcels
+// (see ParcelStore.LoadJSONL):
+//
+//	load -in tracker.jsonl [-db tracker.db]
+func cmdLoad(args []string) error {
+	fs := flag.NewFlagSet("load", flag.ContinueOnError)
+	path := fs.String("db", database, "path to the tracker database")
+	in := fs.String("in", "", "dump file to load")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" {
+		return errors.New("load: -in is required")
+	}
+
+	f, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	store, err := openStore(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	return store.LoadJSONL(f)
+}
+
+// cmdErase erases the data of a client on request, keeping the parcels
+// within the configured retention anonymised (see
+// ParcelService.EraseClientData), and prints the tombstone recorded:
+//
+//	erase -client 1000 [-config tracker.yaml] [-db tracker.db]
+func cmdErase(args []string) error {
+	fs := flag.NewFlagSet("erase", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv(ConfigEnv), "YAML configuration file with the retention policy")
+	path := fs.String("db", "", "path to the tracker database (default from the configuration)")
+	client := fs.Int("client", 0, "client whose data to erase")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *client <= 0 {
+		return errors.New("erase: -client is required")
+	}
+
+	cfg, err := LoadConfig(*configPath, os.LookupEnv)
+	if err != nil {
+		return err
+	}
+	if *path != "" {
+		cfg.Database.Path = *path
+	}
+	store, err := cfg.Database.Open()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	service := NewParcelService(store, nil).WithRetention(cfg.Retention.RetentionPolicy())
+	erasure, err := service.EraseClientData(*client)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("erasure %d of client %d at %s: %d parcels deleted, %d anonymised (retention %s)\n",
+		erasure.ID, erasure.Client, erasure.ErasedAt, erasure.Deleted, erasure.Anonymised, erasure.Retention)
+	return nil
+}
+
+// cmdReencrypt encrypts addresses and phones stored in plaintext or with
+// a retired key with the current key of the key ring in
+// TRACKER_DB_ENCRYPTION_KEYS (see ParcelStore.ReencryptFields):
+//
+//	reencrypt [-db tracker.db]
+//
+// To rotate keys, put the new key first in the ring, keeping the old
+// ones, run reencrypt, and then drop the old keys.
+func cmdReencrypt(args []string) error {
+	fs := flag.NewFlagSet("reencrypt", flag.ContinueOnError)
+	path := fs.String("db", database, "path to the tracker database")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if os.Getenv(EncryptionKeysEnv) == "" {
+		return fmt.Errorf("reencrypt: %s is required", EncryptionKeysEnv)
+	}
+
+	store, err := openStore(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	n, err := store.ReencryptFields()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d values re-encrypted\n", n)
+	return nil
+}
+
+// cmdStatus forces the status of a parcel, e.g. to undo a mis-scan, and
+// records the override with the reason and actor (see
+// ParcelService.ForceSetStatus):
+//
+//	status -number 42 -set sent -reason "scanned as delivered by mistake" [-actor name] [-db tracker.db]
+//
+// The actor defaults to the user running the command.
+func cmdStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	path := fs.String("db", database, "path to the tracker database")
+	number := fs.Int("number", 0, "parcel number")
+	status := fs.String("set", "", "status to force: registered, sent or delivered")
+	reason := fs.String("reason", "", "why the status is forced, recorded in the audit")
+	actor := fs.String("actor", os.Getenv("USER"), "who forces the status")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *number <= 0 || *status == "" {
+		return errors.New("status: -number and -set are required")
+	}
+
+	store, err := openStore(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	return NewParcelService(store.WithActor(Actor{Kind: ActorUser, ID: *actor}), nil).ForceSetStatus(*number, *status, *reason, *actor)
+}
+
+// cmdTariff lists, sets or deletes tariff bands:
+//
+//	tariff [-db tracker.db]
+//	tariff -max-weight 1000 -price 25000 [-zone default]
+//	tariff -max-weight 1000 -delete [-zone default]
+//
+// Prices are in kopecks.
+func cmdTariff(args []string) error {
+	fs := flag.NewFlagSet("tariff", flag.ContinueOnError)
+	path := fs.String("db", database, "path to the tracker database")
+	zone := fs.String("zone", DefaultZone, "delivery zone")
+	maxWeight := fs.Int("max-weight", 0, "upper bound of the weight band in grams")
+	price := fs.Int("price", -1, "price of the band in kopecks")
+	del := fs.Bool("delete", false, "delete the band instead of setting it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := openStore(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	switch {
+	case *del:
+		return store.DeleteTariff(*zone, *maxWeight)
+	case *maxWeight != 0 || *price != -1:
+		return store.SetTariff(Tariff{Zone: *zone, MaxWeightGrams: *maxWeight, Price: *price})
+	}
+
+	tariffs, err := store.GetTariffs()
+	if err != nil {
+		return err
+	}
+	for _, t := range tariffs {
+		fmt.Printf("%-16s up to %7d g  %d.%02d\n", t.Zone, t.MaxWeightGrams, t.Price/100, t.Price%100)
+	}
+	return nil
+}
+
+// cmdRestrict lists, adds or lifts content restrictions:
+//
+//	restrict [-db tracker.db]
+//	restrict -category batteries [-zone remote]
+//	restrict -delete 3
+//
+// Without -zone the category is restricted for every destination.
+func cmdRestrict(args []string) error {
+	fs := flag.NewFlagSet("restrict", flag.ContinueOnError)
+	path := fs.String("db", database, "path to the tracker database")
+	category := fs.String("category", "", "content category to restrict")
+	zone := fs.String("zone", "", "delivery zone; empty for every destination")
+	del := fs.Int("delete", 0, "id of the restriction to lift")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := openStore(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	switch {
+	case *del != 0:
+		return store.DeleteContentRestriction(*del)
+	case *category != "":
+		_, err := store.AddContentRestriction(*category, *zone)
+		return err
+	}
+
+	restrictions, err := store.GetContentRestrictions()
+	if err != nil {
+		return err
+	}
+	for _, r := range restrictions {
+		zone := r.Zone
+		if zone == "" {
+			zone = "(everywhere)"
+		}
+		fmt.Printf("%4d  %-12s %s\n", r.ID, r.Category, zone)
+	}
+	return nil
+}
+
+// cmdDoctor scans the database for anomalies (see Doctor) and prints
+// them, one per line; with -fix it fixes those that are safe to fix:
+//
+//	doctor [-fix] [-db tracker.db]
+//
+// It fails if anomalies are left, so that it can guard scripts.
+func cmdDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	path := fs.String("db", database, "path to the tracker database")
+	fix := fs.Bool("fix", false, "fix the anomalies that are safe to fix")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := openStore(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	anomalies, err := store.Doctor(*fix)
+	if err != nil {
+		return err
+	}
+	left := 0
+	for _, a := range anomalies {
+		state := ""
+		switch {
+		case a.Fixed:
+			state = "fixed"
+		case a.Fixable:
+			state = "fixable with -fix"
+			left++
+		default:
+			left++
+		}
+		fmt.Printf("%-22s %-22s %8d  %s  %s\n", a.Kind, a.Table, a.Number, a.Detail, state)
+	}
+	if left > 0 {
+		return fmt.Errorf("doctor: %d anomalies left", left)
+	}
+	return nil
+}
+
+// cmdRepair lists parcels with an unknown status, or sets the unknown
+// statuses given to known ones (see RepairStatuses):
+//
+//	repair [-db tracker.db]
+//	repair -fix shipped=sent,lost=registered
+func cmdRepair(args []string) error {
+	fs := flag.NewFlagSet("repair", flag.ContinueOnError)
+	path := fs.String("db", database, "path to the tracker database")
+	fix := fs.String("fix", "", "comma-separated unknown=known statuses to repair")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := openStore(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if *fix != "" {
+		fixes, err := parseStatusFixes(*fix)
+		if err != nil {
+			return fmt.Errorf("repair: %w", err)
+		}
+		n, err := store.WithActor(Actor{Kind: ActorUser, ID: os.Getenv("USER")}).RepairStatuses(fixes)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("repaired %d parcels\n", n)
+		return nil
+	}
+
+	bad, err := store.ListBadStatuses()
+	if err != nil {
+		return err
+	}
+	for _, b := range bad {
+		fmt.Printf("%8d  %q\n", b.Number, b.Status)
+	}
+	return nil
+}
+
+// cmdAPIKey lists, issues, rotates or revokes API keys:
+//
+//	apikey [-db tracker.db]
+//	apikey -issue -name shop -role client -client 42
+//	apikey -rotate -id 3
+//	apikey -revoke -id 3
+//
+// Issued keys are printed once; only their hash is stored.
+func cmdAPIKey(args []string) error {
+	fs := flag.NewFlagSet("apikey", flag.ContinueOnError)
+	path := fs.String("db", database, "path to the tracker database")
+	issue := fs.Bool("issue", false, "issue a new key")
+	rotate := fs.Bool("rotate", false, "replace key -id with a new one")
+	revoke := fs.Bool("revoke", false, "revoke key -id")
+	id := fs.Int("id", 0, "key id for -rotate and -revoke")
+	name := fs.String("name", "", "key name for -issue")
+	role := fs.String("role", string(RoleClient), "role for -issue: operator, courier, admin or client")
+	client := fs.Int("client", 0, "client id for -issue with the client role")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := openStore(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var key APIKey
+	var secret string
+	switch {
+	case *issue:
+		key, secret, err = store.IssueAPIKey(*name, Principal{Role: Role(*role), Client: *client})
+	case *rotate:
+		key, secret, err = store.RotateAPIKey(*id)
+	case *revoke:
+		return store.RevokeAPIKey(*id)
+	default:
+		keys, err := store.GetAPIKeys()
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			state := "active"
+			if k.RevokedAt != "" {
+				state = "revoked " + k.RevokedAt
+			}
+			fmt.Printf("%4d  %-20s %-8s client %-6d %s\n", k.ID, k.Name, k.Principal.Role, k.Principal.Client, state)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("key %d (%s): %s\n", key.ID, key.Name, secret)
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxCommentLength is the maximum length of a comment in characters.
+const MaxCommentLength = 2000
+
+// ErrInvalidComment indicates a comment without author or text, or with
+// a text longer than MaxCommentLength.
+var ErrInvalidComment = newError(CodeInvalidComment, "invalid comment")
+
+// Comment is a note left on a parcel by support staff, e.g. "customer
+// rescheduled" or "dog at address".
+type Comment struct {
+	ID        int
+	Number    int
+	Author    string
+	Text      string
+	CreatedAt string
+}
+
+// AddComment appends a comment by author to the parcel and returns it.
+// Surrounding white space is trimmed from author and text.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidComment (wrapped) for an empty author or text, or a
+//     text longer than MaxCommentLength characters.
+//   - Returns sql.ErrNoRows (wrapped) if the parcel does not exist.
+//   - Wraps and returns any SQL error from the INSERT.
+func (s ParcelStore) AddComment(number int, author, text string) (Comment, error) {
+	c := Comment{Number: number, Author: strings.TrimSpace(author), Text: strings.TrimSpace(text),
+		CreatedAt: FormatTimestamp(time.Now(), DefaultTimestampPrecision)}
+
+	if err := s.check(); err != nil {
+		return c, err
+	}
+
+	switch {
+	case c.Author == "":
+		return c, fmt.Errorf("failed to add comment to parcel %d: %w: author is required", number, ErrInvalidComment)
+	case c.Text == "":
+		return c, fmt.Errorf("failed to add comment to parcel %d: %w: text is required", number, ErrInvalidComment)
+	case utf8.RuneCountInString(c.Text) > MaxCommentLength:
+		return c, fmt.Errorf("failed to add comment to parcel %d: %w: text is longer than %d characters", number, ErrInvalidComment, MaxCommentLength)
+	}
+	if _, err := s.getStatus(number); err != nil {
+		return c, err
+	}
+
+	query := `INSERT INTO parcel_comments (parcel_number, author, text, created_at)
+VALUES (:number, :author, :text, :created_at)`
+	res, err := s.conn().Exec(query, sql.Named("number", number), sql.Named("author", c.Author),
+		sql.Named("text", c.Text), sql.Named("created_at", c.CreatedAt))
+	if err != nil {
+		return c, fmt.Errorf("failed to add comment to parcel %d: %w", number, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return c, fmt.Errorf("failed to get id of comment added to parcel %d: %w", number, err)
+	}
+	c.ID = int(id)
+	return c, nil
+}
+
+// ListComments returns the comments of a parcel, oldest first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if the parcel has no comments.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) ListComments(number int) ([]Comment, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, parcel_number, author, text, created_at FROM parcel_comments
+WHERE parcel_number = :number ORDER BY id`
+	rows, err := s.conn().Query(query, sql.Named("number", number))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for comments of parcel %d: %w", number, err)
+	}
+	defer rows.Close()
+
+	var res []Comment
+	for rows.Next() {
+		var c Comment
+		if err := rows.Scan(&c.ID, &c.Number, &c.Author, &c.Text, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan one of comment rows for parcel %d: %w", number, err)
+		}
+		res = append(res, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate comment rows for parcel %d: %w", number, err)
+	}
+	return res, nil
+}
+
+// AddComment appends a comment to the parcel; see ParcelStore.AddComment.
+func (s ParcelService) AddComment(number int, author, text string) (Comment, error) {
+	c, err := s.store.AddComment(number, author, text)
+	return c, mapError(err)
+}
+
+// Comments returns the comments of the parcel, oldest first.
+func (s ParcelService) Comments(number int) ([]Comment, error) {
+	comments, err := s.store.ListComments(number)
+	return comments, mapError(err)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestComments checks adding, listing and validating comments, and that
+// deleting the parcel removes them.
+func TestComments(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	number, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// add
+	first, err := store.AddComment(number, " support ", "customer rescheduled ")
+	require.NoError(t, err)
+	assert.NotZero(t, first.ID)
+	assert.Equal(t, "support", first.Author)
+	assert.Equal(t, "customer rescheduled", first.Text)
+	_, err = store.AddComment(number, "courier", "dog at address")
+	require.NoError(t, err)
+
+	// check
+	comments, err := store.ListComments(number)
+	require.NoError(t, err)
+	require.Len(t, comments, 2)
+	assert.Equal(t, first, comments[0])
+	assert.Equal(t, "dog at address", comments[1].Text)
+
+	_, err = store.AddComment(number, "", "text")
+	assert.ErrorIs(t, err, ErrInvalidComment)
+	_, err = store.AddComment(number, "support", "  ")
+	assert.ErrorIs(t, err, ErrInvalidComment)
+	_, err = store.AddComment(number, "support", strings.Repeat("ж", MaxCommentLength+1))
+	assert.ErrorIs(t, err, ErrInvalidComment)
+	_, err = store.AddComment(number+1, "support", "text")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, store.Delete(number))
+	comments, err = store.ListComments(number)
+	require.NoError(t, err)
+	assert.Empty(t, comments)
+}
+
+// TestCommentsHTTP checks /parcels/{number}/comments and that clients
+// cannot see comments, even on their own parcels.
+func TestCommentsHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test"})
+	require.NoError(t, err)
+	h := NewHTTPHandler(service)
+	path := fmt.Sprintf("/parcels/%d/comments", parcel.Number)
+
+	// check
+	rec := doRequest(t, h, http.MethodPost, path, `{"author": "support", "text": "dog at address"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = doRequest(t, h, http.MethodGet, path, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var comments []commentJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&comments))
+	require.Len(t, comments, 1)
+	assert.Equal(t, "dog at address", comments[0].Text)
+
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodPost, path, `{"author": "support"}`).Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodGet, "/parcels/999/comments", "").Code)
+
+	client := NewAuthorizedService(service, Principal{Role: RoleClient, Client: 1000})
+	_, err = client.Comments(parcel.Number)
+	assert.ErrorIs(t, err, ErrForbidden)
+}
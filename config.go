@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidConfig indicates a configuration file or environment variable
+// that does not parse, or settings that fail validation.
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// ConfigEnv names the environment variable holding the path of the
+// configuration file, used when none is given on the command line.
+const ConfigEnv = "TRACKER_CONFIG"
+
+// EncryptionKeysEnv names the environment variable holding the key ring
+// of field encryption, which is better kept out of configuration files.
+const EncryptionKeysEnv = "TRACKER_DB_ENCRYPTION_KEYS"
+
+// Config holds the settings of the tracker server. LoadConfig fills it
+// from DefaultConfig, an optional YAML file and environment variables, in
+// that order of precedence (later wins).
+type Config struct {
+	Database      DatabaseConfig      `yaml:"database"`
+	HTTP          HTTPConfig          `yaml:"http"`
+	SLA           SLAConfig           `yaml:"sla"`
+	AddressChange AddressChangeConfig `yaml:"address_change"`
+	Notifications NotificationsConfig `yaml:"notifications"`
+	Backup        BackupConfig        `yaml:"backup"`
+	Retention     RetentionConfig     `yaml:"retention"`
+	Log           LogConfig           `yaml:"log"`
+}
+
+// DatabaseConfig selects the database and its connection settings; see
+// Options for the pragmas.
+type DatabaseConfig struct {
+	// Driver is the database/sql driver name; it must be registered.
+	// AuditDriver runs SQLite with every statement audited.
+	Driver string `yaml:"driver"`
+	// Path is the database file, the DSN before pragmas are added.
+	Path         string        `yaml:"path"`
+	JournalMode  string        `yaml:"journal_mode"`
+	BusyTimeout  time.Duration `yaml:"busy_timeout"`
+	ForeignKeys  bool          `yaml:"foreign_keys"`
+	Synchronous  string        `yaml:"synchronous"`
+	QueryTimeout time.Duration `yaml:"query_timeout"`
+	TxLock       string        `yaml:"tx_lock"`
+	// EncryptionKeys, if set, is the key ring addresses and phones are
+	// encrypted with (see ParseKeyRing and WithFieldEncryption).
+	EncryptionKeys string `yaml:"encryption_keys"`
+}
+
+// HTTPConfig configures the API server.
+type HTTPConfig struct {
+	Addr string `yaml:"addr"`
+	// ShutdownTimeout bounds how long in-flight requests may take to
+	// finish on shutdown; see Serve.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// PublicIDsOnly stops the API from addressing parcels by number; see
+	// PublicIDsOnly.
+	PublicIDsOnly bool `yaml:"public_ids_only"`
+	// Auth requires an API key (see APIKeyAuth) on API routes. Turning it
+	// off serves them to anyone as admin (see AllowAnonymous), which is
+	// only fit for development.
+	Auth bool `yaml:"auth"`
+}
+
+// SLAConfig holds the delivery windows of the service classes; zero means
+// no deadline. See SLAPolicy.
+type SLAConfig struct {
+	Express  time.Duration `yaml:"express"`
+	Standard time.Duration `yaml:"standard"`
+	Economy  time.Duration `yaml:"economy"`
+}
+
+// AddressChangeConfig is the YAML form of AddressChangePolicy, to match
+// the terms of the carrier contract.
+type AddressChangeConfig struct {
+	AfterDispatch bool          `yaml:"after_dispatch"`
+	Window        time.Duration `yaml:"window"`
+}
+
+// NotificationsConfig configures the delivery of notifications. They are
+// sent by e-mail through SMTP if set, and retried as Retry says.
+type NotificationsConfig struct {
+	SMTP     string      `yaml:"smtp"`
+	SMTPFrom string      `yaml:"smtp_from"`
+	Retry    RetryConfig `yaml:"retry"`
+}
+
+// RetryConfig is the YAML form of RetryPolicy.
+type RetryConfig struct {
+	MaxAttempts int           `yaml:"max_attempts"`
+	Backoff     time.Duration `yaml:"backoff"`
+}
+
+// BackupConfig schedules backups of the database; see BackupJob. Backups
+// are off while Dir is empty.
+type BackupConfig struct {
+	Dir      string        `yaml:"dir"`
+	Interval time.Duration `yaml:"interval"`
+	// Keep is how many backups to keep in Dir; zero keeps all of them.
+	Keep int `yaml:"keep"`
+}
+
+// RetentionConfig is the YAML form of RetentionPolicy: parcels of a
+// client erasing its data are kept, anonymised, for Keep after creation.
+type RetentionConfig struct {
+	Keep time.Duration `yaml:"keep"`
+}
+
+// LogConfig configures error messages and log records.
+type LogConfig struct {
+	// RevealPII shows personal data instead of RedactedPII; see RevealPII.
+	RevealPII bool `yaml:"reveal_pii"`
+}
+
+// DefaultConfig returns the settings the server used before it was
+// configurable: tracker.db with DefaultOptions, port 8080 with
+// DefaultShutdownTimeout and API keys required, DefaultSLAPolicy and DefaultRetryPolicy, and no
+// e-mail or backups; once a backup directory is set, a daily backup is
+// taken and the last week of them kept. No parcels are retained when a
+// client's data is erased, and personal data is redacted from errors.
+func DefaultConfig() Config {
+	opts := DefaultOptions()
+	retry := DefaultRetryPolicy()
+	return Config{
+		Database: DatabaseConfig{
+			Driver:       driver,
+			Path:         database,
+			JournalMode:  opts.JournalMode,
+			BusyTimeout:  opts.BusyTimeout,
+			ForeignKeys:  opts.ForeignKeys,
+			Synchronous:  opts.Synchronous,
+			QueryTimeout: opts.QueryTimeout,
+			TxLock:       opts.TxLock,
+		},
+		HTTP: HTTPConfig{Addr: ":8080", ShutdownTimeout: DefaultShutdownTimeout, Auth: true},
+		SLA:  SLAConfig{Express: ExpressDeadline, Standard: StandardDeadline, Economy: EconomyDeadline},
+		Notifications: NotificationsConfig{
+			SMTPFrom: "tracker@localhost",
+			Retry:    RetryConfig{MaxAttempts: retry.MaxAttempts, Backoff: retry.Backoff},
+		},
+		Backup: BackupConfig{Interval: 24 * time.Hour, Keep: 7},
+	}
+}
+
+// configEnvVars maps the environment variables LoadConfig reads to the
+// setting each one overrides.
+var configEnvVars = map[string]func(c *Config, value string) error{
+	"TRACKER_DB_DRIVER":        func(c *Config, v string) error { c.Database.Driver = v; return nil },
+	"TRACKER_DB":               func(c *Config, v string) error { c.Database.Path = v; return nil },
+	"TRACKER_DB_JOURNAL_MODE":  func(c *Config, v string) error { c.Database.JournalMode = v; return nil },
+	"TRACKER_DB_BUSY_TIMEOUT":  durationEnv(func(c *Config) *time.Duration { return &c.Database.BusyTimeout }),
+	"TRACKER_DB_QUERY_TIMEOUT": durationEnv(func(c *Config) *time.Duration { return &c.Database.QueryTimeout }),
+	"TRACKER_DB_FOREIGN_KEYS": func(c *Config, v string) (err error) {
+		c.Database.ForeignKeys, err = strconv.ParseBool(v)
+		return err
+	},
+	"TRACKER_DB_SYNCHRONOUS":   func(c *Config, v string) error { c.Database.Synchronous = v; return nil },
+	"TRACKER_DB_TX_LOCK":       func(c *Config, v string) error { c.Database.TxLock = v; return nil },
+	EncryptionKeysEnv:          func(c *Config, v string) error { c.Database.EncryptionKeys = v; return nil },
+	"TRACKER_ADDR":             func(c *Config, v string) error { c.HTTP.Addr = v; return nil },
+	"TRACKER_SHUTDOWN_TIMEOUT": durationEnv(func(c *Config) *time.Duration { return &c.HTTP.ShutdownTimeout }),
+	"TRACKER_PUBLIC_IDS_ONLY": func(c *Config, v string) (err error) {
+		c.HTTP.PublicIDsOnly, err = strconv.ParseBool(v)
+		return err
+	},
+	"TRACKER_AUTH": func(c *Config, v string) (err error) {
+		c.HTTP.Auth, err = strconv.ParseBool(v)
+		return err
+	},
+	"TRACKER_SLA_EXPRESS":  durationEnv(func(c *Config) *time.Duration { return &c.SLA.Express }),
+	"TRACKER_SLA_STANDARD": durationEnv(func(c *Config) *time.Duration { return &c.SLA.Standard }),
+	"TRACKER_SLA_ECONOMY":  durationEnv(func(c *Config) *time.Duration { return &c.SLA.Economy }),
+	"TRACKER_ADDRESS_CHANGE_AFTER_DISPATCH": func(c *Config, v string) (err error) {
+		c.AddressChange.AfterDispatch, err = strconv.ParseBool(v)
+		return err
+	},
+	"TRACKER_ADDRESS_CHANGE_WINDOW": durationEnv(func(c *Config) *time.Duration { return &c.AddressChange.Window }),
+	"TRACKER_SMTP":                  func(c *Config, v string) error { c.Notifications.SMTP = v; return nil },
+	"TRACKER_SMTP_FROM":             func(c *Config, v string) error { c.Notifications.SMTPFrom = v; return nil },
+	"TRACKER_RETRY_ATTEMPTS": func(c *Config, v string) (err error) {
+		c.Notifications.Retry.MaxAttempts, err = strconv.Atoi(v)
+		return err
+	},
+	"TRACKER_RETRY_BACKOFF":   durationEnv(func(c *Config) *time.Duration { return &c.Notifications.Retry.Backoff }),
+	"TRACKER_BACKUP_DIR":      func(c *Config, v string) error { c.Backup.Dir = v; return nil },
+	"TRACKER_BACKUP_INTERVAL": durationEnv(func(c *Config) *time.Duration { return &c.Backup.Interval }),
+	"TRACKER_BACKUP_KEEP": func(c *Config, v string) (err error) {
+		c.Backup.Keep, err = strconv.Atoi(v)
+		return err
+	},
+	"TRACKER_RETENTION_KEEP": durationEnv(func(c *Config) *time.Duration { return &c.Retention.Keep }),
+	"TRACKER_LOG_REVEAL_PII": func(c *Config, v string) (err error) {
+		c.Log.RevealPII, err = strconv.ParseBool(v)
+		return err
+	},
+}
+
+// durationEnv returns a setter of the duration field selected by field.
+func durationEnv(field func(c *Config) *time.Duration) func(c *Config, value string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err == nil {
+			*field(c) = d
+		}
+		return err
+	}
+}
+
+// LoadConfig returns the configuration read from the YAML file at path,
+// if path is not empty, and the environment variables found by lookupEnv
+// (os.LookupEnv outside tests).
+//
+// Behaviour:
+//   - Settings missing from the file and the environment keep their
+//     DefaultConfig values.
+//   - Environment variables (see configEnvVars) override the file.
+//   - Returns ErrInvalidConfig (wrapped) for unknown keys in the file,
+//     values that do not parse, or a configuration failing Validate.
+//   - Wraps and returns errors reading the file.
+func LoadConfig(path string, lookupEnv func(string) (string, bool)) (Config, error) {
+	cfg := DefaultConfig()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read configuration: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+		}
+	}
+
+	for name, set := range configEnvVars {
+		value, ok := lookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := set(&cfg, value); err != nil {
+			return cfg, fmt.Errorf("%w: %s=%q: %v", ErrInvalidConfig, name, value, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Validate reports whether the settings can be used: a registered driver,
+// a database path, valid pragmas (see Options.Validate) and encryption
+// keys, a listen address,
+// non-negative timeouts, deadlines, address change window and retention,
+// a usable retry policy and, if backups are on, a backup schedule.
+func (c Config) Validate() error {
+	if !driverRegistered(c.Database.Driver) {
+		return fmt.Errorf("%w: database driver %q is not registered", ErrInvalidConfig, c.Database.Driver)
+	}
+	if c.Database.Path == "" {
+		return fmt.Errorf("%w: empty database path", ErrInvalidConfig)
+	}
+	if err := c.Database.Options().Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	if c.Database.EncryptionKeys != "" {
+		if _, err := ParseKeyRing(c.Database.EncryptionKeys); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+	}
+	if c.HTTP.Addr == "" {
+		return fmt.Errorf("%w: empty listen address", ErrInvalidConfig)
+	}
+	if c.HTTP.ShutdownTimeout < 0 {
+		return fmt.Errorf("%w: negative shutdown timeout", ErrInvalidConfig)
+	}
+	if c.SLA.Express < 0 || c.SLA.Standard < 0 || c.SLA.Economy < 0 {
+		return fmt.Errorf("%w: negative SLA deadline", ErrInvalidConfig)
+	}
+	if c.AddressChange.Window < 0 {
+		return fmt.Errorf("%w: negative address change window", ErrInvalidConfig)
+	}
+	if c.Notifications.SMTP != "" && c.Notifications.SMTPFrom == "" {
+		return fmt.Errorf("%w: e-mail notifications require a sender", ErrInvalidConfig)
+	}
+	if r := c.Notifications.Retry; r.MaxAttempts < 1 || r.Backoff < 0 {
+		return fmt.Errorf("%w: retry policy needs at least one attempt and a non-negative backoff", ErrInvalidConfig)
+	}
+	if c.Retention.Keep < 0 {
+		return fmt.Errorf("%w: negative retention", ErrInvalidConfig)
+	}
+	if b := c.Backup; b.Dir != "" && (b.Interval <= 0 || b.Keep < 0) {
+		return fmt.Errorf("%w: backups need a positive interval and a non-negative count to keep", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// driverRegistered reports whether name is a registered database/sql driver.
+func driverRegistered(name string) bool {
+	for _, d := range sql.Drivers() {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Options returns the connection settings of c.
+func (c DatabaseConfig) Options() Options {
+	return Options{
+		JournalMode:  c.JournalMode,
+		BusyTimeout:  c.BusyTimeout,
+		ForeignKeys:  c.ForeignKeys,
+		Synchronous:  c.Synchronous,
+		QueryTimeout: c.QueryTimeout,
+		TxLock:       c.TxLock,
+	}
+}
+
+// Open opens the database c describes, creating the schema on a fresh
+// file, and brings its schema up to date (see EnsureSchema). With
+// EncryptionKeys set, the store encrypts addresses and phones.
+func (c DatabaseConfig) Open() (ParcelStore, error) {
+	var ring KeyRing
+	if c.EncryptionKeys != "" {
+		var err error
+		if ring, err = ParseKeyRing(c.EncryptionKeys); err != nil {
+			return ParcelStore{}, err
+		}
+	}
+	store, err := openParcelStore(c.Driver, c.Path, c.Options())
+	if err != nil {
+		return ParcelStore{}, err
+	}
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		store.Close()
+		return ParcelStore{}, err
+	}
+	if c.EncryptionKeys != "" {
+		store = store.WithFieldEncryption(ring)
+	}
+	return store, nil
+}
+
+// SLAPolicy returns the policy of the configured deadlines.
+func (c SLAConfig) SLAPolicy() SLAPolicy {
+	return SLAPolicy{Default: c.Standard, Levels: map[string]time.Duration{
+		ServiceExpress: c.Express,
+		ServiceEconomy: c.Economy,
+	}}
+}
+
+// AddressChangePolicy returns the configured address change policy.
+func (c AddressChangeConfig) AddressChangePolicy() AddressChangePolicy {
+	return AddressChangePolicy{AfterDispatch: c.AfterDispatch, Window: c.Window}
+}
+
+// RetentionPolicy returns the configured retention policy.
+func (c RetentionConfig) RetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{Keep: c.Keep}
+}
+
+// RetryPolicy returns the configured retry policy.
+func (c RetryConfig) RetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: c.MaxAttempts, Backoff: c.Backoff}
+}
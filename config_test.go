@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestConfig writes data to a configuration file in a temporary
+// directory and returns its path.
+func writeTestConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tracker.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+	return path
+}
+
+// testEnv returns a lookup function over vars, for LoadConfig.
+func testEnv(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+// TestLoadConfig verifies the precedence of defaults, the file and the
+// environment.
+func TestLoadConfig(t *testing.T) {
+	// check
+	cfg, err := LoadConfig("", testEnv(nil))
+	require.NoError(t, err)
+	assert.Equal(t, DefaultConfig(), cfg)
+	assert.True(t, cfg.HTTP.Auth)
+	assert.Equal(t, DefaultOptions(), cfg.Database.Options())
+	assert.Equal(t, DefaultRetryPolicy(), cfg.Notifications.Retry.RetryPolicy())
+	assert.Equal(t, DefaultSLAPolicy(), cfg.SLA.SLAPolicy())
+
+	path := writeTestConfig(t, `
+database:
+  path: /var/lib/tracker/tracker.db
+  busy_timeout: 10s
+  foreign_keys: false
+http:
+  addr: ":9090"
+sla:
+  express: 24h
+address_change:
+  window: 30m
+notifications:
+  smtp: mail.example.com:25
+  retry:
+    max_attempts: 3
+`)
+	cfg, err = LoadConfig(path, testEnv(map[string]string{
+		"TRACKER_ADDR":                          ":7070",
+		"TRACKER_DB_QUERY_TIMEOUT":              "2s",
+		"TRACKER_RETRY_BACKOFF":                 "30s",
+		"TRACKER_BACKUP_DIR":                    "/var/backups/tracker",
+		"TRACKER_RETENTION_KEEP":                "8760h",
+		"TRACKER_LOG_REVEAL_PII":                "true",
+		"TRACKER_ADDRESS_CHANGE_AFTER_DISPATCH": "true",
+		"TRACKER_AUTH":                          "false",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "/var/lib/tracker/tracker.db", cfg.Database.Path)
+	assert.Equal(t, Options{JournalMode: "WAL", BusyTimeout: 10 * time.Second, Synchronous: "NORMAL",
+		QueryTimeout: 2 * time.Second, TxLock: "immediate"}, cfg.Database.Options())
+	assert.Equal(t, ":7070", cfg.HTTP.Addr)
+	assert.False(t, cfg.HTTP.Auth)
+	assert.Equal(t, 24*time.Hour, cfg.SLA.SLAPolicy().Deadline(ServiceExpress))
+	assert.Equal(t, StandardDeadline, cfg.SLA.SLAPolicy().Deadline(ServiceStandard))
+	assert.Equal(t, AddressChangePolicy{AfterDispatch: true, Window: 30 * time.Minute},
+		cfg.AddressChange.AddressChangePolicy())
+	assert.Equal(t, "mail.example.com:25", cfg.Notifications.SMTP)
+	assert.Equal(t, "tracker@localhost", cfg.Notifications.SMTPFrom)
+	assert.Equal(t, RetryPolicy{MaxAttempts: 3, Backoff: 30 * time.Second}, cfg.Notifications.Retry.RetryPolicy())
+	assert.Equal(t, BackupConfig{Dir: "/var/backups/tracker", Interval: 24 * time.Hour, Keep: 7}, cfg.Backup)
+	assert.Equal(t, RetentionPolicy{Keep: 365 * 24 * time.Hour}, cfg.Retention.RetentionPolicy())
+	assert.True(t, cfg.Log.RevealPII)
+}
+
+// TestLoadConfigInvalid verifies that unknown keys, unparsable values and
+// invalid settings are rejected.
+func TestLoadConfigInvalid(t *testing.T) {
+	// check
+	for _, data := range []string{
+		"database:\n  pth: tracker.db\n",
+		"sla:\n  express: two days\n",
+		"database:\n  journal_mode: SOMETIMES\n",
+		"database:\n  driver: postgres\n",
+		"http:\n  addr: \"\"\n",
+		"notifications:\n  retry:\n    max_attempts: 0\n",
+		"backup:\n  dir: backups\n  interval: 0s\n",
+		"retention:\n  keep: -24h\n",
+		"address_change:\n  window: -1m\n",
+	} {
+		_, err := LoadConfig(writeTestConfig(t, data), testEnv(nil))
+		assert.ErrorIs(t, err, ErrInvalidConfig, data)
+	}
+
+	_, err := LoadConfig(writeTestConfig(t, "database:\n  synchronous: SOMETIMES\n"), testEnv(nil))
+	assert.ErrorIs(t, err, ErrInvalidOption)
+
+	for name, value := range map[string]string{
+		"TRACKER_DB_FOREIGN_KEYS": "maybe",
+		"TRACKER_SLA_ECONOMY":     "-1h",
+		"TRACKER_RETRY_ATTEMPTS":  "five",
+		EncryptionKeysEnv:         "2024:short",
+	} {
+		_, err := LoadConfig("", testEnv(map[string]string{name: value}))
+		assert.ErrorIs(t, err, ErrInvalidConfig, name)
+	}
+
+	_, err = LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"), testEnv(nil))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+// TestDatabaseConfigOpen verifies that the configured database is opened,
+// initialised and migrated.
+func TestDatabaseConfigOpen(t *testing.T) {
+	// prepare
+	db := DefaultConfig().Database
+	db.Path = filepath.Join(t.TempDir(), "tracker.db")
+
+	// check
+	store, err := db.Open()
+	require.NoError(t, err)
+	defer store.Close()
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	assert.Positive(t, id)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultPhoneCountry is the country whose national phone formats are
+// accepted where no other country applies, e.g. for the recipient of a
+// domestic parcel.
+const DefaultPhoneCountry = "RU"
+
+// MaxEmailLength is the longest e-mail address accepted, in bytes.
+const MaxEmailLength = 254
+
+// ErrInvalidEmail indicates an e-mail address that is not of the form
+// local@domain.tld.
+var ErrInvalidEmail = newError(CodeInvalidEmail, "invalid e-mail address")
+
+// phonePlan is the numbering plan of a country: its calling code, the
+// trunk prefix dialled before national numbers, if any, and how many
+// digits national numbers have.
+type phonePlan struct {
+	code     string
+	trunk    string
+	national int
+}
+
+// phonePlans lists the countries whose national phone formats
+// NormalisePhoneIn understands, by ISO 3166-1 alpha-2 code.
+var phonePlans = map[string]phonePlan{
+	"RU": {code: "7", trunk: "8", national: 10},
+	"KZ": {code: "7", trunk: "8", national: 10},
+	"BY": {code: "375", trunk: "80", national: 9},
+	"UA": {code: "380", trunk: "0", national: 9},
+	"GB": {code: "44", trunk: "0", national: 10},
+	"FR": {code: "33", trunk: "0", national: 9},
+	"US": {code: "1", national: 10},
+	"CA": {code: "1", national: 10},
+}
+
+// NormalisePhone returns phone in E.164 form, accepting the national
+// formats of DefaultPhoneCountry; see NormalisePhoneIn.
+func NormalisePhone(phone string) (string, error) {
+	return NormalisePhoneIn(phone, DefaultPhoneCountry)
+}
+
+// NormalisePhoneIn returns phone in E.164 form: "+" and 8 to 15 digits.
+// A phone without "+" is read as a number of country.
+//
+// Behaviour:
+//   - Spaces, dashes, dots and parentheses are dropped.
+//   - A number of country written with its calling code or its trunk
+//     prefix and no "+", e.g. "8 (916) 123-45-67" in RU, becomes
+//     "+79161234567"; so does a bare national number in a country
+//     without a trunk prefix, e.g. "(202) 555-0123" in US.
+//   - Returns ErrInvalidRecipient (wrapped) for anything else that is not
+//     "+" followed by 8 to 15 digits, including numbers without "+" of a
+//     country missing from phonePlans.
+func NormalisePhoneIn(phone, country string) (string, error) {
+	var b strings.Builder
+	for i, c := range strings.TrimSpace(phone) {
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case c == '+' && i == 0:
+			b.WriteRune(c)
+		case strings.ContainsRune(" -.()", c):
+		default:
+			return "", fmt.Errorf("%w: phone %q contains %q", ErrInvalidRecipient, pii(phone), c)
+		}
+	}
+
+	res := b.String()
+	if !strings.HasPrefix(res, "+") {
+		national, ok := phonePlans[strings.ToUpper(strings.TrimSpace(country))].nationalNumber(res)
+		if !ok {
+			return "", fmt.Errorf("%w: phone %q must start with + and the country code", ErrInvalidRecipient, pii(phone))
+		}
+		res = national
+	}
+	if digits := len(res) - 1; digits < 8 || digits > 15 {
+		return "", fmt.Errorf("%w: phone %q must have 8 to 15 digits", ErrInvalidRecipient, pii(phone))
+	}
+	return res, nil
+}
+
+// nationalNumber returns digits, a number written without "+", in E.164
+// form, and false if it is not a number of the plan.
+func (p phonePlan) nationalNumber(digits string) (string, bool) {
+	switch {
+	case p.national == 0:
+		return "", false
+	case len(digits) == len(p.code)+p.national && strings.HasPrefix(digits, p.code):
+		return "+" + digits, true
+	case p.trunk != "" && len(digits) == len(p.trunk)+p.national && strings.HasPrefix(digits, p.trunk):
+		return "+" + p.code + digits[len(p.trunk):], true
+	case p.trunk == "" && len(digits) == p.national:
+		return "+" + p.code + digits, true
+	}
+	return "", false
+}
+
+// NormaliseEmail returns email trimmed, with its domain in lower case.
+// The local part is kept as it is: mail servers may tell its cases apart.
+//
+// Behaviour:
+//   - Returns ErrInvalidEmail (wrapped) for an address longer than
+//     MaxEmailLength, without exactly one "@", with a local part that is
+//     empty, longer than 64 bytes, has white space or control characters
+//     or misplaced dots, or with a domain that is not at least two
+//     dot-separated labels of letters, digits and inner hyphens ending in
+//     an alphabetic top-level domain.
+func NormaliseEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	local, domain, ok := strings.Cut(email, "@")
+	switch {
+	case len(email) > MaxEmailLength:
+		return "", fmt.Errorf("%w: %q is longer than %d bytes", ErrInvalidEmail, pii(email), MaxEmailLength)
+	case !ok || strings.Contains(domain, "@"):
+		return "", fmt.Errorf("%w: %q must have one @", ErrInvalidEmail, pii(email))
+	case !validEmailLocal(local):
+		return "", fmt.Errorf("%w: %q has an invalid local part", ErrInvalidEmail, pii(email))
+	}
+	domain = strings.ToLower(domain)
+	if !validEmailDomain(domain) {
+		return "", fmt.Errorf("%w: %q has an invalid domain", ErrInvalidEmail, pii(email))
+	}
+	return local + "@" + domain, nil
+}
+
+// validEmailLocal reports whether local is a plausible local part of an
+// e-mail address.
+func validEmailLocal(local string) bool {
+	if local == "" || len(local) > 64 || local[0] == '.' || local[len(local)-1] == '.' ||
+		strings.Contains(local, "..") {
+		return false
+	}
+	for _, c := range local {
+		if c <= ' ' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// validEmailDomain reports whether domain, in lower case, is a plausible
+// domain of an e-mail address.
+func validEmailDomain(domain string) bool {
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	tld := labels[len(labels)-1]
+	if len(tld) < 2 {
+		return false
+	}
+	for _, c := range tld {
+		if c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
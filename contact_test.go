@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNormalisePhoneIn checks the national phone formats of other
+// countries.
+func TestNormalisePhoneIn(t *testing.T) {
+	valid := []struct {
+		phone, country, want string
+	}{
+		{"020 7946 0958", "GB", "+442079460958"},
+		{"44 20 7946 0958", "gb", "+442079460958"},
+		{"(202) 555-0123", "US", "+12025550123"},
+		{"1 202 555 0123", "US", "+12025550123"},
+		{"80 29 123-45-67", "BY", "+375291234567"},
+		{"+33 1 23 45 67 89", "US", "+33123456789"},
+	}
+	for _, tt := range valid {
+		got, err := NormalisePhoneIn(tt.phone, tt.country)
+		require.NoError(t, err, tt.phone)
+		assert.Equal(t, tt.want, got, tt.phone)
+	}
+
+	invalid := []struct {
+		phone, country string
+	}{
+		{"8 (916) 123-45-67", "GB"},
+		{"020 7946 0958", "RU"},
+		{"2079460958", "GB"},
+		{"030 123456", "DE"},
+		{"030 123456", ""},
+	}
+	for _, tt := range invalid {
+		_, err := NormalisePhoneIn(tt.phone, tt.country)
+		assert.ErrorIs(t, err, ErrInvalidRecipient, tt.phone)
+	}
+}
+
+// TestNormaliseEmail checks the accepted e-mail addresses.
+func TestNormaliseEmail(t *testing.T) {
+	valid := map[string]string{
+		"ivan@example.com":              "ivan@example.com",
+		" Ivan.Petrov+parcels@Mail.RU ": "Ivan.Petrov+parcels@mail.ru",
+		"a@b-c.example.org":             "a@b-c.example.org",
+	}
+	for in, want := range valid {
+		got, err := NormaliseEmail(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	for _, in := range []string{"", "ivan", "ivan@", "@example.com", "ivan@@example.com", "a@b@example.com",
+		"iv an@example.com", ".ivan@example.com", "iv..an@example.com", "ivan@example", "ivan@-example.com",
+		"ivan@example..com", "ivan@example.c0m", "ivan@exa_mple.com"} {
+		_, err := NormaliseEmail(in)
+		assert.ErrorIs(t, err, ErrInvalidEmail, in)
+	}
+}
+
+// TestContactValidation verifies that recipient phones of international
+// parcels are read in the format of their destination and that
+// notification preferences are validated and normalised.
+func TestContactValidation(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	// check
+	p := getTestParcel()
+	p.International, p.Country = true, "GB"
+	p.Recipient = Recipient{Name: "John Smith", Phone: "020 7946 0958"}
+	number, err := store.Add(p)
+	require.NoError(t, err)
+	stored, err := store.Get(number)
+	require.NoError(t, err)
+	assert.Equal(t, "+442079460958", stored.Recipient.Phone)
+
+	p = getTestParcel()
+	p.Recipient = Recipient{Name: "Ivan Petrov", Phone: "020 7946 0958"}
+	_, err = store.Add(p)
+	assert.ErrorIs(t, err, ErrInvalidRecipient)
+
+	err = store.SetNotificationPreference(NotificationPreference{Client: 1000, Channel: ChannelEmail,
+		Recipient: "ivan@example", Enabled: true})
+	assert.ErrorIs(t, err, ErrInvalidPreference)
+	assert.ErrorIs(t, err, ErrInvalidEmail)
+	err = store.SetNotificationPreference(NotificationPreference{Client: 1000, Channel: ChannelSMS,
+		Recipient: "123", Enabled: true})
+	assert.ErrorIs(t, err, ErrInvalidPreference)
+	assert.ErrorIs(t, err, ErrInvalidRecipient)
+
+	require.NoError(t, store.SetNotificationPreference(NotificationPreference{Client: 1000, Channel: ChannelEmail,
+		Recipient: "Ivan@Example.COM", Enabled: true}))
+	prefs, err := store.GetNotificationPreferences(1000)
+	require.NoError(t, err)
+	require.Len(t, prefs, 1)
+	assert.Equal(t, "Ivan@example.com", prefs[0].Recipient)
+}
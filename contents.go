@@ -0,0 +1,265 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Content categories of dangerous or restricted goods. A parcel without
+// any holds general goods.
+const (
+	ContentBatteries  = "batteries"
+	ContentLiquids    = "liquids"
+	ContentAerosols   = "aerosols"
+	ContentFlammable  = "flammable"
+	ContentPerishable = "perishable"
+	ContentMedicines  = "medicines"
+)
+
+// contentCategories lists the known content categories.
+var contentCategories = []string{ContentBatteries, ContentLiquids, ContentAerosols, ContentFlammable,
+	ContentPerishable, ContentMedicines}
+
+var (
+	// ErrContentCategoryUnrecognised indicates a content category that is
+	// not one of the Content constants.
+	ErrContentCategoryUnrecognised = newError(CodeUnknownContent, "unrecognised content category")
+	// ErrRestrictedContents indicates a parcel whose contents may not be
+	// sent to its destination.
+	ErrRestrictedContents = newError(CodeRestrictedContents, "restricted contents")
+	// ErrRestrictionNotFound indicates that no content restriction exists
+	// with the requested id.
+	ErrRestrictionNotFound = newError(CodeRestrictionNotFound, "content restriction not found")
+)
+
+// knownContentCategory reports whether category is one of the Content
+// constants.
+func knownContentCategory(category string) bool {
+	for _, c := range contentCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// normaliseContents returns the categories sorted and without repeats, or
+// ErrContentCategoryUnrecognised (wrapped) for an unknown one.
+func normaliseContents(categories []string) ([]string, error) {
+	if len(categories) == 0 {
+		return nil, nil
+	}
+	res := make([]string, 0, len(categories))
+	for _, c := range categories {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if !knownContentCategory(c) {
+			return nil, fmt.Errorf("%w %q", ErrContentCategoryUnrecognised, c)
+		}
+		res = append(res, c)
+	}
+	sort.Strings(res)
+	unique := res[:0]
+	for i, c := range res {
+		if i == 0 || c != res[i-1] {
+			unique = append(unique, c)
+		}
+	}
+	return unique, nil
+}
+
+// encodeList returns the form of a list of codes, such as content
+// categories, kept in a column: comma separated, empty for no codes.
+func encodeList(codes []string) string {
+	return strings.Join(codes, ",")
+}
+
+// decodeList is the inverse of encodeList.
+func decodeList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// ContentRestriction forbids parcels holding Category from being sent to
+// Zone, the delivery zone of the tariffs; an empty Zone forbids it for
+// every destination.
+type ContentRestriction struct {
+	ID        int
+	Category  string
+	Zone      string
+	CreatedAt string
+}
+
+// AddContentRestriction forbids category for zone, or for every
+// destination if zone is empty, and returns the restriction. Adding an
+// existing restriction returns it unchanged.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrContentCategoryUnrecognised (wrapped) for an unknown
+//     category.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) AddContentRestriction(category, zone string) (ContentRestriction, error) {
+	r := ContentRestriction{Category: strings.ToLower(strings.TrimSpace(category)), Zone: strings.TrimSpace(zone),
+		CreatedAt: FormatTimestamp(time.Now(), DefaultTimestampPrecision)}
+
+	if err := s.check(); err != nil {
+		return r, err
+	}
+	if !knownContentCategory(r.Category) {
+		return r, fmt.Errorf("failed to add content restriction: %w %q", ErrContentCategoryUnrecognised, category)
+	}
+
+	err := s.InTx(func(tx ParcelStore) error {
+		query := `INSERT INTO content_restriction (category, zone, created_at) VALUES (:category, :zone, :created_at)
+ON CONFLICT (category, zone) DO NOTHING`
+		_, err := tx.conn().Exec(query, sql.Named("category", r.Category), sql.Named("zone", r.Zone),
+			sql.Named("created_at", r.CreatedAt))
+		if err != nil {
+			return fmt.Errorf("failed to add restriction of %s to zone %q: %w", r.Category, r.Zone, err)
+		}
+
+		err = tx.conn().QueryRow("SELECT id, created_at FROM content_restriction WHERE category = :category AND zone = :zone",
+			sql.Named("category", r.Category), sql.Named("zone", r.Zone)).Scan(&r.ID, &r.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to scan restriction of %s to zone %q: %w", r.Category, r.Zone, err)
+		}
+		return nil
+	})
+	return r, err
+}
+
+// GetContentRestrictions returns every content restriction, ordered by
+// category and zone.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) GetContentRestrictions() ([]ContentRestriction, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.conn().Query("SELECT id, category, zone, created_at FROM content_restriction ORDER BY category, zone")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for content restrictions: %w", err)
+	}
+	defer rows.Close()
+
+	res := []ContentRestriction{}
+	for rows.Next() {
+		var r ContentRestriction
+		if err := rows.Scan(&r.ID, &r.Category, &r.Zone, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan one of content restriction rows: %w", err)
+		}
+		res = append(res, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate content restriction rows: %w", err)
+	}
+	return res, nil
+}
+
+// DeleteContentRestriction lifts the content restriction with the given
+// id.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrRestrictionNotFound (wrapped) if no such restriction
+//     exists.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) DeleteContentRestriction(id int) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	res, err := s.conn().Exec("DELETE FROM content_restriction WHERE id = :id", sql.Named("id", id))
+	if err != nil {
+		return fmt.Errorf("failed to delete content restriction %d: %w", id, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete content restriction %d: %w", id, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("failed to delete content restriction %d: %w", id, ErrRestrictionNotFound)
+	}
+	return nil
+}
+
+// ContentRule is a hook deciding whether a parcel about to be registered
+// may be sent; it returns an error wrapping ErrRestrictedContents to
+// reject it. The parcel has its Zone set, DefaultZone if pricing is off.
+// tx is the registration transaction.
+type ContentRule func(tx ParcelStore, p Parcel) error
+
+// RestrictedContents is the ContentRule applied to every registration:
+// it rejects parcels holding a category restricted for their zone, or for
+// every destination, in the content_restriction table.
+func RestrictedContents(tx ParcelStore, p Parcel) error {
+	if len(p.Contents) == 0 {
+		return nil
+	}
+
+	categories := make([]any, len(p.Contents))
+	for i, c := range p.Contents {
+		categories[i] = c
+	}
+	query, args := selectFrom("content_restriction", "category, zone").WhereIn("category", categories...).
+		Where("zone IN ('', ?)", p.Zone).OrderBy("category", "zone").Limit(1).build()
+	var category, zone string
+	err := tx.conn().QueryRow(query, args...).Scan(&category, &zone)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up restrictions of parcel for client %d: %w", pii(p.Client), err)
+	}
+	if zone == "" {
+		return fmt.Errorf("%w: %s may not be sent", ErrRestrictedContents, category)
+	}
+	return fmt.Errorf("%w: %s may not be sent to zone %q", ErrRestrictedContents, category, zone)
+}
+
+// WithContentRule returns a copy of the service that also checks every
+// registration against rule, after RestrictedContents.
+func (s ParcelService) WithContentRule(rule ContentRule) ParcelService {
+	s.contentRules = append(append([]ContentRule(nil), s.contentRules...), rule)
+	return s
+}
+
+// checkContents applies RestrictedContents and the service's content
+// rules to parcel, which is about to be registered.
+func (s ParcelService) checkContents(tx ParcelStore, parcel Parcel) error {
+	if parcel.Zone == "" {
+		parcel.Zone = DefaultZone
+	}
+	for _, rule := range append([]ContentRule{RestrictedContents}, s.contentRules...) {
+		if err := rule(tx, parcel); err != nil {
+			return fmt.Errorf("failed to register parcel for client %d: %w", pii(parcel.Client), err)
+		}
+	}
+	return nil
+}
+
+// ContentRestrictions returns every content restriction.
+func (s ParcelService) ContentRestrictions() ([]ContentRestriction, error) {
+	return s.store.GetContentRestrictions()
+}
+
+// AddContentRestriction forbids category for zone, or for every
+// destination if zone is empty; see ParcelStore.AddContentRestriction.
+func (s ParcelService) AddContentRestriction(category, zone string) (ContentRestriction, error) {
+	return s.store.AddContentRestriction(category, zone)
+}
+
+// DeleteContentRestriction lifts the content restriction with the given
+// id.
+func (s ParcelService) DeleteContentRestriction(id int) error {
+	return s.store.DeleteContentRestriction(id)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAddWithContents verifies that contents are validated and stored
+// sorted and without repeats.
+func TestAddWithContents(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store, parcel := NewParcelStore(db), getTestParcel()
+
+	// check
+	parcel.Contents = []string{"explosives"}
+	_, err := store.Add(parcel)
+	require.ErrorIs(t, err, ErrContentCategoryUnrecognised)
+
+	parcel.Contents = []string{ContentLiquids, " Batteries ", ContentLiquids}
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, []string{ContentBatteries, ContentLiquids}, stored.Contents)
+
+	id, err = store.Add(getTestParcel())
+	require.NoError(t, err)
+	stored, err = store.Get(id)
+	require.NoError(t, err)
+	assert.Empty(t, stored.Contents)
+}
+
+// TestContentRestrictions verifies that registration is rejected for
+// categories restricted for the parcel's zone or for every destination.
+func TestContentRestrictions(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	service = service.WithPricing(func(p Parcel) string {
+		if p.Address == "island" {
+			return "remote"
+		}
+		return DefaultZone
+	})
+	store := service.store
+	require.NoError(t, store.SetTariff(Tariff{Zone: DefaultZone, MaxWeightGrams: 10_000, Price: 100}))
+	require.NoError(t, store.SetTariff(Tariff{Zone: "remote", MaxWeightGrams: 10_000, Price: 500}))
+
+	_, err := store.AddContentRestriction("explosives", "")
+	require.ErrorIs(t, err, ErrContentCategoryUnrecognised)
+	batteries, err := store.AddContentRestriction(ContentBatteries, "remote")
+	require.NoError(t, err)
+	again, err := store.AddContentRestriction(ContentBatteries, " remote ")
+	require.NoError(t, err)
+	assert.Equal(t, batteries, again)
+	_, err = store.AddContentRestriction(ContentFlammable, "")
+	require.NoError(t, err)
+
+	// check
+	tests := []struct {
+		name     string
+		address  string
+		contents []string
+		err      error
+	}{
+		{"general goods", "island", nil, nil},
+		{"allowed in zone", "test", []string{ContentBatteries}, nil},
+		{"restricted in zone", "island", []string{ContentLiquids, ContentBatteries}, ErrRestrictedContents},
+		{"restricted everywhere", "test", []string{ContentFlammable}, ErrRestrictedContents},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.RegisterParcel(Parcel{Client: 1000, Address: tt.address, Contents: tt.contents})
+			if tt.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.err)
+			}
+		})
+	}
+
+	require.NoError(t, store.DeleteContentRestriction(batteries.ID))
+	require.ErrorIs(t, store.DeleteContentRestriction(batteries.ID), ErrRestrictionNotFound)
+	_, err = service.RegisterParcel(Parcel{Client: 1000, Address: "island", Contents: []string{ContentBatteries}})
+	assert.NoError(t, err)
+}
+
+// TestWithContentRule checks that custom rules run after the table.
+func TestWithContentRule(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	var zones []string
+	service = service.WithContentRule(func(tx ParcelStore, p Parcel) error {
+		zones = append(zones, p.Zone)
+		if p.WeightGrams > 1000 && len(p.Contents) > 0 {
+			return fmt.Errorf("%w: too heavy", ErrRestrictedContents)
+		}
+		return nil
+	})
+
+	// check
+	_, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", WeightGrams: 2000})
+	require.NoError(t, err)
+	_, err = service.RegisterParcel(Parcel{Client: 1000, Address: "test", WeightGrams: 2000,
+		Contents: []string{ContentAerosols}})
+	assert.ErrorIs(t, err, ErrRestrictedContents)
+	assert.Equal(t, []string{DefaultZone, DefaultZone}, zones)
+}
+
+// TestContentRestrictionsHTTP checks /content-restrictions and the
+// contents of registered parcels.
+func TestContentRestrictionsHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service)
+
+	// check
+	rec := doRequest(t, h, http.MethodPost, "/content-restrictions", `{"category": "aerosols"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var restriction contentRestrictionJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&restriction))
+	assert.Equal(t, ContentAerosols, restriction.Category)
+	assert.Equal(t, http.StatusBadRequest,
+		doRequest(t, h, http.MethodPost, "/content-restrictions", `{"category": "gold"}`).Code)
+
+	rec = doRequest(t, h, http.MethodGet, "/content-restrictions", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var restrictions []contentRestrictionJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&restrictions))
+	assert.Equal(t, []contentRestrictionJSON{restriction}, restrictions)
+
+	body := `{"client": 1000, "address": "test", "contents": ["aerosols"]}`
+	assert.Equal(t, http.StatusUnprocessableEntity, doRequest(t, h, http.MethodPost, "/parcels", body).Code)
+	rec = doRequest(t, h, http.MethodPost, "/parcels", `{"client": 1000, "address": "test", "contents": ["liquids"]}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var parcel parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&parcel))
+	assert.Equal(t, []string{ContentLiquids}, parcel.Contents)
+
+	code, res := doGraphQL(t, h, `mutation {
+		register(client: 1000, address: "test", contents: ["perishable", "liquids"]) { contents }
+	}`, nil)
+	require.Equal(t, http.StatusOK, code)
+	require.Nil(t, res["errors"])
+	assert.Equal(t, []any{ContentLiquids, ContentPerishable}, res["data"].(map[string]any)["register"].(map[string]any)["contents"])
+
+	path := fmt.Sprintf("/content-restrictions/%d", restriction.ID)
+	assert.Equal(t, http.StatusNoContent, doRequest(t, h, http.MethodDelete, path, "").Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodDelete, path, "").Code)
+
+	operator := NewAuthorizedService(service, Principal{Role: RoleOperator})
+	_, err := operator.AddContentRestriction(ContentLiquids, "")
+	assert.ErrorIs(t, err, ErrForbidden)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSync indicates a batch of offline scans without a device, too
+// large, or with an event lacking its ID or time, or repeating an ID.
+var ErrInvalidSync = newError(CodeInvalidSync, "invalid sync batch")
+
+// MaxSyncBatch is the most events SyncScans accepts at once.
+const MaxSyncBatch = 500
+
+// Outcomes of an event of SyncScans.
+const (
+	// SyncApplied is an event recorded by this batch.
+	SyncApplied = "applied"
+	// SyncDuplicate is an event recorded by an earlier batch, e.g. one
+	// whose response the device never received.
+	SyncDuplicate = "duplicate"
+	// SyncRejected is an event the service refused, e.g. a delivery scan
+	// of a parcel that was not sent. It is not recorded, so the device
+	// may send it again.
+	SyncRejected = "rejected"
+)
+
+// OfflineScan is a scan recorded by a courier device while offline.
+type OfflineScan struct {
+	// ID identifies the event on its device; a device must not reuse it.
+	ID       string
+	Number   int
+	Type     string
+	Location Location
+	// ScannedAt is when the device read the parcel, by the device clock.
+	ScannedAt time.Time
+}
+
+// SyncResult is the outcome of one OfflineScan.
+type SyncResult struct {
+	ID     string
+	Number int
+	// Status is one of the Sync* outcomes.
+	Status string
+	// Scan is the scan recorded, by this batch or an earlier one; empty if
+	// rejected.
+	Scan Scan
+	// Err is why the event was rejected.
+	Err error
+}
+
+// SyncScans applies a batch of scans recorded offline by a courier device,
+// one at a time in the order given, each as by RecordScan at its own
+// ScannedAt, and returns the outcome of every event in the same order.
+//
+// Behaviour:
+//   - Returns ErrInvalidSync (wrapped) and applies nothing if device is
+//     empty, the batch is larger than MaxSyncBatch, or an event has no
+//     ID, repeats one, or has no ScannedAt.
+//   - An event the device already synced is not applied again; its result
+//     is SyncDuplicate with the scan recorded the first time.
+//   - An event failing with a coded error (see ErrorCodeOf), such as
+//     ErrParcelNotFound or ErrRequireSent, is SyncRejected; the rest of
+//     the batch is still applied.
+//   - Any other error stops the batch and is returned with the results so
+//     far. Those events stay applied, and are reported as duplicates when
+//     the device retries.
+func (s ParcelService) SyncScans(device string, events []OfflineScan) ([]SyncResult, error) {
+	if err := validateSync(device, events); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	results := make([]SyncResult, 0, len(events))
+	for _, e := range events {
+		sc := Scan{Number: e.Number, Type: e.Type, Warehouse: e.Location.Warehouse,
+			Description: strings.TrimSpace(e.Location.Description),
+			ScannedAt:   s.timestamp(e.ScannedAt), RecordedAt: s.timestamp(now), Device: device, EventID: e.ID}
+		res := SyncResult{ID: e.ID, Number: e.Number, Status: SyncApplied, Scan: sc}
+		var adv advanced
+
+		err := s.store.InTx(func(tx ParcelStore) error {
+			prev, err := tx.getDeviceScan(device, e.ID)
+			if err == nil {
+				res.Status, res.Scan = SyncDuplicate, prev
+				return nil
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			adv, err = s.recordScan(tx, sc)
+			return err
+		})
+		if err != nil {
+			err = mapError(err)
+			if ErrorCodeOf(err) == "" {
+				return results, err
+			}
+			res.Status, res.Scan, res.Err = SyncRejected, Scan{}, err
+		} else {
+			s.publishAdvanced(adv)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// validateSync checks a batch of SyncScans before any of it is applied.
+func validateSync(device string, events []OfflineScan) error {
+	if strings.TrimSpace(device) == "" {
+		return fmt.Errorf("failed to sync scans: %w: no device", ErrInvalidSync)
+	}
+	if len(events) > MaxSyncBatch {
+		return fmt.Errorf("failed to sync scans of device %q: %w: %d events, at most %d",
+			device, ErrInvalidSync, len(events), MaxSyncBatch)
+	}
+	seen := make(map[string]bool, len(events))
+	for i, e := range events {
+		switch {
+		case e.ID == "":
+			return fmt.Errorf("failed to sync scans of device %q: %w: event %d has no id", device, ErrInvalidSync, i)
+		case seen[e.ID]:
+			return fmt.Errorf("failed to sync scans of device %q: %w: event id %q repeated", device, ErrInvalidSync, e.ID)
+		case e.ScannedAt.IsZero():
+			return fmt.Errorf("failed to sync scans of device %q: %w: event %q has no time", device, ErrInvalidSync, e.ID)
+		}
+		seen[e.ID] = true
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSyncScans verifies that a batch is applied in order, rejected events
+// do not stop it, and a retried batch reports duplicates without applying
+// them again.
+func TestSyncScans(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", Payment: PaymentPaid})
+	require.NoError(t, err)
+	scannedAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	events := []OfflineScan{
+		{ID: "e1", Number: parcel.Number, Type: ScanOutbound, Location: Location{Description: "depot"}, ScannedAt: scannedAt},
+		{ID: "e2", Number: 999, Type: ScanInbound, Location: Location{Description: "depot"}, ScannedAt: scannedAt},
+		{ID: "e3", Number: parcel.Number, Type: ScanDelivery, Location: Location{Description: "door"},
+			ScannedAt: scannedAt.Add(time.Minute)},
+	}
+	*published = nil
+
+	// sync
+	results, err := service.SyncScans("courier-7", events)
+	require.NoError(t, err)
+
+	// check
+	require.Len(t, results, 3)
+	assert.Equal(t, SyncApplied, results[0].Status)
+	assert.Equal(t, SyncRejected, results[1].Status)
+	assert.ErrorIs(t, results[1].Err, ErrParcelNotFound)
+	assert.Equal(t, SyncApplied, results[2].Status)
+	assert.Equal(t, FormatTimestamp(scannedAt, DefaultTimestampPrecision), results[0].Scan.ScannedAt)
+	stored, err := service.Get(parcel.Number)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusDelivered, stored.Status)
+	assert.Len(t, *published, 2)
+
+	// retry
+	results, err = service.SyncScans("courier-7", events)
+	require.NoError(t, err)
+	assert.Equal(t, SyncDuplicate, results[0].Status)
+	assert.Equal(t, "courier-7", results[0].Scan.Device)
+	assert.Equal(t, "e1", results[0].Scan.EventID)
+	assert.Equal(t, SyncRejected, results[1].Status)
+	assert.Equal(t, SyncDuplicate, results[2].Status)
+	scans, err := service.Scans(parcel.Number)
+	require.NoError(t, err)
+	assert.Len(t, scans, 2)
+	assert.Len(t, *published, 2)
+
+	// the same event ids of another device are its own
+	results, err = service.SyncScans("courier-8", events[:1])
+	require.NoError(t, err)
+	assert.Equal(t, SyncApplied, results[0].Status, results[0].Err)
+}
+
+// TestSyncScansInvalid ensures that malformed batches are refused whole.
+func TestSyncScansInvalid(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	number := getSentParcel(t, service)
+	now := time.Now()
+	valid := OfflineScan{ID: "e1", Number: number, Type: ScanDelivery, ScannedAt: now}
+
+	// check
+	for name, batch := range map[string]struct {
+		device string
+		events []OfflineScan
+	}{
+		"no device":   {"", []OfflineScan{valid}},
+		"no id":       {"d", []OfflineScan{valid, {Number: number, Type: ScanInbound, ScannedAt: now}}},
+		"repeated id": {"d", []OfflineScan{valid, valid}},
+		"no time":     {"d", []OfflineScan{{ID: "e2", Number: number, Type: ScanInbound}}},
+		"too many":    {"d", make([]OfflineScan, MaxSyncBatch+1)},
+	} {
+		_, err := service.SyncScans(batch.device, batch.events)
+		assert.ErrorIs(t, err, ErrInvalidSync, name)
+	}
+	scans, err := service.Scans(number)
+	require.NoError(t, err)
+	assert.Empty(t, scans)
+}
+
+// TestHTTPSyncScans verifies the batch endpoint and its per-event results.
+func TestHTTPSyncScans(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service)
+	number := getSentParcel(t, service)
+	body := fmt.Sprintf(`{"device": "courier-7", "events": [
+{"id": "a", "parcel": %d, "type": "delivery", "description": "door", "scanned_at": "2024-05-01T10:00:00Z"},
+{"id": "b", "parcel": %d, "type": "teleport", "scanned_at": "2024-05-01T10:01:00Z"}]}`, number, number)
+
+	// check
+	rec := doRequest(t, h, http.MethodPost, "/scans/sync", body)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var results []syncResultJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&results))
+	require.Len(t, results, 2)
+	assert.Equal(t, SyncApplied, results[0].Status)
+	require.NotNil(t, results[0].Scan)
+	assert.Equal(t, "door", results[0].Scan.Description)
+	assert.Equal(t, SyncRejected, results[1].Status)
+	assert.Equal(t, CodeUnknownScanType, results[1].Code)
+	assert.Nil(t, results[1].Scan)
+
+	rec = doRequest(t, h, http.MethodPost, "/scans/sync", `{"events": []}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = doRequest(t, h, http.MethodGet, "/scans/sync", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// MaxCustomsReferenceLength is the maximum length of a customs
+// declaration reference.
+const MaxCustomsReferenceLength = 64
+
+var (
+	// ErrInvalidCustoms indicates customs fields that failed validation:
+	// a country that is not two letters, an international parcel without
+	// a country, an HS code that is not 6 to 10 digits, or a declaration
+	// on a domestic parcel.
+	ErrInvalidCustoms = newError(CodeInvalidCustoms, "invalid customs data")
+	// ErrCustomsDeclaration indicates an international parcel that cannot
+	// clear customs because it has no declaration reference, or whose
+	// declaration can no longer change.
+	ErrCustomsDeclaration = newError(CodeCustomsDeclaration, "customs declaration required")
+)
+
+// nextStatus returns the status that follows the current one of p, empty
+// for a delivered parcel. International parcels pass through
+// ParcelStatusCustomsCleared between sent and delivered.
+func nextStatus(p Parcel) string {
+	switch p.Status {
+	case ParcelStatusRegistered:
+		return ParcelStatusSent
+	case ParcelStatusSent:
+		if p.International {
+			return ParcelStatusCustomsCleared
+		}
+		return ParcelStatusDelivered
+	case ParcelStatusCustomsCleared:
+		return ParcelStatusDelivered
+	}
+	return ""
+}
+
+// readyForDelivery reports whether delivery is the next step of p: it is
+// sent and, if international, cleared through customs.
+func readyForDelivery(p Parcel) bool {
+	return p.Status != ParcelStatusRegistered && nextStatus(p) == ParcelStatusDelivered
+}
+
+// inTransit reports whether a parcel in status has left but not arrived.
+func inTransit(status string) bool {
+	return status == ParcelStatusSent || status == ParcelStatusCustomsCleared
+}
+
+// normaliseCountry returns country as an upper-case ISO 3166-1 alpha-2
+// code, or ErrInvalidCustoms (wrapped) unless it is two letters.
+func normaliseCountry(country string) (string, error) {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if country == "" {
+		return "", nil
+	}
+	if len(country) != 2 || country[0] < 'A' || country[0] > 'Z' || country[1] < 'A' || country[1] > 'Z' {
+		return "", fmt.Errorf("%w: country %q is not an ISO 3166-1 alpha-2 code", ErrInvalidCustoms, country)
+	}
+	return country, nil
+}
+
+// normaliseHSCodes returns the Harmonized System codes as digits only,
+// e.g. "8471.30" as "847130", or ErrInvalidCustoms (wrapped) for a code
+// that does not have 6 to 10 digits.
+func normaliseHSCodes(codes []string) ([]string, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	res := make([]string, 0, len(codes))
+	for _, code := range codes {
+		digits := strings.NewReplacer(".", "", " ", "").Replace(code)
+		valid := len(digits) >= 6 && len(digits) <= 10
+		for _, r := range digits {
+			valid = valid && r >= '0' && r <= '9'
+		}
+		if !valid {
+			return nil, fmt.Errorf("%w: HS code %q must have 6 to 10 digits", ErrInvalidCustoms, code)
+		}
+		res = append(res, digits)
+	}
+	return res, nil
+}
+
+// normaliseCustoms validates and normalises the customs fields of p.
+func normaliseCustoms(p Parcel) (Parcel, error) {
+	var err error
+	if p.Country, err = normaliseCountry(p.Country); err != nil {
+		return p, err
+	}
+	if p.HSCodes, err = normaliseHSCodes(p.HSCodes); err != nil {
+		return p, err
+	}
+	p.CustomsReference = strings.TrimSpace(p.CustomsReference)
+	switch {
+	case len(p.CustomsReference) > MaxCustomsReferenceLength:
+		return p, fmt.Errorf("%w: declaration reference is longer than %d characters", ErrInvalidCustoms,
+			MaxCustomsReferenceLength)
+	case p.International && p.Country == "":
+		return p, fmt.Errorf("%w: international parcels require a country", ErrInvalidCustoms)
+	case !p.International && (p.CustomsReference != "" || len(p.HSCodes) > 0):
+		return p, fmt.Errorf("%w: customs declarations apply to international parcels only", ErrInvalidCustoms)
+	}
+	return p, nil
+}
+
+// SetCustomsDeclaration sets the customs declaration reference and HS
+// codes of an international parcel that has not cleared customs yet.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns sql.ErrNoRows (wrapped) if no such parcel exists.
+//   - Returns ErrInvalidCustoms (wrapped) for a domestic parcel, an empty
+//     or too long reference, or an invalid HS code.
+//   - Returns ErrCustomsDeclaration (wrapped) once the parcel has cleared
+//     customs or been delivered.
+//   - Wraps and returns any SQL error from the UPDATE.
+func (s ParcelStore) SetCustomsDeclaration(number int, reference string, hsCodes []string) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	return s.InTx(func(tx ParcelStore) error {
+		p, err := tx.Get(number)
+		if err != nil {
+			return err
+		}
+		if p.Status != ParcelStatusRegistered && p.Status != ParcelStatusSent {
+			return fmt.Errorf("failed to set customs declaration of parcel %d: %w: parcel is %s", number,
+				ErrCustomsDeclaration, p.Status)
+		}
+		p.CustomsReference, p.HSCodes = reference, hsCodes
+		if p, err = normaliseCustoms(p); err != nil {
+			return fmt.Errorf("failed to set customs declaration of parcel %d: %w", number, err)
+		}
+		if p.CustomsReference == "" {
+			return fmt.Errorf("failed to set customs declaration of parcel %d: %w: empty reference", number,
+				ErrInvalidCustoms)
+		}
+
+		tx.invalidateParcel(number)
+		query := "UPDATE parcel SET customs_reference = :reference, hs_codes = :hs_codes WHERE number = :number"
+		_, err = tx.conn().Exec(query, sql.Named("reference", p.CustomsReference),
+			sql.Named("hs_codes", encodeList(p.HSCodes)), sql.Named("number", number))
+		if err != nil {
+			return fmt.Errorf("failed to set customs declaration of parcel %d: %w", number, err)
+		}
+		return nil
+	})
+}
+
+// SetCustomsDeclaration sets the customs declaration of an international
+// parcel; see ParcelStore.SetCustomsDeclaration.
+func (s ParcelService) SetCustomsDeclaration(number int, reference string, hsCodes []string) error {
+	return mapError(s.store.SetCustomsDeclaration(number, reference, hsCodes))
+}
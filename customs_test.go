@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getInternationalParcel registers a paid international parcel to
+// Kazakhstan without a customs declaration.
+func getInternationalParcel(t *testing.T, service ParcelService) Parcel {
+	t.Helper()
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", Payment: PaymentPaid,
+		International: true, Country: "kz"})
+	require.NoError(t, err)
+	return parcel
+}
+
+// TestAddCustoms verifies that customs fields are validated, normalised
+// and stored.
+func TestAddCustoms(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	// check
+	for _, change := range []func(p *Parcel){
+		func(p *Parcel) { p.Country = "" },
+		func(p *Parcel) { p.Country = "KAZ" },
+		func(p *Parcel) { p.HSCodes = []string{"8471"} },
+		func(p *Parcel) { p.HSCodes = []string{"8471.3x"} },
+		func(p *Parcel) { p.International, p.Country = false, "" },
+	} {
+		parcel := getTestParcel()
+		parcel.International, parcel.Country = true, "KZ"
+		parcel.CustomsReference, parcel.HSCodes = "CN23-1", []string{"847130"}
+		change(&parcel)
+		_, err := store.Add(parcel)
+		require.ErrorIs(t, err, ErrInvalidCustoms)
+	}
+
+	parcel := getTestParcel()
+	parcel.International, parcel.Country = true, " kz "
+	parcel.CustomsReference, parcel.HSCodes = " CN23-1 ", []string{"8471.30", "6109 10 00"}
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	assert.True(t, stored.International)
+	assert.Equal(t, "KZ", stored.Country)
+	assert.Equal(t, "CN23-1", stored.CustomsReference)
+	assert.Equal(t, []string{"847130", "61091000"}, stored.HSCodes)
+
+	id, err = store.Add(getTestParcel())
+	require.NoError(t, err)
+	stored, err = store.Get(id)
+	require.NoError(t, err)
+	assert.False(t, stored.International)
+	assert.Empty(t, stored.HSCodes)
+}
+
+// TestCustomsLifecycle verifies that international parcels clear customs
+// between sent and delivered, only once declared, while domestic parcels
+// skip customs.
+func TestCustomsLifecycle(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	parcel := getInternationalParcel(t, service)
+	number := parcel.Number
+	require.NoError(t, service.NextStatus(number))
+
+	// check
+	require.ErrorIs(t, service.NextStatus(number), ErrCustomsDeclaration)
+	require.ErrorIs(t, service.SetStatus(number, ParcelStatusDelivered), ErrStatusTransition)
+	require.ErrorIs(t, service.DeliverWithProof(number, Proof{Kind: ProofSignature, ContentType: "image/png",
+		Data: getTestSignature(t)}), ErrRequireSent)
+	_, err := service.RecordScan(number, ScanDelivery, Location{Description: "door"}, time.Time{})
+	require.ErrorIs(t, err, ErrRequireSent)
+
+	require.ErrorIs(t, service.SetCustomsDeclaration(number, " ", nil), ErrInvalidCustoms)
+	require.NoError(t, service.SetCustomsDeclaration(number, "CN23-1", []string{"847130"}))
+	require.NoError(t, service.NextStatus(number))
+	stored, err := service.Get(number)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusCustomsCleared, stored.Status)
+	assert.Equal(t, "CN23-1", stored.CustomsReference)
+	require.ErrorIs(t, service.SetCustomsDeclaration(number, "CN23-2", nil), ErrCustomsDeclaration)
+
+	require.NoError(t, service.SetStatus(number, ParcelStatusDelivered))
+	history, err := service.History(number)
+	require.NoError(t, err)
+	statuses := make([]string, 0, len(history))
+	for _, h := range history {
+		statuses = append(statuses, h.Status)
+	}
+	assert.Equal(t, []string{ParcelStatusRegistered, ParcelStatusSent, ParcelStatusCustomsCleared,
+		ParcelStatusDelivered}, statuses)
+
+	domestic := getSentParcel(t, service)
+	require.ErrorIs(t, service.SetCustomsDeclaration(domestic, "CN23-3", nil), ErrInvalidCustoms)
+	require.ErrorIs(t, service.SetStatus(domestic, ParcelStatusCustomsCleared), ErrStatusTransition)
+	require.NoError(t, service.NextStatus(domestic))
+	stored, err = service.Get(domestic)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusDelivered, stored.Status)
+}
+
+// TestCustomsHTTP verifies customs fields on registration and the
+// customs declaration endpoint.
+func TestCustomsHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service)
+
+	// check
+	body := `{"client": 1000, "address": "test", "international": true}`
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodPost, "/parcels", body).Code)
+	body = `{"client": 1000, "address": "test", "international": true, "country": "kz", "hs_codes": ["8471.30"]}`
+	rec := doRequest(t, h, http.MethodPost, "/parcels", body)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var parcel parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&parcel))
+	assert.True(t, parcel.International)
+	assert.Equal(t, "KZ", parcel.Country)
+	assert.Equal(t, []string{"847130"}, parcel.HSCodes)
+
+	path := fmt.Sprintf("/parcels/%d/customs", parcel.Number)
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodPut, path, `{"hs_codes": ["1"]}`).Code)
+	rec = doRequest(t, h, http.MethodPut, path, `{"reference": "CN23-1", "hs_codes": ["847130"]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&parcel))
+	assert.Equal(t, "CN23-1", parcel.CustomsReference)
+
+	require.NoError(t, service.SetPaymentStatus(parcel.Number, PaymentPaid))
+	next := fmt.Sprintf("/parcels/%d/next-status", parcel.Number)
+	require.Equal(t, http.StatusOK, doRequest(t, h, http.MethodPost, next, "").Code)
+	rec = doRequest(t, h, http.MethodPost, next, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&parcel))
+	assert.Equal(t, ParcelStatusCustomsCleared, parcel.Status)
+	assert.Equal(t, http.StatusConflict, doRequest(t, h, http.MethodPut, path, `{"reference": "CN23-2"}`).Code)
+
+	code, res := doGraphQL(t, h, `mutation {
+		register(client: 1000, address: "test", international: true, country: "de", customsReference: "CN23-3") {
+			international country customsReference
+		}
+	}`, nil)
+	require.Equal(t, http.StatusOK, code)
+	require.Nil(t, res["errors"])
+	assert.Equal(t, map[string]any{"international": true, "country": "DE", "customsReference": "CN23-3"},
+		res["data"].(map[string]any)["register"])
+}
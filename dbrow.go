@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Rows are scanned into structs whose fields name their columns with db
+// tags, the convention of sqlx, e.g.
+//
+//	type row struct {
+//		Number int    `db:"number"`
+//		Status string `db:"status"`
+//	}
+//
+//	query := "SELECT " + dbColumns(row{}) + " FROM parcel"
+//	err := scanRow(rows, &r)
+//
+// so the column list of a query and the destinations of its Scan are
+// written once, in the struct, and cannot drift apart as columns are
+// added. Fields without a db tag, or tagged "-", are not columns.
+//
+// Columns are matched by position, not by name: a query selecting other
+// columns than dbColumns fails to scan rather than filling the wrong
+// fields. Fields are passed to Scan as they are, so a column that may be
+// NULL needs a pointer or sql.Null* field; NULL in any other fails.
+
+// dbFields caches the indices of the db-tagged fields of each struct type.
+var dbFields sync.Map // reflect.Type -> []dbField
+
+// dbField is a db-tagged struct field.
+type dbField struct {
+	column string
+	index  int
+}
+
+// fieldsOf returns the db-tagged fields of the struct type t, in order.
+// It panics for other types and for a column tagged twice, which are
+// programming errors.
+func fieldsOf(t reflect.Type) []dbField {
+	if cached, ok := dbFields.Load(t); ok {
+		return cached.([]dbField)
+	}
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("db row %s is not a struct", t))
+	}
+	var fields []dbField
+	seen := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		column := t.Field(i).Tag.Get("db")
+		if column == "" || column == "-" {
+			continue
+		}
+		if seen[column] {
+			panic(fmt.Sprintf("db row %s has column %q twice", t, column))
+		}
+		seen[column] = true
+		fields = append(fields, dbField{column: column, index: i})
+	}
+	dbFields.Store(t, fields)
+	return fields
+}
+
+// dbColumns returns the columns of the struct row, comma-separated in
+// field order, for a SELECT scanned with scanRow.
+func dbColumns(row any) string {
+	fields := fieldsOf(reflect.TypeOf(row))
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = f.column
+	}
+	return strings.Join(columns, ", ")
+}
+
+// scanRow scans row, selected with dbColumns, into the struct dest
+// points to.
+func scanRow(row rowScanner, dest any) error {
+	v := reflect.ValueOf(dest).Elem()
+	fields := fieldsOf(v.Type())
+	ptrs := make([]any, len(fields))
+	for i, f := range fields {
+		ptrs[i] = v.Field(f.index).Addr().Interface()
+	}
+	return row.Scan(ptrs...)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestScanRow verifies that rows are scanned into the db-tagged fields in
+// order, skipping the rest.
+func TestScanRow(t *testing.T) {
+	type row struct {
+		Number  int    `db:"number"`
+		Skipped string `db:"-"`
+		Note    string
+		Status  string `db:"status"`
+	}
+
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	number, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// check
+	require.Equal(t, "number, status", dbColumns(row{}))
+	var r row
+	err = scanRow(db.QueryRow("SELECT "+dbColumns(row{})+" FROM parcel WHERE number = ?", number), &r)
+	require.NoError(t, err)
+	assert.Equal(t, row{Number: number, Status: ParcelStatusRegistered}, r)
+
+	type twice struct {
+		A int `db:"a"`
+		B int `db:"a"`
+	}
+	assert.Panics(t, func() { dbColumns(twice{}) })
+}
+
+// TestScanRowNulls verifies that NULL scans into pointer and sql.Null*
+// fields, and fails for other fields instead of leaving a zero value.
+func TestScanRowNulls(t *testing.T) {
+	type row struct {
+		Number  int            `db:"number"`
+		Note    *string        `db:"note"`
+		Comment sql.NullString `db:"comment"`
+	}
+	type strict struct {
+		Number int    `db:"number"`
+		Note   string `db:"note"`
+	}
+
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	query := "SELECT ? AS number, ? AS note, ? AS comment"
+
+	// check
+	var r row
+	require.NoError(t, scanRow(db.QueryRow(query, 1, nil, nil), &r))
+	assert.Equal(t, row{Number: 1}, r)
+
+	require.NoError(t, scanRow(db.QueryRow(query, 2, "fragile", "leave at door"), &r))
+	require.NotNil(t, r.Note)
+	assert.Equal(t, "fragile", *r.Note)
+	assert.Equal(t, sql.NullString{String: "leave at door", Valid: true}, r.Comment)
+
+	var s strict
+	assert.Error(t, scanRow(db.QueryRow("SELECT ? AS number, ? AS note", 3, nil), &s))
+}
+
+// TestScanRowWhenColumnsUnmapped ensures that a row whose columns do not
+// match the db-tagged fields fails to scan.
+func TestScanRowWhenColumnsUnmapped(t *testing.T) {
+	type row struct {
+		Number int    `db:"number"`
+		Status string `db:"status"`
+	}
+
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	number, err := NewParcelStore(db).Add(getTestParcel())
+	require.NoError(t, err)
+
+	// check
+	var r row
+	err = scanRow(db.QueryRow("SELECT number, status, address FROM parcel WHERE number = ?", number), &r)
+	assert.Error(t, err, "extra column")
+	err = scanRow(db.QueryRow("SELECT number FROM parcel WHERE number = ?", number), &r)
+	assert.Error(t, err, "missing column")
+}
+
+// TestParcelRowColumns verifies that parcelRow reads every column of the
+// "parcel" table but the creation sequence, so a column added by a
+// migration is not left out of Parcel unnoticed.
+func TestParcelRowColumns(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	rows, err := db.Query("SELECT name FROM pragma_table_info('parcel') WHERE name != 'seq'")
+	require.NoError(t, err)
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var name string
+		require.NoError(t, rows.Scan(&name))
+		columns = append(columns, name)
+	}
+	require.NoError(t, rows.Err())
+
+	// check
+	var scanned []string
+	for _, f := range fieldsOf(reflect.TypeOf(parcelRow{})) {
+		scanned = append(scanned, f.column)
+	}
+	assert.ElementsMatch(t, columns, scanned)
+}
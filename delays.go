@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// DetectDelays finds the parcels that are not delivered by their
+// estimated delivery time, moves their estimates on (see
+// ParcelStore.SlipETAs) and publishes EventParcelDelayed for each, which
+// a Notifier passes on to the client. A parcel that has now missed
+// EscalateAfter estimates (see WithETA) is escalated to the ops queue with
+// a WorkItemDelayed. It returns the delayed parcels with their new
+// estimates.
+func (s ParcelService) DetectDelays() ([]Parcel, error) {
+	now := time.Now()
+	at := s.timestamp(now)
+	var delayed []Parcel
+	var missed []string
+	err := s.store.InTx(func(tx ParcelStore) error {
+		late, err := tx.SlipETAs(now, s.eta.Slip)
+		if err != nil {
+			return err
+		}
+		for _, p := range late {
+			missed = append(missed, p.EstimatedDeliveryAt)
+			p.EstimatedDeliveryAt = FormatTimestamp(now.Add(s.eta.Slip), DefaultTimestampPrecision)
+			p.Delays++
+			delayed = append(delayed, p)
+
+			if s.eta.EscalateAfter > 0 && p.Delays == s.eta.EscalateAfter {
+				_, err := tx.AddWorkItem(WorkItem{Number: p.Number, Kind: WorkItemDelayed, CreatedAt: at,
+					Detail: fmt.Sprintf("missed %d delivery estimates, %s in status %s", p.Delays, p.ServiceClass, p.Status)})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	for i, p := range delayed {
+		s.events.Publish(Event{Type: EventParcelDelayed, Parcel: p, MissedETA: missed[i], At: at})
+	}
+	return delayed, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDetectDelays verifies that a late parcel is marked delayed, its
+// client notified every time and the parcel escalated once it missed
+// enough estimates.
+func TestDetectDelays(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	events := NewEventBus()
+	service := NewParcelService(store, events).WithETA(ETAPolicy{
+		Transit: map[string]time.Duration{ServiceStandard: 72 * time.Hour}, Slip: time.Hour, EscalateAfter: 2,
+	})
+	require.NoError(t, store.SetNotificationTemplate(NotificationTemplate{
+		Status: TemplateDelayed, Channel: ChannelEmail, Body: "Parcel {{.Parcel.TrackingCode}} is late, now expected {{.Parcel.EstimatedDeliveryAt}}.",
+	}))
+	require.NoError(t, store.SetNotificationPreference(NotificationPreference{Client: 1000, Channel: ChannelEmail,
+		Recipient: "a@example.com", Enabled: true}))
+	notifier := NewNotifier(store, nil, DefaultRetryPolicy())
+	defer notifier.Subscribe(events, func(err error) { t.Error(err) })()
+
+	parcel, err := service.Register(1000, "test")
+	require.NoError(t, err)
+	onTime, err := service.Register(1000, "test")
+	require.NoError(t, err)
+	past := FormatTimestamp(time.Now().Add(-time.Minute), DefaultTimestampPrecision)
+
+	// miss the estimate twice
+	for i := 1; i <= 2; i++ {
+		require.NoError(t, store.setETA(parcel.Number, past))
+		delayed, err := service.DetectDelays()
+		require.NoError(t, err)
+		require.Len(t, delayed, 1)
+		assert.Equal(t, i, delayed[0].Delays)
+	}
+
+	// check
+	stored, err := service.Get(parcel.Number)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stored.Delays)
+	assert.Greater(t, stored.EstimatedDeliveryAt, past)
+	view, err := store.GetTrackingView(parcel.TrackingCode)
+	require.NoError(t, err)
+	assert.True(t, view.Delayed)
+	stored, err = service.Get(onTime.Number)
+	require.NoError(t, err)
+	assert.Zero(t, stored.Delays)
+
+	queued, err := store.GetNotifications(parcel.Number)
+	require.NoError(t, err)
+	require.Len(t, queued, 2)
+	assert.Contains(t, queued[0].Body, parcel.TrackingCode+" is late")
+
+	items, err := store.ListWorkItems(WorkItemFilter{})
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, parcel.Number, items[0].Number)
+	assert.Equal(t, WorkItemDelayed, items[0].Kind)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Errors of delivery confirmation codes; see WithDeliveryCodes.
+var (
+	// ErrDeliveryCodeRequired indicates delivering a parcel whose delivery
+	// code was neither confirmed nor overridden.
+	ErrDeliveryCodeRequired = newError(CodeDeliveryCodeRequired, "delivery code not confirmed")
+	// ErrWrongDeliveryCode indicates a code other than the one issued.
+	ErrWrongDeliveryCode = newError(CodeWrongDeliveryCode, "wrong delivery code")
+	// ErrDeliveryCodeLocked indicates a code that can no longer be tried
+	// after too many wrong ones; only an override delivers the parcel.
+	ErrDeliveryCodeLocked = newError(CodeDeliveryCodeLocked, "delivery code locked")
+	// ErrNoDeliveryCode indicates a parcel that was not issued a code,
+	// e.g. one not sent yet.
+	ErrNoDeliveryCode = newError(CodeNoDeliveryCode, "no delivery code")
+)
+
+// DefaultDeliveryCodeAttempts is how many codes a courier may try per
+// parcel unless configured otherwise.
+const DefaultDeliveryCodeAttempts = 5
+
+// deliveryCodeDigits is the length of a delivery code.
+const deliveryCodeDigits = 6
+
+// DeliveryCodePolicy configures delivery confirmation codes. They are off
+// while MaxAttempts is zero.
+type DeliveryCodePolicy struct {
+	// MaxAttempts is how many wrong codes lock the code of a parcel.
+	MaxAttempts int
+}
+
+// deliveryCode is the stored state of the code of a parcel.
+type deliveryCode struct {
+	hash, salt  string
+	attempts    int
+	confirmedAt string
+	// overrideReason and overrideActor are set if it was overridden.
+	overrideReason, overrideActor string
+}
+
+// matches reports whether code is the one hashed, in constant time.
+func (c deliveryCode) matches(code string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashDeliveryCode(c.salt, code)), []byte(c.hash)) == 1
+}
+
+// hashDeliveryCode returns the hex SHA-256 of salt and code. Codes are
+// short, so the salt keeps equal codes of different parcels apart.
+func hashDeliveryCode(salt, code string) string {
+	sum := sha256.Sum256([]byte(salt + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// newDeliveryCode returns a random code of deliveryCodeDigits digits.
+func newDeliveryCode() (string, error) {
+	limit := big.NewInt(1)
+	for i := 0; i < deliveryCodeDigits; i++ {
+		limit.Mul(limit, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate delivery code: %w", err)
+	}
+	return fmt.Sprintf("%0*d", deliveryCodeDigits, n), nil
+}
+
+// issueDeliveryCode stores a new code for the parcel, replacing any
+// earlier one with its attempts, and returns it.
+func (s ParcelStore) issueDeliveryCode(number int, at string) (string, error) {
+	code, err := newDeliveryCode()
+	if err != nil {
+		return "", err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate delivery code: %w", err)
+	}
+	saltHex := hex.EncodeToString(salt)
+
+	query := `INSERT OR REPLACE INTO delivery_code (parcel_number, code_hash, salt, issued_at)
+VALUES (:number, :hash, :salt, :at)`
+	_, err = s.conn().Exec(query, sql.Named("number", number), sql.Named("hash", hashDeliveryCode(saltHex, code)),
+		sql.Named("salt", saltHex), sql.Named("at", at))
+	if err != nil {
+		return "", fmt.Errorf("failed to issue delivery code of parcel %d: %w", number, err)
+	}
+	return code, nil
+}
+
+// getDeliveryCode returns the code of the parcel.
+// Returns sql.ErrNoRows (wrapped) if it was not issued one.
+func (s ParcelStore) getDeliveryCode(number int) (deliveryCode, error) {
+	var c deliveryCode
+	query := `SELECT code_hash, salt, attempts, confirmed_at, override_reason, override_actor FROM delivery_code
+WHERE parcel_number = :number`
+	err := s.conn().QueryRow(query, sql.Named("number", number)).
+		Scan(&c.hash, &c.salt, &c.attempts, &c.confirmedAt, &c.overrideReason, &c.overrideActor)
+	if err != nil {
+		return c, fmt.Errorf("failed to get delivery code of parcel %d: %w", number, err)
+	}
+	return c, nil
+}
+
+// failDeliveryCode counts a wrong attempt at the code of the parcel.
+func (s ParcelStore) failDeliveryCode(number int) error {
+	query := "UPDATE delivery_code SET attempts = attempts + 1 WHERE parcel_number = :number"
+	if _, err := s.conn().Exec(query, sql.Named("number", number)); err != nil {
+		return fmt.Errorf("failed to count delivery code attempt of parcel %d: %w", number, err)
+	}
+	return nil
+}
+
+// confirmDeliveryCode marks the code of the parcel confirmed at the given
+// time, by an override with reason and actor if they are set.
+func (s ParcelStore) confirmDeliveryCode(number int, at, reason, actor string) error {
+	query := `UPDATE delivery_code SET confirmed_at = :at, override_reason = :reason, override_actor = :actor
+WHERE parcel_number = :number`
+	_, err := s.conn().Exec(query, sql.Named("at", at), sql.Named("reason", reason), sql.Named("actor", actor),
+		sql.Named("number", number))
+	if err != nil {
+		return fmt.Errorf("failed to confirm delivery code of parcel %d: %w", number, err)
+	}
+	return nil
+}
+
+// WithDeliveryCodes returns a copy of the service that issues a delivery
+// code when a parcel is sent and delivers it only once the code is
+// confirmed (see ConfirmDeliveryCode) or overridden (see
+// OverrideDeliveryCode). The code is published once, with the
+// EventStatusChanged to sent, for the recipient to be told; only its hash
+// is stored.
+//
+// Parcels sent before codes were turned on have none and are delivered as
+// before.
+func (s ParcelService) WithDeliveryCodes(policy DeliveryCodePolicy) ParcelService {
+	s.deliveryCodes = policy
+	return s
+}
+
+// requireDeliveryCode checks within tx that the parcel may be delivered:
+// its code, if it was issued one, is confirmed. It returns the note of an
+// override for the status history, empty if there was none.
+func (s ParcelService) requireDeliveryCode(tx ParcelStore, number int) (string, error) {
+	c, err := tx.getDeliveryCode(number)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if c.confirmedAt == "" {
+		return "", fmt.Errorf("failed to deliver parcel %d: %w", number, ErrDeliveryCodeRequired)
+	}
+	if c.overrideActor != "" {
+		return fmt.Sprintf("delivery code overridden by %s: %s", c.overrideActor, c.overrideReason), nil
+	}
+	return "", nil
+}
+
+// ConfirmDeliveryCode checks the code the recipient of a sent parcel gives
+// the courier. Once confirmed, the parcel is delivered as usual, e.g. with
+// NextStatus or DeliverWithProof.
+//
+// Behaviour:
+//   - Returns ErrRequireSent (wrapped) unless the parcel is ready for
+//     delivery, and ErrNoDeliveryCode (wrapped) if it has no code.
+//   - Returns ErrWrongDeliveryCode (wrapped) for another code and counts
+//     the attempt; once MaxAttempts wrong codes were tried, returns
+//     ErrDeliveryCodeLocked (wrapped) without checking the code.
+//   - Confirming a confirmed code again does nothing.
+func (s ParcelService) ConfirmDeliveryCode(number int, code string) error {
+	code = strings.TrimSpace(code)
+	var wrong bool
+	err := s.store.InTx(func(tx ParcelStore) error {
+		c, err := s.deliveryCodeOf(tx, number)
+		if err != nil || c.confirmedAt != "" {
+			return err
+		}
+		if s.deliveryCodes.MaxAttempts > 0 && c.attempts >= s.deliveryCodes.MaxAttempts {
+			return fmt.Errorf("failed to confirm delivery code of parcel %d: %w after %d attempts",
+				number, ErrDeliveryCodeLocked, c.attempts)
+		}
+		if !c.matches(code) {
+			wrong = true
+			return tx.failDeliveryCode(number)
+		}
+		return tx.confirmDeliveryCode(number, s.timestamp(time.Now()), "", "")
+	})
+	if err != nil {
+		return mapError(err)
+	}
+	if wrong {
+		return fmt.Errorf("failed to confirm delivery code of parcel %d: %w", number, ErrWrongDeliveryCode)
+	}
+	return nil
+}
+
+// OverrideDeliveryCode lets a sent parcel be delivered without its code,
+// e.g. when the recipient lost it and showed an ID instead, or the code
+// is locked. The reason and actor are kept with the code and noted in
+// the status history when the parcel is delivered.
+//
+// Behaviour:
+//   - Returns ErrInvalidOverride (wrapped) if reason or actor is blank.
+//   - Otherwise fails as ConfirmDeliveryCode, except that locked codes may
+//     be overridden.
+func (s ParcelService) OverrideDeliveryCode(number int, reason, actor string) error {
+	reason, actor = strings.TrimSpace(reason), strings.TrimSpace(actor)
+	if reason == "" {
+		return fmt.Errorf("failed to override delivery code of parcel %d: %w: a reason is required", number, ErrInvalidOverride)
+	}
+	if actor == "" {
+		return fmt.Errorf("failed to override delivery code of parcel %d: %w: an actor is required", number, ErrInvalidOverride)
+	}
+
+	err := s.store.InTx(func(tx ParcelStore) error {
+		c, err := s.deliveryCodeOf(tx, number)
+		if err != nil || c.confirmedAt != "" {
+			return err
+		}
+		return tx.confirmDeliveryCode(number, s.timestamp(time.Now()), reason, actor)
+	})
+	return mapError(err)
+}
+
+// deliveryCodeOf returns within tx the code of a parcel ready for
+// delivery.
+func (s ParcelService) deliveryCodeOf(tx ParcelStore, number int) (deliveryCode, error) {
+	parcel, err := tx.Get(number)
+	if err != nil {
+		return deliveryCode{}, err
+	}
+	if !readyForDelivery(parcel) {
+		return deliveryCode{}, fmt.Errorf("failed to confirm delivery of parcel %d: %w, actual status: %s",
+			number, ErrRequireSent, parcel.Status)
+	}
+	c, err := tx.getDeliveryCode(number)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c, fmt.Errorf("failed to confirm delivery of parcel %d: %w", number, ErrNoDeliveryCode)
+	}
+	return c, err
+}
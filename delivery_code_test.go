@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getCodedParcel registers and sends a paid parcel with delivery codes on
+// and returns its number and code.
+func getCodedParcel(t *testing.T, service ParcelService, published *[]Event) (int, string) {
+	t.Helper()
+	number := getSentParcel(t, service)
+	require.NotEmpty(t, *published)
+	sent := (*published)[len(*published)-1]
+	require.Equal(t, ParcelStatusSent, sent.Parcel.Status)
+	require.Len(t, sent.DeliveryCode, deliveryCodeDigits)
+	return number, sent.DeliveryCode
+}
+
+// TestDeliveryCode verifies that a parcel is delivered only after its
+// code is confirmed, and that the code is stored hashed.
+func TestDeliveryCode(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	service = service.WithDeliveryCodes(DeliveryCodePolicy{MaxAttempts: 3})
+	number, code := getCodedParcel(t, service, published)
+
+	// check
+	var stored string
+	err := service.store.db.QueryRow("SELECT code_hash FROM delivery_code WHERE parcel_number = ?", number).Scan(&stored)
+	require.NoError(t, err)
+	assert.NotContains(t, stored, code)
+
+	err = service.NextStatus(number)
+	require.ErrorIs(t, err, ErrDeliveryCodeRequired)
+	_, err = service.RecordScan(number, ScanDelivery, Location{Description: "door"}, time.Time{})
+	require.ErrorIs(t, err, ErrDeliveryCodeRequired)
+
+	wrong := fmt.Sprintf("%06d", 0)
+	if wrong == code {
+		wrong = "000001"
+	}
+	require.ErrorIs(t, service.ConfirmDeliveryCode(number, wrong), ErrWrongDeliveryCode)
+	require.NoError(t, service.ConfirmDeliveryCode(number, " "+code+" "))
+	require.NoError(t, service.NextStatus(number))
+	parcel, err := service.Get(number)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusDelivered, parcel.Status)
+	assert.Empty(t, (*published)[len(*published)-1].DeliveryCode)
+
+	// without codes, or before the parcel is sent
+	plain, _ := getTestService(t)
+	number = getSentParcel(t, plain)
+	assert.ErrorIs(t, plain.ConfirmDeliveryCode(number, code), ErrNoDeliveryCode)
+	assert.NoError(t, plain.NextStatus(number))
+	registered, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test"})
+	require.NoError(t, err)
+	assert.ErrorIs(t, service.ConfirmDeliveryCode(registered.Number, code), ErrRequireSent)
+}
+
+// TestDeliveryCodeLocked verifies that too many wrong codes lock the code
+// and that an override with a reason still lets the parcel be delivered.
+func TestDeliveryCodeLocked(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	service = service.WithDeliveryCodes(DeliveryCodePolicy{MaxAttempts: 2})
+	number, code := getCodedParcel(t, service, published)
+	wrong := "x" + code
+
+	// check
+	assert.ErrorIs(t, service.ConfirmDeliveryCode(number, wrong), ErrWrongDeliveryCode)
+	assert.ErrorIs(t, service.ConfirmDeliveryCode(number, wrong), ErrWrongDeliveryCode)
+	assert.ErrorIs(t, service.ConfirmDeliveryCode(number, code), ErrDeliveryCodeLocked)
+
+	assert.ErrorIs(t, service.OverrideDeliveryCode(number, " ", "anna"), ErrInvalidOverride)
+	require.NoError(t, service.OverrideDeliveryCode(number, "recipient showed a passport", "anna"))
+	require.NoError(t, service.NextStatus(number))
+	history, err := service.History(number)
+	require.NoError(t, err)
+	last := history[len(history)-1]
+	assert.Equal(t, ParcelStatusDelivered, last.Status)
+	assert.Equal(t, "delivery code overridden by anna: recipient showed a passport", last.Note)
+}
+
+// TestHTTPDeliveryCode verifies the delivery code endpoints as a courier,
+// who may confirm codes but not override them.
+func TestHTTPDeliveryCode(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	service = service.WithDeliveryCodes(DeliveryCodePolicy{MaxAttempts: 3})
+	asCourier := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), Principal{Role: RoleCourier})))
+		})
+	}
+	h := NewHTTPHandler(service, asCourier)
+	number, code := getCodedParcel(t, service, published)
+	target := fmt.Sprintf("/parcels/%d/delivery-code", number)
+
+	// check
+	rec := doRequest(t, h, http.MethodPost, fmt.Sprintf("/parcels/%d/next-status", number), "")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	rec = doRequest(t, h, http.MethodPost, target, `{"code": "x"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	rec = doRequest(t, h, http.MethodPost, target, `{"code": "`+code+`"}`)
+	assert.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	rec = doRequest(t, h, http.MethodPost, target+"/override", `{"reason": "lost"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = doRequest(t, h, http.MethodPost, fmt.Sprintf("/parcels/%d/next-status", number), "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxRescheduleDays is how many days ahead a delivery may be scheduled.
+const MaxRescheduleDays = 14
+
+var (
+	// ErrInvalidDeliveryWindow indicates a delivery window on a day that
+	// is not a date, not in the next MaxRescheduleDays days, or at times
+	// other than those of a DeliverySlot.
+	ErrInvalidDeliveryWindow = newError(CodeInvalidDeliveryWindow, "invalid delivery window")
+	// ErrDeliverySlotFull indicates a delivery window whose slot already
+	// holds as many parcels as couriers can deliver in it.
+	ErrDeliverySlotFull = newError(CodeDeliverySlotFull, "delivery slot full")
+)
+
+// DeliveryWindow is when the recipient prefers a parcel to be delivered:
+// on Day (YYYY-MM-DD) between From and To (HH:MM, local time).
+type DeliveryWindow struct {
+	Day  string
+	From string
+	To   string
+}
+
+// IsZero reports whether no window is set.
+func (w DeliveryWindow) IsZero() bool {
+	return w == DeliveryWindow{}
+}
+
+// DeliverySlot is a time of day deliveries can be scheduled in, e.g.
+// 09:00 to 13:00, and how many parcels couriers can deliver in it a day.
+type DeliverySlot struct {
+	From     string
+	To       string
+	Capacity int
+}
+
+// DefaultDeliverySlots are the slots of a service without
+// WithDeliverySlots: morning, afternoon and evening, 50 parcels each.
+func DefaultDeliverySlots() []DeliverySlot {
+	return []DeliverySlot{
+		{From: "09:00", To: "13:00", Capacity: 50},
+		{From: "13:00", To: "18:00", Capacity: 50},
+		{From: "18:00", To: "21:00", Capacity: 50},
+	}
+}
+
+// SlotAvailability is a DeliverySlot on a day with the room left in it.
+type SlotAvailability struct {
+	DeliverySlot
+	Day       string
+	Remaining int
+}
+
+// countDeliveryWindow returns how many parcels in transit other than
+// except are scheduled for delivery in window w.
+func (s ParcelStore) countDeliveryWindow(w DeliveryWindow, except int) (int, error) {
+	var n int
+	query := `SELECT COUNT(*) FROM parcel WHERE delivery_day = :day AND delivery_from = :from AND delivery_to = :to
+    AND status IN (:sent, :cleared) AND number != :except`
+	err := s.conn().QueryRow(query, sql.Named("day", w.Day), sql.Named("from", w.From), sql.Named("to", w.To),
+		sql.Named("sent", ParcelStatusSent), sql.Named("cleared", ParcelStatusCustomsCleared),
+		sql.Named("except", except)).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count parcels to deliver on %s from %s: %w", w.Day, w.From, err)
+	}
+	return n, nil
+}
+
+// SetDeliveryWindow sets the preferred delivery window of a parcel in
+// transit, or clears it if w is zero, provided the window holds fewer
+// than capacity other parcels.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns sql.ErrNoRows (wrapped) if no such parcel exists.
+//   - Returns ErrRequireSent (wrapped) unless the parcel is sent or
+//     cleared through customs.
+//   - Returns ErrParcelOnRoute (wrapped) if the parcel is a stop of a
+//     route on another day than w.Day; it must be taken off first.
+//   - Returns ErrDeliverySlotFull (wrapped) if the window is full.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) SetDeliveryWindow(number int, w DeliveryWindow, capacity int) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	return s.InTx(func(tx ParcelStore) error {
+		p, err := tx.Get(number)
+		if err != nil {
+			return err
+		}
+		if !inTransit(p.Status) {
+			return fmt.Errorf("failed to set delivery window of parcel %d: %w, actual status: %s", number,
+				ErrRequireSent, p.Status)
+		}
+
+		var day string
+		query := `SELECT r.day FROM route_stop s JOIN route r ON r.id = s.route_id
+WHERE s.parcel_number = :number AND s.completed_at = ''`
+		err = tx.conn().QueryRow(query, sql.Named("number", number)).Scan(&day)
+		switch {
+		case err == nil && !w.IsZero() && day != w.Day:
+			return fmt.Errorf("failed to set delivery window of parcel %d: %w on %s", number, ErrParcelOnRoute, day)
+		case err != nil && !errors.Is(err, sql.ErrNoRows):
+			return fmt.Errorf("failed to look up route of parcel %d: %w", number, err)
+		}
+
+		if !w.IsZero() && w != p.DeliveryWindow {
+			n, err := tx.countDeliveryWindow(w, number)
+			if err != nil {
+				return err
+			}
+			if n >= capacity {
+				return fmt.Errorf("failed to set delivery window of parcel %d: %w: %s %s-%s", number,
+					ErrDeliverySlotFull, w.Day, w.From, w.To)
+			}
+		}
+
+		tx.invalidateParcel(number)
+		query = "UPDATE parcel SET delivery_day = :day, delivery_from = :from, delivery_to = :to WHERE number = :number"
+		_, err = tx.conn().Exec(query, sql.Named("day", w.Day), sql.Named("from", w.From), sql.Named("to", w.To),
+			sql.Named("number", number))
+		if err != nil {
+			return fmt.Errorf("failed to set delivery window of parcel %d: %w", number, err)
+		}
+		return nil
+	})
+}
+
+// WithDeliverySlots returns a copy of the service that schedules
+// deliveries in slots instead of DefaultDeliverySlots.
+func (s ParcelService) WithDeliverySlots(slots []DeliverySlot) ParcelService {
+	s.slots = slots
+	return s
+}
+
+// deliverySlots returns the slots deliveries are scheduled in.
+func (s ParcelService) deliverySlots() []DeliverySlot {
+	if s.slots == nil {
+		return DefaultDeliverySlots()
+	}
+	return s.slots
+}
+
+// deliverySlot returns the slot of window w, checking that its day is
+// one of the next MaxRescheduleDays days after now.
+func (s ParcelService) deliverySlot(w DeliveryWindow, now time.Time) (DeliverySlot, error) {
+	day, err := time.ParseInLocation(routeDayLayout, w.Day, now.Location())
+	if err != nil {
+		return DeliverySlot{}, fmt.Errorf("%w: day %q is not YYYY-MM-DD", ErrInvalidDeliveryWindow, w.Day)
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if !day.After(today) || day.After(today.AddDate(0, 0, MaxRescheduleDays)) {
+		return DeliverySlot{}, fmt.Errorf("%w: %s is not within the next %d days", ErrInvalidDeliveryWindow,
+			w.Day, MaxRescheduleDays)
+	}
+	for _, slot := range s.deliverySlots() {
+		if slot.From == w.From && slot.To == w.To {
+			return slot, nil
+		}
+	}
+	return DeliverySlot{}, fmt.Errorf("%w: no delivery slot from %s to %s", ErrInvalidDeliveryWindow, w.From, w.To)
+}
+
+// Reschedule sets the window a parcel in transit is to be delivered in,
+// which must be one of the delivery slots on a day from tomorrow to
+// MaxRescheduleDays ahead, or clears it if w is zero. Routes of w.Day
+// accept the parcel, routes of other days refuse it (see AddRouteStop).
+//
+// Behaviour:
+//   - Returns ErrInvalidDeliveryWindow (wrapped) for another window.
+//   - Returns ErrDeliverySlotFull (wrapped) once the slot holds its
+//     Capacity of parcels that day.
+//   - Otherwise fails as ParcelStore.SetDeliveryWindow.
+func (s ParcelService) Reschedule(number int, w DeliveryWindow) error {
+	w = DeliveryWindow{Day: strings.TrimSpace(w.Day), From: strings.TrimSpace(w.From), To: strings.TrimSpace(w.To)}
+	if w.IsZero() {
+		return mapError(s.store.SetDeliveryWindow(number, w, 0))
+	}
+	slot, err := s.deliverySlot(w, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to reschedule parcel %d: %w", number, err)
+	}
+	return mapError(s.store.SetDeliveryWindow(number, w, slot.Capacity))
+}
+
+// DeliverySlots returns the delivery slots on day with the room left in
+// each.
+//
+// Behaviour:
+//   - Returns ErrInvalidDeliveryWindow (wrapped) unless day is one a
+//     parcel can be rescheduled to.
+func (s ParcelService) DeliverySlots(day string) ([]SlotAvailability, error) {
+	now := time.Now()
+	var res []SlotAvailability
+	for _, slot := range s.deliverySlots() {
+		w := DeliveryWindow{Day: day, From: slot.From, To: slot.To}
+		if _, err := s.deliverySlot(w, now); err != nil {
+			return nil, fmt.Errorf("failed to get delivery slots: %w", err)
+		}
+		n, err := s.store.countDeliveryWindow(w, 0)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		res = append(res, SlotAvailability{DeliverySlot: slot, Day: day, Remaining: max(slot.Capacity-n, 0)})
+	}
+	return res, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dayAhead returns the day n days from today as YYYY-MM-DD.
+func dayAhead(n int) string {
+	return time.Now().AddDate(0, 0, n).Format(routeDayLayout)
+}
+
+// TestReschedule verifies the validation of delivery windows and the
+// capacity of a slot.
+func TestReschedule(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	service = service.WithDeliverySlots([]DeliverySlot{{From: "09:00", To: "13:00", Capacity: 1}})
+	first, second := getSentParcel(t, service), getSentParcel(t, service)
+	registered, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test"})
+	require.NoError(t, err)
+	w := DeliveryWindow{Day: dayAhead(2), From: "09:00", To: "13:00"}
+
+	// check
+	for name, invalid := range map[string]DeliveryWindow{
+		"not a date":   {Day: "tomorrow", From: "09:00", To: "13:00"},
+		"today":        {Day: dayAhead(0), From: "09:00", To: "13:00"},
+		"too far":      {Day: dayAhead(MaxRescheduleDays + 1), From: "09:00", To: "13:00"},
+		"not a slot":   {Day: w.Day, From: "10:00", To: "12:00"},
+		"no slot time": {Day: w.Day},
+	} {
+		assert.ErrorIs(t, service.Reschedule(first, invalid), ErrInvalidDeliveryWindow, name)
+	}
+	assert.ErrorIs(t, service.Reschedule(registered.Number, w), ErrRequireSent)
+
+	require.NoError(t, service.Reschedule(first, w))
+	require.NoError(t, service.Reschedule(first, w))
+	assert.ErrorIs(t, service.Reschedule(second, w), ErrDeliverySlotFull)
+	slots, err := service.DeliverySlots(w.Day)
+	require.NoError(t, err)
+	require.Len(t, slots, 1)
+	assert.Equal(t, 0, slots[0].Remaining)
+
+	parcel, err := service.Get(first)
+	require.NoError(t, err)
+	assert.Equal(t, w, parcel.DeliveryWindow)
+
+	// clearing the window frees the slot
+	require.NoError(t, service.Reschedule(first, DeliveryWindow{}))
+	require.NoError(t, service.Reschedule(second, w))
+	parcel, err = service.Get(first)
+	require.NoError(t, err)
+	assert.True(t, parcel.DeliveryWindow.IsZero())
+}
+
+// TestRescheduleRoutes verifies that route planning respects the day the
+// recipient chose, and that routes show the window of each stop.
+func TestRescheduleRoutes(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	number := getSentParcel(t, service)
+	w := DeliveryWindow{Day: dayAhead(1), From: "13:00", To: "18:00"}
+	require.NoError(t, service.Reschedule(number, w))
+	other, err := service.store.CreateRoute("courier-1", dayAhead(2))
+	require.NoError(t, err)
+	route, err := service.store.CreateRoute("courier-1", w.Day)
+	require.NoError(t, err)
+
+	// check
+	require.ErrorIs(t, service.store.AddRouteStop(other.ID, number), ErrInvalidRoute)
+	require.NoError(t, service.store.AddRouteStop(route.ID, number))
+	stored, err := service.store.GetRoute(route.ID)
+	require.NoError(t, err)
+	require.Len(t, stored.Stops, 1)
+	assert.Equal(t, "13:00", stored.Stops[0].WindowFrom)
+	assert.Equal(t, "18:00", stored.Stops[0].WindowTo)
+
+	// a parcel on a route cannot move to another day
+	assert.ErrorIs(t, service.Reschedule(number, DeliveryWindow{Day: dayAhead(2), From: "13:00", To: "18:00"}),
+		ErrParcelOnRoute)
+	assert.NoError(t, service.Reschedule(number, DeliveryWindow{Day: w.Day, From: "09:00", To: "13:00"}))
+}
+
+// TestHTTPReschedule verifies the reschedule and slot endpoints and the
+// window on the tracking page.
+func TestHTTPReschedule(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service)
+	number := getSentParcel(t, service)
+	parcel, err := service.Get(number)
+	require.NoError(t, err)
+	day := dayAhead(3)
+	target := fmt.Sprintf("/parcels/%d/delivery-window", number)
+
+	// check
+	rec := doRequest(t, h, http.MethodPut, target, `{"day": "`+day+`", "from": "18:00", "to": "21:00"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var res parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	assert.Equal(t, &deliveryWindowJSON{Day: day, From: "18:00", To: "21:00"}, res.DeliveryWindow)
+
+	rec = doRequest(t, h, http.MethodPut, target, `{"day": "`+day+`", "from": "18:00", "to": "22:00"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(t, h, http.MethodGet, "/delivery-slots?day="+day, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var slots []deliverySlotJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&slots))
+	require.Len(t, slots, len(DefaultDeliverySlots()))
+	assert.Equal(t, slots[2].Capacity-1, slots[2].Remaining)
+	rec = doRequest(t, h, http.MethodGet, "/delivery-slots", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(t, h, http.MethodGet, "/track/"+parcel.TrackingCode, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var tracking trackingJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&tracking))
+	assert.Equal(t, &deliveryWindowJSON{Day: day, From: "18:00", To: "21:00"}, tracking.DeliveryWindow)
+}
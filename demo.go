@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// demoParcels are registered by seedDemo: a client, an address and how
+// many times the parcel is advanced along its lifecycle.
+var demoParcels = []struct {
+	client  int
+	address string
+	steps   int
+}{
+	{1, "Псков, ул. Пушкина, д. 5", 0},
+	{1, "Саратов, ул. Козлова, д. 25", 1},
+	{1, "Казань, ул. Баумана, д. 12", 2},
+	{2, "Berlin, Friedrichstraße 43", 0},
+	{2, "Hamburg, Mönckebergstraße 7", 2},
+	{3, "London, 221B Baker Street", 1},
+	{3, "Manchester, 12 Deansgate", 2},
+}
+
+// openDemoStore opens the demo database db describes, creating the schema on
+// a fresh file, and seeds it with demoParcels if it holds no parcels.
+// Registered tracking codes are reported to out.
+func openDemoStore(db DatabaseConfig, out io.Writer) (ParcelStore, error) {
+	store, err := db.Open()
+	if err != nil {
+		return ParcelStore{}, err
+	}
+
+	var count int
+	if err := store.db.QueryRow("SELECT COUNT(*) FROM parcel").Scan(&count); err != nil {
+		store.Close()
+		return ParcelStore{}, fmt.Errorf("failed to count demo parcels: %w", err)
+	}
+	if count > 0 {
+		return store, nil
+	}
+
+	if err := seedDemo(NewParcelService(store, nil), out); err != nil {
+		store.Close()
+		return ParcelStore{}, err
+	}
+	return store, nil
+}
+
+// seedDemo registers demoParcels through the service so that every parcel
+// gets a tracking code and a status history.
+func seedDemo(service ParcelService, out io.Writer) error {
+	fmt.Fprintln(out, "Demo parcels:")
+	for _, d := range demoParcels {
+		parcel, err := service.Register(d.client, d.address)
+		if err != nil {
+			return fmt.Errorf("failed to seed demo parcel: %w", err)
+		}
+		if d.steps > 0 {
+			if err := service.SetPaymentStatus(parcel.Number, PaymentPaid); err != nil {
+				return fmt.Errorf("failed to seed demo parcel: %w", err)
+			}
+		}
+		for i := 0; i < d.steps; i++ {
+			if err := service.NextStatus(parcel.Number); err != nil {
+				return fmt.Errorf("failed to seed demo parcel: %w", err)
+			}
+		}
+		fmt.Fprintf(out, "  %s  client %d  %s\n", parcel.TrackingCode, d.client, d.address)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Kinds of anomalies found by Doctor.
+const (
+	// AnomalyUnknownStatus is a parcel in a status that is not a known
+	// one; see RepairStatuses.
+	AnomalyUnknownStatus = "unknown_status"
+	// AnomalyOrphanedRow is a history, scan, comment or other row of a
+	// parcel that exists neither in the parcel table nor in the archive.
+	AnomalyOrphanedRow = "orphaned_row"
+	// AnomalyBrokenReference is a route stop or order item whose route,
+	// order or parcel does not exist, written while foreign keys were off.
+	AnomalyBrokenReference = "broken_reference"
+	// AnomalyEmptyAddress is a parcel without an address that has not
+	// been anonymised.
+	AnomalyEmptyAddress = "empty_address"
+	// AnomalyMissingDeliveryTime is a delivered parcel without a
+	// "delivered" entry in its status history, so its delivery time, and
+	// when it is archived, are unknown.
+	AnomalyMissingDeliveryTime = "missing_delivery_time"
+)
+
+// Anomaly is an inconsistency in the data found by Doctor.
+type Anomaly struct {
+	Kind  string
+	Table string
+	// Number is the parcel concerned, 0 if none.
+	Number int
+	Detail string
+	// Fixable anomalies are fixed by Doctor when asked to; the others need
+	// a person to decide.
+	Fixable bool
+	Fixed   bool
+}
+
+// Doctor scans the data for anomalies and returns them, by kind. With
+// fix, it also fixes those that are safe to fix: it deletes orphaned rows
+// and rows with broken references, which nothing can reach any more.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if nothing is wrong.
+//   - Scans, and fixes, in one transaction.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) Doctor(fix bool) ([]Anomaly, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	res := []Anomaly{}
+	err := s.InTx(func(tx ParcelStore) error {
+		checks := []func(fix bool) ([]Anomaly, error){
+			tx.doctorStatuses, tx.doctorOrphans, tx.doctorReferences, tx.doctorAddresses, tx.doctorDeliveries,
+		}
+		for _, check := range checks {
+			found, err := check(fix)
+			if err != nil {
+				return err
+			}
+			res = append(res, found...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s ParcelStore) doctorStatuses(bool) ([]Anomaly, error) {
+	bad, err := s.ListBadStatuses()
+	if err != nil {
+		return nil, err
+	}
+	var res []Anomaly
+	for _, b := range bad {
+		res = append(res, Anomaly{Kind: AnomalyUnknownStatus, Table: "parcel", Number: b.Number,
+			Detail: fmt.Sprintf("status %q", b.Status)})
+	}
+	return res, nil
+}
+
+// doctorOrphans finds the rows of erasedParcelTables of parcels that are
+// gone; route stops and order items are left to doctorReferences.
+func (s ParcelStore) doctorOrphans(fix bool) ([]Anomaly, error) {
+	const orphaned = "parcel_number NOT IN (SELECT number FROM parcel) AND parcel_number NOT IN (SELECT number FROM parcel_archive)"
+
+	var res []Anomaly
+	for _, table := range erasedParcelTables {
+		if table == "route_stop" || table == "parcel_order_item" {
+			continue
+		}
+		query, args := selectFrom(table, "parcel_number, COUNT(*)").Where(orphaned).
+			GroupBy("parcel_number").OrderBy("parcel_number").build()
+		rows, err := s.conn().Query(query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cursor for orphaned rows of %s: %w", table, err)
+		}
+		var found []Anomaly
+		for rows.Next() {
+			var number, n int
+			if err := rows.Scan(&number, &n); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan one of orphaned rows of %s: %w", table, err)
+			}
+			found = append(found, Anomaly{Kind: AnomalyOrphanedRow, Table: table, Number: number,
+				Detail: fmt.Sprintf("%d rows of a parcel that does not exist", n), Fixable: true})
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate orphaned rows of %s: %w", table, err)
+		}
+
+		if fix && len(found) > 0 {
+			if _, err := s.conn().Exec("DELETE FROM " + table + " WHERE " + orphaned); err != nil {
+				return nil, fmt.Errorf("failed to delete orphaned rows of %s: %w", table, err)
+			}
+			for i := range found {
+				found[i].Fixed = true
+			}
+		}
+		res = append(res, found...)
+	}
+	return res, nil
+}
+
+// doctorReferences finds the rows foreign keys would refuse; see
+// migration 46.
+func (s ParcelStore) doctorReferences(fix bool) ([]Anomaly, error) {
+	type broken struct {
+		table, parent string
+		rowid         int64
+	}
+	rows, err := s.conn().Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return nil, fmt.Errorf("failed to check foreign keys: %w", err)
+	}
+	var found []broken
+	for rows.Next() {
+		var b broken
+		var fkid int
+		if err := rows.Scan(&b.table, &b.rowid, &b.parent, &fkid); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan one of foreign key failures: %w", err)
+		}
+		found = append(found, b)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate foreign key failures: %w", err)
+	}
+
+	var res []Anomaly
+	seen := make(map[broken]bool)
+	for _, b := range found {
+		// a row may refer to several missing records
+		key := broken{table: b.table, rowid: b.rowid}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		a := Anomaly{Kind: AnomalyBrokenReference, Table: b.table, Fixable: true,
+			Detail: fmt.Sprintf("row %d refers to a missing %s", b.rowid, b.parent)}
+		err := s.conn().QueryRow("SELECT parcel_number FROM "+b.table+" WHERE rowid = :rowid",
+			sql.Named("rowid", b.rowid)).Scan(&a.Number)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read row %d of %s: %w", b.rowid, b.table, err)
+		}
+		if fix {
+			if _, err := s.conn().Exec("DELETE FROM "+b.table+" WHERE rowid = :rowid", sql.Named("rowid", b.rowid)); err != nil {
+				return nil, fmt.Errorf("failed to delete row %d of %s: %w", b.rowid, b.table, err)
+			}
+			a.Fixed = true
+		}
+		res = append(res, a)
+	}
+	return res, nil
+}
+
+func (s ParcelStore) doctorAddresses(bool) ([]Anomaly, error) {
+	// anonymised parcels (see EraseClient) have neither client nor address
+	query, args := selectFrom("parcel", "number").Where("TRIM(address) = ''").Where("client != 0").
+		Where("pickup_point = 0").OrderBy("number").build()
+	return s.doctorParcels(AnomalyEmptyAddress, "no delivery address", query, args...)
+}
+
+func (s ParcelStore) doctorDeliveries(bool) ([]Anomaly, error) {
+	query, args := selectFrom("parcel", "number").Where("status = ?", ParcelStatusDelivered).
+		Where("NOT EXISTS (SELECT 1 FROM parcel_status_history h WHERE h.parcel_number = parcel.number AND h.status = ?)",
+			ParcelStatusDelivered).
+		OrderBy("number").build()
+	return s.doctorParcels(AnomalyMissingDeliveryTime, "delivered, but not in the status history", query, args...)
+}
+
+// doctorParcels returns an anomaly of kind for each parcel number query
+// selects.
+func (s ParcelStore) doctorParcels(kind, detail, query string, args ...any) ([]Anomaly, error) {
+	rows, err := s.conn().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for %s: %w", strings.ReplaceAll(kind, "_", " "), err)
+	}
+	defer rows.Close()
+
+	var res []Anomaly
+	for rows.Next() {
+		a := Anomaly{Kind: kind, Table: "parcel", Detail: detail}
+		if err := rows.Scan(&a.Number); err != nil {
+			return nil, fmt.Errorf("failed to scan one of parcels with %s: %w", strings.ReplaceAll(kind, "_", " "), err)
+		}
+		res = append(res, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate parcels with %s: %w", strings.ReplaceAll(kind, "_", " "), err)
+	}
+	return res, nil
+}
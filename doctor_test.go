@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDoctor verifies that Doctor finds each kind of anomaly, leaves the
+// rows of archived parcels alone and fixes only what is safe to fix.
+func TestDoctor(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	add := func() int {
+		number, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		return number
+	}
+	exec := func(query string, args ...any) {
+		_, err := db.Exec(query, args...)
+		require.NoError(t, err)
+	}
+
+	archived := add()
+	require.NoError(t, store.SetStatus(archived, ParcelStatusSent))
+	require.NoError(t, store.SetStatus(archived, ParcelStatusDelivered))
+	require.NoError(t, store.AddHistory(StatusChange{Number: archived, Status: ParcelStatusDelivered,
+		ChangedAt: "2020-01-01T00:00:00Z"}))
+	n, err := store.archive(time.Now(), 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	exec("DROP TRIGGER parcel_status_check_update")
+	unknown := add()
+	exec("UPDATE parcel SET status = ? WHERE number = ?", "lost", unknown)
+	undated := add()
+	exec("UPDATE parcel SET status = ? WHERE number = ?", ParcelStatusDelivered, undated)
+	addressless := add()
+	exec("UPDATE parcel SET address = substr(address, 1, 0) WHERE number = ?", addressless)
+	require.NoError(t, store.AddHistory(StatusChange{Number: 999, Status: ParcelStatusSent, ChangedAt: "2024-01-01T00:00:00Z"}))
+	exec("INSERT INTO parcel_order_item (order_id, parcel_number) VALUES (?, ?)", 42, undated)
+
+	// check
+	kinds := func(anomalies []Anomaly) map[string]int {
+		res := make(map[string]int)
+		for _, a := range anomalies {
+			res[a.Kind] = a.Number
+		}
+		return res
+	}
+	anomalies, err := store.Doctor(false)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{
+		AnomalyUnknownStatus:       unknown,
+		AnomalyOrphanedRow:         999,
+		AnomalyBrokenReference:     undated,
+		AnomalyEmptyAddress:        addressless,
+		AnomalyMissingDeliveryTime: undated,
+	}, kinds(anomalies))
+	for _, a := range anomalies {
+		assert.False(t, a.Fixed, a.Kind)
+	}
+
+	anomalies, err = store.Doctor(true)
+	require.NoError(t, err)
+	for _, a := range anomalies {
+		assert.Equal(t, a.Fixable, a.Fixed, a.Kind)
+	}
+
+	anomalies, err = store.Doctor(false)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{
+		AnomalyUnknownStatus:       unknown,
+		AnomalyEmptyAddress:        addressless,
+		AnomalyMissingDeliveryTime: undated,
+	}, kinds(anomalies))
+	history, err := store.GetHistory(archived)
+	require.NoError(t, err)
+	assert.NotEmpty(t, history)
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DumpFormat and DumpVersion identify the format written by DumpJSONL.
+const (
+	DumpFormat  = "parcel-tracker-dump"
+	DumpVersion = 1
+)
+
+var (
+	// ErrInvalidDump indicates input to LoadJSONL that is not a dump this
+	// build can load.
+	ErrInvalidDump = errors.New("invalid dump")
+	// ErrDatabaseNotEmpty indicates a LoadJSONL into a database that
+	// already holds parcels.
+	ErrDatabaseNotEmpty = errors.New("database already holds parcels")
+)
+
+// derivedTables are filled by triggers on the parcel table, so loading
+// parcels fills them again: the change feed, which a load starts afresh
+// (see GetChangesSince), and the parcel summary (see GetParcelSummary).
+var derivedTables = map[string]bool{"parcel_change": true, "parcel_summary": true}
+
+// dumpHeader is the first line of a dump.
+type dumpHeader struct {
+	Format        string   `json:"format"`
+	Version       int      `json:"version"`
+	SchemaVersion int      `json:"schema_version"`
+	ExportedAt    string   `json:"exported_at"`
+	Tables        []string `json:"tables"`
+}
+
+// dumpRow is a line of a dump after the header.
+type dumpRow struct {
+	Table string                     `json:"table"`
+	Row   map[string]json.RawMessage `json:"row"`
+}
+
+// dumpBlob is the form of BLOB values in a dump.
+type dumpBlob struct {
+	Blob string `json:"blob"` // base64, standard encoding
+}
+
+// DumpJSONL writes every row of the database to w as line-delimited
+// JSON, for moving the data to another store or backend.
+//
+// The first line is a header:
+//
+//	{"format": "parcel-tracker-dump", "version": 1, "schema_version": 35,
+//	 "exported_at": "2024-05-01T12:00:00Z", "tables": ["parcel", ...]}
+//
+// Every other line is a row of one of the tables, keyed by column name:
+//
+//	{"table": "parcel", "row": {"number": 1, "client": 1000, "status": "sent", ...}}
+//
+// Values are JSON null, numbers for INTEGER and REAL, strings for TEXT
+// and {"blob": "<base64>"} for BLOB. The tables are those of the schema
+// at schema_version (see migrations), parcel first; search indexes are
+// left out as they are rebuilt from the data, and so are the tables
+// triggers derive from parcels (see derivedTables). Clients have no
+// table of their own: they are the client columns of parcels and related
+// rows.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store has not been initialised.
+//   - Reads every table in one transaction, so the dump is a consistent
+//     point in time while writes go on.
+//   - Wraps and returns any SQL error and any error writing to w.
+func (s ParcelStore) DumpJSONL(w io.Writer) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	// read-only, so the dump does not hold the write lock (see TxLock)
+	tx, err := s.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to begin dump: %w", err)
+	}
+	defer tx.Rollback()
+
+	header := dumpHeader{Format: DumpFormat, Version: DumpVersion,
+		ExportedAt: FormatTimestamp(time.Now(), time.Second)}
+	if err := tx.QueryRow("PRAGMA user_version").Scan(&header.SchemaVersion); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if header.Tables, err = dumpTables(timeoutQuerier{q: tx}); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if err := enc.Encode(header); err != nil {
+		return fmt.Errorf("failed to write dump: %w", err)
+	}
+	for _, table := range header.Tables {
+		if err := dumpTable(timeoutQuerier{q: tx}, enc, table); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write dump: %w", err)
+	}
+	return nil
+}
+
+// dumpTables returns the tables holding data, "parcel" first and the rest
+// by name: all but SQLite's own, virtual tables and their shadow tables,
+// and derivedTables.
+func dumpTables(q querier) ([]string, error) {
+	rows, err := q.Query(`SELECT name, sql FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite\_%' ESCAPE '\'`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables, virtual []string
+	for rows.Next() {
+		var name, ddl string
+		if err := rows.Scan(&name, &ddl); err != nil {
+			return nil, fmt.Errorf("failed to list tables: %w", err)
+		}
+		if strings.HasPrefix(strings.ToUpper(ddl), "CREATE VIRTUAL TABLE") {
+			virtual = append(virtual, name)
+			continue
+		}
+		if derivedTables[name] {
+			continue
+		}
+		tables = append(tables, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	res := tables[:0]
+	for _, t := range tables {
+		shadow := false
+		for _, v := range virtual {
+			shadow = shadow || strings.HasPrefix(t, v+"_")
+		}
+		if !shadow {
+			res = append(res, t)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if (res[i] == "parcel") != (res[j] == "parcel") {
+			return res[i] == "parcel"
+		}
+		return res[i] < res[j]
+	})
+	return res, nil
+}
+
+// dumpTable writes the rows of table to enc, in rowid order.
+func dumpTable(q querier, enc *json.Encoder, table string) error {
+	rows, err := q.Query(fmt.Sprintf("SELECT * FROM %s ORDER BY rowid", quoteIdent(table)))
+	if err != nil {
+		return fmt.Errorf("failed to dump %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to dump %s: %w", table, err)
+	}
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return fmt.Errorf("failed to dump %s: %w", table, err)
+		}
+		row := dumpRow{Table: table, Row: make(map[string]json.RawMessage, len(columns))}
+		for i, c := range columns {
+			var v any = values[i]
+			if b, ok := v.([]byte); ok {
+				v = dumpBlob{Blob: base64.StdEncoding.EncodeToString(b)}
+			}
+			if row.Row[c], err = json.Marshal(v); err != nil {
+				return fmt.Errorf("failed to dump %s.%s: %w", table, c, err)
+			}
+		}
+		if err := enc.Encode(row); err != nil {
+			return fmt.Errorf("failed to write dump: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to dump %s: %w", table, err)
+	}
+	return nil
+}
+
+// LoadJSONL loads a dump written by DumpJSONL into the database, which
+// must have its schema (see EnsureSchema) but no parcels yet.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store has not been initialised.
+//   - Returns ErrDatabaseNotEmpty if the parcel table has rows.
+//   - Returns ErrInvalidDump (wrapped) for input that does not follow the
+//     format, a dump of a newer schema than this build, or rows of tables
+//     or columns the schema does not have. Columns added to the schema
+//     after the dump was taken get their defaults.
+//   - Replaces the rows of every table listed in the header, e.g. the
+//     status labels seeded by migrations, with those of the dump.
+//   - Loads everything in one transaction: on error nothing is loaded.
+//   - Wraps and returns any SQL error and any error reading r.
+func (s ParcelStore) LoadJSONL(r io.Reader) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var header dumpHeader
+	if err := dec.Decode(&header); err != nil {
+		return fmt.Errorf("%w: header: %v", ErrInvalidDump, err)
+	}
+	if header.Format != DumpFormat || header.Version != DumpVersion {
+		return fmt.Errorf("%w: format %q version %d", ErrInvalidDump, header.Format, header.Version)
+	}
+	if header.SchemaVersion > len(migrations) {
+		return fmt.Errorf("%w: schema version %d is newer than %d", ErrInvalidDump, header.SchemaVersion,
+			len(migrations))
+	}
+
+	return s.InTx(func(tx ParcelStore) error {
+		q := tx.conn()
+		var parcels int
+		if err := q.QueryRow("SELECT COUNT(*) FROM parcel").Scan(&parcels); err != nil {
+			return fmt.Errorf("failed to count parcels: %w", err)
+		}
+		if parcels > 0 {
+			return ErrDatabaseNotEmpty
+		}
+
+		tables, err := dumpTables(q)
+		if err != nil {
+			return err
+		}
+		columns := make(map[string]map[string]bool, len(header.Tables))
+		for _, table := range header.Tables {
+			if !contains(tables, table) {
+				return fmt.Errorf("%w: unknown table %q", ErrInvalidDump, table)
+			}
+			if columns[table], err = tableColumns(q, table); err != nil {
+				return err
+			}
+			if _, err := q.Exec("DELETE FROM " + quoteIdent(table)); err != nil {
+				return fmt.Errorf("failed to clear %s: %w", table, err)
+			}
+		}
+
+		for line := 2; ; line++ {
+			var row dumpRow
+			err := dec.Decode(&row)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%w: line %d: %v", ErrInvalidDump, line, err)
+			}
+			if err := loadRow(tx, columns, row); err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+	})
+}
+
+// loadRow inserts row, checking its table and columns against columns.
+func loadRow(tx ParcelStore, columns map[string]map[string]bool, row dumpRow) error {
+	known, ok := columns[row.Table]
+	if !ok {
+		return fmt.Errorf("%w: table %q is not in the header", ErrInvalidDump, row.Table)
+	}
+	names := make([]string, 0, len(row.Row))
+	for name := range row.Row {
+		if !known[name] {
+			return fmt.Errorf("%w: unknown column %s.%s", ErrInvalidDump, row.Table, name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	quoted := make([]string, len(names))
+	args := make([]any, len(names))
+	for i, name := range names {
+		v, err := dumpValue(row.Row[name])
+		if err != nil {
+			return fmt.Errorf("%w: %s.%s: %v", ErrInvalidDump, row.Table, name, err)
+		}
+		quoted[i], args[i] = quoteIdent(name), v
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteIdent(row.Table), strings.Join(quoted, ", "),
+		strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", "))
+	if _, err := tx.conn().Exec(query, args...); err != nil {
+		return fmt.Errorf("failed to load %s row: %w", row.Table, err)
+	}
+
+	if row.Table == "parcel" {
+		var number, client int
+		json.Unmarshal(row.Row["number"], &number)
+		json.Unmarshal(row.Row["client"], &client)
+		tx.invalidateParcel(number)
+		tx.invalidateClient(client)
+	}
+	return nil
+}
+
+// dumpValue decodes a value written by dumpTable.
+func dumpValue(raw json.RawMessage) (any, error) {
+	var v any
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case nil, string:
+		return v, nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		return v.Float64()
+	case map[string]any:
+		if b, ok := v["blob"].(string); ok && len(v) == 1 {
+			return base64.StdEncoding.DecodeString(b)
+		}
+	}
+	return nil, fmt.Errorf("unsupported value %s", raw)
+}
+
+// tableColumns returns the column names of table.
+func tableColumns(q querier, table string) (map[string]bool, error) {
+	rows, err := q.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	res := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to read columns of %s: %w", table, err)
+		}
+		res[name] = true
+	}
+	return res, rows.Err()
+}
+
+// quoteIdent quotes an SQL identifier.
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
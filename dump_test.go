@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDumpLoadJSONL verifies that a dump loaded into a fresh database
+// gives back the same parcels, history, comments and proofs.
+func TestDumpLoadJSONL(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	number := getSentParcel(t, service)
+	require.NoError(t, service.DeliverWithProof(number, Proof{Kind: ProofSignature, Data: getTestSignature(t)}))
+	_, err := service.AddComment(number, "courier", "left at the door")
+	require.NoError(t, err)
+	registered, err := service.RegisterParcel(Parcel{Client: 1001, Address: "Main street 1", Payment: PaymentPaid})
+	require.NoError(t, err)
+
+	var dump bytes.Buffer
+	require.NoError(t, service.store.DumpJSONL(&dump))
+
+	// load
+	target := NewParcelService(getTestFileStore(t), NewEventBus())
+	require.NoError(t, target.store.LoadJSONL(bytes.NewReader(dump.Bytes())))
+
+	// check
+	for _, n := range []int{number, registered.Number} {
+		want, err := service.store.Get(n)
+		require.NoError(t, err)
+		got, err := target.store.Get(n)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+
+		wantHistory, err := service.History(n)
+		require.NoError(t, err)
+		gotHistory, err := target.History(n)
+		require.NoError(t, err)
+		assert.Equal(t, wantHistory, gotHistory)
+	}
+	wantProof, err := service.Proof(number)
+	require.NoError(t, err)
+	gotProof, err := target.Proof(number)
+	require.NoError(t, err)
+	assert.Equal(t, wantProof, gotProof)
+	comments, err := target.Comments(number)
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.Equal(t, "left at the door", comments[0].Text)
+	found, err := target.Search("Main", 10)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, registered.Number, found[0].Number)
+
+	// a new parcel does not reuse a loaded number
+	added, err := target.RegisterParcel(Parcel{Client: 1001, Address: "test", Payment: PaymentPaid})
+	require.NoError(t, err)
+	assert.Greater(t, added.Number, registered.Number)
+}
+
+// TestDumpJSONLHeader verifies the header line of a dump.
+func TestDumpJSONLHeader(t *testing.T) {
+	// prepare
+	store := NewParcelStore(getTestDB(t))
+	_, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// dump
+	var dump bytes.Buffer
+	require.NoError(t, store.DumpJSONL(&dump))
+
+	// check
+	line, err := bufio.NewReader(&dump).ReadString('\n')
+	require.NoError(t, err)
+	var header dumpHeader
+	require.NoError(t, json.Unmarshal([]byte(line), &header))
+	assert.Equal(t, DumpFormat, header.Format)
+	assert.Equal(t, DumpVersion, header.Version)
+	assert.Equal(t, len(migrations), header.SchemaVersion)
+	require.NotEmpty(t, header.Tables)
+	assert.Equal(t, "parcel", header.Tables[0])
+	assert.Contains(t, header.Tables, "parcel_status_history")
+	for _, table := range header.Tables {
+		assert.False(t, strings.HasPrefix(table, "parcel_address_fts"), table)
+	}
+}
+
+// TestLoadJSONLInvalid ensures that invalid dumps and non-empty databases
+// are rejected without loading anything.
+func TestLoadJSONLInvalid(t *testing.T) {
+	// prepare
+	store := NewParcelStore(getTestDB(t))
+	header := `{"format":"parcel-tracker-dump","version":1,"schema_version":1,"tables":["parcel"]}` + "\n"
+	row := `{"table":"parcel","row":{"number":1,"client":1000,"status":"registered","address":"test","created_at":"2024-01-01T00:00:00Z"}}` + "\n"
+	tests := []struct {
+		name string
+		dump string
+	}{
+		{"empty", ""},
+		{"not json", "parcels\n"},
+		{"other format", `{"format":"csv","version":1}` + "\n"},
+		{"newer version", `{"format":"parcel-tracker-dump","version":2}` + "\n"},
+		{"newer schema", `{"format":"parcel-tracker-dump","version":1,"schema_version":1000}` + "\n"},
+		{"unknown table", `{"format":"parcel-tracker-dump","version":1,"tables":["parcels"]}` + "\n"},
+		{"table not in header", header + strings.Replace(row, `"parcel"`, `"parcel_history"`, 1)},
+		{"unknown column", header + strings.Replace(row, `"address"`, `"street"`, 1)},
+		{"unsupported value", header + strings.Replace(row, `"test"`, `["test"]`, 1)},
+		{"truncated", header + row[:40]},
+	}
+
+	// check
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := store.LoadJSONL(strings.NewReader(tt.dump))
+			assert.ErrorIs(t, err, ErrInvalidDump)
+		})
+	}
+	require.NoError(t, store.LoadJSONL(strings.NewReader(header+row)))
+	_, err := store.Get(1)
+	require.NoError(t, err)
+	assert.ErrorIs(t, store.LoadJSONL(strings.NewReader(header+row)), ErrDatabaseNotEmpty)
+}
+
+// FuzzLoadJSONL checks that no dump, however malformed, panics, changes
+// the schema through a table or column name, or leaves rows behind when
+// it is rejected.
+func FuzzLoadJSONL(f *testing.F) {
+	header := `{"format":"parcel-tracker-dump","version":1,"schema_version":1,"tables":["parcel"]}` + "\n"
+	row := `{"table":"parcel","row":{"number":1,"client":1000,"status":"registered","address":"test","created_at":"2024-01-01T00:00:00Z"}}` + "\n"
+	f.Add(header + row)
+	f.Add(header + strings.Replace(row, `"address"`, `"address\" TEXT); DROP TABLE parcel; --"`, 1))
+	f.Add(strings.Replace(header, `["parcel"]`, `["parcel\"; DROP TABLE parcel; --"]`, 1) + row)
+	f.Add(header + strings.Replace(row, `"test"`, `{"blob":"AAEC"}`, 1))
+	f.Add(header + row[:40])
+
+	f.Fuzz(func(t *testing.T, dump string) {
+		// prepare
+		db := getTestDB(t)
+		defer db.Close()
+		store := NewParcelStore(db)
+		schema := func() string {
+			var s string
+			err := db.QueryRow("SELECT group_concat(name || ':' || COALESCE(sql, ''), ';') FROM " +
+				"(SELECT name, sql FROM sqlite_master ORDER BY name)").Scan(&s)
+			require.NoError(t, err)
+			return s
+		}
+		before := schema()
+
+		// load
+		err := store.LoadJSONL(strings.NewReader(dump))
+
+		// check
+		assert.Equal(t, before, schema())
+		if err != nil {
+			var parcels int
+			require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM parcel").Scan(&parcels))
+			assert.Zero(t, parcels)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrDuplicateParcel indicates that a registration looks like a repeat
+// of a recent one and the duplicate policy rejects it.
+var ErrDuplicateParcel = newError(CodeDuplicateParcel, "suspected duplicate parcel")
+
+// DuplicateAction is what the service does with a suspected duplicate.
+type DuplicateAction int
+
+const (
+	// DuplicateReject refuses the registration with ErrDuplicateParcel.
+	DuplicateReject DuplicateAction = iota
+	// DuplicateFlag registers the parcel with DuplicateOf set.
+	DuplicateFlag
+)
+
+// DuplicatePolicy describes when a registration is a suspected
+// duplicate: the same client registered a parcel to the same address
+// (ignoring case and surrounding spaces) less than Window ago.
+// A zero Window disables the check.
+type DuplicatePolicy struct {
+	Window time.Duration
+	Action DuplicateAction
+}
+
+// findDuplicate returns the latest parcel of client to address created at
+// or after since. Returns sql.ErrNoRows (wrapped) if there is none.
+//
+// Addresses are compared after reading, as they may be encrypted (see
+// WithFieldEncryption).
+func (s ParcelStore) findDuplicate(client int, address string, since time.Time) (Parcel, error) {
+	query := "SELECT " + parcelColumns + ` FROM parcel
+WHERE client = :client AND julianday(created_at) >= julianday(:since)
+ORDER BY julianday(created_at) DESC, seq DESC`
+	parcels, err := s.queryParcels(fmt.Sprintf("duplicates for client %d", pii(client)), query,
+		sql.Named("client", client), sql.Named("since", FormatTimestamp(since, DefaultTimestampPrecision)))
+	if err != nil {
+		return Parcel{}, err
+	}
+	for _, p := range parcels {
+		if strings.EqualFold(strings.TrimSpace(p.Address), strings.TrimSpace(address)) {
+			return p, nil
+		}
+	}
+	return Parcel{}, fmt.Errorf("failed to find duplicate of parcel for client %d: %w", pii(client), sql.ErrNoRows)
+}
+
+// checkDuplicate applies the service's duplicate policy to parcel, which
+// is about to be registered at now, and sets DuplicateOf when flagging.
+func (s ParcelService) checkDuplicate(tx ParcelStore, parcel *Parcel, now time.Time) error {
+	if s.duplicates.Window <= 0 {
+		return nil
+	}
+
+	existing, err := tx.findDuplicate(parcel.Client, parcel.Address, now.Add(-s.duplicates.Window))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.duplicates.Action == DuplicateFlag {
+		parcel.DuplicateOf = existing.Number
+		return nil
+	}
+	return fmt.Errorf("failed to register parcel for client %d: %w of parcel %d registered %s",
+		pii(parcel.Client), ErrDuplicateParcel, existing.Number, existing.CreatedAt)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRegisterWhenDuplicateRejected verifies that a repeat within the
+// window is rejected unless overridden, while other clients, addresses
+// and old parcels are unaffected.
+func TestRegisterWhenDuplicateRejected(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	service = service.WithDuplicatePolicy(DuplicatePolicy{Window: 10 * time.Minute, Action: DuplicateReject})
+	first, err := service.Register(1000, "Main street 1")
+	require.NoError(t, err)
+
+	// register
+	_, err = service.Register(1000, "  main STREET 1 ")
+	require.ErrorIs(t, err, ErrDuplicateParcel)
+	_, err = service.Register(2000, "Main street 1")
+	require.NoError(t, err)
+	_, err = service.Register(1000, "Main street 2")
+	require.NoError(t, err)
+	again, err := service.AllowDuplicates().Register(1000, "Main street 1")
+	require.NoError(t, err)
+
+	// check
+	assert.NotEqual(t, first.Number, again.Number)
+	assert.Zero(t, again.DuplicateOf)
+
+	old := getTestParcel()
+	old.Address = "Old street 1"
+	old.CreatedAt = FormatTimestamp(time.Now().Add(-time.Hour), DefaultTimestampPrecision)
+	_, err = service.store.Add(old)
+	require.NoError(t, err)
+	_, err = service.Register(old.Client, old.Address)
+	require.NoError(t, err)
+}
+
+// TestRegisterWhenDuplicateFlagged verifies that flagged duplicates are
+// registered, point at the original and can be listed.
+func TestRegisterWhenDuplicateFlagged(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	service = service.WithDuplicatePolicy(DuplicatePolicy{Window: 10 * time.Minute, Action: DuplicateFlag})
+	first, err := service.Register(1000, "Main street 1")
+	require.NoError(t, err)
+
+	// register
+	second, err := service.Register(1000, "Main street 1")
+	require.NoError(t, err)
+
+	// check
+	assert.Equal(t, first.Number, second.DuplicateOf)
+	flagged, err := service.FindParcels(ParcelFilter{SuspectedDuplicates: true})
+	require.NoError(t, err)
+	require.Len(t, flagged, 1)
+	assert.Equal(t, second.Number, flagged[0].Number)
+}
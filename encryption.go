@@ -0,0 +1,436 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrUnknownKey indicates an encrypted value whose key the key
+	// provider does not have, or a store without a key provider.
+	ErrUnknownKey = errors.New("unknown encryption key")
+	// ErrInvalidKeyRing indicates a key ring that does not parse or holds
+	// keys unusable for AES.
+	ErrInvalidKeyRing = errors.New("invalid key ring")
+	// ErrSearchUnavailable indicates a search of addresses while they are
+	// encrypted, which the full-text index cannot see.
+	ErrSearchUnavailable = newError(CodeSearchUnavailable, "address search is unavailable with encrypted addresses")
+)
+
+// KeyProvider supplies the keys of field encryption (see
+// WithFieldEncryption). Keys are 16, 24 or 32 bytes long, selecting
+// AES-128, AES-192 or AES-256, and identified by an id stored with every
+// value they encrypt, so that values encrypted with a retired key can
+// still be read after a rotation; ids must not contain colons.
+type KeyProvider interface {
+	// CurrentKey returns the key to encrypt new values with and its id.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key with the given id; ErrUnknownKey (wrapped) if
+	// there is none.
+	Key(id string) ([]byte, error)
+}
+
+// KeyRing is a KeyProvider over a fixed set of keys by id.
+type KeyRing struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+// CurrentKey returns the key with id r.Current.
+func (r KeyRing) CurrentKey() (string, []byte, error) {
+	key, err := r.Key(r.Current)
+	return r.Current, key, err
+}
+
+// Key returns the key with the given id.
+func (r KeyRing) Key(id string) ([]byte, error) {
+	key, ok := r.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	return key, nil
+}
+
+// ParseKeyRing parses a key ring written as comma-separated "id:key"
+// pairs, with keys in standard base64, e.g. "2024:<key>,2023:<key>". The
+// first key is the current one; the others decrypt older values.
+func ParseKeyRing(s string) (KeyRing, error) {
+	ring := KeyRing{Keys: map[string][]byte{}}
+	for i, pair := range strings.Split(s, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || id == "" {
+			return KeyRing{}, fmt.Errorf("%w: key %d is not \"id:key\"", ErrInvalidKeyRing, i+1)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return KeyRing{}, fmt.Errorf("%w: key %q: %v", ErrInvalidKeyRing, id, err)
+		}
+		if _, err := aes.NewCipher(key); err != nil {
+			return KeyRing{}, fmt.Errorf("%w: key %q: %v", ErrInvalidKeyRing, id, err)
+		}
+		if _, dup := ring.Keys[id]; dup {
+			return KeyRing{}, fmt.Errorf("%w: key %q appears twice", ErrInvalidKeyRing, id)
+		}
+		if i == 0 {
+			ring.Current = id
+		}
+		ring.Keys[id] = key
+	}
+	return ring, nil
+}
+
+// encryptedPrefix starts every encrypted value, followed by the key id,
+// a colon and the base64 (standard, unpadded) nonce and AES-GCM sealed
+// value. Values without it are plaintext written before encryption was
+// enabled.
+const encryptedPrefix = "enc:v1:"
+
+// Purposes of encrypted values, authenticated with them so that a value
+// cannot be moved into a column of another kind.
+const (
+	purposeAddress = "address"
+	purposePhone   = "recipient_phone"
+)
+
+// WithFieldEncryption returns a copy of the store that encrypts addresses
+// and recipient phones at rest with AES-GCM, using the current key of
+// keys, and decrypts them transparently on read.
+//
+// Addresses are encrypted in the parcel table and in the address
+// history, change and correction audit tables; the archive stores them
+// encrypted as well. Recipient phones are encrypted deterministically,
+// so that filtering parcels by phone keeps working: equal phones give
+// equal values under the same key. Plaintext values written before
+// encryption was enabled are still read; ReencryptFields encrypts them,
+// and values of retired keys, with the current key.
+//
+// The full-text index cannot see encrypted addresses: Search returns
+// ErrSearchUnavailable.
+func (s ParcelStore) WithFieldEncryption(keys KeyProvider) ParcelStore {
+	s.keys = keys
+	return s
+}
+
+// seal encrypts value for purpose with the current key, unless the store
+// encrypts nothing or value is empty. A deterministic seal derives the
+// nonce from the key and the value instead of drawing it at random.
+func (s ParcelStore) seal(value, purpose string, deterministic bool) (string, error) {
+	if s.keys == nil || value == "" {
+		return value, nil
+	}
+
+	id, key, err := s.keys.CurrentKey()
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt %s: %w", purpose, err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt %s: %w", purpose, err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if deterministic {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(purpose + "\x00" + value))
+		copy(nonce, mac.Sum(nil))
+	} else if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to encrypt %s: %w", purpose, err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(purpose))
+	return encryptedPrefix + id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a value sealed for purpose; plaintext values are returned
+// as they are.
+func (s ParcelStore) open(value, purpose string) (string, error) {
+	id, ok := encryptedKeyID(value)
+	if !ok {
+		return value, nil
+	}
+	if s.keys == nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w %q: no key provider", purpose, ErrUnknownKey, id)
+	}
+
+	key, err := s.keys.Key(id)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", purpose, err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", purpose, err)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(value[len(encryptedPrefix)+len(id)+1:])
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("failed to decrypt %s: malformed value", purpose)
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(purpose))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", purpose, err)
+	}
+	return string(plain), nil
+}
+
+// encryptedKeyID returns the key id of an encrypted value, and false for
+// plaintext.
+func encryptedKeyID(value string) (string, bool) {
+	rest, ok := strings.CutPrefix(value, encryptedPrefix)
+	if !ok {
+		return "", false
+	}
+	id, _, ok := strings.Cut(rest, ":")
+	return id, ok
+}
+
+// newAEAD returns AES-GCM with key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealAddress and sealPhone encrypt an address and a recipient phone.
+func (s ParcelStore) sealAddress(address string) (string, error) {
+	return s.seal(address, purposeAddress, false)
+}
+
+func (s ParcelStore) sealPhone(phone string) (string, error) {
+	return s.seal(phone, purposePhone, true)
+}
+
+// sealParcel returns p with its address and recipient phone encrypted.
+func (s ParcelStore) sealParcel(p Parcel) (Parcel, error) {
+	var err error
+	if p.Address, err = s.sealAddress(p.Address); err != nil {
+		return p, err
+	}
+	p.Recipient.Phone, err = s.sealPhone(p.Recipient.Phone)
+	return p, err
+}
+
+// openParcel returns p with its address and recipient phone decrypted.
+func (s ParcelStore) openParcel(p Parcel) (Parcel, error) {
+	var err error
+	if p.Address, err = s.open(p.Address, purposeAddress); err != nil {
+		return p, fmt.Errorf("parcel %d: %w", p.Number, err)
+	}
+	if p.Recipient.Phone, err = s.open(p.Recipient.Phone, purposePhone); err != nil {
+		return p, fmt.Errorf("parcel %d: %w", p.Number, err)
+	}
+	return p, nil
+}
+
+// encryptedColumns lists the columns WithFieldEncryption encrypts, by
+// table and primary key, with the purpose of their values.
+var encryptedColumns = []struct {
+	table, key, column, purpose string
+}{
+	{"parcel", "number", "address", purposeAddress},
+	{"parcel", "number", "recipient_phone", purposePhone},
+	{"parcel_address_history", "id", "address", purposeAddress},
+	{"address_changes", "id", "old_address", purposeAddress},
+	{"address_changes", "id", "new_address", purposeAddress},
+	{"address_correction", "id", "old_address", purposeAddress},
+	{"address_correction", "id", "new_address", purposeAddress},
+	{"client_address", "id", "address", purposeAddress},
+	{"parcel_template", "id", "address", purposeAddress},
+}
+
+// ReencryptFields encrypts every value of the encrypted columns, and the
+// addresses and phones of archived parcels and parcel drafts, that is
+// plaintext or encrypted with another key than the current one, e.g.
+// after enabling encryption or rotating keys. It returns how many values
+// it rewrote, counting each archived parcel and draft once.
+// Once it returns, retired keys can be dropped from the provider.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrUnknownKey (wrapped) if the store has no key provider.
+//   - Runs in one transaction; on error nothing is rewritten.
+//   - Wraps and returns any SQL, decryption or encoding errors.
+func (s ParcelStore) ReencryptFields() (int, error) {
+	if err := s.check(); err != nil {
+		return 0, err
+	}
+	if s.keys == nil {
+		return 0, fmt.Errorf("failed to re-encrypt fields: %w: no key provider", ErrUnknownKey)
+	}
+	current, _, err := s.keys.CurrentKey()
+	if err != nil {
+		return 0, fmt.Errorf("failed to re-encrypt fields: %w", err)
+	}
+	stale := func(value string) bool {
+		id, ok := encryptedKeyID(value)
+		return value != "" && (!ok || id != current)
+	}
+
+	total := 0
+	err = s.InTx(func(tx ParcelStore) error {
+		for _, c := range encryptedColumns {
+			n, err := tx.reencryptColumn(c.table, c.key, c.column, c.purpose, stale)
+			total += n
+			if err != nil {
+				return err
+			}
+		}
+		n, err := tx.reencryptArchive(stale)
+		total += n
+		if err != nil {
+			return err
+		}
+		n, err = tx.reencryptDrafts(stale)
+		total += n
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// reencryptColumn rewrites the stale values of one column; it must run
+// inside InTx.
+func (s ParcelStore) reencryptColumn(table, key, column, purpose string, stale func(string) bool) (int, error) {
+	query := fmt.Sprintf("SELECT %s, %s FROM %s", key, column, table)
+	rows, err := s.conn().Query(query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get cursor for %s.%s: %w", table, column, err)
+	}
+	values := map[int]string{}
+	for rows.Next() {
+		var id int
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan one of %s rows: %w", table, err)
+		}
+		if stale(value) {
+			values[id] = value
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to iterate %s rows: %w", table, err)
+	}
+
+	queryUpdate := fmt.Sprintf("UPDATE %s SET %s = :value WHERE %s = :id", table, column, key)
+	for id, value := range values {
+		plain, err := s.open(value, purpose)
+		if err != nil {
+			return 0, fmt.Errorf("failed to re-encrypt %s.%s of %d: %w", table, column, id, err)
+		}
+		sealed, err := s.seal(plain, purpose, purpose == purposePhone)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := s.conn().Exec(queryUpdate, sql.Named("value", sealed), sql.Named("id", id)); err != nil {
+			return 0, fmt.Errorf("failed to re-encrypt %s.%s of %d: %w", table, column, id, err)
+		}
+	}
+	return len(values), nil
+}
+
+// reencryptArchive rewrites the archived parcels with stale addresses or
+// phones; it must run inside InTx.
+func (s ParcelStore) reencryptArchive(stale func(string) bool) (int, error) {
+	rows, err := s.conn().Query("SELECT data FROM parcel_archive")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get cursor for archived parcels: %w", err)
+	}
+	var parcels []Parcel
+	for rows.Next() {
+		var data string
+		var p Parcel
+		if err := rows.Scan(&data); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan one of archived parcel rows: %w", err)
+		}
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to decode archived parcel: %w", err)
+		}
+		if stale(p.Address) || stale(p.Recipient.Phone) {
+			parcels = append(parcels, p)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to iterate archived parcel rows: %w", err)
+	}
+
+	n := 0
+	queryUpdate := "UPDATE parcel_archive SET data = :data WHERE number = :number"
+	for _, p := range parcels {
+		p, err := s.openParcel(p)
+		if err != nil {
+			return 0, fmt.Errorf("failed to re-encrypt archived %w", err)
+		}
+		if p, err = s.sealParcel(p); err != nil {
+			return 0, err
+		}
+		data, err := json.Marshal(p)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode archived parcel with number %d: %w", p.Number, err)
+		}
+		if _, err := s.conn().Exec(queryUpdate, sql.Named("data", string(data)), sql.Named("number", p.Number)); err != nil {
+			return 0, fmt.Errorf("failed to re-encrypt archived parcel with number %d: %w", p.Number, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// reencryptDrafts rewrites the parcel drafts with stale addresses or
+// phones; it must run inside InTx.
+func (s ParcelStore) reencryptDrafts(stale func(string) bool) (int, error) {
+	rows, err := s.conn().Query("SELECT id, data FROM parcel_draft")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get cursor for parcel drafts: %w", err)
+	}
+	drafts := map[int]Parcel{}
+	for rows.Next() {
+		var id int
+		var data string
+		var p Parcel
+		if err := rows.Scan(&id, &data); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan one of parcel draft rows: %w", err)
+		}
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to decode parcel draft %d: %w", id, err)
+		}
+		if stale(p.Address) || stale(p.Recipient.Phone) {
+			drafts[id] = p
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to iterate parcel draft rows: %w", err)
+	}
+
+	queryUpdate := "UPDATE parcel_draft SET data = :data WHERE id = :id"
+	for id, p := range drafts {
+		p, err := s.openParcel(p)
+		if err != nil {
+			return 0, fmt.Errorf("failed to re-encrypt parcel draft %d: %w", id, err)
+		}
+		data, err := s.encodeDraft(ParcelDraft{ID: id, Parcel: p})
+		if err != nil {
+			return 0, err
+		}
+		if _, err := s.conn().Exec(queryUpdate, sql.Named("data", data), sql.Named("id", id)); err != nil {
+			return 0, fmt.Errorf("failed to re-encrypt parcel draft %d: %w", id, err)
+		}
+	}
+	return len(drafts), nil
+}
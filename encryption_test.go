@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getTestKeyRing returns a key ring with a 32-byte key per id, the first
+// one current.
+func getTestKeyRing(t *testing.T, ids ...string) KeyRing {
+	t.Helper()
+	pairs := make([]string, len(ids))
+	for i, id := range ids {
+		pairs[i] = id + ":" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte(id[:1]), 32))
+	}
+	ring, err := ParseKeyRing(strings.Join(pairs, ","))
+	require.NoError(t, err)
+	return ring
+}
+
+// rawParcelFields returns the address and recipient phone of a parcel as
+// stored.
+func rawParcelFields(t *testing.T, store ParcelStore, number int) (string, string) {
+	t.Helper()
+	var address, phone string
+	err := store.db.QueryRow("SELECT address, recipient_phone FROM parcel WHERE number = ?", number).
+		Scan(&address, &phone)
+	require.NoError(t, err)
+	return address, phone
+}
+
+// TestFieldEncryption verifies that addresses and phones are stored
+// encrypted and read back transparently.
+func TestFieldEncryption(t *testing.T) {
+	// prepare
+	plain := NewParcelStore(getTestDB(t))
+	store := plain.WithFieldEncryption(getTestKeyRing(t, "a"))
+	parcel := getTestParcel()
+	parcel.Address = "Moscow, Tverskaya 1"
+	parcel.Recipient = Recipient{Name: "Ivan Petrov", Phone: "+79991234567"}
+
+	// add
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	other := getTestParcel()
+	other.Recipient = Recipient{Name: "Ivan Petrov", Phone: "+79991234567"}
+	otherID, err := store.Add(other)
+	require.NoError(t, err)
+
+	// check
+	address, phone := rawParcelFields(t, store, id)
+	assert.True(t, strings.HasPrefix(address, "enc:v1:a:"), address)
+	assert.NotContains(t, address, "Tverskaya")
+	assert.True(t, strings.HasPrefix(phone, "enc:v1:a:"), phone)
+	_, otherPhone := rawParcelFields(t, store, otherID)
+	assert.Equal(t, phone, otherPhone)
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, parcel.Address, stored.Address)
+	assert.Equal(t, parcel.Recipient, stored.Recipient)
+	found, err := store.Find(ParcelFilter{RecipientPhone: "8 (999) 123-45-67"})
+	require.NoError(t, err)
+	assert.Len(t, found, 2)
+
+	require.NoError(t, store.SetAddress(id, "Moscow, Arbat 2"))
+	stored, err = store.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, "Moscow, Arbat 2", stored.Address)
+	history, err := store.GetAddressHistory(id)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, parcel.Address, history[0].Address)
+
+	_, err = store.Search("Arbat", 10)
+	assert.ErrorIs(t, err, ErrSearchUnavailable)
+	_, err = plain.Get(id)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	_, err = plain.WithFieldEncryption(getTestKeyRing(t, "b")).Get(id)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+// TestFieldEncryptionDuplicates verifies that duplicate registrations are
+// still detected with encrypted addresses.
+func TestFieldEncryptionDuplicates(t *testing.T) {
+	// prepare
+	store := NewParcelStore(getTestDB(t)).WithFieldEncryption(getTestKeyRing(t, "a"))
+	service := NewParcelService(store, nil).WithDuplicatePolicy(DuplicatePolicy{Window: time.Hour})
+	_, err := service.RegisterParcel(Parcel{Client: 1000, Address: "Moscow, Tverskaya 1"})
+	require.NoError(t, err)
+
+	// check
+	_, err = service.RegisterParcel(Parcel{Client: 1000, Address: " moscow, tverskaya 1"})
+	assert.ErrorIs(t, err, ErrDuplicateParcel)
+}
+
+// TestReencryptFields verifies that plaintext values and values of a
+// retired key are rewritten with the current key.
+func TestReencryptFields(t *testing.T) {
+	// prepare
+	plain := NewParcelStore(getTestDB(t))
+	parcel := getTestParcel()
+	parcel.Status = ParcelStatusDelivered
+	parcel.CreatedAt = FormatTimestamp(time.Now().Add(-time.Hour), DefaultTimestampPrecision)
+	parcel.Recipient = Recipient{Name: "Ivan Petrov", Phone: "+79991234567"}
+	archivedID, err := plain.Add(parcel)
+	require.NoError(t, err)
+	_, err = plain.Archive(0)
+	require.NoError(t, err)
+	id, err := plain.Add(getTestParcel())
+	require.NoError(t, err)
+
+	_, err = plain.ReencryptFields()
+	require.ErrorIs(t, err, ErrUnknownKey)
+
+	// encrypt
+	first := plain.WithFieldEncryption(getTestKeyRing(t, "a"))
+	n, err := first.ReencryptFields()
+	require.NoError(t, err)
+	// the parcel address, two address history entries and the archive
+	assert.Equal(t, 4, n)
+	address, _ := rawParcelFields(t, first, id)
+	assert.True(t, strings.HasPrefix(address, "enc:v1:a:"), address)
+
+	// rotate
+	rotated := plain.WithFieldEncryption(getTestKeyRing(t, "b", "a"))
+	n, err = rotated.ReencryptFields()
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+	n, err = rotated.ReencryptFields()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	// check
+	retired := plain.WithFieldEncryption(getTestKeyRing(t, "b"))
+	stored, err := retired.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, "test", stored.Address)
+	archived, err := retired.GetArchived(archivedID)
+	require.NoError(t, err)
+	assert.Equal(t, parcel.Recipient, archived.Recipient)
+	history, err := retired.GetAddressHistory(id)
+	require.NoError(t, err)
+	assert.Equal(t, "test", history[0].Address)
+}
+
+// TestParseKeyRing verifies the key ring syntax and key checks.
+func TestParseKeyRing(t *testing.T) {
+	// check
+	key := base64.StdEncoding.EncodeToString(make([]byte, 16))
+	ring, err := ParseKeyRing("new:" + key + ", old:" + key)
+	require.NoError(t, err)
+	assert.Equal(t, "new", ring.Current)
+	assert.Len(t, ring.Keys, 2)
+
+	for _, s := range []string{"", key, ":" + key, "k:not base64", "k:" + base64.StdEncoding.EncodeToString(make([]byte, 10)),
+		"k:" + key + ",k:" + key} {
+		_, err := ParseKeyRing(s)
+		assert.ErrorIs(t, err, ErrInvalidKeyRing, s)
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrInvalidErasure indicates an erasure request for an invalid
+	// client number.
+	ErrInvalidErasure = newError(CodeInvalidErasure, "invalid erasure request")
+	// ErrParcelsInTransit indicates an erasure request for a client with
+	// parcels still on their way; it can be repeated once they arrive.
+	ErrParcelsInTransit = newError(CodeParcelsInTransit, "client has parcels in transit")
+)
+
+// RetentionPolicy says which data of a client survives EraseClientData.
+// Parcels created less than Keep ago are kept for accounting and customs
+// records, anonymised; older parcels are deleted with all their data.
+// A zero Keep deletes every parcel.
+type RetentionPolicy struct {
+	Keep time.Duration
+}
+
+// ClientErasure is the tombstone of an erasure of the data of a client:
+// how many parcels were deleted and anonymised under which retention.
+type ClientErasure struct {
+	ID         int
+	Client     int
+	Deleted    int
+	Anonymised int
+	// Retention is the Keep of the RetentionPolicy applied.
+	Retention time.Duration
+	ErasedAt  string
+}
+
+// erasedParcelTables lists the tables whose rows of a parcel, keyed by
+// parcel_number, are deleted with the parcel by EraseClient.
+var erasedParcelTables = []string{
+	"parcel_status_history", "parcel_location", "scan_event", "parcel_comments", "parcel_address_history",
+	"address_correction", "address_changes", "status_override", "notification", "delivery_proof",
+	"parcel_claim", "route_stop", "parcel_order_item", "delivery_code", "work_item",
+}
+
+// anonymisedParcelQueries clear the personal data of the parcel :number
+// kept by EraseClient: its address, recipient and whereabouts, and the
+// messages, comments and proofs of delivery that may repeat them.
+var anonymisedParcelQueries = []string{
+	`UPDATE parcel SET client = 0, address = '', latitude = NULL, longitude = NULL, recipient_name = '',
+    recipient_phone = '', attributes = '{}', tracking_code = '', idempotency_key = ''
+WHERE number = :number`,
+	"UPDATE parcel_address_history SET address = '' WHERE parcel_number = :number",
+	"UPDATE address_correction SET old_address = '', new_address = '' WHERE parcel_number = :number",
+	"UPDATE address_changes SET old_address = '', new_address = '' WHERE parcel_number = :number",
+	"UPDATE parcel_claim SET description = '', resolution = '' WHERE parcel_number = :number",
+	"DELETE FROM notification WHERE parcel_number = :number",
+	"DELETE FROM parcel_comments WHERE parcel_number = :number",
+	"DELETE FROM delivery_proof WHERE parcel_number = :number",
+}
+
+// anonymise returns p without the personal data anonymisedParcelQueries
+// clear, for archived parcels.
+func anonymise(p Parcel) Parcel {
+	p.Client, p.Address, p.Coordinates, p.Recipient = 0, "", nil, Recipient{}
+	p.Attributes, p.TrackingCode, p.IdempotencyKey = nil, "", ""
+	return p
+}
+
+// EraseClient erases the data of client, live and archived: parcels
+// created before cutoff are deleted with everything recorded about them,
+// later ones are anonymised (see anonymisedParcelQueries), and a
+// ClientErasure tombstone with the given retention is recorded.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Also drops the notification preferences, saved addresses, parcel
+//     templates and drafts of the client and its orders of deleted parcels,
+//     detaches the rest from it, and revokes its API keys.
+//   - Runs in one transaction; on error nothing is erased.
+//   - Succeeds with zero counts for clients without data, still
+//     recording the tombstone.
+//   - Wraps and returns any SQL or encoding errors.
+func (s ParcelStore) EraseClient(client int, cutoff time.Time, retention time.Duration) (ClientErasure, error) {
+	erasure := ClientErasure{Client: client, Retention: retention,
+		ErasedAt: FormatTimestamp(time.Now(), DefaultTimestampPrecision)}
+
+	if err := s.check(); err != nil {
+		return erasure, err
+	}
+
+	err := s.InTx(func(tx ParcelStore) error {
+		parcels, err := tx.GetByClient(client)
+		if err != nil {
+			return err
+		}
+		before := FormatTimestamp(cutoff, DefaultTimestampPrecision)
+		for _, p := range parcels {
+			tx.invalidateParcel(p.Number)
+			if p.CreatedAt < before {
+				err = tx.deleteParcelData(p.Number)
+				erasure.Deleted++
+			} else {
+				err = tx.anonymiseParcelData(p.Number)
+				erasure.Anonymised++
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		deleted, anonymised, err := tx.eraseArchived(client, before)
+		if err != nil {
+			return err
+		}
+		erasure.Deleted += deleted
+		erasure.Anonymised += anonymised
+
+		if err := tx.eraseClientRecords(client); err != nil {
+			return err
+		}
+		tx.invalidateClient(client)
+		tx.invalidateClient(0)
+
+		query := `INSERT INTO client_erasure (client, deleted, anonymised, retention, erased_at)
+VALUES (:client, :deleted, :anonymised, :retention, :erased_at)`
+		res, err := tx.conn().Exec(query, sql.Named("client", client), sql.Named("deleted", erasure.Deleted),
+			sql.Named("anonymised", erasure.Anonymised), sql.Named("retention", retention.String()),
+			sql.Named("erased_at", erasure.ErasedAt))
+		if err != nil {
+			return fmt.Errorf("failed to record erasure of client %d: %w", pii(client), err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get id of erasure of client %d: %w", pii(client), err)
+		}
+		erasure.ID = int(id)
+		return nil
+	})
+	return erasure, err
+}
+
+// deleteParcelData deletes the parcel and the rows of erasedParcelTables
+// and parcel_link about it; it must run inside InTx.
+func (s ParcelStore) deleteParcelData(number int) error {
+	for _, table := range erasedParcelTables {
+		query := "DELETE FROM " + table + " WHERE parcel_number = :number"
+		if _, err := s.conn().Exec(query, sql.Named("number", number)); err != nil {
+			return fmt.Errorf("failed to erase %s of parcel with number %d: %w", table, number, err)
+		}
+	}
+	queryLinks := "DELETE FROM parcel_link WHERE parent_number = :number OR child_number = :number"
+	if _, err := s.conn().Exec(queryLinks, sql.Named("number", number)); err != nil {
+		return fmt.Errorf("failed to erase links of parcel with number %d: %w", number, err)
+	}
+	queryDelete := "DELETE FROM parcel WHERE number = :number"
+	if _, err := s.conn().Exec(queryDelete, sql.Named("number", number)); err != nil {
+		return fmt.Errorf("failed to erase parcel with number %d: %w", number, err)
+	}
+	return nil
+}
+
+// anonymiseParcelData runs anonymisedParcelQueries on the parcel; it must
+// run inside InTx.
+func (s ParcelStore) anonymiseParcelData(number int) error {
+	for _, query := range anonymisedParcelQueries {
+		if _, err := s.conn().Exec(query, sql.Named("number", number)); err != nil {
+			return fmt.Errorf("failed to anonymise parcel with number %d: %w", number, err)
+		}
+	}
+	return nil
+}
+
+// eraseArchived deletes the archived parcels of client created before
+// before, anonymises the others, and returns how many of each; it must
+// run inside InTx.
+func (s ParcelStore) eraseArchived(client int, before string) (int, int, error) {
+	rows, err := s.conn().Query("SELECT data FROM parcel_archive WHERE client = :client ORDER BY number",
+		sql.Named("client", client))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get cursor for archived parcels of client %d: %w", pii(client), err)
+	}
+	var parcels []Parcel
+	for rows.Next() {
+		var data string
+		var p Parcel
+		if err := rows.Scan(&data); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("failed to scan archived parcel row of client %d: %w", pii(client), err)
+		}
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("failed to decode archived parcel of client %d: %w", pii(client), err)
+		}
+		parcels = append(parcels, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to iterate archived parcel rows of client %d: %w", pii(client), err)
+	}
+
+	deleted, anonymised := 0, 0
+	for _, p := range parcels {
+		if p.CreatedAt < before {
+			if err := s.deleteParcelData(p.Number); err != nil {
+				return 0, 0, err
+			}
+			queryDelete := "DELETE FROM parcel_archive WHERE number = :number"
+			if _, err := s.conn().Exec(queryDelete, sql.Named("number", p.Number)); err != nil {
+				return 0, 0, fmt.Errorf("failed to erase archived parcel with number %d: %w", p.Number, err)
+			}
+			deleted++
+			continue
+		}
+
+		if err := s.anonymiseParcelData(p.Number); err != nil {
+			return 0, 0, err
+		}
+		data, err := json.Marshal(anonymise(p))
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to encode archived parcel with number %d: %w", p.Number, err)
+		}
+		queryUpdate := "UPDATE parcel_archive SET client = 0, data = :data WHERE number = :number"
+		_, err = s.conn().Exec(queryUpdate, sql.Named("data", string(data)), sql.Named("number", p.Number))
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to anonymise archived parcel with number %d: %w", p.Number, err)
+		}
+		anonymised++
+	}
+	return deleted, anonymised, nil
+}
+
+// eraseClientRecords erases what is recorded about client beyond its
+// parcels; it must run inside InTx.
+func (s ParcelStore) eraseClientRecords(client int) error {
+	queries := []struct{ what, query string }{
+		{"notification preferences", "DELETE FROM notification_preference WHERE client = :client"},
+		{"saved addresses", "DELETE FROM client_address WHERE client = :client"},
+		{"parcel templates", "DELETE FROM parcel_template WHERE client = :client"},
+		{"parcel drafts", "DELETE FROM parcel_draft WHERE client = :client"},
+		{"orders", `DELETE FROM parcel_order WHERE client = :client
+    AND NOT EXISTS (SELECT 1 FROM parcel_order_item WHERE order_id = parcel_order.id)`},
+		{"orders", "UPDATE parcel_order SET client = 0 WHERE client = :client"},
+		{"API keys", "UPDATE api_key SET revoked_at = :now WHERE client = :client AND revoked_at = ''"},
+	}
+	now := FormatTimestamp(time.Now(), DefaultTimestampPrecision)
+	for _, q := range queries {
+		if _, err := s.conn().Exec(q.query, sql.Named("client", client), sql.Named("now", now)); err != nil {
+			return fmt.Errorf("failed to erase %s of client %d: %w", q.what, pii(client), err)
+		}
+	}
+	return nil
+}
+
+// ListClientErasures returns the erasures of the data of client, oldest
+// first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if the data of the client was never erased.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) ListClientErasures(client int) ([]ClientErasure, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, deleted, anonymised, retention, erased_at FROM client_erasure
+WHERE client = :client ORDER BY id`
+	rows, err := s.conn().Query(query, sql.Named("client", client))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for erasures of client %d: %w", pii(client), err)
+	}
+	defer rows.Close()
+
+	res := []ClientErasure{}
+	for rows.Next() {
+		e := ClientErasure{Client: client}
+		var retention string
+		if err := rows.Scan(&e.ID, &e.Deleted, &e.Anonymised, &retention, &e.ErasedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan one of erasure rows of client %d: %w", pii(client), err)
+		}
+		if e.Retention, err = time.ParseDuration(retention); err != nil {
+			return nil, fmt.Errorf("failed to parse retention of erasure %d: %w", e.ID, err)
+		}
+		res = append(res, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate erasure rows of client %d: %w", pii(client), err)
+	}
+	return res, nil
+}
+
+// countInTransit returns how many parcels of client are sent but not yet
+// delivered.
+func (s ParcelStore) countInTransit(client int) (int, error) {
+	var n int
+	query := "SELECT COUNT(*) FROM parcel WHERE client = :client AND status NOT IN (:registered, :delivered)"
+	err := s.conn().QueryRow(query, sql.Named("client", client),
+		sql.Named("registered", ParcelStatusRegistered), sql.Named("delivered", ParcelStatusDelivered)).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count parcels in transit of client %d: %w", pii(client), err)
+	}
+	return n, nil
+}
+
+// EraseClientData honours a request of the client to erase its data:
+// parcels within the retention period of the service (see
+// WithRetention) are kept anonymised, the others deleted, and a
+// tombstone is recorded; see ParcelStore.EraseClient.
+//
+// Behaviour:
+//   - Returns ErrInvalidErasure (wrapped) for a client number below 1.
+//   - Returns ErrParcelsInTransit (wrapped) while parcels of the client
+//     are sent but not delivered, as erasing their address would stop
+//     the delivery; nothing is erased then.
+//   - Does not publish events.
+func (s ParcelService) EraseClientData(client int) (ClientErasure, error) {
+	if client < 1 {
+		return ClientErasure{}, fmt.Errorf("failed to erase data of client %d: %w: client must be positive",
+			pii(client), ErrInvalidErasure)
+	}
+
+	var erasure ClientErasure
+	err := s.store.InTx(func(tx ParcelStore) error {
+		n, err := tx.countInTransit(client)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("failed to erase data of client %d: %w (%d parcels)", pii(client), ErrParcelsInTransit, n)
+		}
+		erasure, err = tx.EraseClient(client, time.Now().Add(-s.retention.Keep), s.retention.Keep)
+		return err
+	})
+	return erasure, err
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEraseClientData verifies that parcels past the retention period are
+// deleted with their data, recent ones anonymised, other clients left
+// alone, and a tombstone recorded.
+func TestEraseClientData(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	service = service.WithRetention(RetentionPolicy{Keep: 24 * time.Hour})
+	store := service.store
+
+	old := getTestParcel()
+	old.Status = ParcelStatusDelivered
+	old.CreatedAt = FormatTimestamp(time.Now().Add(-48*time.Hour), DefaultTimestampPrecision)
+	oldID, err := store.Add(old)
+	require.NoError(t, err)
+	_, err = service.AddComment(oldID, "support", "called the client")
+	require.NoError(t, err)
+
+	recent, err := service.RegisterParcel(Parcel{Client: 1000, Address: "Main street 1", Payment: PaymentPaid,
+		Recipient: Recipient{Name: "Ivan Petrov", Phone: "+79991234567"}})
+	require.NoError(t, err)
+	require.NoError(t, service.NextStatus(recent.Number))
+	require.NoError(t, service.DeliverWithProof(recent.Number, Proof{Kind: ProofSignature, Data: getTestSignature(t)}))
+	_, err = service.AddComment(recent.Number, "courier", "left with the neighbour")
+	require.NoError(t, err)
+
+	other, err := service.RegisterParcel(Parcel{Client: 2000, Address: "Main street 2", Payment: PaymentPaid})
+	require.NoError(t, err)
+	require.NoError(t, store.SetNotificationPreference(NotificationPreference{Client: 1000, Channel: "email",
+		Recipient: "ivan@example.com", Enabled: true}))
+	key, _, err := store.IssueAPIKey("ivan", Principal{Role: RoleClient, Client: 1000})
+	require.NoError(t, err)
+
+	// erase
+	erasure, err := service.EraseClientData(1000)
+	require.NoError(t, err)
+
+	// check
+	assert.Equal(t, 1, erasure.Deleted)
+	assert.Equal(t, 1, erasure.Anonymised)
+	erasures, err := store.ListClientErasures(1000)
+	require.NoError(t, err)
+	assert.Equal(t, []ClientErasure{erasure}, erasures)
+
+	_, err = store.Get(oldID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	history, err := store.GetHistory(oldID)
+	require.NoError(t, err)
+	assert.Empty(t, history)
+	comments, err := store.ListComments(oldID)
+	require.NoError(t, err)
+	assert.Empty(t, comments)
+
+	kept, err := store.Get(recent.Number)
+	require.NoError(t, err)
+	assert.Equal(t, 0, kept.Client)
+	assert.Empty(t, kept.Address)
+	assert.True(t, kept.Recipient.IsZero())
+	assert.Empty(t, kept.TrackingCode)
+	assert.Equal(t, ParcelStatusDelivered, kept.Status)
+	assert.Equal(t, recent.Price, kept.Price)
+	history, err = store.GetHistory(recent.Number)
+	require.NoError(t, err)
+	assert.Len(t, history, 3)
+	comments, err = store.ListComments(recent.Number)
+	require.NoError(t, err)
+	assert.Empty(t, comments)
+	_, err = service.Proof(recent.Number)
+	assert.ErrorIs(t, err, ErrNoProof)
+	found, err := service.Search("Main", 10)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, other.Number, found[0].Number)
+
+	parcels, err := store.GetByClient(1000)
+	require.NoError(t, err)
+	assert.Empty(t, parcels)
+	prefs, err := store.GetNotificationPreferences(1000)
+	require.NoError(t, err)
+	assert.Empty(t, prefs)
+	revoked, err := store.getAPIKey(key.ID)
+	require.NoError(t, err)
+	assert.NotEmpty(t, revoked.RevokedAt)
+	_, err = store.Get(other.Number)
+	assert.NoError(t, err)
+}
+
+// TestEraseClientDataArchived verifies that archived parcels are erased
+// under the same retention as live ones.
+func TestEraseClientDataArchived(t *testing.T) {
+	// prepare
+	store := NewParcelStore(getTestDB(t))
+	service := NewParcelService(store, nil).WithRetention(RetentionPolicy{Keep: 24 * time.Hour})
+	old := getTestParcel()
+	old.Status = ParcelStatusDelivered
+	old.CreatedAt = FormatTimestamp(time.Now().Add(-72*time.Hour), DefaultTimestampPrecision)
+	oldID, err := store.Add(old)
+	require.NoError(t, err)
+	recent := getTestParcel()
+	recent.Status = ParcelStatusDelivered
+	recent.CreatedAt = FormatTimestamp(time.Now().Add(-time.Hour), DefaultTimestampPrecision)
+	recentID, err := store.Add(recent)
+	require.NoError(t, err)
+	moved, err := store.Archive(0)
+	require.NoError(t, err)
+	require.Equal(t, 2, moved)
+
+	// erase
+	erasure, err := service.EraseClientData(1000)
+	require.NoError(t, err)
+
+	// check
+	assert.Equal(t, 1, erasure.Deleted)
+	assert.Equal(t, 1, erasure.Anonymised)
+	_, err = store.GetArchived(oldID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	archived, err := store.GetArchived(recentID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, archived.Client)
+	assert.Empty(t, archived.Address)
+	assert.Equal(t, recent.CreatedAt, archived.CreatedAt)
+}
+
+// TestEraseClientDataRejected ensures that invalid clients and clients
+// with parcels in transit are refused without erasing anything.
+func TestEraseClientDataRejected(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	number := getSentParcel(t, service)
+
+	// check
+	_, err := service.EraseClientData(0)
+	assert.ErrorIs(t, err, ErrInvalidErasure)
+	_, err = service.EraseClientData(1000)
+	assert.ErrorIs(t, err, ErrParcelsInTransit)
+	assert.Equal(t, CodeParcelsInTransit, ErrorCodeOf(err))
+
+	parcel, err := service.store.Get(number)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, parcel.Client)
+	erasures, err := service.store.ListClientErasures(1000)
+	require.NoError(t, err)
+	assert.Empty(t, erasures)
+}
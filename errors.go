@@ -0,0 +1,129 @@
+package main
+
+import "errors"
+
+// ErrorCode is the machine-readable kind of an error, for API consumers
+// that cannot use errors.Is. Unlike error messages, codes never change.
+type ErrorCode string
+
+// Codes of the errors a caller of the API can get. Each identifies one
+// sentinel error, except the generic codes at the end, which the HTTP API
+// uses for errors that have no code of their own.
+const (
+	CodeParcelNotFound         ErrorCode = "PARCEL_NOT_FOUND"
+	CodeRouteNotFound          ErrorCode = "ROUTE_NOT_FOUND"
+	CodeOrderNotFound          ErrorCode = "ORDER_NOT_FOUND"
+	CodeClaimNotFound          ErrorCode = "CLAIM_NOT_FOUND"
+	CodeRestrictionNotFound    ErrorCode = "RESTRICTION_NOT_FOUND"
+	CodePickupPointNotFound    ErrorCode = "PICKUP_POINT_NOT_FOUND"
+	CodeWarehouseNotFound      ErrorCode = "WAREHOUSE_NOT_FOUND"
+	CodeLocationUnknown        ErrorCode = "LOCATION_UNKNOWN"
+	CodeNoProof                ErrorCode = "PROOF_NOT_FOUND"
+	CodeWorkItemNotFound       ErrorCode = "WORK_ITEM_NOT_FOUND"
+	CodeSavedAddressNotFound   ErrorCode = "SAVED_ADDRESS_NOT_FOUND"
+	CodeParcelTemplateNotFound ErrorCode = "PARCEL_TEMPLATE_NOT_FOUND"
+	CodeDraftNotFound          ErrorCode = "DRAFT_NOT_FOUND"
+
+	CodeInvalidAPIKey ErrorCode = "INVALID_API_KEY"
+	CodeForbidden     ErrorCode = "FORBIDDEN"
+
+	CodeRequiresRegistered   ErrorCode = "REQUIRES_REGISTERED"
+	CodeRequiresPaid         ErrorCode = "REQUIRES_PAID"
+	CodeRequiresSent         ErrorCode = "REQUIRES_SENT"
+	CodeInvalidTransition    ErrorCode = "INVALID_TRANSITION"
+	CodePaymentTransition    ErrorCode = "INVALID_PAYMENT_TRANSITION"
+	CodeClaimTransition      ErrorCode = "INVALID_CLAIM_TRANSITION"
+	CodeWorkItemTransition   ErrorCode = "INVALID_WORK_ITEM_TRANSITION"
+	CodeDuplicateParcel      ErrorCode = "DUPLICATE_PARCEL"
+	CodeParcelOnRoute        ErrorCode = "PARCEL_ON_ROUTE"
+	CodeParcelInOrder        ErrorCode = "PARCEL_IN_ORDER"
+	CodeCurrencyMismatch     ErrorCode = "CURRENCY_MISMATCH"
+	CodeBrokenReference      ErrorCode = "BROKEN_REFERENCE"
+	CodeParcelsInTransit     ErrorCode = "PARCELS_IN_TRANSIT"
+	CodePickupPointFull      ErrorCode = "PICKUP_POINT_FULL"
+	CodeRepacked             ErrorCode = "PARCEL_REPACKED"
+	CodeParcelHeld           ErrorCode = "PARCEL_HELD"
+	CodeNotHeld              ErrorCode = "PARCEL_NOT_HELD"
+	CodeCustomsDeclaration   ErrorCode = "CUSTOMS_DECLARATION_REQUIRED"
+	CodeDeliveryCodeRequired ErrorCode = "DELIVERY_CODE_REQUIRED"
+	CodeDeliveryCodeLocked   ErrorCode = "DELIVERY_CODE_LOCKED"
+	CodeWrongDeliveryCode    ErrorCode = "WRONG_DELIVERY_CODE"
+	CodeNoDeliveryCode       ErrorCode = "DELIVERY_CODE_NOT_FOUND"
+	CodeDeliverySlotFull     ErrorCode = "DELIVERY_SLOT_FULL"
+	CodeNoTariff             ErrorCode = "NO_TARIFF"
+	CodeRestrictedContents   ErrorCode = "RESTRICTED_CONTENTS"
+	CodeSearchUnavailable    ErrorCode = "SEARCH_UNAVAILABLE"
+	CodeQueryTimeout         ErrorCode = "QUERY_TIMEOUT"
+	CodeUnknownStatus        ErrorCode = "UNKNOWN_STATUS"
+	CodeUnknownServiceClass  ErrorCode = "UNKNOWN_SERVICE_CLASS"
+	CodeUnknownPayment       ErrorCode = "UNKNOWN_PAYMENT_STATUS"
+	CodeUnknownContent       ErrorCode = "UNKNOWN_CONTENT_CATEGORY"
+	CodeUnknownScanType      ErrorCode = "UNKNOWN_SCAN_TYPE"
+
+	CodeInvalidAttribute      ErrorCode = "INVALID_ATTRIBUTE"
+	CodeInvalidLabel          ErrorCode = "INVALID_LABEL"
+	CodeInvalidTrackingCode   ErrorCode = "INVALID_TRACKING_CODE"
+	CodeInvalidParcel         ErrorCode = "INVALID_PARCEL"
+	CodeInvalidRecipient      ErrorCode = "INVALID_RECIPIENT"
+	CodeInvalidAddress        ErrorCode = "INVALID_ADDRESS"
+	CodeInvalidCoordinates    ErrorCode = "INVALID_COORDINATES"
+	CodeInvalidFilter         ErrorCode = "INVALID_FILTER"
+	CodeInvalidTariff         ErrorCode = "INVALID_TARIFF"
+	CodeInvalidRoute          ErrorCode = "INVALID_ROUTE"
+	CodeInvalidOrder          ErrorCode = "INVALID_ORDER"
+	CodeInvalidClaim          ErrorCode = "INVALID_CLAIM"
+	CodeInvalidPickupPoint    ErrorCode = "INVALID_PICKUP_POINT"
+	CodeInvalidWarehouse      ErrorCode = "INVALID_WAREHOUSE"
+	CodeInvalidLocation       ErrorCode = "INVALID_LOCATION"
+	CodeEmptySearch           ErrorCode = "EMPTY_SEARCH"
+	CodeInvalidComment        ErrorCode = "INVALID_COMMENT"
+	CodeInvalidProof          ErrorCode = "INVALID_PROOF"
+	CodeInvalidOverride       ErrorCode = "INVALID_OVERRIDE"
+	CodeInvalidRepack         ErrorCode = "INVALID_REPACK"
+	CodeInvalidCustoms        ErrorCode = "INVALID_CUSTOMS"
+	CodeInvalidErasure        ErrorCode = "INVALID_ERASURE"
+	CodeInvalidSync           ErrorCode = "INVALID_SYNC"
+	CodeInvalidDeliveryWindow ErrorCode = "INVALID_DELIVERY_WINDOW"
+	CodeInvalidHold           ErrorCode = "INVALID_HOLD"
+	CodeInvalidPublicID       ErrorCode = "INVALID_PUBLIC_ID"
+	CodeInvalidWorkItem       ErrorCode = "INVALID_WORK_ITEM"
+	CodeInvalidSavedAddress   ErrorCode = "INVALID_SAVED_ADDRESS"
+	CodeInvalidEmail          ErrorCode = "INVALID_EMAIL"
+	CodeInvalidParcelTemplate ErrorCode = "INVALID_PARCEL_TEMPLATE"
+	CodeInvalidDraft          ErrorCode = "INVALID_DRAFT"
+	CodeInvalidCurrency       ErrorCode = "INVALID_CURRENCY"
+
+	CodeInvalidRequest   ErrorCode = "INVALID_REQUEST"
+	CodeNotFound         ErrorCode = "NOT_FOUND"
+	CodeMethodNotAllowed ErrorCode = "METHOD_NOT_ALLOWED"
+	CodeRateLimited      ErrorCode = "RATE_LIMITED"
+	CodeInternal         ErrorCode = "INTERNAL"
+)
+
+// Error is a sentinel error with an ErrorCode. The sentinels a caller of
+// the API can get, such as ErrParcelNotFound, are *Error values: errors.Is
+// works on them as on any sentinel, and ErrorCodeOf recovers the code of
+// an error wrapping one.
+type Error struct {
+	Code    ErrorCode
+	message string
+}
+
+// newError returns a sentinel error with code and message.
+func newError(code ErrorCode, message string) *Error {
+	return &Error{Code: code, message: message}
+}
+
+func (e *Error) Error() string {
+	return e.message
+}
+
+// ErrorCodeOf returns the code of the first *Error in the chain of err,
+// or an empty code if there is none.
+func ErrorCodeOf(err error) ErrorCode {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
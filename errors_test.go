@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestErrorCodeOf verifies that the code of a sentinel survives wrapping
+// and that errors.Is still matches it.
+func TestErrorCodeOf(t *testing.T) {
+	// check
+	err := fmt.Errorf("failed to get parcel 42: %w", ErrParcelNotFound)
+	assert.Equal(t, CodeParcelNotFound, ErrorCodeOf(err))
+	assert.ErrorIs(t, err, ErrParcelNotFound)
+	assert.Equal(t, "failed to get parcel 42: parcel not found", err.Error())
+
+	err = fmt.Errorf("failed to register parcel: %w: %w", ErrInvalidCustoms, errors.New("country missing"))
+	assert.Equal(t, CodeInvalidCustoms, ErrorCodeOf(err))
+
+	assert.Equal(t, ErrorCode(""), ErrorCodeOf(errors.New("disk full")))
+	assert.Equal(t, ErrorCode(""), ErrorCodeOf(nil))
+}
+
+// TestErrorCodesHTTP verifies that error responses carry the code of the
+// error, or a generic one, and that GraphQL errors carry it as an
+// extension.
+func TestErrorCodesHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service)
+	number := getSentParcel(t, service)
+
+	// check
+	for _, tc := range []struct {
+		method, target, body string
+		status               int
+		code                 ErrorCode
+	}{
+		{http.MethodGet, "/parcels/999999", "", http.StatusNotFound, CodeParcelNotFound},
+		{http.MethodDelete, fmt.Sprintf("/parcels/%d", number), "", http.StatusConflict, CodeRequiresRegistered},
+		{http.MethodPut, fmt.Sprintf("/parcels/%d/payment", number), `{"status": "gift"}`,
+			http.StatusBadRequest, CodeUnknownPayment},
+		{http.MethodPost, "/parcels", `{"client": "one"}`, http.StatusBadRequest, CodeInvalidRequest},
+		{http.MethodPatch, "/parcels", "", http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+		{http.MethodGet, "/track/PKG-2024-000001-0", "", http.StatusNotFound, CodeNotFound},
+	} {
+		rec := doRequest(t, h, tc.method, tc.target, tc.body)
+		require.Equal(t, tc.status, rec.Code, tc)
+		var res errorJSON
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		assert.Equal(t, tc.code, res.Code, tc)
+		assert.NotEmpty(t, res.Error)
+	}
+
+	code, res := doGraphQL(t, h, `mutation { setStatus(number: 999999, status: "sent") { status } }`, nil)
+	require.Equal(t, http.StatusOK, code)
+	errs := res["errors"].([]any)
+	require.Len(t, errs, 1)
+	assert.Equal(t, map[string]any{"code": string(CodeParcelNotFound)}, errs[0].(map[string]any)["extensions"])
+}
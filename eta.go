@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ETAPolicy defines how the estimated delivery time of a parcel is
+// computed at registration and moved when the parcel is late.
+//
+// A parcel is expected to take as long as the parcels of its service
+// class and zone delivered within Lookback took on average, from
+// registration to delivery. Until at least MinSamples of them have been
+// delivered, it is expected to take the Transit of its class instead.
+// Zones are those of the destination (see WithPricing); parcels without
+// a zone are compared with each other.
+type ETAPolicy struct {
+	// Transit is the assumed time to delivery of each service class;
+	// classes it lacks, or with a zero duration, get no estimate until
+	// enough parcels have been delivered.
+	Transit    map[string]time.Duration
+	MinSamples int
+	Lookback   time.Duration
+	// Slip is how far SlipETAs moves an estimate that has passed, from the
+	// time it runs.
+	Slip time.Duration
+	// EscalateAfter is how many estimates a parcel may miss before
+	// DetectDelays escalates it to the ops queue; 0 never escalates.
+	EscalateAfter int
+}
+
+// DefaultETAPolicy returns a policy that assumes a day for express, three
+// for standard and six for economy until 20 parcels of the class and zone
+// were delivered in the last 90 days, moves estimates that passed a day
+// on and escalates parcels that missed three.
+func DefaultETAPolicy() ETAPolicy {
+	return ETAPolicy{
+		Transit: map[string]time.Duration{
+			ServiceExpress:  24 * time.Hour,
+			ServiceStandard: 3 * 24 * time.Hour,
+			ServiceEconomy:  6 * 24 * time.Hour,
+		},
+		MinSamples:    20,
+		Lookback:      90 * 24 * time.Hour,
+		Slip:          24 * time.Hour,
+		EscalateAfter: 3,
+	}
+}
+
+// TransitTime returns the average time from registration to delivery of
+// the parcels of the service class and zone delivered since, and how many
+// there were.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns 0 and 0 if there were none.
+//   - Archived parcels are not counted.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) TransitTime(class, zone string, since time.Time) (time.Duration, int, error) {
+	if err := s.check(); err != nil {
+		return 0, 0, err
+	}
+
+	query, args := selectFrom("parcel",
+		"COUNT(*), COALESCE(AVG((julianday(delivered_at) - julianday(created_at)) * 86400), 0)").
+		Where("service_class = ?", class).Where("zone = ?", zone).
+		Where("delivered_at >= ?", FormatTimestamp(since, DefaultTimestampPrecision)).build()
+	var n int
+	var seconds float64
+	if err := s.conn().QueryRow(query, args...).Scan(&n, &seconds); err != nil {
+		return 0, 0, fmt.Errorf("failed to scan transit time of %s parcels to zone %q: %w", class, zone, err)
+	}
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second), n, nil
+}
+
+// setETA sets the estimated delivery time of the parcel.
+func (s ParcelStore) setETA(number int, at string) error {
+	s.invalidateParcel(number)
+	query := "UPDATE parcel SET estimated_delivery_at = :at WHERE number = :number"
+	if _, err := s.conn().Exec(query, sql.Named("at", at), sql.Named("number", number)); err != nil {
+		return fmt.Errorf("failed to set estimated delivery time of parcel %d: %w", number, err)
+	}
+	return nil
+}
+
+// SlipETAs moves the estimated delivery time of every parcel that is not
+// delivered by it to now plus slip, counting the delay (see
+// Parcel.Delays), and returns those parcels as they were before.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Parcels without an estimate are left alone.
+//   - Runs in one transaction; wraps and returns any SQL error.
+func (s ParcelStore) SlipETAs(now time.Time, slip time.Duration) ([]Parcel, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	var late []Parcel
+	err := s.InTx(func(tx ParcelStore) error {
+		query, args := selectFrom("parcel", parcelColumns).Where("estimated_delivery_at != ''").
+			Where("estimated_delivery_at < ?", FormatTimestamp(now, DefaultTimestampPrecision)).
+			Where("status != ?", ParcelStatusDelivered).OrderBy("estimated_delivery_at", "seq").build()
+		var err error
+		if late, err = tx.queryParcels("late parcels", query, args...); err != nil {
+			return err
+		}
+		at := FormatTimestamp(now.Add(slip), DefaultTimestampPrecision)
+		for _, p := range late {
+			tx.invalidateParcel(p.Number)
+			query := "UPDATE parcel SET estimated_delivery_at = :at, delays = delays + 1 WHERE number = :number"
+			if _, err := tx.conn().Exec(query, sql.Named("at", at), sql.Named("number", p.Number)); err != nil {
+				return fmt.Errorf("failed to delay parcel %d: %w", p.Number, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return late, nil
+}
+
+// WithETA returns a copy of the service that estimates delivery times
+// according to policy.
+func (s ParcelService) WithETA(policy ETAPolicy) ParcelService {
+	s.eta = policy
+	return s
+}
+
+// estimateDelivery returns the estimated delivery time of parcel, which
+// is registered at now, or "" if the policy gives none.
+func (s ParcelService) estimateDelivery(tx ParcelStore, parcel Parcel, now time.Time) (string, error) {
+	transit := s.eta.Transit[parcel.ServiceClass]
+	if s.eta.MinSamples > 0 {
+		avg, n, err := tx.TransitTime(parcel.ServiceClass, parcel.Zone, now.Add(-s.eta.Lookback))
+		if err != nil {
+			return "", err
+		}
+		if n >= s.eta.MinSamples {
+			transit = avg
+		}
+	}
+	if transit <= 0 {
+		return "", nil
+	}
+	return FormatTimestamp(now.Add(transit), DefaultTimestampPrecision), nil
+}
+
+// delayETA moves the estimated delivery time of parcel, which was on hold
+// until now, by the time it was held.
+func (s ParcelService) delayETA(tx ParcelStore, parcel Parcel, now time.Time) error {
+	eta, errETA := time.Parse(time.RFC3339, parcel.EstimatedDeliveryAt)
+	held, errHeld := time.Parse(time.RFC3339, parcel.Hold.PlacedAt)
+	if errETA != nil || errHeld != nil || !now.After(held) {
+		return nil
+	}
+	return tx.setETA(parcel.Number, FormatTimestamp(eta.Add(now.Sub(held)), DefaultTimestampPrecision))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parseTestTimestamp parses an RFC 3339 timestamp of a test parcel.
+func parseTestTimestamp(t *testing.T, s string) time.Time {
+	t.Helper()
+	at, err := time.Parse(time.RFC3339, s)
+	require.NoError(t, err)
+	return at
+}
+
+// TestEstimateDelivery verifies that registration estimates the delivery
+// time from the service class until enough parcels were delivered, and
+// from their average afterwards.
+func TestEstimateDelivery(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	service = service.WithETA(ETAPolicy{Transit: map[string]time.Duration{ServiceStandard: 72 * time.Hour},
+		MinSamples: 2, Lookback: 30 * 24 * time.Hour})
+
+	// check
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test"})
+	require.NoError(t, err)
+	created := parcel.CreatedAt
+	assert.Equal(t, 72*time.Hour, parseTestTimestamp(t, parcel.EstimatedDeliveryAt).Sub(parseTestTimestamp(t, created)))
+
+	express, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", ServiceClass: ServiceExpress})
+	require.NoError(t, err)
+	assert.Empty(t, express.EstimatedDeliveryAt)
+
+	for _, took := range []time.Duration{20 * time.Hour, 28 * time.Hour} {
+		p := getTestParcel()
+		p.ServiceClass, p.Status = ServiceStandard, ParcelStatusDelivered
+		p.CreatedAt = FormatTimestamp(time.Now().Add(-48*time.Hour), DefaultTimestampPrecision)
+		p.DeliveredAt = FormatTimestamp(time.Now().Add(-48*time.Hour+took), DefaultTimestampPrecision)
+		_, err := service.store.Add(p)
+		require.NoError(t, err)
+	}
+	avg, n, err := service.store.TransitTime(ServiceStandard, "", time.Now().Add(-72*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 24*time.Hour, avg)
+
+	parcel, err = service.RegisterParcel(Parcel{Client: 1000, Address: "test"})
+	require.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, parseTestTimestamp(t, parcel.EstimatedDeliveryAt).Sub(parseTestTimestamp(t, parcel.CreatedAt)))
+
+	view, err := service.store.GetTrackingView(parcel.TrackingCode)
+	require.NoError(t, err)
+	assert.Equal(t, parcel.EstimatedDeliveryAt, view.EstimatedDeliveryAt)
+}
+
+// TestSlipETAs verifies that only the estimates of late parcels move.
+func TestSlipETAs(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	now := time.Now()
+	add := func(status string, eta time.Time) int {
+		p := getTestParcel()
+		p.Status = status
+		p.EstimatedDeliveryAt = FormatTimestamp(eta, DefaultTimestampPrecision)
+		number, err := store.Add(p)
+		require.NoError(t, err)
+		return number
+	}
+	late := add(ParcelStatusSent, now.Add(-time.Hour))
+	onTime := add(ParcelStatusSent, now.Add(time.Hour))
+	delivered := add(ParcelStatusDelivered, now.Add(-time.Hour))
+
+	// slip
+	slipped, err := store.SlipETAs(now, 24*time.Hour)
+	require.NoError(t, err)
+
+	// check
+	require.Len(t, slipped, 1)
+	assert.Equal(t, late, slipped[0].Number)
+	p, err := store.Get(late)
+	require.NoError(t, err)
+	assert.Equal(t, FormatTimestamp(now.Add(24*time.Hour), DefaultTimestampPrecision), p.EstimatedDeliveryAt)
+	for _, number := range []int{onTime, delivered} {
+		p, err := store.Get(number)
+		require.NoError(t, err)
+		assert.NotEqual(t, FormatTimestamp(now.Add(24*time.Hour), DefaultTimestampPrecision), p.EstimatedDeliveryAt)
+	}
+}
+
+// TestReleaseDelaysETA verifies that releasing a parcel moves its
+// estimate by the time it was held.
+func TestReleaseDelaysETA(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	parcel, err := service.Register(1000, "test")
+	require.NoError(t, err)
+	require.NotEmpty(t, parcel.EstimatedDeliveryAt)
+	require.NoError(t, service.store.SetHold(parcel.Number, Hold{Kind: HoldCustomer, Reason: "on holiday",
+		Actor: "alice", PlacedAt: FormatTimestamp(time.Now().Add(-48*time.Hour), DefaultTimestampPrecision)}))
+
+	// release
+	require.NoError(t, service.Release(parcel.Number))
+
+	// check
+	released, err := service.Get(parcel.Number)
+	require.NoError(t, err)
+	delay := parseTestTimestamp(t, released.EstimatedDeliveryAt).Sub(parseTestTimestamp(t, parcel.EstimatedDeliveryAt))
+	assert.InDelta(t, float64(48*time.Hour), float64(delay), float64(time.Minute))
+}
@@ -0,0 +1,99 @@
+package main
+
+import "sync"
+
+// EventType identifies what happened to a parcel.
+type EventType string
+
+const (
+	EventParcelRegistered EventType = "parcel.registered"
+	EventStatusChanged    EventType = "parcel.status_changed"
+	EventAddressChanged   EventType = "parcel.address_changed"
+	EventParcelDeleted    EventType = "parcel.deleted"
+	EventSLABreached      EventType = "parcel.sla_breached"
+	EventPaymentChanged   EventType = "parcel.payment_changed"
+	EventParcelDelayed    EventType = "parcel.delayed"
+)
+
+// Event is published by ParcelService after a change has been committed.
+type Event struct {
+	Type EventType
+	// Parcel is the state after the change; for EventParcelDeleted it is
+	// the last known state.
+	Parcel Parcel
+	// PrevStatus is set for EventStatusChanged.
+	PrevStatus string
+	// PrevAddress is set for EventAddressChanged.
+	PrevAddress string
+	// PrevPayment is set for EventPaymentChanged.
+	PrevPayment string
+	// MissedETA is set for EventParcelDelayed: the estimated delivery time
+	// the parcel missed; Parcel has the new one.
+	MissedETA string
+	// DeliveryCode is set for EventStatusChanged to sent when the service
+	// issues delivery codes (see WithDeliveryCodes): the code to pass on to
+	// the recipient, published only this once.
+	DeliveryCode string
+	// At is the RFC 3339 time of the change.
+	At string
+}
+
+// EventBus is an in-process publish/subscribe hub for parcel events.
+//
+// Handlers run synchronously on the publishing goroutine, in
+// subscription order, so they should return quickly and hand off slow
+// work (network calls, retries) to their own goroutines or queues.
+// A nil *EventBus is valid and discards every event.
+type EventBus struct {
+	mu       sync.RWMutex
+	nextID   int
+	handlers map[int]func(Event)
+	order    []int
+}
+
+// NewEventBus returns an empty EventBus.
+func NewEventBus() *EventBus {
+	return &EventBus{handlers: make(map[int]func(Event))}
+}
+
+// Subscribe registers h for every published event and returns a function
+// that removes the subscription.
+func (b *EventBus) Subscribe(h func(Event)) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	b.handlers[id] = h
+	b.order = append(b.order, id)
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+		for i, v := range b.order {
+			if v == id {
+				b.order = append(b.order[:i], b.order[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Publish delivers e to every current subscriber.
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	handlers := make([]func(Event), 0, len(b.order))
+	for _, id := range b.order {
+		handlers = append(handlers, b.handlers[id])
+	}
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		h(e)
+	}
+}
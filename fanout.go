@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync"
+)
+
+// DefaultFanOutLimit bounds the number of concurrent queries issued by
+// fanOut when the caller does not choose a limit.
+const DefaultFanOutLimit = 4
+
+// fanOut calls fn for every index in [0, n) with at most limit calls in
+// flight and concatenates the results in index order, so callers merging
+// per-shard or per-partition results get a deterministic order regardless
+// of completion order.
+//
+// After the first error no further calls are started; calls already in
+// flight finish, and the error of the lowest failing index is returned.
+// A limit below one uses DefaultFanOutLimit.
+func fanOut[T any](n, limit int, fn func(i int) ([]T, error)) ([]T, error) {
+	if limit < 1 {
+		limit = DefaultFanOutLimit
+	}
+
+	results := make([][]T, n)
+	errs := make([]error, n)
+	sem := make(chan struct{}, limit)
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed bool
+	)
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+
+		mu.Lock()
+		stop := failed
+		mu.Unlock()
+		if stop {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			res, err := fn(i)
+			if err != nil {
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+			results[i], errs[i] = res, err
+		}(i)
+	}
+	wg.Wait()
+
+	var merged []T
+	for i := range results {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		merged = append(merged, results[i]...)
+	}
+	return merged, nil
+}
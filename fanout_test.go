@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFanOutMergesInOrder verifies that results keep index order and that
+// no more than limit calls run at once.
+func TestFanOutMergesInOrder(t *testing.T) {
+	var inFlight, peak int32
+
+	res, err := fanOut(8, 3, func(i int) ([]int, error) {
+		cur := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if cur <= old || atomic.CompareAndSwapInt32(&peak, old, cur) {
+				break
+			}
+		}
+
+		// later indexes finish first
+		time.Sleep(time.Duration(8-i) * time.Millisecond)
+		return []int{i * 10, i*10 + 1}, nil
+	})
+	require.NoError(t, err)
+
+	require.Len(t, res, 16)
+	for i := 0; i < 8; i++ {
+		assert.Equal(t, i*10, res[2*i])
+	}
+	assert.LessOrEqual(t, peak, int32(3))
+}
+
+// TestFanOutStopsOnError ensures that an error is reported and that no new
+// calls start after it.
+func TestFanOutStopsOnError(t *testing.T) {
+	errShard := errors.New("shard unavailable")
+	var calls int32
+
+	_, err := fanOut(100, 1, func(i int) ([]int, error) {
+		atomic.AddInt32(&calls, 1)
+		if i == 2 {
+			return nil, errShard
+		}
+		return []int{i}, nil
+	})
+	require.ErrorIs(t, err, errShard)
+	assert.Less(t, calls, int32(100))
+}
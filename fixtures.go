@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// fixtureCities, fixtureStreets and fixtureNames are what fabricated
+// addresses and recipients are made of.
+var (
+	fixtureCities  = []string{"Москва", "Санкт-Петербург", "Казань", "Новосибирск", "Екатеринбург", "Псков", "Саратов"}
+	fixtureStreets = []string{"ул. Ленина", "ул. Пушкина", "Невский пр.", "ул. Баумана", "ул. Козлова", "ул. Мира"}
+	fixtureNames   = []string{"Иван Петров", "Анна Смирнова", "Олег Кузнецов", "Мария Иванова", "Сергей Попов"}
+	// fixtureCountries are the destinations of international parcels.
+	fixtureCountries = []string{"DE", "GB", "KZ", "FR", "TR"}
+)
+
+// Fixtures fabricates realistic parcels for integration tests and demo
+// environments: spread over clients and over months, with addresses,
+// recipients and measurements, and advanced along valid lifecycles the
+// further the older they are. The same seed fabricates the same parcels.
+type Fixtures struct {
+	rnd *rand.Rand
+	// Clients are numbered from 1.
+	Clients int
+	// From and To bound the creation times; parcels do not move past To.
+	From, To time.Time
+	// International is the share of parcels sent abroad, from 0 to 1.
+	International float64
+}
+
+// NewFixtures returns fixtures for 50 clients registering parcels over
+// the six months before now, one in ten abroad.
+func NewFixtures(seed int64, now time.Time) *Fixtures {
+	return &Fixtures{
+		rnd:           rand.New(rand.NewSource(seed)),
+		Clients:       50,
+		From:          now.AddDate(0, -6, 0),
+		To:            now,
+		International: 0.1,
+	}
+}
+
+// Parcel fabricates a parcel and its status history, oldest entry first.
+// The parcel is in the status of the last entry and, unless registered,
+// paid; it has no number yet.
+func (f *Fixtures) Parcel() (Parcel, []StatusChange) {
+	pick := func(list []string) string { return list[f.rnd.Intn(len(list))] }
+
+	created := f.From.Add(time.Duration(f.rnd.Int63n(int64(f.To.Sub(f.From)) + 1)))
+	p := Parcel{
+		Client:  1 + f.rnd.Intn(max(f.Clients, 1)),
+		Status:  ParcelStatusRegistered,
+		Address: fmt.Sprintf("%s, %s, д. %d", pick(fixtureCities), pick(fixtureStreets), 1+f.rnd.Intn(120)),
+		Recipient: Recipient{
+			Name:  pick(fixtureNames),
+			Phone: fmt.Sprintf("+7916%07d", f.rnd.Intn(10_000_000)),
+		},
+		ServiceClass:  serviceClasses[f.rnd.Intn(len(serviceClasses))],
+		WeightGrams:   100 + f.rnd.Intn(20_000),
+		Dimensions:    Dimensions{LengthMM: 100 + f.rnd.Intn(500), WidthMM: 100 + f.rnd.Intn(400), HeightMM: 50 + f.rnd.Intn(300)},
+		DeclaredValue: 100 * f.rnd.Intn(50_000),
+		Payment:       PaymentUnpaid,
+		CreatedAt:     FormatTimestamp(created, DefaultTimestampPrecision),
+	}
+	if f.rnd.Float64() < f.International {
+		p.International = true
+		p.Country = pick(fixtureCountries)
+		p.CustomsReference = fmt.Sprintf("DECL-%08d", f.rnd.Intn(100_000_000))
+		p.HSCodes = []string{fmt.Sprintf("%06d", 10_000+f.rnd.Intn(900_000))}
+	}
+
+	history := []StatusChange{{Status: ParcelStatusRegistered, ChangedAt: p.CreatedAt}}
+	// one parcel in ten is never sent
+	if f.rnd.Intn(10) == 0 {
+		return p, history
+	}
+	at := created
+	for next := nextStatus(p); next != ""; next = nextStatus(p) {
+		at = at.Add(6*time.Hour + time.Duration(f.rnd.Int63n(int64(72*time.Hour))))
+		if at.After(f.To) {
+			break
+		}
+		p.Status, p.Payment = next, PaymentPaid
+		c := StatusChange{Status: next, ChangedAt: FormatTimestamp(at, DefaultTimestampPrecision)}
+		switch next {
+		case ParcelStatusSent:
+			p.SentAt = c.ChangedAt
+		case ParcelStatusDelivered:
+			p.DeliveredAt = c.ChangedAt
+		}
+		history = append(history, c)
+	}
+	return p, history
+}
+
+// Seed adds n fabricated parcels with their status histories to store in
+// one transaction and returns them as stored, oldest first. Parcels are
+// added with Add, so they get tracking codes, reference numbers and
+// public IDs like any other.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Adds nothing if any parcel fails; wraps and returns the error.
+func (f *Fixtures) Seed(store ParcelStore, n int) ([]Parcel, error) {
+	type fixture struct {
+		parcel  Parcel
+		history []StatusChange
+	}
+	fabricated := make([]fixture, n)
+	for i := range fabricated {
+		fabricated[i].parcel, fabricated[i].history = f.Parcel()
+	}
+	// numbers follow creation, as they would have
+	sort.SliceStable(fabricated, func(i, j int) bool {
+		return fabricated[i].parcel.CreatedAt < fabricated[j].parcel.CreatedAt
+	})
+
+	res := make([]Parcel, 0, n)
+	err := store.InTx(func(tx ParcelStore) error {
+		for _, fx := range fabricated {
+			number, err := tx.Add(fx.parcel)
+			if err != nil {
+				return fmt.Errorf("failed to seed fixture parcel: %w", err)
+			}
+			for _, c := range fx.history {
+				c.Number = number
+				if err := tx.AddHistory(c); err != nil {
+					return fmt.Errorf("failed to seed fixture parcel: %w", err)
+				}
+			}
+			stored, err := tx.Get(number)
+			if err != nil {
+				return fmt.Errorf("failed to seed fixture parcel: %w", err)
+			}
+			res = append(res, stored)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
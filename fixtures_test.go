@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFixturesParcel verifies that fabricated parcels are reproducible,
+// valid, and moved along their lifecycle within the time bounds.
+func TestFixturesParcel(t *testing.T) {
+	// prepare
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	fixtures, again := NewFixtures(7, now), NewFixtures(7, now)
+
+	// check
+	statuses := map[string]int{}
+	for i := 0; i < 200; i++ {
+		p, history := fixtures.Parcel()
+		same, _ := again.Parcel()
+		require.Equal(t, p, same)
+		require.NoError(t, p.Validate())
+		statuses[p.Status]++
+
+		assert.True(t, p.Client >= 1 && p.Client <= fixtures.Clients)
+		require.NotEmpty(t, history)
+		assert.Equal(t, StatusChange{Status: ParcelStatusRegistered, ChangedAt: p.CreatedAt}, history[0])
+		assert.Equal(t, p.Status, history[len(history)-1].Status)
+		step := Parcel{Status: ParcelStatusRegistered, International: p.International}
+		for _, c := range history[1:] {
+			assert.Equal(t, nextStatus(step), c.Status)
+			step.Status = c.Status
+		}
+		for i := 1; i < len(history); i++ {
+			assert.Less(t, history[i-1].ChangedAt, history[i].ChangedAt)
+		}
+		assert.GreaterOrEqual(t, p.CreatedAt, FormatTimestamp(fixtures.From, DefaultTimestampPrecision))
+		assert.LessOrEqual(t, history[len(history)-1].ChangedAt, FormatTimestamp(now, DefaultTimestampPrecision))
+		if p.International {
+			assert.NotEmpty(t, p.Country)
+		}
+	}
+	assert.Positive(t, statuses[ParcelStatusRegistered])
+	assert.Positive(t, statuses[ParcelStatusDelivered])
+}
+
+// TestFixturesSeed verifies that seeded parcels are stored with their
+// histories, numbered in the order they were created.
+func TestFixturesSeed(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	// seed
+	parcels, err := NewFixtures(1, time.Now()).Seed(store, 20)
+	require.NoError(t, err)
+
+	// check
+	require.Len(t, parcels, 20)
+	for i, p := range parcels {
+		assert.NotEmpty(t, p.TrackingCode)
+		assert.NotEmpty(t, p.PublicID)
+		if i > 0 {
+			assert.Greater(t, p.Number, parcels[i-1].Number)
+			assert.GreaterOrEqual(t, p.CreatedAt, parcels[i-1].CreatedAt)
+		}
+		history, err := store.GetHistory(p.Number)
+		require.NoError(t, err)
+		require.NotEmpty(t, history)
+		assert.Equal(t, p.Status, history[len(history)-1].Status)
+	}
+}
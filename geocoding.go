@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidCoordinates indicates a latitude, longitude or radius out of range.
+var ErrInvalidCoordinates = newError(CodeInvalidCoordinates, "invalid coordinates")
+
+// earthRadius is the mean radius of the Earth in metres.
+const earthRadius = 6371000.0
+
+// Coordinates is a WGS 84 position in decimal degrees.
+type Coordinates struct {
+	Lat float64
+	Lon float64
+}
+
+// valid reports whether c lies within the latitude and longitude ranges.
+func (c Coordinates) valid() bool {
+	return c.Lat >= -90 && c.Lat <= 90 && c.Lon >= -180 && c.Lon <= 180
+}
+
+// Distance returns the great-circle distance between a and b in metres.
+func Distance(a, b Coordinates) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Geocoder resolves an address to coordinates. It returns nil coordinates
+// and no error for an address it cannot find, and an error only when the
+// lookup itself fails.
+type Geocoder interface {
+	Geocode(address string) (*Coordinates, error)
+}
+
+// WithGeocoder returns a copy of the store that stores the coordinates
+// of every address given to Add and SetAddress, as resolved by g.
+// Addresses g cannot find are stored without coordinates.
+func (s ParcelStore) WithGeocoder(g Geocoder) ParcelStore {
+	s.geocoder = g
+	return s
+}
+
+// geocode resolves address with the store's geocoder, if any.
+func (s ParcelStore) geocode(address string) (*Coordinates, error) {
+	if s.geocoder == nil {
+		return nil, nil
+	}
+	c, err := s.geocoder.Geocode(address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to geocode %q: %w", pii(address), err)
+	}
+	if c != nil && !c.valid() {
+		return nil, fmt.Errorf("failed to geocode %q: %w %v", pii(address), ErrInvalidCoordinates, pii(*c))
+	}
+	return c, nil
+}
+
+// nullCoordinates returns the column values for c: NULL if c is nil.
+func nullCoordinates(c *Coordinates) (lat, lon sql.NullFloat64) {
+	if c == nil {
+		return lat, lon
+	}
+	return sql.NullFloat64{Float64: c.Lat, Valid: true}, sql.NullFloat64{Float64: c.Lon, Valid: true}
+}
+
+// GetNearby returns the undelivered parcels whose coordinates lie within
+// radius metres of (lat, lon), nearest first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidCoordinates (wrapped) for a position out of range
+//     or a radius that is not positive.
+//   - Parcels without coordinates are never returned.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) GetNearby(lat, lon, radius float64) ([]Parcel, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	center := Coordinates{Lat: lat, Lon: lon}
+	if !center.valid() || !(radius > 0) {
+		return nil, fmt.Errorf("failed to get parcels near %v: %w (radius %g m)", pii(center), ErrInvalidCoordinates, radius)
+	}
+
+	// narrow the search with a bounding box on the index, then measure exactly;
+	// near the poles or for huge radii the box covers every longitude
+	dLat := radius / earthRadius * 180 / math.Pi
+	dLon := 180.0
+	if cos := math.Cos(lat * math.Pi / 180); cos > 0 && radius < earthRadius {
+		dLon = math.Min(180, dLat/cos)
+	}
+	query := "SELECT " + parcelColumns + ` FROM parcel
+WHERE latitude BETWEEN :min_lat AND :max_lat AND status != :delivered`
+	args := []any{sql.Named("min_lat", lat-dLat), sql.Named("max_lat", lat+dLat), sql.Named("delivered", ParcelStatusDelivered)}
+	if dLon < 180 && lon-dLon >= -180 && lon+dLon <= 180 {
+		query += " AND longitude BETWEEN :min_lon AND :max_lon"
+		args = append(args, sql.Named("min_lon", lon-dLon), sql.Named("max_lon", lon+dLon))
+	}
+
+	parcels, err := s.queryParcels(fmt.Sprintf("area around %v", pii(center)), query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	distances := make(map[int]float64, len(parcels))
+	res := parcels[:0]
+	for _, p := range parcels {
+		d := Distance(center, *p.Coordinates)
+		if d <= radius {
+			distances[p.Number] = d
+			res = append(res, p)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return distances[res[i].Number] < distances[res[j].Number]
+	})
+	return res, nil
+}
+
+// NominatimGeocoder is an example Geocoder for services with a
+// Nominatim-style search API: it requests
+// Endpoint?q=<address>&format=json&limit=1 and uses the first match.
+type NominatimGeocoder struct {
+	// Endpoint is the search URL, e.g. "https://nominatim.example/search".
+	Endpoint string
+	// Client is used for requests; nil means http.DefaultClient.
+	Client *http.Client
+	// Timeout bounds each lookup; zero means 5 seconds.
+	Timeout time.Duration
+}
+
+// Geocode implements Geocoder.
+func (g NominatimGeocoder) Geocode(address string) (*Coordinates, error) {
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	timeout := g.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	q := url.Values{"q": {address}, "format": {"json"}, "limit": {"1"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.Endpoint+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build geocoding request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to geocode address: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to geocode address: %s", resp.Status)
+	}
+
+	// Nominatim returns coordinates as strings
+	var matches []struct {
+		Lat string `json:"lat"`
+		Lon string `json:"lon"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&matches); err != nil {
+		return nil, fmt.Errorf("failed to decode geocoding response: %w", err)
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	lat, err := strconv.ParseFloat(matches[0].Lat, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode geocoding response: latitude %q: %w", matches[0].Lat, err)
+	}
+	lon, err := strconv.ParseFloat(matches[0].Lon, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode geocoding response: longitude %q: %w", matches[0].Lon, err)
+	}
+	return &Coordinates{Lat: lat, Lon: lon}, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mapGeocoder is a Geocoder over a fixed table of addresses.
+type mapGeocoder map[string]Coordinates
+
+func (g mapGeocoder) Geocode(address string) (*Coordinates, error) {
+	c, ok := g[address]
+	if !ok {
+		return nil, nil
+	}
+	return &c, nil
+}
+
+var testGeocoder = mapGeocoder{
+	"Red Square":      {Lat: 55.7539, Lon: 37.6208},
+	"Bolshoi Theatre": {Lat: 55.7601, Lon: 37.6186},
+	"Gorky Park":      {Lat: 55.7298, Lon: 37.6010},
+	"Hermitage":       {Lat: 59.9398, Lon: 30.3146},
+}
+
+// TestDistance checks the great-circle distance against a known value.
+func TestDistance(t *testing.T) {
+	moscow, petersburg := testGeocoder["Red Square"], testGeocoder["Hermitage"]
+	assert.InDelta(t, 634000, Distance(moscow, petersburg), 5000)
+	assert.Zero(t, Distance(moscow, moscow))
+}
+
+// TestAddWithGeocoder verifies that coordinates follow the address on Add
+// and SetAddress.
+func TestAddWithGeocoder(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db).WithGeocoder(testGeocoder)
+	parcel := getTestParcel()
+	parcel.Address = "Red Square"
+
+	// add
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.NotNil(t, stored.Coordinates)
+	assert.Equal(t, testGeocoder["Red Square"], *stored.Coordinates)
+
+	// set address
+	require.NoError(t, store.SetAddress(id, "Gorky Park"))
+	stored, err = store.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, testGeocoder["Gorky Park"], *stored.Coordinates)
+
+	require.NoError(t, store.SetAddress(id, "Unknown street"))
+	stored, err = store.Get(id)
+	require.NoError(t, err)
+	assert.Nil(t, stored.Coordinates)
+
+	// check
+	parcel.Coordinates = &Coordinates{Lat: 91}
+	_, err = store.Add(parcel)
+	require.ErrorIs(t, err, ErrInvalidCoordinates)
+}
+
+// TestGetNearby verifies radius filtering, ordering by distance and that
+// delivered parcels are left out.
+func TestGetNearby(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db).WithGeocoder(testGeocoder)
+
+	ids := map[string]int{}
+	for _, address := range []string{"Gorky Park", "Hermitage", "Bolshoi Theatre", "Red Square"} {
+		parcel := getTestParcel()
+		parcel.Address = address
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		ids[address] = id
+	}
+	require.NoError(t, store.SetStatus(ids["Red Square"], ParcelStatusDelivered))
+	center := testGeocoder["Red Square"]
+
+	// check
+	parcels, err := store.GetNearby(center.Lat, center.Lon, 5000)
+	require.NoError(t, err)
+	require.Len(t, parcels, 2)
+	assert.Equal(t, ids["Bolshoi Theatre"], parcels[0].Number)
+	assert.Equal(t, ids["Gorky Park"], parcels[1].Number)
+
+	parcels, err = store.GetNearby(center.Lat, center.Lon, 1000)
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+
+	_, err = store.GetNearby(center.Lat, center.Lon, 0)
+	require.ErrorIs(t, err, ErrInvalidCoordinates)
+}
+
+// TestNominatimGeocoder verifies parsing of a Nominatim-style response.
+func TestNominatimGeocoder(t *testing.T) {
+	// prepare
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("q") == "Red Square" {
+			w.Write([]byte(`[{"lat": "55.7539", "lon": "37.6208", "display_name": "Red Square"}]`))
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+	g := NominatimGeocoder{Endpoint: srv.URL}
+
+	// check
+	c, err := g.Geocode("Red Square")
+	require.NoError(t, err)
+	require.NotNil(t, c)
+	assert.Equal(t, testGeocoder["Red Square"], *c)
+
+	c, err = g.Geocode("Nowhere")
+	require.NoError(t, err)
+	assert.Nil(t, c)
+}
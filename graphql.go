@@ -0,0 +1,691 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// This file implements the subset of GraphQL the API needs, so that the
+// module keeps depending on the standard library only:
+//
+//   - query, mutation and subscription operations, named or anonymous,
+//     with variables and default values;
+//   - fields with aliases, arguments and nested selection sets;
+//   - __typename.
+//
+// Fragments, directives and introspection beyond __typename are rejected
+// with a syntax error. Variable types are parsed but not checked; the
+// resolvers validate their arguments instead.
+
+// errGraphQLSyntax indicates a document the parser does not accept.
+var errGraphQLSyntax = errors.New("graphql syntax error")
+
+// gqlOperation is one operation of a document.
+type gqlOperation struct {
+	kind string // "query", "mutation" or "subscription"
+	name string
+	// defaults holds the default values of the declared variables.
+	defaults map[string]any
+	sel      []gqlSelection
+}
+
+// gqlSelection is a field of a selection set.
+type gqlSelection struct {
+	alias string
+	name  string
+	args  map[string]any
+	sel   []gqlSelection
+}
+
+// key is the name of the field in the response.
+func (s gqlSelection) key() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+// gqlVariable is a reference to a variable in an argument value.
+type gqlVariable string
+
+// gqlEnum is an enum literal, e.g. DESC; resolvers receive it as a string.
+type gqlEnum string
+
+// gqlToken is a lexical token. kind is one of "name", "int", "float",
+// "string", "punct" or "eof".
+type gqlToken struct {
+	kind string
+	text string
+	pos  int
+}
+
+// gqlLex splits a document into tokens, dropping whitespace, commas and
+// comments.
+func gqlLex(src string) ([]gqlToken, error) {
+	var tokens []gqlToken
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case strings.HasPrefix(src[i:], "\ufeff"):
+			i += len("\ufeff")
+		case c == '#':
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			tokens = append(tokens, gqlToken{kind: "punct", text: "...", pos: i})
+			i += 3
+		case strings.ContainsRune("!$():=@[]{}|&", rune(c)):
+			tokens = append(tokens, gqlToken{kind: "punct", text: string(c), pos: i})
+			i++
+		case isNameStart(c):
+			start := i
+			for i < len(src) && (isNameStart(src[i]) || src[i] >= '0' && src[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, gqlToken{kind: "name", text: src[start:i], pos: start})
+		case c == '-' || c >= '0' && c <= '9':
+			start := i
+			i++
+			kind := "int"
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || strings.IndexByte(".eE+-", src[i]) >= 0) {
+				if strings.IndexByte(".eE", src[i]) >= 0 {
+					kind = "float"
+				}
+				i++
+			}
+			tokens = append(tokens, gqlToken{kind: kind, text: src[start:i], pos: start})
+		case c == '"':
+			if strings.HasPrefix(src[i:], `"""`) {
+				return nil, fmt.Errorf("%w at %d: block strings are not supported", errGraphQLSyntax, i)
+			}
+			start := i
+			i++
+			for i < len(src) && src[i] != '"' {
+				if src[i] == '\\' {
+					i++
+				}
+				if i < len(src) && (src[i] == '\n' || src[i] == '\r') {
+					return nil, fmt.Errorf("%w at %d: unterminated string", errGraphQLSyntax, start)
+				}
+				i++
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("%w at %d: unterminated string", errGraphQLSyntax, start)
+			}
+			i++
+			// GraphQL string escapes are those of JSON
+			var text string
+			if err := json.Unmarshal([]byte(src[start:i]), &text); err != nil {
+				return nil, fmt.Errorf("%w at %d: invalid string: %v", errGraphQLSyntax, start, err)
+			}
+			tokens = append(tokens, gqlToken{kind: "string", text: text, pos: start})
+		default:
+			return nil, fmt.Errorf("%w at %d: unexpected character %q", errGraphQLSyntax, i, c)
+		}
+	}
+	return append(tokens, gqlToken{kind: "eof", pos: len(src)}), nil
+}
+
+// isNameStart reports whether c may start a name; names are ASCII only.
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// gqlParser is a recursive-descent parser over the tokens of a document.
+type gqlParser struct {
+	tokens []gqlToken
+	i      int
+}
+
+func (p *gqlParser) peek() gqlToken { return p.tokens[p.i] }
+
+func (p *gqlParser) next() gqlToken {
+	t := p.tokens[p.i]
+	if t.kind != "eof" {
+		p.i++
+	}
+	return t
+}
+
+// is reports whether the next token is the punctuator or name text.
+func (p *gqlParser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == "punct" || t.kind == "name") && t.text == text
+}
+
+func (p *gqlParser) expect(text string) error {
+	if t := p.next(); t.text != text || t.kind == "string" {
+		return p.errorf(t, "expected %q, found %q", text, t.text)
+	}
+	return nil
+}
+
+func (p *gqlParser) name() (string, error) {
+	t := p.next()
+	if t.kind != "name" {
+		return "", p.errorf(t, "expected a name, found %q", t.text)
+	}
+	return t.text, nil
+}
+
+func (p *gqlParser) errorf(t gqlToken, format string, args ...any) error {
+	if t.kind == "eof" {
+		return fmt.Errorf("%w: unexpected end of document", errGraphQLSyntax)
+	}
+	return fmt.Errorf("%w at %d: %s", errGraphQLSyntax, t.pos, fmt.Sprintf(format, args...))
+}
+
+// parseGraphQL parses a document into its operations.
+func parseGraphQL(src string) ([]gqlOperation, error) {
+	tokens, err := gqlLex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &gqlParser{tokens: tokens}
+
+	var ops []gqlOperation
+	for p.peek().kind != "eof" {
+		op, err := p.operation()
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("%w: no operation", errGraphQLSyntax)
+	}
+	return ops, nil
+}
+
+func (p *gqlParser) operation() (gqlOperation, error) {
+	op := gqlOperation{kind: "query"}
+	if !p.is("{") {
+		t := p.next()
+		switch t.text {
+		case "query", "mutation", "subscription":
+			op.kind = t.text
+		case "fragment":
+			return op, p.errorf(t, "fragments are not supported")
+		default:
+			return op, p.errorf(t, "expected an operation, found %q", t.text)
+		}
+		if p.peek().kind == "name" {
+			op.name = p.next().text
+		}
+		if p.is("(") {
+			defaults, err := p.variableDefinitions()
+			if err != nil {
+				return op, err
+			}
+			op.defaults = defaults
+		}
+	}
+
+	sel, err := p.selectionSet()
+	if err != nil {
+		return op, err
+	}
+	op.sel = sel
+	return op, nil
+}
+
+func (p *gqlParser) variableDefinitions() (map[string]any, error) {
+	defaults := make(map[string]any)
+	p.next() // (
+	for !p.is(")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if err := p.typeRef(); err != nil {
+			return nil, err
+		}
+		if p.is("=") {
+			p.next()
+			v, err := p.value(true)
+			if err != nil {
+				return nil, err
+			}
+			defaults[name] = v
+		}
+	}
+	p.next() // )
+	return defaults, nil
+}
+
+// typeRef skips a type such as [Int!]!.
+func (p *gqlParser) typeRef() error {
+	if p.is("[") {
+		p.next()
+		if err := p.typeRef(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	if p.is("!") {
+		p.next()
+	}
+	return nil
+}
+
+func (p *gqlParser) selectionSet() ([]gqlSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var sels []gqlSelection
+	for !p.is("}") {
+		if t := p.peek(); t.kind == "punct" && t.text == "..." {
+			return nil, p.errorf(t, "fragments are not supported")
+		}
+		sel, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+	}
+	p.next() // }
+	if len(sels) == 0 {
+		return nil, fmt.Errorf("%w: empty selection set", errGraphQLSyntax)
+	}
+	return sels, nil
+}
+
+func (p *gqlParser) field() (gqlSelection, error) {
+	var sel gqlSelection
+	name, err := p.name()
+	if err != nil {
+		return sel, err
+	}
+	sel.name = name
+	if p.is(":") {
+		p.next()
+		if sel.name, err = p.name(); err != nil {
+			return sel, err
+		}
+		sel.alias = name
+	}
+
+	if p.is("(") {
+		p.next()
+		sel.args = make(map[string]any)
+		for !p.is(")") {
+			arg, err := p.name()
+			if err != nil {
+				return sel, err
+			}
+			if err := p.expect(":"); err != nil {
+				return sel, err
+			}
+			if sel.args[arg], err = p.value(false); err != nil {
+				return sel, err
+			}
+		}
+		p.next() // )
+	}
+	if t := p.peek(); t.kind == "punct" && t.text == "@" {
+		return sel, p.errorf(t, "directives are not supported")
+	}
+	if p.is("{") {
+		if sel.sel, err = p.selectionSet(); err != nil {
+			return sel, err
+		}
+	}
+	return sel, nil
+}
+
+// value parses an argument value; constant values may not use variables.
+func (p *gqlParser) value(constant bool) (any, error) {
+	t := p.next()
+	switch t.kind {
+	case "int":
+		n, err := strconv.Atoi(t.text)
+		if err != nil {
+			return nil, p.errorf(t, "invalid integer %q", t.text)
+		}
+		return n, nil
+	case "float":
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number %q", t.text)
+		}
+		return f, nil
+	case "string":
+		return t.text, nil
+	case "name":
+		switch t.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return gqlEnum(t.text), nil
+	}
+
+	switch t.text {
+	case "$":
+		if constant {
+			return nil, p.errorf(t, "variables are not allowed here")
+		}
+		name, err := p.name()
+		return gqlVariable(name), err
+	case "[":
+		list := []any{}
+		for !p.is("]") {
+			if p.peek().kind == "eof" {
+				return nil, p.errorf(p.peek(), "unterminated list")
+			}
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		p.next()
+		return list, nil
+	case "{":
+		obj := make(map[string]any)
+		for !p.is("}") {
+			key, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if obj[key], err = p.value(constant); err != nil {
+				return nil, err
+			}
+		}
+		p.next()
+		return obj, nil
+	}
+	return nil, p.errorf(t, "expected a value, found %q", t.text)
+}
+
+// gqlObject is an object type of a schema.
+type gqlObject struct {
+	name   string
+	fields map[string]*gqlField
+}
+
+// gqlField is a field of an object type.
+type gqlField struct {
+	// args lists the accepted argument names.
+	args []string
+	// typ is the object type of the value, or of the elements of a list
+	// value; nil for scalars.
+	typ *gqlObject
+	// resolve returns the value of the field of source. Lists of objects
+	// are returned as []any.
+	resolve func(source any, args gqlArgs) (any, error)
+}
+
+// gqlError is an entry of the "errors" of a response.
+type gqlError struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+	// Extensions carry the ErrorCode of the error, if it has one.
+	Extensions *gqlErrorExtensions `json:"extensions,omitempty"`
+}
+
+type gqlErrorExtensions struct {
+	Code   ErrorCode        `json:"code"`
+	Fields []fieldErrorJSON `json:"fields,omitempty"`
+}
+
+// newGQLError returns the response entry of err raised at path.
+func newGQLError(err error, path []any) gqlError {
+	res := gqlError{Message: err.Error(), Path: path}
+	if code := ErrorCodeOf(err); code != "" {
+		res.Extensions = &gqlErrorExtensions{Code: code, Fields: toFieldErrorsJSON(err)}
+	}
+	return res
+}
+
+// gqlResult is a response object that keeps its keys in selection order.
+type gqlResult struct {
+	keys   []string
+	values map[string]any
+}
+
+func (r *gqlResult) set(key string, v any) {
+	if r.values == nil {
+		r.values = make(map[string]any)
+	}
+	if _, ok := r.values[key]; !ok {
+		r.keys = append(r.keys, key)
+	}
+	r.values[key] = v
+}
+
+// empty reports whether every value of r is null.
+func (r *gqlResult) empty() bool {
+	for _, v := range r.values {
+		if v != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r *gqlResult) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range r.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		buf.Write(key)
+		buf.WriteByte(':')
+		v, err := json.Marshal(r.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// gqlValidate checks the selections against obj before anything runs, so
+// that a mistyped field cannot leave a mutation half done.
+func gqlValidate(obj *gqlObject, sels []gqlSelection, path string) error {
+	for _, sel := range sels {
+		if sel.name == "__typename" {
+			continue
+		}
+		field, ok := obj.fields[sel.name]
+		if !ok {
+			return fmt.Errorf("cannot query field %q on type %s", sel.name, obj.name)
+		}
+		for arg := range sel.args {
+			if !contains(field.args, arg) {
+				return fmt.Errorf("unknown argument %q on field %s.%s", arg, obj.name, sel.name)
+			}
+		}
+		switch {
+		case field.typ == nil && sel.sel != nil:
+			return fmt.Errorf("field %s%s of a scalar type must not have a selection", path, sel.name)
+		case field.typ != nil && sel.sel == nil:
+			return fmt.Errorf("field %s%s of type %s must have a selection", path, sel.name, field.typ.name)
+		case field.typ != nil:
+			if err := gqlValidate(field.typ, sel.sel, path+sel.name+"."); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// gqlExecutor executes validated selections, collecting field errors.
+type gqlExecutor struct {
+	vars   map[string]any
+	errors []gqlError
+}
+
+// object resolves the selections on source of type obj.
+func (e *gqlExecutor) object(obj *gqlObject, source any, sels []gqlSelection, path []any) *gqlResult {
+	res := &gqlResult{}
+	for _, sel := range sels {
+		fieldPath := append(append([]any(nil), path...), sel.key())
+		if sel.name == "__typename" {
+			res.set(sel.key(), obj.name)
+			continue
+		}
+
+		field := obj.fields[sel.name]
+		v, err := field.resolve(source, gqlArgs(e.bind(sel.args).(map[string]any)))
+		if err != nil {
+			e.errors = append(e.errors, newGQLError(err, fieldPath))
+			res.set(sel.key(), nil)
+			continue
+		}
+		res.set(sel.key(), e.complete(field, v, sel, fieldPath))
+	}
+	return res
+}
+
+// complete turns a resolved value into its response form.
+func (e *gqlExecutor) complete(field *gqlField, v any, sel gqlSelection, path []any) any {
+	if field.typ == nil || v == nil {
+		return v
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return e.object(field.typ, v, sel.sel, path)
+	}
+	res := make([]any, len(list))
+	for i, item := range list {
+		res[i] = e.object(field.typ, item, sel.sel, append(append([]any(nil), path...), i))
+	}
+	return res
+}
+
+// bind replaces variable references in v with their values.
+func (e *gqlExecutor) bind(v any) any {
+	switch v := v.(type) {
+	case gqlVariable:
+		return e.bind(e.vars[string(v)]) // defaults may hold enums
+	case gqlEnum:
+		return string(v)
+	case []any:
+		res := make([]any, len(v))
+		for i, item := range v {
+			res[i] = e.bind(item)
+		}
+		return res
+	case map[string]any:
+		res := make(map[string]any, len(v))
+		for k, item := range v {
+			res[k] = e.bind(item)
+		}
+		return res
+	}
+	return v
+}
+
+// gqlArgs are the bound arguments of a field. The typed getters return
+// the zero value for missing or null arguments.
+type gqlArgs map[string]any
+
+func (a gqlArgs) has(name string) bool {
+	v, ok := a[name]
+	return ok && v != nil
+}
+
+func (a gqlArgs) int(name string) (int, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return v, nil
+	case float64: // JSON variables
+		if v == math.Trunc(v) && math.Abs(v) <= math.MaxInt32 {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("argument %q must be an integer", name)
+}
+
+func (a gqlArgs) float(name string) (float64, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	}
+	return 0, fmt.Errorf("argument %q must be a number", name)
+}
+
+func (a gqlArgs) string(name string) (string, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("argument %q must be a string", name)
+}
+
+func (a gqlArgs) strings(name string) ([]string, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		res := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("argument %q must be a list of strings", name)
+			}
+			res[i] = s
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("argument %q must be a list of strings", name)
+}
+
+func (a gqlArgs) bool(name string) (bool, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	}
+	return false, fmt.Errorf("argument %q must be a boolean", name)
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// graphQLSchema is the parcel domain as GraphQL:
+//
+//	type Query {
+//	  parcel(number: Int, trackingCode: String, publicId: String): Parcel
+//	  parcels(client: Int, status: String, serviceClass: String, minWeight: Int,
+//	          maxWeight: Int, minValue: Int, maxValue: Int, duplicates: Boolean,
+//	          recipientPhone: String, sort: String, order: String): [Parcel]
+//	  statusLabels(lang: String): [StatusLabel]
+//	}
+//	type Mutation {
+//	  register(client: Int!, address: String, serviceClass: String, weightGrams: Int,
+//	           dimensions: String, declaredValue: Int, currency: String, cashOnDelivery: Boolean,
+//	           allowDuplicate: Boolean,
+//	           pickupPoint: Int, recipientName: String, recipientPhone: String,
+//	           contents: [String], international: Boolean, country: String,
+//	           customsReference: String, hsCodes: [String], idempotencyKey: String): Parcel
+//	  setStatus(number: Int!, status: String!): Parcel
+//	  setAddress(number: Int!, address: String!): Parcel
+//	}
+//	type Subscription {
+//	  statusChanged(number: Int, client: Int): StatusChangedEvent
+//	}
+//	type Parcel {
+//	  number: Int, publicId: String, trackingCode: String, client: Int, status: String,
+//	  serviceClass: String, address: String, createdAt: String, dueAt: String,
+//	  weightGrams: Int, dimensions: String, declaredValue: Int, zone: String, price: Int, currency: String,
+//	  payment: String, cashOnDelivery: Boolean, duplicateOf: Int,
+//	  latitude: Float, longitude: Float, pickupPoint: Int,
+//	  recipientName: String, recipientPhone: String, contents: [String], repacked: Boolean,
+//	  international: Boolean, country: String, customsReference: String, hsCodes: [String],
+//	  statusLabel(lang: String): StatusLabel, history: [StatusChange]
+//	}
+//	type StatusChange { status: String, changedAt: String, note: String }
+//	type StatusLabel { status: String, lang: String, displayName: String,
+//	                   color: String, description: String }
+//	type StatusChangedEvent { parcel: Parcel, prevStatus: String, status: String, at: String }
+//
+// The arguments of parcels mirror the query parameters of GET /parcels.
+// Optional fields that are unset on the parcel, e.g. dueAt, are null.
+// Errors that have an ErrorCode carry it in extensions.code.
+type graphQLSchema struct {
+	query, mutation, subscription *gqlObject
+}
+
+// newGraphQLSchema returns the schema resolving against a; labels come
+// from service, as they are not subject to authorization.
+func newGraphQLSchema(service ParcelService, a AuthorizedService) graphQLSchema {
+	statusChange := &gqlObject{name: "StatusChange", fields: map[string]*gqlField{
+		"status":    gqlProperty(func(c StatusChange) any { return c.Status }),
+		"changedAt": gqlProperty(func(c StatusChange) any { return c.ChangedAt }),
+		"note":      gqlProperty(func(c StatusChange) any { return optional(c.Note) }),
+	}}
+
+	statusLabel := &gqlObject{name: "StatusLabel", fields: map[string]*gqlField{
+		"status":      gqlProperty(func(l StatusLabel) any { return l.Status }),
+		"lang":        gqlProperty(func(l StatusLabel) any { return l.Lang }),
+		"displayName": gqlProperty(func(l StatusLabel) any { return l.DisplayName }),
+		"color":       gqlProperty(func(l StatusLabel) any { return optional(l.Color) }),
+		"description": gqlProperty(func(l StatusLabel) any { return optional(l.Description) }),
+	}}
+
+	parcel := &gqlObject{name: "Parcel", fields: map[string]*gqlField{
+		"number":              gqlProperty(func(p Parcel) any { return p.Number }),
+		"publicId":            gqlProperty(func(p Parcel) any { return p.PublicID }),
+		"trackingCode":        gqlProperty(func(p Parcel) any { return p.TrackingCode }),
+		"client":              gqlProperty(func(p Parcel) any { return p.Client }),
+		"clientRef":           gqlProperty(func(p Parcel) any { return p.ClientRef }),
+		"status":              gqlProperty(func(p Parcel) any { return p.Status }),
+		"serviceClass":        gqlProperty(func(p Parcel) any { return p.ServiceClass }),
+		"address":             gqlProperty(func(p Parcel) any { return p.Address }),
+		"createdAt":           gqlProperty(func(p Parcel) any { return p.CreatedAt }),
+		"dueAt":               gqlProperty(func(p Parcel) any { return optional(p.DueAt) }),
+		"sentAt":              gqlProperty(func(p Parcel) any { return optional(p.SentAt) }),
+		"deliveredAt":         gqlProperty(func(p Parcel) any { return optional(p.DeliveredAt) }),
+		"estimatedDeliveryAt": gqlProperty(func(p Parcel) any { return optional(p.EstimatedDeliveryAt) }),
+		"delays":              gqlProperty(func(p Parcel) any { return p.Delays }),
+		"weightGrams":         gqlProperty(func(p Parcel) any { return optional(p.WeightGrams) }),
+		"dimensions":          gqlProperty(func(p Parcel) any { return optional(p.Dimensions.String()) }),
+		"declaredValue":       gqlProperty(func(p Parcel) any { return optional(p.DeclaredValue) }),
+		"zone":                gqlProperty(func(p Parcel) any { return optional(p.Zone) }),
+		"price":               gqlProperty(func(p Parcel) any { return optional(p.Price) }),
+		"currency":            gqlProperty(func(p Parcel) any { return p.Currency }),
+		"payment":             gqlProperty(func(p Parcel) any { return p.Payment }),
+		"cashOnDelivery":      gqlProperty(func(p Parcel) any { return p.CashOnDelivery }),
+		"duplicateOf":         gqlProperty(func(p Parcel) any { return optional(p.DuplicateOf) }),
+		"pickupPoint":         gqlProperty(func(p Parcel) any { return optional(p.PickupPoint) }),
+		"recipientName":       gqlProperty(func(p Parcel) any { return optional(p.Recipient.Name) }),
+		"recipientPhone":      gqlProperty(func(p Parcel) any { return optional(p.Recipient.Phone) }),
+		"repacked":            gqlProperty(func(p Parcel) any { return p.Repacked }),
+		"hold":                gqlProperty(func(p Parcel) any { return optional(p.Hold.Kind) }),
+		"contents":            gqlProperty(func(p Parcel) any { return p.Contents }),
+		"international":       gqlProperty(func(p Parcel) any { return p.International }),
+		"country":             gqlProperty(func(p Parcel) any { return optional(p.Country) }),
+		"customsReference":    gqlProperty(func(p Parcel) any { return optional(p.CustomsReference) }),
+		"hsCodes":             gqlProperty(func(p Parcel) any { return p.HSCodes }),
+		"latitude": gqlProperty(func(p Parcel) any {
+			if p.Coordinates == nil {
+				return nil
+			}
+			return p.Coordinates.Lat
+		}),
+		"longitude": gqlProperty(func(p Parcel) any {
+			if p.Coordinates == nil {
+				return nil
+			}
+			return p.Coordinates.Lon
+		}),
+		"history": {typ: statusChange, resolve: func(source any, _ gqlArgs) (any, error) {
+			history, err := a.History(source.(Parcel).Number)
+			return gqlList(history), err
+		}},
+		"statusLabel": {args: []string{"lang"}, typ: statusLabel, resolve: func(source any, args gqlArgs) (any, error) {
+			lang, err := args.string("lang")
+			if err != nil {
+				return nil, err
+			}
+			labels, err := service.Labels(lang)
+			return labels.Label(source.(Parcel).Status), err
+		}},
+	}}
+
+	statusChanged := &gqlObject{name: "StatusChangedEvent", fields: map[string]*gqlField{
+		"parcel":     {typ: parcel, resolve: func(source any, _ gqlArgs) (any, error) { return source.(Event).Parcel, nil }},
+		"prevStatus": gqlProperty(func(e Event) any { return e.PrevStatus }),
+		"status":     gqlProperty(func(e Event) any { return e.Parcel.Status }),
+		"at":         gqlProperty(func(e Event) any { return e.At }),
+	}}
+
+	// current returns the parcel after a mutation succeeded.
+	current := func(number int, err error) (any, error) {
+		if err != nil {
+			return nil, err
+		}
+		return a.Get(number)
+	}
+
+	var s graphQLSchema
+	s.query = &gqlObject{name: "Query", fields: map[string]*gqlField{
+		"parcel": {args: []string{"number", "trackingCode", "publicId"}, typ: parcel, resolve: func(_ any, args gqlArgs) (any, error) {
+			given := 0
+			for _, name := range []string{"number", "trackingCode", "publicId"} {
+				if args.has(name) {
+					given++
+				}
+			}
+			if given != 1 {
+				return nil, errors.New("exactly one of number, trackingCode and publicId is required")
+			}
+			if args.has("publicId") {
+				id, err := args.string("publicId")
+				if err != nil {
+					return nil, err
+				}
+				return a.GetByPublicID(id)
+			}
+			if args.has("trackingCode") {
+				code, err := args.string("trackingCode")
+				if err != nil {
+					return nil, err
+				}
+				return a.GetByTrackingCode(code)
+			}
+			number, err := args.int("number")
+			if err != nil {
+				return nil, err
+			}
+			return a.Get(number)
+		}},
+		"parcels": {
+			args: []string{"client", "status", "serviceClass", "minWeight", "maxWeight", "minValue", "maxValue",
+				"duplicates", "recipientPhone", "sort", "order"},
+			typ: parcel,
+			resolve: func(_ any, args gqlArgs) (any, error) {
+				filter, err := graphQLFilter(args)
+				if err != nil {
+					return nil, err
+				}
+				parcels, err := a.FindParcels(filter)
+				return gqlList(parcels), err
+			},
+		},
+		"statusLabels": {args: []string{"lang"}, typ: statusLabel, resolve: func(_ any, args gqlArgs) (any, error) {
+			lang, err := args.string("lang")
+			if err != nil {
+				return nil, err
+			}
+			if lang == "" {
+				lang = DefaultLabelLang
+			}
+			labels, err := service.StatusLabels(lang)
+			return gqlList(labels), err
+		}},
+	}}
+
+	s.mutation = &gqlObject{name: "Mutation", fields: map[string]*gqlField{
+		"register": {
+			args: []string{"client", "address", "serviceClass", "weightGrams", "dimensions", "declaredValue",
+				"currency", "cashOnDelivery", "allowDuplicate", "pickupPoint", "recipientName", "recipientPhone",
+				"contents", "international", "country", "customsReference", "hsCodes", "idempotencyKey"},
+			typ: parcel,
+			resolve: func(_ any, args gqlArgs) (any, error) {
+				var draft Parcel
+				var dimensions string
+				var allowDuplicate bool
+				err := errors.Join(
+					args.intTo("client", &draft.Client),
+					args.stringTo("address", &draft.Address),
+					args.stringTo("serviceClass", &draft.ServiceClass),
+					args.intTo("weightGrams", &draft.WeightGrams),
+					args.stringTo("dimensions", &dimensions),
+					args.intTo("declaredValue", &draft.DeclaredValue),
+					args.stringTo("currency", &draft.Currency),
+					args.boolTo("cashOnDelivery", &draft.CashOnDelivery),
+					args.boolTo("allowDuplicate", &allowDuplicate),
+					args.intTo("pickupPoint", &draft.PickupPoint),
+					args.stringTo("recipientName", &draft.Recipient.Name),
+					args.stringTo("recipientPhone", &draft.Recipient.Phone),
+					args.stringsTo("contents", &draft.Contents),
+					args.boolTo("international", &draft.International),
+					args.stringTo("country", &draft.Country),
+					args.stringTo("customsReference", &draft.CustomsReference),
+					args.stringsTo("hsCodes", &draft.HSCodes),
+					args.stringTo("idempotencyKey", &draft.IdempotencyKey),
+				)
+				if err != nil {
+					return nil, err
+				}
+				if draft.Dimensions, err = ParseDimensions(dimensions); err != nil {
+					return nil, err
+				}
+				service := a
+				if allowDuplicate {
+					service = service.AllowDuplicates()
+				}
+				return service.Register(draft)
+			},
+		},
+		"setStatus": {args: []string{"number", "status"}, typ: parcel, resolve: func(_ any, args gqlArgs) (any, error) {
+			var number int
+			var status string
+			if err := errors.Join(args.intTo("number", &number), args.stringTo("status", &status)); err != nil {
+				return nil, err
+			}
+			return current(number, a.SetStatus(number, status))
+		}},
+		"setAddress": {args: []string{"number", "address"}, typ: parcel, resolve: func(_ any, args gqlArgs) (any, error) {
+			var number int
+			var address string
+			if err := errors.Join(args.intTo("number", &number), args.stringTo("address", &address)); err != nil {
+				return nil, err
+			}
+			return current(number, a.ChangeAddress(number, address))
+		}},
+	}}
+
+	// Subscription fields resolve against the published Event and are
+	// null for events they do not match.
+	s.subscription = &gqlObject{name: "Subscription", fields: map[string]*gqlField{
+		"statusChanged": {args: []string{"number", "client"}, typ: statusChanged, resolve: func(source any, args gqlArgs) (any, error) {
+			var number, client int
+			if err := errors.Join(args.intTo("number", &number), args.intTo("client", &client)); err != nil {
+				return nil, err
+			}
+			e := source.(Event)
+			if e.Type != EventStatusChanged || number != 0 && e.Parcel.Number != number ||
+				client != 0 && e.Parcel.Client != client {
+				return nil, nil
+			}
+			return e, nil
+		}},
+	}}
+	return s
+}
+
+// root returns the root type of operations of the given kind.
+func (s graphQLSchema) root(kind string) *gqlObject {
+	switch kind {
+	case "mutation":
+		return s.mutation
+	case "subscription":
+		return s.subscription
+	}
+	return s.query
+}
+
+// graphQLFilter builds a ParcelFilter from the arguments of Query.parcels.
+func graphQLFilter(args gqlArgs) (ParcelFilter, error) {
+	var f ParcelFilter
+	var order string
+	err := errors.Join(
+		args.intTo("client", &f.Client),
+		args.stringTo("status", &f.Status),
+		args.stringTo("serviceClass", &f.ServiceClass),
+		args.intTo("minWeight", &f.MinWeight),
+		args.intTo("maxWeight", &f.MaxWeight),
+		args.intTo("minValue", &f.MinDeclaredValue),
+		args.intTo("maxValue", &f.MaxDeclaredValue),
+		args.boolTo("duplicates", &f.SuspectedDuplicates),
+		args.stringTo("recipientPhone", &f.RecipientPhone),
+		args.stringTo("sort", &f.SortBy),
+		args.stringTo("order", &order),
+	)
+	if err != nil {
+		return f, err
+	}
+
+	switch strings.ToLower(order) {
+	case "", "asc":
+	case "desc":
+		f.Desc = true
+	default:
+		return f, errors.New(`argument "order" must be "asc" or "desc"`)
+	}
+	return f, nil
+}
+
+// gqlProperty returns a scalar field reading get from a source of type T.
+func gqlProperty[T any](get func(T) any) *gqlField {
+	return &gqlField{resolve: func(source any, _ gqlArgs) (any, error) {
+		return get(source.(T)), nil
+	}}
+}
+
+// gqlList converts a slice to the []any that list fields resolve to.
+func gqlList[T any](items []T) []any {
+	res := make([]any, len(items))
+	for i, item := range items {
+		res[i] = item
+	}
+	return res
+}
+
+// optional returns nil for the zero value of v, so that unset fields are
+// null in responses.
+func optional[T comparable](v T) any {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return v
+}
+
+func (a gqlArgs) intTo(name string, dst *int) (err error) {
+	*dst, err = a.int(name)
+	return err
+}
+
+func (a gqlArgs) stringTo(name string, dst *string) (err error) {
+	*dst, err = a.string(name)
+	return err
+}
+
+func (a gqlArgs) stringsTo(name string, dst *[]string) (err error) {
+	*dst, err = a.strings(name)
+	return err
+}
+
+func (a gqlArgs) boolTo(name string, dst *bool) (err error) {
+	*dst, err = a.bool(name)
+	return err
+}
+
+// graphQLRequest is the body of a POST /graphql request; GET requests
+// carry the same fields as query parameters.
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// graphQLResponse is the body of a /graphql response and of each
+// subscription event.
+type graphQLResponse struct {
+	Data   *gqlResult `json:"data,omitempty"`
+	Errors []gqlError `json:"errors,omitempty"`
+}
+
+// graphql serves /graphql. Queries may be sent with GET or POST and
+// mutations with POST only. A subscription is answered with a stream of
+// server-sent "next" events, one per matching parcel event, that lasts
+// until the client disconnects.
+//
+// Malformed documents, unknown fields and arguments fail the whole
+// request with 400. Errors of individual fields, e.g. a parcel that is
+// not found, are reported in "errors" next to the rest of the data.
+func (h apiHandler) graphql(w http.ResponseWriter, r *http.Request) {
+	var req graphQLRequest
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				writeGraphQLError(w, http.StatusBadRequest, fmt.Errorf("invalid variables: %w", err))
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := decodeJSON(r, &req); err != nil {
+			writeGraphQLError(w, http.StatusBadRequest, err)
+			return
+		}
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return
+	}
+
+	op, err := selectOperation(req.Query, req.OperationName)
+	if err != nil {
+		writeGraphQLError(w, http.StatusBadRequest, err)
+		return
+	}
+	if op.kind == "mutation" && r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	root := newGraphQLSchema(h.service, h.as(r)).root(op.kind)
+	if err := gqlValidate(root, op.sel, ""); err != nil {
+		writeGraphQLError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	vars := make(map[string]any, len(op.defaults)+len(req.Variables))
+	for k, v := range op.defaults {
+		vars[k] = v
+	}
+	for k, v := range req.Variables {
+		vars[k] = v
+	}
+
+	if op.kind == "subscription" {
+		h.graphqlSubscribe(w, r, root, op, vars)
+		return
+	}
+
+	e := &gqlExecutor{vars: vars}
+	data := e.object(root, nil, op.sel, nil)
+	writeJSON(w, http.StatusOK, graphQLResponse{Data: data, Errors: e.errors})
+}
+
+// graphqlSubscribe streams the results of a subscription operation as
+// "next" events.
+func (h apiHandler) graphqlSubscribe(w http.ResponseWriter, r *http.Request, root *gqlObject, op gqlOperation, vars map[string]any) {
+	subscribe := func(handler func(Event)) (func(), error) {
+		return h.as(r).Subscribe(handler)
+	}
+	serveEvents(w, r, subscribe, func(event Event) (string, []byte, bool) {
+		e := &gqlExecutor{vars: vars}
+		data := e.object(root, event, op.sel, nil)
+		if len(e.errors) == 0 && data.empty() {
+			return "", nil, false
+		}
+		body, err := json.Marshal(graphQLResponse{Data: data, Errors: e.errors})
+		return "next", body, err == nil
+	}, writeGraphQLError)
+}
+
+// selectOperation parses the document and returns the operation to run:
+// the one named name, or the only one if name is empty.
+func selectOperation(document, name string) (gqlOperation, error) {
+	ops, err := parseGraphQL(document)
+	if err != nil {
+		return gqlOperation{}, err
+	}
+	if name == "" {
+		if len(ops) > 1 {
+			return gqlOperation{}, errors.New("operationName is required for a document with several operations")
+		}
+		return ops[0], nil
+	}
+	for _, op := range ops {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return gqlOperation{}, fmt.Errorf("no operation named %q", name)
+}
+
+func writeGraphQLError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, graphQLResponse{Errors: []gqlError{newGQLError(err, nil)}})
+}
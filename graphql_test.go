@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// doGraphQL posts a GraphQL request to h and decodes the response.
+func doGraphQL(t *testing.T, h http.Handler, query string, vars map[string]any) (int, map[string]any) {
+	t.Helper()
+	body, err := json.Marshal(graphQLRequest{Query: query, Variables: vars})
+	require.NoError(t, err)
+	rec := doRequest(t, h, http.MethodPost, "/graphql", string(body))
+
+	var res map[string]any
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	return rec.Code, res
+}
+
+// TestParseGraphQL checks the supported syntax and the rejected one.
+func TestParseGraphQL(t *testing.T) {
+	ops, err := parseGraphQL(`
+		# list parcels
+		query List($client: Int = 1000, $order: String = DESC) {
+			all: parcels(client: $client, order: $order) { number, status }
+			one: parcel(trackingCode: "PKG-\"1\"") { __typename }
+		}
+		mutation { setStatus(number: 1, status: "sent") { status } }`)
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+
+	assert.Equal(t, "query", ops[0].kind)
+	assert.Equal(t, "List", ops[0].name)
+	assert.Equal(t, map[string]any{"client": 1000, "order": gqlEnum("DESC")}, ops[0].defaults)
+	require.Len(t, ops[0].sel, 2)
+	assert.Equal(t, "all", ops[0].sel[0].key())
+	assert.Equal(t, "parcels", ops[0].sel[0].name)
+	assert.Equal(t, gqlVariable("client"), ops[0].sel[0].args["client"])
+	assert.Len(t, ops[0].sel[0].sel, 2)
+	assert.Equal(t, `PKG-"1"`, ops[0].sel[1].args["trackingCode"])
+	assert.Equal(t, "mutation", ops[1].kind)
+
+	for _, doc := range []string{
+		"",
+		"{ parcels { ...fields } }",
+		"{ parcel(number: 1) @skip(if: true) { number } }",
+		"{ parcels { }",
+		`{ parcel(trackingCode: "open) { number } }`,
+		"query ($n: Int = $m) { parcel(number: $n) { number } }",
+		"subscribe { statusChanged { at } }",
+	} {
+		_, err := parseGraphQL(doc)
+		assert.ErrorIs(t, err, errGraphQLSyntax, doc)
+	}
+}
+
+// TestGraphQLQueriesAndMutations runs the parcel lifecycle through
+// /graphql, including field errors reported next to partial data.
+func TestGraphQLQueriesAndMutations(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service)
+
+	// register
+	code, res := doGraphQL(t, h, `mutation Register($address: String!) {
+		register(client: 1000, address: $address, weightGrams: 1200) { number status dueAt weightGrams }
+	}`, map[string]any{"address": "test"})
+	require.Equal(t, http.StatusOK, code)
+	require.Nil(t, res["errors"])
+	parcel := res["data"].(map[string]any)["register"].(map[string]any)
+	assert.Equal(t, float64(1), parcel["number"])
+	assert.Equal(t, ParcelStatusRegistered, parcel["status"])
+	assert.Equal(t, float64(1200), parcel["weightGrams"])
+
+	// unpaid parcels cannot be sent; the error is reported per field
+	code, res = doGraphQL(t, h, `mutation { setStatus(number: 1, status: "sent") { status } }`, nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Nil(t, res["data"].(map[string]any)["setStatus"])
+	require.Len(t, res["errors"], 1)
+	assert.Equal(t, []any{"setStatus"}, res["errors"].([]any)[0].(map[string]any)["path"])
+
+	require.NoError(t, service.SetPaymentStatus(1, PaymentPaid))
+	code, res = doGraphQL(t, h, `mutation {
+		sent: setStatus(number: 1, status: "sent") { status }
+		back: setStatus(number: 1, status: "registered") { status }
+	}`, nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]any{"status": ParcelStatusSent}, res["data"].(map[string]any)["sent"])
+	assert.Nil(t, res["data"].(map[string]any)["back"])
+	require.Len(t, res["errors"], 1)
+	assert.Contains(t, res["errors"].([]any)[0].(map[string]any)["message"], ErrStatusTransition.Error())
+
+	_, res = doGraphQL(t, h, `mutation { setAddress(number: 1, address: "new") { address } }`, nil)
+	assert.Contains(t, res["errors"].([]any)[0].(map[string]any)["message"], ErrRequireRegistered.Error())
+
+	// check
+	q := url.Values{"query": {`{ parcels(client: 1000, order: DESC) { number status history { status } } }`}}
+	rec := doRequest(t, h, http.MethodGet, "/graphql?"+q.Encode(), "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data": {"parcels": [{"number": 1, "status": "sent",
+		"history": [{"status": "registered"}, {"status": "sent"}]}]}}`, rec.Body.String())
+
+	_, res = doGraphQL(t, h, `{ parcel(number: 42) { number } }`, nil)
+	assert.Nil(t, res["data"].(map[string]any)["parcel"])
+	assert.Contains(t, res["errors"].([]any)[0].(map[string]any)["message"], ErrParcelNotFound.Error())
+
+	// invalid requests fail as a whole
+	code, _ = doGraphQL(t, h, `{ parcels { weight } }`, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = doGraphQL(t, h, `{ parcels }`, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = doGraphQL(t, h, `{ parcel(id: 1) { number } }`, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	q = url.Values{"query": {`mutation { setStatus(number: 1, status: "delivered") { status } }`}}
+	assert.Equal(t, http.StatusMethodNotAllowed, doRequest(t, h, http.MethodGet, "/graphql?"+q.Encode(), "").Code)
+}
+
+// TestGraphQLAuthorization checks that a client only sees its own parcels.
+func TestGraphQLAuthorization(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	_, err := service.Register(1000, "own")
+	require.NoError(t, err)
+	_, err = service.Register(2000, "other")
+	require.NoError(t, err)
+
+	asClient := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := ContextWithPrincipal(r.Context(), Principal{Role: RoleClient, Client: 1000})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+	h := NewHTTPHandler(service, asClient)
+
+	// check
+	_, res := doGraphQL(t, h, `{ parcels { address } other: parcel(number: 2) { address } }`, nil)
+	assert.Equal(t, []any{map[string]any{"address": "own"}}, res["data"].(map[string]any)["parcels"])
+	assert.Nil(t, res["data"].(map[string]any)["other"])
+	assert.Contains(t, res["errors"].([]any)[0].(map[string]any)["message"], ErrForbidden.Error())
+}
+
+// TestGraphQLSubscription streams status changes of one parcel.
+func TestGraphQLSubscription(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	first, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", Payment: PaymentPaid})
+	require.NoError(t, err)
+	second, err := service.RegisterParcel(Parcel{Client: 1000, Address: "other", Payment: PaymentPaid})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(NewHTTPHandler(service, AllowAnonymous(Principal{Role: RoleAdmin})))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	body, err := json.Marshal(graphQLRequest{
+		Query:     `subscription ($n: Int) { statusChanged(number: $n) { prevStatus parcel { number status } } }`,
+		Variables: map[string]any{"n": second.Number},
+	})
+	require.NoError(t, err)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/graphql", strings.NewReader(string(body)))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// change both parcels
+	require.NoError(t, service.NextStatus(first.Number))
+	require.NoError(t, service.NextStatus(second.Number))
+
+	// check
+	lines := bufio.NewScanner(resp.Body)
+	require.True(t, lines.Scan())
+	assert.Equal(t, "event: next", lines.Text())
+	require.True(t, lines.Scan())
+	assert.JSONEq(t, `{"data": {"statusChanged": {"prevStatus": "registered",
+		"parcel": {"number": 2, "status": "sent"}}}}`, strings.TrimPrefix(lines.Text(), "data: "))
+}
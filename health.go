@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrSchemaOutdated indicates a database whose schema is older than the
+// migrations of this build; see Migrate.
+var ErrSchemaOutdated = errors.New("database schema is not up to date")
+
+// healthCheckTimeout bounds each health check run by a probe.
+const healthCheckTimeout = 5 * time.Second
+
+// HealthCheck is a named check of a dependency or background worker.
+// Check returns a short description of what it found, and an error if the
+// checked part is not healthy.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) (detail string, err error)
+}
+
+// CheckResult is the outcome of one HealthCheck.
+type CheckResult struct {
+	Name     string
+	Detail   string
+	Err      error
+	Duration time.Duration
+}
+
+// HealthReport is the outcome of a set of health checks; it is healthy
+// if every check passed.
+type HealthReport struct {
+	Checks []CheckResult
+}
+
+// Healthy reports whether every check passed.
+func (r HealthReport) Healthy() bool {
+	for _, c := range r.Checks {
+		if c.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// runHealthChecks runs checks in order, each with healthCheckTimeout.
+func runHealthChecks(ctx context.Context, checks []HealthCheck) HealthReport {
+	report := HealthReport{Checks: make([]CheckResult, 0, len(checks))}
+	for _, c := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		start := time.Now()
+		detail, err := c.Check(checkCtx)
+		cancel()
+		report.Checks = append(report.Checks, CheckResult{Name: c.Name, Detail: detail, Err: err,
+			Duration: time.Since(start)})
+	}
+	return report
+}
+
+// Ping reports whether the database can be reached.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection or ErrStoreClosed if the store has not
+//     been initialised or was closed.
+//   - Wraps and returns the error if the database cannot be reached
+//     before ctx is done.
+func (s ParcelStore) Ping(ctx context.Context) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to reach database: %w", err)
+	}
+	return nil
+}
+
+// CheckSchema returns the schema version of the database and
+// ErrSchemaOutdated (wrapped) if migrations are pending; see
+// SchemaVersion for other errors.
+func (s ParcelStore) CheckSchema() (int, error) {
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return 0, err
+	}
+	if version < len(migrations) {
+		return version, fmt.Errorf("%w: version %d of %d", ErrSchemaOutdated, version, len(migrations))
+	}
+	return version, nil
+}
+
+// WithLivenessChecks returns a copy of the service whose Liveness also
+// runs checks, e.g. those of a Scheduler (see Scheduler.HealthChecks).
+func (s ParcelService) WithLivenessChecks(checks ...HealthCheck) ParcelService {
+	s.liveness = append(append([]HealthCheck(nil), s.liveness...), checks...)
+	return s
+}
+
+// Liveness runs the checks added with WithLivenessChecks: the process
+// needs restarting if one fails.
+func (s ParcelService) Liveness(ctx context.Context) HealthReport {
+	return runHealthChecks(ctx, s.liveness)
+}
+
+// Readiness checks that the service can serve requests: the "database"
+// check pings it and the "schema" check compares its schema version with
+// the migrations of this build.
+func (s ParcelService) Readiness(ctx context.Context) HealthReport {
+	return runHealthChecks(ctx, []HealthCheck{
+		{Name: "database", Check: func(ctx context.Context) (string, error) {
+			return "", s.store.Ping(ctx)
+		}},
+		{Name: "schema", Check: func(context.Context) (string, error) {
+			version, err := s.store.CheckSchema()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("version %d", version), nil
+		}},
+	})
+}
+
+// healthJSON is the response of /healthz and /readyz.
+type healthJSON struct {
+	// Status is "ok", or "unavailable" if a check failed.
+	Status string      `json:"status"`
+	Error  string      `json:"error,omitempty"`
+	Checks []checkJSON `json:"checks"`
+}
+
+type checkJSON struct {
+	Name string `json:"name"`
+	// Status is "ok" or "failing".
+	Status     string `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// writeHealth answers with report: 200 if it is healthy, 503 otherwise.
+func writeHealth(w http.ResponseWriter, report HealthReport) {
+	res := healthJSON{Status: "ok", Checks: make([]checkJSON, 0, len(report.Checks))}
+	status := http.StatusOK
+	for _, c := range report.Checks {
+		check := checkJSON{Name: c.Name, Status: "ok", Detail: c.Detail, DurationMS: c.Duration.Milliseconds()}
+		if c.Err != nil {
+			check.Status, check.Error = "failing", c.Err.Error()
+			res.Status, status = "unavailable", http.StatusServiceUnavailable
+		}
+		res.Checks = append(res.Checks, check)
+	}
+	writeJSON(w, status, res)
+}
+
+// healthz serves /healthz, the liveness probe: the checks added with
+// ParcelService.WithLivenessChecks, such as those of background jobs.
+func (h apiHandler) healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, h.service.Liveness(r.Context()))
+}
+
+// readyz serves /readyz, the readiness probe: ParcelService.Readiness,
+// failing while the server shuts down.
+func (h apiHandler) readyz(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-shuttingDown(r.Context()):
+		writeJSON(w, http.StatusServiceUnavailable, healthJSON{Status: "unavailable", Error: "shutting down",
+			Checks: []checkJSON{}})
+		return
+	default:
+	}
+	writeHealth(w, h.service.Readiness(r.Context()))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPingAndCheckSchema verifies that Ping fails for closed stores and
+// CheckSchema for pending migrations.
+func TestPingAndCheckSchema(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	// check
+	require.NoError(t, store.Ping(context.Background()))
+	version, err := store.CheckSchema()
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations), version)
+
+	raw, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer raw.Close()
+	raw.SetMaxOpenConns(1)
+	_, err = raw.Exec(testSchema)
+	require.NoError(t, err)
+	version, err = NewParcelStore(raw).CheckSchema()
+	require.ErrorIs(t, err, ErrSchemaOutdated)
+	assert.Zero(t, version)
+
+	require.NoError(t, store.Close())
+	require.ErrorIs(t, store.Ping(context.Background()), ErrStoreClosed)
+}
+
+// TestProbes verifies the diagnostics of the liveness and readiness
+// endpoints.
+func TestProbes(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	stalled := errors.New("stalled")
+	var failing bool
+	service := NewParcelService(store, nil).WithLivenessChecks(HealthCheck{Name: "job:test",
+		Check: func(context.Context) (string, error) {
+			if failing {
+				return "", stalled
+			}
+			return "fine", nil
+		}})
+	h := NewHTTPHandler(service)
+	probe := func(path string, status int) healthJSON {
+		t.Helper()
+		rec := doRequest(t, h, http.MethodGet, path, "")
+		require.Equal(t, status, rec.Code)
+		var res healthJSON
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		for i := range res.Checks {
+			res.Checks[i].DurationMS = 0
+		}
+		return res
+	}
+
+	// check
+	assert.Equal(t, healthJSON{Status: "ok", Checks: []checkJSON{{Name: "job:test", Status: "ok", Detail: "fine"}}},
+		probe("/healthz", http.StatusOK))
+	assert.Equal(t, healthJSON{Status: "ok", Checks: []checkJSON{
+		{Name: "database", Status: "ok"},
+		{Name: "schema", Status: "ok", Detail: fmt.Sprintf("version %d", len(migrations))},
+	}}, probe("/readyz", http.StatusOK))
+
+	failing = true
+	assert.Equal(t, healthJSON{Status: "unavailable", Checks: []checkJSON{
+		{Name: "job:test", Status: "failing", Error: "stalled"},
+	}}, probe("/healthz", http.StatusServiceUnavailable))
+
+	require.NoError(t, store.Close())
+	res := probe("/readyz", http.StatusServiceUnavailable)
+	assert.Equal(t, "unavailable", res.Status)
+	require.Len(t, res.Checks, 2)
+	assert.Equal(t, "failing", res.Checks[0].Status)
+	assert.Equal(t, ErrStoreClosed.Error(), res.Checks[0].Error)
+}
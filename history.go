@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// StatusChange is one entry of a parcel's status history.
+type StatusChange struct {
+	Number    int
+	Status    string
+	ChangedAt string
+	Note      string
+	// Actor made the change (see Actor.String); AddHistory fills it in
+	// from the store if it is empty.
+	Actor string
+}
+
+// AddHistory appends an entry to the status history of parcel c.Number.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrNewStatusUnrecognised (wrapped) for an unknown status.
+//   - Records the actor of the store (see WithActor) unless c.Actor is set.
+//   - Wraps and returns any SQL error from the INSERT.
+func (s ParcelStore) AddHistory(c StatusChange) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	if !knownStatus(c.Status) {
+		return fmt.Errorf("failed to add history for parcel with number %d: %w %q", c.Number, ErrNewStatusUnrecognised, c.Status)
+	}
+
+	if c.Actor == "" {
+		c.Actor = s.actor.String()
+	}
+	query := `INSERT INTO parcel_status_history (parcel_number, status, changed_at, note, actor)
+VALUES (:number, :status, :changed_at, :note, :actor)`
+	_, err := s.conn().Exec(query, sql.Named("number", c.Number), sql.Named("status", c.Status),
+		sql.Named("changed_at", c.ChangedAt), sql.Named("note", c.Note), sql.Named("actor", c.Actor))
+	if err != nil {
+		return fmt.Errorf("failed to add history for parcel with number %d: %w", c.Number, err)
+	}
+	return nil
+}
+
+// GetHistory returns the status history of a parcel, oldest entry first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if the parcel has no history.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) GetHistory(number int) ([]StatusChange, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT parcel_number, status, changed_at, note, actor FROM parcel_status_history
+WHERE parcel_number = :number ORDER BY id`
+	rows, err := s.conn().Query(query, sql.Named("number", number))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for history of parcel %d: %w", number, err)
+	}
+	defer rows.Close()
+
+	var res []StatusChange
+	for rows.Next() {
+		var c StatusChange
+
+		err := rows.Scan(&c.Number, &c.Status, &c.ChangedAt, &c.Note, &c.Actor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan one of history rows for parcel %d: %w", number, err)
+		}
+		res = append(res, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate history rows for parcel %d: %w", number, err)
+	}
+	return res, nil
+}
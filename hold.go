@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kinds of Hold.
+const (
+	HoldCustoms  = "customs"  // held by customs, e.g. for inspection
+	HoldPayment  = "payment"  // held until a payment dispute is settled
+	HoldCustomer = "customer" // held at the request of the client
+)
+
+var (
+	// ErrParcelHeld indicates a status change of a parcel on hold.
+	ErrParcelHeld = newError(CodeParcelHeld, "parcel on hold")
+	// ErrNotHeld indicates releasing a parcel that is not on hold.
+	ErrNotHeld = newError(CodeNotHeld, "parcel not on hold")
+	// ErrInvalidHold indicates a hold of an unknown kind, without a reason
+	// or an actor, or of a delivered parcel.
+	ErrInvalidHold = newError(CodeInvalidHold, "invalid hold")
+)
+
+// Hold pauses a parcel: while it is set, the parcel keeps its status and
+// does not move through the lifecycle. It is independent of the status,
+// so a parcel may be held whether registered, sent or cleared.
+type Hold struct {
+	// Kind is one of the Hold constants.
+	Kind   string
+	Reason string
+	// Actor identifies who placed the hold.
+	Actor string
+	// PlacedAt is the RFC 3339 time the hold was placed.
+	PlacedAt string
+}
+
+// IsZero reports whether the parcel is not on hold.
+func (h Hold) IsZero() bool {
+	return h == Hold{}
+}
+
+// knownHold reports whether kind is one of the Hold constants.
+func knownHold(kind string) bool {
+	switch kind {
+	case HoldCustoms, HoldPayment, HoldCustomer:
+		return true
+	}
+	return false
+}
+
+// SetHold places h on the parcel, replacing any hold it had, or releases
+// it if h is zero.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) SetHold(number int, h Hold) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	s.invalidateParcel(number)
+	query := `UPDATE parcel SET hold_kind = :kind, hold_reason = :reason, hold_actor = :actor, held_at = :at
+WHERE number = :number`
+	_, err := s.conn().Exec(query, sql.Named("kind", h.Kind), sql.Named("reason", h.Reason),
+		sql.Named("actor", h.Actor), sql.Named("at", h.PlacedAt), sql.Named("number", number))
+	if err != nil {
+		return fmt.Errorf("failed to set hold of parcel %d: %w", number, err)
+	}
+	return nil
+}
+
+// Hold puts the parcel on hold: NextStatus, scans and deliveries fail
+// with ErrParcelHeld until it is released with Release. ForceSetStatus,
+// which bypasses the lifecycle, still applies. Placing a hold on a held
+// parcel replaces the hold.
+//
+// Behaviour:
+//   - Returns ErrInvalidHold (wrapped) for an unknown kind, if reason or
+//     actor is blank, or for a delivered parcel, which has nowhere left to
+//     move.
+//   - Returns ErrParcelNotFound (wrapped) if the parcel does not exist.
+func (s ParcelService) Hold(number int, kind, reason, actor string) (Hold, error) {
+	h := Hold{Kind: strings.TrimSpace(kind), Reason: strings.TrimSpace(reason), Actor: strings.TrimSpace(actor)}
+	switch {
+	case !knownHold(h.Kind):
+		return Hold{}, fmt.Errorf("failed to hold parcel %d: %w: unknown kind %q", number, ErrInvalidHold, h.Kind)
+	case h.Reason == "":
+		return Hold{}, fmt.Errorf("failed to hold parcel %d: %w: a reason is required", number, ErrInvalidHold)
+	case h.Actor == "":
+		return Hold{}, fmt.Errorf("failed to hold parcel %d: %w: an actor is required", number, ErrInvalidHold)
+	}
+	h.PlacedAt = s.timestamp(time.Now())
+
+	err := s.store.InTx(func(tx ParcelStore) error {
+		parcel, err := tx.Get(number)
+		if err != nil {
+			return err
+		}
+		if parcel.Status == ParcelStatusDelivered {
+			return fmt.Errorf("failed to hold parcel %d: %w: already delivered", number, ErrInvalidHold)
+		}
+		return tx.SetHold(number, h)
+	})
+	if err != nil {
+		return Hold{}, mapError(err)
+	}
+	return h, nil
+}
+
+// Release takes the parcel off hold, letting it move on from the status
+// it was held in. Its estimated delivery time moves on by the time it was
+// held.
+//
+// Behaviour:
+//   - Returns ErrParcelNotFound (wrapped) if the parcel does not exist.
+//   - Returns ErrNotHeld (wrapped) if it is not on hold.
+func (s ParcelService) Release(number int) error {
+	now := time.Now()
+	err := s.store.InTx(func(tx ParcelStore) error {
+		parcel, err := tx.Get(number)
+		if err != nil {
+			return err
+		}
+		if parcel.Hold.IsZero() {
+			return fmt.Errorf("failed to release parcel %d: %w", number, ErrNotHeld)
+		}
+		if err := tx.SetHold(number, Hold{}); err != nil {
+			return err
+		}
+		return s.delayETA(tx, parcel, now)
+	})
+	return mapError(err)
+}
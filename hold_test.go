@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHold verifies that a hold blocks status transitions, records who
+// placed it and why, and that releasing it lets the parcel move on.
+func TestHold(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	number := getSentParcel(t, service)
+
+	// check
+	for name, args := range map[string][3]string{
+		"unknown kind": {"whim", "reason", "anna"},
+		"no reason":    {HoldCustoms, " ", "anna"},
+		"no actor":     {HoldCustoms, "inspection", ""},
+	} {
+		_, err := service.Hold(number, args[0], args[1], args[2])
+		assert.ErrorIs(t, err, ErrInvalidHold, name)
+	}
+	assert.ErrorIs(t, service.Release(number), ErrNotHeld)
+
+	hold, err := service.Hold(number, HoldCustoms, " inspection ", "anna")
+	require.NoError(t, err)
+	parcel, err := service.Get(number)
+	require.NoError(t, err)
+	assert.Equal(t, hold, parcel.Hold)
+	assert.Equal(t, "inspection", parcel.Hold.Reason)
+	assert.Equal(t, ParcelStatusSent, parcel.Status)
+
+	assert.ErrorIs(t, service.NextStatus(number), ErrParcelHeld)
+	_, err = service.RecordScan(number, ScanDelivery, Location{Description: "door"}, time.Time{})
+	assert.ErrorIs(t, err, ErrParcelHeld)
+
+	require.NoError(t, service.Release(number))
+	require.NoError(t, service.NextStatus(number))
+	parcel, err = service.Get(number)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusDelivered, parcel.Status)
+	assert.True(t, parcel.Hold.IsZero())
+
+	_, err = service.Hold(number, HoldCustomer, "away", "anna")
+	assert.ErrorIs(t, err, ErrInvalidHold)
+	_, err = service.Hold(999, HoldCustomer, "away", "anna")
+	assert.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestAuthorizedHold verifies that clients may only place and release
+// holds at their own request.
+func TestAuthorizedHold(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	number := getSentParcel(t, service)
+	parcel, err := service.Get(number)
+	require.NoError(t, err)
+	client := NewAuthorizedService(service, Principal{Role: RoleClient, Client: parcel.Client})
+	operator := NewAuthorizedService(service, Principal{Role: RoleOperator})
+
+	// check
+	_, err = client.Hold(number, HoldPayment, "dispute", "")
+	assert.ErrorIs(t, err, ErrForbidden)
+	hold, err := client.Hold(number, HoldCustomer, "on holiday", "")
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("client %d", parcel.Client), hold.Actor)
+	require.NoError(t, client.Release(number))
+
+	_, err = operator.Hold(number, HoldPayment, "dispute", "bob")
+	require.NoError(t, err)
+	assert.ErrorIs(t, client.Release(number), ErrForbidden)
+	assert.NoError(t, operator.Release(number))
+}
+
+// TestHTTPHold verifies the hold endpoints.
+func TestHTTPHold(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service)
+	number := getSentParcel(t, service)
+	target := fmt.Sprintf("/parcels/%d/hold", number)
+
+	// check
+	rec := doRequest(t, h, http.MethodPost, target, `{"kind": "customs", "reason": "inspection", "actor": "anna"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var res parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	require.NotNil(t, res.Hold)
+	assert.Equal(t, HoldCustoms, res.Hold.Kind)
+	assert.Equal(t, "inspection", res.Hold.Reason)
+
+	rec = doRequest(t, h, http.MethodPost, fmt.Sprintf("/parcels/%d/scans", number), `{"type": "delivery", "description": "door"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	rec = doRequest(t, h, http.MethodPost, target, `{"kind": "whim", "reason": "x"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(t, h, http.MethodDelete, target, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	res = parcelJSON{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	assert.Nil(t, res.Hold)
+	rec = doRequest(t, h, http.MethodDelete, target, "")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	rec = doRequest(t, h, http.MethodGet, target, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,3025 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parcelJSON is the representation of a Parcel in the REST API. It is
+// kept separate from Parcel so that the wire format stays stable when
+// the model changes.
+type parcelJSON struct {
+	ID           string `json:"id"` // public ID; see Parcel.PublicID
+	Number       int    `json:"number"`
+	TrackingCode string `json:"tracking_code"`
+	Client       int    `json:"client"`
+	ClientRef    int    `json:"client_ref"`
+	Status       string `json:"status"`
+	StatusLabel  string `json:"status_label"` // Status in the language of the request
+	ServiceClass string `json:"service_class"`
+	Address      string `json:"address"`
+	CreatedAt    string `json:"created_at"`
+	DueAt        string `json:"due_at,omitempty"`
+	SentAt       string `json:"sent_at,omitempty"`
+	DeliveredAt  string `json:"delivered_at,omitempty"`
+	// EstimatedDeliveryAt is when the parcel is expected to be delivered.
+	EstimatedDeliveryAt string              `json:"estimated_delivery_at,omitempty"`
+	Delays              int                 `json:"delays,omitempty"` // estimates missed
+	Attributes          map[string]string   `json:"attributes,omitempty"`
+	WeightGrams         int                 `json:"weight_grams,omitempty"`
+	Dimensions          string              `json:"dimensions,omitempty"` // "LxWxH" in millimetres
+	DeclaredValue       int                 `json:"declared_value,omitempty"`
+	Zone                string              `json:"zone,omitempty"`
+	Price               int                 `json:"price,omitempty"`
+	Currency            string              `json:"currency"` // ISO 4217 code of declared_value and price
+	Payment             string              `json:"payment"`
+	CashOnDelivery      bool                `json:"cash_on_delivery"`
+	DuplicateOf         int                 `json:"duplicate_of,omitempty"`
+	Latitude            *float64            `json:"latitude,omitempty"`
+	Longitude           *float64            `json:"longitude,omitempty"`
+	PickupPoint         int                 `json:"pickup_point,omitempty"`
+	Recipient           *recipientJSON      `json:"recipient,omitempty"`
+	Contents            []string            `json:"contents,omitempty"`
+	Repacked            bool                `json:"repacked,omitempty"`
+	International       bool                `json:"international,omitempty"`
+	Country             string              `json:"country,omitempty"`
+	CustomsReference    string              `json:"customs_reference,omitempty"`
+	HSCodes             []string            `json:"hs_codes,omitempty"`
+	DeliveryWindow      *deliveryWindowJSON `json:"delivery_window,omitempty"`
+	Hold                *holdJSON           `json:"hold,omitempty"`
+}
+
+type holdJSON struct {
+	Kind     string `json:"kind"`
+	Reason   string `json:"reason"`
+	Actor    string `json:"actor"`
+	PlacedAt string `json:"placed_at"`
+}
+
+type recipientJSON struct {
+	Name  string `json:"name"`
+	Phone string `json:"phone"`
+}
+
+func toParcelJSON(p Parcel, labels Labels) parcelJSON {
+	res := parcelJSON{
+		ID:                  p.PublicID,
+		Number:              p.Number,
+		TrackingCode:        p.TrackingCode,
+		Client:              p.Client,
+		ClientRef:           p.ClientRef,
+		Status:              p.Status,
+		StatusLabel:         labels.Name(p.Status),
+		ServiceClass:        p.ServiceClass,
+		Address:             p.Address,
+		CreatedAt:           p.CreatedAt,
+		DueAt:               p.DueAt,
+		SentAt:              p.SentAt,
+		DeliveredAt:         p.DeliveredAt,
+		EstimatedDeliveryAt: p.EstimatedDeliveryAt,
+		Delays:              p.Delays,
+		Attributes:          p.Attributes,
+		WeightGrams:         p.WeightGrams,
+		Dimensions:          p.Dimensions.String(),
+		DeclaredValue:       p.DeclaredValue,
+		Zone:                p.Zone,
+		Price:               p.Price,
+		Currency:            p.Currency,
+		Payment:             p.Payment,
+		CashOnDelivery:      p.CashOnDelivery,
+		DuplicateOf:         p.DuplicateOf,
+		PickupPoint:         p.PickupPoint,
+		Contents:            p.Contents,
+		Repacked:            p.Repacked,
+		International:       p.International,
+		Country:             p.Country,
+		CustomsReference:    p.CustomsReference,
+		HSCodes:             p.HSCodes,
+		DeliveryWindow:      toDeliveryWindowJSON(p.DeliveryWindow),
+	}
+	if p.Coordinates != nil {
+		res.Latitude, res.Longitude = &p.Coordinates.Lat, &p.Coordinates.Lon
+	}
+	if !p.Hold.IsZero() {
+		res.Hold = &holdJSON{Kind: p.Hold.Kind, Reason: p.Hold.Reason, Actor: p.Hold.Actor, PlacedAt: p.Hold.PlacedAt}
+	}
+	if !p.Recipient.IsZero() {
+		res.Recipient = &recipientJSON{Name: p.Recipient.Name, Phone: p.Recipient.Phone}
+	}
+	return res
+}
+
+type parcelLinkJSON struct {
+	Parent    int    `json:"parent"`
+	Child     int    `json:"child"`
+	Kind      string `json:"kind"`
+	CreatedAt string `json:"created_at"`
+}
+
+type addressHistoryJSON struct {
+	Address string `json:"address"`
+	Status  string `json:"status"`
+	SetAt   string `json:"set_at"`
+	Actor   string `json:"actor,omitempty"`
+}
+
+type statusChangeJSON struct {
+	Status    string `json:"status"`
+	ChangedAt string `json:"changed_at"`
+	Note      string `json:"note,omitempty"`
+	Actor     string `json:"actor,omitempty"`
+}
+
+type statusLabelJSON struct {
+	Status      string `json:"status"`
+	Lang        string `json:"lang"`
+	DisplayName string `json:"display_name"`
+	Color       string `json:"color,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type routeJSON struct {
+	ID        int             `json:"id"`
+	Courier   string          `json:"courier"`
+	Day       string          `json:"day"`
+	CreatedAt string          `json:"created_at"`
+	Stops     []routeStopJSON `json:"stops"`
+}
+
+type routeStopJSON struct {
+	Parcel      int    `json:"parcel"`
+	Position    int    `json:"position"`
+	CompletedAt string `json:"completed_at,omitempty"`
+	WindowFrom  string `json:"window_from,omitempty"`
+	WindowTo    string `json:"window_to,omitempty"`
+}
+
+func toRouteJSON(r Route) routeJSON {
+	res := routeJSON{ID: r.ID, Courier: r.Courier, Day: r.Day, CreatedAt: r.CreatedAt, Stops: []routeStopJSON{}}
+	for _, stop := range r.Stops {
+		res.Stops = append(res.Stops, routeStopJSON(stop))
+	}
+	return res
+}
+
+type orderJSON struct {
+	ID        int    `json:"id"`
+	Client    int    `json:"client"`
+	CreatedAt string `json:"created_at"`
+	Parcels   []int  `json:"parcels"`
+	Status    string `json:"status"`
+}
+
+type claimJSON struct {
+	ID          int    `json:"id"`
+	Parcel      int    `json:"parcel"`
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	Amount      int    `json:"amount"`
+	Payout      int    `json:"payout"`
+	Status      string `json:"status"`
+	Resolution  string `json:"resolution,omitempty"`
+	FiledAt     string `json:"filed_at"`
+	ResolvedAt  string `json:"resolved_at,omitempty"`
+}
+
+func toClaimJSON(c Claim) claimJSON {
+	return claimJSON{ID: c.ID, Parcel: c.Number, Kind: c.Kind, Description: c.Description, Amount: c.Amount,
+		Payout: c.Payout, Status: c.Status, Resolution: c.Resolution, FiledAt: c.FiledAt, ResolvedAt: c.ResolvedAt}
+}
+
+type parcelTemplateJSON struct {
+	ID           int    `json:"id"`
+	Client       int    `json:"client"`
+	Name         string `json:"name"`
+	Address      string `json:"address"`
+	ServiceClass string `json:"service_class"`
+	WeightGrams  int    `json:"weight_grams"`
+	CreatedAt    string `json:"created_at"`
+}
+
+type draftJSON struct {
+	ID         int             `json:"id"`
+	Client     int             `json:"client"`
+	Parcel     registerRequest `json:"parcel"`
+	ActivateAt string          `json:"activate_at,omitempty"`
+	CreatedAt  string          `json:"created_at"`
+	UpdatedAt  string          `json:"updated_at"`
+	Attempts   int             `json:"attempts,omitempty"`
+	LastError  string          `json:"last_error,omitempty"`
+}
+
+func toDraftJSON(d ParcelDraft) draftJSON {
+	return draftJSON{ID: d.ID, Client: d.Parcel.Client, Parcel: toRegisterRequest(d.Parcel), ActivateAt: d.ActivateAt,
+		CreatedAt: d.CreatedAt, UpdatedAt: d.UpdatedAt, Attempts: d.Attempts, LastError: d.LastError}
+}
+
+type savedAddressJSON struct {
+	ID        int    `json:"id"`
+	Client    int    `json:"client"`
+	Label     string `json:"label"`
+	Address   string `json:"address"`
+	Default   bool   `json:"default"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+type workItemJSON struct {
+	ID         int    `json:"id"`
+	Parcel     int    `json:"parcel"`
+	Kind       string `json:"kind"`
+	Detail     string `json:"detail"`
+	State      string `json:"state"`
+	Assignee   string `json:"assignee,omitempty"`
+	Resolution string `json:"resolution,omitempty"`
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+	ResolvedAt string `json:"resolved_at,omitempty"`
+}
+
+func toWorkItemJSON(w WorkItem) workItemJSON {
+	return workItemJSON{ID: w.ID, Parcel: w.Number, Kind: w.Kind, Detail: w.Detail, State: w.State,
+		Assignee: w.Assignee, Resolution: w.Resolution, CreatedAt: w.CreatedAt, UpdatedAt: w.UpdatedAt,
+		ResolvedAt: w.ResolvedAt}
+}
+
+type contentRestrictionJSON struct {
+	ID        int    `json:"id"`
+	Category  string `json:"category"`
+	Zone      string `json:"zone,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type pickupPointJSON struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Capacity int    `json:"capacity"`
+	Occupied int    `json:"occupied"`
+}
+
+type warehouseJSON struct {
+	ID      int    `json:"id"`
+	Code    string `json:"code"`
+	Name    string `json:"name"`
+	Address string `json:"address,omitempty"`
+}
+
+type locationJSON struct {
+	Warehouse   int    `json:"warehouse,omitempty"`
+	Description string `json:"description,omitempty"`
+	ScannedAt   string `json:"scanned_at"`
+}
+
+type scanJSON struct {
+	Type        string `json:"type"`
+	Warehouse   int    `json:"warehouse,omitempty"`
+	Description string `json:"description,omitempty"`
+	ScannedAt   string `json:"scanned_at"`
+	RecordedAt  string `json:"recorded_at"`
+}
+
+type syncResultJSON struct {
+	ID     string    `json:"id"`
+	Parcel int       `json:"parcel"`
+	Status string    `json:"status"`
+	Scan   *scanJSON `json:"scan,omitempty"`
+	Error  string    `json:"error,omitempty"`
+	Code   ErrorCode `json:"code,omitempty"`
+}
+
+func toSyncResultJSON(res SyncResult) syncResultJSON {
+	out := syncResultJSON{ID: res.ID, Parcel: res.Number, Status: res.Status}
+	if res.Err != nil {
+		out.Error, out.Code = res.Err.Error(), ErrorCodeOf(res.Err)
+	} else {
+		sc := toScanJSON(res.Scan)
+		out.Scan = &sc
+	}
+	return out
+}
+
+func toScanJSON(sc Scan) scanJSON {
+	return scanJSON{Type: sc.Type, Warehouse: sc.Warehouse, Description: sc.Description,
+		ScannedAt: sc.ScannedAt, RecordedAt: sc.RecordedAt}
+}
+
+type proofJSON struct {
+	Kind        string `json:"kind"`
+	ContentType string `json:"content_type,omitempty"`
+	Reference   string `json:"reference,omitempty"`
+	// Size is the size of the image kept in the database, 0 if none.
+	Size       int    `json:"size,omitempty"`
+	RecordedAt string `json:"recorded_at"`
+}
+
+func toProofJSON(p Proof) proofJSON {
+	return proofJSON{Kind: p.Kind, ContentType: p.ContentType, Reference: p.Reference, Size: len(p.Data),
+		RecordedAt: p.RecordedAt}
+}
+
+type statusOverrideJSON struct {
+	ID           int    `json:"id"`
+	OldStatus    string `json:"old_status"`
+	NewStatus    string `json:"new_status"`
+	Reason       string `json:"reason"`
+	Actor        string `json:"actor"`
+	OverriddenAt string `json:"overridden_at"`
+}
+
+func toStatusOverrideJSON(o StatusOverride) statusOverrideJSON {
+	return statusOverrideJSON{ID: o.ID, OldStatus: o.OldStatus, NewStatus: o.NewStatus, Reason: o.Reason,
+		Actor: o.Actor, OverriddenAt: o.OverriddenAt}
+}
+
+type commentJSON struct {
+	ID        int    `json:"id"`
+	Author    string `json:"author"`
+	Text      string `json:"text"`
+	CreatedAt string `json:"created_at"`
+}
+
+func toCommentJSON(c Comment) commentJSON {
+	return commentJSON{ID: c.ID, Author: c.Author, Text: c.Text, CreatedAt: c.CreatedAt}
+}
+
+// trackingJSON is the public view of a parcel served by /track/{code}.
+type trackingJSON struct {
+	TrackingCode string              `json:"tracking_code"`
+	Status       string              `json:"status"`
+	StatusLabel  string              `json:"status_label"`
+	City         string              `json:"city,omitempty"`
+	History      []trackingEventJSON `json:"history"`
+	// EstimatedDeliveryAt is when the parcel is expected, until delivered.
+	EstimatedDeliveryAt string `json:"estimated_delivery_at,omitempty"`
+	// Delayed is set while the parcel is late; see Parcel.Delays.
+	Delayed bool `json:"delayed,omitempty"`
+	// DeliveryWindow is the window the recipient chose, if any.
+	DeliveryWindow *deliveryWindowJSON `json:"delivery_window,omitempty"`
+}
+
+type deliveryWindowJSON struct {
+	Day  string `json:"day"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// toDeliveryWindowJSON returns nil for a zero window.
+func toDeliveryWindowJSON(w DeliveryWindow) *deliveryWindowJSON {
+	if w.IsZero() {
+		return nil
+	}
+	return &deliveryWindowJSON{Day: w.Day, From: w.From, To: w.To}
+}
+
+type deliverySlotJSON struct {
+	Day       string `json:"day"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Capacity  int    `json:"capacity"`
+	Remaining int    `json:"remaining"`
+}
+
+type trackingEventJSON struct {
+	Status      string `json:"status"`
+	StatusLabel string `json:"status_label"`
+	ChangedAt   string `json:"changed_at"`
+}
+
+func toTrackingJSON(v TrackingView, labels Labels) trackingJSON {
+	res := trackingJSON{TrackingCode: v.Code, Status: v.Status, StatusLabel: labels.Name(v.Status), City: v.City,
+		History: []trackingEventJSON{}, EstimatedDeliveryAt: v.EstimatedDeliveryAt, Delayed: v.Delayed,
+		DeliveryWindow: toDeliveryWindowJSON(v.DeliveryWindow)}
+	for _, e := range v.History {
+		res.History = append(res.History,
+			trackingEventJSON{Status: e.Status, StatusLabel: labels.Name(e.Status), ChangedAt: e.At})
+	}
+	return res
+}
+
+type errorJSON struct {
+	Error string `json:"error"`
+	// Code is the ErrorCode of the error; unlike Error it never changes.
+	Code ErrorCode `json:"code"`
+	// Fields lists the rejected fields of a parcel that failed validation.
+	Fields []fieldErrorJSON `json:"fields,omitempty"`
+}
+
+type fieldErrorJSON struct {
+	Field string    `json:"field"`
+	Code  ErrorCode `json:"code"`
+	Error string    `json:"error"`
+}
+
+// toFieldErrorsJSON returns the rejected fields of a *ValidationError in
+// the chain of err, or nil if there is none.
+func toFieldErrorsJSON(err error) []fieldErrorJSON {
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		return nil
+	}
+	res := make([]fieldErrorJSON, 0, len(verr.Fields))
+	for _, f := range verr.Fields {
+		res = append(res, fieldErrorJSON{Field: f.Field, Code: ErrorCodeOf(f.Err), Error: f.Err.Error()})
+	}
+	return res
+}
+
+// Request bodies; fields tagged omitempty are optional.
+
+type registerRequest struct {
+	Client         int    `json:"client"`
+	Address        string `json:"address,omitempty"`
+	ServiceClass   string `json:"service_class,omitempty"` // standard if empty
+	WeightGrams    int    `json:"weight_grams,omitempty"`
+	Dimensions     string `json:"dimensions,omitempty"` // "LxWxH" in millimetres
+	DeclaredValue  int    `json:"declared_value,omitempty"`
+	Currency       string `json:"currency,omitempty"` // of declared_value, RUB if empty
+	CashOnDelivery bool   `json:"cash_on_delivery,omitempty"`
+	AllowDuplicate bool   `json:"allow_duplicate,omitempty"`
+	PickupPoint    int    `json:"pickup_point,omitempty"`
+	// Recipient is who the parcel is delivered to, if not the client.
+	Recipient *recipientJSON `json:"recipient,omitempty"`
+	// Contents are the categories of dangerous or restricted goods held.
+	Contents []string `json:"contents,omitempty"`
+	// International parcels go to Country, an ISO 3166-1 alpha-2 code,
+	// with an optional customs declaration.
+	International    bool     `json:"international,omitempty"`
+	Country          string   `json:"country,omitempty"`
+	CustomsReference string   `json:"customs_reference,omitempty"`
+	HSCodes          []string `json:"hs_codes,omitempty"`
+	// SavedAddress is the id of an address in the client's address book
+	// to deliver to instead of Address; without either, and without a
+	// pickup point, the parcel goes to the client's default address.
+	SavedAddress int `json:"saved_address,omitempty"`
+}
+
+// draft returns the parcel req asks to register.
+func (req registerRequest) draft() (Parcel, error) {
+	dimensions, err := ParseDimensions(req.Dimensions)
+	if err != nil {
+		return Parcel{}, err
+	}
+	var recipient Recipient
+	if req.Recipient != nil {
+		recipient = Recipient{Name: req.Recipient.Name, Phone: req.Recipient.Phone}
+	}
+	return Parcel{
+		Client:           req.Client,
+		Address:          req.Address,
+		ServiceClass:     req.ServiceClass,
+		WeightGrams:      req.WeightGrams,
+		Dimensions:       dimensions,
+		DeclaredValue:    req.DeclaredValue,
+		Currency:         req.Currency,
+		CashOnDelivery:   req.CashOnDelivery,
+		PickupPoint:      req.PickupPoint,
+		Recipient:        recipient,
+		Contents:         req.Contents,
+		International:    req.International,
+		Country:          req.Country,
+		CustomsReference: req.CustomsReference,
+		HSCodes:          req.HSCodes,
+	}, nil
+}
+
+// toRegisterRequest returns the request that registers a parcel like p.
+func toRegisterRequest(p Parcel) registerRequest {
+	req := registerRequest{
+		Client:           p.Client,
+		Address:          p.Address,
+		ServiceClass:     p.ServiceClass,
+		WeightGrams:      p.WeightGrams,
+		Dimensions:       p.Dimensions.String(),
+		DeclaredValue:    p.DeclaredValue,
+		Currency:         p.Currency,
+		CashOnDelivery:   p.CashOnDelivery,
+		PickupPoint:      p.PickupPoint,
+		Contents:         p.Contents,
+		International:    p.International,
+		Country:          p.Country,
+		CustomsReference: p.CustomsReference,
+		HSCodes:          p.HSCodes,
+	}
+	if !p.Recipient.IsZero() {
+		req.Recipient = &recipientJSON{Name: p.Recipient.Name, Phone: p.Recipient.Phone}
+	}
+	return req
+}
+
+// draftRequest saves Parcel as a draft to confirm later or, with
+// ActivateAt, an RFC 3339 time, schedules its registration; the parcel
+// cannot go to a saved address.
+type draftRequest struct {
+	Parcel     registerRequest `json:"parcel"`
+	ActivateAt string          `json:"activate_at,omitempty"`
+}
+
+type parcelTemplateRequest struct {
+	Client       int    `json:"client"`
+	Name         string `json:"name"`
+	Address      string `json:"address"`
+	ServiceClass string `json:"service_class,omitempty"` // standard if empty
+	WeightGrams  int    `json:"weight_grams,omitempty"`
+}
+
+type savedAddressRequest struct {
+	Label   string `json:"label"`
+	Address string `json:"address"`
+	Default bool   `json:"default,omitempty"`
+}
+
+type holdRequest struct {
+	Kind   string `json:"kind"`
+	Reason string `json:"reason"`
+	Actor  string `json:"actor,omitempty"`
+}
+
+type addressRequest struct {
+	Address string `json:"address"`
+}
+
+type customsRequest struct {
+	Reference string   `json:"reference"`
+	HSCodes   []string `json:"hs_codes,omitempty"`
+}
+
+type paymentRequest struct {
+	Status string `json:"status"`
+}
+
+type locationRequest struct {
+	Warehouse   int    `json:"warehouse,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type scanRequest struct {
+	Type        string    `json:"type"`
+	Warehouse   int       `json:"warehouse,omitempty"`
+	Description string    `json:"description,omitempty"`
+	ScannedAt   time.Time `json:"scanned_at,omitempty"` // now if zero
+}
+
+type syncRequest struct {
+	Device string            `json:"device"`
+	Events []offlineScanJSON `json:"events"`
+}
+
+type offlineScanJSON struct {
+	ID          string    `json:"id"`
+	Parcel      int       `json:"parcel"`
+	Type        string    `json:"type"`
+	Warehouse   int       `json:"warehouse,omitempty"`
+	Description string    `json:"description,omitempty"`
+	ScannedAt   time.Time `json:"scanned_at"`
+}
+
+type deliveryCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type deliveryCodeOverrideRequest struct {
+	Reason string `json:"reason"`
+	// Actor names who overrides the code; the caller's role and key are
+	// recorded as well.
+	Actor string `json:"actor,omitempty"`
+}
+
+type proofRequest struct {
+	Kind        string `json:"kind"`
+	ContentType string `json:"content_type,omitempty"`
+	Data        []byte `json:"data,omitempty"` // base64
+	Reference   string `json:"reference,omitempty"`
+}
+
+type splitRequest struct {
+	Pieces int `json:"pieces"`
+}
+
+type mergeRequest struct {
+	Numbers []int `json:"numbers"`
+}
+
+type deleteManyRequest struct {
+	Numbers []int `json:"numbers"`
+}
+
+type deleteReportJSON struct {
+	Deleted []int               `json:"deleted"`
+	Refused []deleteRefusalJSON `json:"refused"`
+}
+
+type deleteRefusalJSON struct {
+	Parcel int       `json:"parcel"`
+	Error  string    `json:"error"`
+	Code   ErrorCode `json:"code"`
+}
+
+type statusOverrideRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+	// Actor names who forces the status; the caller's role and key are
+	// recorded as well.
+	Actor string `json:"actor,omitempty"`
+}
+
+type commentRequest struct {
+	Author string `json:"author"`
+	Text   string `json:"text"`
+}
+
+type routeRequest struct {
+	Courier string `json:"courier"`
+	Day     string `json:"day"`
+}
+
+type routeStopRequest struct {
+	Parcel int `json:"parcel"`
+}
+
+type orderRequest struct {
+	Client int `json:"client"`
+}
+
+type orderParcelRequest struct {
+	Parcel int `json:"parcel"`
+}
+
+type claimRequest struct {
+	Kind        string `json:"kind"`
+	Amount      int    `json:"amount"`
+	Description string `json:"description"`
+}
+
+type claimApprovalRequest struct {
+	Payout int    `json:"payout"`
+	Note   string `json:"note"`
+}
+
+type claimRejectionRequest struct {
+	Reason string `json:"reason"`
+}
+
+type workItemRequest struct {
+	Parcel int    `json:"parcel"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+type workItemAssignRequest struct {
+	Assignee string `json:"assignee"`
+}
+
+type workItemResolveRequest struct {
+	State      string `json:"state"`
+	Resolution string `json:"resolution"`
+}
+
+type contentRestrictionRequest struct {
+	Category string `json:"category"`
+	// Zone is the delivery zone; empty restricts every destination.
+	Zone string `json:"zone,omitempty"`
+}
+
+type reorderRequest struct {
+	Parcels []int `json:"parcels"`
+}
+
+type warehouseRequest struct {
+	Code    string `json:"code"`
+	Name    string `json:"name"`
+	Address string `json:"address,omitempty"`
+}
+
+type pickupPointRequest struct {
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Capacity int    `json:"capacity"`
+}
+
+// apiHandler serves the parcel REST API on top of a ParcelService.
+type apiHandler struct {
+	service ParcelService
+}
+
+// as returns the service restricted to the principal of the request,
+// which requirePrincipal ensures there is. Changes are recorded as made by
+// the actor of the request context, if a middleware put one there, or
+// else by the principal; see Actor.
+func (h apiHandler) as(r *http.Request) AuthorizedService {
+	who, _ := PrincipalFromContext(r.Context())
+	service := h.service.WithActor(ActorOf(who))
+	if actor, ok := ActorFromContext(r.Context()); ok {
+		service = service.WithActor(actor)
+	}
+	return NewAuthorizedService(service, who)
+}
+
+// requirePrincipal answers requests without a principal, i.e. not
+// authenticated by a middleware such as APIKeyAuth or AllowAnonymous,
+// with 401 Unauthorized.
+func requirePrincipal(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := PrincipalFromContext(r.Context()); !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, ErrInvalidAPIKey)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Rate limit of the public /track endpoint per remote address.
+const (
+	TrackRate  = 1.0
+	TrackBurst = 10
+)
+
+// NewHTTPHandler returns the HTTP handler of the parcel REST API and the
+// public tracking page:
+//
+//	POST   /parcels                      register {"client", "address", "service_class",
+//	                                     "weight_grams", "dimensions", "declared_value", "currency",
+//	                                     "cash_on_delivery", "allow_duplicate", "pickup_point",
+//	                                     "recipient": {"name", "phone"}, "contents",
+//	                                     "international", "country", "customs_reference", "hs_codes"}
+//	                                     with an optional Idempotency-Key header
+//	GET    /parcels?client=N&...         list parcels; see parcelFilter
+//	GET    /parcels/{number}             get a parcel
+//	DELETE /parcels/{number}             delete a registered parcel
+//	PUT    /parcels/{number}/address     change the address {"address"}
+//	PUT    /parcels/{number}/customs     set the customs declaration {"reference", "hs_codes"}
+//	POST   /parcels/{number}/next-status advance the status
+//	PUT    /parcels/{number}/payment     change the payment status {"status"}
+//	GET    /parcels/{number}/history     status history
+//	GET    /parcels/{number}/address-history every address the parcel has had
+//	POST   /parcels/{number}/split       split into pieces {"pieces"}
+//	POST   /parcels/merge                merge into one parcel {"numbers"}
+//	POST   /parcels/delete               delete registered parcels in bulk {"numbers"}
+//	GET    /parcels/{number}/links       split and merge links
+//	GET    /parcels/{number}/location    where the parcel was last scanned
+//	POST   /parcels/{number}/location    record a scan {"warehouse", "description"}
+//	GET    /parcels/{number}/locations   movement trail
+//	POST   /parcels/{number}/scans       record a scan {"type", "warehouse", "description",
+//	                                     "scanned_at" (RFC 3339, default now)}
+//	GET    /parcels/{number}/scans       scan events
+//	PUT    /parcels/{number}/delivery-window reschedule delivery {"day", "from", "to"}
+//	GET    /delivery-slots?day=YYYY-MM-DD delivery slots of a day with the room left
+//	POST   /parcels/{number}/hold        pause the parcel {"kind", "reason", "actor"}
+//	DELETE /parcels/{number}/hold        release the hold
+//	POST   /scans/sync                   apply scans recorded offline {"device", "events": [{"id",
+//	                                     "parcel", "type", "warehouse", "description", "scanned_at"}]}
+//	POST   /parcels/{number}/status-overrides force a status {"status", "reason", "actor"}
+//	GET    /parcels/{number}/status-overrides audit of forced statuses
+//	POST   /parcels/{number}/delivery-code confirm the delivery code {"code"}
+//	POST   /parcels/{number}/delivery-code/override deliver without the code {"reason", "actor"}
+//	POST   /parcels/{number}/proof       deliver with proof {"kind", "content_type",
+//	                                     "data" (base64 image) or "reference"}
+//	GET    /parcels/{number}/proof       proof of delivery
+//	GET    /parcels/{number}/proof/content image of the proof of delivery
+//	POST   /parcels/{number}/comments    leave a comment {"author", "text"}
+//	GET    /parcels/{number}/comments    comments, oldest first
+//	GET    /parcels/{number}/label       PNG shipping label
+//	POST   /parcels/{number}/claims      file a claim {"kind", "amount", "description"}
+//	GET    /parcels/{number}/claims      claims against a parcel, oldest first
+//	GET    /nearby?lat=..&lon=..&radius=m undelivered parcels near a position
+//	GET    /search?q=..&limit=N          parcels by address words, best match first
+//	GET    /status-labels?lang=xx        status presentation metadata
+//	GET    /changes?since=N&limit=N      changes of parcels after a cursor
+//	GET    /summary?client=N&from=..&to=.. parcels per client, day and status
+//	GET    /audit?actor=..&number=N&operation=..&from=..&to=..&limit=N audit log
+//	GET    /audit/export?...             the audit log as CSV
+//	POST   /routes                       create a route {"courier", "day"}
+//	GET    /routes?day=YYYY-MM-DD        list routes
+//	GET    /routes/{id}                  get a route with its stops
+//	POST   /routes/{id}/stops            add a stop {"parcel"}
+//	PUT    /routes/{id}/stops            reorder the stops {"parcels": [...]}
+//	DELETE /routes/{id}/stops/{number}   remove a stop
+//	POST   /routes/{id}/stops/{number}/complete deliver the parcel of a stop
+//	POST   /orders                       create an order {"client"}
+//	GET    /orders/{id}                  get an order with its derived status
+//	GET    /orders/{id}/parcels          parcels of an order
+//	POST   /orders/{id}/parcels          add a parcel to an order {"parcel"}
+//	DELETE /orders/{id}/parcels/{number} take a parcel out of an order
+//	GET    /claims?status=open           claims in a status, open by default
+//	GET    /claims/{id}                  get a claim
+//	POST   /claims/{id}/approve          approve a claim {"payout", "note"}
+//	POST   /claims/{id}/reject           reject a claim {"reason"}
+//	POST   /claims/{id}/pay              record the payout of an approved claim
+//	GET    /parcel-templates?client=N    parcel templates of a client, ordered by name
+//	POST   /parcel-templates             save a parcel template
+//	                                     {"client", "name", "address", "service_class", "weight_grams"}
+//	GET    /parcel-templates/{id}        get a parcel template
+//	DELETE /parcel-templates/{id}        delete a parcel template
+//	POST   /parcel-templates/{id}/parcels register a parcel from a template
+//	GET    /drafts?client=N              parcel drafts of a client, oldest first
+//	POST   /drafts                       save a draft, or schedule a registration with activate_at
+//	                                     {"parcel", "activate_at"}
+//	GET    /drafts/{id}                  get a parcel draft
+//	PUT    /drafts/{id}                  change the parcel of a draft {"client", "address", ...}
+//	DELETE /drafts/{id}                  discard a parcel draft
+//	POST   /drafts/{id}/confirm          register the parcel of a draft
+//	GET    /clients/{client}/addresses   address book of a client, ordered by label
+//	POST   /clients/{client}/addresses   save an address {"label", "address", "default"}
+//	PUT    /clients/{client}/addresses/{id} change a saved address {"label", "address", "default"}
+//	DELETE /clients/{client}/addresses/{id} delete a saved address
+//	GET    /work-items?state=&kind=&assignee=&parcel=
+//	                                     ops work items, open and in progress by default
+//	POST   /work-items                   report a work item {"parcel", "kind", "detail"}
+//	GET    /work-items/{id}              get a work item
+//	POST   /work-items/{id}/assign       assign a work item {"assignee"}
+//	POST   /work-items/{id}/resolve      close a work item {"state", "resolution"}
+//	GET    /content-restrictions         content categories restricted by zone
+//	POST   /content-restrictions         restrict a category {"category", "zone"}
+//	DELETE /content-restrictions/{id}    lift a restriction
+//	POST   /warehouses                   create a warehouse {"code", "name", "address"}
+//	GET    /warehouses                   list warehouses
+//	POST   /pickup-points                create a pickup point {"name", "address", "capacity"}
+//	GET    /pickup-points                list pickup points
+//	GET    /pickup-points/{id}           get a pickup point
+//	GET    /pickup-points/{id}/parcels   parcels awaiting pickup at the point
+//	GET    /graphql?query=...            GraphQL queries; see graphQLSchema
+//	POST   /graphql                      GraphQL queries, mutations and subscriptions
+//	                                     {"query", "operationName", "variables"}
+//	GET    /events?client=N              server-sent "status_changed" events
+//	GET    /track/{trackingCode}         public status, history and destination city
+//	GET    /track/{trackingCode}/events  public server-sent "status_changed" events
+//	GET    /openapi.json                 OpenAPI document of the REST API
+//	GET    /healthz                      liveness probe: background jobs not stalled
+//	GET    /readyz                       readiness probe: database reachable and migrated
+//	GET    /                             tracking page
+//
+// The API routes are wrapped in middleware, outermost first, e.g.
+// APIKeyAuth; every API call is then authorized for the principal the
+// middleware attaches, and answered with 401 Unauthorized if there is
+// none (see AllowAnonymous for development). The tracking page, /track, /openapi.json and the
+// probes are always public; /track is limited to TrackRate requests per
+// second per remote address.
+//
+// Errors are answered with {"error", "code"}, where code is the ErrorCode
+// of the error, or a generic one such as INVALID_REQUEST. Parcels failing
+// validation also list the rejected fields in "fields" (see
+// Parcel.Validate).
+//
+// Parcels and tracking views carry, next to each status code, a
+// status_label in the language of the "lang" query parameter or the
+// Accept-Language header (see requestLang); the codes never change.
+func NewHTTPHandler(service ParcelService, middleware ...func(http.Handler) http.Handler) http.Handler {
+	h := apiHandler{service: service}
+
+	api := http.NewServeMux()
+	api.HandleFunc("/parcels", h.parcels)
+	api.HandleFunc("/parcels/", h.parcel)
+	api.HandleFunc("/parcels/merge", h.merge)
+	api.HandleFunc("/parcels/delete", h.deleteMany)
+	api.HandleFunc("/nearby", h.nearby)
+	api.HandleFunc("/search", h.search)
+	api.HandleFunc("/changes", h.changes)
+	api.HandleFunc("/summary", h.summary)
+	api.HandleFunc("/audit", h.audit)
+	api.HandleFunc("/audit/export", h.audit)
+	api.HandleFunc("/scans/sync", h.syncScans)
+	api.HandleFunc("/delivery-slots", h.deliverySlots)
+	api.HandleFunc("/status-labels", h.statusLabels)
+	api.HandleFunc("/routes", h.routes)
+	api.HandleFunc("/routes/", h.route)
+	api.HandleFunc("/orders", h.orders)
+	api.HandleFunc("/orders/", h.order)
+	api.HandleFunc("/claims", h.claims)
+	api.HandleFunc("/claims/", h.claim)
+	api.HandleFunc("/parcel-templates", h.parcelTemplates)
+	api.HandleFunc("/parcel-templates/", h.parcelTemplate)
+	api.HandleFunc("/drafts", h.drafts)
+	api.HandleFunc("/drafts/", h.draft)
+	api.HandleFunc("/clients/", h.savedAddresses)
+	api.HandleFunc("/work-items", h.workItems)
+	api.HandleFunc("/work-items/", h.workItem)
+	api.HandleFunc("/content-restrictions", h.contentRestrictions)
+	api.HandleFunc("/content-restrictions/", h.contentRestriction)
+	api.HandleFunc("/warehouses", h.warehouses)
+	api.HandleFunc("/pickup-points", h.pickupPoints)
+	api.HandleFunc("/pickup-points/", h.pickupPoint)
+	api.HandleFunc("/graphql", h.graphql)
+	api.HandleFunc("/events", h.events)
+
+	var handler http.Handler = requirePrincipal(api)
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/parcels", handler)
+	mux.Handle("/parcels/", handler)
+	mux.Handle("/nearby", handler)
+	mux.Handle("/search", handler)
+	mux.Handle("/changes", handler)
+	mux.Handle("/summary", handler)
+	mux.Handle("/audit", handler)
+	mux.Handle("/audit/export", handler)
+	mux.Handle("/scans/sync", handler)
+	mux.Handle("/delivery-slots", handler)
+	mux.Handle("/status-labels", handler)
+	mux.Handle("/routes", handler)
+	mux.Handle("/routes/", handler)
+	mux.Handle("/orders", handler)
+	mux.Handle("/orders/", handler)
+	mux.Handle("/claims", handler)
+	mux.Handle("/claims/", handler)
+	mux.Handle("/parcel-templates", handler)
+	mux.Handle("/parcel-templates/", handler)
+	mux.Handle("/drafts", handler)
+	mux.Handle("/drafts/", handler)
+	mux.Handle("/clients/", handler)
+	mux.Handle("/work-items", handler)
+	mux.Handle("/work-items/", handler)
+	mux.Handle("/content-restrictions", handler)
+	mux.Handle("/content-restrictions/", handler)
+	mux.Handle("/warehouses", handler)
+	mux.Handle("/pickup-points", handler)
+	mux.Handle("/pickup-points/", handler)
+	mux.Handle("/graphql", handler)
+	mux.Handle("/events", handler)
+	mux.Handle("/track/", RateLimitAll(NewRateLimiter(TrackRate, TrackBurst))(http.HandlerFunc(h.track)))
+	mux.HandleFunc("/openapi.json", openAPIDocumentHandler)
+	mux.HandleFunc("/healthz", h.healthz)
+	mux.HandleFunc("/readyz", h.readyz)
+	mux.Handle("/", newTrackingPage(service))
+	return mux
+}
+
+// parcels serves /parcels.
+func (h apiHandler) parcels(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		filter, err := parcelFilter(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		parcels, err := h.as(r).FindParcels(filter)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		labels := h.labels(r)
+		res := make([]parcelJSON, 0, len(parcels))
+		for _, p := range parcels {
+			res = append(res, toParcelJSON(p, labels))
+		}
+		writeJSON(w, http.StatusOK, res)
+
+	case http.MethodPost:
+		var req registerRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		draft, err := req.draft()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		draft.IdempotencyKey = r.Header.Get("Idempotency-Key")
+		service := h.as(r)
+		if req.AllowDuplicate {
+			service = service.AllowDuplicates()
+		}
+		var parcel Parcel
+		if req.SavedAddress != 0 || (req.Address == "" && req.PickupPoint == 0) {
+			parcel, err = service.RegisterToSavedAddress(draft, req.SavedAddress)
+		} else {
+			parcel, err = service.Register(draft)
+		}
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/parcels/"+parcel.PublicID)
+		writeJSON(w, http.StatusCreated, toParcelJSON(parcel, h.labels(r)))
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// parcelFilter builds a ParcelFilter from the query parameters client,
+// status, service_class, min_weight, max_weight, min_value, max_value, duplicates,
+// recipient_phone, sort (a SortBy constant) and order ("asc" or "desc").
+func parcelFilter(q url.Values) (ParcelFilter, error) {
+	f := ParcelFilter{Status: q.Get("status"), ServiceClass: q.Get("service_class"), SortBy: q.Get("sort"),
+		RecipientPhone: q.Get("recipient_phone")}
+	ints := []struct {
+		name string
+		dst  *int
+	}{
+		{"client", &f.Client},
+		{"min_weight", &f.MinWeight},
+		{"max_weight", &f.MaxWeight},
+		{"min_value", &f.MinDeclaredValue},
+		{"max_value", &f.MaxDeclaredValue},
+	}
+	for _, p := range ints {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return f, fmt.Errorf("query parameter %s must be an integer", p.name)
+		}
+		*p.dst = n
+	}
+
+	if v := q.Get("duplicates"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, errors.New("query parameter duplicates must be a boolean")
+		}
+		f.SuspectedDuplicates = b
+	}
+
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		f.Desc = true
+	default:
+		return f, errors.New(`query parameter order must be "asc" or "desc"`)
+	}
+	return f, nil
+}
+
+// parcel serves /parcels/{parcel} and its sub-resources, where {parcel}
+// is the public ID of the parcel or, unless PublicIDsOnly is in front,
+// its number.
+func (h apiHandler) parcel(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/parcels/")
+	id, sub, _ := strings.Cut(rest, "/")
+	number, err := strconv.Atoi(id)
+	if err != nil {
+		if _, err := ParsePublicID(id); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		parcel, err := h.as(r).GetByPublicID(id)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		number = parcel.Number
+	}
+	if number <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch sub {
+	case "":
+		h.parcelRoot(w, r, number)
+	case "address":
+		h.parcelAddress(w, r, number)
+	case "delivery-window":
+		h.parcelDeliveryWindow(w, r, number)
+	case "hold":
+		h.parcelHold(w, r, number)
+	case "next-status":
+		h.parcelNextStatus(w, r, number)
+	case "payment":
+		h.parcelPayment(w, r, number)
+	case "history":
+		h.parcelHistory(w, r, number)
+	case "address-history":
+		h.parcelAddressHistory(w, r, number)
+	case "split":
+		h.parcelSplit(w, r, number)
+	case "links":
+		h.parcelLinks(w, r, number)
+	case "location":
+		h.parcelLocation(w, r, number)
+	case "locations":
+		h.parcelLocations(w, r, number)
+	case "scans":
+		h.parcelScans(w, r, number)
+	case "comments":
+		h.parcelComments(w, r, number)
+	case "status-overrides":
+		h.parcelStatusOverrides(w, r, number)
+	case "delivery-code":
+		h.parcelDeliveryCode(w, r, number)
+	case "delivery-code/override":
+		h.parcelDeliveryCodeOverride(w, r, number)
+	case "proof":
+		h.parcelProof(w, r, number)
+	case "proof/content":
+		h.parcelProofContent(w, r, number)
+	case "label":
+		h.parcelLabel(w, r, number)
+	case "claims":
+		h.parcelClaims(w, r, number)
+	case "customs":
+		h.parcelCustoms(w, r, number)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h apiHandler) parcelRoot(w http.ResponseWriter, r *http.Request, number int) {
+	switch r.Method {
+	case http.MethodGet:
+		parcel, err := h.as(r).Get(number)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, toParcelJSON(parcel, h.labels(r)))
+
+	case http.MethodDelete:
+		if err := h.as(r).Delete(number); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+	}
+}
+
+func (h apiHandler) parcelAddress(w http.ResponseWriter, r *http.Request, number int) {
+	if r.Method != http.MethodPut {
+		methodNotAllowed(w, http.MethodPut)
+		return
+	}
+
+	var req addressRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.as(r).ChangeAddress(number, req.Address); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	h.writeParcel(w, r, number)
+}
+
+func (h apiHandler) parcelDeliveryWindow(w http.ResponseWriter, r *http.Request, number int) {
+	if r.Method != http.MethodPut {
+		methodNotAllowed(w, http.MethodPut)
+		return
+	}
+
+	var req deliveryWindowJSON
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.as(r).Reschedule(number, DeliveryWindow(req)); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	h.writeParcel(w, r, number)
+}
+
+func (h apiHandler) parcelHold(w http.ResponseWriter, r *http.Request, number int) {
+	switch r.Method {
+	case http.MethodPost:
+		var req holdRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if _, err := h.as(r).Hold(number, req.Kind, req.Reason, req.Actor); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+
+	case http.MethodDelete:
+		if err := h.as(r).Release(number); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+
+	default:
+		methodNotAllowed(w, http.MethodPost, http.MethodDelete)
+		return
+	}
+	h.writeParcel(w, r, number)
+}
+
+func (h apiHandler) deliverySlots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	slots, err := h.as(r).DeliverySlots(r.URL.Query().Get("day"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	res := make([]deliverySlotJSON, 0, len(slots))
+	for _, slot := range slots {
+		res = append(res, deliverySlotJSON{Day: slot.Day, From: slot.From, To: slot.To, Capacity: slot.Capacity,
+			Remaining: slot.Remaining})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h apiHandler) parcelCustoms(w http.ResponseWriter, r *http.Request, number int) {
+	if r.Method != http.MethodPut {
+		methodNotAllowed(w, http.MethodPut)
+		return
+	}
+
+	var req customsRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.as(r).SetCustomsDeclaration(number, req.Reference, req.HSCodes); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	h.writeParcel(w, r, number)
+}
+
+func (h apiHandler) parcelNextStatus(w http.ResponseWriter, r *http.Request, number int) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	if err := h.as(r).NextStatus(number); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	h.writeParcel(w, r, number)
+}
+
+func (h apiHandler) parcelPayment(w http.ResponseWriter, r *http.Request, number int) {
+	if r.Method != http.MethodPut {
+		methodNotAllowed(w, http.MethodPut)
+		return
+	}
+
+	var req paymentRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.as(r).SetPaymentStatus(number, req.Status); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	h.writeParcel(w, r, number)
+}
+
+func (h apiHandler) parcelHistory(w http.ResponseWriter, r *http.Request, number int) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	history, err := h.as(r).History(number)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	res := make([]statusChangeJSON, 0, len(history))
+	for _, c := range history {
+		res = append(res, statusChangeJSON{Status: c.Status, ChangedAt: c.ChangedAt, Note: c.Note, Actor: c.Actor})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h apiHandler) parcelAddressHistory(w http.ResponseWriter, r *http.Request, number int) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	history, err := h.as(r).AddressHistory(number)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	res := make([]addressHistoryJSON, 0, len(history))
+	for _, e := range history {
+		res = append(res, addressHistoryJSON{Address: e.Address, Status: e.Status, SetAt: e.SetAt, Actor: e.Actor})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h apiHandler) parcelSplit(w http.ResponseWriter, r *http.Request, number int) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req splitRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	pieces, err := h.as(r).Split(number, req.Pieces)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	labels := h.labels(r)
+	res := make([]parcelJSON, 0, len(pieces))
+	for _, p := range pieces {
+		res = append(res, toParcelJSON(p, labels))
+	}
+	writeJSON(w, http.StatusCreated, res)
+}
+
+func (h apiHandler) merge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req mergeRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	parcel, err := h.as(r).Merge(req.Numbers)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/parcels/"+parcel.PublicID)
+	writeJSON(w, http.StatusCreated, toParcelJSON(parcel, h.labels(r)))
+}
+
+// deleteMany serves /parcels/delete. The batch is answered with 200 and
+// the parcels deleted and refused, even if some were refused.
+func (h apiHandler) deleteMany(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req deleteManyRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	report, err := h.as(r).DeleteMany(req.Numbers)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	res := deleteReportJSON{Deleted: report.Deleted, Refused: []deleteRefusalJSON{}}
+	for _, refusal := range report.Refused {
+		res.Refused = append(res.Refused, deleteRefusalJSON{Parcel: refusal.Number, Error: refusal.Err.Error(),
+			Code: ErrorCodeOf(refusal.Err)})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// syncScans serves /scans/sync. The batch is answered with 200 and the
+// result of each event, even if some were rejected.
+func (h apiHandler) syncScans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req syncRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	events := make([]OfflineScan, 0, len(req.Events))
+	for _, e := range req.Events {
+		events = append(events, OfflineScan{ID: e.ID, Number: e.Parcel, Type: e.Type,
+			Location: Location{Warehouse: e.Warehouse, Description: e.Description}, ScannedAt: e.ScannedAt})
+	}
+	results, err := h.as(r).SyncScans(req.Device, events)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	res := make([]syncResultJSON, 0, len(results))
+	for _, sr := range results {
+		res = append(res, toSyncResultJSON(sr))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h apiHandler) parcelLinks(w http.ResponseWriter, r *http.Request, number int) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	links, err := h.as(r).Links(number)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	res := make([]parcelLinkJSON, 0, len(links))
+	for _, l := range links {
+		res = append(res, parcelLinkJSON{Parent: l.Parent, Child: l.Child, Kind: l.Kind, CreatedAt: l.CreatedAt})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h apiHandler) parcelLocation(w http.ResponseWriter, r *http.Request, number int) {
+	switch r.Method {
+	case http.MethodGet:
+		l, err := h.as(r).CurrentLocation(number)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, locationJSON{Warehouse: l.Warehouse, Description: l.Description, ScannedAt: l.ScannedAt})
+
+	case http.MethodPost:
+		var req locationRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		l, err := h.as(r).RecordLocation(number, req.Warehouse, req.Description)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, locationJSON{Warehouse: l.Warehouse, Description: l.Description, ScannedAt: l.ScannedAt})
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (h apiHandler) parcelLocations(w http.ResponseWriter, r *http.Request, number int) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	trail, err := h.as(r).Locations(number)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	res := make([]locationJSON, 0, len(trail))
+	for _, l := range trail {
+		res = append(res, locationJSON{Warehouse: l.Warehouse, Description: l.Description, ScannedAt: l.ScannedAt})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h apiHandler) parcelScans(w http.ResponseWriter, r *http.Request, number int) {
+	switch r.Method {
+	case http.MethodGet:
+		scans, err := h.as(r).Scans(number)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		res := make([]scanJSON, 0, len(scans))
+		for _, sc := range scans {
+			res = append(res, toScanJSON(sc))
+		}
+		writeJSON(w, http.StatusOK, res)
+
+	case http.MethodPost:
+		var req scanRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		location := Location{Warehouse: req.Warehouse, Description: req.Description}
+		sc, err := h.as(r).RecordScan(number, req.Type, location, req.ScannedAt)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, toScanJSON(sc))
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (h apiHandler) parcelComments(w http.ResponseWriter, r *http.Request, number int) {
+	switch r.Method {
+	case http.MethodGet:
+		comments, err := h.as(r).Comments(number)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		res := make([]commentJSON, 0, len(comments))
+		for _, c := range comments {
+			res = append(res, toCommentJSON(c))
+		}
+		writeJSON(w, http.StatusOK, res)
+
+	case http.MethodPost:
+		var req commentRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		c, err := h.as(r).AddComment(number, req.Author, req.Text)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, toCommentJSON(c))
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (h apiHandler) parcelClaims(w http.ResponseWriter, r *http.Request, number int) {
+	switch r.Method {
+	case http.MethodGet:
+		claims, err := h.as(r).ParcelClaims(number)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeClaims(w, claims)
+
+	case http.MethodPost:
+		var req claimRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		c, err := h.as(r).FileClaim(number, req.Kind, req.Amount, req.Description)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/claims/%d", c.ID))
+		writeJSON(w, http.StatusCreated, toClaimJSON(c))
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (h apiHandler) parcelStatusOverrides(w http.ResponseWriter, r *http.Request, number int) {
+	switch r.Method {
+	case http.MethodGet:
+		overrides, err := h.as(r).StatusOverrides(number)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		res := make([]statusOverrideJSON, 0, len(overrides))
+		for _, o := range overrides {
+			res = append(res, toStatusOverrideJSON(o))
+		}
+		writeJSON(w, http.StatusOK, res)
+
+	case http.MethodPost:
+		var req statusOverrideRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := h.as(r).ForceSetStatus(number, req.Status, req.Reason, req.Actor); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		h.writeParcel(w, r, number)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (h apiHandler) parcelDeliveryCode(w http.ResponseWriter, r *http.Request, number int) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req deliveryCodeRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.as(r).ConfirmDeliveryCode(number, req.Code); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h apiHandler) parcelDeliveryCodeOverride(w http.ResponseWriter, r *http.Request, number int) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req deliveryCodeOverrideRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.as(r).OverrideDeliveryCode(number, req.Reason, req.Actor); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h apiHandler) parcelProof(w http.ResponseWriter, r *http.Request, number int) {
+	switch r.Method {
+	case http.MethodGet:
+		proof, err := h.as(r).Proof(number)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, toProofJSON(proof))
+
+	case http.MethodPost:
+		var req proofRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		proof := Proof{Kind: req.Kind, ContentType: req.ContentType, Data: req.Data, Reference: req.Reference}
+		if err := h.as(r).DeliverWithProof(number, proof); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		h.writeParcel(w, r, number)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (h apiHandler) parcelProofContent(w http.ResponseWriter, r *http.Request, number int) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	data, contentType, err := h.as(r).ProofContent(number)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(data)
+}
+
+func (h apiHandler) parcelLabel(w http.ResponseWriter, r *http.Request, number int) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	parcel, err := h.as(r).Get(number)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	if err := RenderLabel(w, parcel); err != nil {
+		writeServiceError(w, err)
+	}
+}
+
+// nearby serves /nearby.
+func (h apiHandler) nearby(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	var args [3]float64
+	for i, name := range []string{"lat", "lon", "radius"} {
+		v, err := strconv.ParseFloat(r.URL.Query().Get(name), 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("query parameter %s must be a number", name))
+			return
+		}
+		args[i] = v
+	}
+
+	parcels, err := h.as(r).Nearby(args[0], args[1], args[2])
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	labels := h.labels(r)
+	res := make([]parcelJSON, 0, len(parcels))
+	for _, p := range parcels {
+		res = append(res, toParcelJSON(p, labels))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// search serves /search.
+func (h apiHandler) search(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	var limit int
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("query parameter limit must be an integer"))
+			return
+		}
+		limit = n
+	}
+
+	parcels, err := h.as(r).Search(r.URL.Query().Get("q"), limit)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	labels := h.labels(r)
+	res := make([]parcelJSON, 0, len(parcels))
+	for _, p := range parcels {
+		res = append(res, toParcelJSON(p, labels))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// changeJSON is an entry of the change feed; Parcel is omitted if the
+// parcel has been deleted since.
+type changeJSON struct {
+	Cursor int64       `json:"cursor"`
+	Number int         `json:"number"`
+	Op     string      `json:"op"`
+	At     string      `json:"at"`
+	Actor  string      `json:"actor,omitempty"`
+	Parcel *parcelJSON `json:"parcel,omitempty"`
+}
+
+// changesJSON is a page of the change feed. NextCursor is the since of
+// the next page: the cursor of the last change, or since if there is none.
+type changesJSON struct {
+	Changes    []changeJSON `json:"changes"`
+	NextCursor int64        `json:"next_cursor"`
+}
+
+// changes serves /changes: the changes of parcels after ?since=cursor.
+func (h apiHandler) changes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	var since int64
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("query parameter since must be an integer"))
+			return
+		}
+		since = n
+	}
+	var limit int
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("query parameter limit must be an integer"))
+			return
+		}
+		limit = n
+	}
+
+	changes, err := h.as(r).ChangesSince(since, limit)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	labels := h.labels(r)
+	res := changesJSON{Changes: make([]changeJSON, 0, len(changes)), NextCursor: since}
+	for _, c := range changes {
+		v := changeJSON{Cursor: c.Cursor, Number: c.Number, Op: string(c.Op), At: c.At, Actor: c.Actor}
+		if c.Parcel != nil {
+			p := toParcelJSON(*c.Parcel, labels)
+			v.Parcel = &p
+		}
+		res.Changes = append(res.Changes, v)
+		res.NextCursor = c.Cursor
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// summaryJSON is a row of the parcel summary.
+type summaryJSON struct {
+	Client int    `json:"client"`
+	Day    string `json:"day"`
+	Status string `json:"status"`
+	Count  int    `json:"count"`
+}
+
+// summary serves /summary: the parcel summary, optionally only of
+// ?client=N and of the registration days in [?from, ?to).
+func (h apiHandler) summary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	var client int
+	if v := r.URL.Query().Get("client"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("query parameter client must be an integer"))
+			return
+		}
+		client = n
+	}
+	var period ReportPeriod
+	for name, bound := range map[string]*time.Time{"from": &period.From, "to": &period.To} {
+		if v := r.URL.Query().Get(name); v != "" {
+			t, err := time.Parse(time.DateOnly, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("query parameter %s must be a date like 2024-01-31", name))
+				return
+			}
+			*bound = t
+		}
+	}
+
+	counts, err := h.as(r).ParcelSummary(client, period)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	res := make([]summaryJSON, 0, len(counts))
+	for _, c := range counts {
+		res = append(res, summaryJSON(c))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+type auditEntryJSON struct {
+	At        string `json:"at"`
+	Actor     string `json:"actor,omitempty"`
+	Number    int    `json:"number"`
+	Operation string `json:"operation"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// audit serves /audit, the audit entries the query selects, and
+// /audit/export, the same as CSV. Times are RFC 3339 or dates.
+func (h apiHandler) audit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	query := r.URL.Query()
+	f := AuditFilter{Actor: query.Get("actor"), Operation: query.Get("operation")}
+	for name, n := range map[string]*int{"number": &f.Number, "limit": &f.Limit} {
+		if v := query.Get(name); v != "" {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("query parameter %s must be an integer", name))
+				return
+			}
+			*n = i
+		}
+	}
+	for name, bound := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+		if v := query.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				t, err = time.Parse(time.DateOnly, v)
+			}
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("query parameter %s must be a time like 2024-01-31T03:00:00Z or a date", name))
+				return
+			}
+			*bound = t
+		}
+	}
+
+	entries, err := h.as(r).AuditEntries(f)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if r.URL.Path == "/audit/export" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+		csv.NewWriter(w).WriteAll(AuditCSV(entries))
+		return
+	}
+	res := make([]auditEntryJSON, 0, len(entries))
+	for _, e := range entries {
+		res = append(res, auditEntryJSON(e))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// statusLabels serves /status-labels.
+func (h apiHandler) statusLabels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	labels, err := h.service.StatusLabels(requestLang(r))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	res := make([]statusLabelJSON, 0, len(labels))
+	for _, l := range labels {
+		res = append(res, statusLabelJSON(l))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// requestLang returns the language the caller wants status labels in:
+// the "lang" query parameter, else the first language of the
+// Accept-Language header, else DefaultLabelLang.
+func requestLang(r *http.Request) string {
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		return lang
+	}
+	first, _, _ := strings.Cut(r.Header.Get("Accept-Language"), ",")
+	first, _, _ = strings.Cut(first, ";")
+	primary, _, _ := strings.Cut(strings.TrimSpace(first), "-")
+	if primary == "" || primary == "*" {
+		return DefaultLabelLang
+	}
+	return strings.ToLower(primary)
+}
+
+// labels returns the Labels of the language of r. Labels are only
+// presentation: if they cannot be loaded, statuses are shown by code.
+func (h apiHandler) labels(r *http.Request) Labels {
+	labels, _ := h.service.Labels(requestLang(r))
+	return labels
+}
+
+// track serves the public /track/{trackingCode} and its event stream.
+// Unknown and malformed codes alike are answered with 404.
+func (h apiHandler) track(w http.ResponseWriter, r *http.Request) {
+	code, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/track/"), "/")
+	switch sub {
+	case "":
+	case "events":
+		h.trackEvents(w, r, code)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	v, err := h.service.Track(code)
+	if err != nil {
+		writeTrackError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toTrackingJSON(v, h.labels(r)))
+}
+
+// writeTrackError answers a failed public lookup without telling unknown
+// codes from malformed ones.
+func writeTrackError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrParcelNotFound) || errors.Is(err, ErrInvalidTrackingCode) {
+		writeError(w, http.StatusNotFound, errors.New("no parcel with this tracking code"))
+		return
+	}
+	writeServiceError(w, err)
+}
+
+// routes serves /routes.
+func (h apiHandler) routes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		routes, err := h.as(r).Routes(r.URL.Query().Get("day"))
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		res := make([]routeJSON, 0, len(routes))
+		for _, route := range routes {
+			res = append(res, toRouteJSON(route))
+		}
+		writeJSON(w, http.StatusOK, res)
+
+	case http.MethodPost:
+		var req routeRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		route, err := h.as(r).CreateRoute(req.Courier, req.Day)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/routes/%d", route.ID))
+		writeJSON(w, http.StatusCreated, toRouteJSON(route))
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// route serves /routes/{id} and its stops.
+func (h apiHandler) route(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/routes/"), "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || id <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		h.writeRoute(w, r, id)
+	case len(parts) == 2 && parts[1] == "stops":
+		h.routeStops(w, r, id)
+	case len(parts) >= 3 && len(parts) <= 4 && parts[1] == "stops":
+		number, err := strconv.Atoi(parts[2])
+		if err != nil || number <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+		if len(parts) == 3 {
+			h.routeStop(w, r, id, number)
+		} else if parts[3] == "complete" {
+			h.routeStopComplete(w, r, id, number)
+		} else {
+			http.NotFound(w, r)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h apiHandler) routeStops(w http.ResponseWriter, r *http.Request, id int) {
+	switch r.Method {
+	case http.MethodPost:
+		var req routeStopRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := h.as(r).AddRouteStop(id, req.Parcel); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+
+	case http.MethodPut:
+		var req reorderRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := h.as(r).ReorderRoute(id, req.Parcels); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+
+	default:
+		methodNotAllowed(w, http.MethodPost, http.MethodPut)
+		return
+	}
+	h.writeRoute(w, r, id)
+}
+
+func (h apiHandler) routeStop(w http.ResponseWriter, r *http.Request, id, number int) {
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+
+	if err := h.as(r).RemoveRouteStop(id, number); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h apiHandler) routeStopComplete(w http.ResponseWriter, r *http.Request, id, number int) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	if err := h.as(r).CompleteRouteStop(id, number); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	h.writeRoute(w, r, id)
+}
+
+// writeRoute responds with the current state of the route.
+func (h apiHandler) writeRoute(w http.ResponseWriter, r *http.Request, id int) {
+	route, err := h.as(r).Route(id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toRouteJSON(route))
+}
+
+// orders serves /orders.
+func (h apiHandler) orders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req orderRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	order, err := h.as(r).CreateOrder(req.Client)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/orders/%d", order.ID))
+	writeJSON(w, http.StatusCreated, orderJSON(order))
+}
+
+// order serves /orders/{id} and its parcels.
+func (h apiHandler) order(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/orders/"), "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || id <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		h.writeOrder(w, r, id)
+	case len(parts) == 2 && parts[1] == "parcels":
+		h.orderParcels(w, r, id)
+	case len(parts) == 3 && parts[1] == "parcels":
+		number, err := strconv.Atoi(parts[2])
+		if err != nil || number <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodDelete {
+			methodNotAllowed(w, http.MethodDelete)
+			return
+		}
+		if err := h.as(r).RemoveOrderParcel(id, number); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h apiHandler) orderParcels(w http.ResponseWriter, r *http.Request, id int) {
+	switch r.Method {
+	case http.MethodGet:
+		parcels, err := h.as(r).GetByOrder(id)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		labels := h.labels(r)
+		res := make([]parcelJSON, 0, len(parcels))
+		for _, p := range parcels {
+			res = append(res, toParcelJSON(p, labels))
+		}
+		writeJSON(w, http.StatusOK, res)
+
+	case http.MethodPost:
+		var req orderParcelRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := h.as(r).AddOrderParcel(id, req.Parcel); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		h.writeOrder(w, r, id)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// writeOrder responds with the current state of the order.
+func (h apiHandler) writeOrder(w http.ResponseWriter, r *http.Request, id int) {
+	order, err := h.as(r).Order(id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, orderJSON(order))
+}
+
+// claims serves /claims.
+func (h apiHandler) claims(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = ClaimOpen
+	}
+	claims, err := h.as(r).ClaimsByStatus(status)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeClaims(w, claims)
+}
+
+// claim serves /claims/{id} and its decisions.
+func (h apiHandler) claim(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/claims/"), "/")
+	claimID, err := strconv.Atoi(id)
+	if err != nil || claimID <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	want := http.MethodPost
+	if action == "" {
+		want = http.MethodGet
+	}
+	if r.Method != want {
+		methodNotAllowed(w, want)
+		return
+	}
+
+	var c Claim
+	switch action {
+	case "":
+		c, err = h.as(r).Claim(claimID)
+	case "approve":
+		var req claimApprovalRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		c, err = h.as(r).ApproveClaim(claimID, req.Payout, req.Note)
+	case "reject":
+		var req claimRejectionRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		c, err = h.as(r).RejectClaim(claimID, req.Reason)
+	case "pay":
+		c, err = h.as(r).PayClaim(claimID)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toClaimJSON(c))
+}
+
+// writeClaims responds with claims.
+func writeClaims(w http.ResponseWriter, claims []Claim) {
+	res := make([]claimJSON, 0, len(claims))
+	for _, c := range claims {
+		res = append(res, toClaimJSON(c))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// parcelTemplates serves /parcel-templates.
+func (h apiHandler) parcelTemplates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		client, err := strconv.Atoi(r.URL.Query().Get("client"))
+		if err != nil || client <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("query parameter client must be a positive integer"))
+			return
+		}
+		templates, err := h.as(r).ParcelTemplates(client)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		res := make([]parcelTemplateJSON, 0, len(templates))
+		for _, t := range templates {
+			res = append(res, parcelTemplateJSON(t))
+		}
+		writeJSON(w, http.StatusOK, res)
+
+	case http.MethodPost:
+		var req parcelTemplateRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		t, err := h.as(r).SaveParcelTemplate(ParcelTemplate{Client: req.Client, Name: req.Name, Address: req.Address,
+			ServiceClass: req.ServiceClass, WeightGrams: req.WeightGrams})
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/parcel-templates/%d", t.ID))
+		writeJSON(w, http.StatusCreated, parcelTemplateJSON(t))
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// drafts serves /drafts.
+func (h apiHandler) drafts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		client, err := strconv.Atoi(r.URL.Query().Get("client"))
+		if err != nil || client <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("query parameter client must be a positive integer"))
+			return
+		}
+		drafts, err := h.as(r).Drafts(client)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		res := make([]draftJSON, 0, len(drafts))
+		for _, d := range drafts {
+			res = append(res, toDraftJSON(d))
+		}
+		writeJSON(w, http.StatusOK, res)
+
+	case http.MethodPost:
+		var req draftRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.Parcel.SavedAddress != 0 {
+			writeError(w, http.StatusBadRequest, errors.New("a draft cannot go to a saved address"))
+			return
+		}
+		draft, err := req.Parcel.draft()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		var d ParcelDraft
+		if req.ActivateAt == "" {
+			d, err = h.as(r).SaveDraft(draft)
+		} else {
+			at, perr := time.Parse(time.RFC3339, req.ActivateAt)
+			if perr != nil {
+				writeError(w, http.StatusBadRequest, errors.New("activate_at must be a time like 2024-01-31T03:00:00Z"))
+				return
+			}
+			d, err = h.as(r).ScheduleRegistration(draft, at)
+		}
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/drafts/%d", d.ID))
+		writeJSON(w, http.StatusCreated, toDraftJSON(d))
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// draft serves /drafts/{id} and its confirmation.
+func (h apiHandler) draft(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/drafts/"), "/")
+	draftID, err := strconv.Atoi(id)
+	if err != nil || draftID <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch action {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			d, err := h.as(r).Draft(draftID)
+			if err != nil {
+				writeServiceError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, toDraftJSON(d))
+		case http.MethodPut:
+			var req registerRequest
+			if err := decodeJSON(r, &req); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			if req.SavedAddress != 0 {
+				writeError(w, http.StatusBadRequest, errors.New("a draft cannot go to a saved address"))
+				return
+			}
+			parcel, err := req.draft()
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			d, err := h.as(r).UpdateDraft(draftID, parcel)
+			if err != nil {
+				writeServiceError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, toDraftJSON(d))
+		case http.MethodDelete:
+			if err := h.as(r).DiscardDraft(draftID); err != nil {
+				writeServiceError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+		}
+
+	case "confirm":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		parcel, err := h.as(r).ConfirmDraft(draftID)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/parcels/"+parcel.PublicID)
+		writeJSON(w, http.StatusCreated, toParcelJSON(parcel, h.labels(r)))
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// parcelTemplate serves /parcel-templates/{id} and registration from it.
+func (h apiHandler) parcelTemplate(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/parcel-templates/"), "/")
+	templateID, err := strconv.Atoi(id)
+	if err != nil || templateID <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch action {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			t, err := h.as(r).ParcelTemplate(templateID)
+			if err != nil {
+				writeServiceError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, parcelTemplateJSON(t))
+		case http.MethodDelete:
+			if err := h.as(r).DeleteParcelTemplate(templateID); err != nil {
+				writeServiceError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		}
+
+	case "parcels":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		parcel, err := h.as(r).RegisterFromTemplate(templateID)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/parcels/"+parcel.PublicID)
+		writeJSON(w, http.StatusCreated, toParcelJSON(parcel, h.labels(r)))
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// savedAddresses serves /clients/{client}/addresses and its entries.
+func (h apiHandler) savedAddresses(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/clients/"), "/")
+	client, err := strconv.Atoi(parts[0])
+	if err != nil || client <= 0 || len(parts) < 2 || len(parts) > 3 || parts[1] != "addresses" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(parts) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			addresses, err := h.as(r).SavedAddresses(client)
+			if err != nil {
+				writeServiceError(w, err)
+				return
+			}
+			res := make([]savedAddressJSON, 0, len(addresses))
+			for _, a := range addresses {
+				res = append(res, savedAddressJSON(a))
+			}
+			writeJSON(w, http.StatusOK, res)
+
+		case http.MethodPost:
+			var req savedAddressRequest
+			if err := decodeJSON(r, &req); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			a, err := h.as(r).SaveAddress(SavedAddress{Client: client, Label: req.Label, Address: req.Address,
+				Default: req.Default})
+			if err != nil {
+				writeServiceError(w, err)
+				return
+			}
+			w.Header().Set("Location", fmt.Sprintf("/clients/%d/addresses/%d", client, a.ID))
+			writeJSON(w, http.StatusCreated, savedAddressJSON(a))
+
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+		return
+	}
+
+	id, err := strconv.Atoi(parts[2])
+	if err != nil || id <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		var req savedAddressRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		a, err := h.as(r).UpdateSavedAddress(SavedAddress{ID: id, Client: client, Label: req.Label,
+			Address: req.Address, Default: req.Default})
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, savedAddressJSON(a))
+
+	case http.MethodDelete:
+		if err := h.as(r).DeleteSavedAddress(client, id); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		methodNotAllowed(w, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// workItems serves /work-items.
+func (h apiHandler) workItems(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		f := WorkItemFilter{Open: true, State: q.Get("state"), Kind: q.Get("kind"), Assignee: q.Get("assignee")}
+		if v := q.Get("parcel"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, errors.New("query parameter parcel must be an integer"))
+				return
+			}
+			f.Number = n
+		}
+		items, err := h.as(r).WorkItems(f)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		res := make([]workItemJSON, 0, len(items))
+		for _, item := range items {
+			res = append(res, toWorkItemJSON(item))
+		}
+		writeJSON(w, http.StatusOK, res)
+
+	case http.MethodPost:
+		var req workItemRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		item, err := h.as(r).ReportWorkItem(req.Parcel, req.Kind, req.Detail)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/work-items/%d", item.ID))
+		writeJSON(w, http.StatusCreated, toWorkItemJSON(item))
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// workItem serves /work-items/{id}, its assignment and resolution.
+func (h apiHandler) workItem(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/work-items/"), "/")
+	itemID, err := strconv.Atoi(id)
+	if err != nil || itemID <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	want := http.MethodPost
+	if action == "" {
+		want = http.MethodGet
+	}
+	if r.Method != want {
+		methodNotAllowed(w, want)
+		return
+	}
+
+	var item WorkItem
+	switch action {
+	case "":
+		item, err = h.as(r).WorkItem(itemID)
+	case "assign":
+		var req workItemAssignRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		item, err = h.as(r).AssignWorkItem(itemID, req.Assignee)
+	case "resolve":
+		var req workItemResolveRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		item, err = h.as(r).ResolveWorkItem(itemID, req.State, req.Resolution)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toWorkItemJSON(item))
+}
+
+// contentRestrictions serves /content-restrictions.
+func (h apiHandler) contentRestrictions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		restrictions, err := h.as(r).ContentRestrictions()
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		res := make([]contentRestrictionJSON, 0, len(restrictions))
+		for _, rs := range restrictions {
+			res = append(res, contentRestrictionJSON(rs))
+		}
+		writeJSON(w, http.StatusOK, res)
+
+	case http.MethodPost:
+		var req contentRestrictionRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		rs, err := h.as(r).AddContentRestriction(req.Category, req.Zone)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/content-restrictions/%d", rs.ID))
+		writeJSON(w, http.StatusCreated, contentRestrictionJSON(rs))
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// contentRestriction serves /content-restrictions/{id}.
+func (h apiHandler) contentRestriction(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/content-restrictions/"))
+	if err != nil || id <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+
+	if err := h.as(r).DeleteContentRestriction(id); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// warehouses serves /warehouses.
+func (h apiHandler) warehouses(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		warehouses, err := h.as(r).Warehouses()
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		res := make([]warehouseJSON, 0, len(warehouses))
+		for _, wh := range warehouses {
+			res = append(res, warehouseJSON(wh))
+		}
+		writeJSON(w, http.StatusOK, res)
+
+	case http.MethodPost:
+		var req warehouseRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		wh, err := h.as(r).AddWarehouse(Warehouse{Code: req.Code, Name: req.Name, Address: req.Address})
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, warehouseJSON(wh))
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// pickupPoints serves /pickup-points.
+func (h apiHandler) pickupPoints(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		points, err := h.as(r).PickupPoints()
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		res := make([]pickupPointJSON, 0, len(points))
+		for _, p := range points {
+			res = append(res, pickupPointJSON(p))
+		}
+		writeJSON(w, http.StatusOK, res)
+
+	case http.MethodPost:
+		var req pickupPointRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		point, err := h.as(r).AddPickupPoint(PickupPoint{Name: req.Name, Address: req.Address, Capacity: req.Capacity})
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/pickup-points/%d", point.ID))
+		writeJSON(w, http.StatusCreated, pickupPointJSON(point))
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// pickupPoint serves /pickup-points/{id} and the parcels awaiting pickup.
+func (h apiHandler) pickupPoint(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/pickup-points/")
+	idText, sub, _ := strings.Cut(rest, "/")
+	id, err := strconv.Atoi(idText)
+	if err != nil || id <= 0 || (sub != "" && sub != "parcels") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	if sub == "" {
+		point, err := h.as(r).PickupPoint(id)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, pickupPointJSON(point))
+		return
+	}
+
+	parcels, err := h.as(r).AwaitingPickup(id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	labels := h.labels(r)
+	res := make([]parcelJSON, 0, len(parcels))
+	for _, p := range parcels {
+		res = append(res, toParcelJSON(p, labels))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// writeParcel responds with the current state of the parcel.
+func (h apiHandler) writeParcel(w http.ResponseWriter, r *http.Request, number int) {
+	parcel, err := h.service.Get(number)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toParcelJSON(parcel, h.labels(r)))
+}
+
+// decodeJSON decodes the request body into v, rejecting unknown fields.
+func decodeJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError responds with err and its ErrorCode, or the generic code
+// of the status if it has none.
+func writeError(w http.ResponseWriter, status int, err error) {
+	code := ErrorCodeOf(err)
+	if code == "" {
+		code = statusCode(status)
+	}
+	writeJSON(w, status, errorJSON{Error: err.Error(), Code: code, Fields: toFieldErrorsJSON(err)})
+}
+
+// writeServiceError maps a service error to an HTTP status code.
+func writeServiceError(w http.ResponseWriter, err error) {
+	writeError(w, httpStatus(err), err)
+}
+
+// httpStatus returns the HTTP status code for a service error: that of
+// its code in codeStatus, 500 for an error without a code.
+func httpStatus(err error) int {
+	if status, ok := codeStatus[ErrorCodeOf(err)]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// codeStatus maps error codes to HTTP status codes.
+var codeStatus = map[ErrorCode]int{
+	CodeParcelNotFound:         http.StatusNotFound,
+	CodeRouteNotFound:          http.StatusNotFound,
+	CodeOrderNotFound:          http.StatusNotFound,
+	CodeClaimNotFound:          http.StatusNotFound,
+	CodeRestrictionNotFound:    http.StatusNotFound,
+	CodePickupPointNotFound:    http.StatusNotFound,
+	CodeWarehouseNotFound:      http.StatusNotFound,
+	CodeLocationUnknown:        http.StatusNotFound,
+	CodeNoProof:                http.StatusNotFound,
+	CodeWorkItemNotFound:       http.StatusNotFound,
+	CodeSavedAddressNotFound:   http.StatusNotFound,
+	CodeParcelTemplateNotFound: http.StatusNotFound,
+	CodeDraftNotFound:          http.StatusNotFound,
+
+	CodeInvalidAPIKey: http.StatusUnauthorized,
+	CodeForbidden:     http.StatusForbidden,
+
+	CodeRequiresRegistered:   http.StatusConflict,
+	CodeDuplicateParcel:      http.StatusConflict,
+	CodeRequiresPaid:         http.StatusConflict,
+	CodePaymentTransition:    http.StatusConflict,
+	CodeRequiresSent:         http.StatusConflict,
+	CodeParcelOnRoute:        http.StatusConflict,
+	CodeParcelInOrder:        http.StatusConflict,
+	CodeCurrencyMismatch:     http.StatusConflict,
+	CodeBrokenReference:      http.StatusConflict,
+	CodeParcelsInTransit:     http.StatusConflict,
+	CodeClaimTransition:      http.StatusConflict,
+	CodeWorkItemTransition:   http.StatusConflict,
+	CodePickupPointFull:      http.StatusConflict,
+	CodeInvalidTransition:    http.StatusConflict,
+	CodeRepacked:             http.StatusConflict,
+	CodeCustomsDeclaration:   http.StatusConflict,
+	CodeDeliveryCodeRequired: http.StatusConflict,
+	CodeDeliveryCodeLocked:   http.StatusConflict,
+	CodeNoDeliveryCode:       http.StatusConflict,
+	CodeDeliverySlotFull:     http.StatusConflict,
+	CodeParcelHeld:           http.StatusConflict,
+	CodeNotHeld:              http.StatusConflict,
+	CodeWrongDeliveryCode:    http.StatusUnprocessableEntity,
+
+	CodeUnknownStatus:         http.StatusBadRequest,
+	CodeUnknownServiceClass:   http.StatusBadRequest,
+	CodeUnknownPayment:        http.StatusBadRequest,
+	CodeUnknownContent:        http.StatusBadRequest,
+	CodeUnknownScanType:       http.StatusBadRequest,
+	CodeInvalidAttribute:      http.StatusBadRequest,
+	CodeInvalidLabel:          http.StatusBadRequest,
+	CodeInvalidTrackingCode:   http.StatusBadRequest,
+	CodeInvalidParcel:         http.StatusBadRequest,
+	CodeInvalidRecipient:      http.StatusBadRequest,
+	CodeInvalidAddress:        http.StatusBadRequest,
+	CodeInvalidCoordinates:    http.StatusBadRequest,
+	CodeInvalidFilter:         http.StatusBadRequest,
+	CodeInvalidTariff:         http.StatusBadRequest,
+	CodeInvalidRoute:          http.StatusBadRequest,
+	CodeInvalidOrder:          http.StatusBadRequest,
+	CodeInvalidClaim:          http.StatusBadRequest,
+	CodeInvalidPickupPoint:    http.StatusBadRequest,
+	CodeInvalidWarehouse:      http.StatusBadRequest,
+	CodeInvalidLocation:       http.StatusBadRequest,
+	CodeEmptySearch:           http.StatusBadRequest,
+	CodeInvalidComment:        http.StatusBadRequest,
+	CodeInvalidProof:          http.StatusBadRequest,
+	CodeInvalidOverride:       http.StatusBadRequest,
+	CodeInvalidRepack:         http.StatusBadRequest,
+	CodeInvalidCustoms:        http.StatusBadRequest,
+	CodeInvalidErasure:        http.StatusBadRequest,
+	CodeInvalidSync:           http.StatusBadRequest,
+	CodeInvalidDeliveryWindow: http.StatusBadRequest,
+	CodeInvalidHold:           http.StatusBadRequest,
+	CodeInvalidPublicID:       http.StatusBadRequest,
+	CodeInvalidWorkItem:       http.StatusBadRequest,
+	CodeInvalidSavedAddress:   http.StatusBadRequest,
+	CodeInvalidEmail:          http.StatusBadRequest,
+	CodeInvalidParcelTemplate: http.StatusBadRequest,
+	CodeInvalidDraft:          http.StatusBadRequest,
+	CodeInvalidCurrency:       http.StatusBadRequest,
+
+	CodeNoTariff:           http.StatusUnprocessableEntity,
+	CodeRestrictedContents: http.StatusUnprocessableEntity,
+
+	CodeSearchUnavailable: http.StatusNotImplemented,
+	CodeQueryTimeout:      http.StatusServiceUnavailable,
+}
+
+// statusCode returns the generic code of an error without one of its own
+// answered with the HTTP status.
+func statusCode(status int) ErrorCode {
+	switch {
+	case status == http.StatusNotFound:
+		return CodeNotFound
+	case status == http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case status == http.StatusTooManyRequests:
+		return CodeRateLimited
+	case status < http.StatusInternalServerError:
+		return CodeInvalidRequest
+	default:
+		return CodeInternal
+	}
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
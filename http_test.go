@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// doRequest sends a request to h and returns the recorded response.
+func doRequest(t *testing.T, h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req = req.WithContext(ContextWithPrincipal(req.Context(), Principal{Role: RoleAdmin}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestHTTPParcelLifecycle verifies registering, advancing and reading a
+// parcel through the REST API.
+func TestHTTPParcelLifecycle(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service)
+
+	// register
+	rec := doRequest(t, h, http.MethodPost, "/parcels", `{"client": 1000, "address": "test"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var created parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	assert.Equal(t, ParcelStatusRegistered, created.Status)
+	assert.NotEmpty(t, created.TrackingCode)
+	assert.Len(t, created.ID, 26)
+	assert.Equal(t, "/parcels/"+created.ID, rec.Header().Get("Location"))
+
+	// advance before and after payment
+	rec = doRequest(t, h, http.MethodPost, "/parcels/1/next-status", "")
+	require.Equal(t, http.StatusConflict, rec.Code)
+	rec = doRequest(t, h, http.MethodPut, "/parcels/1/payment", `{"status": "paid"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequest(t, h, http.MethodPost, "/parcels/1/next-status", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// change address after dispatch
+	rec = doRequest(t, h, http.MethodPut, "/parcels/1/address", `{"address": "new"}`)
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	// check
+	rec = doRequest(t, h, http.MethodGet, "/parcels/1/history", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var history []statusChangeJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&history))
+	require.Len(t, history, 2)
+	assert.Equal(t, ParcelStatusSent, history[1].Status)
+
+	rec = doRequest(t, h, http.MethodGet, "/parcels?client=1000", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var parcels []parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&parcels))
+	require.Len(t, parcels, 1)
+	assert.Equal(t, ParcelStatusSent, parcels[0].Status)
+}
+
+// TestHTTPErrors ensures that errors map to the expected status codes.
+func TestHTTPErrors(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service)
+
+	// check
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodGet, "/parcels/42", "").Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodGet, "/parcels/abc", "").Code)
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodPost, "/parcels", `{"unknown": 1}`).Code)
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodGet, "/parcels?client=abc", "").Code)
+
+	rec := doRequest(t, h, http.MethodPatch, "/parcels/42", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET, DELETE", rec.Header().Get("Allow"))
+}
+
+// TestTrackingPage verifies that the tracking page shows the status
+// without revealing the address.
+func TestTrackingPage(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	parcel, err := service.Register(1000, "Secret street 1")
+	require.NoError(t, err)
+	h := NewHTTPHandler(service)
+
+	// track
+	rec := doRequest(t, h, http.MethodGet, "/?lang=ru&code="+parcel.TrackingCode, "")
+
+	// check
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Зарегистрирована")
+	assert.NotContains(t, rec.Body.String(), "Secret street")
+
+	rec = doRequest(t, h, http.MethodGet, "/?code=PKG-2024-000999-0", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+// TestHTTPTrack verifies the public tracking endpoint and its rate limit.
+func TestHTTPTrack(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	parcel, err := service.Register(1000, "Secret street 1, Kazan")
+	require.NoError(t, err)
+	h := NewHTTPHandler(service)
+
+	// track
+	rec := doRequest(t, h, http.MethodGet, "/track/"+parcel.TrackingCode, "")
+
+	// check
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "Secret street")
+	assert.NotContains(t, rec.Body.String(), "1000")
+	var view trackingJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&view))
+	assert.Equal(t, ParcelStatusRegistered, view.Status)
+	assert.Equal(t, "Kazan", view.City)
+	require.Len(t, view.History, 1)
+
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodGet, "/track/PKG-2024-000999-0", "").Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodGet, "/track/nonsense", "").Code)
+
+	for i := 3; i < TrackBurst; i++ {
+		doRequest(t, h, http.MethodGet, "/track/"+parcel.TrackingCode, "")
+	}
+	assert.Equal(t, http.StatusTooManyRequests, doRequest(t, h, http.MethodGet, "/track/"+parcel.TrackingCode, "").Code)
+}
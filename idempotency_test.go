@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAddWithIdempotencyKey verifies that a retried Add returns the first
+// parcel, and that keys are scoped per client.
+func TestAddWithIdempotencyKey(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store, parcel := NewParcelStore(db), getTestParcel()
+	parcel.IdempotencyKey = "retry-1"
+
+	// add
+	first, err := store.Add(parcel)
+	require.NoError(t, err)
+	retried, err := store.Add(parcel)
+	require.NoError(t, err)
+	parcel.Client = 2000
+	other, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	// check
+	assert.Equal(t, first, retried)
+	assert.NotEqual(t, first, other)
+	parcels, err := store.GetByClient(1000)
+	require.NoError(t, err)
+	assert.Len(t, parcels, 1)
+}
+
+// TestRegisterWithIdempotencyKey ensures that a retried registration over
+// HTTP neither duplicates the parcel nor its history and events.
+func TestRegisterWithIdempotencyKey(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	h := NewHTTPHandler(service, AllowAnonymous(Principal{Role: RoleAdmin}))
+
+	register := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/parcels", strings.NewReader(`{"client": 1000, "address": "test"}`))
+		req.Header.Set("Idempotency-Key", "abc")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// register twice
+	first := register()
+	require.Equal(t, http.StatusCreated, first.Code)
+	second := register()
+	require.Equal(t, http.StatusCreated, second.Code)
+
+	// check
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	history, err := service.History(1)
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+	assert.Len(t, *published, 1)
+}
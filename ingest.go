@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Defaults of IngestOptions.
+const (
+	DefaultIngestBatch    = 500
+	DefaultIngestInterval = 50 * time.Millisecond
+	DefaultIngestQueue    = 10_000
+)
+
+// IngestOptions configures an IngestBuffer.
+type IngestOptions struct {
+	// MaxBatch writes the queued parcels once this many are queued;
+	// 0 means DefaultIngestBatch.
+	MaxBatch int
+	// Interval writes the queued parcels at least this often; 0 means
+	// DefaultIngestInterval.
+	Interval time.Duration
+	// MaxQueued is the most parcels waiting to be written; Add blocks
+	// while the queue is full. 0 means DefaultIngestQueue.
+	MaxQueued int
+	// Async trades durability for latency. By default Add returns once
+	// the batch of the parcel is committed, so a returned number is as
+	// durable as that of ParcelStore.Add; batching only makes concurrent
+	// callers share a transaction. With Async, Add returns 0 as soon as
+	// the parcel is queued: the caller goes on at once, but parcels still
+	// queued are lost if the process dies, and failures are only reported
+	// to OnError.
+	Async bool
+	// OnError, if set, is called from the writing goroutine with every
+	// parcel that could not be added and why.
+	OnError func(p Parcel, err error)
+}
+
+// withDefaults returns o with zero fields set to their defaults.
+func (o IngestOptions) withDefaults() (IngestOptions, error) {
+	if o.MaxBatch < 0 || o.Interval < 0 || o.MaxQueued < 0 {
+		return o, fmt.Errorf("%w: negative ingest batch, interval or queue", ErrInvalidOption)
+	}
+	if o.MaxBatch == 0 {
+		o.MaxBatch = DefaultIngestBatch
+	}
+	if o.Interval == 0 {
+		o.Interval = DefaultIngestInterval
+	}
+	if o.MaxQueued == 0 {
+		o.MaxQueued = DefaultIngestQueue
+	}
+	return o, nil
+}
+
+// ingestItem is a queued parcel; done, unless nil, receives the result of
+// adding it.
+type ingestItem struct {
+	parcel Parcel
+	done   chan ingestResult
+}
+
+type ingestResult struct {
+	number int
+	err    error
+}
+
+// IngestBuffer queues parcels and adds them in batches, one transaction
+// per batch, so that spikes of registrations such as a manifest of
+// thousands of parcels cost a commit per batch rather than per parcel.
+// See IngestOptions for when a batch is written and for the durability
+// of queued parcels.
+//
+// A parcel that fails in a batch does not fail the others: the batch is
+// then retried one parcel at a time. Parcels are validated before they
+// are queued, so most failures are reported by Add itself.
+//
+// An IngestBuffer is safe for concurrent use. Close writes what is
+// queued and stops it; close it before its store, as closing the store
+// stops it too but fails what is still queued with ErrStoreClosed.
+type IngestBuffer struct {
+	store ParcelStore
+	opts  IngestOptions
+	items chan ingestItem
+	flush chan chan struct{}
+
+	// mu guards closed; Add holds it for reading while it queues, so that
+	// nothing is queued once the writer has taken its last look.
+	mu     sync.RWMutex
+	closed bool
+	// stopping is closed when the writer starts stopping, to wake Add and
+	// Flush calls waiting on it; stopped when it has stopped.
+	stopping  chan struct{}
+	stopped   chan struct{}
+	quit      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewIngestBuffer returns a buffer adding parcels to the store in
+// batches, written by a background worker of the store.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised, and
+//     ErrStoreClosed if it has been closed.
+//   - Returns ErrInvalidOption (wrapped) for negative options.
+func (s ParcelStore) NewIngestBuffer(opts IngestOptions) (*IngestBuffer, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	b := &IngestBuffer{
+		store:    s,
+		opts:     opts,
+		items:    make(chan ingestItem, opts.MaxQueued),
+		flush:    make(chan chan struct{}),
+		stopping: make(chan struct{}),
+		stopped:  make(chan struct{}),
+		quit:     make(chan struct{}),
+	}
+	if err := s.startWorker(b.run); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Add queues p to be added to the store.
+//
+// Behaviour:
+//   - Returns a *ValidationError (wrapped) if p.Validate fails, without
+//     queueing it.
+//   - Blocks while the queue is full.
+//   - Returns ErrStoreClosed once the buffer or its store is closed.
+//   - Unless IngestOptions.Async is set, waits for the batch of p to be
+//     written and returns the number of p or the error adding it, as
+//     ParcelStore.Add does; with it, returns 0 once p is queued.
+func (b *IngestBuffer) Add(p Parcel) (int, error) {
+	if err := p.Validate(); err != nil {
+		return 0, fmt.Errorf("failed to queue parcel for client %d: %w", pii(p.Client), err)
+	}
+
+	item := ingestItem{parcel: p}
+	if !b.opts.Async {
+		item.done = make(chan ingestResult, 1)
+	}
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return 0, ErrStoreClosed
+	}
+	select {
+	case b.items <- item:
+	case <-b.stopping:
+		b.mu.RUnlock()
+		return 0, ErrStoreClosed
+	}
+	b.mu.RUnlock()
+
+	if item.done == nil {
+		return 0, nil
+	}
+	res := <-item.done
+	return res.number, res.err
+}
+
+// Flush writes every parcel queued before it was called and returns once
+// they are committed, or ErrStoreClosed if the buffer has stopped; then
+// everything queued has been written already.
+func (b *IngestBuffer) Flush() error {
+	done := make(chan struct{})
+	select {
+	case b.flush <- done:
+	case <-b.stopping:
+		<-b.stopped
+		return ErrStoreClosed
+	}
+	<-done
+	return nil
+}
+
+// Close writes what is queued and stops the buffer. Further calls do
+// nothing.
+func (b *IngestBuffer) Close() error {
+	b.closeOnce.Do(func() { close(b.quit) })
+	<-b.stopped
+	return nil
+}
+
+// run is the writer: it collects queued parcels into batches and writes
+// them until the buffer or the store is closed.
+func (b *IngestBuffer) run(ctx context.Context) {
+	defer close(b.stopped)
+	ticker := time.NewTicker(b.opts.Interval)
+	defer ticker.Stop()
+
+	var batch []ingestItem
+	for {
+		select {
+		case item := <-b.items:
+			batch = append(batch, item)
+			if len(batch) >= b.opts.MaxBatch {
+				b.write(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			b.write(batch)
+			batch = nil
+		case done := <-b.flush:
+			b.write(b.drain(batch))
+			batch = nil
+			close(done)
+		case <-ctx.Done():
+			b.stop(batch)
+			return
+		case <-b.quit:
+			b.stop(batch)
+			return
+		}
+	}
+}
+
+// stop refuses further parcels and writes batch and the rest of the queue.
+func (b *IngestBuffer) stop(batch []ingestItem) {
+	close(b.stopping)
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.write(b.drain(batch))
+}
+
+// drain appends every queued item to batch.
+func (b *IngestBuffer) drain(batch []ingestItem) []ingestItem {
+	for {
+		select {
+		case item := <-b.items:
+			batch = append(batch, item)
+		default:
+			return batch
+		}
+	}
+}
+
+// write adds the parcels of batch, in chunks of at most MaxBatch, and
+// reports the outcome of each.
+func (b *IngestBuffer) write(batch []ingestItem) {
+	for len(batch) > 0 {
+		n := min(len(batch), b.opts.MaxBatch)
+		b.writeChunk(batch[:n])
+		batch = batch[n:]
+	}
+}
+
+func (b *IngestBuffer) writeChunk(chunk []ingestItem) {
+	results := make([]ingestResult, len(chunk))
+	err := b.store.InTx(func(tx ParcelStore) error {
+		for i, item := range chunk {
+			number, err := tx.Add(item.parcel)
+			if err != nil {
+				return err
+			}
+			results[i].number = number
+		}
+		return nil
+	})
+	if err != nil {
+		// find the parcels at fault rather than failing them all
+		for i, item := range chunk {
+			results[i].number, results[i].err = b.store.Add(item.parcel)
+		}
+	}
+
+	for i, item := range chunk {
+		if results[i].err != nil && b.opts.OnError != nil {
+			b.opts.OnError(item.parcel, results[i].err)
+		}
+		if item.done != nil {
+			item.done <- results[i]
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestIngestBuffer verifies that concurrent adds are batched and each
+// caller gets the number of its own parcel.
+func TestIngestBuffer(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	buffer, err := store.NewIngestBuffer(IngestOptions{MaxBatch: 10, Interval: time.Hour})
+	require.NoError(t, err)
+	defer buffer.Close()
+
+	// add
+	const n = 50
+	numbers := make([]int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p := getTestParcel()
+			p.Client = 1000 + i
+			number, err := buffer.Add(p)
+			assert.NoError(t, err)
+			numbers[i] = number
+		}(i)
+	}
+	wg.Wait()
+
+	// check
+	for i, number := range numbers {
+		p, err := store.Get(number)
+		require.NoError(t, err)
+		assert.Equal(t, 1000+i, p.Client)
+	}
+}
+
+// TestIngestBufferFailures verifies that a failing parcel fails alone,
+// and that invalid parcels are refused before they are queued.
+func TestIngestBufferFailures(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	var failed []Parcel
+	buffer, err := store.NewIngestBuffer(IngestOptions{Async: true, Interval: time.Hour,
+		OnError: func(p Parcel, err error) { failed = append(failed, p) }})
+	require.NoError(t, err)
+	defer buffer.Close()
+
+	// add
+	p := getTestParcel()
+	p.PublicID = getTestPublicID(t)
+	for i := 0; i < 3; i++ {
+		number, err := buffer.Add(p)
+		require.NoError(t, err)
+		assert.Zero(t, number)
+	}
+	invalid := getTestParcel()
+	invalid.Status = "lost"
+	_, err = buffer.Add(invalid)
+	var verr *ValidationError
+	assert.True(t, errors.As(err, &verr), "%v", err)
+
+	// check
+	require.NoError(t, buffer.Flush())
+	parcels, err := store.GetByClient(p.Client)
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	assert.Equal(t, p.PublicID, parcels[0].PublicID)
+	assert.Len(t, failed, 2)
+}
+
+// TestIngestBufferClose verifies that closing writes what is queued and
+// refuses further parcels.
+func TestIngestBufferClose(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	buffer, err := store.NewIngestBuffer(IngestOptions{Async: true, Interval: time.Hour})
+	require.NoError(t, err)
+	_, err = buffer.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// close
+	require.NoError(t, buffer.Close())
+	require.NoError(t, buffer.Close())
+
+	// check
+	parcels, err := store.GetByClient(getTestParcel().Client)
+	require.NoError(t, err)
+	assert.Len(t, parcels, 1)
+	_, err = buffer.Add(getTestParcel())
+	assert.ErrorIs(t, err, ErrStoreClosed)
+	assert.ErrorIs(t, buffer.Flush(), ErrStoreClosed)
+
+	_, err = store.NewIngestBuffer(IngestOptions{MaxBatch: -1})
+	assert.ErrorIs(t, err, ErrInvalidOption)
+}
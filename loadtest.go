@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// LoadTest configures RunLoadTest.
+type LoadTest struct {
+	// Parcels are seeded with SeedParcels before measuring, spread over
+	// Clients clients.
+	Parcels int
+	Clients int
+	// Workers run operations concurrently for Duration.
+	Workers  int
+	Duration time.Duration
+	// WriteRatio is the share of operations that add a parcel, from 0 to
+	// 1; the rest get the parcels of a random client.
+	WriteRatio float64
+}
+
+// LoadResult is the outcome of RunLoadTest.
+type LoadResult struct {
+	Options Options
+	// Seeded parcels took SeedTime to insert.
+	Seeded   int
+	SeedTime time.Duration
+	// Reads, Writes and Errors count the operations run in Elapsed;
+	// failed operations count as errors only.
+	Reads, Writes, Errors int
+	Elapsed               time.Duration
+}
+
+// ReadsPerSecond returns the throughput of GetByClient.
+func (r LoadResult) ReadsPerSecond() float64 {
+	return float64(r.Reads) / r.Elapsed.Seconds()
+}
+
+// WritesPerSecond returns the throughput of Add.
+func (r LoadResult) WritesPerSecond() float64 {
+	return float64(r.Writes) / r.Elapsed.Seconds()
+}
+
+// SeedParcels inserts n registered parcels of clients 1 to clients, in
+// one statement, for benchmarks and load tests: unlike Add it assigns
+// neither tracking codes, reference numbers nor public IDs, encrypts
+// nothing and bypasses the cache.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Parcels follow the existing ones in the creation sequence.
+//   - Wraps and returns any SQL errors.
+func (s ParcelStore) SeedParcels(n, clients int) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	query := `INSERT INTO parcel (client, status, address, created_at, seq)
+WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < :count)
+SELECT 1 + i % :clients, :status, 'Load test street ' || i, :created_at,
+    (SELECT COALESCE(MAX(seq), 0) FROM parcel) + i FROM n`
+	_, err := s.conn().Exec(query, sql.Named("count", n), sql.Named("clients", max(clients, 1)),
+		sql.Named("status", ParcelStatusRegistered),
+		sql.Named("created_at", FormatTimestamp(time.Now(), DefaultTimestampPrecision)))
+	if err != nil {
+		return fmt.Errorf("failed to seed %d parcels: %w", n, err)
+	}
+	return nil
+}
+
+// RunLoadTest creates a database at path with opts, seeds it and measures
+// the throughput of a mix of Add and GetByClient, e.g. to compare journal
+// modes. The database is left in place.
+//
+// Behaviour:
+//   - Returns ErrInvalidOption (wrapped) if opts fail validation.
+//   - Operations failing under contention, e.g. with SQLITE_BUSY, are
+//     counted as errors and the test goes on.
+//   - Wraps and returns errors opening, migrating or seeding the database.
+func RunLoadTest(path string, opts Options, lt LoadTest) (LoadResult, error) {
+	res := LoadResult{Options: opts}
+	store, err := OpenParcelStore(path, opts)
+	if err != nil {
+		return res, err
+	}
+	defer store.Close()
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		return res, err
+	}
+
+	start := time.Now()
+	if err := store.SeedParcels(lt.Parcels, lt.Clients); err != nil {
+		return res, err
+	}
+	res.Seeded, res.SeedTime = lt.Parcels, time.Since(start)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	start = time.Now()
+	deadline := start.Add(lt.Duration)
+	for w := 0; w < max(lt.Workers, 1); w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			var reads, writes, errs int
+			for time.Now().Before(deadline) {
+				client := 1 + rnd.Intn(max(lt.Clients, 1))
+				var err error
+				write := rnd.Float64() < lt.WriteRatio
+				if write {
+					_, err = store.Add(Parcel{Client: client, Status: ParcelStatusRegistered,
+						Address: "Load test street", CreatedAt: FormatTimestamp(time.Now(), DefaultTimestampPrecision)})
+				} else {
+					_, err = store.GetByClient(client)
+				}
+				switch {
+				case err != nil:
+					errs++
+				case write:
+					writes++
+				default:
+					reads++
+				}
+			}
+			mu.Lock()
+			res.Reads, res.Writes, res.Errors = res.Reads+reads, res.Writes+writes, res.Errors+errs
+			mu.Unlock()
+		}(start.UnixNano() + int64(w))
+	}
+	wg.Wait()
+	res.Elapsed = time.Since(start)
+	return res, nil
+}
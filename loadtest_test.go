@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// benchClients is the number of clients seeded parcels are spread over.
+const benchClients = 1000
+
+// getBenchStore returns a store on a file database in WAL mode seeded
+// with n parcels.
+func getBenchStore(b *testing.B, n int) ParcelStore {
+	b.Helper()
+	store, err := OpenParcelStore(filepath.Join(b.TempDir(), "bench.db"), DefaultOptions())
+	require.NoError(b, err)
+	b.Cleanup(func() { store.Close() })
+	require.NoError(b, store.EnsureSchema(context.Background()))
+	require.NoError(b, store.SeedParcels(n, benchClients))
+	return store
+}
+
+// BenchmarkAdd measures registering a parcel, one transaction each.
+func BenchmarkAdd(b *testing.B) {
+	store := getBenchStore(b, 0)
+	parcel := getTestParcel()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := store.Add(parcel); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkGetByClient measures listing the parcels of a client among
+// 1M, about a thousand each.
+func BenchmarkGetByClient(b *testing.B) {
+	store := getBenchStore(b, 1_000_000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		parcels, err := store.GetByClient(1 + i%benchClients)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(parcels) == 0 {
+			b.Fatal("no parcels")
+		}
+	}
+}
+
+// TestSeedParcels verifies that seeded parcels are spread over the
+// clients and readable.
+func TestSeedParcels(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	number, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// seed
+	require.NoError(t, store.SeedParcels(10, 3))
+	require.NoError(t, store.SeedParcels(0, 3))
+
+	// check
+	for client, want := range map[int]int{1: 3, 2: 4, 3: 3} {
+		parcels, err := store.GetByClient(client)
+		require.NoError(t, err)
+		require.Len(t, parcels, want)
+		assert.Equal(t, ParcelStatusRegistered, parcels[0].Status)
+	}
+	parcels, err := store.Find(ParcelFilter{})
+	require.NoError(t, err)
+	require.Len(t, parcels, 11)
+	assert.Equal(t, number, parcels[0].Number)
+}
+
+// TestRunLoadTest verifies that a short load test runs both kinds of
+// operation.
+func TestRunLoadTest(t *testing.T) {
+	res, err := RunLoadTest(filepath.Join(t.TempDir(), "load.db"), DefaultOptions(),
+		LoadTest{Parcels: 1000, Clients: 10, Workers: 2, Duration: 200 * time.Millisecond, WriteRatio: 0.5})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1000, res.Seeded)
+	assert.Positive(t, res.Reads)
+	assert.Positive(t, res.Writes)
+	assert.Positive(t, res.ReadsPerSecond())
+	assert.GreaterOrEqual(t, res.Elapsed, 200*time.Millisecond)
+
+	_, err = RunLoadTest(filepath.Join(t.TempDir(), "load.db"), Options{JournalMode: "fast"}, LoadTest{})
+	assert.ErrorIs(t, err, ErrInvalidOption)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrWarehouseNotFound indicates that no warehouse exists with the
+	// requested id.
+	ErrWarehouseNotFound = newError(CodeWarehouseNotFound, "warehouse not found")
+	// ErrInvalidWarehouse indicates a Warehouse that failed validation.
+	ErrInvalidWarehouse = newError(CodeInvalidWarehouse, "invalid warehouse")
+	// ErrInvalidLocation indicates a Location naming neither a warehouse
+	// nor a place.
+	ErrInvalidLocation = newError(CodeInvalidLocation, "invalid location")
+	// ErrLocationUnknown indicates that a parcel has never been scanned.
+	ErrLocationUnknown = newError(CodeLocationUnknown, "parcel location unknown")
+)
+
+// Warehouse is a sorting centre or depot parcels pass through.
+type Warehouse struct {
+	ID int
+	// Code is the short unique identifier printed on scanners, e.g. "MSK-1".
+	Code    string
+	Name    string
+	Address string
+}
+
+// Location is one entry of a parcel's movement trail: where it was
+// scanned and when.
+type Location struct {
+	Number int
+	// Warehouse is the id of the warehouse the parcel is in, 0 if it is
+	// elsewhere, e.g. in a courier's van.
+	Warehouse int
+	// Description says where the parcel is outside a warehouse, or
+	// details the place within one, e.g. "gate 4".
+	Description string
+	ScannedAt   string
+}
+
+// AddWarehouse creates a warehouse and returns its id.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidWarehouse (wrapped) if the code or name is blank
+//     or the code is taken.
+//   - Wraps and returns any SQL error from the INSERT.
+func (s ParcelStore) AddWarehouse(w Warehouse) (int, error) {
+	if err := s.check(); err != nil {
+		return 0, err
+	}
+
+	w.Code, w.Name = strings.TrimSpace(w.Code), strings.TrimSpace(w.Name)
+	if w.Code == "" || w.Name == "" {
+		return 0, fmt.Errorf("failed to add warehouse: %w: code %q, name %q", ErrInvalidWarehouse, w.Code, w.Name)
+	}
+
+	var id int
+	err := s.InTx(func(tx ParcelStore) error {
+		var existing int
+		err := tx.conn().QueryRow("SELECT id FROM warehouse WHERE code = :code", sql.Named("code", w.Code)).Scan(&existing)
+		if err == nil {
+			return fmt.Errorf("failed to add warehouse: %w: code %q is taken by warehouse %d", ErrInvalidWarehouse, w.Code, existing)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to look up warehouse %q: %w", w.Code, err)
+		}
+
+		query := "INSERT INTO warehouse (code, name, address) VALUES (:code, :name, :address)"
+		res, err := tx.conn().Exec(query, sql.Named("code", w.Code), sql.Named("name", w.Name), sql.Named("address", w.Address))
+		if err != nil {
+			return fmt.Errorf("failed to add warehouse %q: %w", w.Code, err)
+		}
+		lastID, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get id of warehouse %q: %w", w.Code, err)
+		}
+		id = int(lastID)
+		return nil
+	})
+	return id, err
+}
+
+// GetWarehouse returns the warehouse with the given id.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrWarehouseNotFound (wrapped) if no such warehouse exists.
+//   - Wraps and returns any other SQL error.
+func (s ParcelStore) GetWarehouse(id int) (Warehouse, error) {
+	w := Warehouse{ID: id}
+
+	if err := s.check(); err != nil {
+		return w, err
+	}
+
+	err := s.conn().QueryRow("SELECT code, name, address FROM warehouse WHERE id = :id", sql.Named("id", id)).
+		Scan(&w.Code, &w.Name, &w.Address)
+	if errors.Is(err, sql.ErrNoRows) {
+		return w, fmt.Errorf("failed to get warehouse %d: %w", id, ErrWarehouseNotFound)
+	}
+	if err != nil {
+		return w, fmt.Errorf("failed to scan warehouse row with id %d: %w", id, err)
+	}
+	return w, nil
+}
+
+// GetWarehouses returns every warehouse, ordered by code.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Wraps and returns any SQL errors from query, scanning, or iteration.
+func (s ParcelStore) GetWarehouses() ([]Warehouse, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.conn().Query("SELECT id, code, name, address FROM warehouse ORDER BY code")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for warehouses: %w", err)
+	}
+	defer rows.Close()
+
+	var res []Warehouse
+	for rows.Next() {
+		var w Warehouse
+		if err := rows.Scan(&w.ID, &w.Code, &w.Name, &w.Address); err != nil {
+			return nil, fmt.Errorf("failed to scan one of warehouse rows: %w", err)
+		}
+		res = append(res, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate warehouse rows: %w", err)
+	}
+	return res, nil
+}
+
+// AddLocation appends l to the movement trail of parcel l.Number.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidLocation (wrapped) if l has neither a warehouse
+//     nor a description.
+//   - Returns ErrWarehouseNotFound (wrapped) for an unknown warehouse.
+//   - Wraps and returns any SQL error from the INSERT.
+func (s ParcelStore) AddLocation(l Location) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	l.Description = strings.TrimSpace(l.Description)
+	if l.Warehouse == 0 && l.Description == "" {
+		return fmt.Errorf("failed to add location of parcel %d: %w: no warehouse or description", l.Number, ErrInvalidLocation)
+	}
+	if l.Warehouse != 0 {
+		if _, err := s.GetWarehouse(l.Warehouse); err != nil {
+			return fmt.Errorf("failed to add location of parcel %d: %w", l.Number, err)
+		}
+	}
+
+	query := `INSERT INTO parcel_location (parcel_number, warehouse, description, scanned_at)
+VALUES (:number, :warehouse, :description, :scanned_at)`
+	_, err := s.conn().Exec(query, sql.Named("number", l.Number), sql.Named("warehouse", l.Warehouse),
+		sql.Named("description", l.Description), sql.Named("scanned_at", l.ScannedAt))
+	if err != nil {
+		return fmt.Errorf("failed to add location of parcel %d: %w", l.Number, err)
+	}
+	return nil
+}
+
+// GetLocations returns the movement trail of a parcel, oldest scan first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if the parcel has never been scanned.
+//   - Wraps and returns any SQL errors from query, scanning, or iteration.
+func (s ParcelStore) GetLocations(number int) ([]Location, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + locationColumns + " FROM parcel_location WHERE parcel_number = :number ORDER BY id"
+	rows, err := s.conn().Query(query, sql.Named("number", number))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for locations of parcel %d: %w", number, err)
+	}
+	defer rows.Close()
+
+	var res []Location
+	for rows.Next() {
+		var l Location
+		if err := rows.Scan(&l.Number, &l.Warehouse, &l.Description, &l.ScannedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan one of location rows for parcel %d: %w", number, err)
+		}
+		res = append(res, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate location rows for parcel %d: %w", number, err)
+	}
+	return res, nil
+}
+
+// GetCurrentLocation returns the latest location of a parcel.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrLocationUnknown (wrapped) if the parcel has never been scanned.
+//   - Wraps and returns any other SQL error.
+func (s ParcelStore) GetCurrentLocation(number int) (Location, error) {
+	if err := s.check(); err != nil {
+		return Location{}, err
+	}
+
+	var l Location
+	query := "SELECT " + locationColumns + " FROM parcel_location WHERE parcel_number = :number ORDER BY id DESC LIMIT 1"
+	err := s.conn().QueryRow(query, sql.Named("number", number)).Scan(&l.Number, &l.Warehouse, &l.Description, &l.ScannedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return l, fmt.Errorf("failed to get location of parcel %d: %w", number, ErrLocationUnknown)
+	}
+	if err != nil {
+		return l, fmt.Errorf("failed to scan location of parcel %d: %w", number, err)
+	}
+	return l, nil
+}
+
+// locationColumns lists the "parcel_location" columns in scan order.
+const locationColumns = "parcel_number, warehouse, description, scanned_at"
+
+// Warehouses returns every warehouse.
+func (s ParcelService) Warehouses() ([]Warehouse, error) {
+	return s.store.GetWarehouses()
+}
+
+// AddWarehouse creates a warehouse; see ParcelStore.AddWarehouse.
+func (s ParcelService) AddWarehouse(w Warehouse) (Warehouse, error) {
+	id, err := s.store.AddWarehouse(w)
+	if err != nil {
+		return w, err
+	}
+	return s.store.GetWarehouse(id)
+}
+
+// RecordLocation records that the parcel was scanned at warehouse (0 if
+// outside one) or the place described, now.
+func (s ParcelService) RecordLocation(number, warehouse int, description string) (Location, error) {
+	l := Location{Number: number, Warehouse: warehouse, Description: strings.TrimSpace(description),
+		ScannedAt: s.timestamp(time.Now())}
+
+	err := s.store.InTx(func(tx ParcelStore) error {
+		if _, err := tx.getStatus(number); err != nil {
+			return err
+		}
+		return tx.AddLocation(l)
+	})
+	return l, mapError(err)
+}
+
+// CurrentLocation returns where the parcel was last scanned.
+func (s ParcelService) CurrentLocation(number int) (Location, error) {
+	l, err := s.store.GetCurrentLocation(number)
+	return l, mapError(err)
+}
+
+// Locations returns the movement trail of the parcel, oldest first.
+func (s ParcelService) Locations(number int) ([]Location, error) {
+	trail, err := s.store.GetLocations(number)
+	return trail, mapError(err)
+}
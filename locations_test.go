@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLocations verifies recording scans and reading the trail and the
+// current location.
+func TestLocations(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	parcel, err := service.Register(1000, "test")
+	require.NoError(t, err)
+
+	_, err = service.AddWarehouse(Warehouse{Code: " ", Name: "Central"})
+	require.ErrorIs(t, err, ErrInvalidWarehouse)
+	warehouse, err := service.AddWarehouse(Warehouse{Code: "MSK-1", Name: "Central", Address: "Depot st. 1"})
+	require.NoError(t, err)
+	_, err = service.AddWarehouse(Warehouse{Code: "MSK-1", Name: "Other"})
+	require.ErrorIs(t, err, ErrInvalidWarehouse)
+
+	_, err = service.CurrentLocation(parcel.Number)
+	require.ErrorIs(t, err, ErrLocationUnknown)
+
+	// record
+	_, err = service.RecordLocation(parcel.Number, warehouse.ID, "gate 4")
+	require.NoError(t, err)
+	_, err = service.RecordLocation(parcel.Number, 0, " van of courier-1 ")
+	require.NoError(t, err)
+
+	_, err = service.RecordLocation(parcel.Number, 0, " ")
+	require.ErrorIs(t, err, ErrInvalidLocation)
+	_, err = service.RecordLocation(parcel.Number, warehouse.ID+100, "")
+	require.ErrorIs(t, err, ErrWarehouseNotFound)
+	_, err = service.RecordLocation(parcel.Number+100, warehouse.ID, "")
+	require.ErrorIs(t, err, ErrParcelNotFound)
+
+	// check
+	current, err := service.CurrentLocation(parcel.Number)
+	require.NoError(t, err)
+	assert.Zero(t, current.Warehouse)
+	assert.Equal(t, "van of courier-1", current.Description)
+
+	trail, err := service.Locations(parcel.Number)
+	require.NoError(t, err)
+	require.Len(t, trail, 2)
+	assert.Equal(t, warehouse.ID, trail[0].Warehouse)
+	assert.Equal(t, "gate 4", trail[0].Description)
+	assert.NotEmpty(t, trail[0].ScannedAt)
+
+	require.NoError(t, service.Delete(parcel.Number))
+	trail, err = service.Locations(parcel.Number)
+	require.NoError(t, err)
+	assert.Empty(t, trail)
+}
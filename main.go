@@ -1,9 +1,8 @@
 package main
 
 import (
-	"database/sql"
 	"fmt"
-	"time"
+	"os"
 
 	_ "modernc.org/sqlite"
 )
@@ -11,7 +10,10 @@ import (
 const (
 	ParcelStatusRegistered = "registered"
 	ParcelStatusSent       = "sent"
-	ParcelStatusDelivered  = "delivered"
+	// ParcelStatusCustomsCleared follows sent for international parcels
+	// only; see Parcel.International.
+	ParcelStatusCustomsCleared = "customs_cleared"
+	ParcelStatusDelivered      = "delivered"
 
 	driver   = "sqlite"
 	database = "tracker.db"
@@ -23,92 +25,140 @@ type Parcel struct {
 	Status    string
 	Address   string
 	CreatedAt string
+	// DueAt is the RFC 3339 delivery deadline; empty if the parcel has none.
+	DueAt string
+	// SentAt and DeliveredAt are when the parcel was first sent and
+	// delivered, set by the transitions; empty until then.
+	SentAt      string
+	DeliveredAt string
+	// EstimatedDeliveryAt is when the parcel is expected to be delivered,
+	// set at registration and moved when it is late; empty if there is no
+	// estimate. See ETAPolicy.
+	EstimatedDeliveryAt string
+	// Delays counts the estimates the parcel missed; it is delayed while
+	// it has missed any and is not delivered. See DetectDelays.
+	Delays int
+	// Attributes holds deployment-specific fields; see AttrDef.
+	Attributes Attributes
+	// TrackingCode is the customer-facing identifier, e.g. "PKG-2024-000123-7".
+	TrackingCode string
+	// WeightGrams is the gross weight; 0 if the parcel has not been weighed.
+	WeightGrams int
+	// Dimensions is the outer size; zero if the parcel has not been measured.
+	Dimensions Dimensions
+	// DeclaredValue is the insured value in minor units of Currency; 0 if
+	// none was declared.
+	DeclaredValue int
+	// Zone and Price record the tariff applied at registration; Price is in
+	// minor units of Currency and both are empty if the parcel was
+	// registered without pricing.
+	Zone  string
+	Price int
+	// Currency is the ISO 4217 code of DeclaredValue and Price,
+	// DefaultCurrency if empty on Add.
+	Currency string
+	// Payment is the payment status, PaymentUnpaid if empty on Add.
+	Payment string
+	// CashOnDelivery parcels may be sent unpaid and are paid on delivery.
+	CashOnDelivery bool
+	// IdempotencyKey, if set, makes Add of the same client and key return
+	// the parcel added first instead of a duplicate.
+	IdempotencyKey string
+	// DuplicateOf is the number of the parcel this one is suspected to
+	// duplicate, 0 if none; see DuplicatePolicy.
+	DuplicateOf int
+	// Coordinates of the address, nil if unknown; see WithGeocoder.
+	Coordinates *Coordinates
+	// PickupPoint is the id of the pickup point the parcel is delivered
+	// to, 0 for delivery to Address; see PickupPoint.
+	PickupPoint int
+	// Recipient is who the parcel is delivered to, as opposed to Client,
+	// who pays for it; zero if not given.
+	Recipient Recipient
+	// ServiceClass is one of the Service constants, ServiceStandard if
+	// empty on Add.
+	ServiceClass string
+	// Contents are the categories of dangerous or restricted goods the
+	// parcel holds, sorted; empty for general goods. See ContentRule.
+	Contents []string
+	// Repacked is set once the parcel was split into pieces or merged into
+	// another parcel; it then no longer moves through the lifecycle. See
+	// ParcelService.Split and Merge.
+	Repacked bool
+	// International parcels cross a border to Country, an ISO 3166-1
+	// alpha-2 code, and clear customs between sent and delivered.
+	International bool
+	Country       string
+	// CustomsReference and HSCodes are the customs declaration of an
+	// international parcel, required before it clears customs; HSCodes are
+	// Harmonized System codes of its goods, digits only.
+	CustomsReference string
+	HSCodes          []string
+	// DeliveryWindow is when the recipient prefers the parcel delivered;
+	// zero if any time will do. See ParcelService.Reschedule.
+	DeliveryWindow DeliveryWindow
+	// Hold pauses the parcel in its status; zero if it is not on hold. See
+	// ParcelService.Hold.
+	Hold Hold
+	// ClientRef numbers the parcels of Client consecutively from 1, in the
+	// order they were added; numbers of deleted parcels are not reused.
+	ClientRef int
+	// PublicID is the ULID the API addresses the parcel by (see
+	// NewPublicID); unlike Number, it cannot be guessed.
+	PublicID string
 }
 
-type ParcelService struct {
-	store ParcelStore
-}
-
-func NewParcelService(store ParcelStore) ParcelService {
-	return ParcelService{store: store}
-}
-
-func (s ParcelService) Register(client int, address string) (Parcel, error) {
-	parcel := Parcel{
-		Client:    client,
-		Status:    ParcelStatusRegistered,
-		Address:   address,
-		CreatedAt: time.Now().UTC().Format(time.RFC3339),
-	}
-
-	id, err := s.store.Add(parcel)
-	if err != nil {
-		return parcel, err
+// printLang is the language of the messages printed on standard output.
+const printLang = "ru"
+
+// eventPrinter returns an event handler reporting parcel changes on
+// standard output, with statuses labelled by labels.
+func eventPrinter(labels Labels) func(Event) {
+	return func(e Event) {
+		switch e.Type {
+		case EventParcelRegistered:
+			fmt.Printf("Новая посылка № %d на адрес %s от клиента с идентификатором %d зарегистрирована %s\n",
+				e.Parcel.Number, e.Parcel.Address, e.Parcel.Client, e.Parcel.CreatedAt)
+		case EventStatusChanged:
+			fmt.Printf("У посылки № %d новый статус: %s\n", e.Parcel.Number, labels.Name(e.Parcel.Status))
+		}
 	}
-
-	parcel.Number = id
-
-	fmt.Printf("Новая посылка № %d на адрес %s от клиента с идентификатором %d зарегистрирована %s\n",
-		parcel.Number, parcel.Address, parcel.Client, parcel.CreatedAt)
-
-	return parcel, nil
 }
 
-func (s ParcelService) PrintClientParcels(client int) error {
-	parcels, err := s.store.GetByClient(client)
-	if err != nil {
-		return err
-	}
-
-	fmt.Printf("Посылки клиента %d:\n", client)
-	for _, parcel := range parcels {
-		fmt.Printf("Посылка № %d на адрес %s от клиента с идентификатором %d зарегистрирована %s, статус %s\n",
-			parcel.Number, parcel.Address, parcel.Client, parcel.CreatedAt, parcel.Status)
+func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
 	}
-	fmt.Println()
-
-	return nil
+	runDemo()
 }
 
-func (s ParcelService) NextStatus(number int) error {
-	parcel, err := s.store.Get(number)
+// runDemo walks a parcel through its lifecycle against the configured
+// database, tracker.db by default.
+func runDemo() {
+	// подключение к БД
+	cfg, err := LoadConfig(os.Getenv(ConfigEnv), os.LookupEnv)
 	if err != nil {
-		return err
+		fmt.Println(err)
+		return
 	}
-
-	var nextStatus string
-	switch parcel.Status {
-	case ParcelStatusRegistered:
-		nextStatus = ParcelStatusSent
-	case ParcelStatusSent:
-		nextStatus = ParcelStatusDelivered
-	case ParcelStatusDelivered:
-		return nil
+	store, err := cfg.Database.Open()
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
-
-	fmt.Printf("У посылки № %d новый статус: %s\n", number, nextStatus)
-
-	return s.store.SetStatus(number, nextStatus)
-}
-
-func (s ParcelService) ChangeAddress(number int, address string) error {
-	return s.store.SetAddress(number, address)
-}
-
-func (s ParcelService) Delete(number int) error {
-	return s.store.Delete(number)
-}
-
-func main() {
-	// подключение к БД
-	db, err := sql.Open(driver, database)
+	defer store.Close()
+	labels, err := store.GetLabels(printLang)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	defer db.Close()
-	store := NewParcelStore(db)
-	service := NewParcelService(store)
+	events := NewEventBus()
+	events.Subscribe(eventPrinter(labels))
+	service := NewParcelService(store, events).WithSLA(cfg.SLA.SLAPolicy())
 
 	// регистрация посылки
 	client := 1
@@ -127,6 +177,13 @@ func main() {
 		return
 	}
 
+	// оплата посылки
+	err = service.SetPaymentStatus(p.Number, PaymentPaid)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
 	// изменение статуса
 	err = service.NextStatus(p.Number)
 	if err != nil {
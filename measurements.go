@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidParcel indicates that a parcel field holds a value outside
+// its accepted range.
+var ErrInvalidParcel = newError(CodeInvalidParcel, "invalid parcel")
+
+// ErrInvalidFilter indicates that a ParcelFilter cannot be turned into
+// a query.
+var ErrInvalidFilter = newError(CodeInvalidFilter, "invalid parcel filter")
+
+// Dimensions is the outer size of a parcel in millimetres. It is stored
+// in the "dimensions" column as "LxWxH", e.g. "300x200x150".
+type Dimensions struct {
+	LengthMM int
+	WidthMM  int
+	HeightMM int
+}
+
+// IsZero reports whether the parcel has not been measured.
+func (d Dimensions) IsZero() bool {
+	return d == Dimensions{}
+}
+
+// VolumeCM3 returns the volume in cubic centimetres, rounded up.
+func (d Dimensions) VolumeCM3() int {
+	mm3 := d.LengthMM * d.WidthMM * d.HeightMM
+	return (mm3 + 999) / 1000
+}
+
+// String returns the "LxWxH" form, or "" for zero dimensions.
+func (d Dimensions) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%dx%dx%d", d.LengthMM, d.WidthMM, d.HeightMM)
+}
+
+// ParseDimensions parses the "LxWxH" form produced by Dimensions.String.
+// An empty string yields zero dimensions.
+func ParseDimensions(s string) (Dimensions, error) {
+	if s == "" {
+		return Dimensions{}, nil
+	}
+
+	parts := strings.Split(s, "x")
+	if len(parts) != 3 {
+		return Dimensions{}, fmt.Errorf("%w: dimensions %q are not LxWxH", ErrInvalidParcel, s)
+	}
+	var sides [3]int
+	for i, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil || v <= 0 {
+			return Dimensions{}, fmt.Errorf("%w: dimensions %q are not LxWxH", ErrInvalidParcel, s)
+		}
+		sides[i] = v
+	}
+	return Dimensions{LengthMM: sides[0], WidthMM: sides[1], HeightMM: sides[2]}, nil
+}
+
+// Sort orders accepted by ParcelFilter.SortBy.
+const (
+	SortByCreatedAt     = "created_at"
+	SortByWeight        = "weight_grams"
+	SortByDeclaredValue = "declared_value"
+)
+
+// ParcelFilter selects parcels for Find. Zero fields do not constrain
+// the result, so ParcelFilter{} matches every parcel.
+type ParcelFilter struct {
+	Client       int
+	Status       string
+	ServiceClass string
+
+	// MinWeight and MaxWeight bound WeightGrams, inclusive.
+	MinWeight int
+	MaxWeight int
+	// MinDeclaredValue and MaxDeclaredValue bound DeclaredValue, inclusive.
+	MinDeclaredValue int
+	MaxDeclaredValue int
+	// SuspectedDuplicates selects only parcels with DuplicateOf set.
+	SuspectedDuplicates bool
+	// RecipientPhone selects parcels for the recipient with this phone, in
+	// any form NormalisePhone accepts.
+	RecipientPhone string
+
+	// SortBy is one of the SortBy constants; empty means SortByCreatedAt.
+	SortBy string
+	// Desc reverses the order.
+	Desc bool
+}
+
+// apply adds the conditions of the filter to q.
+func (f ParcelFilter) apply(q selectQuery) selectQuery {
+	if f.Client != 0 {
+		q = q.Where("client = ?", f.Client)
+	}
+	if f.Status != "" {
+		q = q.Where("status = ?", f.Status)
+	}
+	if f.ServiceClass != "" {
+		q = q.Where("service_class = ?", f.ServiceClass)
+	}
+	if f.MinWeight != 0 {
+		q = q.Where("weight_grams >= ?", f.MinWeight)
+	}
+	if f.MaxWeight != 0 {
+		q = q.Where("weight_grams <= ?", f.MaxWeight)
+	}
+	if f.MinDeclaredValue != 0 {
+		q = q.Where("declared_value >= ?", f.MinDeclaredValue)
+	}
+	if f.MaxDeclaredValue != 0 {
+		q = q.Where("declared_value <= ?", f.MaxDeclaredValue)
+	}
+
+	if f.SuspectedDuplicates {
+		q = q.Where("duplicate_of != 0")
+	}
+	if f.RecipientPhone != "" {
+		q = q.Where("recipient_phone = ?", f.RecipientPhone)
+	}
+	return q
+}
+
+// Find returns the parcels matching f in the requested order; parcels
+// that compare equal stay in registration order.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrNewStatusUnrecognised (wrapped) for an unknown status and
+//     ErrServiceClassUnrecognised (wrapped) for an unknown service class.
+//   - Returns ErrInvalidFilter (wrapped) for an unknown sort order or a
+//     minimum above the corresponding maximum, or a recipient phone that
+//     is not a valid number.
+//   - Returns an empty slice if nothing matches.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) Find(f ParcelFilter) ([]Parcel, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	if f.Status != "" && !knownStatus(f.Status) {
+		return nil, fmt.Errorf("failed to find parcels: %w %q", ErrNewStatusUnrecognised, f.Status)
+	}
+	if f.ServiceClass != "" && !knownServiceClass(f.ServiceClass) {
+		return nil, fmt.Errorf("failed to find parcels: %w %q", ErrServiceClassUnrecognised, f.ServiceClass)
+	}
+	if f.MaxWeight != 0 && f.MinWeight > f.MaxWeight {
+		return nil, fmt.Errorf("failed to find parcels: %w: weight range %d..%d", ErrInvalidFilter, f.MinWeight, f.MaxWeight)
+	}
+	if f.MaxDeclaredValue != 0 && f.MinDeclaredValue > f.MaxDeclaredValue {
+		return nil, fmt.Errorf("failed to find parcels: %w: declared value range %d..%d", ErrInvalidFilter,
+			f.MinDeclaredValue, f.MaxDeclaredValue)
+	}
+
+	if f.RecipientPhone != "" {
+		phone, err := NormalisePhone(f.RecipientPhone)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find parcels: %w: %w", ErrInvalidFilter, err)
+		}
+		// phones are encrypted deterministically; see WithFieldEncryption
+		if f.RecipientPhone, err = s.sealPhone(phone); err != nil {
+			return nil, fmt.Errorf("failed to find parcels: %w", err)
+		}
+	}
+
+	// the sort column is checked against a fixed list, it cannot be a parameter
+	sortBy := f.SortBy
+	switch sortBy {
+	case "":
+		sortBy = SortByCreatedAt
+	case SortByCreatedAt, SortByWeight, SortByDeclaredValue:
+	default:
+		return nil, fmt.Errorf("failed to find parcels: %w: sort by %q", ErrInvalidFilter, f.SortBy)
+	}
+	// creation times may differ in precision; see FormatTimestamp
+	order := []string{sortBy}
+	if sortBy == SortByCreatedAt {
+		order[0] = "julianday(created_at)"
+	}
+	if f.Desc {
+		order[0] += " DESC"
+	}
+	if sortBy != SortByCreatedAt {
+		order = append(order, "julianday(created_at)")
+	}
+
+	query, args := f.apply(selectFrom("parcel", parcelColumns)).OrderBy(append(order, "seq")...).build()
+	return s.queryParcels("filter", query, args...)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAddWithMeasurements verifies that weight, dimensions and declared
+// value are stored and read back.
+func TestAddWithMeasurements(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store, parcel := NewParcelStore(db), getTestParcel()
+	parcel.WeightGrams = 1250
+	parcel.Dimensions = Dimensions{LengthMM: 300, WidthMM: 200, HeightMM: 150}
+	parcel.DeclaredValue = 500000
+
+	// add
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	// check
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, 1250, stored.WeightGrams)
+	assert.Equal(t, parcel.Dimensions, stored.Dimensions)
+	assert.Equal(t, 500000, stored.DeclaredValue)
+	assert.Equal(t, 9000, stored.Dimensions.VolumeCM3())
+}
+
+// TestAddWhenInvalidMeasurements ensures that out-of-range measurements
+// are rejected before reaching the database.
+func TestAddWhenInvalidMeasurements(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	invalid := []func(p *Parcel){
+		func(p *Parcel) { p.WeightGrams = -1 },
+		func(p *Parcel) { p.DeclaredValue = -100 },
+		func(p *Parcel) { p.Dimensions = Dimensions{LengthMM: 100} },
+	}
+
+	// add
+	for _, modify := range invalid {
+		parcel := getTestParcel()
+		modify(&parcel)
+		_, err := store.Add(parcel)
+		require.ErrorIs(t, err, ErrInvalidParcel)
+	}
+}
+
+// TestParseDimensions verifies the round trip of the stored dimensions
+// format and rejection of malformed values.
+func TestParseDimensions(t *testing.T) {
+	d := Dimensions{LengthMM: 300, WidthMM: 200, HeightMM: 15}
+	parsed, err := ParseDimensions(d.String())
+	require.NoError(t, err)
+	assert.Equal(t, d, parsed)
+
+	parsed, err = ParseDimensions("")
+	require.NoError(t, err)
+	assert.True(t, parsed.IsZero())
+
+	for _, s := range []string{"300x200", "300x200x0", "axbxc", "300X200X15"} {
+		_, err := ParseDimensions(s)
+		assert.ErrorIs(t, err, ErrInvalidParcel, s)
+	}
+}
+
+// TestFind verifies filtering and sorting by weight and declared value.
+func TestFind(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	weights := []int{500, 3000, 1500, 0}
+	values := []int{100, 0, 300, 200}
+	ids := make([]int, len(weights))
+	for i := range weights {
+		parcel := getTestParcel()
+		parcel.WeightGrams, parcel.DeclaredValue = weights[i], values[i]
+		if i == 3 {
+			parcel.Client = 2000
+		}
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		ids[i] = id
+	}
+
+	numbers := func(parcels []Parcel) []int {
+		var res []int
+		for _, p := range parcels {
+			res = append(res, p.Number)
+		}
+		return res
+	}
+
+	// check
+	parcels, err := store.Find(ParcelFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, ids, numbers(parcels))
+
+	parcels, err = store.Find(ParcelFilter{MinWeight: 1000, SortBy: SortByWeight, Desc: true})
+	require.NoError(t, err)
+	assert.Equal(t, []int{ids[1], ids[2]}, numbers(parcels))
+
+	parcels, err = store.Find(ParcelFilter{Client: 1000, MaxDeclaredValue: 200, SortBy: SortByDeclaredValue})
+	require.NoError(t, err)
+	assert.Equal(t, []int{ids[1], ids[0]}, numbers(parcels))
+
+	_, err = store.Find(ParcelFilter{SortBy: "address"})
+	require.ErrorIs(t, err, ErrInvalidFilter)
+	_, err = store.Find(ParcelFilter{MinWeight: 10, MaxWeight: 5})
+	require.ErrorIs(t, err, ErrInvalidFilter)
+	_, err = store.Find(ParcelFilter{Status: "lost"})
+	require.ErrorIs(t, err, ErrNewStatusUnrecognised)
+}
@@ -0,0 +1,739 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"fmt"
+)
+
+// baseSchema creates the base "parcel" table the migrations build on.
+//
+//go:embed schema.sql
+var baseSchema string
+
+// migrations lists the schema changes applied on top of the base
+// "parcel" table of schema.sql, in order. The index of a migration plus
+// one is the schema version it produces, recorded in PRAGMA user_version.
+//
+// Migrations are append-only: never edit or reorder an entry that has
+// already shipped, add a new one instead.
+var migrations = []string{
+	// 1: status presentation metadata
+	`CREATE TABLE status_label (
+    status VARCHAR(128) NOT NULL,
+    lang VARCHAR(16) NOT NULL,
+    display_name VARCHAR(128) NOT NULL,
+    color VARCHAR(16) NOT NULL DEFAULT '',
+    description VARCHAR(512) NOT NULL DEFAULT '',
+    PRIMARY KEY (status, lang)
+);
+INSERT INTO status_label (status, lang, display_name, color, description) VALUES
+    ('registered', 'en', 'Registered', '#9e9e9e', 'The parcel has been registered and awaits dispatch.'),
+    ('sent', 'en', 'Sent', '#1e88e5', 'The parcel is on its way.'),
+    ('delivered', 'en', 'Delivered', '#43a047', 'The parcel has been delivered.'),
+    ('registered', 'ru', 'Зарегистрирована', '#9e9e9e', 'Посылка зарегистрирована и ожидает отправки.'),
+    ('sent', 'ru', 'Отправлена', '#1e88e5', 'Посылка в пути.'),
+    ('delivered', 'ru', 'Доставлена', '#43a047', 'Посылка доставлена.');`,
+
+	// 2: audit trail for bulk address corrections
+	`CREATE TABLE address_correction (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    parcel_number INTEGER NOT NULL,
+    old_address VARCHAR(512) NOT NULL,
+    new_address VARCHAR(512) NOT NULL,
+    corrected_at VARCHAR(64) NOT NULL
+);
+CREATE INDEX address_correction_parcel_number ON address_correction(parcel_number);`,
+
+	// 3: parcel status history
+	`CREATE TABLE parcel_status_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    parcel_number INTEGER NOT NULL,
+    status VARCHAR(128) NOT NULL,
+    changed_at VARCHAR(64) NOT NULL,
+    note VARCHAR(512) NOT NULL DEFAULT ''
+);
+CREATE INDEX parcel_status_history_parcel_number ON parcel_status_history(parcel_number);`,
+
+	// 4: delivery deadlines
+	`ALTER TABLE parcel ADD COLUMN due_at VARCHAR(64) NOT NULL DEFAULT '';
+CREATE INDEX parcel_due_at ON parcel(due_at);`,
+
+	// 5: status lookups
+	`CREATE INDEX parcel_status ON parcel(status);`,
+
+	// 6: monotonic creation sequence, the tie-breaker for equal created_at
+	`ALTER TABLE parcel ADD COLUMN seq INTEGER NOT NULL DEFAULT 0;
+UPDATE parcel SET seq = number;
+CREATE UNIQUE INDEX parcel_seq ON parcel(seq);
+CREATE INDEX parcel_created_at_seq ON parcel(created_at, seq);`,
+
+	// 7: archive of delivered parcels, stored as JSON so that it does not
+	// need to follow every change of the parcel table
+	`CREATE TABLE parcel_archive (
+    number INTEGER PRIMARY KEY,
+    client INTEGER NOT NULL,
+    data TEXT NOT NULL,
+    archived_at VARCHAR(64) NOT NULL
+);
+CREATE INDEX parcel_archive_client ON parcel_archive(client);`,
+
+	// 8: extensible parcel attributes
+	`ALTER TABLE parcel ADD COLUMN attributes TEXT NOT NULL DEFAULT '{}';`,
+
+	// 9: customer-facing tracking codes, backfilled by backfillTrackingCodes
+	`ALTER TABLE parcel ADD COLUMN tracking_code VARCHAR(32) NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX parcel_tracking_code ON parcel(tracking_code) WHERE tracking_code != '';`,
+
+	// 10: physical measurements and declared value for pricing and capacity planning
+	`ALTER TABLE parcel ADD COLUMN weight_grams INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE parcel ADD COLUMN dimensions VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE parcel ADD COLUMN declared_value INTEGER NOT NULL DEFAULT 0;`,
+
+	// 11: tariffs by zone and weight band, and the price charged per parcel
+	`CREATE TABLE tariff (
+    zone VARCHAR(64) NOT NULL,
+    max_weight_grams INTEGER NOT NULL,
+    price INTEGER NOT NULL,
+    PRIMARY KEY (zone, max_weight_grams)
+);
+ALTER TABLE parcel ADD COLUMN zone VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE parcel ADD COLUMN price INTEGER NOT NULL DEFAULT 0;`,
+
+	// 12: payment sub-state and cash on delivery
+	`ALTER TABLE parcel ADD COLUMN payment_status VARCHAR(16) NOT NULL DEFAULT 'unpaid';
+ALTER TABLE parcel ADD COLUMN cash_on_delivery INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX parcel_payment_status ON parcel(payment_status, created_at);`,
+
+	// 13: API keys, stored as SHA-256 hashes
+	`CREATE TABLE api_key (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(128) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    role VARCHAR(16) NOT NULL,
+    client INTEGER NOT NULL DEFAULT 0,
+    created_at VARCHAR(64) NOT NULL,
+    revoked_at VARCHAR(64) NOT NULL DEFAULT ''
+);`,
+
+	// 14: client-supplied idempotency keys for retried registrations
+	`ALTER TABLE parcel ADD COLUMN idempotency_key VARCHAR(128) NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX parcel_idempotency_key ON parcel(client, idempotency_key) WHERE idempotency_key != '';`,
+
+	// 15: suspected duplicate registrations
+	`ALTER TABLE parcel ADD COLUMN duplicate_of INTEGER NOT NULL DEFAULT 0;`,
+
+	// 16: geocoded coordinates of the delivery address, NULL when unknown
+	`ALTER TABLE parcel ADD COLUMN latitude REAL;
+ALTER TABLE parcel ADD COLUMN longitude REAL;
+CREATE INDEX parcel_coordinates ON parcel(latitude, longitude) WHERE latitude IS NOT NULL;`,
+
+	// 17: courier delivery routes; a parcel is a stop of at most one route
+	`CREATE TABLE route (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    courier VARCHAR(128) NOT NULL,
+    day VARCHAR(10) NOT NULL,
+    created_at VARCHAR(64) NOT NULL,
+    UNIQUE (courier, day)
+);
+CREATE INDEX route_day ON route(day);
+CREATE TABLE route_stop (
+    route_id INTEGER NOT NULL,
+    parcel_number INTEGER NOT NULL UNIQUE,
+    position INTEGER NOT NULL,
+    completed_at VARCHAR(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (route_id, parcel_number)
+);`,
+
+	// 18: pickup points (parcel lockers) and parcels delivered to them
+	`CREATE TABLE pickup_point (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(128) NOT NULL,
+    address VARCHAR(512) NOT NULL,
+    capacity INTEGER NOT NULL
+);
+ALTER TABLE parcel ADD COLUMN pickup_point INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX parcel_pickup_point ON parcel(pickup_point, status) WHERE pickup_point != 0;`,
+
+	// 19: warehouses and the log of where each parcel was scanned
+	`CREATE TABLE warehouse (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code VARCHAR(32) NOT NULL UNIQUE,
+    name VARCHAR(128) NOT NULL,
+    address VARCHAR(512) NOT NULL DEFAULT ''
+);
+CREATE TABLE parcel_location (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    parcel_number INTEGER NOT NULL,
+    warehouse INTEGER NOT NULL DEFAULT 0,
+    description VARCHAR(512) NOT NULL DEFAULT '',
+    scanned_at VARCHAR(64) NOT NULL
+);
+CREATE INDEX parcel_location_parcel_number ON parcel_location(parcel_number, id);`,
+
+	// 20: raw scan events from handheld scanners
+	`CREATE TABLE scan_event (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    parcel_number INTEGER NOT NULL,
+    scan_type VARCHAR(32) NOT NULL,
+    warehouse INTEGER NOT NULL DEFAULT 0,
+    description VARCHAR(512) NOT NULL DEFAULT '',
+    scanned_at VARCHAR(64) NOT NULL,
+    recorded_at VARCHAR(64) NOT NULL
+);
+CREATE INDEX scan_event_parcel_number ON scan_event(parcel_number, id);`,
+
+	// 21: status change notifications: templates, client opt-ins and the outgoing queue
+	`CREATE TABLE notification_template (
+    status VARCHAR(128) NOT NULL,
+    channel VARCHAR(32) NOT NULL,
+    subject VARCHAR(512) NOT NULL DEFAULT '',
+    body TEXT NOT NULL,
+    PRIMARY KEY (status, channel)
+);
+CREATE TABLE notification_preference (
+    client INTEGER NOT NULL,
+    channel VARCHAR(32) NOT NULL,
+    recipient VARCHAR(256) NOT NULL DEFAULT '',
+    enabled INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (client, channel)
+);
+CREATE TABLE notification (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    parcel_number INTEGER NOT NULL,
+    channel VARCHAR(32) NOT NULL,
+    recipient VARCHAR(256) NOT NULL,
+    subject VARCHAR(512) NOT NULL DEFAULT '',
+    body TEXT NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at VARCHAR(64) NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at VARCHAR(64) NOT NULL,
+    sent_at VARCHAR(64) NOT NULL DEFAULT ''
+);
+CREATE INDEX notification_due ON notification(state, next_attempt_at);
+CREATE INDEX notification_parcel_number ON notification(parcel_number);`,
+
+	// 22: delivery analytics materialised by day and by week, and the delivery time histogram by day
+	`CREATE TABLE delivery_summary (
+    period VARCHAR(8) NOT NULL,
+    start VARCHAR(10) NOT NULL,
+    delivered INTEGER NOT NULL,
+    total_seconds REAL NOT NULL,
+    on_time INTEGER NOT NULL,
+    late INTEGER NOT NULL,
+    PRIMARY KEY (period, start)
+);
+CREATE TABLE delivery_histogram (
+    day VARCHAR(10) NOT NULL,
+    bucket INTEGER NOT NULL,
+    count INTEGER NOT NULL,
+    PRIMARY KEY (day, bucket)
+);
+CREATE INDEX parcel_status_history_status ON parcel_status_history(status, changed_at);`,
+
+	// 23: full-text index of addresses, kept in sync with the parcel table by triggers
+	`CREATE VIRTUAL TABLE parcel_address_fts USING fts5(
+    address, content = 'parcel', content_rowid = 'number', tokenize = 'unicode61 remove_diacritics 2'
+);
+INSERT INTO parcel_address_fts (parcel_address_fts) VALUES ('rebuild');
+CREATE TRIGGER parcel_address_fts_insert AFTER INSERT ON parcel BEGIN
+    INSERT INTO parcel_address_fts (rowid, address) VALUES (new.number, new.address);
+END;
+CREATE TRIGGER parcel_address_fts_delete AFTER DELETE ON parcel BEGIN
+    INSERT INTO parcel_address_fts (parcel_address_fts, rowid, address) VALUES ('delete', old.number, old.address);
+END;
+CREATE TRIGGER parcel_address_fts_update AFTER UPDATE OF address ON parcel BEGIN
+    INSERT INTO parcel_address_fts (parcel_address_fts, rowid, address) VALUES ('delete', old.number, old.address);
+    INSERT INTO parcel_address_fts (rowid, address) VALUES (new.number, new.address);
+END;`,
+
+	// 24: internal comments of support staff on parcels
+	`CREATE TABLE parcel_comments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    parcel_number INTEGER NOT NULL,
+    author VARCHAR(128) NOT NULL,
+    text TEXT NOT NULL,
+    created_at VARCHAR(64) NOT NULL
+);
+CREATE INDEX parcel_comments_parcel_number ON parcel_comments(parcel_number, id);`,
+
+	// 25: proof of delivery: an image kept in the database, or a reference to it
+	`CREATE TABLE delivery_proof (
+    parcel_number INTEGER PRIMARY KEY,
+    kind VARCHAR(16) NOT NULL,
+    content_type VARCHAR(64) NOT NULL DEFAULT '',
+    data BLOB,
+    reference VARCHAR(512) NOT NULL DEFAULT '',
+    recorded_at VARCHAR(64) NOT NULL
+);`,
+
+	// 26: recipient of the parcel, distinct from the paying client
+	`ALTER TABLE parcel ADD COLUMN recipient_name VARCHAR(200) NOT NULL DEFAULT '';
+ALTER TABLE parcel ADD COLUMN recipient_phone VARCHAR(16) NOT NULL DEFAULT '';
+CREATE INDEX parcel_recipient_phone ON parcel(recipient_phone) WHERE recipient_phone != '';`,
+
+	// 27: service class, which sets the deadline and the price
+	`ALTER TABLE parcel ADD COLUMN service_class VARCHAR(16) NOT NULL DEFAULT 'standard';`,
+
+	// 28: audit trail for statuses forced by administrators
+	`CREATE TABLE status_override (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    parcel_number INTEGER NOT NULL,
+    old_status VARCHAR(128) NOT NULL,
+    new_status VARCHAR(128) NOT NULL,
+    reason TEXT NOT NULL,
+    actor VARCHAR(200) NOT NULL,
+    overridden_at VARCHAR(64) NOT NULL
+);
+CREATE INDEX status_override_parcel_number ON status_override(parcel_number, id);`,
+
+	// 29: audit trail for addresses changed after dispatch
+	`CREATE TABLE address_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    parcel_number INTEGER NOT NULL,
+    status VARCHAR(128) NOT NULL,
+    old_address VARCHAR(512) NOT NULL,
+    new_address VARCHAR(512) NOT NULL,
+    changed_at VARCHAR(64) NOT NULL
+);
+CREATE INDEX address_changes_parcel_number ON address_changes(parcel_number, id);`,
+
+	// 30: every address of every parcel, starting from the current ones
+	`CREATE TABLE parcel_address_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    parcel_number INTEGER NOT NULL,
+    address VARCHAR(512) NOT NULL,
+    status VARCHAR(128) NOT NULL,
+    set_at VARCHAR(64) NOT NULL
+);
+CREATE INDEX parcel_address_history_parcel_number ON parcel_address_history(parcel_number, id);
+INSERT INTO parcel_address_history (parcel_number, address, status, set_at)
+SELECT number, address, status, created_at FROM parcel ORDER BY number;`,
+
+	// 31: parcels split or merged at the warehouse
+	`ALTER TABLE parcel ADD COLUMN repacked INTEGER NOT NULL DEFAULT 0;
+CREATE TABLE parcel_link (
+    parent_number INTEGER NOT NULL,
+    child_number INTEGER NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    created_at VARCHAR(64) NOT NULL,
+    PRIMARY KEY (parent_number, child_number)
+);
+CREATE INDEX parcel_link_child_number ON parcel_link(child_number);`,
+
+	// 32: orders grouping several parcels of one client
+	`CREATE TABLE parcel_order (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    client INTEGER NOT NULL,
+    created_at VARCHAR(64) NOT NULL
+);
+CREATE INDEX parcel_order_client ON parcel_order(client);
+CREATE TABLE parcel_order_item (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id INTEGER NOT NULL,
+    parcel_number INTEGER NOT NULL UNIQUE
+);
+CREATE INDEX parcel_order_item_order_id ON parcel_order_item(order_id, id);`,
+
+	// 33: insurance claims against lost or damaged parcels
+	`CREATE TABLE parcel_claim (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    parcel_number INTEGER NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    description TEXT NOT NULL,
+    amount INTEGER NOT NULL,
+    payout INTEGER NOT NULL DEFAULT 0,
+    status VARCHAR(16) NOT NULL,
+    resolution TEXT NOT NULL DEFAULT '',
+    filed_at VARCHAR(64) NOT NULL,
+    resolved_at VARCHAR(64) NOT NULL DEFAULT ''
+);
+CREATE INDEX parcel_claim_parcel_number ON parcel_claim(parcel_number, id);
+CREATE INDEX parcel_claim_status ON parcel_claim(status, id);`,
+
+	// 34: content categories of parcels and the destinations they may not go to
+	`ALTER TABLE parcel ADD COLUMN contents VARCHAR(256) NOT NULL DEFAULT '';
+CREATE TABLE content_restriction (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    category VARCHAR(32) NOT NULL,
+    zone VARCHAR(64) NOT NULL,
+    created_at VARCHAR(64) NOT NULL,
+    UNIQUE (category, zone)
+);`,
+
+	// 35: international parcels, their customs declarations and clearance
+	`ALTER TABLE parcel ADD COLUMN international INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE parcel ADD COLUMN country VARCHAR(2) NOT NULL DEFAULT '';
+ALTER TABLE parcel ADD COLUMN customs_reference VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE parcel ADD COLUMN hs_codes VARCHAR(256) NOT NULL DEFAULT '';
+INSERT INTO status_label (status, lang, display_name, color, description) VALUES
+    ('customs_cleared', 'en', 'Customs cleared', '#8e24aa', 'The parcel has cleared customs and awaits delivery.'),
+    ('customs_cleared', 'ru', 'Прошла таможню', '#8e24aa', 'Посылка прошла таможенное оформление и ожидает доставки.');`,
+	// 36: tombstones of clients whose data was erased on request
+	`CREATE TABLE client_erasure (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    client INTEGER NOT NULL,
+    deleted INTEGER NOT NULL,
+    anonymised INTEGER NOT NULL,
+    retention VARCHAR(32) NOT NULL,
+    erased_at VARCHAR(64) NOT NULL
+);
+CREATE INDEX client_erasure_client ON client_erasure(client, id);`,
+
+	// 37: scans synced from courier devices, applied once per device event
+	`ALTER TABLE scan_event ADD COLUMN device VARCHAR(128) NOT NULL DEFAULT '';
+ALTER TABLE scan_event ADD COLUMN device_event_id VARCHAR(128) NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX scan_event_device_event ON scan_event(device, device_event_id) WHERE device_event_id != '';`,
+
+	// 38: delivery confirmation codes, hashed, with their attempts and overrides
+	`CREATE TABLE delivery_code (
+    parcel_number INTEGER PRIMARY KEY,
+    code_hash VARCHAR(64) NOT NULL,
+    salt VARCHAR(32) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    issued_at VARCHAR(64) NOT NULL,
+    confirmed_at VARCHAR(64) NOT NULL DEFAULT '',
+    override_reason VARCHAR(512) NOT NULL DEFAULT '',
+    override_actor VARCHAR(128) NOT NULL DEFAULT ''
+);`,
+
+	// 39: delivery windows chosen by recipients
+	`ALTER TABLE parcel ADD COLUMN delivery_day VARCHAR(10) NOT NULL DEFAULT '';
+ALTER TABLE parcel ADD COLUMN delivery_from VARCHAR(5) NOT NULL DEFAULT '';
+ALTER TABLE parcel ADD COLUMN delivery_to VARCHAR(5) NOT NULL DEFAULT '';
+CREATE INDEX parcel_delivery_day ON parcel(delivery_day, delivery_from, delivery_to);`,
+
+	// 40: holds pausing parcels independently of their status
+	`ALTER TABLE parcel ADD COLUMN hold_kind VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE parcel ADD COLUMN hold_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE parcel ADD COLUMN hold_actor TEXT NOT NULL DEFAULT '';
+ALTER TABLE parcel ADD COLUMN held_at VARCHAR(64) NOT NULL DEFAULT '';`,
+
+	// 41: consecutive reference numbers per client, existing parcels
+	// numbered in the order they were added
+	`CREATE TABLE client_sequence (
+    client INTEGER PRIMARY KEY,
+    last_ref INTEGER NOT NULL
+);
+ALTER TABLE parcel ADD COLUMN client_ref INTEGER NOT NULL DEFAULT 0;
+UPDATE parcel SET client_ref = (SELECT COUNT(*) FROM parcel p WHERE p.client = parcel.client AND p.seq <= parcel.seq);
+INSERT INTO client_sequence (client, last_ref) SELECT client, MAX(client_ref) FROM parcel GROUP BY client;
+CREATE UNIQUE INDEX parcel_client_ref ON parcel(client, client_ref) WHERE client_ref > 0;`,
+
+	// 42: public IDs, backfilled by backfillPublicIDs
+	`ALTER TABLE parcel ADD COLUMN public_id VARCHAR(26) NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX parcel_public_id ON parcel(public_id) WHERE public_id != '';`,
+
+	// 43: change feed of parcels, written by triggers in the transaction of
+	// the change; see GetChangesSince
+	`CREATE TABLE parcel_change (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    parcel_number INTEGER NOT NULL,
+    op VARCHAR(16) NOT NULL,
+    changed_at VARCHAR(64) NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+);
+CREATE TRIGGER parcel_change_insert AFTER INSERT ON parcel BEGIN
+    INSERT INTO parcel_change (parcel_number, op) VALUES (new.number, 'create');
+END;
+-- Add sets the tracking code right after the insert, as part of the create
+CREATE TRIGGER parcel_change_update AFTER UPDATE ON parcel WHEN old.tracking_code != '' BEGIN
+    INSERT INTO parcel_change (parcel_number, op) VALUES (new.number, 'update');
+END;
+CREATE TRIGGER parcel_change_delete AFTER DELETE ON parcel BEGIN
+    INSERT INTO parcel_change (parcel_number, op) VALUES (old.number, 'delete');
+END;
+INSERT INTO parcel_change (parcel_number, op, changed_at) SELECT number, 'create', created_at FROM parcel ORDER BY seq;`,
+
+	// 44: parcels per client, registration day and status, kept in sync with
+	// the parcel table by triggers; see GetParcelSummary
+	`CREATE TABLE parcel_summary (
+    client INTEGER NOT NULL,
+    day VARCHAR(10) NOT NULL,
+    status VARCHAR(128) NOT NULL,
+    count INTEGER NOT NULL,
+    PRIMARY KEY (client, day, status)
+);
+CREATE INDEX parcel_summary_day ON parcel_summary(day);
+INSERT INTO parcel_summary (client, day, status, count)
+SELECT client, substr(created_at, 1, 10), status, COUNT(*) FROM parcel GROUP BY 1, 2, 3;
+CREATE TRIGGER parcel_summary_insert AFTER INSERT ON parcel BEGIN
+    INSERT INTO parcel_summary (client, day, status, count) VALUES (new.client, substr(new.created_at, 1, 10), new.status, 1)
+        ON CONFLICT (client, day, status) DO UPDATE SET count = count + 1;
+END;
+CREATE TRIGGER parcel_summary_delete AFTER DELETE ON parcel BEGIN
+    UPDATE parcel_summary SET count = count - 1
+        WHERE client = old.client AND day = substr(old.created_at, 1, 10) AND status = old.status;
+    DELETE FROM parcel_summary
+        WHERE client = old.client AND day = substr(old.created_at, 1, 10) AND status = old.status AND count <= 0;
+END;
+CREATE TRIGGER parcel_summary_update AFTER UPDATE OF client, created_at, status ON parcel
+WHEN old.client != new.client OR old.status != new.status OR substr(old.created_at, 1, 10) != substr(new.created_at, 1, 10) BEGIN
+    UPDATE parcel_summary SET count = count - 1
+        WHERE client = old.client AND day = substr(old.created_at, 1, 10) AND status = old.status;
+    DELETE FROM parcel_summary
+        WHERE client = old.client AND day = substr(old.created_at, 1, 10) AND status = old.status AND count <= 0;
+    INSERT INTO parcel_summary (client, day, status, count) VALUES (new.client, substr(new.created_at, 1, 10), new.status, 1)
+        ON CONFLICT (client, day, status) DO UPDATE SET count = count + 1;
+END;`,
+
+	// 45: actors of changes; mutation_actor holds the actor of a writing
+	// transaction for the change feed triggers, see WithActor
+	`CREATE TABLE mutation_actor (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    actor VARCHAR(128) NOT NULL
+);
+ALTER TABLE parcel_status_history ADD COLUMN actor VARCHAR(128) NOT NULL DEFAULT '';
+ALTER TABLE parcel_address_history ADD COLUMN actor VARCHAR(128) NOT NULL DEFAULT '';
+ALTER TABLE parcel_change ADD COLUMN actor VARCHAR(128) NOT NULL DEFAULT '';
+DROP TRIGGER parcel_change_insert;
+DROP TRIGGER parcel_change_update;
+DROP TRIGGER parcel_change_delete;
+CREATE TRIGGER parcel_change_insert AFTER INSERT ON parcel BEGIN
+    INSERT INTO parcel_change (parcel_number, op, actor)
+    VALUES (new.number, 'create', COALESCE((SELECT actor FROM mutation_actor), ''));
+END;
+-- Add sets the tracking code right after the insert, as part of the create
+CREATE TRIGGER parcel_change_update AFTER UPDATE ON parcel WHEN old.tracking_code != '' BEGIN
+    INSERT INTO parcel_change (parcel_number, op, actor)
+    VALUES (new.number, 'update', COALESCE((SELECT actor FROM mutation_actor), ''));
+END;
+CREATE TRIGGER parcel_change_delete AFTER DELETE ON parcel BEGIN
+    INSERT INTO parcel_change (parcel_number, op, actor)
+    VALUES (old.number, 'delete', COALESCE((SELECT actor FROM mutation_actor), ''));
+END;`,
+
+	// 46: foreign keys of route stops and order items; SQLite cannot add
+	// them to a table, so both are rebuilt, without rows that already
+	// refer to nothing
+	`CREATE TABLE route_stop_new (
+    route_id INTEGER NOT NULL REFERENCES route(id) ON DELETE CASCADE,
+    parcel_number INTEGER NOT NULL UNIQUE REFERENCES parcel(number) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    completed_at VARCHAR(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (route_id, parcel_number)
+);
+INSERT INTO route_stop_new (route_id, parcel_number, position, completed_at)
+SELECT route_id, parcel_number, position, completed_at FROM route_stop
+WHERE route_id IN (SELECT id FROM route) AND parcel_number IN (SELECT number FROM parcel);
+DROP TABLE route_stop;
+ALTER TABLE route_stop_new RENAME TO route_stop;
+CREATE TABLE parcel_order_item_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id INTEGER NOT NULL REFERENCES parcel_order(id) ON DELETE CASCADE,
+    parcel_number INTEGER NOT NULL UNIQUE REFERENCES parcel(number) ON DELETE CASCADE
+);
+INSERT INTO parcel_order_item_new (id, order_id, parcel_number)
+SELECT id, order_id, parcel_number FROM parcel_order_item
+WHERE order_id IN (SELECT id FROM parcel_order) AND parcel_number IN (SELECT number FROM parcel);
+DROP TABLE parcel_order_item;
+ALTER TABLE parcel_order_item_new RENAME TO parcel_order_item;
+CREATE INDEX parcel_order_item_order_id ON parcel_order_item(order_id, id);`,
+
+	// 47: only known statuses (see knownStatus), for writers other than the
+	// store; SQLite cannot add a CHECK constraint to a table, so triggers
+	// refuse the others. Existing rows are left; see ListBadStatuses
+	`CREATE TRIGGER parcel_status_check_insert BEFORE INSERT ON parcel
+WHEN new.status NOT IN ('registered', 'sent', 'customs_cleared', 'delivered') BEGIN
+    SELECT RAISE(ABORT, 'CHECK constraint failed: unknown parcel status');
+END;
+CREATE TRIGGER parcel_status_check_update BEFORE UPDATE OF status ON parcel
+WHEN new.status NOT IN ('registered', 'sent', 'customs_cleared', 'delivered') BEGIN
+    SELECT RAISE(ABORT, 'CHECK constraint failed: unknown parcel status');
+END;`,
+
+	// 48: when parcels were first sent and delivered, backfilled from the
+	// status history; the change feed trigger is dropped meanwhile, as the
+	// backfill changes nothing a consumer cares about
+	`ALTER TABLE parcel ADD COLUMN sent_at VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE parcel ADD COLUMN delivered_at VARCHAR(64) NOT NULL DEFAULT '';
+DROP TRIGGER parcel_change_update;
+UPDATE parcel SET
+    sent_at = COALESCE((SELECT MIN(changed_at) FROM parcel_status_history
+        WHERE parcel_number = parcel.number AND status = 'sent'), ''),
+    delivered_at = COALESCE((SELECT MIN(changed_at) FROM parcel_status_history
+        WHERE parcel_number = parcel.number AND status = 'delivered'), '');
+CREATE TRIGGER parcel_change_update AFTER UPDATE ON parcel WHEN old.tracking_code != '' BEGIN
+    INSERT INTO parcel_change (parcel_number, op, actor)
+    VALUES (new.number, 'update', COALESCE((SELECT actor FROM mutation_actor), ''));
+END;
+CREATE INDEX parcel_delivered_at ON parcel(delivered_at);`,
+
+	// 49: estimated delivery times, see ETAPolicy; parcels registered
+	// before have none
+	`ALTER TABLE parcel ADD COLUMN estimated_delivery_at VARCHAR(64) NOT NULL DEFAULT '';
+CREATE INDEX parcel_estimated_delivery_at ON parcel(estimated_delivery_at);
+CREATE INDEX parcel_transit ON parcel(service_class, zone, delivered_at);`,
+
+	// 50: delays and the ops queue parcels are escalated to; see
+	// DetectDelays
+	`ALTER TABLE parcel ADD COLUMN delays INTEGER NOT NULL DEFAULT 0;
+CREATE TABLE work_item (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    parcel_number INTEGER NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    created_at VARCHAR(64) NOT NULL
+);
+CREATE INDEX work_item_parcel_number ON work_item(parcel_number);`,
+
+	// 51: assignment and resolution of work items; see AssignWorkItem
+	`ALTER TABLE work_item ADD COLUMN state VARCHAR(16) NOT NULL DEFAULT 'open';
+ALTER TABLE work_item ADD COLUMN assignee VARCHAR(128) NOT NULL DEFAULT '';
+ALTER TABLE work_item ADD COLUMN resolution TEXT NOT NULL DEFAULT '';
+ALTER TABLE work_item ADD COLUMN updated_at VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE work_item ADD COLUMN resolved_at VARCHAR(64) NOT NULL DEFAULT '';
+UPDATE work_item SET updated_at = created_at;
+CREATE INDEX work_item_state_kind ON work_item(state, kind);`,
+
+	// 52: address books of clients; see SavedAddress
+	`CREATE TABLE client_address (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    client INTEGER NOT NULL,
+    label VARCHAR(64) NOT NULL,
+    address TEXT NOT NULL,
+    is_default INTEGER NOT NULL DEFAULT 0,
+    created_at VARCHAR(64) NOT NULL,
+    updated_at VARCHAR(64) NOT NULL DEFAULT ''
+);
+CREATE INDEX client_address_client ON client_address(client);`,
+
+	// 53: templates of recurring parcels; see ParcelTemplate
+	`CREATE TABLE parcel_template (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    client INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    address TEXT NOT NULL,
+    service_class VARCHAR(16) NOT NULL,
+    weight_grams INTEGER NOT NULL DEFAULT 0,
+    created_at VARCHAR(64) NOT NULL
+);
+CREATE INDEX parcel_template_client ON parcel_template(client);`,
+
+	// 54: parcel drafts and scheduled registrations; see ParcelDraft
+	`CREATE TABLE parcel_draft (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    client INTEGER NOT NULL,
+    data TEXT NOT NULL,
+    activate_at VARCHAR(64) NOT NULL DEFAULT '',
+    created_at VARCHAR(64) NOT NULL,
+    updated_at VARCHAR(64) NOT NULL
+);
+CREATE INDEX parcel_draft_client ON parcel_draft(client);
+CREATE INDEX parcel_draft_activate_at ON parcel_draft(activate_at);`,
+
+	// 55: currencies of parcel amounts; see DefaultCurrency
+	`ALTER TABLE parcel ADD COLUMN currency VARCHAR(3) NOT NULL DEFAULT 'RUB';`,
+
+	// 56: the change feed records every update; Add now stores the
+	// tracking code with the insert, and parcels anonymised by erasure
+	// have none
+	`DROP TRIGGER parcel_change_update;
+CREATE TRIGGER parcel_change_update AFTER UPDATE ON parcel BEGIN
+    INSERT INTO parcel_change (parcel_number, op, actor)
+    VALUES (new.number, 'update', COALESCE((SELECT actor FROM mutation_actor), ''));
+END;`,
+
+	// 57: failed activations of scheduled registrations; see
+	// ActivateScheduled
+	`ALTER TABLE parcel_draft ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE parcel_draft ADD COLUMN last_error TEXT NOT NULL DEFAULT '';`,
+
+	// 58: creation times compared as Julian days, which do not depend on
+	// their precision; see FormatTimestamp
+	`DROP INDEX parcel_created_at_seq;
+CREATE INDEX parcel_created_at_seq ON parcel(julianday(created_at), seq);`,
+}
+
+// migrationFuncs holds data changes SQL cannot express, keyed by schema
+// version. Each runs in the transaction of its migration, after the SQL.
+var migrationFuncs = map[int]func(tx *sql.Tx) error{
+	9:  backfillTrackingCodes,
+	22: materialiseDeliveryAnalytics,
+	42: backfillPublicIDs,
+}
+
+// SchemaVersion returns the schema version recorded in the database.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store has not been initialised.
+//   - Wraps and returns any SQL error from reading PRAGMA user_version.
+func (s ParcelStore) SchemaVersion() (int, error) {
+	if err := s.check(); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err := s.db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// EnsureSchema initialises a fresh database and brings the schema of any
+// database up to date, so the store works on a new file without manual
+// setup.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store has not been initialised.
+//   - Creates the base "parcel" table and its indexes from the embedded
+//     schema.sql if they do not exist; existing tables are left as they are.
+//   - Then applies pending migrations; see Migrate.
+//   - Wraps and returns any SQL error from creating the base schema.
+func (s ParcelStore) EnsureSchema(ctx context.Context) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	if _, err := s.db.ExecContext(ctx, baseSchema); err != nil {
+		return fmt.Errorf("failed to create base schema: %w", err)
+	}
+	return s.Migrate()
+}
+
+// Migrate brings the schema up to date by applying every migration newer
+// than the version recorded in the database.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store has not been initialised.
+//   - Applies each migration in its own transaction together with the
+//     version bump, so a failed migration leaves the previous version intact.
+//   - Is a no-op when the schema is already current.
+//   - Wraps and returns any SQL error with the failing version number.
+func (s ParcelStore) Migrate() error {
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+
+		tx, err := s.db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d: %w", version, err)
+		}
+		if fn, ok := migrationFuncs[version]; ok {
+			if err := fn(tx); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to apply migration %d: %w", version, err)
+			}
+		}
+		// PRAGMA does not accept parameters; version is an int we control.
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record schema version %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
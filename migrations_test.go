@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMigrateIsIdempotent verifies that Migrate records the latest schema
+// version and that running it again changes nothing.
+func TestMigrateIsIdempotent(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(testSchema)
+	require.NoError(t, err)
+	store := NewParcelStore(db)
+
+	// migrate
+	require.NoError(t, store.Migrate())
+	require.NoError(t, store.Migrate())
+
+	// check
+	version, err := store.SchemaVersion()
+	require.NoError(t, err)
+	require.Equal(t, len(migrations), version)
+}
+
+// TestEnsureSchema verifies that EnsureSchema initialises a fresh file
+// and keeps the data of an existing database.
+func TestEnsureSchema(t *testing.T) {
+	// prepare
+	path := filepath.Join(t.TempDir(), "tracker.db")
+	store, err := OpenParcelStore(path, DefaultOptions())
+	require.NoError(t, err)
+	defer store.Close()
+
+	// check
+	_, err = store.Add(getTestParcel())
+	require.ErrorContains(t, err, "no such table")
+	require.NoError(t, store.EnsureSchema(context.Background()))
+	version, err := store.SchemaVersion()
+	require.NoError(t, err)
+	require.Equal(t, len(migrations), version)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.EnsureSchema(context.Background()))
+	_, err = store.Get(id)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// DefaultCurrency is the ISO 4217 code of amounts stored without one, and
+// of tariffs (see Tariff). Amounts are integers in minor units of their
+// currency, e.g. kopecks, never floats.
+const DefaultCurrency = "RUB"
+
+var (
+	// ErrInvalidCurrency indicates a currency that is not an ISO 4217
+	// code, or one a CurrencyConverter has no rate for.
+	ErrInvalidCurrency = newError(CodeInvalidCurrency, "invalid currency")
+	// ErrCurrencyMismatch indicates amounts in different currencies put
+	// together, e.g. parcels of one order or a merge, or a conversion
+	// needed without a CurrencyConverter.
+	ErrCurrencyMismatch = newError(CodeCurrencyMismatch, "currency mismatch")
+)
+
+// NormaliseCurrency returns currency as an upper-case ISO 4217 code,
+// DefaultCurrency if it is empty.
+//
+// Behaviour:
+//   - Returns ErrInvalidCurrency (wrapped) unless currency is three
+//     letters.
+func NormaliseCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return DefaultCurrency, nil
+	}
+	if len(currency) != 3 {
+		return "", fmt.Errorf("%w %q: must be an ISO 4217 code", ErrInvalidCurrency, currency)
+	}
+	for _, c := range currency {
+		if c < 'A' || c > 'Z' {
+			return "", fmt.Errorf("%w %q: must be an ISO 4217 code", ErrInvalidCurrency, currency)
+		}
+	}
+	return currency, nil
+}
+
+// CurrencyConverter converts amount, in minor units of from, to minor
+// units of to, e.g. with the rates of a bank or of a carrier contract.
+type CurrencyConverter interface {
+	Convert(amount int, from, to string) (int, error)
+}
+
+// FixedRates is a CurrencyConverter with rates that do not change: each
+// is the value of one minor unit of a currency in millionths of a minor
+// unit of DefaultCurrency, e.g. "EUR": 100_000_000 for 1 EUR = 100 RUB.
+// DefaultCurrency need not be listed.
+type FixedRates map[string]int64
+
+// Convert converts amount from one currency to another, rounding half
+// away from zero. It returns ErrInvalidCurrency (wrapped) for a currency
+// without a rate.
+func (r FixedRates) Convert(amount int, from, to string) (int, error) {
+	if from == to {
+		return amount, nil
+	}
+	fromRate, err := r.rate(from)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := r.rate(to)
+	if err != nil {
+		return 0, err
+	}
+
+	// big.Int keeps amount * rate from overflowing
+	num := new(big.Int).Mul(big.NewInt(int64(amount)), big.NewInt(fromRate))
+	den := big.NewInt(toRate)
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Abs(new(big.Int).Mul(rem, big.NewInt(2))).Cmp(den) >= 0 {
+		quo.Add(quo, big.NewInt(int64(num.Sign())))
+	}
+	if !quo.IsInt64() {
+		return 0, fmt.Errorf("failed to convert %d %s to %s: result out of range", amount, from, to)
+	}
+	return int(quo.Int64()), nil
+}
+
+// rate returns the rate of currency.
+func (r FixedRates) rate(currency string) (int64, error) {
+	if rate, ok := r[currency]; ok && rate > 0 {
+		return rate, nil
+	}
+	if currency == DefaultCurrency {
+		return 1_000_000, nil
+	}
+	return 0, fmt.Errorf("%w %q: no exchange rate", ErrInvalidCurrency, currency)
+}
+
+// WithCurrencyConverter returns a copy of the service that converts the
+// tariffs of parcels in another currency than DefaultCurrency with c
+// (see WithPricing). Without one, such parcels cannot be priced.
+func (s ParcelService) WithCurrencyConverter(c CurrencyConverter) ParcelService {
+	s.currencies = c
+	return s
+}
+
+// convert converts amount from one currency to another with the service's
+// converter, or returns ErrCurrencyMismatch (wrapped) if it needs one and
+// has none.
+func (s ParcelService) convert(amount int, from, to string) (int, error) {
+	if from == to {
+		return amount, nil
+	}
+	if s.currencies == nil {
+		return 0, fmt.Errorf("%w: cannot convert %s to %s without exchange rates", ErrCurrencyMismatch, from, to)
+	}
+	return s.currencies.Convert(amount, from, to)
+}
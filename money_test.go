@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNormaliseCurrency checks the accepted currency codes.
+func TestNormaliseCurrency(t *testing.T) {
+	for in, want := range map[string]string{"": DefaultCurrency, "eur": "EUR", " USD ": "USD"} {
+		got, err := NormaliseCurrency(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	for _, in := range []string{"EURO", "E1R", "€"} {
+		_, err := NormaliseCurrency(in)
+		assert.ErrorIs(t, err, ErrInvalidCurrency, in)
+	}
+}
+
+// TestFixedRates checks conversions through DefaultCurrency and their
+// rounding.
+func TestFixedRates(t *testing.T) {
+	rates := FixedRates{"EUR": 100_000_000, "USD": 90_000_000}
+
+	tests := []struct {
+		amount   int
+		from, to string
+		want     int
+	}{
+		{40000, DefaultCurrency, "EUR", 400},
+		{150, "EUR", DefaultCurrency, 15000},
+		{100, "EUR", "USD", 111},
+		{5, "USD", "USD", 5},
+		{50, DefaultCurrency, "EUR", 1},
+		{-50, DefaultCurrency, "EUR", -1},
+		{49, DefaultCurrency, "EUR", 0},
+	}
+	for _, tt := range tests {
+		got, err := rates.Convert(tt.amount, tt.from, tt.to)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, "%d %s to %s", tt.amount, tt.from, tt.to)
+	}
+	_, err := rates.Convert(100, "GBP", DefaultCurrency)
+	assert.ErrorIs(t, err, ErrInvalidCurrency)
+}
+
+// TestCurrencies verifies that parcels are priced in their currency and
+// that currencies do not mix within an order or a merge.
+func TestCurrencies(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	getTestTariffs(t, service.store)
+	service = service.WithPricing(nil)
+	draft := Parcel{Client: 1000, Address: "test", WeightGrams: 2000, Currency: "eur", DeclaredValue: 5000}
+
+	// check
+	_, err := service.RegisterParcel(draft)
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+	_, err = service.RegisterParcel(Parcel{Client: 1000, Address: "test", Currency: "euro"})
+	assert.ErrorIs(t, err, ErrInvalidCurrency)
+
+	service = service.WithCurrencyConverter(FixedRates{"EUR": 100_000_000})
+	euros, err := service.RegisterParcel(draft)
+	require.NoError(t, err)
+	assert.Equal(t, "EUR", euros.Currency)
+	assert.Equal(t, 400, euros.Price)
+	assert.Equal(t, 5000, euros.DeclaredValue)
+	roubles, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", WeightGrams: 2000})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultCurrency, roubles.Currency)
+	assert.Equal(t, 40000, roubles.Price)
+
+	order, err := service.CreateOrder(1000)
+	require.NoError(t, err)
+	require.NoError(t, service.AddOrderParcel(order.ID, euros.Number))
+	assert.ErrorIs(t, service.AddOrderParcel(order.ID, roubles.Number), ErrCurrencyMismatch)
+
+	_, err = service.Merge([]int{euros.Number, roubles.Number})
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Channels with a built-in implementation; other names may be used with
+// custom Channel implementations.
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+// TemplateDelayed is the Status of the NotificationTemplate sent when a
+// parcel misses its estimated delivery time (see DetectDelays) rather
+// than on a status change.
+const TemplateDelayed = "delayed"
+
+// States of a queued notification.
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed"
+)
+
+var (
+	// ErrInvalidTemplate indicates a NotificationTemplate that failed
+	// validation or does not parse.
+	ErrInvalidTemplate = errors.New("invalid notification template")
+	// ErrInvalidPreference indicates a NotificationPreference that failed
+	// validation.
+	ErrInvalidPreference = errors.New("invalid notification preference")
+	// ErrNoChannel indicates a queued notification for a channel the
+	// Notifier has no implementation of.
+	ErrNoChannel = errors.New("no such notification channel")
+)
+
+// NotificationTemplate is the message sent on a channel when a parcel
+// reaches Status, or is delayed if Status is TemplateDelayed. Subject and Body are text/template templates executed
+// with a NotificationData; Subject is ignored by channels without one.
+type NotificationTemplate struct {
+	Status  string
+	Channel string
+	Subject string
+	Body    string
+}
+
+// NotificationData is what notification templates are executed with.
+type NotificationData struct {
+	Parcel     Parcel
+	PrevStatus string
+	// DeliveryCode is set on the "sent" status when delivery codes are
+	// on; see Event.DeliveryCode.
+	DeliveryCode string
+	// MissedETA is set on TemplateDelayed; see Event.MissedETA.
+	MissedETA string
+}
+
+// NotificationPreference is the opt-in of a client to a channel: while
+// Enabled, status changes of the client's parcels are sent to Recipient
+// (an e-mail address or phone number).
+type NotificationPreference struct {
+	Client    int
+	Channel   string
+	Recipient string
+	Enabled   bool
+}
+
+// Notification is a message in the outgoing queue.
+type Notification struct {
+	ID        int
+	Number    int
+	Channel   string
+	Recipient string
+	Subject   string
+	Body      string
+	// State is one of the Notification* constants.
+	State    string
+	Attempts int
+	// NextAttemptAt is when a pending notification is due.
+	NextAttemptAt string
+	LastError     string
+	CreatedAt     string
+	SentAt        string
+}
+
+// Message is a rendered notification handed to a Channel.
+type Message struct {
+	Recipient string
+	Subject   string
+	Body      string
+}
+
+// Channel delivers messages to recipients, e.g. by e-mail or SMS.
+type Channel interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// SMTPChannel is a Channel sending plain-text e-mail through an SMTP
+// server with net/smtp.
+type SMTPChannel struct {
+	// Addr is the server as host:port.
+	Addr string
+	From string
+	// Auth may be nil for servers that do not require authentication.
+	Auth smtp.Auth
+}
+
+// Send implements Channel. The context is not honoured by net/smtp.
+func (c SMTPChannel) Send(_ context.Context, m Message) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\n", c.From, m.Recipient, m.Subject)
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+
+	if err := smtp.SendMail(c.Addr, c.Auth, c.From, []string{m.Recipient}, msg.Bytes()); err != nil {
+		return fmt.Errorf("failed to send e-mail to %s: %w", m.Recipient, err)
+	}
+	return nil
+}
+
+// SMSGateway sends text messages; implement it for the SMS provider in use.
+type SMSGateway interface {
+	SendSMS(ctx context.Context, phone, text string) error
+}
+
+// SMSChannel is a Channel sending the body of each message through an
+// SMSGateway.
+type SMSChannel struct {
+	Gateway SMSGateway
+}
+
+// Send implements Channel.
+func (c SMSChannel) Send(ctx context.Context, m Message) error {
+	return c.Gateway.SendSMS(ctx, m.Recipient, m.Body)
+}
+
+// SetNotificationTemplate creates or replaces the template for
+// (t.Status, t.Channel).
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrNewStatusUnrecognised (wrapped) for an unknown status
+//     other than TemplateDelayed.
+//   - Returns ErrInvalidTemplate (wrapped) if the channel or body is
+//     empty or a template does not parse.
+//   - Wraps and returns any SQL error from the upsert.
+func (s ParcelStore) SetNotificationTemplate(t NotificationTemplate) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	if !knownStatus(t.Status) && t.Status != TemplateDelayed {
+		return fmt.Errorf("failed to set notification template: %w %q", ErrNewStatusUnrecognised, t.Status)
+	}
+	if t.Channel == "" || t.Body == "" {
+		return fmt.Errorf("failed to set notification template for %q: %w: empty channel or body", t.Status, ErrInvalidTemplate)
+	}
+	if _, _, err := t.render(NotificationData{}); err != nil {
+		return fmt.Errorf("failed to set notification template for %q on %s: %w", t.Status, t.Channel, err)
+	}
+
+	query := `INSERT INTO notification_template (status, channel, subject, body) VALUES (:status, :channel, :subject, :body)
+ON CONFLICT (status, channel) DO UPDATE SET subject = excluded.subject, body = excluded.body`
+	_, err := s.conn().Exec(query, sql.Named("status", t.Status), sql.Named("channel", t.Channel),
+		sql.Named("subject", t.Subject), sql.Named("body", t.Body))
+	if err != nil {
+		return fmt.Errorf("failed to set notification template for %q on %s: %w", t.Status, t.Channel, err)
+	}
+	return nil
+}
+
+// render executes the subject and body templates with data. Parse and
+// execution errors wrap ErrInvalidTemplate.
+func (t NotificationTemplate) render(data NotificationData) (subject, body string, err error) {
+	texts := []string{t.Subject, t.Body}
+	for i, text := range texts {
+		tmpl, err := template.New(t.Status).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", "", fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+		}
+		texts[i] = buf.String()
+	}
+	return texts[0], texts[1], nil
+}
+
+// SetNotificationPreference creates or replaces the preference of
+// (p.Client, p.Channel).
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidPreference (wrapped) if the client or channel is
+//     missing, or the preference is enabled without a recipient.
+//   - Returns ErrInvalidPreference and ErrInvalidEmail or
+//     ErrInvalidRecipient (wrapped) if the recipient of an e-mail or SMS
+//     preference is not a valid address or phone; it is stored normalised
+//     (see NormaliseEmail and NormalisePhone).
+//   - Wraps and returns any SQL error from the upsert.
+func (s ParcelStore) SetNotificationPreference(p NotificationPreference) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	p.Recipient = strings.TrimSpace(p.Recipient)
+	if p.Client <= 0 || p.Channel == "" || (p.Enabled && p.Recipient == "") {
+		return fmt.Errorf("failed to set notification preference: %w: client %d, channel %q, recipient %q",
+			ErrInvalidPreference, pii(p.Client), p.Channel, pii(p.Recipient))
+	}
+	if p.Recipient != "" {
+		var err error
+		switch p.Channel {
+		case ChannelEmail:
+			p.Recipient, err = NormaliseEmail(p.Recipient)
+		case ChannelSMS:
+			p.Recipient, err = NormalisePhone(p.Recipient)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set notification preference of client %d on %s: %w: %w",
+				pii(p.Client), p.Channel, ErrInvalidPreference, err)
+		}
+	}
+
+	query := `INSERT INTO notification_preference (client, channel, recipient, enabled)
+VALUES (:client, :channel, :recipient, :enabled)
+ON CONFLICT (client, channel) DO UPDATE SET recipient = excluded.recipient, enabled = excluded.enabled`
+	_, err := s.conn().Exec(query, sql.Named("client", p.Client), sql.Named("channel", p.Channel),
+		sql.Named("recipient", p.Recipient), sql.Named("enabled", p.Enabled))
+	if err != nil {
+		return fmt.Errorf("failed to set notification preference of client %d on %s: %w", pii(p.Client), p.Channel, err)
+	}
+	return nil
+}
+
+// GetNotificationPreferences returns the preferences of client, ordered
+// by channel.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Wraps and returns any SQL errors from query, scanning, or iteration.
+func (s ParcelStore) GetNotificationPreferences(client int) ([]NotificationPreference, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT client, channel, recipient, enabled FROM notification_preference WHERE client = :client ORDER BY channel"
+	rows, err := s.conn().Query(query, sql.Named("client", client))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for notification preferences of client %d: %w", pii(client), err)
+	}
+	defer rows.Close()
+
+	var res []NotificationPreference
+	for rows.Next() {
+		var p NotificationPreference
+		if err := rows.Scan(&p.Client, &p.Channel, &p.Recipient, &p.Enabled); err != nil {
+			return nil, fmt.Errorf("failed to scan one of notification preference rows: %w", err)
+		}
+		res = append(res, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate notification preference rows: %w", err)
+	}
+	return res, nil
+}
+
+// GetNotifications returns the notifications queued for a parcel, oldest
+// first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Wraps and returns any SQL errors from query, scanning, or iteration.
+func (s ParcelStore) GetNotifications(number int) ([]Notification, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + notificationColumns + " FROM notification WHERE parcel_number = :number ORDER BY id"
+	return s.queryNotifications(fmt.Sprintf("parcel %d", number), query, sql.Named("number", number))
+}
+
+// EnqueueNotifications renders the templates for the status of parcel on
+// every channel its client opted in to and queues the messages.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Queues nothing if the client has no enabled preference with a
+//     template for the status.
+//   - Returns ErrInvalidTemplate (wrapped) if a template fails to execute;
+//     nothing is queued then.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) EnqueueNotifications(data NotificationData, now time.Time) error {
+	return s.enqueueNotifications(data.Parcel.Status, data, now)
+}
+
+// enqueueNotifications is EnqueueNotifications with the templates of
+// status, which may be TemplateDelayed.
+func (s ParcelStore) enqueueNotifications(status string, data NotificationData, now time.Time) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	parcel := data.Parcel
+	query := `SELECT t.status, t.channel, t.subject, t.body, p.recipient
+FROM notification_template t JOIN notification_preference p ON p.channel = t.channel
+WHERE t.status = :status AND p.client = :client AND p.enabled
+ORDER BY t.channel`
+	rows, err := s.conn().Query(query, sql.Named("status", status), sql.Named("client", parcel.Client))
+	if err != nil {
+		return fmt.Errorf("failed to get cursor for notification templates of parcel %d: %w", parcel.Number, err)
+	}
+	defer rows.Close()
+
+	at := FormatTimestamp(now, DefaultTimestampPrecision)
+	var queue []Notification
+	for rows.Next() {
+		var t NotificationTemplate
+		n := Notification{Number: parcel.Number, State: NotificationPending, NextAttemptAt: at, CreatedAt: at}
+		if err := rows.Scan(&t.Status, &t.Channel, &t.Subject, &t.Body, &n.Recipient); err != nil {
+			return fmt.Errorf("failed to scan one of notification template rows: %w", err)
+		}
+		n.Channel = t.Channel
+		if n.Subject, n.Body, err = t.render(data); err != nil {
+			return fmt.Errorf("failed to render %s notification of parcel %d: %w", t.Channel, parcel.Number, err)
+		}
+		queue = append(queue, n)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate notification template rows: %w", err)
+	}
+	rows.Close()
+
+	return s.InTx(func(tx ParcelStore) error {
+		query := `INSERT INTO notification (parcel_number, channel, recipient, subject, body, state, next_attempt_at, created_at)
+VALUES (:number, :channel, :recipient, :subject, :body, :state, :next_attempt_at, :created_at)`
+		for _, n := range queue {
+			_, err := tx.conn().Exec(query, sql.Named("number", n.Number), sql.Named("channel", n.Channel),
+				sql.Named("recipient", n.Recipient), sql.Named("subject", n.Subject), sql.Named("body", n.Body),
+				sql.Named("state", n.State), sql.Named("next_attempt_at", n.NextAttemptAt), sql.Named("created_at", n.CreatedAt))
+			if err != nil {
+				return fmt.Errorf("failed to queue %s notification of parcel %d: %w", n.Channel, n.Number, err)
+			}
+		}
+		return nil
+	})
+}
+
+// dueNotifications returns up to limit pending notifications due at now,
+// oldest first.
+func (s ParcelStore) dueNotifications(now time.Time, limit int) ([]Notification, error) {
+	query := "SELECT " + notificationColumns + ` FROM notification
+WHERE state = :pending AND next_attempt_at <= :now ORDER BY next_attempt_at, id LIMIT :limit`
+	return s.queryNotifications("due notifications", query, sql.Named("pending", NotificationPending),
+		sql.Named("now", FormatTimestamp(now, DefaultTimestampPrecision)), sql.Named("limit", limit))
+}
+
+// updateNotification stores the delivery state of n.
+func (s ParcelStore) updateNotification(n Notification) error {
+	query := `UPDATE notification SET state = :state, attempts = :attempts, next_attempt_at = :next_attempt_at,
+    last_error = :last_error, sent_at = :sent_at WHERE id = :id`
+	_, err := s.conn().Exec(query, sql.Named("state", n.State), sql.Named("attempts", n.Attempts),
+		sql.Named("next_attempt_at", n.NextAttemptAt), sql.Named("last_error", n.LastError),
+		sql.Named("sent_at", n.SentAt), sql.Named("id", n.ID))
+	if err != nil {
+		return fmt.Errorf("failed to update notification %d: %w", n.ID, err)
+	}
+	return nil
+}
+
+// notificationColumns lists the "notification" columns in scan order.
+const notificationColumns = "id, parcel_number, channel, recipient, subject, body, state, attempts, " +
+	"next_attempt_at, last_error, created_at, sent_at"
+
+func (s ParcelStore) queryNotifications(what, query string, args ...any) ([]Notification, error) {
+	rows, err := s.conn().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for %s: %w", what, err)
+	}
+	defer rows.Close()
+
+	var res []Notification
+	for rows.Next() {
+		var n Notification
+		err := rows.Scan(&n.ID, &n.Number, &n.Channel, &n.Recipient, &n.Subject, &n.Body, &n.State, &n.Attempts,
+			&n.NextAttemptAt, &n.LastError, &n.CreatedAt, &n.SentAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan one of notification rows for %s: %w", what, err)
+		}
+		res = append(res, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate notification rows for %s: %w", what, err)
+	}
+	return res, nil
+}
+
+// RetryPolicy controls redelivery of failed notifications: attempt n
+// (from 1) that fails is retried after Backoff·2^(n-1), and a
+// notification is given up as failed after MaxAttempts attempts.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+// DefaultRetryPolicy returns a policy of five attempts starting one
+// minute apart.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 5, Backoff: time.Minute}
+}
+
+// notificationBatch is how many notifications Deliver sends per call.
+const notificationBatch = 100
+
+// Notifier queues notifications on parcel status changes and delivers
+// the queue through its channels.
+type Notifier struct {
+	store    ParcelStore
+	channels map[string]Channel
+	retry    RetryPolicy
+	now      func() time.Time
+}
+
+// NewNotifier returns a Notifier queueing into store and delivering
+// through channels, keyed by channel name (e.g. ChannelEmail).
+func NewNotifier(store ParcelStore, channels map[string]Channel, retry RetryPolicy) *Notifier {
+	return &Notifier{store: store, channels: channels, retry: retry, now: time.Now}
+}
+
+// Subscribe queues notifications for every registration, status change
+// and delay published on bus and returns a function that stops it.
+// Errors are reported to onError, which may be nil to ignore them.
+func (n *Notifier) Subscribe(bus *EventBus, onError func(error)) (unsubscribe func()) {
+	return bus.Subscribe(func(e Event) {
+		var status string
+		switch e.Type {
+		case EventParcelRegistered, EventStatusChanged:
+			status = e.Parcel.Status
+		case EventParcelDelayed:
+			status = TemplateDelayed
+		default:
+			return
+		}
+		err := n.store.enqueueNotifications(status, NotificationData{Parcel: e.Parcel, PrevStatus: e.PrevStatus,
+			DeliveryCode: e.DeliveryCode, MissedETA: e.MissedETA}, n.now())
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	})
+}
+
+// Deliver sends the notifications that are due and returns how many were
+// sent. A failed send is retried according to the retry policy; only
+// errors of the queue itself are returned.
+func (n *Notifier) Deliver(ctx context.Context) (int, error) {
+	now := n.now()
+	due, err := n.store.dueNotifications(now, notificationBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, msg := range due {
+		if ctx.Err() != nil {
+			break
+		}
+
+		msg.Attempts++
+		err := ErrNoChannel
+		if ch, ok := n.channels[msg.Channel]; ok {
+			err = ch.Send(ctx, Message{Recipient: msg.Recipient, Subject: msg.Subject, Body: msg.Body})
+		}
+
+		switch {
+		case err == nil:
+			msg.State, msg.SentAt, msg.LastError = NotificationSent, FormatTimestamp(n.now(), DefaultTimestampPrecision), ""
+			sent++
+		case msg.Attempts >= n.retry.MaxAttempts:
+			msg.State, msg.LastError = NotificationFailed, err.Error()
+		default:
+			backoff := n.retry.Backoff << (msg.Attempts - 1)
+			msg.NextAttemptAt, msg.LastError = FormatTimestamp(now.Add(backoff), DefaultTimestampPrecision), err.Error()
+		}
+		if err := n.store.updateNotification(msg); err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// NotificationJob returns a Job that delivers due notifications (see
+// Notifier.Deliver).
+func NotificationJob(n *Notifier) Job {
+	return NewJob("notifications", func(ctx context.Context) error {
+		_, err := n.Deliver(ctx)
+		return err
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingChannel is a Channel that records messages and fails while
+// failing is set.
+type recordingChannel struct {
+	sent    []Message
+	failing bool
+}
+
+func (c *recordingChannel) Send(_ context.Context, m Message) error {
+	if c.failing {
+		return errors.New("gateway unavailable")
+	}
+	c.sent = append(c.sent, m)
+	return nil
+}
+
+// TestNotificationSettings verifies template and preference validation.
+func TestNotificationSettings(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	// check
+	require.ErrorIs(t, store.SetNotificationTemplate(NotificationTemplate{Status: "lost", Channel: ChannelSMS, Body: "x"}),
+		ErrNewStatusUnrecognised)
+	require.ErrorIs(t, store.SetNotificationTemplate(NotificationTemplate{Status: ParcelStatusSent, Channel: ChannelSMS, Body: "{{.Parcel"}),
+		ErrInvalidTemplate)
+	require.ErrorIs(t, store.SetNotificationTemplate(NotificationTemplate{Status: ParcelStatusSent, Channel: ChannelSMS, Body: "{{.Weight}}"}),
+		ErrInvalidTemplate)
+	require.ErrorIs(t, store.SetNotificationPreference(NotificationPreference{Client: 1000, Channel: ChannelSMS, Enabled: true}),
+		ErrInvalidPreference)
+
+	require.NoError(t, store.SetNotificationPreference(NotificationPreference{Client: 1000, Channel: ChannelSMS, Recipient: "+79161234567", Enabled: true}))
+	require.NoError(t, store.SetNotificationPreference(NotificationPreference{Client: 1000, Channel: ChannelSMS, Recipient: "8 (926) 123-45-67"}))
+	prefs, err := store.GetNotificationPreferences(1000)
+	require.NoError(t, err)
+	assert.Equal(t, []NotificationPreference{{Client: 1000, Channel: ChannelSMS, Recipient: "+79261234567"}}, prefs)
+}
+
+// TestNotifier verifies that status changes queue notifications on the
+// channels a client opted in to and that failed sends are retried.
+func TestNotifier(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	events := NewEventBus()
+	service := NewParcelService(store, events)
+
+	require.NoError(t, store.SetNotificationTemplate(NotificationTemplate{
+		Status: ParcelStatusSent, Channel: ChannelEmail,
+		Subject: "Parcel {{.Parcel.TrackingCode}}", Body: "Your parcel is {{.Parcel.Status}}, was {{.PrevStatus}}.",
+	}))
+	require.NoError(t, store.SetNotificationTemplate(NotificationTemplate{
+		Status: ParcelStatusSent, Channel: ChannelSMS, Body: "Sent: {{.Parcel.TrackingCode}}",
+	}))
+	require.NoError(t, store.SetNotificationPreference(NotificationPreference{Client: 1000, Channel: ChannelEmail, Recipient: "a@example.com", Enabled: true}))
+	require.NoError(t, store.SetNotificationPreference(NotificationPreference{Client: 1000, Channel: ChannelSMS, Recipient: "+79161234567", Enabled: false}))
+
+	email := &recordingChannel{failing: true}
+	notifier := NewNotifier(store, map[string]Channel{ChannelEmail: email}, RetryPolicy{MaxAttempts: 2, Backoff: time.Minute})
+	now := time.Now()
+	notifier.now = func() time.Time { return now }
+	defer notifier.Subscribe(events, func(err error) { t.Error(err) })()
+
+	// change status
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", Payment: PaymentPaid})
+	require.NoError(t, err)
+	require.NoError(t, service.NextStatus(parcel.Number))
+
+	// deliver: fails, not yet due, then succeeds on retry
+	sent, err := notifier.Deliver(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, sent)
+	sent, err = notifier.Deliver(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, sent)
+
+	email.failing = false
+	now = now.Add(time.Minute)
+	sent, err = notifier.Deliver(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+
+	// check
+	require.Len(t, email.sent, 1)
+	assert.Equal(t, Message{
+		Recipient: "a@example.com",
+		Subject:   "Parcel " + parcel.TrackingCode,
+		Body:      "Your parcel is sent, was registered.",
+	}, email.sent[0])
+
+	queued, err := store.GetNotifications(parcel.Number)
+	require.NoError(t, err)
+	require.Len(t, queued, 1)
+	assert.Equal(t, NotificationSent, queued[0].State)
+	assert.Equal(t, 2, queued[0].Attempts)
+}
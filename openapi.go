@@ -0,0 +1,554 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:generate go run . openapi -o openapi.json -client client/client.go
+
+// apiOperation describes one route of NewHTTPHandler for the OpenAPI
+// document. Keep the table in step with the handlers: TestOpenAPIRoutes
+// checks that every entry is served.
+type apiOperation struct {
+	method string
+	// path is the route with {parameters}; "number", "id" and "client" are
+	// integers, other path parameters strings, such as "parcel", the public
+	// ID of a parcel.
+	path string
+	// id names the operation, and the method of the generated client.
+	id      string
+	summary string
+	params  []apiParam
+	// request and response are values of the JSON body types, nil for
+	// none; a []byte response is served as binary content of contentType,
+	// image/png if empty.
+	request     any
+	response    any
+	contentType string
+	status      int
+	// public operations need no API key.
+	public bool
+}
+
+// apiParam is a query or header parameter of an apiOperation.
+type apiParam struct {
+	name     string
+	in       string // "query" or "header"
+	typ      string // OpenAPI type: "integer", "number", "boolean" or "string"
+	required bool
+	summary  string
+}
+
+// langParam selects the language of status labels; see requestLang.
+var langParam = apiParam{name: "lang", in: "query", typ: "string",
+	summary: "language of status labels, default from Accept-Language, else " + DefaultLabelLang}
+
+// auditParams are the query parameters of GET /audit and /audit/export;
+// see AuditFilter.
+var auditParams = []apiParam{
+	{name: "actor", in: "query", typ: "string", summary: "only changes by this actor, e.g. user:alice"},
+	{name: "number", in: "query", typ: "integer", summary: "only changes to the parcel with this number"},
+	{name: "operation", in: "query", typ: "string",
+		summary: "only this operation: create, update, delete, status, address or override"},
+	{name: "from", in: "query", typ: "string", summary: "first time included, RFC 3339 or YYYY-MM-DD"},
+	{name: "to", in: "query", typ: "string", summary: "first time excluded, RFC 3339 or YYYY-MM-DD"},
+	{name: "limit", in: "query", typ: "integer",
+		summary: "default " + strconv.Itoa(DefaultAuditLimit) + ", at most " + strconv.Itoa(MaxAuditLimit)},
+}
+
+// filterParams are the query parameters of GET /parcels; see parcelFilter.
+var filterParams = []apiParam{
+	{name: "client", in: "query", typ: "integer"},
+	{name: "status", in: "query", typ: "string"},
+	{name: "service_class", in: "query", typ: "string", summary: "express, standard or economy"},
+	{name: "min_weight", in: "query", typ: "integer", summary: "grams, inclusive"},
+	{name: "max_weight", in: "query", typ: "integer", summary: "grams, inclusive"},
+	{name: "min_value", in: "query", typ: "integer", summary: "declared value in kopecks, inclusive"},
+	{name: "max_value", in: "query", typ: "integer", summary: "declared value in kopecks, inclusive"},
+	{name: "duplicates", in: "query", typ: "boolean", summary: "only suspected duplicates"},
+	{name: "recipient_phone", in: "query", typ: "string", summary: "phone of the recipient, any common format"},
+	{name: "sort", in: "query", typ: "string", summary: "created_at, weight_grams or declared_value"},
+	{name: "order", in: "query", typ: "string", summary: "asc or desc"},
+}
+
+// apiOperations lists the REST API in the order of NewHTTPHandler.
+// /graphql, which describes itself, the event streams and the tracking
+// page are left out.
+var apiOperations = []apiOperation{
+	{method: http.MethodPost, path: "/parcels", id: "RegisterParcel", summary: "register a parcel",
+		params: []apiParam{{name: "Idempotency-Key", in: "header", typ: "string",
+			summary: "repeating a registration with the same key returns the first parcel"}},
+		request: registerRequest{}, response: parcelJSON{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/parcels", id: "ListParcels", summary: "list parcels",
+		params: filterParams, response: []parcelJSON{}},
+	{method: http.MethodGet, path: "/parcels/{parcel}", id: "GetParcel", summary: "get a parcel",
+		response: parcelJSON{}},
+	{method: http.MethodDelete, path: "/parcels/{parcel}", id: "DeleteParcel", summary: "delete a registered parcel",
+		status: http.StatusNoContent},
+	{method: http.MethodPut, path: "/parcels/{parcel}/address", id: "ChangeAddress", summary: "change the address",
+		request: addressRequest{}, response: parcelJSON{}},
+	{method: http.MethodPut, path: "/parcels/{parcel}/delivery-window", id: "Reschedule",
+		summary: "set the window the recipient wants the parcel delivered in", request: deliveryWindowJSON{},
+		response: parcelJSON{}},
+	{method: http.MethodPost, path: "/parcels/{parcel}/hold", id: "HoldParcel",
+		summary: "put the parcel on hold, pausing it in its status", request: holdRequest{}, response: parcelJSON{}},
+	{method: http.MethodDelete, path: "/parcels/{parcel}/hold", id: "ReleaseParcel", summary: "release the hold",
+		response: parcelJSON{}},
+	{method: http.MethodGet, path: "/delivery-slots", id: "ListDeliverySlots",
+		summary: "delivery slots of a day with the room left in each",
+		params: []apiParam{
+			{name: "day", in: "query", typ: "string", required: true, summary: "YYYY-MM-DD"},
+		},
+		response: []deliverySlotJSON{}},
+	{method: http.MethodPut, path: "/parcels/{parcel}/customs", id: "SetCustomsDeclaration",
+		summary: "set the customs declaration", request: customsRequest{}, response: parcelJSON{}},
+	{method: http.MethodPost, path: "/parcels/{parcel}/next-status", id: "NextStatus", summary: "advance the status",
+		response: parcelJSON{}},
+	{method: http.MethodPut, path: "/parcels/{parcel}/payment", id: "SetPayment", summary: "change the payment status",
+		request: paymentRequest{}, response: parcelJSON{}},
+	{method: http.MethodGet, path: "/parcels/{parcel}/history", id: "GetHistory", summary: "status history",
+		response: []statusChangeJSON{}},
+	{method: http.MethodGet, path: "/parcels/{parcel}/address-history", id: "GetAddressHistory",
+		summary: "every address the parcel has had", response: []addressHistoryJSON{}},
+	{method: http.MethodPost, path: "/parcels/{parcel}/split", id: "SplitParcel", summary: "split into pieces",
+		request: splitRequest{}, response: []parcelJSON{}, status: http.StatusCreated},
+	{method: http.MethodPost, path: "/parcels/delete", id: "DeleteParcels",
+		summary: "delete registered parcels in bulk, reporting those refused", request: deleteManyRequest{},
+		response: deleteReportJSON{}},
+	{method: http.MethodPost, path: "/parcels/merge", id: "MergeParcels", summary: "merge into one parcel",
+		request: mergeRequest{}, response: parcelJSON{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/parcels/{parcel}/links", id: "ListParcelLinks", summary: "split and merge links",
+		response: []parcelLinkJSON{}},
+	{method: http.MethodGet, path: "/parcels/{parcel}/location", id: "GetLocation", summary: "where the parcel was last scanned",
+		response: locationJSON{}},
+	{method: http.MethodPost, path: "/parcels/{parcel}/location", id: "RecordLocation", summary: "record a scan",
+		request: locationRequest{}, response: locationJSON{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/parcels/{parcel}/locations", id: "ListLocations", summary: "movement trail",
+		response: []locationJSON{}},
+	{method: http.MethodPost, path: "/parcels/{parcel}/scans", id: "RecordScan", summary: "record a scan event",
+		request: scanRequest{}, response: scanJSON{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/parcels/{parcel}/scans", id: "ListScans", summary: "scan events",
+		response: []scanJSON{}},
+	{method: http.MethodPost, path: "/scans/sync", id: "SyncScans", summary: "apply scans recorded offline by a courier device",
+		request: syncRequest{}, response: []syncResultJSON{}},
+	{method: http.MethodPost, path: "/parcels/{parcel}/status-overrides", id: "ForceSetStatus",
+		summary: "force a status, bypassing the lifecycle", request: statusOverrideRequest{}, response: parcelJSON{}},
+	{method: http.MethodGet, path: "/parcels/{parcel}/status-overrides", id: "ListStatusOverrides",
+		summary: "audit of forced statuses", response: []statusOverrideJSON{}},
+	{method: http.MethodPost, path: "/parcels/{parcel}/delivery-code", id: "ConfirmDeliveryCode",
+		summary: "confirm the delivery code given by the recipient", request: deliveryCodeRequest{}, status: http.StatusNoContent},
+	{method: http.MethodPost, path: "/parcels/{parcel}/delivery-code/override", id: "OverrideDeliveryCode",
+		summary: "let the parcel be delivered without its code", request: deliveryCodeOverrideRequest{},
+		status: http.StatusNoContent},
+	{method: http.MethodPost, path: "/parcels/{parcel}/proof", id: "DeliverWithProof", summary: "deliver with proof of delivery",
+		request: proofRequest{}, response: parcelJSON{}},
+	{method: http.MethodGet, path: "/parcels/{parcel}/proof", id: "GetProof", summary: "proof of delivery",
+		response: proofJSON{}},
+	{method: http.MethodGet, path: "/parcels/{parcel}/proof/content", id: "GetProofContent", summary: "image of the proof of delivery",
+		response: []byte{}, contentType: "image/*"},
+	{method: http.MethodPost, path: "/parcels/{parcel}/comments", id: "AddComment", summary: "leave a comment",
+		request: commentRequest{}, response: commentJSON{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/parcels/{parcel}/comments", id: "ListComments", summary: "comments, oldest first",
+		response: []commentJSON{}},
+	{method: http.MethodGet, path: "/parcels/{parcel}/label", id: "GetLabel", summary: "PNG shipping label",
+		response: []byte{}},
+	{method: http.MethodPost, path: "/parcels/{parcel}/claims", id: "FileClaim", summary: "file a claim",
+		request: claimRequest{}, response: claimJSON{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/parcels/{parcel}/claims", id: "ListParcelClaims",
+		summary: "claims against a parcel, oldest first", response: []claimJSON{}},
+	{method: http.MethodGet, path: "/nearby", id: "Nearby", summary: "undelivered parcels near a position",
+		params: []apiParam{
+			{name: "lat", in: "query", typ: "number", required: true},
+			{name: "lon", in: "query", typ: "number", required: true},
+			{name: "radius", in: "query", typ: "number", required: true, summary: "metres"},
+		},
+		response: []parcelJSON{}},
+	{method: http.MethodGet, path: "/search", id: "Search", summary: "parcels by address words, best match first",
+		params: []apiParam{
+			{name: "q", in: "query", typ: "string", required: true, summary: "words of the address, matched as prefixes"},
+			{name: "limit", in: "query", typ: "integer", summary: "default " + strconv.Itoa(DefaultSearchLimit) + ", at most " + strconv.Itoa(MaxSearchLimit)},
+		},
+		response: []parcelJSON{}},
+	{method: http.MethodGet, path: "/changes", id: "ListChanges", summary: "changes of parcels after a cursor, oldest first",
+		params: []apiParam{
+			{name: "since", in: "query", typ: "integer", summary: "cursor of the last change read; default 0, the start"},
+			{name: "limit", in: "query", typ: "integer", summary: "default " + strconv.Itoa(DefaultChangeLimit) + ", at most " + strconv.Itoa(MaxChangeLimit)},
+		},
+		response: changesJSON{}},
+	{method: http.MethodGet, path: "/summary", id: "GetParcelSummary",
+		summary: "parcels per client, registration day and status, read from a table kept up to date",
+		params: []apiParam{
+			{name: "client", in: "query", typ: "integer", summary: "only this client; a client sees only its own"},
+			{name: "from", in: "query", typ: "string", summary: "first registration day included, YYYY-MM-DD"},
+			{name: "to", in: "query", typ: "string", summary: "first registration day excluded, YYYY-MM-DD"},
+		},
+		response: []summaryJSON{}},
+	{method: http.MethodGet, path: "/audit", id: "ListAuditEntries", summary: "audit log of changes to parcels, oldest first",
+		params: auditParams, response: []auditEntryJSON{}},
+	{method: http.MethodGet, path: "/audit/export", id: "ExportAuditEntries", summary: "audit log as CSV, for compliance reviews",
+		params: auditParams, response: []byte{}, contentType: "text/csv"},
+	{method: http.MethodGet, path: "/status-labels", id: "ListStatusLabels", summary: "status presentation metadata",
+		params: []apiParam{langParam}, response: []statusLabelJSON{}},
+	{method: http.MethodPost, path: "/routes", id: "CreateRoute", summary: "create a route",
+		request: routeRequest{}, response: routeJSON{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/routes", id: "ListRoutes", summary: "list routes",
+		params:   []apiParam{{name: "day", in: "query", typ: "string", summary: "YYYY-MM-DD"}},
+		response: []routeJSON{}},
+	{method: http.MethodGet, path: "/routes/{id}", id: "GetRoute", summary: "get a route with its stops",
+		response: routeJSON{}},
+	{method: http.MethodPost, path: "/routes/{id}/stops", id: "AddRouteStop", summary: "add a stop",
+		request: routeStopRequest{}, response: routeJSON{}},
+	{method: http.MethodPut, path: "/routes/{id}/stops", id: "ReorderRoute", summary: "reorder the stops",
+		request: reorderRequest{}, response: routeJSON{}},
+	{method: http.MethodDelete, path: "/routes/{id}/stops/{number}", id: "RemoveRouteStop", summary: "remove a stop",
+		status: http.StatusNoContent},
+	{method: http.MethodPost, path: "/routes/{id}/stops/{number}/complete", id: "CompleteRouteStop",
+		summary: "deliver the parcel of a stop", response: routeJSON{}},
+	{method: http.MethodPost, path: "/orders", id: "CreateOrder", summary: "create an order",
+		request: orderRequest{}, response: orderJSON{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/orders/{id}", id: "GetOrder", summary: "get an order with its derived status",
+		response: orderJSON{}},
+	{method: http.MethodGet, path: "/orders/{id}/parcels", id: "ListOrderParcels", summary: "parcels of an order",
+		response: []parcelJSON{}},
+	{method: http.MethodPost, path: "/orders/{id}/parcels", id: "AddOrderParcel", summary: "add a parcel to an order",
+		request: orderParcelRequest{}, response: orderJSON{}},
+	{method: http.MethodDelete, path: "/orders/{id}/parcels/{number}", id: "RemoveOrderParcel",
+		summary: "take a parcel out of an order", status: http.StatusNoContent},
+	{method: http.MethodGet, path: "/claims", id: "ListClaims", summary: "claims in a status",
+		params:   []apiParam{{name: "status", in: "query", typ: "string", summary: "default " + ClaimOpen}},
+		response: []claimJSON{}},
+	{method: http.MethodGet, path: "/claims/{id}", id: "GetClaim", summary: "get a claim", response: claimJSON{}},
+	{method: http.MethodPost, path: "/claims/{id}/approve", id: "ApproveClaim", summary: "approve a claim",
+		request: claimApprovalRequest{}, response: claimJSON{}},
+	{method: http.MethodPost, path: "/claims/{id}/reject", id: "RejectClaim", summary: "reject a claim",
+		request: claimRejectionRequest{}, response: claimJSON{}},
+	{method: http.MethodPost, path: "/claims/{id}/pay", id: "PayClaim",
+		summary: "record the payout of an approved claim", response: claimJSON{}},
+	{method: http.MethodGet, path: "/parcel-templates", id: "ListParcelTemplates",
+		summary:  "parcel templates of a client, ordered by name",
+		params:   []apiParam{{name: "client", in: "query", typ: "integer", required: true}},
+		response: []parcelTemplateJSON{}},
+	{method: http.MethodPost, path: "/parcel-templates", id: "SaveParcelTemplate", summary: "save a parcel template",
+		request: parcelTemplateRequest{}, response: parcelTemplateJSON{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/parcel-templates/{id}", id: "GetParcelTemplate", summary: "get a parcel template",
+		response: parcelTemplateJSON{}},
+	{method: http.MethodDelete, path: "/parcel-templates/{id}", id: "DeleteParcelTemplate",
+		summary: "delete a parcel template", status: http.StatusNoContent},
+	{method: http.MethodPost, path: "/parcel-templates/{id}/parcels", id: "RegisterFromTemplate",
+		summary: "register a parcel from a template", response: parcelJSON{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/drafts", id: "ListDrafts", summary: "parcel drafts of a client, oldest first",
+		params:   []apiParam{{name: "client", in: "query", typ: "integer", required: true}},
+		response: []draftJSON{}},
+	{method: http.MethodPost, path: "/drafts", id: "SaveDraft",
+		summary: "save a draft, or schedule a registration with activate_at", request: draftRequest{},
+		response: draftJSON{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/drafts/{id}", id: "GetDraft", summary: "get a parcel draft", response: draftJSON{}},
+	{method: http.MethodPut, path: "/drafts/{id}", id: "UpdateDraft", summary: "change the parcel of a draft",
+		request: registerRequest{}, response: draftJSON{}},
+	{method: http.MethodDelete, path: "/drafts/{id}", id: "DiscardDraft", summary: "discard a parcel draft",
+		status: http.StatusNoContent},
+	{method: http.MethodPost, path: "/drafts/{id}/confirm", id: "ConfirmDraft",
+		summary: "register the parcel of a draft", response: parcelJSON{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/clients/{client}/addresses", id: "ListSavedAddresses",
+		summary: "address book of a client, ordered by label", response: []savedAddressJSON{}},
+	{method: http.MethodPost, path: "/clients/{client}/addresses", id: "SaveAddress", summary: "save an address",
+		request: savedAddressRequest{}, response: savedAddressJSON{}, status: http.StatusCreated},
+	{method: http.MethodPut, path: "/clients/{client}/addresses/{id}", id: "UpdateSavedAddress",
+		summary: "change a saved address", request: savedAddressRequest{}, response: savedAddressJSON{}},
+	{method: http.MethodDelete, path: "/clients/{client}/addresses/{id}", id: "DeleteSavedAddress",
+		summary: "delete a saved address", status: http.StatusNoContent},
+	{method: http.MethodGet, path: "/work-items", id: "ListWorkItems", summary: "ops work items",
+		params: []apiParam{
+			{name: "state", in: "query", typ: "string", summary: "default open and in progress"},
+			{name: "kind", in: "query", typ: "string"},
+			{name: "assignee", in: "query", typ: "string"},
+			{name: "parcel", in: "query", typ: "integer"},
+		},
+		response: []workItemJSON{}},
+	{method: http.MethodPost, path: "/work-items", id: "ReportWorkItem", summary: "report a work item",
+		request: workItemRequest{}, response: workItemJSON{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/work-items/{id}", id: "GetWorkItem", summary: "get a work item",
+		response: workItemJSON{}},
+	{method: http.MethodPost, path: "/work-items/{id}/assign", id: "AssignWorkItem", summary: "assign a work item",
+		request: workItemAssignRequest{}, response: workItemJSON{}},
+	{method: http.MethodPost, path: "/work-items/{id}/resolve", id: "ResolveWorkItem", summary: "close a work item",
+		request: workItemResolveRequest{}, response: workItemJSON{}},
+	{method: http.MethodGet, path: "/content-restrictions", id: "ListContentRestrictions",
+		summary: "content categories restricted by zone", response: []contentRestrictionJSON{}},
+	{method: http.MethodPost, path: "/content-restrictions", id: "AddContentRestriction",
+		summary: "restrict a content category", request: contentRestrictionRequest{},
+		response: contentRestrictionJSON{}, status: http.StatusCreated},
+	{method: http.MethodDelete, path: "/content-restrictions/{id}", id: "DeleteContentRestriction",
+		summary: "lift a content restriction", status: http.StatusNoContent},
+	{method: http.MethodPost, path: "/warehouses", id: "CreateWarehouse", summary: "create a warehouse",
+		request: warehouseRequest{}, response: warehouseJSON{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/warehouses", id: "ListWarehouses", summary: "list warehouses",
+		response: []warehouseJSON{}},
+	{method: http.MethodPost, path: "/pickup-points", id: "CreatePickupPoint", summary: "create a pickup point",
+		request: pickupPointRequest{}, response: pickupPointJSON{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/pickup-points", id: "ListPickupPoints", summary: "list pickup points",
+		response: []pickupPointJSON{}},
+	{method: http.MethodGet, path: "/pickup-points/{id}", id: "GetPickupPoint", summary: "get a pickup point",
+		response: pickupPointJSON{}},
+	{method: http.MethodGet, path: "/pickup-points/{id}/parcels", id: "ListAwaitingPickup",
+		summary: "parcels awaiting pickup at the point", response: []parcelJSON{}},
+	{method: http.MethodGet, path: "/track/{trackingCode}", id: "Track",
+		summary: "public status, history and destination city", params: []apiParam{langParam},
+		response: trackingJSON{}, public: true},
+}
+
+// openAPIDocument is an OpenAPI 3.0 document, reduced to the parts the
+// API uses.
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+	Security   []map[string][]string                   `json:"security"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema        `json:"schemas"`
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPISecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+	// Security is empty for public operations and nil for the default.
+	Security *[]map[string][]string `json:"security,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Required    bool           `json:"required,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                    `json:"required"`
+	Content  map[string]openAPIMedia `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                  `json:"description"`
+	Content     map[string]openAPIMedia `json:"content,omitempty"`
+}
+
+type openAPIMedia struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+
+	// order lists Properties in field order; JSON objects lose it, so it
+	// only serves the client generator.
+	order []string
+}
+
+// schemaRefPrefix prefixes references to component schemas.
+const schemaRefPrefix = "#/components/schemas/"
+
+// errorSchema is the component name of errorJSON, the body of every
+// error response.
+const errorSchema = "Error"
+
+// OpenAPI returns the OpenAPI document of the REST API served by
+// NewHTTPHandler. Schemas are derived from the JSON types of the HTTP
+// layer, so the document follows them as they change.
+func OpenAPI() *openAPIDocument {
+	doc := &openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: "Parcel tracker API", Version: "1.0.0"},
+		Paths:   make(map[string]map[string]*openAPIOperation),
+		Components: openAPIComponents{
+			Schemas: make(map[string]*openAPISchema),
+			SecuritySchemes: map[string]openAPISecurityScheme{
+				"bearer":  {Type: "http", Scheme: "bearer"},
+				"api_key": {Type: "apiKey", In: "header", Name: "X-API-Key"},
+			},
+		},
+		Security: []map[string][]string{{"bearer": {}}, {"api_key": {}}},
+	}
+	errorRef := schemaOf(reflect.TypeOf(errorJSON{}), doc.Components.Schemas)
+
+	for _, op := range apiOperations {
+		o := &openAPIOperation{OperationID: op.id, Summary: op.summary, Responses: make(map[string]openAPIResponse)}
+		if op.public {
+			o.Security = &[]map[string][]string{}
+		}
+
+		for _, name := range pathParams(op.path) {
+			typ := "integer"
+			if name != "number" && name != "id" && name != "client" {
+				typ = "string"
+			}
+			o.Parameters = append(o.Parameters, openAPIParameter{Name: name, In: "path", Required: true,
+				Schema: &openAPISchema{Type: typ}})
+		}
+		for _, p := range op.params {
+			o.Parameters = append(o.Parameters, openAPIParameter{Name: p.name, In: p.in, Required: p.required,
+				Description: p.summary, Schema: &openAPISchema{Type: p.typ}})
+		}
+
+		if op.request != nil {
+			o.RequestBody = &openAPIRequestBody{Required: true, Content: map[string]openAPIMedia{
+				"application/json": {Schema: schemaOf(reflect.TypeOf(op.request), doc.Components.Schemas)},
+			}}
+		}
+
+		status := op.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		res := openAPIResponse{Description: http.StatusText(status)}
+		switch op.response.(type) {
+		case nil:
+		case []byte:
+			contentType := op.contentType
+			if contentType == "" {
+				contentType = "image/png"
+			}
+			res.Content = map[string]openAPIMedia{contentType: {Schema: &openAPISchema{Type: "string", Format: "binary"}}}
+		default:
+			res.Content = map[string]openAPIMedia{
+				"application/json": {Schema: schemaOf(reflect.TypeOf(op.response), doc.Components.Schemas)},
+			}
+		}
+		o.Responses[strconv.Itoa(status)] = res
+		o.Responses["default"] = openAPIResponse{Description: "error",
+			Content: map[string]openAPIMedia{"application/json": {Schema: errorRef}}}
+
+		if doc.Paths[op.path] == nil {
+			doc.Paths[op.path] = make(map[string]*openAPIOperation)
+		}
+		doc.Paths[op.path][strings.ToLower(op.method)] = o
+	}
+	return doc
+}
+
+// pathParams returns the names of the {parameters} of path in order.
+func pathParams(path string) []string {
+	var res []string
+	for _, part := range strings.Split(path, "/") {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			res = append(res, part[1:len(part)-1])
+		}
+	}
+	return res
+}
+
+// schemaOf returns the schema of t, adding the structs it refers to to
+// components. Struct fields tagged omitempty are optional.
+func schemaOf(t reflect.Type, components map[string]*openAPISchema) *openAPISchema {
+	if t == reflect.TypeOf(time.Time{}) {
+		return &openAPISchema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := *schemaOf(t.Elem(), components)
+		s.Nullable = true
+		return &s
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &openAPISchema{Type: "string", Format: "byte"} // base64
+		}
+		return &openAPISchema{Type: "array", Items: schemaOf(t.Elem(), components)}
+	case reflect.Map:
+		return &openAPISchema{Type: "object", AdditionalProperties: schemaOf(t.Elem(), components)}
+	case reflect.Int, reflect.Int64:
+		return &openAPISchema{Type: "integer"}
+	case reflect.Float64:
+		return &openAPISchema{Type: "number"}
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case reflect.String:
+		return &openAPISchema{Type: "string"}
+	case reflect.Struct:
+	default:
+		panic("openapi: unsupported type " + t.String())
+	}
+
+	name := schemaName(t)
+	ref := &openAPISchema{Ref: schemaRefPrefix + name}
+	if _, ok := components[name]; ok {
+		return ref
+	}
+
+	s := &openAPISchema{Type: "object", Properties: make(map[string]*openAPISchema)}
+	components[name] = s // before the fields, for recursive types
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		prop, opts, _ := strings.Cut(tag, ",")
+		if prop == "" {
+			prop = f.Name
+		}
+		s.Properties[prop] = schemaOf(f.Type, components)
+		s.order = append(s.order, prop)
+		if !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, prop)
+		}
+	}
+	return ref
+}
+
+// schemaName names the component schema of a JSON type of the HTTP layer:
+// parcelJSON is "Parcel", registerRequest "RegisterRequest".
+func schemaName(t reflect.Type) string {
+	name := strings.TrimSuffix(t.Name(), "JSON")
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// openAPIDocumentHandler serves the OpenAPI document.
+func openAPIDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, OpenAPI())
+}
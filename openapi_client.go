@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+	"text/template"
+)
+
+// GenerateClient returns the source of a Go package named pkg with a
+// typed client for the operations of doc: a struct per component schema
+// and a method per operation, named after its operationId.
+func GenerateClient(doc *openAPIDocument, pkg string) ([]byte, error) {
+	g := clientGen{Package: pkg}
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		if name == errorSchema {
+			continue // the client returns *APIError instead
+		}
+		t, err := g.structType(name, doc.Components.Schemas[name])
+		if err != nil {
+			return nil, err
+		}
+		g.Types = append(g.Types, t)
+	}
+	for _, path := range sortedKeys(doc.Paths) {
+		for _, method := range sortedKeys(doc.Paths[path]) {
+			op, err := g.operation(strings.ToUpper(method), path, doc.Paths[path][method])
+			if err != nil {
+				return nil, err
+			}
+			g.Operations = append(g.Operations, op)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := clientTemplate.Execute(&buf, g); err != nil {
+		return nil, fmt.Errorf("failed to generate client: %w", err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated client: %w", err)
+	}
+	return src, nil
+}
+
+// clientGen is the model clientTemplate renders.
+type clientGen struct {
+	Package    string
+	Types      []clientType
+	Operations []clientOperation
+	// UsesTime and UsesStrconv select the imports beyond the fixed ones.
+	UsesTime    bool
+	UsesStrconv bool
+}
+
+type clientType struct {
+	Name   string
+	Fields []clientField
+}
+
+type clientField struct {
+	Name, Type, Tag string
+}
+
+type clientOperation struct {
+	Name, Method, Path, Summary string
+	// PathExpr is the Go expression of the request path.
+	PathExpr string
+	// Args are the path parameters, e.g. "number int".
+	Args   string
+	Params []clientParam
+	// Body and Result are Go types, empty for none; Result is "[]byte"
+	// for binary responses.
+	Body, Result string
+}
+
+type clientParam struct {
+	Field, Type, Name, In string
+	// Set is the condition under which the parameter is sent and Encode
+	// its value as a string.
+	Set, Encode string
+}
+
+func (g *clientGen) structType(name string, s *openAPISchema) (clientType, error) {
+	t := clientType{Name: name}
+	order := s.order
+	if order == nil {
+		order = sortedKeys(s.Properties)
+	}
+	for _, prop := range order {
+		typ, err := g.goType(s.Properties[prop])
+		if err != nil {
+			return t, fmt.Errorf("failed to generate %s.%s: %w", name, prop, err)
+		}
+		tag := prop
+		if !contains(s.Required, prop) {
+			tag += ",omitempty"
+		}
+		t.Fields = append(t.Fields, clientField{Name: goName(prop), Type: typ, Tag: fmt.Sprintf("`json:%q`", tag)})
+	}
+	return t, nil
+}
+
+// goType returns the Go type of values of schema s.
+func (g *clientGen) goType(s *openAPISchema) (string, error) {
+	var typ string
+	switch {
+	case s.Ref != "":
+		typ = strings.TrimPrefix(s.Ref, schemaRefPrefix)
+	case s.Type == "array":
+		elem, err := g.goType(s.Items)
+		if err != nil {
+			return "", err
+		}
+		typ = "[]" + elem
+	case s.Type == "object" && s.AdditionalProperties != nil:
+		elem, err := g.goType(s.AdditionalProperties)
+		if err != nil {
+			return "", err
+		}
+		typ = "map[string]" + elem
+	case s.Type == "string" && s.Format == "date-time":
+		g.UsesTime = true
+		typ = "time.Time"
+	case s.Type == "string" && (s.Format == "binary" || s.Format == "byte"):
+		typ = "[]byte"
+	case s.Type == "string":
+		typ = "string"
+	case s.Type == "integer":
+		typ = "int"
+	case s.Type == "number":
+		typ = "float64"
+	case s.Type == "boolean":
+		typ = "bool"
+	default:
+		return "", fmt.Errorf("unsupported schema %+v", *s)
+	}
+	if s.Nullable {
+		typ = "*" + typ
+	}
+	return typ, nil
+}
+
+func (g *clientGen) operation(method, path string, o *openAPIOperation) (clientOperation, error) {
+	op := clientOperation{Name: o.OperationID, Method: method, Path: path, Summary: o.Summary}
+
+	format := path
+	var args, values []string
+	for _, p := range o.Parameters {
+		typ, err := g.goType(p.Schema)
+		if err != nil {
+			return op, fmt.Errorf("failed to generate %s: %w", o.OperationID, err)
+		}
+		if p.In == "path" {
+			args = append(args, p.Name+" "+typ)
+			verb, value := "%d", p.Name
+			if typ == "string" {
+				verb, value = "%s", "url.PathEscape("+p.Name+")"
+			}
+			format = strings.Replace(format, "{"+p.Name+"}", verb, 1)
+			values = append(values, value)
+			continue
+		}
+
+		field := "params." + goName(p.Name)
+		param := clientParam{Field: goName(p.Name), Type: typ, Name: p.Name, In: p.In, Set: "true", Encode: field}
+		switch typ {
+		case "int":
+			g.UsesStrconv = true
+			param.Set, param.Encode = field+" != 0", "strconv.Itoa("+field+")"
+		case "float64":
+			g.UsesStrconv = true
+			param.Set, param.Encode = field+" != 0", "strconv.FormatFloat("+field+", 'f', -1, 64)"
+		case "bool":
+			g.UsesStrconv = true
+			param.Set, param.Encode = field, "strconv.FormatBool("+field+")"
+		default:
+			param.Set = field + ` != ""`
+		}
+		if p.Required {
+			param.Set = "true"
+		}
+		op.Params = append(op.Params, param)
+	}
+	op.Args = strings.Join(args, ", ")
+	op.PathExpr = fmt.Sprintf("%q", path)
+	if len(values) > 0 {
+		op.PathExpr = fmt.Sprintf("fmt.Sprintf(%q, %s)", format, strings.Join(values, ", "))
+	}
+
+	if o.RequestBody != nil {
+		body, err := g.goType(o.RequestBody.Content["application/json"].Schema)
+		if err != nil {
+			return op, fmt.Errorf("failed to generate %s: %w", o.OperationID, err)
+		}
+		op.Body = body
+	}
+	for _, code := range sortedKeys(o.Responses) {
+		if !strings.HasPrefix(code, "2") {
+			continue
+		}
+		for _, media := range o.Responses[code].Content {
+			result, err := g.goType(media.Schema)
+			if err != nil {
+				return op, fmt.Errorf("failed to generate %s: %w", o.OperationID, err)
+			}
+			op.Result = result
+		}
+	}
+	return op, nil
+}
+
+// goName converts a JSON or header name to an exported Go identifier:
+// "tracking_code" is TrackingCode, "id" ID, "Idempotency-Key" IdempotencyKey.
+func goName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' }) {
+		if strings.EqualFold(part, "id") {
+			b.WriteString("ID")
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+var clientTemplate = template.Must(template.New("client").Parse(`// Code generated by "go run . openapi -client"; DO NOT EDIT.
+
+// Package {{.Package}} is a typed client of the parcel tracker REST API,
+// generated from its OpenAPI document.
+package {{.Package}}
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+{{- if .UsesStrconv}}
+	"strconv"
+{{- end}}
+	"strings"
+{{- if .UsesTime}}
+	"time"
+{{- end}}
+)
+
+// Client calls the parcel tracker API.
+type Client struct {
+	// BaseURL is the address of the server, e.g. "http://localhost:8080".
+	BaseURL string
+	// APIKey, if set, is sent as a bearer token.
+	APIKey string
+	// HTTPClient sends the requests; nil means http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// APIError is an error response of the API.
+type APIError struct {
+	StatusCode int
+	// Code is the machine-readable kind of the error, e.g.
+	// "PARCEL_NOT_FOUND"; unlike Message it never changes.
+	Code    string
+	Message string
+	// Fields lists the rejected fields of a parcel that failed validation.
+	Fields []FieldError
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("parcel api: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+{{range .Types}}
+type {{.Name}} struct {
+{{- range .Fields}}
+	{{.Name}} {{.Type}} {{.Tag}}
+{{- end}}
+}
+{{end}}
+{{- range .Operations}}
+{{- if .Params}}
+// {{.Name}}Params are the query and header parameters of {{.Name}}.
+type {{.Name}}Params struct {
+{{- range .Params}}
+	{{.Field}} {{.Type}}
+{{- end}}
+}
+{{end}}
+// {{.Name}} calls {{.Method}} {{.Path}}: {{.Summary}}.
+func (c *Client) {{.Name}}(ctx context.Context{{if .Args}}, {{.Args}}{{end}}{{if .Params}}, params {{.Name}}Params{{end}}{{if .Body}}, body {{.Body}}{{end}}) ({{if .Result}}{{.Result}}, {{end}}error) {
+{{- if .Params}}
+	query, header := url.Values{}, http.Header{}
+{{- range .Params}}
+	if {{.Set}} {
+		{{if eq .In "header"}}header{{else}}query{{end}}.Set({{printf "%q" .Name}}, {{.Encode}})
+	}
+{{- end}}
+{{- else}}
+	var query url.Values
+	var header http.Header
+{{- end}}
+{{- if .Result}}
+	var res {{.Result}}
+	err := c.do(ctx, {{printf "%q" .Method}}, {{.PathExpr}}, query, header, {{if .Body}}body{{else}}nil{{end}}, &res)
+	return res, err
+{{- else}}
+	return c.do(ctx, {{printf "%q" .Method}}, {{.PathExpr}}, query, header, {{if .Body}}body{{else}}nil{{end}}, nil)
+{{- end}}
+}
+{{end}}
+// do sends a request and decodes the response into out: JSON, or the raw
+// body if out is a *[]byte. Responses other than 2xx are returned as
+// *APIError.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, header http.Header, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request body: %w", err)
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	target := strings.TrimRight(c.BaseURL, "/") + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var payload struct {
+			Error  string       ` + "`json:\"error\"`" + `
+			Code   string       ` + "`json:\"code\"`" + `
+			Fields []FieldError ` + "`json:\"fields\"`" + `
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+			payload.Error = resp.Status
+		}
+		return &APIError{StatusCode: resp.StatusCode, Code: payload.Code, Message: payload.Error, Fields: payload.Fields}
+	}
+
+	switch out := out.(type) {
+	case nil:
+		return nil
+	case *[]byte:
+		*out, err = io.ReadAll(resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+`))
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yandex-Practicum/go-db-sql-final/client"
+)
+
+// TestOpenAPIRoutes checks that every operation of the document is
+// served by NewHTTPHandler with the documented method.
+func TestOpenAPIRoutes(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service)
+
+	// check
+	for _, op := range apiOperations {
+		path := strings.NewReplacer("{number}", "1", "{parcel}", "1", "{id}", "1", "{client}", "1", "{trackingCode}", "PKG-2024-000001-0").Replace(op.path)
+		rec := doRequest(t, h, op.method, path, "{}")
+		assert.NotEqual(t, http.StatusMethodNotAllowed, rec.Code, op.id)
+		switch {
+		case rec.Code == http.StatusNoContent:
+		case op.contentType != "" && rec.Code == http.StatusOK:
+			assert.Contains(t, rec.Header().Get("Content-Type"), strings.TrimSuffix(op.contentType, "*"), op.id)
+		default:
+			assert.Contains(t, rec.Header().Get("Content-Type"), "application/json", op.id)
+		}
+	}
+}
+
+// TestOpenAPIDocument checks the schemas derived from the JSON types.
+func TestOpenAPIDocument(t *testing.T) {
+	doc := OpenAPI()
+
+	register := doc.Paths["/parcels"]["post"]
+	require.NotNil(t, register)
+	assert.Equal(t, schemaRefPrefix+"RegisterRequest", register.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Equal(t, schemaRefPrefix+"Parcel", register.Responses["201"].Content["application/json"].Schema.Ref)
+	assert.Equal(t, schemaRefPrefix+errorSchema, register.Responses["default"].Content["application/json"].Schema.Ref)
+
+	parcel := doc.Components.Schemas["Parcel"]
+	require.NotNil(t, parcel)
+	assert.Equal(t, "integer", parcel.Properties["number"].Type)
+	assert.True(t, parcel.Properties["latitude"].Nullable)
+	assert.Equal(t, "string", parcel.Properties["attributes"].AdditionalProperties.Type)
+	assert.Contains(t, parcel.Required, "tracking_code")
+	assert.NotContains(t, parcel.Required, "due_at")
+	assert.Equal(t, "date-time", doc.Components.Schemas["ScanRequest"].Properties["scanned_at"].Format)
+
+	track := doc.Paths["/track/{trackingCode}"]["get"]
+	require.NotNil(t, track.Security)
+	assert.Empty(t, *track.Security)
+	assert.Equal(t, "string", track.Parameters[0].Schema.Type)
+
+	rec := doRequest(t, NewHTTPHandler(ParcelService{}), http.MethodGet, "/openapi.json", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var served map[string]any
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&served))
+	assert.Equal(t, "3.0.3", served["openapi"])
+}
+
+// TestGeneratedFilesUpToDate fails when the HTTP layer changed without
+// running go generate.
+func TestGeneratedFilesUpToDate(t *testing.T) {
+	doc := OpenAPI()
+
+	spec, err := json.MarshalIndent(doc, "", "  ")
+	require.NoError(t, err)
+	onDisk, err := os.ReadFile("openapi.json")
+	require.NoError(t, err)
+	assert.Equal(t, string(spec)+"\n", string(onDisk), "openapi.json is stale, run go generate")
+
+	src, err := GenerateClient(doc, "client")
+	require.NoError(t, err)
+	onDisk, err = os.ReadFile("client/client.go")
+	require.NoError(t, err)
+	assert.Equal(t, string(src), string(onDisk), "client/client.go is stale, run go generate")
+}
+
+// TestClient drives the API through the generated client.
+func TestClient(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	server := httptest.NewServer(NewHTTPHandler(service, AllowAnonymous(Principal{Role: RoleAdmin})))
+	defer server.Close()
+	c := &client.Client{BaseURL: server.URL}
+	ctx := context.Background()
+
+	// register
+	parcel, err := c.RegisterParcel(ctx, client.RegisterParcelParams{IdempotencyKey: "k1"},
+		client.RegisterRequest{Client: 1000, Address: "test", WeightGrams: 500})
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusRegistered, parcel.Status)
+	again, err := c.RegisterParcel(ctx, client.RegisterParcelParams{IdempotencyKey: "k1"},
+		client.RegisterRequest{Client: 1000, Address: "test", WeightGrams: 500})
+	require.NoError(t, err)
+	assert.Equal(t, parcel.ID, again.ID)
+
+	// advance
+	_, err = c.NextStatus(ctx, parcel.ID)
+	var apiErr *client.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusConflict, apiErr.StatusCode)
+
+	_, err = c.SetPayment(ctx, parcel.ID, client.PaymentRequest{Status: PaymentPaid})
+	require.NoError(t, err)
+	parcel, err = c.NextStatus(ctx, parcel.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusSent, parcel.Status)
+
+	// check
+	history, err := c.GetHistory(ctx, parcel.ID)
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	parcels, err := c.ListParcels(ctx, client.ListParcelsParams{Client: 1000, Status: ParcelStatusSent})
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	assert.Equal(t, 500, parcels[0].WeightGrams)
+
+	label, err := c.GetLabel(ctx, parcel.ID)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(label), "\x89PNG"))
+
+	tracking, err := c.Track(ctx, parcel.TrackingCode, client.TrackParams{Lang: "ru"})
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusSent, tracking.Status)
+	assert.Equal(t, "Отправлена", tracking.StatusLabel)
+
+	_, err = c.GetParcel(ctx, "01ARZ3NDEKTSV4RRFFQ69G5FAV")
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+}
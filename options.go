@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrInvalidOption indicates that an Options field holds a value
+// SQLite does not accept for the corresponding PRAGMA.
+var ErrInvalidOption = errors.New("invalid store option")
+
+// Options configures the SQLite connection settings applied when a
+// ParcelStore is constructed with NewParcelStoreWithOptions.
+//
+// Zero values leave the corresponding setting untouched, so
+// Options{} behaves exactly like NewParcelStore.
+type Options struct {
+	// JournalMode is the value for PRAGMA journal_mode,
+	// e.g. "WAL" or "DELETE".
+	JournalMode string
+	// BusyTimeout is how long a connection waits on a locked
+	// database before failing with SQLITE_BUSY.
+	BusyTimeout time.Duration
+	// ForeignKeys enables PRAGMA foreign_keys=ON.
+	ForeignKeys bool
+	// Synchronous is the value for PRAGMA synchronous,
+	// e.g. "NORMAL" or "FULL".
+	Synchronous string
+	// QueryTimeout bounds every statement of the store; see
+	// ParcelStore.WithTimeout. It caps BusyTimeout, and unlike it also
+	// ends statements slow for other reasons than a lock.
+	QueryTimeout time.Duration
+	// TxLock is the lock a transaction takes when it begins: "deferred",
+	// "immediate" or "exclusive". A deferred transaction that reads and
+	// then writes fails with SQLITE_BUSY when another one wrote first;
+	// an immediate one takes the write lock at BEGIN and waits on the
+	// busy timeout instead. Read-only transactions stay deferred. It is
+	// a driver setting, so it only holds through DSN.
+	TxLock string
+}
+
+// DefaultOptions returns the settings recommended for a file-backed
+// tracker database: WAL journaling, a five second busy timeout,
+// enforced foreign keys, synchronous=NORMAL (safe under WAL),
+// statements timed out after DefaultQueryTimeout and transactions that
+// take the write lock when they begin.
+func DefaultOptions() Options {
+	return Options{
+		JournalMode:  "WAL",
+		BusyTimeout:  5 * time.Second,
+		ForeignKeys:  true,
+		Synchronous:  "NORMAL",
+		QueryTimeout: DefaultQueryTimeout,
+		TxLock:       "immediate",
+	}
+}
+
+var (
+	journalModes = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+	syncModes    = []string{"OFF", "NORMAL", "FULL", "EXTRA"}
+	txLocks      = []string{"DEFERRED", "IMMEDIATE", "EXCLUSIVE"}
+)
+
+// Validate reports whether every non-zero field holds a value
+// accepted by SQLite. PRAGMA statements cannot be parameterised,
+// so values are checked against a fixed list before use.
+func (o Options) Validate() error {
+	if o.JournalMode != "" && !containsFold(journalModes, o.JournalMode) {
+		return fmt.Errorf("%w: journal mode %q", ErrInvalidOption, o.JournalMode)
+	}
+	if o.Synchronous != "" && !containsFold(syncModes, o.Synchronous) {
+		return fmt.Errorf("%w: synchronous %q", ErrInvalidOption, o.Synchronous)
+	}
+	if o.TxLock != "" && !containsFold(txLocks, o.TxLock) {
+		return fmt.Errorf("%w: transaction lock %q", ErrInvalidOption, o.TxLock)
+	}
+	if o.BusyTimeout < 0 {
+		return fmt.Errorf("%w: negative busy timeout %s", ErrInvalidOption, o.BusyTimeout)
+	}
+	if o.QueryTimeout < 0 {
+		return fmt.Errorf("%w: negative query timeout %s", ErrInvalidOption, o.QueryTimeout)
+	}
+	return nil
+}
+
+// pragmas returns the PRAGMA assignments described by the options,
+// in the form "name=value", in a stable order.
+func (o Options) pragmas() []string {
+	var res []string
+	if o.JournalMode != "" {
+		res = append(res, "journal_mode="+strings.ToUpper(o.JournalMode))
+	}
+	if busy := o.busyTimeout(); busy > 0 {
+		res = append(res, fmt.Sprintf("busy_timeout=%d", busy.Milliseconds()))
+	}
+	if o.ForeignKeys {
+		res = append(res, "foreign_keys=ON")
+	}
+	if o.Synchronous != "" {
+		res = append(res, "synchronous="+strings.ToUpper(o.Synchronous))
+	}
+	return res
+}
+
+// busyTimeout returns BusyTimeout capped at QueryTimeout: SQLite does not
+// interrupt a statement waiting for a lock, so a longer busy timeout
+// would outlast the query timeout.
+func (o Options) busyTimeout() time.Duration {
+	if o.QueryTimeout > 0 && o.BusyTimeout > o.QueryTimeout {
+		return o.QueryTimeout
+	}
+	return o.BusyTimeout
+}
+
+// DSN returns a data source name for the sqlite driver that applies
+// the options to every connection opened by the pool.
+//
+// Only journal_mode is persisted in the database file; busy_timeout,
+// foreign_keys and synchronous are per-connection settings, so opening
+// the *sql.DB with this DSN is the only way to guarantee they hold for
+// all pooled connections. TxLock is passed to the driver as _txlock.
+func (o Options) DSN(path string) string {
+	pragmas := o.pragmas()
+	if len(pragmas) == 0 && o.TxLock == "" {
+		return path
+	}
+
+	q := url.Values{}
+	for _, p := range pragmas {
+		name, value, _ := strings.Cut(p, "=")
+		q.Add("_pragma", fmt.Sprintf("%s(%s)", name, value))
+	}
+	if o.TxLock != "" {
+		q.Add("_txlock", strings.ToLower(o.TxLock))
+	}
+	return "file:" + path + "?" + q.Encode()
+}
+
+// apply issues the PRAGMA statements on db. Per-connection settings
+// only reach the connection that executed them; see DSN.
+func (o Options) apply(db *sql.DB) error {
+	for _, p := range o.pragmas() {
+		if _, err := db.Exec("PRAGMA " + p); err != nil {
+			return fmt.Errorf("failed to apply pragma %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// containsFold reports whether list contains s, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
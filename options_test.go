@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewParcelStoreWithOptionsAppliesPragmas verifies that the default
+// options switch a file database to WAL and set the busy timeout.
+func TestNewParcelStoreWithOptionsAppliesPragmas(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "tracker.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// construct
+	_, err = NewParcelStoreWithOptions(db, DefaultOptions())
+	require.NoError(t, err)
+
+	// check
+	var journalMode string
+	require.NoError(t, db.QueryRow("PRAGMA journal_mode").Scan(&journalMode))
+	assert.Equal(t, "wal", strings.ToLower(journalMode))
+
+	var busyTimeout int
+	require.NoError(t, db.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout))
+	assert.Equal(t, 5000, busyTimeout)
+
+	var foreignKeys int
+	require.NoError(t, db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys))
+	assert.Equal(t, 1, foreignKeys)
+}
+
+// TestNewParcelStoreWithOptionsWhenInvalid ensures that values outside
+// the accepted PRAGMA vocabulary are rejected before reaching SQLite.
+func TestNewParcelStoreWithOptionsWhenInvalid(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+
+	invalid := []Options{
+		{JournalMode: "WAL; DROP TABLE parcel"},
+		{Synchronous: "sometimes"},
+		{BusyTimeout: -time.Second},
+		{QueryTimeout: -time.Second},
+		{TxLock: "later"},
+	}
+
+	// construct
+	for _, opts := range invalid {
+		_, err := NewParcelStoreWithOptions(db, opts)
+		require.ErrorIs(t, err, ErrInvalidOption)
+	}
+}
+
+// TestOptionsDSN verifies that pragmas encoded in the DSN reach every
+// pooled connection, not only the first one.
+func TestOptionsDSN(t *testing.T) {
+	// prepare
+	opts := Options{ForeignKeys: true, BusyTimeout: time.Second}
+	db, err := sql.Open("sqlite", opts.DSN(filepath.Join(t.TempDir(), "tracker.db")))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// hold one connection so the next query opens another
+	conn, err := db.Conn(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// check
+	var foreignKeys, busyTimeout int
+	require.NoError(t, db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys))
+	require.NoError(t, db.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout))
+	assert.Equal(t, 1, foreignKeys)
+	assert.Equal(t, 1000, busyTimeout)
+}
+
+// TestOptionsTxLock verifies that transactions reading then writing in
+// parallel wait for each other instead of failing with SQLITE_BUSY.
+func TestOptionsTxLock(t *testing.T) {
+	// prepare
+	store, err := OpenParcelStore(filepath.Join(t.TempDir(), "tracker.db"), DefaultOptions())
+	require.NoError(t, err)
+	defer store.Close()
+	require.NoError(t, store.EnsureSchema(context.Background()))
+	number, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// update
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := store.InTx(func(tx ParcelStore) error {
+				if _, err := tx.Get(number); err != nil {
+					return err
+				}
+				// let the other transactions read before this one writes
+				time.Sleep(10 * time.Millisecond)
+				return tx.SetAddress(number, fmt.Sprintf("address %d", i))
+			})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	// check
+	parcel, err := store.Get(number)
+	require.NoError(t, err)
+	assert.Contains(t, parcel.Address, "address ")
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrOrderNotFound indicates that no order exists with the requested id.
+	ErrOrderNotFound = newError(CodeOrderNotFound, "order not found")
+	// ErrInvalidOrder indicates a parcel that cannot join an order because
+	// it belongs to another client.
+	ErrInvalidOrder = newError(CodeInvalidOrder, "invalid order")
+	// ErrParcelInOrder indicates that a parcel already belongs to an order.
+	ErrParcelInOrder = newError(CodeParcelInOrder, "parcel already in an order")
+)
+
+// Order groups parcels of one client shipped together, such as the boxes
+// of one purchase.
+type Order struct {
+	ID        int
+	Client    int
+	CreatedAt string
+	// Parcels are the numbers of the parcels of the order, in the order
+	// they were added.
+	Parcels []int
+	// Status is derived from the parcels; see OrderStatus.
+	Status string
+}
+
+// OrderStatus returns the status of an order made of parcels: the least
+// advanced status among them, so an order is delivered only when all of
+// its parcels are. Repacked parcels are left out, as their pieces stand
+// for them; an order with no other parcels is registered.
+func OrderStatus(parcels []Parcel) string {
+	status := ""
+	for _, p := range parcels {
+		if p.Repacked {
+			continue
+		}
+		if status == "" || statusRank(p.Status) < statusRank(status) {
+			status = p.Status
+		}
+	}
+	if status == "" {
+		return ParcelStatusRegistered
+	}
+	return status
+}
+
+// statusRank returns the position of status in parcelStatuses.
+func statusRank(status string) int {
+	for i, st := range parcelStatuses {
+		if st == status {
+			return i
+		}
+	}
+	return len(parcelStatuses)
+}
+
+// CreateOrder creates an empty order for client.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Wraps and returns any SQL error from the INSERT.
+func (s ParcelStore) CreateOrder(client int) (Order, error) {
+	o := Order{Client: client, CreatedAt: FormatTimestamp(time.Now(), DefaultTimestampPrecision),
+		Parcels: []int{}, Status: ParcelStatusRegistered}
+
+	if err := s.check(); err != nil {
+		return o, err
+	}
+
+	query := "INSERT INTO parcel_order (client, created_at) VALUES (:client, :created_at)"
+	res, err := s.conn().Exec(query, sql.Named("client", client), sql.Named("created_at", o.CreatedAt))
+	if err != nil {
+		return o, fmt.Errorf("failed to create order of client %d: %w", pii(client), err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return o, fmt.Errorf("failed to get id of order of client %d: %w", pii(client), err)
+	}
+	o.ID = int(id)
+	return o, nil
+}
+
+// GetOrder returns the order with the given id, its parcels and its
+// derived status.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrOrderNotFound (wrapped) if no such order exists.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) GetOrder(id int) (Order, error) {
+	if err := s.check(); err != nil {
+		return Order{}, err
+	}
+
+	o := Order{ID: id, Parcels: []int{}}
+	err := s.conn().QueryRow("SELECT client, created_at FROM parcel_order WHERE id = :id", sql.Named("id", id)).
+		Scan(&o.Client, &o.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return o, fmt.Errorf("failed to get order %d: %w", id, ErrOrderNotFound)
+	}
+	if err != nil {
+		return o, fmt.Errorf("failed to scan order row with id %d: %w", id, err)
+	}
+
+	parcels, err := s.GetByOrder(id)
+	if err != nil {
+		return o, err
+	}
+	for _, p := range parcels {
+		o.Parcels = append(o.Parcels, p.Number)
+	}
+	o.Status = OrderStatus(parcels)
+	return o, nil
+}
+
+// GetByOrder returns the parcels of the order, in the order they were
+// added.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty result for an unknown or empty order.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) GetByOrder(id int) ([]Parcel, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + parcelColumns + ` FROM parcel JOIN parcel_order_item ON parcel_number = number
+WHERE order_id = :order ORDER BY parcel_order_item.id`
+	return s.queryParcels(fmt.Sprintf("order %d", id), query, sql.Named("order", id))
+}
+
+// AddOrderParcel adds the parcel with the given number to the order.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrOrderNotFound (wrapped) if no such order exists.
+//   - Returns sql.ErrNoRows (wrapped) if no such parcel exists.
+//   - Returns ErrInvalidOrder (wrapped) if the parcel belongs to another
+//     client than the order.
+//   - Returns ErrParcelInOrder (wrapped) if the parcel is already in this
+//     or another order.
+//   - Returns ErrCurrencyMismatch (wrapped) if the parcel is in another
+//     currency than the parcels of the order.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) AddOrderParcel(id, number int) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	return s.InTx(func(tx ParcelStore) error {
+		o, err := tx.GetOrder(id)
+		if err != nil {
+			return err
+		}
+		p, err := tx.Get(number)
+		if err != nil {
+			return err
+		}
+		if p.Client != o.Client {
+			return fmt.Errorf("failed to add parcel %d to order %d: %w: parcel of client %d, order of client %d",
+				number, id, ErrInvalidOrder, pii(p.Client), pii(o.Client))
+		}
+		if len(o.Parcels) > 0 {
+			first, err := tx.Get(o.Parcels[0])
+			if err != nil {
+				return err
+			}
+			if p.Currency != first.Currency {
+				return fmt.Errorf("failed to add parcel %d to order %d: %w: parcel in %s, order in %s",
+					number, id, ErrCurrencyMismatch, p.Currency, first.Currency)
+			}
+		}
+		return tx.addOrderItem(id, number)
+	})
+}
+
+// RemoveOrderParcel takes the parcel with the given number out of the
+// order.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrOrderNotFound (wrapped) if the parcel is not in the order.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) RemoveOrderParcel(id, number int) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	query := "DELETE FROM parcel_order_item WHERE order_id = :order AND parcel_number = :number"
+	res, err := s.conn().Exec(query, sql.Named("order", id), sql.Named("number", number))
+	if err != nil {
+		return fmt.Errorf("failed to remove parcel %d from order %d: %w", number, id, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to remove parcel %d from order %d: %w", number, id, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("failed to remove parcel %d: %w: order %d has no such parcel", number, ErrOrderNotFound, id)
+	}
+	return nil
+}
+
+// addOrderItem puts the parcel in the order, or returns ErrParcelInOrder
+// (wrapped) if it is already in one.
+func (s ParcelStore) addOrderItem(id, number int) error {
+	other, err := s.orderOf(number)
+	if err != nil {
+		return err
+	}
+	if other != 0 {
+		return fmt.Errorf("failed to add parcel %d to order %d: %w %d", number, id, ErrParcelInOrder, other)
+	}
+
+	query := "INSERT INTO parcel_order_item (parcel_number, order_id) VALUES (:number, :order)"
+	if _, err := s.conn().Exec(query, sql.Named("number", number), sql.Named("order", id)); err != nil {
+		return fmt.Errorf("failed to add parcel %d to order %d: %w", number, id, referenceError(err))
+	}
+	return nil
+}
+
+// orderOf returns the id of the order of the parcel, 0 if it is in none.
+func (s ParcelStore) orderOf(number int) (int, error) {
+	var id int
+	err := s.conn().QueryRow("SELECT order_id FROM parcel_order_item WHERE parcel_number = :number",
+		sql.Named("number", number)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up order of parcel %d: %w", number, err)
+	}
+	return id, nil
+}
+
+// CreateOrder creates an empty order for client; see
+// ParcelStore.CreateOrder.
+func (s ParcelService) CreateOrder(client int) (Order, error) {
+	return s.store.CreateOrder(client)
+}
+
+// Order returns the order with the given id and its derived status.
+func (s ParcelService) Order(id int) (Order, error) {
+	return s.store.GetOrder(id)
+}
+
+// GetByOrder returns the parcels of the order.
+func (s ParcelService) GetByOrder(id int) ([]Parcel, error) {
+	if _, err := s.store.GetOrder(id); err != nil {
+		return nil, err
+	}
+	return s.store.GetByOrder(id)
+}
+
+// AddOrderParcel adds a parcel of the order's client to the order.
+func (s ParcelService) AddOrderParcel(id, number int) error {
+	return mapError(s.store.AddOrderParcel(id, number))
+}
+
+// RemoveOrderParcel takes a parcel out of the order.
+func (s ParcelService) RemoveOrderParcel(id, number int) error {
+	return s.store.RemoveOrderParcel(id, number)
+}
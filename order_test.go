@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOrderParcels verifies adding parcels to an order, listing them and
+// taking them out again.
+func TestOrderParcels(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for i := 0; i < 3; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+	stranger := getTestParcel()
+	stranger.Client = 2000
+	strangerID, err := store.Add(stranger)
+	require.NoError(t, err)
+
+	// create
+	order, err := store.CreateOrder(1000)
+	require.NoError(t, err)
+	other, err := store.CreateOrder(1000)
+	require.NoError(t, err)
+
+	// add
+	for i := len(numbers) - 1; i >= 0; i-- {
+		require.NoError(t, store.AddOrderParcel(order.ID, numbers[i]))
+	}
+	require.ErrorIs(t, store.AddOrderParcel(other.ID, numbers[0]), ErrParcelInOrder)
+	require.ErrorIs(t, store.AddOrderParcel(order.ID, strangerID), ErrInvalidOrder)
+	require.ErrorIs(t, store.AddOrderParcel(order.ID+100, numbers[0]), ErrOrderNotFound)
+
+	// remove
+	require.NoError(t, store.RemoveOrderParcel(order.ID, numbers[1]))
+	require.ErrorIs(t, store.RemoveOrderParcel(order.ID, numbers[1]), ErrOrderNotFound)
+
+	// check
+	parcels, err := store.GetByOrder(order.ID)
+	require.NoError(t, err)
+	require.Len(t, parcels, 2)
+	assert.Equal(t, numbers[2], parcels[0].Number)
+	assert.Equal(t, numbers[0], parcels[1].Number)
+
+	stored, err := store.GetOrder(order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int{numbers[2], numbers[0]}, stored.Parcels)
+	assert.Equal(t, ParcelStatusRegistered, stored.Status)
+
+	require.NoError(t, store.Delete(numbers[0]))
+	stored, err = store.GetOrder(order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int{numbers[2]}, stored.Parcels)
+}
+
+// TestOrderStatus checks that an order is delivered only when all of its
+// parcels are.
+func TestOrderStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []string
+		want     string
+	}{
+		{"empty", nil, ParcelStatusRegistered},
+		{"one registered", []string{ParcelStatusDelivered, ParcelStatusRegistered, ParcelStatusSent}, ParcelStatusRegistered},
+		{"some sent", []string{ParcelStatusDelivered, ParcelStatusSent}, ParcelStatusSent},
+		{"all delivered", []string{ParcelStatusDelivered, ParcelStatusDelivered}, ParcelStatusDelivered},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var parcels []Parcel
+			for _, status := range tt.statuses {
+				parcels = append(parcels, Parcel{Status: status})
+			}
+			assert.Equal(t, tt.want, OrderStatus(parcels))
+		})
+	}
+
+	repacked := []Parcel{{Status: ParcelStatusRegistered, Repacked: true}, {Status: ParcelStatusDelivered}}
+	assert.Equal(t, ParcelStatusDelivered, OrderStatus(repacked))
+}
+
+// TestOrderSplit checks that the pieces of a split parcel join its order.
+func TestOrderSplit(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	parcel, err := service.Register(1000, "test")
+	require.NoError(t, err)
+	order, err := service.CreateOrder(1000)
+	require.NoError(t, err)
+	require.NoError(t, service.AddOrderParcel(order.ID, parcel.Number))
+
+	// split
+	pieces, err := service.Split(parcel.Number, 2)
+	require.NoError(t, err)
+
+	// check
+	stored, err := service.Order(order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int{parcel.Number, pieces[0].Number, pieces[1].Number}, stored.Parcels)
+	assert.Equal(t, ParcelStatusRegistered, stored.Status)
+
+	merged, err := service.Merge([]int{pieces[0].Number, pieces[1].Number})
+	require.NoError(t, err)
+	stored, err = service.Order(order.ID)
+	require.NoError(t, err)
+	assert.Contains(t, stored.Parcels, merged.Number)
+}
+
+// TestOrderHTTP checks /orders and its parcels, and that clients see only
+// their own orders.
+func TestOrderHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	parcel, err := service.Register(1000, "test")
+	require.NoError(t, err)
+	h := NewHTTPHandler(service)
+
+	// check
+	rec := doRequest(t, h, http.MethodPost, "/orders", `{"client": 1000}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var order orderJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&order))
+	assert.Equal(t, fmt.Sprintf("/orders/%d", order.ID), rec.Header().Get("Location"))
+
+	path := fmt.Sprintf("/orders/%d/parcels", order.ID)
+	rec = doRequest(t, h, http.MethodPost, path, fmt.Sprintf(`{"parcel": %d}`, parcel.Number))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&order))
+	assert.Equal(t, []int{parcel.Number}, order.Parcels)
+	assert.Equal(t, ParcelStatusRegistered, order.Status)
+
+	rec = doRequest(t, h, http.MethodGet, path, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var parcels []parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&parcels))
+	require.Len(t, parcels, 1)
+
+	assert.Equal(t, http.StatusConflict,
+		doRequest(t, h, http.MethodPost, path, fmt.Sprintf(`{"parcel": %d}`, parcel.Number)).Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodGet, "/orders/999", "").Code)
+	assert.Equal(t, http.StatusNoContent,
+		doRequest(t, h, http.MethodDelete, fmt.Sprintf("%s/%d", path, parcel.Number), "").Code)
+
+	client := NewAuthorizedService(service, Principal{Role: RoleClient, Client: 2000})
+	_, err = client.Order(order.ID)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = client.CreateOrder(1000)
+	assert.ErrorIs(t, err, ErrForbidden)
+}
@@ -4,16 +4,20 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 )
 
 var (
 	// ErrNoDBConnection indicates that the store has not been
 	// initialised with a valid *sql.DB connection.
 	ErrNoDBConnection = errors.New("no database connection")
+	// ErrStoreClosed indicates that the store has been shut down
+	// with Close and can no longer serve requests.
+	ErrStoreClosed = errors.New("parcel store is closed")
 
 	// Business logic errors
-	ErrNewStatusUnrecognised = errors.New("unrecognised new status")
-	ErrRequireRegistered     = errors.New("requires registered status")
+	ErrNewStatusUnrecognised = newError(CodeUnknownStatus, "unrecognised new status")
+	ErrRequireRegistered     = newError(CodeRequiresRegistered, "requires registered status")
 )
 
 // ParcelStore wraps a *sql.DB handle and provides higher–level
@@ -21,9 +25,36 @@ var (
 //
 // Exported methods on ParcelStore check for a nil database connection
 // before executing queries and return ErrNoDBConnection if
-// the store has not been properly initialised.
+// the store has not been properly initialised, or ErrStoreClosed
+// once Close has been called.
+//
+// ParcelStore is passed by value; copies share the same underlying
+// state, so closing one copy closes them all.
 type ParcelStore struct {
-	db *sql.DB
+	db    *sql.DB
+	tx    *sql.Tx
+	state *storeState
+	attrs map[string]AttrDef
+	// addresses, if set, validates and normalises addresses on write.
+	addresses AddressValidator
+	// geocoder, if set, resolves the coordinates of addresses on write.
+	geocoder Geocoder
+	// addressPolicy decides which parcels SetAddress may redirect.
+	addressPolicy AddressChangePolicy
+	// keys, if set, encrypts addresses and phones; see WithFieldEncryption.
+	keys KeyProvider
+	// cache, if set, serves Get and GetByClient; see WithCache.
+	cache Cache
+	// touched collects the cache keys invalidated inside a transaction,
+	// to invalidate them again when it ends.
+	touched *[]CacheKey
+	// timeout, if positive, bounds every statement; see WithTimeout.
+	timeout time.Duration
+	// actor, if set, is recorded with every change; see WithActor.
+	actor Actor
+	// recorded is the actor in mutation_actor for the transaction the
+	// store is bound to.
+	recorded *string
 }
 
 // Add inserts a new parcel record into the database using the values
@@ -31,33 +62,206 @@ type ParcelStore struct {
 //
 // Behavior:
 //   - Returns ErrNoDBConnection if the store has not been initialised.
-//   - Returns ErrNewStatusUnrecognised if the status is not one of
-//     ("registered", "sent", "delivered").
-//   - Inserts a new row into the "parcel" table with the given values.
+//   - Returns a *ValidationError (wrapped) listing the rejected fields if
+//     p.Validate fails; it matches the sentinel of each field with
+//     errors.Is, such as ErrNewStatusUnrecognised for an unknown status.
+//   - Returns ErrInvalidAttribute (wrapped) if an attribute is not
+//     registered with WithAttributes or fails its validation.
+//   - Inserts a new row into the "parcel" table with the given values and
+//     the next value of the creation sequence, which orders parcels sharing
+//     the same created_at.
+//   - Assigns a tracking code (see NewTrackingCode) unless p already has one.
+//   - Assigns the next reference number of the client (see
+//     Parcel.ClientRef), ignoring any ClientRef p has.
+//   - Assigns a public ID (see NewPublicID) unless p already has one;
+//     returns ErrInvalidPublicID (wrapped) if that is not a ULID.
+//   - Stores SentAt, DeliveredAt and EstimatedDeliveryAt as given, e.g.
+//     those of a parcel being restored; SetStatus sets the first two
+//     otherwise.
+//   - Starts the address history of the parcel (see GetAddressHistory).
+//   - If p has a PickupPoint, stores the address of the point instead of
+//     p.Address; returns ErrPickupPointNotFound or ErrPickupPointFull
+//     (wrapped) if the point does not exist or has no free slot.
+//   - Returns ErrServiceClassUnrecognised (wrapped) for an unknown
+//     service class; an empty one is stored as ServiceStandard.
+//   - Returns ErrInvalidRecipient (wrapped) if the recipient is incomplete
+//     or its phone is not a valid number; the phone is stored normalised,
+//     read in the national format of the destination of an international
+//     parcel (see NormalisePhoneIn).
+//   - Returns ErrContentCategoryUnrecognised (wrapped) for an unknown
+//     content category; contents are stored sorted and without repeats.
+//   - Returns ErrInvalidCustoms (wrapped) for an international parcel
+//     without a country, a country that is not an ISO 3166-1 alpha-2
+//     code, an invalid HS code, or a customs declaration on a domestic
+//     parcel.
 //   - Returns the generated parcel number on success.
-//   - Wraps and returns any SQL errors from INSERT or ID retrieval.
+//   - If p has an IdempotencyKey already used by the same client, inserts
+//     nothing and returns the number of the parcel added with it.
+//   - Wraps and returns any SQL errors from INSERT or ID retrieval; the
+//     insert is rolled back if the tracking code cannot be stored.
 func (s ParcelStore) Add(p Parcel) (int, error) {
-	if s.db == nil {
-		return 0, ErrNoDBConnection
+	if err := s.check(); err != nil {
+		return 0, err
 	}
 
-	if p.Status != ParcelStatusDelivered && p.Status != ParcelStatusRegistered && p.Status != ParcelStatusSent {
-		return 0, fmt.Errorf("failed to add parcel for client %d: %w %q", p.Client, ErrNewStatusUnrecognised, p.Status)
+	if err := p.Validate(); err != nil {
+		return 0, fmt.Errorf("failed to add parcel for client %d: %w", pii(p.Client), err)
 	}
 
-	query := `INSERT INTO parcel (client, status, address, created_at)
-VALUES (:client, :status, :address, :created_at)`
-	res, err := s.db.Exec(query, sql.Named("client", p.Client), sql.Named("status", p.Status),
-		sql.Named("address", p.Address), sql.Named("created_at", p.CreatedAt))
+	if p.PickupPoint != 0 {
+		point, err := s.GetPickupPoint(p.PickupPoint)
+		if err != nil {
+			return 0, fmt.Errorf("failed to add parcel for client %d: %w", pii(p.Client), err)
+		}
+		p.Address = point.Address
+	}
+	address, err := s.validateAddress(p.Address)
 	if err != nil {
-		return 0, fmt.Errorf("failed to add parcel for client %d: %w", p.Client, err)
+		return 0, fmt.Errorf("failed to add parcel for client %d: %w", pii(p.Client), err)
 	}
+	p.Address = address
+	if p.Coordinates == nil {
+		p.Coordinates, err = s.geocode(p.Address)
+		if err != nil {
+			return 0, fmt.Errorf("failed to add parcel for client %d: %w", pii(p.Client), err)
+		}
+	}
+	latitude, longitude := nullCoordinates(p.Coordinates)
 
-	id, err := res.LastInsertId()
+	if p.Payment == "" {
+		p.Payment = PaymentUnpaid
+	}
+	if p.ServiceClass == "" {
+		p.ServiceClass = ServiceStandard
+	}
+	if p.Currency, err = NormaliseCurrency(p.Currency); err != nil {
+		return 0, fmt.Errorf("failed to add parcel for client %d: %w", pii(p.Client), err)
+	}
+	if p.Recipient, err = p.Recipient.normalise(p.phoneCountry()); err != nil {
+		return 0, fmt.Errorf("failed to add parcel for client %d: %w", pii(p.Client), err)
+	}
+	if p.Contents, err = normaliseContents(p.Contents); err != nil {
+		return 0, fmt.Errorf("failed to add parcel for client %d: %w", pii(p.Client), err)
+	}
+	if p, err = normaliseCustoms(p); err != nil {
+		return 0, fmt.Errorf("failed to add parcel for client %d: %w", pii(p.Client), err)
+	}
+	for key, value := range p.Attributes {
+		if err := s.validateAttr(key, value); err != nil {
+			return 0, fmt.Errorf("failed to add parcel for client %d: %w", pii(p.Client), err)
+		}
+	}
+	attributes, err := encodeAttributes(p.Attributes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode attributes of parcel for client %d: %w", pii(p.Client), err)
+	}
+	if p.PublicID == "" {
+		p.PublicID, err = NewPublicID(time.Now())
+	} else {
+		p.PublicID, err = ParsePublicID(p.PublicID)
+	}
 	if err != nil {
-		return 0, fmt.Errorf("failed to get id of added parcel for client %d: %w", p.Client, err)
+		return 0, fmt.Errorf("failed to add parcel for client %d: %w", pii(p.Client), err)
 	}
-	return int(id), nil
+	sealed, err := s.sealParcel(p)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add parcel for client %d: %w", pii(p.Client), err)
+	}
+
+	var id int
+	err = s.InTx(func(tx ParcelStore) error {
+		tx.invalidateClient(p.Client)
+		if p.IdempotencyKey != "" {
+			existing, err := tx.getByIdempotencyKey(p.Client, p.IdempotencyKey)
+			if err == nil {
+				id = existing.Number
+				return nil
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+		if p.PickupPoint != 0 && p.Status != ParcelStatusDelivered {
+			if err := tx.checkPickupCapacity(p.PickupPoint); err != nil {
+				return fmt.Errorf("failed to add parcel for client %d: %w", pii(p.Client), err)
+			}
+		}
+
+		ref, err := tx.nextClientRef(p.Client)
+		if err != nil {
+			return err
+		}
+		number, err := tx.nextParcelNumber()
+		if err != nil {
+			return fmt.Errorf("failed to add parcel for client %d: %w", pii(p.Client), err)
+		}
+		code := p.TrackingCode
+		if code == "" {
+			code = NewTrackingCode(trackingYear(p.CreatedAt), number)
+		}
+
+		query := `INSERT INTO parcel (number, client, status, address, created_at, due_at, attributes, tracking_code,
+    weight_grams, dimensions, declared_value, zone, price, currency, payment_status, cash_on_delivery,
+    idempotency_key, duplicate_of, latitude, longitude, pickup_point, recipient_name, recipient_phone,
+    service_class, contents, international, country, customs_reference, hs_codes, client_ref, public_id,
+    sent_at, delivered_at, estimated_delivery_at, seq)
+VALUES (:number, :client, :status, :address, :created_at, :due_at, :attributes, :tracking_code,
+    :weight_grams, :dimensions, :declared_value, :zone, :price, :currency, :payment_status, :cash_on_delivery,
+    :idempotency_key, :duplicate_of, :latitude, :longitude, :pickup_point, :recipient_name, :recipient_phone,
+    :service_class, :contents, :international, :country, :customs_reference, :hs_codes, :client_ref, :public_id,
+    :sent_at, :delivered_at, :estimated_delivery_at, (SELECT COALESCE(MAX(seq), 0) + 1 FROM parcel))`
+		_, err = tx.conn().Exec(query, sql.Named("number", number), sql.Named("client", p.Client), sql.Named("status", p.Status),
+			sql.Named("address", sealed.Address), sql.Named("created_at", p.CreatedAt), sql.Named("due_at", p.DueAt),
+			sql.Named("attributes", attributes), sql.Named("tracking_code", code),
+			sql.Named("weight_grams", p.WeightGrams), sql.Named("dimensions", p.Dimensions.String()),
+			sql.Named("declared_value", p.DeclaredValue), sql.Named("zone", p.Zone), sql.Named("price", p.Price),
+			sql.Named("currency", p.Currency), sql.Named("payment_status", p.Payment), sql.Named("cash_on_delivery", p.CashOnDelivery),
+			sql.Named("idempotency_key", p.IdempotencyKey), sql.Named("duplicate_of", p.DuplicateOf),
+			sql.Named("latitude", latitude), sql.Named("longitude", longitude), sql.Named("pickup_point", p.PickupPoint),
+			sql.Named("recipient_name", p.Recipient.Name), sql.Named("recipient_phone", sealed.Recipient.Phone),
+			sql.Named("service_class", p.ServiceClass), sql.Named("contents", encodeList(p.Contents)),
+			sql.Named("international", p.International), sql.Named("country", p.Country),
+			sql.Named("customs_reference", p.CustomsReference), sql.Named("hs_codes", encodeList(p.HSCodes)),
+			sql.Named("client_ref", ref), sql.Named("public_id", p.PublicID), sql.Named("sent_at", p.SentAt),
+			sql.Named("delivered_at", p.DeliveredAt), sql.Named("estimated_delivery_at", p.EstimatedDeliveryAt))
+		if err != nil {
+			return fmt.Errorf("failed to add parcel for client %d: %w", pii(p.Client), err)
+		}
+		id = number
+		return tx.addAddressHistory(id, p.Address, p.Status, p.CreatedAt)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// nextParcelNumber returns the number the next parcel gets, so that Add
+// can store its tracking code with the insert. It must run in the
+// transaction adding the parcel; like AUTOINCREMENT, it never returns the
+// number of a deleted parcel.
+func (s ParcelStore) nextParcelNumber() (int, error) {
+	var number int
+	query := `SELECT MAX(COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'parcel'), 0),
+    COALESCE((SELECT MAX(number) FROM parcel), 0)) + 1`
+	if err := s.conn().QueryRow(query).Scan(&number); err != nil {
+		return 0, fmt.Errorf("failed to allocate parcel number: %w", err)
+	}
+	return number, nil
+}
+
+// nextClientRef allocates the next reference number of client. It must
+// run in the transaction adding the parcel, whose write lock keeps
+// concurrent adds from drawing the same number; a number is not drawn
+// again if the transaction rolls back.
+func (s ParcelStore) nextClientRef(client int) (int, error) {
+	var ref int
+	query := `INSERT INTO client_sequence (client, last_ref) VALUES (:client, 1)
+ON CONFLICT (client) DO UPDATE SET last_ref = last_ref + 1 RETURNING last_ref`
+	if err := s.conn().QueryRow(query, sql.Named("client", client)).Scan(&ref); err != nil {
+		return 0, fmt.Errorf("failed to allocate reference number for client %d: %w", pii(client), err)
+	}
+	return ref, nil
 }
 
 // Get retrieves a single parcel by its unique number (primary key).
@@ -67,24 +271,38 @@ VALUES (:client, :status, :address, :created_at)`
 //   - Executes a SELECT query against "parcel" by primary key.
 //   - Returns sql.ErrNoRows (wrapped) if no matching parcel exists.
 //   - Returns a fully populated Parcel struct on success.
+//   - Served from the cache outside transactions when one is set (see WithCache).
 //   - Wraps and returns any SQL errors from query execution or scanning.
 func (s ParcelStore) Get(number int) (Parcel, error) {
-	var p Parcel
-
-	if s.db == nil {
-		return p, ErrNoDBConnection
+	if err := s.check(); err != nil {
+		return Parcel{}, err
 	}
 
-	query := "SELECT number, client, status, address, created_at FROM parcel WHERE number = :number"
-	row := s.db.QueryRow(query, sql.Named("number", number))
-	err := row.Scan(&p.Number, &p.Client, &p.Status, &p.Address, &p.CreatedAt)
+	parcels, err := s.cached(CacheKey{ID: number}, func() ([]Parcel, error) {
+		stmt, err := s.prepare(queryGetParcel)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := s.stmtContext()
+		defer cancel()
+		p, err := scanParcel(stmt.QueryRowContext(ctx, sql.Named("number", number)))
+		err = timeoutError(ctx, err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan parcel row with number %d: %w", number, err)
+		}
+		if p, err = s.openParcel(p); err != nil {
+			return nil, err
+		}
+		return []Parcel{p}, nil
+	})
 	if err != nil {
-		return p, fmt.Errorf("failed to scan parcel row with number %d: %w", number, err)
+		return Parcel{}, err
 	}
-	return p, nil
+	return parcels[0], nil
 }
 
-// GetByClient retrieves all parcels belonging to the specified client ID.
+// GetByClient retrieves all parcels belonging to the specified client ID,
+// oldest first.
 //
 // Behavior:
 //   - Returns ErrNoDBConnection if the store is not initialised.
@@ -92,31 +310,62 @@ func (s ParcelStore) Get(number int) (Parcel, error) {
 //   - Returns an empty slice if the client has no parcels.
 //   - Wraps and returns any SQL errors from query, row scanning, or iteration.
 //   - Always closes the cursor after use.
+//   - Served from the cache outside transactions when one is set (see WithCache).
 func (s ParcelStore) GetByClient(client int) ([]Parcel, error) {
-	var res []Parcel
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	return s.cached(CacheKey{Client: true, ID: client}, func() ([]Parcel, error) {
+		query, args := selectFrom("parcel", parcelColumns).Where("client = ?", client).OrderBy("julianday(created_at)", "seq").build()
+		return s.queryParcels(fmt.Sprintf("client %d", pii(client)), query, args...)
+	})
+}
 
-	if s.db == nil {
-		return res, ErrNoDBConnection
+// GetByStatus retrieves all parcels currently in the given status,
+// oldest first.
+//
+// Behavior:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrNewStatusUnrecognised (wrapped) for an unknown status.
+//   - Returns an empty slice if no parcel has the status.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) GetByStatus(status string) ([]Parcel, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	if !knownStatus(status) {
+		return nil, fmt.Errorf("failed to get parcels by status: %w %q", ErrNewStatusUnrecognised, status)
 	}
 
-	query := "SELECT number, client, status, address, created_at FROM parcel WHERE client = :client"
-	rows, err := s.db.Query(query, sql.Named("client", client))
+	query, args := selectFrom("parcel", parcelColumns).Where("status = ?", status).OrderBy("julianday(created_at)", "seq").build()
+	return s.queryParcels(fmt.Sprintf("status %q", status), query, args...)
+}
+
+// queryParcels runs a SELECT of parcelColumns and scans every resulting
+// row; what describes the selection in error messages. The cursor is
+// always closed.
+func (s ParcelStore) queryParcels(what, query string, args ...any) ([]Parcel, error) {
+	rows, err := s.conn().Query(query, args...)
 	if err != nil {
-		return res, fmt.Errorf("failed to get cursor for result of client %d: %w", client, err)
+		return nil, fmt.Errorf("failed to get cursor for result of %s: %w", what, err)
 	}
 	defer rows.Close()
 
+	var res []Parcel
 	for rows.Next() {
-		var p Parcel
-
-		err := rows.Scan(&p.Number, &p.Client, &p.Status, &p.Address, &p.CreatedAt)
+		p, err := scanParcel(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan one of parcel rows for client %d: %w", client, err)
+			return nil, fmt.Errorf("failed to scan one of parcel rows for %s: %w", what, err)
+		}
+		if p, err = s.openParcel(p); err != nil {
+			return nil, fmt.Errorf("failed to read parcel rows for %s: %w", what, err)
 		}
 		res = append(res, p)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("failed to iterate parcel rows for client %d: %w", client, err)
+		return nil, fmt.Errorf("failed to iterate parcel rows for %s: %w", what, err)
 	}
 	return res, nil
 }
@@ -128,19 +377,32 @@ func (s ParcelStore) GetByClient(client int) ([]Parcel, error) {
 //     ErrNoDBConnection is returned.
 //   - If the supplied status is not recognised, ErrNewStatusUnrecognised
 //     is returned (wrapped with context).
+//   - Sets SentAt or DeliveredAt to now the first time the parcel is sent
+//     or delivered; later moves leave them.
 //   - On any database execution failure, the underlying error is wrapped
 //     with context.
 func (s ParcelStore) SetStatus(number int, status string) error {
-	if s.db == nil {
-		return ErrNoDBConnection
+	return s.setStatusAt(number, status, FormatTimestamp(time.Now(), DefaultTimestampPrecision))
+}
+
+// setStatusAt is SetStatus at the given time, which callers also record
+// in the status history so both agree.
+func (s ParcelStore) setStatusAt(number int, status, at string) error {
+	if err := s.check(); err != nil {
+		return err
 	}
 
-	if status != ParcelStatusDelivered && status != ParcelStatusRegistered && status != ParcelStatusSent {
+	if !knownStatus(status) {
 		return fmt.Errorf("failed to update status: %w %q for parcel with number %d", ErrNewStatusUnrecognised, status, number)
 	}
 
-	query := "UPDATE parcel SET status = :status WHERE number = :number"
-	_, err := s.db.Exec(query, sql.Named("status", status), sql.Named("number", number))
+	s.invalidateParcel(number)
+	query := `UPDATE parcel SET status = :status,
+    sent_at = CASE WHEN :status = :sent AND sent_at = '' THEN :at ELSE sent_at END,
+    delivered_at = CASE WHEN :status = :delivered AND delivered_at = '' THEN :at ELSE delivered_at END
+WHERE number = :number`
+	_, err := s.conn().Exec(query, sql.Named("status", status), sql.Named("number", number), sql.Named("at", at),
+		sql.Named("sent", ParcelStatusSent), sql.Named("delivered", ParcelStatusDelivered))
 	if err != nil {
 		return fmt.Errorf("failed to update status to %q for parcel with number %d: %w", status, number, err)
 	}
@@ -149,38 +411,113 @@ func (s ParcelStore) SetStatus(number int, status string) error {
 
 // SetAddress updates the delivery address of a parcel identified by its number.
 //
-// The update is only permitted if the parcel’s current status is `registered`.
-// Attempting to update the address after the parcel has been sent or delivered
-// results in an error.
+// The update is only permitted if the parcel’s current status is `registered`,
+// or also `sent` if the address change policy allows changes after dispatch,
+// or in any status but `delivered` within the window of the policy after
+// registration (see WithAddressChangePolicy). Attempting to update the
+// address otherwise results in an error.
 //
 // Behaviour:
 //   - If the store has not been initialised with a database connection,
 //     ErrNoDBConnection is returned.
-//   - If the stored status is not `registered`, ErrRequireRegistered is returned
-//     (wrapped with context).
+//   - If the policy does not allow changes in the stored status,
+//     ErrRequireRegistered is returned (wrapped with context). The status
+//     is checked again in the transaction of the update, so a concurrent
+//     status change cannot bypass the policy.
+//   - The new address is added to the address history of the parcel (see
+//     GetAddressHistory) in the same transaction as the update.
+//   - A change after dispatch is recorded in the "address_changes" audit
+//     table in the same transaction as the update (see ListAddressChanges).
+//   - If the address validator (see WithAddressValidator) rejects the address,
+//     its error is returned (wrapped); otherwise the normalised address is stored.
+//   - Replaces the coordinates with those of the new address as found by the
+//     geocoder (see WithGeocoder), or clears them; wraps any geocoding error.
+//   - Clears the pickup point: the parcel is delivered to the new address.
 //   - On database execution failure, the underlying error is wrapped with context.
 func (s ParcelStore) SetAddress(number int, address string) error {
-	if s.db == nil {
-		return ErrNoDBConnection
+	if err := s.check(); err != nil {
+		return err
 	}
 
-	storedStatus, err := s.getStatus(number)
-	if err != nil {
+	// checked before validating and geocoding, which may be remote calls,
+	// and again against the row updated
+	if _, err := s.addressChangeStatus(number); err != nil {
 		return err
 	}
-	if storedStatus != ParcelStatusRegistered {
-		return fmt.Errorf("failed to update address: %w (parcel %d has status %q)", ErrRequireRegistered, number, storedStatus)
+	address, err := s.validateAddress(address)
+	if err != nil {
+		return fmt.Errorf("failed to update address for parcel with number %d: %w", number, err)
 	}
-
-	queryUpdate := "UPDATE parcel SET address = :address WHERE number = :number"
-	_, err = s.db.Exec(queryUpdate, sql.Named("address", address), sql.Named("number", number))
+	coordinates, err := s.geocode(address)
 	if err != nil {
 		return fmt.Errorf("failed to update address for parcel with number %d: %w", number, err)
 	}
-	return nil
+	latitude, longitude := nullCoordinates(coordinates)
+
+	return s.InTx(func(tx ParcelStore) error {
+		storedStatus, err := tx.addressChangeStatus(number)
+		if err != nil {
+			return err
+		}
+		var oldAddress string
+		if storedStatus != ParcelStatusRegistered {
+			query := "SELECT address FROM parcel WHERE number = :number"
+			if err := tx.conn().QueryRow(query, sql.Named("number", number)).Scan(&oldAddress); err != nil {
+				return fmt.Errorf("failed to get address of parcel with number %d: %w", number, err)
+			}
+			if oldAddress, err = tx.open(oldAddress, purposeAddress); err != nil {
+				return fmt.Errorf("failed to get address of parcel with number %d: %w", number, err)
+			}
+		}
+		sealed, err := tx.sealAddress(address)
+		if err != nil {
+			return fmt.Errorf("failed to update address for parcel with number %d: %w", number, err)
+		}
+
+		tx.invalidateParcel(number)
+		queryUpdate := `UPDATE parcel SET address = :address, latitude = :latitude, longitude = :longitude, pickup_point = 0
+WHERE number = :number`
+		_, err = tx.conn().Exec(queryUpdate, sql.Named("address", sealed), sql.Named("latitude", latitude),
+			sql.Named("longitude", longitude), sql.Named("number", number))
+		if err != nil {
+			return fmt.Errorf("failed to update address for parcel with number %d: %w", number, err)
+		}
+
+		now := FormatTimestamp(time.Now(), DefaultTimestampPrecision)
+		if err := tx.addAddressHistory(number, address, storedStatus, now); err != nil {
+			return err
+		}
+		if storedStatus == ParcelStatusRegistered {
+			return nil
+		}
+		return tx.addAddressChange(AddressChange{Number: number, Status: storedStatus, OldAddress: oldAddress,
+			NewAddress: address})
+	})
 }
 
-// Delete removes a parcel identified by its number from the database.
+// addressChangeStatus returns the status of the parcel, or
+// ErrRequireRegistered (wrapped) if the address change policy does not
+// allow changing its address now.
+func (s ParcelStore) addressChangeStatus(number int) (string, error) {
+	storedStatus, err := s.getStatus(number)
+	if err != nil {
+		return "", err
+	}
+	allowed, err := s.addressPolicy.allows(storedStatus, func(window time.Duration) (bool, error) {
+		return s.inAddressChangeWindow(number, time.Now(), window)
+	})
+	if err != nil {
+		return "", err
+	}
+	if !allowed {
+		return "", fmt.Errorf("failed to update address: %w (parcel %d has status %q)", ErrRequireRegistered, number, storedStatus)
+	}
+	return storedStatus, nil
+}
+
+// Delete removes a parcel identified by its number from the database,
+// together with its status history, location log, scan events, comments,
+// address history and split or merge links.
 //
 // Deletion is only permitted if the parcel’s current status is `registered`.
 // Attempting to delete a parcel that has already been sent or delivered
@@ -190,27 +527,84 @@ func (s ParcelStore) SetAddress(number int, address string) error {
 //   - If the store has not been initialised with a database connection,
 //     ErrNoDBConnection is returned.
 //   - If the stored status is not `registered`, ErrRequireRegistered is returned
-//     (wrapped with context).
+//     (wrapped with context). The status is read in the transaction that
+//     deletes, so a parcel sent meanwhile is never deleted.
 //   - On database execution failure, the underlying error is wrapped with context.
 func (s ParcelStore) Delete(number int) error {
-	if s.db == nil {
-		return ErrNoDBConnection
-	}
-
-	storedStatus, err := s.getStatus(number)
-	if err != nil {
+	if err := s.check(); err != nil {
 		return err
 	}
-	if storedStatus != ParcelStatusRegistered {
-		return fmt.Errorf("failed to delete parcel: %w (parcel %d has status %q)", ErrRequireRegistered, number, storedStatus)
-	}
 
-	queryDelete := "DELETE FROM parcel WHERE number = :number"
-	_, err = s.db.Exec(queryDelete, sql.Named("number", number))
+	return s.InTx(func(tx ParcelStore) error {
+		storedStatus, err := tx.getStatus(number)
+		if err != nil {
+			return err
+		}
+		if storedStatus != ParcelStatusRegistered {
+			return fmt.Errorf("failed to delete parcel: %w (parcel %d has status %q)", ErrRequireRegistered, number, storedStatus)
+		}
+
+		tx.invalidateParcel(number)
+		queryDelete := "DELETE FROM parcel WHERE number = :number"
+		_, err = tx.conn().Exec(queryDelete, sql.Named("number", number))
+		if err != nil {
+			return fmt.Errorf("failed to delete parcel with number %d: %w", number, err)
+		}
+
+		queryHistory := "DELETE FROM parcel_status_history WHERE parcel_number = :number"
+		_, err = tx.conn().Exec(queryHistory, sql.Named("number", number))
+		if err != nil {
+			return fmt.Errorf("failed to delete history of parcel with number %d: %w", number, err)
+		}
+
+		queryLocations := "DELETE FROM parcel_location WHERE parcel_number = :number"
+		_, err = tx.conn().Exec(queryLocations, sql.Named("number", number))
+		if err != nil {
+			return fmt.Errorf("failed to delete locations of parcel with number %d: %w", number, err)
+		}
+
+		queryScans := "DELETE FROM scan_event WHERE parcel_number = :number"
+		_, err = tx.conn().Exec(queryScans, sql.Named("number", number))
+		if err != nil {
+			return fmt.Errorf("failed to delete scans of parcel with number %d: %w", number, err)
+		}
+
+		queryComments := "DELETE FROM parcel_comments WHERE parcel_number = :number"
+		_, err = tx.conn().Exec(queryComments, sql.Named("number", number))
+		if err != nil {
+			return fmt.Errorf("failed to delete comments of parcel with number %d: %w", number, err)
+		}
+
+		queryAddresses := "DELETE FROM parcel_address_history WHERE parcel_number = :number"
+		_, err = tx.conn().Exec(queryAddresses, sql.Named("number", number))
+		if err != nil {
+			return fmt.Errorf("failed to delete address history of parcel with number %d: %w", number, err)
+		}
+
+		queryLinks := "DELETE FROM parcel_link WHERE parent_number = :number OR child_number = :number"
+		_, err = tx.conn().Exec(queryLinks, sql.Named("number", number))
+		if err != nil {
+			return fmt.Errorf("failed to delete links of parcel with number %d: %w", number, err)
+		}
+
+		queryOrder := "DELETE FROM parcel_order_item WHERE parcel_number = :number"
+		_, err = tx.conn().Exec(queryOrder, sql.Named("number", number))
+		if err != nil {
+			return fmt.Errorf("failed to remove parcel with number %d from its order: %w", number, err)
+		}
+		return nil
+	})
+}
+
+// getByIdempotencyKey retrieves the parcel the client added with key.
+// Returns sql.ErrNoRows (wrapped) if there is none.
+func (s ParcelStore) getByIdempotencyKey(client int, key string) (Parcel, error) {
+	query, args := selectFrom("parcel", parcelColumns).Where("client = ?", client).Where("idempotency_key = ?", key).build()
+	p, err := scanParcel(s.conn().QueryRow(query, args...))
 	if err != nil {
-		return fmt.Errorf("failed to delete parcel with number %d: %w", number, err)
+		return p, fmt.Errorf("failed to scan parcel row of client %d with idempotency key %q: %w", pii(client), key, err)
 	}
-	return nil
+	return s.openParcel(p)
 }
 
 // getStatus retrieves the current status of a parcel by its number.
@@ -221,16 +615,177 @@ func (s ParcelStore) Delete(number int) error {
 func (s ParcelStore) getStatus(number int) (string, error) {
 	var storedStatus string
 
-	querySelect := "SELECT status FROM parcel WHERE number = :number"
-	row := s.db.QueryRow(querySelect, sql.Named("number", number))
-	err := row.Scan(&storedStatus)
+	stmt, err := s.prepare(queryGetStatus)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := s.stmtContext()
+	defer cancel()
+	err = timeoutError(ctx, stmt.QueryRowContext(ctx, sql.Named("number", number)).Scan(&storedStatus))
 	if err != nil {
 		return "", fmt.Errorf("failed to scan parcel row with number %d: %w", number, err)
 	}
 	return storedStatus, nil
 }
 
+// parcelRow is a "parcel" row as scanParcel reads it: the columns of
+// Parcel, with encoded fields in their stored form.
+type parcelRow struct {
+	Number           int             `db:"number"`
+	Client           int             `db:"client"`
+	Status           string          `db:"status"`
+	Address          string          `db:"address"`
+	CreatedAt        string          `db:"created_at"`
+	DueAt            string          `db:"due_at"`
+	SentAt           string          `db:"sent_at"`
+	DeliveredAt      string          `db:"delivered_at"`
+	ETA              string          `db:"estimated_delivery_at"`
+	Delays           int             `db:"delays"`
+	Attributes       string          `db:"attributes"`
+	TrackingCode     string          `db:"tracking_code"`
+	WeightGrams      int             `db:"weight_grams"`
+	Dimensions       string          `db:"dimensions"`
+	DeclaredValue    int             `db:"declared_value"`
+	Zone             string          `db:"zone"`
+	Price            int             `db:"price"`
+	Currency         string          `db:"currency"`
+	Payment          string          `db:"payment_status"`
+	CashOnDelivery   bool            `db:"cash_on_delivery"`
+	IdempotencyKey   string          `db:"idempotency_key"`
+	DuplicateOf      int             `db:"duplicate_of"`
+	Latitude         sql.NullFloat64 `db:"latitude"`
+	Longitude        sql.NullFloat64 `db:"longitude"`
+	PickupPoint      int             `db:"pickup_point"`
+	RecipientName    string          `db:"recipient_name"`
+	RecipientPhone   string          `db:"recipient_phone"`
+	ServiceClass     string          `db:"service_class"`
+	Repacked         bool            `db:"repacked"`
+	Contents         string          `db:"contents"`
+	International    bool            `db:"international"`
+	Country          string          `db:"country"`
+	CustomsReference string          `db:"customs_reference"`
+	HSCodes          string          `db:"hs_codes"`
+	DeliveryDay      string          `db:"delivery_day"`
+	DeliveryFrom     string          `db:"delivery_from"`
+	DeliveryTo       string          `db:"delivery_to"`
+	HoldKind         string          `db:"hold_kind"`
+	HoldReason       string          `db:"hold_reason"`
+	HoldActor        string          `db:"hold_actor"`
+	HeldAt           string          `db:"held_at"`
+	ClientRef        int             `db:"client_ref"`
+	PublicID         string          `db:"public_id"`
+}
+
+// parcelColumns lists the "parcel" columns in the order scanParcel expects.
+var parcelColumns = dbColumns(parcelRow{})
+
+// Statements run on every lookup; they are cached by prepare and warmed
+// up by Preflight.
+var (
+	queryGetParcel = "SELECT " + parcelColumns + " FROM parcel WHERE number = :number"
+	queryGetStatus = "SELECT status FROM parcel WHERE number = :number"
+)
+
+// hotQueries lists the statements prepared ahead of time by Preflight.
+var hotQueries = []string{queryGetParcel, queryGetStatus}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanParcel scans a row selected with parcelColumns into a Parcel.
+func scanParcel(row rowScanner) (Parcel, error) {
+	var r parcelRow
+	if err := scanRow(row, &r); err != nil {
+		return Parcel{}, err
+	}
+	p := Parcel{
+		Number:              r.Number,
+		Client:              r.Client,
+		Status:              r.Status,
+		Address:             r.Address,
+		CreatedAt:           r.CreatedAt,
+		DueAt:               r.DueAt,
+		SentAt:              r.SentAt,
+		DeliveredAt:         r.DeliveredAt,
+		EstimatedDeliveryAt: r.ETA,
+		Delays:              r.Delays,
+		TrackingCode:        r.TrackingCode,
+		WeightGrams:         r.WeightGrams,
+		DeclaredValue:       r.DeclaredValue,
+		Zone:                r.Zone,
+		Price:               r.Price,
+		Currency:            r.Currency,
+		Payment:             r.Payment,
+		CashOnDelivery:      r.CashOnDelivery,
+		IdempotencyKey:      r.IdempotencyKey,
+		DuplicateOf:         r.DuplicateOf,
+		PickupPoint:         r.PickupPoint,
+		Recipient:           Recipient{Name: r.RecipientName, Phone: r.RecipientPhone},
+		ServiceClass:        r.ServiceClass,
+		Contents:            decodeList(r.Contents),
+		Repacked:            r.Repacked,
+		International:       r.International,
+		Country:             r.Country,
+		CustomsReference:    r.CustomsReference,
+		HSCodes:             decodeList(r.HSCodes),
+		DeliveryWindow:      DeliveryWindow{Day: r.DeliveryDay, From: r.DeliveryFrom, To: r.DeliveryTo},
+		Hold:                Hold{Kind: r.HoldKind, Reason: r.HoldReason, Actor: r.HoldActor, PlacedAt: r.HeldAt},
+		ClientRef:           r.ClientRef,
+		PublicID:            r.PublicID,
+	}
+	if r.Latitude.Valid && r.Longitude.Valid {
+		p.Coordinates = &Coordinates{Lat: r.Latitude.Float64, Lon: r.Longitude.Float64}
+	}
+	var err error
+	p.Dimensions, err = ParseDimensions(r.Dimensions)
+	if err != nil {
+		return p, fmt.Errorf("failed to decode dimensions of parcel %d: %w", p.Number, err)
+	}
+	p.Attributes, err = decodeAttributes(r.Attributes)
+	if err != nil {
+		return p, fmt.Errorf("failed to decode attributes of parcel %d: %w", p.Number, err)
+	}
+	return p, nil
+}
+
+// parcelStatuses lists the parcel lifecycle statuses in order; domestic
+// parcels skip ParcelStatusCustomsCleared, see nextStatus.
+var parcelStatuses = []string{ParcelStatusRegistered, ParcelStatusSent, ParcelStatusCustomsCleared,
+	ParcelStatusDelivered}
+
+// knownStatus reports whether status is one of the parcel lifecycle
+// statuses ("registered", "sent", "customs_cleared", "delivered").
+func knownStatus(status string) bool {
+	switch status {
+	case ParcelStatusRegistered, ParcelStatusSent, ParcelStatusCustomsCleared, ParcelStatusDelivered:
+		return true
+	}
+	return false
+}
+
 // NewParcelStore returns a new ParcelStore bound to the provided *sql.DB.
 func NewParcelStore(db *sql.DB) ParcelStore {
-	return ParcelStore{db: db}
+	return ParcelStore{db: db, state: newStoreState()}
+}
+
+// NewParcelStoreWithOptions returns a new ParcelStore bound to the provided
+// *sql.DB after validating opts and applying its pragmas.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if db is nil.
+//   - Returns ErrInvalidOption (wrapped) if opts fails validation.
+//   - Wraps and returns any SQL error raised while applying a pragma.
+func NewParcelStoreWithOptions(db *sql.DB, opts Options) (ParcelStore, error) {
+	if db == nil {
+		return ParcelStore{}, ErrNoDBConnection
+	}
+	if err := opts.Validate(); err != nil {
+		return ParcelStore{}, err
+	}
+	if err := opts.apply(db); err != nil {
+		return ParcelStore{}, err
+	}
+	return NewParcelStore(db).WithTimeout(opts.QueryTimeout), nil
 }
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrDraftNotFound indicates that no parcel draft exists with the
+	// requested id.
+	ErrDraftNotFound = newError(CodeDraftNotFound, "parcel draft not found")
+	// ErrInvalidDraft indicates a draft without a client, an edit that
+	// changes the client of a draft, or a scheduled registration whose
+	// activation time is not in the future.
+	ErrInvalidDraft = newError(CodeInvalidDraft, "invalid parcel draft")
+)
+
+// ParcelDraft is a parcel that is not registered yet. It has no number
+// or status, and dispatch, parcel lists and reports do not see it. A
+// draft without an activation time is kept until the client confirms it
+// (see ConfirmDraft) or discards it, e.g. at checkout; one with an
+// activation time is a scheduled registration: the parcel is registered
+// once that time has come (see ActivateScheduled).
+type ParcelDraft struct {
+	ID int
+	// Parcel is what will be registered, as given to RegisterParcel.
+	Parcel Parcel
+	// ActivateAt is the RFC 3339 time the parcel is to be registered at,
+	// empty for a draft awaiting confirmation.
+	ActivateAt string
+	CreatedAt  string
+	UpdatedAt  string
+	// Attempts counts the failed activations of a scheduled registration,
+	// and LastError is the error of the last one; see ActivateScheduled.
+	Attempts  int
+	LastError string
+}
+
+// draftColumns lists the columns scanned by scanDraft, in order.
+const draftColumns = "id, data, activate_at, created_at, updated_at, attempts, last_error"
+
+// scanDraft scans a row of draftColumns, decoding and decrypting the
+// parcel.
+func (s ParcelStore) scanDraft(row interface{ Scan(...any) error }) (ParcelDraft, error) {
+	var d ParcelDraft
+	var data string
+	if err := row.Scan(&d.ID, &data, &d.ActivateAt, &d.CreatedAt, &d.UpdatedAt, &d.Attempts, &d.LastError); err != nil {
+		return d, err
+	}
+	if err := json.Unmarshal([]byte(data), &d.Parcel); err != nil {
+		return d, fmt.Errorf("failed to decode parcel draft %d: %w", d.ID, err)
+	}
+	var err error
+	d.Parcel, err = s.openParcel(d.Parcel)
+	return d, err
+}
+
+// encodeDraft returns the parcel of d encrypted (see WithFieldEncryption)
+// and encoded for the data column.
+func (s ParcelStore) encodeDraft(d ParcelDraft) (string, error) {
+	sealed, err := s.sealParcel(d.Parcel)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt parcel draft of client %d: %w", pii(d.Parcel.Client), err)
+	}
+	data, err := json.Marshal(sealed)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode parcel draft of client %d: %w", pii(d.Parcel.Client), err)
+	}
+	return string(data), nil
+}
+
+// AddDraft stores d and returns its id. The parcel is stored as it is;
+// it is validated when registered.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Wraps and returns any encryption, encoding or SQL error.
+func (s ParcelStore) AddDraft(d ParcelDraft) (int, error) {
+	if err := s.check(); err != nil {
+		return 0, err
+	}
+	data, err := s.encodeDraft(d)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `INSERT INTO parcel_draft (client, data, activate_at, created_at, updated_at)
+VALUES (:client, :data, :activate_at, :created_at, :created_at)`
+	res, err := s.conn().Exec(query, sql.Named("client", d.Parcel.Client), sql.Named("data", data),
+		sql.Named("activate_at", d.ActivateAt), sql.Named("created_at", d.CreatedAt))
+	if err != nil {
+		return 0, fmt.Errorf("failed to add parcel draft of client %d: %w", pii(d.Parcel.Client), err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get id of parcel draft of client %d: %w", pii(d.Parcel.Client), err)
+	}
+	return int(id), nil
+}
+
+// UpdateDraft replaces the parcel of the draft d.ID with d.Parcel and
+// clears its failed activations.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrDraftNotFound (wrapped) if no such draft exists.
+//   - Wraps and returns any encryption, encoding or SQL error.
+func (s ParcelStore) UpdateDraft(d ParcelDraft) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	data, err := s.encodeDraft(d)
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE parcel_draft SET data = :data, updated_at = :updated_at, attempts = 0, last_error = '' WHERE id = :id"
+	res, err := s.conn().Exec(query, sql.Named("data", data), sql.Named("updated_at", d.UpdatedAt),
+		sql.Named("id", d.ID))
+	if err != nil {
+		return fmt.Errorf("failed to update parcel draft %d: %w", d.ID, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to update parcel draft %d: %w", d.ID, err)
+	} else if n == 0 {
+		return fmt.Errorf("failed to update parcel draft %d: %w", d.ID, ErrDraftNotFound)
+	}
+	return nil
+}
+
+// GetDraft returns the parcel draft with the given id.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrDraftNotFound (wrapped) if no such draft exists.
+//   - Wraps and returns any SQL, decoding or decryption error.
+func (s ParcelStore) GetDraft(id int) (ParcelDraft, error) {
+	if err := s.check(); err != nil {
+		return ParcelDraft{}, err
+	}
+
+	query := "SELECT " + draftColumns + " FROM parcel_draft WHERE id = :id"
+	d, err := s.scanDraft(s.conn().QueryRow(query, sql.Named("id", id)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return d, fmt.Errorf("failed to get parcel draft %d: %w", id, ErrDraftNotFound)
+	}
+	if err != nil {
+		return d, fmt.Errorf("failed to scan parcel draft row with id %d: %w", id, err)
+	}
+	return d, nil
+}
+
+// ListDrafts returns the parcel drafts of client, oldest first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if the client has none.
+//   - Wraps and returns any SQL, decoding or decryption errors.
+func (s ParcelStore) ListDrafts(client int) ([]ParcelDraft, error) {
+	query, args := selectFrom("parcel_draft", draftColumns).Where("client = ?", client).OrderBy("id").build()
+	return s.queryDrafts(fmt.Sprintf("client %d", pii(client)), query, args...)
+}
+
+// DueDrafts returns the scheduled registrations whose activation time is
+// not after now, earliest first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Wraps and returns any SQL, decoding or decryption errors.
+func (s ParcelStore) DueDrafts(now time.Time) ([]ParcelDraft, error) {
+	query, args := selectFrom("parcel_draft", draftColumns).Where("activate_at != ''").
+		Where("activate_at <= ?", FormatTimestamp(now, DefaultTimestampPrecision)).OrderBy("activate_at", "id").build()
+	return s.queryDrafts("due registrations", query, args...)
+}
+
+// queryDrafts runs a query selecting draftColumns; what names the drafts
+// in errors.
+func (s ParcelStore) queryDrafts(what, query string, args ...any) ([]ParcelDraft, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.conn().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for parcel drafts of %s: %w", what, err)
+	}
+	defer rows.Close()
+
+	res := []ParcelDraft{}
+	for rows.Next() {
+		d, err := s.scanDraft(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan one of parcel draft rows of %s: %w", what, err)
+		}
+		res = append(res, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate parcel draft rows of %s: %w", what, err)
+	}
+	return res, nil
+}
+
+// DeleteDraft deletes the parcel draft with the given id.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrDraftNotFound (wrapped) if no such draft exists.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) DeleteDraft(id int) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	res, err := s.conn().Exec("DELETE FROM parcel_draft WHERE id = :id", sql.Named("id", id))
+	if err != nil {
+		return fmt.Errorf("failed to delete parcel draft %d: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to delete parcel draft %d: %w", id, err)
+	} else if n == 0 {
+		return fmt.Errorf("failed to delete parcel draft %d: %w", id, ErrDraftNotFound)
+	}
+	return nil
+}
+
+// failDraft records a failed activation of the draft id, and turns it
+// into a draft awaiting confirmation once it has failed maxAttempts
+// times.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrDraftNotFound (wrapped) if no such draft exists.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) failDraft(id int, cause error, maxAttempts int) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	query := `UPDATE parcel_draft SET attempts = attempts + 1, last_error = :last_error,
+    activate_at = CASE WHEN attempts + 1 >= :max_attempts THEN '' ELSE activate_at END
+WHERE id = :id`
+	res, err := s.conn().Exec(query, sql.Named("last_error", cause.Error()), sql.Named("max_attempts", maxAttempts),
+		sql.Named("id", id))
+	if err != nil {
+		return fmt.Errorf("failed to record failed activation of parcel draft %d: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to record failed activation of parcel draft %d: %w", id, err)
+	} else if n == 0 {
+		return fmt.Errorf("failed to record failed activation of parcel draft %d: %w", id, ErrDraftNotFound)
+	}
+	return nil
+}
+
+// SaveDraft stores draft until it is confirmed or discarded, and returns
+// the stored draft. Only its client is checked: a draft may be
+// incomplete until it is confirmed.
+//
+// Behaviour:
+//   - Returns ErrInvalidDraft (wrapped) if draft has no client.
+func (s ParcelService) SaveDraft(draft Parcel) (ParcelDraft, error) {
+	d := ParcelDraft{Parcel: draft, CreatedAt: s.timestamp(time.Now())}
+	if draft.Client <= 0 {
+		return d, fmt.Errorf("failed to save parcel draft: %w: client is required", ErrInvalidDraft)
+	}
+
+	err := s.store.InTx(func(tx ParcelStore) error {
+		id, err := tx.AddDraft(d)
+		if err != nil {
+			return err
+		}
+		d, err = tx.GetDraft(id)
+		return err
+	})
+	return d, err
+}
+
+// UpdateDraft replaces the parcel of the draft id with parcel and returns
+// the updated draft.
+//
+// Behaviour:
+//   - Returns ErrDraftNotFound (wrapped) if no such draft exists.
+//   - Returns ErrInvalidDraft (wrapped) if parcel is of another client.
+//   - The parcel of a scheduled registration is validated as by
+//     ScheduleRegistration; an invalid one is rejected with a
+//     *ValidationError.
+func (s ParcelService) UpdateDraft(id int, parcel Parcel) (ParcelDraft, error) {
+	var d ParcelDraft
+	err := s.store.InTx(func(tx ParcelStore) error {
+		var err error
+		d, err = tx.GetDraft(id)
+		if err != nil {
+			return err
+		}
+		if parcel.Client != d.Parcel.Client {
+			return fmt.Errorf("failed to update parcel draft %d: %w: client cannot change", id, ErrInvalidDraft)
+		}
+		now := time.Now()
+		if d.ActivateAt != "" {
+			if _, err := s.newParcel(parcel, now); err != nil {
+				return err
+			}
+		}
+		d.Parcel, d.UpdatedAt = parcel, s.timestamp(now)
+		if err := tx.UpdateDraft(d); err != nil {
+			return err
+		}
+		d, err = tx.GetDraft(id)
+		return err
+	})
+	return d, err
+}
+
+// ConfirmDraft registers the parcel of the draft id like RegisterParcel,
+// pricing it and publishing its events, and deletes the draft in the
+// same transaction.
+//
+// Behaviour:
+//   - Returns ErrDraftNotFound (wrapped) if no such draft exists.
+//   - If the parcel cannot be registered, e.g. because the draft is
+//     incomplete, the draft is kept so the client can fix it.
+func (s ParcelService) ConfirmDraft(id int) (Parcel, error) {
+	d, err := s.store.GetDraft(id)
+	if err != nil {
+		return Parcel{}, err
+	}
+	return s.registerDraft(d)
+}
+
+// registerDraft registers the parcel of d and deletes d in one unit of
+// work.
+func (s ParcelService) registerDraft(d ParcelDraft) (Parcel, error) {
+	var parcel Parcel
+	err := s.Work(func(u *UnitOfWork) error {
+		if err := u.Service.store.DeleteDraft(d.ID); err != nil {
+			return err
+		}
+		var err error
+		parcel, err = u.Service.RegisterParcel(d.Parcel)
+		return err
+	})
+	return parcel, err
+}
+
+// ScheduleRegistration stores draft to be registered at, and returns the
+// scheduled registration. The draft is validated as RegisterParcel would
+// now; it is registered by ActivateScheduled.
+//
+// Behaviour:
+//   - Returns ErrInvalidDraft (wrapped) if at is not in the future.
+//   - Invalid drafts are rejected with a *ValidationError.
+func (s ParcelService) ScheduleRegistration(draft Parcel, at time.Time) (ParcelDraft, error) {
+	now := time.Now()
+	d := ParcelDraft{Parcel: draft, ActivateAt: FormatTimestamp(at, DefaultTimestampPrecision),
+		CreatedAt: s.timestamp(now)}
+	if !at.After(now) {
+		return d, fmt.Errorf("failed to schedule registration for client %d: %w: %s is not in the future",
+			pii(draft.Client), ErrInvalidDraft, d.ActivateAt)
+	}
+	if _, err := s.newParcel(draft, now); err != nil {
+		return d, err
+	}
+
+	err := s.store.InTx(func(tx ParcelStore) error {
+		id, err := tx.AddDraft(d)
+		if err != nil {
+			return err
+		}
+		d, err = tx.GetDraft(id)
+		return err
+	})
+	return d, err
+}
+
+// Draft returns the parcel draft with the given id.
+func (s ParcelService) Draft(id int) (ParcelDraft, error) {
+	return s.store.GetDraft(id)
+}
+
+// Drafts returns the parcel drafts of client, oldest first.
+func (s ParcelService) Drafts(client int) ([]ParcelDraft, error) {
+	return s.store.ListDrafts(client)
+}
+
+// DiscardDraft deletes the parcel draft with the given id, e.g. an
+// abandoned checkout, cancelling the registration if it was scheduled.
+func (s ParcelService) DiscardDraft(id int) error {
+	return s.store.DeleteDraft(id)
+}
+
+// MaxActivationAttempts is how many times ActivateScheduled tries to
+// register a scheduled registration before leaving it to its client.
+const MaxActivationAttempts = 10
+
+// ActivateScheduled registers the parcels of the scheduled registrations
+// that are due, deleting each draft in the transaction of its
+// registration, and returns the registered parcels. The registrations
+// were requested in advance, so they are not checked for duplicates.
+//
+// Behaviour:
+//   - A draft that fails to register, e.g. because its pickup point is
+//     full, stays scheduled and is tried again on the next run, with the
+//     failure recorded in its Attempts and LastError; the errors of all
+//     such drafts are returned joined, after the others are registered.
+//   - A draft that has failed MaxActivationAttempts times, e.g. because
+//     its pickup point was deleted, is no longer scheduled: it is kept as
+//     a draft awaiting confirmation, for its client to fix with
+//     UpdateDraft and confirm.
+func (s ParcelService) ActivateScheduled() ([]Parcel, error) {
+	due, err := s.store.DueDrafts(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	registered := []Parcel{}
+	var errs []error
+	for _, d := range due {
+		parcel, err := s.AllowDuplicates().registerDraft(d)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to activate parcel draft %d: %w", d.ID, err))
+			if err := s.store.failDraft(d.ID, err, MaxActivationAttempts); err != nil &&
+				!errors.Is(err, ErrDraftNotFound) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		registered = append(registered, parcel)
+	}
+	return registered, errors.Join(errs...)
+}
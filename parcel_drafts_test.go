@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestScheduleRegistration checks that scheduled registrations stay out
+// of the parcel table until they are due and are then registered once.
+func TestScheduleRegistration(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	draft := Parcel{Client: 1000, Address: "test", WeightGrams: 500}
+
+	// check
+	_, err := service.ScheduleRegistration(draft, time.Now().Add(-time.Minute))
+	assert.ErrorIs(t, err, ErrInvalidDraft)
+	_, err = service.ScheduleRegistration(Parcel{Client: 1000}, time.Now().Add(time.Hour))
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+
+	later, err := service.ScheduleRegistration(draft, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, draft, later.Parcel)
+	due, err := service.ScheduleRegistration(draft, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	_, err = service.store.db.Exec("UPDATE parcel_draft SET activate_at = ? WHERE id = ?",
+		FormatTimestamp(time.Now().Add(-time.Minute), DefaultTimestampPrecision), due.ID)
+	require.NoError(t, err)
+
+	parcels, err := service.store.GetByClient(1000)
+	require.NoError(t, err)
+	assert.Empty(t, parcels)
+	drafts, err := service.Drafts(1000)
+	require.NoError(t, err)
+	assert.Len(t, drafts, 2)
+
+	*published = nil
+	registered, err := service.ActivateScheduled()
+	require.NoError(t, err)
+	require.Len(t, registered, 1)
+	assert.Equal(t, ParcelStatusRegistered, registered[0].Status)
+	assert.Equal(t, 500, registered[0].WeightGrams)
+	assert.NotEmpty(t, *published)
+	_, err = service.Draft(due.ID)
+	assert.ErrorIs(t, err, ErrDraftNotFound)
+
+	registered, err = service.ActivateScheduled()
+	require.NoError(t, err)
+	assert.Empty(t, registered)
+
+	require.NoError(t, service.DiscardDraft(later.ID))
+	assert.ErrorIs(t, service.DiscardDraft(later.ID), ErrDraftNotFound)
+	parcels, err = service.store.GetByClient(1000)
+	require.NoError(t, err)
+	assert.Len(t, parcels, 1)
+}
+
+// TestActivateScheduledFailures checks that a scheduled registration that
+// keeps failing is left to its client after MaxActivationAttempts runs.
+func TestActivateScheduledFailures(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	d, err := service.ScheduleRegistration(Parcel{Client: 1000, Address: "test"}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	_, err = service.store.db.Exec("UPDATE parcel_draft SET data = ?, activate_at = ? WHERE id = ?",
+		`{"Client": 1000}`, FormatTimestamp(time.Now().Add(-time.Minute), DefaultTimestampPrecision), d.ID)
+	require.NoError(t, err)
+
+	// check
+	for i := 1; i < MaxActivationAttempts; i++ {
+		_, err := service.ActivateScheduled()
+		require.ErrorIs(t, err, ErrInvalidAddress)
+	}
+	d, err = service.Draft(d.ID)
+	require.NoError(t, err)
+	assert.Equal(t, MaxActivationAttempts-1, d.Attempts)
+	assert.NotEmpty(t, d.LastError)
+	assert.NotEmpty(t, d.ActivateAt)
+
+	_, err = service.ActivateScheduled()
+	require.ErrorIs(t, err, ErrInvalidAddress)
+	d, err = service.Draft(d.ID)
+	require.NoError(t, err)
+	assert.Equal(t, MaxActivationAttempts, d.Attempts)
+	assert.Empty(t, d.ActivateAt)
+	registered, err := service.ActivateScheduled()
+	require.NoError(t, err)
+	assert.Empty(t, registered)
+
+	d, err = service.UpdateDraft(d.ID, Parcel{Client: 1000, Address: "test"})
+	require.NoError(t, err)
+	assert.Zero(t, d.Attempts)
+	assert.Empty(t, d.LastError)
+	_, err = service.ConfirmDraft(d.ID)
+	require.NoError(t, err)
+}
+
+// TestConfirmDraft checks that drafts may be incomplete until they are
+// confirmed, and that confirming registers the parcel once.
+func TestConfirmDraft(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+
+	// check
+	_, err := service.SaveDraft(Parcel{Address: "test"})
+	assert.ErrorIs(t, err, ErrInvalidDraft)
+	d, err := service.SaveDraft(Parcel{Client: 1000})
+	require.NoError(t, err)
+	assert.Empty(t, d.ActivateAt)
+
+	_, err = service.ConfirmDraft(d.ID)
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+	_, err = service.Draft(d.ID)
+	require.NoError(t, err)
+
+	_, err = service.UpdateDraft(d.ID, Parcel{Client: 2000, Address: "test"})
+	assert.ErrorIs(t, err, ErrInvalidDraft)
+	_, err = service.UpdateDraft(999, Parcel{Client: 1000, Address: "test"})
+	assert.ErrorIs(t, err, ErrDraftNotFound)
+	d, err = service.UpdateDraft(d.ID, Parcel{Client: 1000, Address: "test", WeightGrams: 800})
+	require.NoError(t, err)
+	assert.Equal(t, 800, d.Parcel.WeightGrams)
+	assert.NotEmpty(t, d.UpdatedAt)
+
+	*published = nil
+	parcel, err := service.ConfirmDraft(d.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusRegistered, parcel.Status)
+	assert.Equal(t, 800, parcel.WeightGrams)
+	assert.NotEmpty(t, *published)
+	_, err = service.ConfirmDraft(d.ID)
+	assert.ErrorIs(t, err, ErrDraftNotFound)
+
+	scheduled, err := service.ScheduleRegistration(Parcel{Client: 1000, Address: "test"}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	_, err = service.UpdateDraft(scheduled.ID, Parcel{Client: 1000})
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+// TestDraftsHTTP checks the /drafts endpoints and that clients only see
+// their own drafts.
+func TestDraftsHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service)
+	at := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	// check
+	rec := doRequest(t, h, http.MethodPost, "/drafts",
+		`{"parcel": {"client": 1000, "address": "test", "dimensions": "300x200x100"}, "activate_at": "`+at+`"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var d draftJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&d))
+	path := fmt.Sprintf("/drafts/%d", d.ID)
+	assert.Equal(t, path, rec.Header().Get("Location"))
+	assert.Equal(t, "300x200x100", d.Parcel.Dimensions)
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodPost, "/drafts",
+		`{"parcel": {"client": 1000, "address": "test"}, "activate_at": "tomorrow"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodPost, "/drafts",
+		`{"parcel": {"client": 1000, "address": "test"}, "activate_at": "2000-01-01T00:00:00Z"}`).Code)
+
+	rec = doRequest(t, h, http.MethodGet, "/drafts?client=1000", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var drafts []draftJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&drafts))
+	assert.Equal(t, []draftJSON{d}, drafts)
+
+	other := NewAuthorizedService(service, Principal{Role: RoleClient, Client: 2000})
+	_, err := other.Draft(d.ID)
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.ErrorIs(t, other.DiscardDraft(d.ID), ErrForbidden)
+
+	rec = doRequest(t, h, http.MethodPost, "/drafts", `{"parcel": {"client": 1000}}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var pending draftJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&pending))
+	pendingPath := fmt.Sprintf("/drafts/%d", pending.ID)
+	rec = doRequest(t, h, http.MethodPut, pendingPath, `{"client": 1000, "address": "test", "weight_grams": 700}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequest(t, h, http.MethodPost, pendingPath+"/confirm", "")
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var parcel parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&parcel))
+	assert.Equal(t, 700, parcel.WeightGrams)
+	assert.Equal(t, "/parcels/"+parcel.ID, rec.Header().Get("Location"))
+
+	assert.Equal(t, http.StatusNoContent, doRequest(t, h, http.MethodDelete, path, "").Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodGet, path, "").Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodPost, path+"/confirm", "").Code)
+}
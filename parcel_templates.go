@@ -0,0 +1,257 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxParcelTemplateNameLength is the maximum length of the name of a
+// parcel template, in characters.
+const MaxParcelTemplateNameLength = 100
+
+var (
+	// ErrParcelTemplateNotFound indicates that no parcel template exists
+	// with the requested id.
+	ErrParcelTemplateNotFound = newError(CodeParcelTemplateNotFound, "parcel template not found")
+	// ErrInvalidParcelTemplate indicates a ParcelTemplate that failed
+	// validation.
+	ErrInvalidParcelTemplate = newError(CodeInvalidParcelTemplate, "invalid parcel template")
+)
+
+// ParcelTemplate is a parcel a client ships again and again, e.g. a
+// weekly subscription box; RegisterFromTemplate registers a parcel from
+// it.
+type ParcelTemplate struct {
+	ID     int
+	Client int
+	// Name tells the templates of a client apart, e.g. "weekly box".
+	Name    string
+	Address string
+	// ServiceClass is one of the Service constants, ServiceStandard if
+	// empty on save.
+	ServiceClass string
+	// WeightGrams is the expected gross weight; 0 if unknown.
+	WeightGrams int
+	CreatedAt   string
+}
+
+// validate trims the name and address of t, defaults its service class
+// and checks its fields.
+func (t *ParcelTemplate) validate() error {
+	t.Name, t.Address = strings.TrimSpace(t.Name), strings.TrimSpace(t.Address)
+	if t.ServiceClass == "" {
+		t.ServiceClass = ServiceStandard
+	}
+	switch {
+	case t.Client <= 0:
+		return fmt.Errorf("%w: client is required", ErrInvalidParcelTemplate)
+	case t.Name == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidParcelTemplate)
+	case utf8.RuneCountInString(t.Name) > MaxParcelTemplateNameLength:
+		return fmt.Errorf("%w: name is longer than %d characters", ErrInvalidParcelTemplate, MaxParcelTemplateNameLength)
+	case t.Address == "":
+		return fmt.Errorf("%w: address is required", ErrInvalidParcelTemplate)
+	case t.WeightGrams < 0:
+		return fmt.Errorf("%w: negative weight %d g", ErrInvalidParcelTemplate, t.WeightGrams)
+	case !knownServiceClass(t.ServiceClass):
+		return fmt.Errorf("%w %q", ErrServiceClassUnrecognised, t.ServiceClass)
+	}
+	return nil
+}
+
+// parcelTemplateColumns lists the columns scanned by scanParcelTemplate,
+// in order.
+const parcelTemplateColumns = "id, client, name, address, service_class, weight_grams, created_at"
+
+// scanParcelTemplate scans a row of parcelTemplateColumns and decrypts
+// the address.
+func (s ParcelStore) scanParcelTemplate(row interface{ Scan(...any) error }) (ParcelTemplate, error) {
+	var t ParcelTemplate
+	if err := row.Scan(&t.ID, &t.Client, &t.Name, &t.Address, &t.ServiceClass, &t.WeightGrams, &t.CreatedAt); err != nil {
+		return t, err
+	}
+	var err error
+	t.Address, err = s.open(t.Address, purposeAddress)
+	return t, err
+}
+
+// AddParcelTemplate saves t and returns its id. The address passes
+// through the store's address validator like a parcel address.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidParcelTemplate (wrapped) without a client, name
+//     or address, for a name longer than MaxParcelTemplateNameLength or a
+//     negative weight, ErrServiceClassUnrecognised (wrapped) for an
+//     unknown service class, and the validator's error if it rejects the
+//     address.
+//   - Wraps and returns any SQL error from the INSERT.
+func (s ParcelStore) AddParcelTemplate(t ParcelTemplate) (int, error) {
+	if err := s.check(); err != nil {
+		return 0, err
+	}
+	if err := t.validate(); err != nil {
+		return 0, fmt.Errorf("failed to add parcel template of client %d: %w", pii(t.Client), err)
+	}
+	address, err := s.validateAddress(t.Address)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add parcel template of client %d: %w", pii(t.Client), err)
+	}
+	sealed, err := s.sealAddress(address)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add parcel template of client %d: %w", pii(t.Client), err)
+	}
+
+	query := `INSERT INTO parcel_template (client, name, address, service_class, weight_grams, created_at)
+VALUES (:client, :name, :address, :service_class, :weight_grams, :created_at)`
+	res, err := s.conn().Exec(query, sql.Named("client", t.Client), sql.Named("name", t.Name),
+		sql.Named("address", sealed), sql.Named("service_class", t.ServiceClass),
+		sql.Named("weight_grams", t.WeightGrams), sql.Named("created_at", t.CreatedAt))
+	if err != nil {
+		return 0, fmt.Errorf("failed to add parcel template of client %d: %w", pii(t.Client), err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get id of parcel template of client %d: %w", pii(t.Client), err)
+	}
+	return int(id), nil
+}
+
+// GetParcelTemplate returns the parcel template with the given id.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrParcelTemplateNotFound (wrapped) if no such template
+//     exists.
+//   - Wraps and returns any SQL or decryption error.
+func (s ParcelStore) GetParcelTemplate(id int) (ParcelTemplate, error) {
+	if err := s.check(); err != nil {
+		return ParcelTemplate{}, err
+	}
+
+	query := "SELECT " + parcelTemplateColumns + " FROM parcel_template WHERE id = :id"
+	t, err := s.scanParcelTemplate(s.conn().QueryRow(query, sql.Named("id", id)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, fmt.Errorf("failed to get parcel template %d: %w", id, ErrParcelTemplateNotFound)
+	}
+	if err != nil {
+		return t, fmt.Errorf("failed to scan parcel template row with id %d: %w", id, err)
+	}
+	return t, nil
+}
+
+// ListParcelTemplates returns the parcel templates of client, ordered by
+// name.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if the client has none.
+//   - Wraps and returns any SQL or decryption errors.
+func (s ParcelStore) ListParcelTemplates(client int) ([]ParcelTemplate, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query, args := selectFrom("parcel_template", parcelTemplateColumns).Where("client = ?", client).
+		OrderBy("name", "id").build()
+	rows, err := s.conn().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for parcel templates of client %d: %w", pii(client), err)
+	}
+	defer rows.Close()
+
+	res := []ParcelTemplate{}
+	for rows.Next() {
+		t, err := s.scanParcelTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan one of parcel template rows of client %d: %w", pii(client), err)
+		}
+		res = append(res, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate parcel template rows of client %d: %w", pii(client), err)
+	}
+	return res, nil
+}
+
+// DeleteParcelTemplate deletes the parcel template with the given id;
+// parcels registered from it are kept.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrParcelTemplateNotFound (wrapped) if no such template
+//     exists.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) DeleteParcelTemplate(id int) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	res, err := s.conn().Exec("DELETE FROM parcel_template WHERE id = :id", sql.Named("id", id))
+	if err != nil {
+		return fmt.Errorf("failed to delete parcel template %d: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to delete parcel template %d: %w", id, err)
+	} else if n == 0 {
+		return fmt.Errorf("failed to delete parcel template %d: %w", id, ErrParcelTemplateNotFound)
+	}
+	return nil
+}
+
+// SaveParcelTemplate saves t and returns it as stored; see
+// ParcelStore.AddParcelTemplate.
+func (s ParcelService) SaveParcelTemplate(t ParcelTemplate) (ParcelTemplate, error) {
+	t.CreatedAt = s.timestamp(time.Now())
+	var saved ParcelTemplate
+	err := s.store.InTx(func(tx ParcelStore) error {
+		id, err := tx.AddParcelTemplate(t)
+		if err != nil {
+			return err
+		}
+		saved, err = tx.GetParcelTemplate(id)
+		return err
+	})
+	return saved, err
+}
+
+// ParcelTemplate returns the parcel template with the given id.
+func (s ParcelService) ParcelTemplate(id int) (ParcelTemplate, error) {
+	return s.store.GetParcelTemplate(id)
+}
+
+// ParcelTemplates returns the parcel templates of client, ordered by
+// name.
+func (s ParcelService) ParcelTemplates(client int) ([]ParcelTemplate, error) {
+	return s.store.ListParcelTemplates(client)
+}
+
+// DeleteParcelTemplate deletes the parcel template with the given id.
+func (s ParcelService) DeleteParcelTemplate(id int) error {
+	return s.store.DeleteParcelTemplate(id)
+}
+
+// RegisterFromTemplate registers a parcel of the client of the template
+// to its address, with its service class and weight, like RegisterParcel.
+//
+// Behaviour:
+//   - Returns ErrParcelTemplateNotFound (wrapped) if no such template
+//     exists.
+//   - The parcel is not checked for duplicates: parcels of a template
+//     are meant to look alike.
+func (s ParcelService) RegisterFromTemplate(id int) (Parcel, error) {
+	t, err := s.store.GetParcelTemplate(id)
+	if err != nil {
+		return Parcel{}, err
+	}
+	return s.AllowDuplicates().RegisterParcel(t.draft())
+}
+
+// draft returns the parcel t describes.
+func (t ParcelTemplate) draft() Parcel {
+	return Parcel{Client: t.Client, Address: t.Address, ServiceClass: t.ServiceClass, WeightGrams: t.WeightGrams}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParcelTemplates checks the validation of parcel templates and that
+// parcels registered from one look alike without being flagged as
+// duplicates.
+func TestParcelTemplates(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	service = service.WithDuplicatePolicy(DuplicatePolicy{Window: time.Hour})
+
+	// check
+	tests := []struct {
+		name     string
+		template ParcelTemplate
+		err      error
+	}{
+		{"no client", ParcelTemplate{Name: "box", Address: "test"}, ErrInvalidParcelTemplate},
+		{"no name", ParcelTemplate{Client: 1000, Name: " ", Address: "test"}, ErrInvalidParcelTemplate},
+		{"long name", ParcelTemplate{Client: 1000, Name: strings.Repeat("x", MaxParcelTemplateNameLength+1), Address: "test"},
+			ErrInvalidParcelTemplate},
+		{"no address", ParcelTemplate{Client: 1000, Name: "box"}, ErrInvalidParcelTemplate},
+		{"negative weight", ParcelTemplate{Client: 1000, Name: "box", Address: "test", WeightGrams: -1}, ErrInvalidParcelTemplate},
+		{"unknown class", ParcelTemplate{Client: 1000, Name: "box", Address: "test", ServiceClass: "overnight"},
+			ErrServiceClassUnrecognised},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.SaveParcelTemplate(tt.template)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	box, err := service.SaveParcelTemplate(ParcelTemplate{Client: 1000, Name: " weekly box ", Address: "test",
+		ServiceClass: ServiceExpress, WeightGrams: 1500})
+	require.NoError(t, err)
+	assert.Equal(t, "weekly box", box.Name)
+	other, err := service.SaveParcelTemplate(ParcelTemplate{Client: 1000, Name: "monthly box", Address: "test"})
+	require.NoError(t, err)
+	assert.Equal(t, ServiceStandard, other.ServiceClass)
+
+	for i := 0; i < 2; i++ {
+		parcel, err := service.RegisterFromTemplate(box.ID)
+		require.NoError(t, err)
+		assert.Equal(t, box.Client, parcel.Client)
+		assert.Equal(t, box.Address, parcel.Address)
+		assert.Equal(t, ServiceExpress, parcel.ServiceClass)
+		assert.Equal(t, 1500, parcel.WeightGrams)
+		assert.Zero(t, parcel.DuplicateOf)
+	}
+	_, err = service.RegisterFromTemplate(999)
+	assert.ErrorIs(t, err, ErrParcelTemplateNotFound)
+
+	templates, err := service.ParcelTemplates(1000)
+	require.NoError(t, err)
+	assert.Equal(t, []ParcelTemplate{other, box}, templates)
+	require.NoError(t, service.DeleteParcelTemplate(other.ID))
+	assert.ErrorIs(t, service.DeleteParcelTemplate(other.ID), ErrParcelTemplateNotFound)
+	parcels, err := service.store.GetByClient(1000)
+	require.NoError(t, err)
+	assert.Len(t, parcels, 2)
+}
+
+// TestParcelTemplatesHTTP checks the /parcel-templates endpoints and
+// that clients only use their own templates.
+func TestParcelTemplatesHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service)
+
+	// check
+	rec := doRequest(t, h, http.MethodPost, "/parcel-templates",
+		`{"client": 1000, "name": "weekly box", "address": "test", "weight_grams": 1500}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var box parcelTemplateJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&box))
+	path := fmt.Sprintf("/parcel-templates/%d", box.ID)
+	assert.Equal(t, path, rec.Header().Get("Location"))
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodPost, "/parcel-templates", `{"client": 1000}`).Code)
+
+	rec = doRequest(t, h, http.MethodGet, "/parcel-templates?client=1000", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var templates []parcelTemplateJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&templates))
+	assert.Equal(t, []parcelTemplateJSON{box}, templates)
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodGet, "/parcel-templates", "").Code)
+
+	rec = doRequest(t, h, http.MethodPost, path+"/parcels", "")
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var parcel parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&parcel))
+	assert.Equal(t, 1500, parcel.WeightGrams)
+	assert.Equal(t, "/parcels/"+parcel.ID, rec.Header().Get("Location"))
+
+	other := NewAuthorizedService(service, Principal{Role: RoleClient, Client: 2000})
+	_, err := other.RegisterFromTemplate(box.ID)
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.ErrorIs(t, other.DeleteParcelTemplate(box.ID), ErrForbidden)
+
+	assert.Equal(t, http.StatusNoContent, doRequest(t, h, http.MethodDelete, path, "").Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodGet, path, "").Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodPost, path+"/parcels", "").Code)
+}
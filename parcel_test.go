@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"math/rand"
+	"path/filepath"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -32,22 +36,29 @@ var (
 // getTestParcel returns a sample test parcel.
 func getTestParcel() Parcel {
 	return Parcel{
-		Client:    1000,
-		Status:    ParcelStatusRegistered,
-		Address:   "test",
-		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Client:       1000,
+		Status:       ParcelStatusRegistered,
+		Address:      "test",
+		CreatedAt:    FormatTimestamp(time.Now(), DefaultTimestampPrecision),
+		Payment:      PaymentUnpaid,
+		ServiceClass: ServiceStandard,
+		Currency:     DefaultCurrency,
 	}
 }
 
-// getTestDB creates and returns an in-memory SQLite database for testing.
+// getTestDB creates and returns an in-memory SQLite database for testing,
+// with the base schema created and all migrations applied.
 // Marked as helper (t.Helper()), so errors are reported at the caller level.
 func getTestDB(t *testing.T) *sql.DB {
 	t.Helper()
-	db, err := sql.Open("sqlite", ":memory:")
+	db, err := sql.Open(AuditDriver, ":memory:")
 	require.NoError(t, err)
 
 	_, err = db.Exec(testSchema)
 	require.NoError(t, err)
+
+	err = NewParcelStore(db).Migrate()
+	require.NoError(t, err)
 	return db
 }
 
@@ -59,12 +70,14 @@ func TestAddGetDeleteWhenValidStatus(t *testing.T) {
 	defer db.Close()
 	store, parcel := NewParcelStore(db), getTestParcel()
 	parcel.Status = ParcelStatusRegistered
+	parcel.PublicID = getTestPublicID(t)
 
 	// add
 	id, err := store.Add(parcel)
 	require.NoError(t, err)
 	require.NotEmpty(t, id)
-	parcel.Number = id
+	parcel.Number, parcel.TrackingCode = id, NewTrackingCode(trackingYear(parcel.CreatedAt), id)
+	parcel.ClientRef = 1
 
 	// get
 	storedParcel, err := store.Get(id)
@@ -88,12 +101,14 @@ func TestAddGetDeleteWhenInvalidStatus(t *testing.T) {
 	defer db.Close()
 	store, parcel := NewParcelStore(db), getTestParcel()
 	parcel.Status = ParcelStatusDelivered
+	parcel.PublicID = getTestPublicID(t)
 
 	// add
 	id, err := store.Add(parcel)
 	require.NoError(t, err)
 	require.NotEmpty(t, id)
-	parcel.Number = id
+	parcel.Number, parcel.TrackingCode = id, NewTrackingCode(trackingYear(parcel.CreatedAt), id)
+	parcel.ClientRef = 1
 
 	// get
 	storedParcel, err := store.Get(id)
@@ -109,6 +124,35 @@ func TestAddGetDeleteWhenInvalidStatus(t *testing.T) {
 	assert.Equal(t, parcel, afterDelete)
 }
 
+// TestDeleteRace checks that a parcel sent while it is being deleted is
+// not deleted.
+func TestDeleteRace(t *testing.T) {
+	// prepare
+	store, err := OpenParcelStore(filepath.Join(t.TempDir(), "tracker.db"), DefaultOptions())
+	require.NoError(t, err)
+	defer store.Close()
+	require.NoError(t, store.EnsureSchema(context.Background()))
+	number, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// send, holding the write lock while the parcel is deleted
+	tx, err := store.db.Begin()
+	require.NoError(t, err)
+	_, err = tx.Exec("UPDATE parcel SET status = ? WHERE number = ?", ParcelStatusSent, number)
+	require.NoError(t, err)
+
+	deleted := make(chan error, 1)
+	go func() { deleted <- store.Delete(number) }()
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, tx.Commit())
+
+	// check
+	require.ErrorIs(t, <-deleted, ErrRequireRegistered)
+	stored, err := store.Get(number)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusSent, stored.Status)
+}
+
 // TestDeleteWhenParcelNotExists ensures Delete returns
 // sql.ErrNoRows for a missing parcel.
 func TestDeleteWhenParcelNotExists(t *testing.T) {
@@ -260,6 +304,49 @@ func TestSetStatusWhenUnrecognisedNewStatus(t *testing.T) {
 	require.Equal(t, parcel.Status, storedParcel.Status)
 }
 
+// FuzzSetStatus checks that SetStatus stores exactly the known statuses,
+// whatever the input, and never changes another parcel.
+func FuzzSetStatus(f *testing.F) {
+	for _, status := range []string{ParcelStatusSent, "SENT", " sent", "sent'; DROP TABLE parcel; --", "", "\x00"} {
+		f.Add(1, status)
+	}
+	f.Add(-1, ParcelStatusDelivered)
+
+	f.Fuzz(func(t *testing.T, number int, status string) {
+		// prepare
+		db := getTestDB(t)
+		defer db.Close()
+		store := NewParcelStore(db)
+		target, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		other, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		if number == 1 {
+			number = target
+		}
+
+		// set status
+		err = store.SetStatus(number, status)
+
+		// check
+		if knownStatus(status) {
+			require.NoError(t, err)
+		} else {
+			require.ErrorIs(t, err, ErrNewStatusUnrecognised)
+		}
+		stored, err := store.Get(target)
+		require.NoError(t, err)
+		if number == target && knownStatus(status) {
+			assert.Equal(t, status, stored.Status)
+		} else {
+			assert.Equal(t, ParcelStatusRegistered, stored.Status)
+		}
+		stored, err = store.Get(other)
+		require.NoError(t, err)
+		assert.Equal(t, ParcelStatusRegistered, stored.Status)
+	})
+}
+
 // TestGetByClient verifies retrieving parcels by client ID.
 func TestGetByClient(t *testing.T) {
 	// prepare
@@ -282,12 +369,15 @@ func TestGetByClient(t *testing.T) {
 
 	// add
 	for i := 0; i < len(parcels); i++ {
+		parcels[i].PublicID = getTestPublicID(t)
 		id, err := store.Add(parcels[i])
 		require.NoError(t, err)
 		require.NotEmpty(t, id)
 
 		// update parcel ID
 		parcels[i].Number = id
+		parcels[i].TrackingCode = NewTrackingCode(trackingYear(parcels[i].CreatedAt), id)
+		parcels[i].ClientRef = i + 1
 
 		// save added parcel into a map for quick lookup
 		parcelMap[id] = parcels[i]
@@ -305,3 +395,121 @@ func TestGetByClient(t *testing.T) {
 		assert.Equal(t, localParcel, storedParcel)
 	}
 }
+
+// TestClientRef verifies that concurrent adds number the parcels of each
+// client consecutively, and that numbers of deleted parcels are not
+// reused.
+func TestClientRef(t *testing.T) {
+	// prepare
+	store, err := OpenParcelStore(filepath.Join(t.TempDir(), "tracker.db"), DefaultOptions())
+	require.NoError(t, err)
+	defer store.Close()
+	require.NoError(t, store.EnsureSchema(context.Background()))
+	clients := []int{1000, 2000}
+	const perClient = 10
+
+	// add
+	var mu sync.Mutex
+	refs := map[int][]int{}
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		for i := 0; i < perClient; i++ {
+			wg.Add(1)
+			go func(client int) {
+				defer wg.Done()
+				parcel := getTestParcel()
+				parcel.Client = client
+				id, err := store.Add(parcel)
+				if !assert.NoError(t, err) {
+					return
+				}
+				stored, err := store.Get(id)
+				if !assert.NoError(t, err) {
+					return
+				}
+				mu.Lock()
+				refs[client] = append(refs[client], stored.ClientRef)
+				mu.Unlock()
+			}(client)
+		}
+	}
+	wg.Wait()
+
+	// check
+	for _, client := range clients {
+		sort.Ints(refs[client])
+		want := make([]int, perClient)
+		for i := range want {
+			want[i] = i + 1
+		}
+		assert.Equal(t, want, refs[client], "client %d", client)
+	}
+
+	parcels, err := store.GetByClient(clients[0])
+	require.NoError(t, err)
+	require.NoError(t, store.Delete(parcels[len(parcels)-1].Number))
+	parcel := getTestParcel()
+	parcel.Client = clients[0]
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, perClient+1, stored.ClientRef)
+}
+
+// TestGetByStatus verifies retrieving parcels by their current status.
+func TestGetByStatus(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	sent := getTestParcel()
+	sent.Status = ParcelStatusSent
+	sent.PublicID = getTestPublicID(t)
+
+	// add
+	_, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	id, err := store.Add(sent)
+	require.NoError(t, err)
+	sent.Number, sent.TrackingCode = id, NewTrackingCode(trackingYear(sent.CreatedAt), id)
+	sent.ClientRef = 2
+
+	// get by status
+	storedParcels, err := store.GetByStatus(ParcelStatusSent)
+	require.NoError(t, err)
+	require.Equal(t, []Parcel{sent}, storedParcels)
+
+	_, err = store.GetByStatus("unrecognised")
+	require.ErrorIs(t, err, ErrNewStatusUnrecognised)
+}
+
+// TestGetByClientOrderWhenSameCreatedAt ensures that parcels created
+// within the same timestamp are listed in insertion order.
+func TestGetByClientOrderWhenSameCreatedAt(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	// add
+	var numbers []int
+	for i := 0; i < 5; i++ {
+		parcel := getTestParcel()
+		parcel.CreatedAt = "2024-01-01T00:00:00.000Z"
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// get by client
+	storedParcels, err := store.GetByClient(getTestParcel().Client)
+	require.NoError(t, err)
+
+	// check
+	require.Len(t, storedParcels, len(numbers))
+	for i, p := range storedParcels {
+		assert.Equal(t, numbers[i], p.Number)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Payment statuses of a parcel, tracked alongside its lifecycle status.
+const (
+	PaymentUnpaid   = "unpaid"
+	PaymentPaid     = "paid"
+	PaymentRefunded = "refunded"
+)
+
+var (
+	ErrPaymentStatusUnrecognised = newError(CodeUnknownPayment, "unrecognised payment status")
+	ErrPaymentTransition         = newError(CodePaymentTransition, "payment status change not allowed")
+	ErrRequirePaid               = newError(CodeRequiresPaid, "requires paid parcel")
+)
+
+// knownPayment reports whether status is one of the payment statuses.
+func knownPayment(status string) bool {
+	switch status {
+	case PaymentUnpaid, PaymentPaid, PaymentRefunded:
+		return true
+	}
+	return false
+}
+
+// paymentTransitions lists the allowed changes of payment status:
+// a parcel is paid once and may then be refunded.
+var paymentTransitions = map[string]string{
+	PaymentUnpaid: PaymentPaid,
+	PaymentPaid:   PaymentRefunded,
+}
+
+// SetPaymentStatus changes the payment status of a parcel.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrPaymentStatusUnrecognised (wrapped) for an unknown status.
+//   - Returns sql.ErrNoRows (wrapped) if the parcel does not exist.
+//   - Returns ErrPaymentTransition (wrapped) unless the change is
+//     unpaid → paid or paid → refunded; setting the current status again
+//     is a no-op.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) SetPaymentStatus(number int, status string) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	if !knownPayment(status) {
+		return fmt.Errorf("failed to update payment status: %w %q for parcel with number %d", ErrPaymentStatusUnrecognised, status, number)
+	}
+
+	return s.InTx(func(tx ParcelStore) error {
+		var stored string
+		query := "SELECT payment_status FROM parcel WHERE number = :number"
+		err := tx.conn().QueryRow(query, sql.Named("number", number)).Scan(&stored)
+		if err != nil {
+			return fmt.Errorf("failed to scan parcel row with number %d: %w", number, err)
+		}
+		if stored == status {
+			return nil
+		}
+		if paymentTransitions[stored] != status {
+			return fmt.Errorf("failed to update payment status: %w from %q to %q for parcel %d", ErrPaymentTransition, stored, status, number)
+		}
+
+		tx.invalidateParcel(number)
+		queryUpdate := "UPDATE parcel SET payment_status = :payment WHERE number = :number"
+		_, err = tx.conn().Exec(queryUpdate, sql.Named("payment", status), sql.Named("number", number))
+		if err != nil {
+			return fmt.Errorf("failed to update payment status to %q for parcel with number %d: %w", status, number, err)
+		}
+		return nil
+	})
+}
+
+// GetUnpaid returns the unpaid parcels registered before the given time,
+// oldest first. Cash-on-delivery parcels are paid on delivery and are
+// therefore not included.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if there is nothing to collect.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) GetUnpaid(before time.Time) ([]Parcel, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + parcelColumns + ` FROM parcel
+WHERE payment_status = :unpaid AND cash_on_delivery = 0 AND julianday(created_at) < julianday(:before)
+ORDER BY julianday(created_at), seq`
+	return s.queryParcels("unpaid parcels", query, sql.Named("unpaid", PaymentUnpaid),
+		sql.Named("before", FormatTimestamp(before, DefaultTimestampPrecision)))
+}
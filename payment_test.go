@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSetPaymentStatus verifies the allowed payment transitions.
+func TestSetPaymentStatus(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// check
+	require.ErrorIs(t, store.SetPaymentStatus(id, PaymentRefunded), ErrPaymentTransition)
+	require.ErrorIs(t, store.SetPaymentStatus(id, "pending"), ErrPaymentStatusUnrecognised)
+	require.NoError(t, store.SetPaymentStatus(id, PaymentPaid))
+	require.NoError(t, store.SetPaymentStatus(id, PaymentPaid))
+	require.ErrorIs(t, store.SetPaymentStatus(id, PaymentUnpaid), ErrPaymentTransition)
+	require.NoError(t, store.SetPaymentStatus(id, PaymentRefunded))
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, PaymentRefunded, stored.Payment)
+}
+
+// TestGetUnpaid verifies that only unpaid, prepaid-terms parcels older
+// than the cutoff are returned.
+func TestGetUnpaid(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	now := time.Now()
+
+	add := func(age time.Duration, modify func(p *Parcel)) int {
+		parcel := getTestParcel()
+		parcel.CreatedAt = FormatTimestamp(now.Add(-age), DefaultTimestampPrecision)
+		modify(&parcel)
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		return id
+	}
+	old := add(10*24*time.Hour, func(p *Parcel) {})
+	add(10*24*time.Hour, func(p *Parcel) { p.Payment = PaymentPaid })
+	add(10*24*time.Hour, func(p *Parcel) { p.CashOnDelivery = true })
+	add(time.Hour, func(p *Parcel) {})
+
+	// check
+	unpaid, err := store.GetUnpaid(now.Add(-7 * 24 * time.Hour))
+	require.NoError(t, err)
+	require.Len(t, unpaid, 1)
+	assert.Equal(t, old, unpaid[0].Number)
+}
+
+// TestNextStatusRequiresPayment verifies that a parcel is sent only once
+// paid, and that a cash-on-delivery parcel is paid on delivery.
+func TestNextStatusRequiresPayment(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	prepaid, err := service.Register(1000, "test")
+	require.NoError(t, err)
+	cod, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", CashOnDelivery: true})
+	require.NoError(t, err)
+
+	// advance
+	require.ErrorIs(t, service.NextStatus(prepaid.Number), ErrRequirePaid)
+	require.NoError(t, service.SetPaymentStatus(prepaid.Number, PaymentPaid))
+	require.NoError(t, service.NextStatus(prepaid.Number))
+
+	require.NoError(t, service.NextStatus(cod.Number))
+	require.NoError(t, service.NextStatus(cod.Number))
+
+	// check
+	stored, err := service.Get(cod.Number)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusDelivered, stored.Status)
+	assert.Equal(t, PaymentPaid, stored.Payment)
+
+	last := (*published)[len(*published)-1]
+	assert.Equal(t, EventPaymentChanged, last.Type)
+	assert.Equal(t, PaymentUnpaid, last.PrevPayment)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrPickupPointNotFound indicates that no pickup point exists with
+	// the requested id.
+	ErrPickupPointNotFound = newError(CodePickupPointNotFound, "pickup point not found")
+	// ErrInvalidPickupPoint indicates a PickupPoint that failed validation.
+	ErrInvalidPickupPoint = newError(CodeInvalidPickupPoint, "invalid pickup point")
+	// ErrPickupPointFull indicates that every slot of a pickup point is
+	// taken by parcels awaiting pickup.
+	ErrPickupPointFull = newError(CodePickupPointFull, "pickup point is full")
+)
+
+// PickupPoint is a parcel locker or counter where clients collect their
+// parcels. A parcel registered for a pickup point takes one of its
+// Capacity slots until it is delivered, i.e. collected by the client.
+type PickupPoint struct {
+	ID       int
+	Name     string
+	Address  string
+	Capacity int
+	// Occupied is the number of undelivered parcels assigned to the point;
+	// it is computed on read and ignored by AddPickupPoint.
+	Occupied int
+}
+
+// AddPickupPoint creates a pickup point and returns its id. The address
+// passes through the store's address validator like a parcel address.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidPickupPoint (wrapped) if the name is blank or the
+//     capacity is not positive, and the validator's error if it rejects
+//     the address.
+//   - Wraps and returns any SQL error from the INSERT.
+func (s ParcelStore) AddPickupPoint(p PickupPoint) (int, error) {
+	if err := s.check(); err != nil {
+		return 0, err
+	}
+
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" || p.Capacity <= 0 {
+		return 0, fmt.Errorf("failed to add pickup point: %w: name %q, capacity %d", ErrInvalidPickupPoint, p.Name, p.Capacity)
+	}
+	address, err := s.validateAddress(p.Address)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add pickup point %q: %w", p.Name, err)
+	}
+
+	query := "INSERT INTO pickup_point (name, address, capacity) VALUES (:name, :address, :capacity)"
+	res, err := s.conn().Exec(query, sql.Named("name", p.Name), sql.Named("address", address),
+		sql.Named("capacity", p.Capacity))
+	if err != nil {
+		return 0, fmt.Errorf("failed to add pickup point %q: %w", p.Name, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get id of pickup point %q: %w", p.Name, err)
+	}
+	return int(id), nil
+}
+
+// GetPickupPoint returns the pickup point with the given id.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrPickupPointNotFound (wrapped) if no such point exists.
+//   - Wraps and returns any other SQL error.
+func (s ParcelStore) GetPickupPoint(id int) (PickupPoint, error) {
+	if err := s.check(); err != nil {
+		return PickupPoint{}, err
+	}
+
+	query := "SELECT " + pickupPointColumns + " FROM pickup_point WHERE id = :id"
+	p, err := scanPickupPoint(s.conn().QueryRow(query, sql.Named("id", id), sql.Named("delivered", ParcelStatusDelivered)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, fmt.Errorf("failed to get pickup point %d: %w", id, ErrPickupPointNotFound)
+	}
+	if err != nil {
+		return p, fmt.Errorf("failed to scan pickup point row with id %d: %w", id, err)
+	}
+	return p, nil
+}
+
+// GetPickupPoints returns every pickup point, ordered by name.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Wraps and returns any SQL errors from query, scanning, or iteration.
+func (s ParcelStore) GetPickupPoints() ([]PickupPoint, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + pickupPointColumns + " FROM pickup_point ORDER BY name, id"
+	rows, err := s.conn().Query(query, sql.Named("delivered", ParcelStatusDelivered))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for pickup points: %w", err)
+	}
+	defer rows.Close()
+
+	var res []PickupPoint
+	for rows.Next() {
+		p, err := scanPickupPoint(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan one of pickup point rows: %w", err)
+		}
+		res = append(res, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate pickup point rows: %w", err)
+	}
+	return res, nil
+}
+
+// GetAwaitingPickup returns the undelivered parcels assigned to the
+// pickup point, oldest first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrPickupPointNotFound (wrapped) if no such point exists.
+//   - Wraps and returns any SQL errors from query, scanning, or iteration.
+func (s ParcelStore) GetAwaitingPickup(point int) ([]Parcel, error) {
+	if _, err := s.GetPickupPoint(point); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + parcelColumns + ` FROM parcel
+WHERE pickup_point = :point AND status != :delivered ORDER BY julianday(created_at), seq`
+	return s.queryParcels(fmt.Sprintf("pickup point %d", point), query,
+		sql.Named("point", point), sql.Named("delivered", ParcelStatusDelivered))
+}
+
+// checkPickupCapacity returns ErrPickupPointFull (wrapped) if the pickup
+// point has no free slot for another parcel.
+func (s ParcelStore) checkPickupCapacity(point int) error {
+	p, err := s.GetPickupPoint(point)
+	if err != nil {
+		return err
+	}
+	if p.Occupied >= p.Capacity {
+		return fmt.Errorf("%w: %q holds %d of %d parcels", ErrPickupPointFull, p.Name, p.Occupied, p.Capacity)
+	}
+	return nil
+}
+
+// pickupPointColumns selects a pickup point in the order scanPickupPoint
+// expects; queries using it must bind :delivered.
+const pickupPointColumns = `id, name, address, capacity,
+    (SELECT COUNT(*) FROM parcel WHERE pickup_point = pickup_point.id AND status != :delivered)`
+
+func scanPickupPoint(row rowScanner) (PickupPoint, error) {
+	var p PickupPoint
+	err := row.Scan(&p.ID, &p.Name, &p.Address, &p.Capacity, &p.Occupied)
+	return p, err
+}
+
+// PickupPoints returns every pickup point with its occupancy.
+func (s ParcelService) PickupPoints() ([]PickupPoint, error) {
+	return s.store.GetPickupPoints()
+}
+
+// PickupPoint returns the pickup point with the given id.
+func (s ParcelService) PickupPoint(id int) (PickupPoint, error) {
+	return s.store.GetPickupPoint(id)
+}
+
+// AddPickupPoint creates a pickup point; see ParcelStore.AddPickupPoint.
+func (s ParcelService) AddPickupPoint(p PickupPoint) (PickupPoint, error) {
+	id, err := s.store.AddPickupPoint(p)
+	if err != nil {
+		return p, err
+	}
+	return s.store.GetPickupPoint(id)
+}
+
+// AwaitingPickup returns the parcels at the pickup point that the
+// clients have not collected yet.
+func (s ParcelService) AwaitingPickup(point int) ([]Parcel, error) {
+	return s.store.GetAwaitingPickup(point)
+}
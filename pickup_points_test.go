@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPickupPointCapacity verifies that parcels for a pickup point take
+// its address and that delivered parcels free their slot.
+func TestPickupPointCapacity(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	_, err := store.AddPickupPoint(PickupPoint{Name: " ", Address: "Main st. 1", Capacity: 1})
+	require.ErrorIs(t, err, ErrInvalidPickupPoint)
+	_, err = store.AddPickupPoint(PickupPoint{Name: "Locker 1", Address: "Main st. 1"})
+	require.ErrorIs(t, err, ErrInvalidPickupPoint)
+	point, err := store.AddPickupPoint(PickupPoint{Name: "Locker 1", Address: "Main st. 1", Capacity: 2})
+	require.NoError(t, err)
+
+	// add
+	var ids []int
+	for i := 0; i < 2; i++ {
+		parcel := getTestParcel()
+		parcel.PickupPoint = point
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	parcel := getTestParcel()
+	parcel.PickupPoint = point
+	_, err = store.Add(parcel)
+	require.ErrorIs(t, err, ErrPickupPointFull)
+	parcel.PickupPoint = point + 100
+	_, err = store.Add(parcel)
+	require.ErrorIs(t, err, ErrPickupPointNotFound)
+
+	// check
+	stored, err := store.Get(ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, "Main st. 1", stored.Address)
+	assert.Equal(t, point, stored.PickupPoint)
+
+	require.NoError(t, store.SetStatus(ids[0], ParcelStatusDelivered))
+	awaiting, err := store.GetAwaitingPickup(point)
+	require.NoError(t, err)
+	require.Len(t, awaiting, 1)
+	assert.Equal(t, ids[1], awaiting[0].Number)
+
+	require.NoError(t, store.SetAddress(ids[1], "Elsewhere 2"))
+	points, err := store.GetPickupPoints()
+	require.NoError(t, err)
+	require.Len(t, points, 1)
+	assert.Equal(t, PickupPoint{ID: point, Name: "Locker 1", Address: "Main st. 1", Capacity: 2}, points[0])
+
+	_, err = store.GetAwaitingPickup(point + 100)
+	require.ErrorIs(t, err, ErrPickupPointNotFound)
+}
+
+// TestRegisterForPickupPoint verifies registration through the service.
+func TestRegisterForPickupPoint(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	point, err := service.AddPickupPoint(PickupPoint{Name: "Locker 1", Address: "Main st. 1", Capacity: 1})
+	require.NoError(t, err)
+
+	// register
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, PickupPoint: point.ID})
+	require.NoError(t, err)
+	_, err = service.RegisterParcel(Parcel{Client: 1001, PickupPoint: point.ID})
+	require.ErrorIs(t, err, ErrPickupPointFull)
+
+	// check
+	assert.Equal(t, "Main st. 1", parcel.Address)
+	point, err = service.PickupPoint(point.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, point.Occupied)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrPreflight indicates that the database did not pass the checks run
+// by Preflight.
+var ErrPreflight = errors.New("store preflight failed")
+
+// preflightCachedParcels is how many parcels Preflight loads into the
+// cache of the store.
+const preflightCachedParcels = 1000
+
+// NewParcelStoreContext is NewParcelStoreWithOptions followed by Preflight,
+// so that cold-start costs are paid at construction rather than by the
+// first request. ctx bounds the preflight.
+func NewParcelStoreContext(ctx context.Context, db *sql.DB, opts Options) (ParcelStore, error) {
+	store, err := NewParcelStoreWithOptions(db, opts)
+	if err != nil {
+		return ParcelStore{}, err
+	}
+	if err := store.Preflight(ctx, opts); err != nil {
+		return ParcelStore{}, err
+	}
+	return store, nil
+}
+
+// Preflight verifies that the store is ready to serve requests.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Pings the database within ctx.
+//   - Reads back every pragma set in opts and returns ErrPreflight
+//     (wrapped) if the database reports a different value.
+//   - Prepares the statements used by Get and the status checks, so they
+//     are cached before the first call.
+//   - With a cache set (see WithCache), loads into it the latest
+//     preflightCachedParcels parcels not delivered yet, those tracked
+//     the most.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) Preflight(ctx context.Context, opts Options) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%w: ping: %w", ErrPreflight, err)
+	}
+
+	for _, p := range opts.pragmas() {
+		name, want, _ := strings.Cut(p, "=")
+
+		var got string
+		if err := s.db.QueryRowContext(ctx, "PRAGMA "+name).Scan(&got); err != nil {
+			return fmt.Errorf("%w: read pragma %s: %w", ErrPreflight, name, err)
+		}
+		if !pragmaEqual(name, want, got) {
+			return fmt.Errorf("%w: pragma %s is %q, want %q", ErrPreflight, name, got, want)
+		}
+	}
+
+	for _, query := range hotQueries {
+		if _, err := s.cachedStmt(query); err != nil {
+			return fmt.Errorf("%w: %w", ErrPreflight, err)
+		}
+	}
+
+	if s.cache != nil {
+		if err := s.warmCache(); err != nil {
+			return fmt.Errorf("%w: %w", ErrPreflight, err)
+		}
+	}
+	return nil
+}
+
+// warmCache puts the latest parcels not delivered yet in the cache of the
+// store, the oldest first so that a smaller cache keeps the latest.
+func (s ParcelStore) warmCache() error {
+	query, args := selectFrom("parcel", parcelColumns).Where("status != ?", ParcelStatusDelivered).
+		OrderBy("julianday(created_at) DESC", "seq DESC").Limit(preflightCachedParcels).build()
+	parcels, err := s.queryParcels("parcels to cache", query, args...)
+	if err != nil {
+		return err
+	}
+	for i := len(parcels) - 1; i >= 0; i-- {
+		s.cache.Put(CacheKey{ID: parcels[i].Number}, parcels[i:i+1])
+	}
+	return nil
+}
+
+// pragmaEqual compares a pragma value as written by Options with the
+// value SQLite reports, which uses numbers for booleans and enums.
+func pragmaEqual(name, want, got string) bool {
+	if strings.EqualFold(want, got) {
+		return true
+	}
+
+	var codes map[string]string
+	switch name {
+	case "foreign_keys":
+		codes = map[string]string{"ON": "1", "OFF": "0"}
+	case "synchronous":
+		codes = map[string]string{"OFF": "0", "NORMAL": "1", "FULL": "2", "EXTRA": "3"}
+	default:
+		return false
+	}
+	if code, ok := codes[strings.ToUpper(want)]; ok {
+		n, err := strconv.Atoi(got)
+		return err == nil && strconv.Itoa(n) == code
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewParcelStoreContext verifies that a correctly configured file
+// database passes preflight and has its hot statements prepared.
+func TestNewParcelStoreContext(t *testing.T) {
+	// prepare
+	opts := DefaultOptions()
+	db, err := sql.Open("sqlite", opts.DSN(filepath.Join(t.TempDir(), "tracker.db")))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(testSchema)
+	require.NoError(t, err)
+	require.NoError(t, NewParcelStore(db).Migrate())
+
+	// construct
+	store, err := NewParcelStoreContext(context.Background(), db, opts)
+	require.NoError(t, err)
+
+	// check
+	for _, query := range hotQueries {
+		assert.Contains(t, store.state.stmts, query)
+	}
+}
+
+// TestPreflightWarmsCache verifies that preflight loads the parcels not
+// delivered yet into the cache of the store.
+func TestPreflightWarmsCache(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	cache := NewParcelCache(10, time.Minute)
+	store := NewParcelStore(db).WithCache(cache)
+
+	add := func(status string) int {
+		p := getTestParcel()
+		p.Status = status
+		number, err := store.Add(p)
+		require.NoError(t, err)
+		return number
+	}
+	registered, sent, delivered := add(ParcelStatusRegistered), add(ParcelStatusSent), add(ParcelStatusDelivered)
+
+	// preflight
+	require.NoError(t, store.Preflight(context.Background(), Options{}))
+
+	// check
+	_, ok := cache.Get(CacheKey{ID: registered})
+	assert.True(t, ok)
+	_, ok = cache.Get(CacheKey{ID: sent})
+	assert.True(t, ok)
+	_, ok = cache.Get(CacheKey{ID: delivered})
+	assert.False(t, ok)
+}
+
+// TestPreflightWhenPragmaNotApplied ensures that a database reporting a
+// different journal mode than requested fails preflight.
+func TestPreflightWhenPragmaNotApplied(t *testing.T) {
+	// prepare: in-memory databases cannot use WAL
+	db := getTestDB(t)
+	defer db.Close()
+
+	// construct
+	_, err := NewParcelStoreContext(context.Background(), db, Options{JournalMode: "WAL"})
+	require.ErrorIs(t, err, ErrPreflight)
+}
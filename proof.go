@@ -0,0 +1,264 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of proof of delivery.
+const (
+	ProofSignature = "signature"
+	ProofPhoto     = "photo"
+)
+
+// MaxProofSize is the largest proof image accepted, in bytes.
+const MaxProofSize = 5 << 20
+
+var (
+	// ErrInvalidProof indicates a proof of delivery of an unknown kind,
+	// without exactly one of an image and a reference, or with an image
+	// that is too large or not an image.
+	ErrInvalidProof = newError(CodeInvalidProof, "invalid proof of delivery")
+	// ErrNoProof indicates that a parcel has no proof of delivery, or that
+	// its proof is only a reference the service cannot resolve.
+	ErrNoProof = newError(CodeNoProof, "no proof of delivery")
+)
+
+// Proof is the proof of delivery of a parcel: a signature or photo image,
+// or a reference to one kept elsewhere, e.g. the key of an object in the
+// courier app's storage.
+type Proof struct {
+	Number int
+	Kind   string
+	// ContentType is the media type of the image, detected from Data if
+	// empty.
+	ContentType string
+	Data        []byte
+	Reference   string
+	RecordedAt  string
+}
+
+// validate checks the proof and detects the content type of its image.
+func (p *Proof) validate() error {
+	if p.Kind != ProofSignature && p.Kind != ProofPhoto {
+		return fmt.Errorf("%w: kind %q, want %q or %q", ErrInvalidProof, p.Kind, ProofSignature, ProofPhoto)
+	}
+	p.Reference = strings.TrimSpace(p.Reference)
+	switch {
+	case len(p.Data) == 0 && p.Reference == "":
+		return fmt.Errorf("%w: an image or a reference is required", ErrInvalidProof)
+	case len(p.Data) > 0 && p.Reference != "":
+		return fmt.Errorf("%w: give either an image or a reference", ErrInvalidProof)
+	case len(p.Reference) > 512:
+		return fmt.Errorf("%w: reference is longer than 512 bytes", ErrInvalidProof)
+	case len(p.Data) > MaxProofSize:
+		return fmt.Errorf("%w: image of %d bytes is larger than %d", ErrInvalidProof, len(p.Data), MaxProofSize)
+	case len(p.Data) == 0:
+		return nil
+	}
+	if p.ContentType == "" {
+		p.ContentType = http.DetectContentType(p.Data)
+	}
+	if !strings.HasPrefix(p.ContentType, "image/") {
+		return fmt.Errorf("%w: content type %q is not an image", ErrInvalidProof, p.ContentType)
+	}
+	return nil
+}
+
+// ObjectStorage keeps proof images outside the database; see
+// ParcelService.WithProofStorage.
+type ObjectStorage interface {
+	// Put stores data under key and returns the reference to Get it by.
+	Put(key string, data []byte) (reference string, err error)
+	Get(reference string) ([]byte, error)
+}
+
+// DirStorage is an ObjectStorage keeping each object in a file of Dir,
+// which is created on first use. References are the file names.
+type DirStorage struct {
+	Dir string
+}
+
+// Put writes data to the file key of the directory.
+func (d DirStorage) Put(key string, data []byte) (string, error) {
+	if err := os.MkdirAll(d.Dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create object directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(d.Dir, key), data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to store object %q: %w", key, err)
+	}
+	return key, nil
+}
+
+// Get reads the file reference of the directory; references naming
+// anything but a file directly in it are rejected.
+func (d DirStorage) Get(reference string) ([]byte, error) {
+	if reference == "" || filepath.Base(reference) != reference || reference == ".." {
+		return nil, fmt.Errorf("failed to read object: invalid reference %q", reference)
+	}
+	data, err := os.ReadFile(filepath.Join(d.Dir, reference))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %q: %w", reference, err)
+	}
+	return data, nil
+}
+
+// SaveProof records the proof of delivery of parcel p.Number.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidProof (wrapped) as described for Proof.
+//   - A parcel has at most one proof; saving another fails with the SQL
+//     error of the INSERT, wrapped.
+func (s ParcelStore) SaveProof(p Proof) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	if err := p.validate(); err != nil {
+		return fmt.Errorf("failed to save proof of delivery of parcel %d: %w", p.Number, err)
+	}
+
+	query := `INSERT INTO delivery_proof (parcel_number, kind, content_type, data, reference, recorded_at)
+VALUES (:number, :kind, :content_type, :data, :reference, :recorded_at)`
+	_, err := s.conn().Exec(query, sql.Named("number", p.Number), sql.Named("kind", p.Kind),
+		sql.Named("content_type", p.ContentType), sql.Named("data", p.Data), sql.Named("reference", p.Reference),
+		sql.Named("recorded_at", p.RecordedAt))
+	if err != nil {
+		return fmt.Errorf("failed to save proof of delivery of parcel %d: %w", p.Number, err)
+	}
+	return nil
+}
+
+// GetProof returns the proof of delivery of a parcel.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns sql.ErrNoRows (wrapped) if the parcel has no proof.
+//   - Wraps and returns any other SQL error.
+func (s ParcelStore) GetProof(number int) (Proof, error) {
+	p := Proof{Number: number}
+	if err := s.check(); err != nil {
+		return p, err
+	}
+
+	query := `SELECT kind, content_type, data, reference, recorded_at FROM delivery_proof
+WHERE parcel_number = :number`
+	err := s.conn().QueryRow(query, sql.Named("number", number)).
+		Scan(&p.Kind, &p.ContentType, &p.Data, &p.Reference, &p.RecordedAt)
+	if err != nil {
+		return p, fmt.Errorf("failed to scan proof of delivery of parcel %d: %w", number, err)
+	}
+	return p, nil
+}
+
+// WithProofStorage returns a copy of the service that keeps proof images
+// in storage, recording only their reference in the database.
+func (s ParcelService) WithProofStorage(storage ObjectStorage) ParcelService {
+	s.proofs = storage
+	return s
+}
+
+// DeliverWithProof delivers a sent parcel and records proof in the same
+// transaction; the event is published as by NextStatus.
+//
+// Behaviour:
+//   - Returns ErrInvalidProof (wrapped) as described for Proof.
+//   - Returns ErrRequireSent (wrapped) unless the parcel is ready for
+//     delivery: sent and, if international, cleared through customs.
+//   - With WithProofStorage, the image is stored before the transaction;
+//     if the transaction fails, the object is left behind.
+func (s ParcelService) DeliverWithProof(number int, proof Proof) error {
+	proof.Number = number
+	proof.RecordedAt = s.timestamp(time.Now())
+	if err := proof.validate(); err != nil {
+		return fmt.Errorf("failed to deliver parcel %d: %w", number, err)
+	}
+
+	parcel, err := s.store.Get(number)
+	if err != nil {
+		return mapError(err)
+	}
+	if !readyForDelivery(parcel) {
+		return fmt.Errorf("failed to deliver parcel %d: %w, actual status: %s", number, ErrRequireSent, parcel.Status)
+	}
+	if s.proofs != nil && len(proof.Data) > 0 {
+		key := "proof-" + strconv.Itoa(number) + "-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+		if proof.Reference, err = s.proofs.Put(key, proof.Data); err != nil {
+			return fmt.Errorf("failed to deliver parcel %d: %w", number, err)
+		}
+		proof.Data = nil
+	}
+
+	var res advanced
+	err = s.store.InTx(func(tx ParcelStore) error {
+		parcel, err := tx.Get(number)
+		if err != nil {
+			return err
+		}
+		if !readyForDelivery(parcel) {
+			return fmt.Errorf("failed to deliver parcel %d: %w, actual status: %s", number, ErrRequireSent, parcel.Status)
+		}
+		if res, err = s.advance(tx, parcel); err != nil {
+			return err
+		}
+		return tx.SaveProof(proof)
+	})
+	if err != nil {
+		return mapError(err)
+	}
+
+	s.publishAdvanced(res)
+	return nil
+}
+
+// Proof returns the proof of delivery of the parcel. Data is empty for
+// proofs kept in object storage; see ProofContent.
+//
+// Behaviour:
+//   - Returns ErrParcelNotFound (wrapped) if the parcel does not exist.
+//   - Returns ErrNoProof (wrapped) if it has no proof of delivery.
+func (s ParcelService) Proof(number int) (Proof, error) {
+	proof, err := s.store.GetProof(number)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := s.store.Get(number); err != nil {
+			return proof, mapError(err)
+		}
+		return proof, fmt.Errorf("%w: parcel %d", ErrNoProof, number)
+	}
+	return proof, err
+}
+
+// ProofContent returns the image of the proof of delivery of the parcel
+// and its content type, reading it from object storage if needed.
+//
+// Behaviour:
+//   - Fails as Proof does.
+//   - Returns ErrNoProof (wrapped) if the proof is a reference and the
+//     service has no object storage to resolve it.
+func (s ParcelService) ProofContent(number int) ([]byte, string, error) {
+	proof, err := s.Proof(number)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(proof.Data) > 0 {
+		return proof.Data, proof.ContentType, nil
+	}
+	if s.proofs == nil {
+		return nil, "", fmt.Errorf("%w: proof of parcel %d is kept at %q", ErrNoProof, number, proof.Reference)
+	}
+	data, err := s.proofs.Get(proof.Reference)
+	if err != nil {
+		return nil, "", err
+	}
+	if proof.ContentType == "" {
+		proof.ContentType = http.DetectContentType(data)
+	}
+	return data, proof.ContentType, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getTestSignature returns a small PNG image.
+func getTestSignature(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))))
+	return buf.Bytes()
+}
+
+// getSentParcel registers a paid parcel and sends it.
+func getSentParcel(t *testing.T, service ParcelService) int {
+	t.Helper()
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", Payment: PaymentPaid})
+	require.NoError(t, err)
+	require.NoError(t, service.NextStatus(parcel.Number))
+	return parcel.Number
+}
+
+// TestDeliverWithProof checks that the proof is recorded with the
+// delivered transition, validated, and only once.
+func TestDeliverWithProof(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	signature := getTestSignature(t)
+	registered, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", Payment: PaymentPaid})
+	require.NoError(t, err)
+	number := getSentParcel(t, service)
+
+	// check
+	err = service.DeliverWithProof(registered.Number, Proof{Kind: ProofSignature, Data: signature})
+	assert.ErrorIs(t, err, ErrRequireSent)
+	err = service.DeliverWithProof(number, Proof{Kind: "fingerprint", Data: signature})
+	assert.ErrorIs(t, err, ErrInvalidProof)
+	err = service.DeliverWithProof(number, Proof{Kind: ProofPhoto, Data: []byte("not an image")})
+	assert.ErrorIs(t, err, ErrInvalidProof)
+	err = service.DeliverWithProof(number, Proof{Kind: ProofPhoto, Data: signature, Reference: "x"})
+	assert.ErrorIs(t, err, ErrInvalidProof)
+	_, err = service.Proof(number)
+	assert.ErrorIs(t, err, ErrNoProof)
+	_, err = service.Proof(999)
+	assert.ErrorIs(t, err, ErrParcelNotFound)
+
+	require.NoError(t, service.DeliverWithProof(number, Proof{Kind: ProofSignature, Data: signature}))
+	parcel, err := service.store.Get(number)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusDelivered, parcel.Status)
+	last := (*published)[len(*published)-1]
+	assert.Equal(t, ParcelStatusDelivered, last.Parcel.Status)
+
+	proof, err := service.Proof(number)
+	require.NoError(t, err)
+	assert.Equal(t, ProofSignature, proof.Kind)
+	assert.Equal(t, "image/png", proof.ContentType)
+	assert.NotEmpty(t, proof.RecordedAt)
+	data, contentType, err := service.ProofContent(number)
+	require.NoError(t, err)
+	assert.Equal(t, signature, data)
+	assert.Equal(t, "image/png", contentType)
+
+	err = service.DeliverWithProof(number, Proof{Kind: ProofSignature, Data: signature})
+	assert.ErrorIs(t, err, ErrRequireSent)
+}
+
+// TestProofStorage checks that with object storage only the reference is
+// kept in the database, and that bare references need storage to resolve.
+func TestProofStorage(t *testing.T) {
+	// prepare
+	base, _ := getTestService(t)
+	service := base.WithProofStorage(DirStorage{Dir: t.TempDir()})
+	signature := getTestSignature(t)
+	stored := getSentParcel(t, service)
+	referenced := getSentParcel(t, service)
+
+	// check
+	require.NoError(t, service.DeliverWithProof(stored, Proof{Kind: ProofPhoto, Data: signature}))
+	proof, err := service.store.GetProof(stored)
+	require.NoError(t, err)
+	assert.Empty(t, proof.Data)
+	assert.NotEmpty(t, proof.Reference)
+	data, _, err := service.ProofContent(stored)
+	require.NoError(t, err)
+	assert.Equal(t, signature, data)
+
+	require.NoError(t, service.DeliverWithProof(referenced, Proof{Kind: ProofSignature, Reference: "courier-app/42.png"}))
+	_, _, err = base.ProofContent(referenced)
+	assert.ErrorIs(t, err, ErrNoProof)
+	_, _, err = service.ProofContent(referenced)
+	assert.Error(t, err, "references outside the directory are rejected")
+}
+
+// TestProofHTTP checks /parcels/{number}/proof and its content as a
+// courier, the only role that delivers.
+func TestProofHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	number := getSentParcel(t, service)
+	asCourier := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), Principal{Role: RoleCourier})))
+		})
+	}
+	h := NewHTTPHandler(service, asCourier)
+	path := fmt.Sprintf("/parcels/%d/proof", number)
+	body, err := json.Marshal(proofRequest{Kind: ProofSignature, Data: getTestSignature(t)})
+	require.NoError(t, err)
+
+	// check
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodGet, path, "").Code)
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodPost, path, `{"kind": "signature"}`).Code)
+
+	rec := doRequest(t, h, http.MethodPost, path, string(body))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var parcel parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&parcel))
+	assert.Equal(t, ParcelStatusDelivered, parcel.Status)
+
+	rec = doRequest(t, h, http.MethodGet, path, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var proof proofJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&proof))
+	assert.Equal(t, ProofSignature, proof.Kind)
+	assert.NotZero(t, proof.Size)
+
+	rec = doRequest(t, h, http.MethodGet, path+"/content", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	assert.Equal(t, getTestSignature(t), rec.Body.Bytes())
+}
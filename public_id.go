@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrInvalidPublicID indicates a string that is not a ULID.
+var ErrInvalidPublicID = newError(CodeInvalidPublicID, "invalid public id")
+
+// crockford is the Crockford base32 alphabet ULIDs are written in.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// publicIDLength is the length of a ULID.
+const publicIDLength = 26
+
+// NewPublicID returns a ULID for a parcel added at t: 48 bits of Unix
+// milliseconds followed by 80 random bits, as 26 characters of Crockford
+// base32. Unlike parcel numbers, public IDs cannot be guessed from one
+// another, and they still sort by creation time.
+func NewPublicID(t time.Time) (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", fmt.Errorf("failed to generate public id: %w", err)
+	}
+	ms := uint64(t.UnixMilli())
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	var out [publicIDLength]byte
+	for i := publicIDLength - 1; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:]), nil
+}
+
+// ParsePublicID returns id in canonical form, upper case, checking that
+// it is a ULID.
+func ParsePublicID(id string) (string, error) {
+	canonical := strings.ToUpper(strings.TrimSpace(id))
+	if len(canonical) != publicIDLength || canonical[0] > '7' {
+		return "", fmt.Errorf("%w: %q", ErrInvalidPublicID, id)
+	}
+	for i := 0; i < len(canonical); i++ {
+		if strings.IndexByte(crockford, canonical[i]) < 0 {
+			return "", fmt.Errorf("%w: %q", ErrInvalidPublicID, id)
+		}
+	}
+	return canonical, nil
+}
+
+// GetByPublicID retrieves a parcel by its public ID; see Parcel.PublicID.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidPublicID (wrapped) for a string that is not a
+//     ULID, without querying the database; case is ignored.
+//   - Returns sql.ErrNoRows (wrapped) if no parcel has the ID.
+//   - Wraps and returns any SQL errors from query execution or scanning.
+func (s ParcelStore) GetByPublicID(id string) (Parcel, error) {
+	if err := s.check(); err != nil {
+		return Parcel{}, err
+	}
+
+	id, err := ParsePublicID(id)
+	if err != nil {
+		return Parcel{}, err
+	}
+
+	query, args := selectFrom("parcel", parcelColumns).Where("public_id = ?", id).build()
+	p, err := scanParcel(s.conn().QueryRow(query, args...))
+	if err != nil {
+		return p, fmt.Errorf("failed to scan parcel row with public id %q: %w", id, err)
+	}
+	return s.openParcel(p)
+}
+
+// backfillPublicIDs assigns public IDs to parcels added before they
+// existed, timed by their creation.
+func backfillPublicIDs(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT number, created_at FROM parcel WHERE public_id = ''")
+	if err != nil {
+		return fmt.Errorf("failed to get cursor for public id backfill: %w", err)
+	}
+	defer rows.Close()
+
+	ids := map[int]string{}
+	for rows.Next() {
+		var number int
+		var createdAt string
+		if err := rows.Scan(&number, &createdAt); err != nil {
+			return fmt.Errorf("failed to scan one of parcel rows for public id backfill: %w", err)
+		}
+		created, err := time.Parse(time.RFC3339Nano, createdAt)
+		if err != nil {
+			created = time.Now()
+		}
+		if ids[number], err = NewPublicID(created); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate parcel rows for public id backfill: %w", err)
+	}
+	rows.Close()
+
+	for number, id := range ids {
+		query := "UPDATE parcel SET public_id = :id WHERE number = :number"
+		if _, err := tx.Exec(query, sql.Named("id", id), sql.Named("number", number)); err != nil {
+			return fmt.Errorf("failed to backfill public id for parcel with number %d: %w", number, err)
+		}
+	}
+	return nil
+}
+
+// PublicIDsOnly is middleware that hides parcels addressed by number under
+// /parcels/, so that API callers must use public IDs; parcel numbers in
+// request bodies and other paths are unaffected.
+func PublicIDsOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rest, ok := strings.CutPrefix(r.URL.Path, "/parcels/"); ok {
+			id, _, _ := strings.Cut(rest, "/")
+			if id != "" && strings.Trim(id, "0123456789") == "" {
+				writeError(w, http.StatusNotFound, fmt.Errorf("%w: parcels are addressed by public id", ErrInvalidPublicID))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
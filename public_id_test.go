@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getTestPublicID returns a new public ID, for parcels compared whole
+// after Add.
+func getTestPublicID(t *testing.T) string {
+	id, err := NewPublicID(time.Now())
+	require.NoError(t, err)
+	return id
+}
+
+// TestNewPublicID verifies the format of public IDs and that they sort
+// by time.
+func TestNewPublicID(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	first, err := NewPublicID(at)
+	require.NoError(t, err)
+	second, err := NewPublicID(at)
+	require.NoError(t, err)
+	later, err := NewPublicID(at.Add(time.Millisecond))
+	require.NoError(t, err)
+
+	assert.Regexp(t, `^[0-9A-HJKMNP-TV-Z]{26}$`, first)
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, first[:10], second[:10])
+	assert.Less(t, first[:10], later[:10])
+
+	parsed, err := ParsePublicID(strings.ToLower(first))
+	require.NoError(t, err)
+	assert.Equal(t, first, parsed)
+
+	for _, invalid := range []string{"", "1", first + "0", "8" + first[1:], "U" + first[1:]} {
+		_, err := ParsePublicID(invalid)
+		assert.ErrorIs(t, err, ErrInvalidPublicID, invalid)
+	}
+}
+
+// TestGetByPublicID verifies that Add assigns a unique public ID usable
+// for lookups.
+func TestGetByPublicID(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	// add
+	first, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	second, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// check
+	stored, err := store.Get(first)
+	require.NoError(t, err)
+	other, err := store.Get(second)
+	require.NoError(t, err)
+	require.Len(t, stored.PublicID, 26)
+	assert.NotEqual(t, stored.PublicID, other.PublicID)
+
+	byID, err := store.GetByPublicID(strings.ToLower(stored.PublicID))
+	require.NoError(t, err)
+	assert.Equal(t, stored, byID)
+
+	_, err = store.GetByPublicID(getTestPublicID(t))
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = store.GetByPublicID("1")
+	require.ErrorIs(t, err, ErrInvalidPublicID)
+
+	duplicate := getTestParcel()
+	duplicate.PublicID = stored.PublicID
+	_, err = store.Add(duplicate)
+	require.Error(t, err)
+}
+
+// TestMigrateBackfillsPublicIDs ensures that parcels created before the
+// public ID migration receive one.
+func TestMigrateBackfillsPublicIDs(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(testSchema)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO parcel (client, status, address, created_at)
+VALUES (1, 'sent', 'test', '2023-06-01T10:00:00Z'), (1, 'sent', 'test', '2023-06-02T10:00:00Z')`)
+	require.NoError(t, err)
+
+	// migrate
+	store := NewParcelStore(db)
+	require.NoError(t, store.Migrate())
+
+	// check
+	first, err := store.Get(1)
+	require.NoError(t, err)
+	second, err := store.Get(2)
+	require.NoError(t, err)
+	require.Len(t, first.PublicID, 26)
+	assert.Less(t, first.PublicID, second.PublicID)
+
+	stored, err := store.GetByPublicID(first.PublicID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stored.Number)
+}
+
+// TestHTTPPublicID verifies that the API addresses parcels by public ID,
+// and only by it behind PublicIDsOnly.
+func TestHTTPPublicID(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service)
+	rec := doRequest(t, h, http.MethodPost, "/parcels", `{"client": 1000, "address": "test"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+
+	// check
+	rec = doRequest(t, h, http.MethodGet, "/parcels/"+strings.ToLower(created.ID), "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var got parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+	assert.Equal(t, created.Number, got.Number)
+
+	rec = doRequest(t, h, http.MethodPut, "/parcels/"+created.ID+"/address", `{"address": "new"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	parcel, err := service.Get(created.Number)
+	require.NoError(t, err)
+	assert.Equal(t, "new", parcel.Address)
+
+	rec = doRequest(t, h, http.MethodGet, "/parcels/"+getTestPublicID(t), "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = doRequest(t, h, http.MethodGet, "/parcels/not-an-id", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	strict := NewHTTPHandler(service, PublicIDsOnly)
+	rec = doRequest(t, strict, http.MethodGet, "/parcels/"+created.ID, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequest(t, strict, http.MethodGet, "/parcels/1", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = doRequest(t, strict, http.MethodGet, "/parcels", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// placeholders is how a query marks its parameters for a database.
+type placeholders int
+
+const (
+	// namedPlaceholders marks parameters :p1, :p2, … bound with sql.Named,
+	// as the store does for SQLite.
+	namedPlaceholders placeholders = iota
+	// questionPlaceholders marks every parameter ?, as MySQL expects.
+	questionPlaceholders
+	// dollarPlaceholders marks parameters $1, $2, …, as PostgreSQL expects.
+	dollarPlaceholders
+)
+
+// selectQuery builds a SELECT statement from parts, so that optional
+// conditions, ordering and limits compose without concatenating SQL and
+// naming parameters by hand:
+//
+//	q := selectFrom("parcel", parcelColumns).Where("client = ?", client)
+//	if status != "" {
+//		q = q.Where("status = ?", status)
+//	}
+//	query, args := q.OrderBy("created_at", "seq").Limit(10).build()
+//
+// Expressions mark each parameter with ?, which build replaces with the
+// placeholder of the database; an expression must not contain ? other
+// than as a marker. Table, column and ORDER BY expressions are SQL, never
+// input. A selectQuery is a value: each method returns a changed copy.
+type selectQuery struct {
+	columns string
+	from    string
+	where   []string
+	groupBy []string
+	orderBy []string
+	limit   int
+	offset  int
+	// columnArgs and whereArgs are the arguments of the ? markers of the
+	// columns and the conditions, in order.
+	columnArgs []any
+	whereArgs  []any
+}
+
+// selectFrom starts a SELECT of columns from table, which may be a join.
+// The columns are an expression whose ? markers take args.
+func selectFrom(table, columns string, args ...any) selectQuery {
+	return selectQuery{from: table, columns: columns, columnArgs: args}
+}
+
+// Where adds a condition, ANDed with the others, whose ? markers take
+// args.
+func (q selectQuery) Where(cond string, args ...any) selectQuery {
+	q.where = append(q.where[:len(q.where):len(q.where)], cond)
+	q.whereArgs = append(q.whereArgs[:len(q.whereArgs):len(q.whereArgs)], args...)
+	return q
+}
+
+// WhereIn adds the condition that column is one of values; with no values
+// it selects nothing.
+func (q selectQuery) WhereIn(column string, values ...any) selectQuery {
+	if len(values) == 0 {
+		return q.Where("1 = 0")
+	}
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+	return q.Where(column+" IN ("+marks+")", values...)
+}
+
+// GroupBy sets the GROUP BY expressions.
+func (q selectQuery) GroupBy(exprs ...string) selectQuery {
+	q.groupBy = exprs
+	return q
+}
+
+// OrderBy sets the ORDER BY expressions, e.g. "weight_grams DESC".
+func (q selectQuery) OrderBy(exprs ...string) selectQuery {
+	q.orderBy = exprs
+	return q
+}
+
+// Limit selects at most n rows; zero means no limit.
+func (q selectQuery) Limit(n int) selectQuery {
+	q.limit = n
+	return q
+}
+
+// Offset skips the first n rows.
+func (q selectQuery) Offset(n int) selectQuery {
+	q.offset = n
+	return q
+}
+
+// build returns the statement and its arguments for the store, with
+// named placeholders.
+func (q selectQuery) build() (string, []any) {
+	return q.buildFor(namedPlaceholders)
+}
+
+// buildFor returns the statement and its arguments with placeholders of
+// the given kind. It panics if the ? markers and the arguments do not
+// match, a programming error.
+func (q selectQuery) buildFor(p placeholders) (string, []any) {
+	var b strings.Builder
+	args := append(append([]any{}, q.columnArgs...), q.whereArgs...)
+	b.WriteString("SELECT " + q.columns + " FROM " + q.from)
+	if len(q.where) > 0 {
+		b.WriteString(" WHERE " + strings.Join(q.where, " AND "))
+	}
+	if len(q.groupBy) > 0 {
+		b.WriteString(" GROUP BY " + strings.Join(q.groupBy, ", "))
+	}
+	if len(q.orderBy) > 0 {
+		b.WriteString(" ORDER BY " + strings.Join(q.orderBy, ", "))
+	}
+	if q.limit > 0 || q.offset > 0 {
+		limit := q.limit
+		if limit <= 0 {
+			limit = -1 // no limit: SQLite has no OFFSET without LIMIT
+		}
+		b.WriteString(" LIMIT ?")
+		args = append(args, limit)
+	}
+	if q.offset > 0 {
+		b.WriteString(" OFFSET ?")
+		args = append(args, q.offset)
+	}
+	return bindPlaceholders(b.String(), args, p)
+}
+
+// bindPlaceholders replaces the ? markers of query with placeholders of
+// kind p, binding args to them in order.
+func bindPlaceholders(query string, args []any, p placeholders) (string, []any) {
+	if strings.Count(query, "?") != len(args) {
+		panic(fmt.Sprintf("query %q has %d parameters but %d arguments", query, strings.Count(query, "?"), len(args)))
+	}
+	if p == questionPlaceholders {
+		return query, args
+	}
+
+	var b strings.Builder
+	bound := make([]any, len(args))
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		name := "p" + strconv.Itoa(n)
+		switch p {
+		case dollarPlaceholders:
+			b.WriteString("$" + strconv.Itoa(n))
+			bound[n-1] = args[n-1]
+		default:
+			b.WriteString(":" + name)
+			bound[n-1] = sql.Named(name, args[n-1])
+		}
+	}
+	return b.String(), bound
+}
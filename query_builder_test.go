@@ -0,0 +1,61 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSelectQuery verifies the statements built for each kind of
+// placeholder and that queries branch without sharing conditions.
+func TestSelectQuery(t *testing.T) {
+	// prepare
+	base := selectFrom("parcel", "number, status").Where("client = ?", 1000)
+	q := base.WhereIn("status", "sent", "delivered").OrderBy("created_at DESC", "seq").Limit(10).Offset(20)
+	other := base.Where("zone = ?", "local")
+
+	// check
+	query, args := q.buildFor(questionPlaceholders)
+	assert.Equal(t, "SELECT number, status FROM parcel WHERE client = ? AND status IN (?, ?) "+
+		"ORDER BY created_at DESC, seq LIMIT ? OFFSET ?", query)
+	assert.Equal(t, []any{1000, "sent", "delivered", 10, 20}, args)
+
+	query, args = q.buildFor(dollarPlaceholders)
+	assert.Equal(t, "SELECT number, status FROM parcel WHERE client = $1 AND status IN ($2, $3) "+
+		"ORDER BY created_at DESC, seq LIMIT $4 OFFSET $5", query)
+	assert.Equal(t, []any{1000, "sent", "delivered", 10, 20}, args)
+
+	query, args = other.build()
+	assert.Equal(t, "SELECT number, status FROM parcel WHERE client = :p1 AND zone = :p2", query)
+	assert.Equal(t, []any{sql.Named("p1", 1000), sql.Named("p2", "local")}, args)
+
+	query, args = selectFrom("parcel", "COUNT(*) > ?", 1).WhereIn("status").Offset(5).buildFor(questionPlaceholders)
+	assert.Equal(t, "SELECT COUNT(*) > ? FROM parcel WHERE 1 = 0 LIMIT ? OFFSET ?", query)
+	assert.Equal(t, []any{1, -1, 5}, args)
+
+	assert.Panics(t, func() { selectFrom("parcel", "number").Where("client = ?").build() })
+}
+
+// TestSelectQueryRuns verifies that built statements run on the store.
+func TestSelectQueryRuns(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	var numbers []int
+	for i := 0; i < 3; i++ {
+		number, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, number)
+	}
+
+	// check
+	query, args := selectFrom("parcel", parcelColumns).WhereIn("number", numbers[0], numbers[2]).
+		OrderBy("number DESC").Limit(1).Offset(1).build()
+	parcels, err := store.queryParcels("test", query, args...)
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	assert.Equal(t, numbers[0], parcels[0].Number)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a set of token buckets, one per key. Each bucket holds
+// up to burst tokens and refills at rate tokens per second; a call is
+// allowed if it can take a token.
+//
+// A RateLimiter is safe for concurrent use.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiterSweep is how many calls pass between removals of idle buckets.
+const rateLimiterSweep = 1024
+
+// NewRateLimiter returns a limiter allowing rate calls per second per key
+// on average, with bursts of up to burst calls.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the bucket of key. It returns true if the call
+// may proceed, or false and how long to wait until a token is available.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.calls++
+	if l.calls%rateLimiterSweep == 0 {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets that have refilled completely; they behave exactly
+// like a new bucket.
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rateLimitKey identifies the caller of r: its API key, its client, or
+// its remote address when the request is not authenticated.
+func rateLimitKey(r *http.Request) string {
+	if who, ok := PrincipalFromContext(r.Context()); ok {
+		if who.KeyID != 0 {
+			return fmt.Sprintf("key:%d", who.KeyID)
+		}
+		if who.Role == RoleClient {
+			return fmt.Sprintf("client:%d", who.Client)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// RateLimit returns middleware that applies limiter to requests changing
+// state (every method except GET, HEAD and OPTIONS), keyed by API key,
+// client or remote address. Rejected requests get 429 Too Many Requests
+// with a Retry-After header. Place it after APIKeyAuth so that callers
+// are told apart by their key.
+func RateLimit(limiter *RateLimiter) func(http.Handler) http.Handler {
+	return rateLimit(limiter, func(r *http.Request) bool {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return false
+		}
+		return true
+	})
+}
+
+// RateLimitAll is like RateLimit but limits every request, reads
+// included; use it for public endpoints open to scraping.
+func RateLimitAll(limiter *RateLimiter) func(http.Handler) http.Handler {
+	return rateLimit(limiter, func(*http.Request) bool { return true })
+}
+
+// rateLimit returns middleware applying limiter to the requests selected
+// by limited.
+func rateLimit(limiter *RateLimiter, limited func(r *http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !limited(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ok, wait := limiter.Allow(rateLimitKey(r))
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeError(w, http.StatusTooManyRequests, fmt.Errorf("rate limit exceeded, retry in %s", wait.Round(time.Millisecond)))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
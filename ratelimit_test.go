@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRateLimiter verifies bursts, refill and independent keys.
+func TestRateLimiter(t *testing.T) {
+	// prepare
+	now := time.Now()
+	limiter := NewRateLimiter(2, 3)
+	limiter.now = func() time.Time { return now }
+
+	// burst
+	for i := 0; i < 3; i++ {
+		ok, _ := limiter.Allow("a")
+		require.True(t, ok, "call %d", i)
+	}
+	ok, wait := limiter.Allow("a")
+	require.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	ok, _ = limiter.Allow("b")
+	assert.True(t, ok)
+
+	// refill
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = limiter.Allow("a")
+	assert.True(t, ok)
+	ok, _ = limiter.Allow("a")
+	assert.False(t, ok)
+}
+
+// TestRateLimitMiddleware ensures that only changes are limited and that
+// rejected calls are told when to retry.
+func TestRateLimitMiddleware(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	limiter := NewRateLimiter(0.5, 1)
+	h := NewHTTPHandler(service, RateLimit(limiter))
+
+	// register
+	rec := doRequest(t, h, http.MethodPost, "/parcels", `{"client": 1000, "address": "test"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = doRequest(t, h, http.MethodPost, "/parcels", `{"client": 1000, "address": "test"}`)
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+
+	// check
+	rec = doRequest(t, h, http.MethodGet, "/parcels/1", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
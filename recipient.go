@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxRecipientNameLength is the longest recipient name accepted, in
+// characters.
+const MaxRecipientNameLength = 200
+
+// ErrInvalidRecipient indicates a recipient with a name but no phone or
+// the other way round, a name that is too long, or a phone that is not
+// a valid number.
+var ErrInvalidRecipient = newError(CodeInvalidRecipient, "invalid recipient")
+
+// Recipient is the person a parcel is delivered to. Unlike the client,
+// who registers and pays for the parcel, the recipient has no account;
+// the courier reaches them by Phone, which is stored in E.164 form,
+// e.g. "+79161234567".
+type Recipient struct {
+	Name  string
+	Phone string
+}
+
+// IsZero reports whether no recipient was given.
+func (r Recipient) IsZero() bool {
+	return r == Recipient{}
+}
+
+// phoneCountry returns the country whose national phone formats the
+// recipient phone of p may be in: the destination of an international
+// parcel, DefaultPhoneCountry otherwise.
+func (p Parcel) phoneCountry() string {
+	if p.International && p.Country != "" {
+		return p.Country
+	}
+	return DefaultPhoneCountry
+}
+
+// normalise trims the name, normalises the phone, which may be in the
+// national format of country (see NormalisePhoneIn), and checks that
+// both are given, or neither.
+func (r Recipient) normalise(country string) (Recipient, error) {
+	r.Name = strings.TrimSpace(r.Name)
+	r.Phone = strings.TrimSpace(r.Phone)
+	if r.IsZero() {
+		return r, nil
+	}
+
+	switch {
+	case r.Name == "":
+		return r, fmt.Errorf("%w: name is required", ErrInvalidRecipient)
+	case r.Phone == "":
+		return r, fmt.Errorf("%w: phone is required", ErrInvalidRecipient)
+	case utf8.RuneCountInString(r.Name) > MaxRecipientNameLength:
+		return r, fmt.Errorf("%w: name is longer than %d characters", ErrInvalidRecipient, MaxRecipientNameLength)
+	}
+	phone, err := NormalisePhoneIn(r.Phone, country)
+	if err != nil {
+		return r, err
+	}
+	r.Phone = phone
+	return r, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNormalisePhone checks the accepted phone formats.
+func TestNormalisePhone(t *testing.T) {
+	valid := map[string]string{
+		"+7 916 123-45-67":  "+79161234567",
+		"8 (916) 123-45-67": "+79161234567",
+		"79161234567":       "+79161234567",
+		"+44 20 7946 0958":  "+442079460958",
+	}
+	for in, want := range valid {
+		got, err := NormalisePhone(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	for _, in := range []string{"", "123", "9161234567", "+7 916 ABC", "+1234567890123456", "7+9161234567"} {
+		_, err := NormalisePhone(in)
+		assert.ErrorIs(t, err, ErrInvalidRecipient, in)
+	}
+}
+
+// TestRecipient checks that the recipient is stored apart from the
+// client, validated, and searchable by phone in any format.
+func TestRecipient(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	add := func(recipient Recipient) (int, error) {
+		p := getTestParcel()
+		p.Recipient = recipient
+		return store.Add(p)
+	}
+	first, err := add(Recipient{Name: " Иван Петров ", Phone: "8 (916) 123-45-67"})
+	require.NoError(t, err)
+	second, err := add(Recipient{Name: "Иван Петров", Phone: "+79161234567"})
+	require.NoError(t, err)
+	none, err := add(Recipient{})
+	require.NoError(t, err)
+
+	// check
+	parcel, err := store.Get(first)
+	require.NoError(t, err)
+	assert.Equal(t, Recipient{Name: "Иван Петров", Phone: "+79161234567"}, parcel.Recipient)
+	parcel, err = store.Get(none)
+	require.NoError(t, err)
+	assert.True(t, parcel.Recipient.IsZero())
+
+	parcels, err := store.Find(ParcelFilter{RecipientPhone: "+7 (916) 123 45 67"})
+	require.NoError(t, err)
+	require.Len(t, parcels, 2)
+	assert.Equal(t, first, parcels[0].Number)
+	assert.Equal(t, second, parcels[1].Number)
+	_, err = store.Find(ParcelFilter{RecipientPhone: "123"})
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+
+	for _, r := range []Recipient{
+		{Name: "Иван Петров"},
+		{Phone: "+79161234567"},
+		{Name: "Иван Петров", Phone: "916"},
+		{Name: strings.Repeat("я", MaxRecipientNameLength+1), Phone: "+79161234567"},
+	} {
+		_, err := add(r)
+		assert.ErrorIs(t, err, ErrInvalidRecipient, r)
+	}
+}
+
+// TestRecipientHTTP checks registering with a recipient and filtering
+// GET /parcels by recipient_phone.
+func TestRecipientHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service)
+
+	// check
+	rec := doRequest(t, h, http.MethodPost, "/parcels",
+		`{"client": 1000, "address": "test", "recipient": {"name": "Иван Петров", "phone": "8 916 123 45 67"}}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var created parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	require.NotNil(t, created.Recipient)
+	assert.Equal(t, "+79161234567", created.Recipient.Phone)
+
+	rec = doRequest(t, h, http.MethodGet, "/parcels?recipient_phone=%2B79161234567", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var parcels []parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&parcels))
+	require.Len(t, parcels, 1)
+	assert.Equal(t, created.Number, parcels[0].Number)
+
+	rec = doRequest(t, h, http.MethodPost, "/parcels", `{"client": 1000, "address": "test", "recipient": {"name": "Иван"}}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// RedactedPII replaces personal data in error messages and log records.
+const RedactedPII = "[redacted]"
+
+// revealPII turns redaction off; see RevealPII.
+var revealPII atomic.Bool
+
+// RevealPII sets whether error messages and log records show personal
+// data, such as client numbers, addresses and phones, instead of
+// RedactedPII. Redaction is on by default; turn it off in debugging
+// environments only, before the errors to show are created: messages
+// are fixed when an error is.
+func RevealPII(reveal bool) {
+	revealPII.Store(reveal)
+}
+
+// piiValue is a value that formats as RedactedPII unless RevealPII is on.
+type piiValue struct {
+	v any
+}
+
+// pii marks v as personal data in an error message or log record, e.g.
+//
+//	fmt.Errorf("failed to add parcel for client %d: %w", pii(p.Client), err)
+//
+// Any verb applies to v when personal data is revealed.
+func pii(v any) piiValue {
+	return piiValue{v: v}
+}
+
+// Format implements fmt.Formatter.
+func (p piiValue) Format(f fmt.State, verb rune) {
+	if !revealPII.Load() {
+		io.WriteString(f, RedactedPII)
+		return
+	}
+	fmt.Fprintf(f, fmt.FormatString(f, verb), p.v)
+}
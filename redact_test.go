@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRedactPII verifies that personal data is masked in errors unless
+// revealed, and that masked errors still match their sentinels.
+func TestRedactPII(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	_, err := service.EraseClientData(-7)
+	require.ErrorIs(t, err, ErrInvalidErasure)
+
+	// check
+	assert.NotContains(t, err.Error(), "-7")
+	assert.Contains(t, err.Error(), RedactedPII)
+	_, err = NormalisePhone("+7 abc")
+	require.ErrorIs(t, err, ErrInvalidRecipient)
+	assert.NotContains(t, err.Error(), "abc")
+
+	// reveal
+	RevealPII(true)
+	t.Cleanup(func() { RevealPII(false) })
+	_, err = service.EraseClientData(-7)
+	require.ErrorIs(t, err, ErrInvalidErasure)
+	assert.Contains(t, err.Error(), "client -7")
+	assert.Equal(t, `"+7"`, fmt.Sprintf("%q", pii("+7")))
+	assert.Equal(t, "  42", fmt.Sprintf("%4d", pii(42)))
+}
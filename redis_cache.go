@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisTimeout bounds dialling and each command, so that a slow Redis
+// degrades to cache misses rather than stalling reads.
+const redisTimeout = 2 * time.Second
+
+// redisIdleConns is the number of idle connections kept for reuse.
+const redisIdleConns = 8
+
+// RedisConfig configures a RedisCache.
+type RedisConfig struct {
+	// Addr is the host:port of the Redis server.
+	Addr     string
+	Password string
+	DB       int
+	// Prefix is prepended to every key and to the invalidation channel,
+	// "parcels:" if empty.
+	Prefix string
+	// TTL is how long entries live in Redis.
+	TTL time.Duration
+	// Local, if set, is an in-process cache in front of Redis. Its entries
+	// are invalidated by writes of every instance while Listen runs.
+	Local *ParcelCache
+	// OnError, if set, receives Redis errors, which otherwise only turn
+	// into cache misses.
+	OnError func(error)
+}
+
+// RedisCache is a Cache shared by several instances of the service
+// through Redis. Parcels are stored as JSON under <prefix>parcel:<number>
+// and <prefix>client:<client>, and every invalidation is published on
+// <prefix>invalidate for the local caches of the other instances.
+type RedisCache struct {
+	cfg  RedisConfig
+	idle chan *redisConn
+}
+
+// RedisError is an error reply of the Redis server.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// NewRedisCache returns a cache using the Redis server of cfg. No
+// connection is made until the cache is used.
+func NewRedisCache(cfg RedisConfig) *RedisCache {
+	if cfg.Prefix == "" {
+		cfg.Prefix = "parcels:"
+	}
+	return &RedisCache{cfg: cfg, idle: make(chan *redisConn, redisIdleConns)}
+}
+
+// Get returns the parcels for key from the local cache, or from Redis,
+// filling the local cache.
+func (c *RedisCache) Get(key CacheKey) ([]Parcel, bool) {
+	if c.cfg.Local != nil {
+		if parcels, ok := c.cfg.Local.Get(key); ok {
+			return parcels, true
+		}
+	}
+
+	reply, err := c.do("GET", c.key(key))
+	if err != nil {
+		c.report(fmt.Errorf("failed to get %s from cache: %w", c.key(key), err))
+		return nil, false
+	}
+	data, ok := reply.(string)
+	if !ok {
+		return nil, false
+	}
+	var parcels []Parcel
+	if err := json.Unmarshal([]byte(data), &parcels); err != nil {
+		c.report(fmt.Errorf("failed to decode %s from cache: %w", c.key(key), err))
+		return nil, false
+	}
+	if c.cfg.Local != nil {
+		c.cfg.Local.Put(key, parcels)
+	}
+	return parcels, true
+}
+
+// Put stores parcels under key in Redis and in the local cache, and
+// records the client of each parcel so that invalidating the parcel
+// drops the client's list on every instance.
+func (c *RedisCache) Put(key CacheKey, parcels []Parcel) {
+	if c.cfg.Local != nil {
+		c.cfg.Local.Put(key, parcels)
+	}
+
+	data, err := json.Marshal(parcels)
+	if err != nil {
+		c.report(fmt.Errorf("failed to encode %s for cache: %w", c.key(key), err))
+		return
+	}
+	ttl := strconv.FormatInt(c.cfg.TTL.Milliseconds(), 10)
+	for _, p := range parcels {
+		_, err := c.do("SET", c.ownerKey(p.Number), strconv.Itoa(p.Client), "PX", ttl)
+		if err != nil {
+			c.report(fmt.Errorf("failed to put owner of parcel %d to cache: %w", p.Number, err))
+			return
+		}
+	}
+	if _, err := c.do("SET", c.key(key), string(data), "PX", ttl); err != nil {
+		c.report(fmt.Errorf("failed to put %s to cache: %w", c.key(key), err))
+	}
+}
+
+// Invalidate deletes the entry for key and, for a parcel, the list of
+// its client, and publishes the deleted keys to the other instances.
+func (c *RedisCache) Invalidate(key CacheKey) {
+	if c.cfg.Local != nil {
+		c.cfg.Local.Invalidate(key)
+	}
+
+	keys := []CacheKey{key}
+	if !key.Client {
+		reply, err := c.do("GET", c.ownerKey(key.ID))
+		if err != nil {
+			c.report(fmt.Errorf("failed to get owner of parcel %d from cache: %w", key.ID, err))
+		}
+		if owner, ok := reply.(string); ok {
+			if client, err := strconv.Atoi(owner); err == nil {
+				keys = append(keys, CacheKey{Client: true, ID: client})
+			}
+		}
+	}
+
+	args := []string{"DEL"}
+	for _, k := range keys {
+		args = append(args, c.key(k))
+	}
+	if _, err := c.do(args...); err != nil {
+		c.report(fmt.Errorf("failed to invalidate %s in cache: %w", c.key(key), err))
+	}
+	for _, k := range keys {
+		if _, err := c.do("PUBLISH", c.channel(), c.key(k)); err != nil {
+			c.report(fmt.Errorf("failed to publish invalidation of %s: %w", c.key(k), err))
+		}
+	}
+}
+
+// Listen subscribes to the invalidations published by all instances and
+// applies them to the local cache until ctx is done. It returns nil when
+// ctx is done, and the error otherwise; entries invalidated while no
+// Listen runs may be served from the local cache until they expire.
+func (c *RedisCache) Listen(ctx context.Context) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	conn.SetDeadline(time.Now().Add(redisTimeout))
+	if _, err := conn.do("SUBSCRIBE", c.channel()); err != nil {
+		return fmt.Errorf("failed to subscribe to cache invalidations: %w", err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	for {
+		reply, err := conn.read()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to receive cache invalidation: %w", err)
+		}
+		msg, ok := reply.([]any)
+		if !ok || len(msg) != 3 || msg[0] != "message" {
+			continue
+		}
+		name, _ := msg[2].(string)
+		if key, ok := c.parseKey(name); ok && c.cfg.Local != nil {
+			c.cfg.Local.Invalidate(key)
+		}
+	}
+}
+
+func (c *RedisCache) key(key CacheKey) string {
+	if key.Client {
+		return c.cfg.Prefix + "client:" + strconv.Itoa(key.ID)
+	}
+	return c.cfg.Prefix + "parcel:" + strconv.Itoa(key.ID)
+}
+
+// parseKey is the inverse of key.
+func (c *RedisCache) parseKey(name string) (CacheKey, bool) {
+	kind, id, ok := strings.Cut(strings.TrimPrefix(name, c.cfg.Prefix), ":")
+	n, err := strconv.Atoi(id)
+	if !ok || err != nil || kind != "client" && kind != "parcel" {
+		return CacheKey{}, false
+	}
+	return CacheKey{Client: kind == "client", ID: n}, true
+}
+
+func (c *RedisCache) ownerKey(number int) string {
+	return c.cfg.Prefix + "owner:" + strconv.Itoa(number)
+}
+
+func (c *RedisCache) channel() string {
+	return c.cfg.Prefix + "invalidate"
+}
+
+func (c *RedisCache) report(err error) {
+	if c.cfg.OnError != nil {
+		c.cfg.OnError(err)
+	}
+}
+
+// do runs one command on an idle or new connection. Connections that
+// fail are closed rather than reused.
+func (c *RedisCache) do(args ...string) (any, error) {
+	var conn *redisConn
+	select {
+	case conn = <-c.idle:
+	default:
+		var err error
+		if conn, err = c.dial(); err != nil {
+			return nil, err
+		}
+	}
+
+	conn.SetDeadline(time.Now().Add(redisTimeout))
+	reply, err := conn.do(args...)
+	var redisErr RedisError
+	if err != nil && !errors.As(err, &redisErr) {
+		conn.Close()
+		return nil, err
+	}
+	select {
+	case c.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return reply, err
+}
+
+// dial connects to Redis, authenticating and selecting the database.
+func (c *RedisCache) dial() (*redisConn, error) {
+	nc, err := net.DialTimeout("tcp", c.cfg.Addr, redisTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis at %s: %w", c.cfg.Addr, err)
+	}
+	conn := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	conn.SetDeadline(time.Now().Add(redisTimeout))
+	if c.cfg.Password != "" {
+		if _, err := conn.do("AUTH", c.cfg.Password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to authenticate to redis: %w", err)
+		}
+	}
+	if c.cfg.DB != 0 {
+		if _, err := conn.do("SELECT", strconv.Itoa(c.cfg.DB)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to select redis database %d: %w", c.cfg.DB, err)
+		}
+	}
+	return conn, nil
+}
+
+// redisConn speaks the Redis protocol (RESP) over a connection. Replies
+// are decoded to string (simple and bulk strings), int64, []any or nil;
+// error replies are returned as RedisError.
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// do sends a command and reads its reply.
+func (c *redisConn) do(args ...string) (any, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c, b.String()); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// read reads one reply.
+func (c *redisConn) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("malformed redis reply %q", line)
+	}
+	kind, line := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, RedisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		res := make([]any, n)
+		for i := range res {
+			if res[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("malformed redis reply %q", line)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis serves the subset of Redis used by RedisCache, ignoring
+// expiry.
+type fakeRedis struct {
+	mu          sync.Mutex
+	data        map[string]string
+	subscribers []net.Conn
+	listener    net.Listener
+}
+
+func startFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	r := &fakeRedis{data: map[string]string{}, listener: l}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) addr() string {
+	return r.listener.Addr().String()
+}
+
+func (r *fakeRedis) subscribed() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.subscribers)
+}
+
+func (r *fakeRedis) serve(nc net.Conn) {
+	defer nc.Close()
+	conn := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	for {
+		reply, err := conn.read()
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range reply.([]any) {
+			args = append(args, arg.(string))
+		}
+
+		r.mu.Lock()
+		var out string
+		switch strings.ToUpper(args[0]) {
+		case "GET":
+			if v, ok := r.data[args[1]]; ok {
+				out = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			} else {
+				out = "$-1\r\n"
+			}
+		case "SET":
+			r.data[args[1]] = args[2]
+			out = "+OK\r\n"
+		case "DEL":
+			for _, k := range args[1:] {
+				delete(r.data, k)
+			}
+			out = fmt.Sprintf(":%d\r\n", len(args)-1)
+		case "PUBLISH":
+			msg := fmt.Sprintf("*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(args[1]), args[1], len(args[2]), args[2])
+			for _, sub := range r.subscribers {
+				io.WriteString(sub, msg)
+			}
+			out = fmt.Sprintf(":%d\r\n", len(r.subscribers))
+		case "SUBSCRIBE":
+			r.subscribers = append(r.subscribers, nc)
+			out = fmt.Sprintf("*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(args[1]), args[1])
+		default:
+			out = "-ERR unknown command\r\n"
+		}
+		io.WriteString(nc, out)
+		r.mu.Unlock()
+	}
+}
+
+// TestRedisCache runs two instances on one database sharing a Redis
+// cache: reads of one fill the cache for the other, and writes of one
+// invalidate the local cache of the other.
+func TestRedisCache(t *testing.T) {
+	// prepare
+	redis := startFakeRedis(t)
+	db := getTestDB(t)
+	defer db.Close()
+
+	newInstance := func() (ParcelStore, *ParcelCache) {
+		local := NewParcelCache(100, time.Minute)
+		cache := NewRedisCache(RedisConfig{Addr: redis.addr(), TTL: time.Minute, Local: local,
+			OnError: func(err error) { t.Error(err) }})
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- cache.Listen(ctx) }()
+		t.Cleanup(func() {
+			cancel()
+			assert.NoError(t, <-done)
+		})
+		return NewParcelStore(db).WithCache(cache), local
+	}
+	a, _ := newInstance()
+	b, localB := newInstance()
+	require.Eventually(t, func() bool { return redis.subscribed() == 2 }, time.Second, 10*time.Millisecond)
+
+	parcel := getTestParcel()
+	number, err := a.Add(parcel)
+	require.NoError(t, err)
+
+	// fill through a, read through b
+	_, err = a.Get(number)
+	require.NoError(t, err)
+	_, err = a.GetByClient(parcel.Client)
+	require.NoError(t, err)
+	_, err = db.Exec("UPDATE parcel SET address = 'stale' WHERE number = ?", number)
+	require.NoError(t, err)
+
+	stored, err := b.Get(number)
+	require.NoError(t, err)
+	assert.Equal(t, "test", stored.Address)
+	assert.Equal(t, 1, localB.Stats().Size)
+
+	// write through a
+	require.NoError(t, a.SetStatus(number, ParcelStatusSent))
+
+	// check
+	assert.Eventually(t, func() bool {
+		stored, err := b.Get(number)
+		return err == nil && stored.Status == ParcelStatusSent
+	}, time.Second, 10*time.Millisecond)
+	list, err := b.GetByClient(parcel.Client)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, ParcelStatusSent, list[0].Status)
+	assert.Equal(t, "stale", list[0].Address)
+}
+
+// TestRedisCacheUnavailable checks that reads and writes work without
+// Redis, reporting the errors.
+func TestRedisCacheUnavailable(t *testing.T) {
+	// prepare
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	var errs []error
+	cache := NewRedisCache(RedisConfig{Addr: addr, TTL: time.Minute, OnError: func(err error) { errs = append(errs, err) }})
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db).WithCache(cache)
+
+	// check
+	number, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(number, ParcelStatusSent))
+	stored, err := store.Get(number)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusSent, stored.Status)
+	assert.NotEmpty(t, errs)
+	assert.Error(t, cache.Listen(context.Background()))
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// ErrBrokenReference indicates a write refused by a foreign key because
+// it would leave a row referring to a record that does not exist, such
+// as a stop of a route that has been deleted in the meantime. Foreign
+// keys are only enforced on connections with Options.ForeignKeys set.
+var ErrBrokenReference = newError(CodeBrokenReference, "referenced record not found")
+
+// referenceError wraps err in ErrBrokenReference if a foreign key
+// refused the statement, rather than leaving a raw constraint failure.
+func referenceError(err error) error {
+	var serr *sqlite.Error
+	if errors.As(err, &serr) && serr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY && !errors.Is(err, ErrBrokenReference) {
+		return fmt.Errorf("%w: %w", ErrBrokenReference, err)
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestForeignKeys verifies that route stops and order items go with
+// their route, order or parcel, and that rows referring to nothing are
+// refused with ErrBrokenReference.
+func TestForeignKeys(t *testing.T) {
+	// prepare
+	store := getTestFileStore(t)
+	order, err := store.CreateOrder(getTestParcel().Client)
+	require.NoError(t, err)
+	kept, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	deleted, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.AddOrderParcel(order.ID, kept))
+	require.NoError(t, store.AddOrderParcel(order.ID, deleted))
+
+	// delete the parcel
+	require.NoError(t, store.Delete(deleted))
+	parcels, err := store.GetByOrder(order.ID)
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	assert.Equal(t, kept, parcels[0].Number)
+	other, err := store.orderOf(deleted)
+	require.NoError(t, err)
+	assert.Zero(t, other)
+
+	// delete the order
+	_, err = store.db.Exec("DELETE FROM parcel_order WHERE id = ?", order.ID)
+	require.NoError(t, err)
+	other, err = store.orderOf(kept)
+	require.NoError(t, err)
+	assert.Zero(t, other)
+
+	// check
+	err = store.addOrderItem(order.ID, kept)
+	assert.ErrorIs(t, err, ErrBrokenReference)
+	assert.Equal(t, CodeBrokenReference, ErrorCodeOf(mapError(err)))
+}
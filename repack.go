@@ -0,0 +1,385 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxSplitPieces is the largest number of pieces a parcel may be split
+// into.
+const MaxSplitPieces = 100
+
+// Kinds of ParcelLink.
+const (
+	LinkSplit = "split"
+	LinkMerge = "merge"
+)
+
+var (
+	// ErrInvalidRepack indicates a split into too few or too many pieces,
+	// or a merge of fewer than two parcels or of parcels that do not share
+	// client, destination and status.
+	ErrInvalidRepack = newError(CodeInvalidRepack, "invalid split or merge")
+	// ErrRepacked indicates that a parcel was split or merged into other
+	// parcels and no longer moves through the lifecycle.
+	ErrRepacked = newError(CodeRepacked, "parcel was repacked")
+)
+
+// ParcelLink records that a parcel was repacked at the warehouse. For a
+// split, Parent is the original parcel and Child one of its pieces; for a
+// merge, Parent is the consolidated parcel and Child one of the parcels it
+// contains.
+type ParcelLink struct {
+	Parent    int
+	Child     int
+	Kind      string
+	CreatedAt string
+}
+
+// addLink records a parent-child link; it must run inside InTx.
+func (s ParcelStore) addLink(l ParcelLink) error {
+	query := `INSERT INTO parcel_link (parent_number, child_number, kind, created_at)
+VALUES (:parent, :child, :kind, :created_at)`
+	_, err := s.conn().Exec(query, sql.Named("parent", l.Parent), sql.Named("child", l.Child),
+		sql.Named("kind", l.Kind), sql.Named("created_at", l.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("failed to link parcel %d to parcel %d: %w", l.Child, l.Parent, err)
+	}
+	return nil
+}
+
+// markRepacked flags the parcel as split or merged; see Parcel.Repacked.
+func (s ParcelStore) markRepacked(number int) error {
+	s.invalidateParcel(number)
+	query := "UPDATE parcel SET repacked = 1 WHERE number = :number"
+	if _, err := s.conn().Exec(query, sql.Named("number", number)); err != nil {
+		return fmt.Errorf("failed to mark parcel with number %d as repacked: %w", number, err)
+	}
+	return nil
+}
+
+// GetLinks returns the links in which the parcel is the parent or the
+// child, oldest first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if the parcel was never repacked.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) GetLinks(number int) ([]ParcelLink, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT parent_number, child_number, kind, created_at FROM parcel_link
+WHERE parent_number = :number OR child_number = :number ORDER BY julianday(created_at), parent_number, child_number`
+	rows, err := s.conn().Query(query, sql.Named("number", number))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for links of parcel %d: %w", number, err)
+	}
+	defer rows.Close()
+
+	res := []ParcelLink{}
+	for rows.Next() {
+		var l ParcelLink
+		if err := rows.Scan(&l.Parent, &l.Child, &l.Kind, &l.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan one of link rows of parcel %d: %w", number, err)
+		}
+		res = append(res, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate link rows of parcel %d: %w", number, err)
+	}
+	return res, nil
+}
+
+// checkRepackable returns an error unless the parcel may be split or
+// merged: it must not be delivered or repacked already.
+func checkRepackable(p Parcel) error {
+	if p.Repacked {
+		return fmt.Errorf("%w: parcel %d", ErrRepacked, p.Number)
+	}
+	if p.Status == ParcelStatusDelivered {
+		return fmt.Errorf("%w: parcel %d is delivered", ErrInvalidRepack, p.Number)
+	}
+	return nil
+}
+
+// repackedDraft returns a parcel going to the same client, destination
+// and recipient as p, in the same status and with the same terms. Its
+// price is zero, as p has already been charged.
+func repackedDraft(p Parcel, createdAt string) Parcel {
+	return Parcel{
+		Client:      p.Client,
+		Status:      p.Status,
+		Address:     p.Address,
+		CreatedAt:   createdAt,
+		DueAt:       p.DueAt,
+		SentAt:      p.SentAt,
+		DeliveredAt: p.DeliveredAt,
+		// The pieces are expected when the parcel was.
+		EstimatedDeliveryAt: p.EstimatedDeliveryAt,
+		Attributes:          p.Attributes,
+		Zone:                p.Zone,
+		Payment:             p.Payment,
+		CashOnDelivery:      p.CashOnDelivery,
+		Coordinates:         p.Coordinates,
+		PickupPoint:         p.PickupPoint,
+		Recipient:           p.Recipient,
+		ServiceClass:        p.ServiceClass,
+		Contents:            p.Contents,
+		International:       p.International,
+		Country:             p.Country,
+		// The pieces of a declared parcel share its declaration.
+		CustomsReference: p.CustomsReference,
+		HSCodes:          p.HSCodes,
+	}
+}
+
+// addRepacked adds draft with a status history entry noted note and
+// returns it as stored.
+func addRepacked(tx ParcelStore, draft Parcel, note string) (Parcel, error) {
+	id, err := tx.Add(draft)
+	if err != nil {
+		return draft, err
+	}
+	err = tx.AddHistory(StatusChange{Number: id, Status: draft.Status, ChangedAt: draft.CreatedAt, Note: note})
+	if err != nil {
+		return draft, err
+	}
+	return tx.Get(id)
+}
+
+// Split replaces a parcel repacked into several boxes at the warehouse
+// with pieces new parcels, which are returned. The pieces go to the same
+// client, destination and recipient as the original, in the same status
+// and with its deadline; the declared value is shared between them, and
+// they are to be weighed and measured again. The original is linked to
+// each piece as their parent and marked Repacked. The pieces join the
+// order of the original, if any. EventParcelRegistered is published for
+// every piece.
+//
+// Behaviour:
+//   - Returns ErrInvalidRepack (wrapped) unless pieces is between 2 and
+//     MaxSplitPieces, or if the parcel is delivered.
+//   - Returns ErrRepacked (wrapped) if the parcel was already repacked.
+//   - Returns ErrParcelNotFound (wrapped) if the parcel does not exist.
+func (s ParcelService) Split(number, pieces int) ([]Parcel, error) {
+	if pieces < 2 || pieces > MaxSplitPieces {
+		return nil, fmt.Errorf("failed to split parcel %d: %w: %d pieces, want 2 to %d", number, ErrInvalidRepack,
+			pieces, MaxSplitPieces)
+	}
+
+	now := s.timestamp(time.Now())
+	var res []Parcel
+	err := s.store.InTx(func(tx ParcelStore) error {
+		parent, err := tx.Get(number)
+		if err != nil {
+			return err
+		}
+		if err := checkRepackable(parent); err != nil {
+			return fmt.Errorf("failed to split parcel %d: %w", number, err)
+		}
+
+		order, err := tx.orderOf(number)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < pieces; i++ {
+			draft := repackedDraft(parent, now)
+			// the first pieces take the remainder, so the shares add up
+			draft.DeclaredValue = parent.DeclaredValue / pieces
+			if i < parent.DeclaredValue%pieces {
+				draft.DeclaredValue++
+			}
+			piece, err := addRepacked(tx, draft, fmt.Sprintf("split from parcel %d", number))
+			if err != nil {
+				return err
+			}
+			if err := tx.addLink(ParcelLink{Parent: number, Child: piece.Number, Kind: LinkSplit, CreatedAt: now}); err != nil {
+				return err
+			}
+			if order != 0 {
+				if err := tx.addOrderItem(order, piece.Number); err != nil {
+					return err
+				}
+			}
+			res = append(res, piece)
+		}
+
+		if err := tx.markRepacked(number); err != nil {
+			return err
+		}
+		return tx.AddHistory(StatusChange{Number: number, Status: parent.Status, ChangedAt: now,
+			Note: fmt.Sprintf("split into %d parcels", pieces)})
+	})
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	for _, p := range res {
+		s.events.Publish(Event{Type: EventParcelRegistered, Parcel: p, At: now})
+	}
+	return res, nil
+}
+
+// Merge replaces parcels consolidated into one box at the warehouse with
+// a new parcel, which is returned. The parcels must share client,
+// destination (including country and being international) and status.
+// The consolidated parcel takes the earliest deadline and the fastest
+// service class among them, the sum of their declared values and, if all
+// were weighed, of their weights; it holds the contents and HS codes of
+// all of them, is paid only if all of them are, and cash on delivery if
+// any is. It keeps their customs declaration reference only if they all
+// share it. It is linked to each merged parcel as their parent, and they
+// are marked Repacked. If they all belong to one order, it joins the
+// order.
+// EventParcelRegistered is published for it.
+//
+// Behaviour:
+//   - Returns ErrInvalidRepack (wrapped) for fewer than two distinct
+//     parcels, parcels that differ in client, destination or status, or
+//     a delivered parcel.
+//   - Returns ErrRepacked (wrapped) if a parcel was already repacked.
+//   - Returns ErrParcelNotFound (wrapped) if a parcel does not exist.
+func (s ParcelService) Merge(numbers []int) (Parcel, error) {
+	numbers = append([]int(nil), numbers...)
+	sort.Ints(numbers)
+	unique := numbers[:0]
+	for i, n := range numbers {
+		if i == 0 || n != numbers[i-1] {
+			unique = append(unique, n)
+		}
+	}
+	numbers = unique
+	if len(numbers) < 2 {
+		return Parcel{}, fmt.Errorf("failed to merge parcels: %w: at least two parcels are required", ErrInvalidRepack)
+	}
+
+	now := s.timestamp(time.Now())
+	var res Parcel
+	err := s.store.InTx(func(tx ParcelStore) error {
+		parcels := make([]Parcel, 0, len(numbers))
+		orders := map[int]bool{}
+		for _, n := range numbers {
+			p, err := tx.Get(n)
+			if err != nil {
+				return err
+			}
+			order, err := tx.orderOf(n)
+			if err != nil {
+				return err
+			}
+			orders[order] = true
+			if err := checkRepackable(p); err != nil {
+				return fmt.Errorf("failed to merge parcels: %w", err)
+			}
+			if len(parcels) > 0 {
+				first := parcels[0]
+				if p.Client != first.Client || p.Address != first.Address || p.PickupPoint != first.PickupPoint ||
+					p.International != first.International || p.Country != first.Country || p.Status != first.Status {
+					return fmt.Errorf("failed to merge parcels: %w: parcel %d differs from parcel %d in client, destination or status",
+						ErrInvalidRepack, p.Number, first.Number)
+				}
+				if p.Currency != first.Currency {
+					return fmt.Errorf("failed to merge parcels: %w: parcel %d is in %s, parcel %d in %s",
+						ErrCurrencyMismatch, p.Number, p.Currency, first.Number, first.Currency)
+				}
+			}
+			parcels = append(parcels, p)
+		}
+
+		draft := repackedDraft(parcels[0], now)
+		draft.Contents, draft.HSCodes = nil, nil
+		hsCodes := map[string]bool{}
+		weighed := true
+		names := make([]string, 0, len(parcels))
+		for _, p := range parcels {
+			if p.DueAt != "" && (draft.DueAt == "" || p.DueAt < draft.DueAt) {
+				draft.DueAt = p.DueAt
+			}
+			if classRank(p.ServiceClass) < classRank(draft.ServiceClass) {
+				draft.ServiceClass = p.ServiceClass
+			}
+			if p.Payment != PaymentPaid {
+				draft.Payment = PaymentUnpaid
+			}
+			draft.CashOnDelivery = draft.CashOnDelivery || p.CashOnDelivery
+			draft.Contents = append(draft.Contents, p.Contents...)
+			if p.CustomsReference != draft.CustomsReference {
+				// Parcels declared apart need a new declaration together.
+				draft.CustomsReference = ""
+			}
+			for _, code := range p.HSCodes {
+				if !hsCodes[code] {
+					hsCodes[code] = true
+					draft.HSCodes = append(draft.HSCodes, code)
+				}
+			}
+			draft.DeclaredValue += p.DeclaredValue
+			draft.WeightGrams += p.WeightGrams
+			weighed = weighed && p.WeightGrams > 0
+			names = append(names, strconv.Itoa(p.Number))
+		}
+		if !weighed {
+			draft.WeightGrams = 0
+		}
+
+		var err error
+		res, err = addRepacked(tx, draft, "merged from parcels "+strings.Join(names, ", "))
+		if err != nil {
+			return err
+		}
+		if len(orders) == 1 {
+			for order := range orders {
+				if order != 0 {
+					if err := tx.addOrderItem(order, res.Number); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		for _, p := range parcels {
+			if err := tx.addLink(ParcelLink{Parent: res.Number, Child: p.Number, Kind: LinkMerge, CreatedAt: now}); err != nil {
+				return err
+			}
+			if err := tx.markRepacked(p.Number); err != nil {
+				return err
+			}
+			err := tx.AddHistory(StatusChange{Number: p.Number, Status: p.Status, ChangedAt: now,
+				Note: fmt.Sprintf("merged into parcel %d", res.Number)})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Parcel{}, mapError(err)
+	}
+
+	s.events.Publish(Event{Type: EventParcelRegistered, Parcel: res, At: now})
+	return res, nil
+}
+
+// Links returns the split and merge links of the parcel.
+func (s ParcelService) Links(number int) ([]ParcelLink, error) {
+	if _, err := s.Get(number); err != nil {
+		return nil, err
+	}
+	return s.store.GetLinks(number)
+}
+
+// classRank returns the position of class in serviceClasses, fastest
+// first; unknown classes rank last.
+func classRank(class string) int {
+	for i, c := range serviceClasses {
+		if c == class {
+			return i
+		}
+	}
+	return len(serviceClasses)
+}
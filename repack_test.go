@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSplit checks that the pieces inherit the destination and share the
+// declared value, and that the original is linked and stops moving.
+func TestSplit(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	parent, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", DeclaredValue: 1001,
+		ServiceClass: ServiceExpress, Recipient: Recipient{Name: "Иван", Phone: "+79161234567"}})
+	require.NoError(t, err)
+	events := len(*published)
+
+	// check
+	_, err = service.Split(parent.Number, 1)
+	assert.ErrorIs(t, err, ErrInvalidRepack)
+	_, err = service.Split(999, 2)
+	assert.ErrorIs(t, err, ErrParcelNotFound)
+
+	pieces, err := service.Split(parent.Number, 3)
+	require.NoError(t, err)
+	require.Len(t, pieces, 3)
+	total := 0
+	for _, p := range pieces {
+		assert.Equal(t, parent.Client, p.Client)
+		assert.Equal(t, parent.Address, p.Address)
+		assert.Equal(t, parent.Recipient, p.Recipient)
+		assert.Equal(t, ServiceExpress, p.ServiceClass)
+		assert.Equal(t, parent.DueAt, p.DueAt)
+		assert.NotEqual(t, parent.TrackingCode, p.TrackingCode)
+		total += p.DeclaredValue
+	}
+	assert.Equal(t, 1001, total)
+	assert.Len(t, *published, events+3)
+
+	stored, err := service.Get(parent.Number)
+	require.NoError(t, err)
+	assert.True(t, stored.Repacked)
+	assert.ErrorIs(t, service.NextStatus(parent.Number), ErrRepacked)
+	_, err = service.Split(parent.Number, 2)
+	assert.ErrorIs(t, err, ErrRepacked)
+
+	links, err := service.Links(parent.Number)
+	require.NoError(t, err)
+	require.Len(t, links, 3)
+	assert.Equal(t, ParcelLink{Parent: parent.Number, Child: pieces[0].Number, Kind: LinkSplit, CreatedAt: links[0].CreatedAt}, links[0])
+	links, err = service.Links(pieces[1].Number)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, parent.Number, links[0].Parent)
+}
+
+// TestMerge checks the consolidated parcel and the checks on the parcels
+// merged.
+func TestMerge(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	register := func(draft Parcel) Parcel {
+		p, err := service.RegisterParcel(draft)
+		require.NoError(t, err)
+		return p
+	}
+	a := register(Parcel{Client: 1000, Address: "test", WeightGrams: 500, DeclaredValue: 100, Payment: PaymentPaid})
+	b := register(Parcel{Client: 1000, Address: "test", WeightGrams: 700, DeclaredValue: 200,
+		ServiceClass: ServiceExpress, CashOnDelivery: true})
+	other := register(Parcel{Client: 2000, Address: "test"})
+
+	// check
+	_, err := service.Merge([]int{a.Number, a.Number})
+	assert.ErrorIs(t, err, ErrInvalidRepack)
+	_, err = service.Merge([]int{a.Number, other.Number})
+	assert.ErrorIs(t, err, ErrInvalidRepack)
+
+	merged, err := service.Merge([]int{b.Number, a.Number})
+	require.NoError(t, err)
+	assert.Equal(t, 1200, merged.WeightGrams)
+	assert.Equal(t, 300, merged.DeclaredValue)
+	assert.Equal(t, ServiceExpress, merged.ServiceClass)
+	assert.Equal(t, b.DueAt, merged.DueAt)
+	assert.Equal(t, PaymentUnpaid, merged.Payment)
+	assert.True(t, merged.CashOnDelivery)
+
+	links, err := service.Links(merged.Number)
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	for _, l := range links {
+		assert.Equal(t, merged.Number, l.Parent)
+		assert.Equal(t, LinkMerge, l.Kind)
+	}
+	_, err = service.Merge([]int{a.Number, merged.Number})
+	assert.ErrorIs(t, err, ErrRepacked)
+
+	history, err := service.History(a.Number)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("merged into parcel %d", merged.Number), history[len(history)-1].Note)
+}
+
+// TestRepackHTTP checks /parcels/{number}/split, /parcels/merge and
+// /parcels/{number}/links.
+func TestRepackHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test"})
+	require.NoError(t, err)
+	h := NewHTTPHandler(service)
+
+	// check
+	rec := doRequest(t, h, http.MethodPost, fmt.Sprintf("/parcels/%d/split", parcel.Number), `{"pieces": 2}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var pieces []parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&pieces))
+	require.Len(t, pieces, 2)
+
+	body := fmt.Sprintf(`{"numbers": [%d, %d]}`, pieces[0].Number, pieces[1].Number)
+	rec = doRequest(t, h, http.MethodPost, "/parcels/merge", body)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var merged parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&merged))
+
+	rec = doRequest(t, h, http.MethodGet, fmt.Sprintf("/parcels/%d/links", pieces[0].Number), "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var links []parcelLinkJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&links))
+	require.Len(t, links, 2)
+	assert.Equal(t, LinkSplit, links[0].Kind)
+	assert.Equal(t, merged.Number, links[1].Parent)
+
+	assert.Equal(t, http.StatusConflict, doRequest(t, h, http.MethodPost, "/parcels/merge", body).Code)
+	assert.Equal(t, http.StatusBadRequest,
+		doRequest(t, h, http.MethodPost, fmt.Sprintf("/parcels/%d/split", merged.Number), `{"pieces": 0}`).Code)
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrUnknownReport indicates a report name that ReportCSV does not know.
+var ErrUnknownReport = errors.New("unknown report")
+
+// ReportPeriod selects the parcels registered in [From, To). A zero bound
+// leaves that side open. Archived parcels are not included in reports.
+type ReportPeriod struct {
+	From, To time.Time
+}
+
+// StatusCount is the number of parcels in one status.
+type StatusCount struct {
+	Status string
+	Count  int
+}
+
+// ClientCount is the number of parcels of one client.
+type ClientCount struct {
+	Client int
+	Count  int
+}
+
+// DayCount is the number of parcels registered on one day (UTC),
+// formatted as YYYY-MM-DD.
+type DayCount struct {
+	Day   string
+	Count int
+}
+
+// ClassOverdue is the number of undelivered parcels of one service class
+// and how many of them are past their deadline.
+type ClassOverdue struct {
+	Class   string
+	Open    int
+	Overdue int
+}
+
+// DeliveryReport summarises how parcels were delivered.
+type DeliveryReport struct {
+	// Delivered is the number of delivered parcels.
+	Delivered int
+	// AverageDuration is the mean time from registration to the first
+	// delivered entry of the status history.
+	AverageDuration time.Duration
+	// OnTime and Late count the delivered parcels that had a deadline,
+	// by whether they were delivered before it.
+	OnTime, Late int
+	// SuccessRate is OnTime / (OnTime + Late), or 0 if no delivered
+	// parcel had a deadline.
+	SuccessRate float64
+}
+
+// apply adds the conditions on parcel.created_at for the period to q.
+func (p ReportPeriod) apply(q selectQuery) selectQuery {
+	if !p.From.IsZero() {
+		q = q.Where("julianday(parcel.created_at) >= julianday(?)", FormatTimestamp(p.From, DefaultTimestampPrecision))
+	}
+	if !p.To.IsZero() {
+		q = q.Where("julianday(parcel.created_at) < julianday(?)", FormatTimestamp(p.To, DefaultTimestampPrecision))
+	}
+	return q
+}
+
+// CountByStatus returns the number of parcels per status, in the order of
+// the statuses; statuses without parcels are reported with a zero count.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) CountByStatus(period ReportPeriod) ([]StatusCount, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query, args := period.apply(selectFrom("parcel", "status, COUNT(*)")).GroupBy("status").build()
+	counts := map[string]int{}
+	err := s.scanReport("status report", query, args,
+		func(rows *sql.Rows) error {
+			var status string
+			var n int
+			if err := rows.Scan(&status, &n); err != nil {
+				return err
+			}
+			counts[status] = n
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]StatusCount, 0, len(parcelStatuses))
+	for _, status := range parcelStatuses {
+		res = append(res, StatusCount{Status: status, Count: counts[status]})
+	}
+	return res, nil
+}
+
+// CountByClient returns the number of parcels per client, busiest client
+// first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if no parcel was registered in the period.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) CountByClient(period ReportPeriod) ([]ClientCount, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query, args := period.apply(selectFrom("parcel", "client, COUNT(*) AS n")).
+		GroupBy("client").OrderBy("n DESC", "client").build()
+	var res []ClientCount
+	err := s.scanReport("client report", query, args, func(rows *sql.Rows) error {
+		var c ClientCount
+		if err := rows.Scan(&c.Client, &c.Count); err != nil {
+			return err
+		}
+		res = append(res, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// CountByDay returns the number of parcels registered per day, oldest day
+// first. Days without registrations are omitted.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if no parcel was registered in the period.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) CountByDay(period ReportPeriod) ([]DayCount, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	// Timestamps are stored in UTC as RFC 3339, so the date is a prefix.
+	query, args := period.apply(selectFrom("parcel", "substr(created_at, 1, 10) AS day, COUNT(*)")).
+		GroupBy("day").OrderBy("day").build()
+	var res []DayCount
+	err := s.scanReport("daily report", query, args, func(rows *sql.Rows) error {
+		var c DayCount
+		if err := rows.Scan(&c.Day, &c.Count); err != nil {
+			return err
+		}
+		res = append(res, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// CountOverdueByClass returns, per service class from express to economy,
+// the number of undelivered parcels registered in the period and how many
+// of them are overdue at now (see GetOverdue). Classes without parcels
+// are reported with zero counts.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) CountOverdueByClass(period ReportPeriod, now time.Time) ([]ClassOverdue, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	q := selectFrom("parcel", "service_class, COUNT(*), COALESCE(SUM(due_at != '' AND due_at < ?), 0)",
+		FormatTimestamp(now, DefaultTimestampPrecision)).Where("status != ?", ParcelStatusDelivered)
+	query, args := period.apply(q).GroupBy("service_class").build()
+	counts := map[string]ClassOverdue{}
+	err := s.scanReport("overdue report", query, args, func(rows *sql.Rows) error {
+		var c ClassOverdue
+		if err := rows.Scan(&c.Class, &c.Open, &c.Overdue); err != nil {
+			return err
+		}
+		counts[c.Class] = c
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]ClassOverdue, 0, len(serviceClasses))
+	for _, class := range serviceClasses {
+		c := counts[class]
+		c.Class = class
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+// DeliveryStats returns the delivery report of the parcels registered in
+// the period.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Delivered parcels without a delivery time (see Parcel.DeliveredAt)
+//     count as delivered but do not contribute to the durations or the
+//     success rate.
+//   - Wraps and returns any SQL errors.
+func (s ParcelStore) DeliveryStats(period ReportPeriod) (DeliveryReport, error) {
+	var res DeliveryReport
+	if err := s.check(); err != nil {
+		return res, err
+	}
+
+	delivered, args := period.apply(selectFrom("parcel", "parcel.created_at, parcel.due_at, NULLIF(parcel.delivered_at, '') AS delivered_at").
+		Where("parcel.status = ?", ParcelStatusDelivered)).build()
+	query := `WITH delivered AS (` + delivered + `)
+SELECT COUNT(*),
+    COALESCE(AVG((julianday(delivered_at) - julianday(created_at)) * 86400), 0),
+    COUNT(CASE WHEN due_at != '' AND delivered_at <= due_at THEN 1 END),
+    COUNT(CASE WHEN due_at != '' AND delivered_at > due_at THEN 1 END)
+FROM delivered`
+
+	var seconds float64
+	err := s.conn().QueryRow(query, args...).Scan(&res.Delivered, &seconds, &res.OnTime, &res.Late)
+	if err != nil {
+		return res, fmt.Errorf("failed to scan delivery report: %w", err)
+	}
+	res.AverageDuration = time.Duration(seconds * float64(time.Second)).Round(time.Second)
+	if n := res.OnTime + res.Late; n > 0 {
+		res.SuccessRate = float64(res.OnTime) / float64(n)
+	}
+	return res, nil
+}
+
+// scanReport runs a report query and calls scan for every row; what
+// describes the report in error messages.
+func (s ParcelStore) scanReport(what, query string, args []any, scan func(*sql.Rows) error) error {
+	rows, err := s.conn().Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to get cursor for %s: %w", what, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows.Rows); err != nil {
+			return fmt.Errorf("failed to scan one of rows of %s: %w", what, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows of %s: %w", what, err)
+	}
+	return nil
+}
+
+// reportNames lists the reports of ReportCSV.
+var reportNames = []string{"status", "client", "day", "delivery", "overdue"}
+
+// ReportCSV returns the named report ("status", "client", "day",
+// "delivery" or "overdue", which counts overdue parcels per service class
+// as of now) as CSV records, the first of which is the header.
+// Durations are in seconds and the success rate is a fraction.
+func ReportCSV(store ParcelStore, name string, period ReportPeriod) ([][]string, error) {
+	itoa := strconv.Itoa
+	switch name {
+	case "status":
+		counts, err := store.CountByStatus(period)
+		if err != nil {
+			return nil, err
+		}
+		res := [][]string{{"status", "count"}}
+		for _, c := range counts {
+			res = append(res, []string{c.Status, itoa(c.Count)})
+		}
+		return res, nil
+	case "client":
+		counts, err := store.CountByClient(period)
+		if err != nil {
+			return nil, err
+		}
+		res := [][]string{{"client", "count"}}
+		for _, c := range counts {
+			res = append(res, []string{itoa(c.Client), itoa(c.Count)})
+		}
+		return res, nil
+	case "day":
+		counts, err := store.CountByDay(period)
+		if err != nil {
+			return nil, err
+		}
+		res := [][]string{{"day", "count"}}
+		for _, c := range counts {
+			res = append(res, []string{c.Day, itoa(c.Count)})
+		}
+		return res, nil
+	case "delivery":
+		r, err := store.DeliveryStats(period)
+		if err != nil {
+			return nil, err
+		}
+		return [][]string{
+			{"delivered", "average_duration_seconds", "on_time", "late", "success_rate"},
+			{itoa(r.Delivered), strconv.FormatInt(int64(r.AverageDuration/time.Second), 10), itoa(r.OnTime), itoa(r.Late),
+				strconv.FormatFloat(r.SuccessRate, 'f', 4, 64)},
+		}, nil
+	case "overdue":
+		counts, err := store.CountOverdueByClass(period, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		res := [][]string{{"service_class", "open", "overdue"}}
+		for _, c := range counts {
+			res = append(res, []string{c.Class, itoa(c.Open), itoa(c.Overdue)})
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("%w %q (want one of %v)", ErrUnknownReport, name, reportNames)
+}
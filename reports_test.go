@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReports checks the counts and the delivery report over a small set
+// of parcels registered on two days.
+func TestReports(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	day1 := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	add := func(client int, status string, createdAt time.Time, due time.Duration, deliveredAfter time.Duration) {
+		p := getTestParcel()
+		p.Client = client
+		p.Status = status
+		p.CreatedAt = FormatTimestamp(createdAt, DefaultTimestampPrecision)
+		if due > 0 {
+			p.DueAt = FormatTimestamp(createdAt.Add(due), DefaultTimestampPrecision)
+		}
+		if deliveredAfter > 0 {
+			p.DeliveredAt = FormatTimestamp(createdAt.Add(deliveredAfter), DefaultTimestampPrecision)
+		}
+		number, err := store.Add(p)
+		require.NoError(t, err)
+		if deliveredAfter > 0 {
+			require.NoError(t, store.AddHistory(StatusChange{Number: number, Status: ParcelStatusDelivered,
+				ChangedAt: p.DeliveredAt}))
+		}
+	}
+	add(1, ParcelStatusRegistered, day1, 0, 0)
+	add(1, ParcelStatusDelivered, day1, 48*time.Hour, 24*time.Hour)
+	add(2, ParcelStatusDelivered, day2, 24*time.Hour, 48*time.Hour)
+	add(1, ParcelStatusSent, day2, 0, 0)
+
+	// check
+	statuses, err := store.CountByStatus(ReportPeriod{})
+	require.NoError(t, err)
+	assert.Equal(t, []StatusCount{{ParcelStatusRegistered, 1}, {ParcelStatusSent, 1}, {ParcelStatusCustomsCleared, 0},
+		{ParcelStatusDelivered, 2}}, statuses)
+
+	clients, err := store.CountByClient(ReportPeriod{})
+	require.NoError(t, err)
+	assert.Equal(t, []ClientCount{{1, 3}, {2, 1}}, clients)
+
+	days, err := store.CountByDay(ReportPeriod{})
+	require.NoError(t, err)
+	assert.Equal(t, []DayCount{{"2024-03-01", 2}, {"2024-03-02", 2}}, days)
+
+	delivery, err := store.DeliveryStats(ReportPeriod{})
+	require.NoError(t, err)
+	assert.Equal(t, DeliveryReport{Delivered: 2, AverageDuration: 36 * time.Hour, OnTime: 1, Late: 1, SuccessRate: 0.5}, delivery)
+
+	days, err = store.CountByDay(ReportPeriod{From: day2.Truncate(24 * time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, []DayCount{{"2024-03-02", 2}}, days)
+	clients, err = store.CountByClient(ReportPeriod{To: day1.Add(-time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, clients)
+
+	records, err := ReportCSV(store, "delivery", ReportPeriod{})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"delivered", "average_duration_seconds", "on_time", "late", "success_rate"},
+		{"2", "129600", "1", "1", "0.5000"},
+	}, records)
+	_, err = ReportCSV(store, "weekly", ReportPeriod{})
+	assert.ErrorIs(t, err, ErrUnknownReport)
+}
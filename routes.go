@@ -0,0 +1,420 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// routeDayLayout is the format of Route.Day.
+const routeDayLayout = "2006-01-02"
+
+var (
+	// ErrRouteNotFound indicates that no route exists with the requested id.
+	ErrRouteNotFound = newError(CodeRouteNotFound, "route not found")
+	// ErrInvalidRoute indicates a route or a reordering of its stops that
+	// failed validation.
+	ErrInvalidRoute = newError(CodeInvalidRoute, "invalid route")
+	// ErrRequireSent indicates an operation allowed only for sent parcels
+	// ready for delivery, i.e. international ones cleared through customs.
+	ErrRequireSent = newError(CodeRequiresSent, "requires sent status")
+	// ErrParcelOnRoute indicates that a parcel is already a stop of a route.
+	ErrParcelOnRoute = newError(CodeParcelOnRoute, "parcel already on a route")
+)
+
+// Route is the delivery round of one courier on one day.
+type Route struct {
+	ID      int
+	Courier string
+	// Day is the delivery date, YYYY-MM-DD.
+	Day       string
+	CreatedAt string
+	// Stops are in delivery order.
+	Stops []RouteStop
+}
+
+// RouteStop is a parcel to deliver on a route.
+type RouteStop struct {
+	Parcel int
+	// Position is the 1-based place of the stop in the route.
+	Position int
+	// CompletedAt is empty until the parcel is delivered.
+	CompletedAt string
+	// WindowFrom and WindowTo are the delivery window the recipient chose,
+	// empty if none; see ParcelService.Reschedule.
+	WindowFrom string
+	WindowTo   string
+}
+
+// CreateRoute creates an empty route for courier on day (YYYY-MM-DD).
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidRoute (wrapped) if the courier is blank, the day
+//     is not a date or the courier already has a route that day.
+//   - Wraps and returns any SQL error from the INSERT.
+func (s ParcelStore) CreateRoute(courier, day string) (Route, error) {
+	r := Route{Courier: strings.TrimSpace(courier), Day: day, CreatedAt: FormatTimestamp(time.Now(), DefaultTimestampPrecision)}
+
+	if err := s.check(); err != nil {
+		return r, err
+	}
+	if r.Courier == "" {
+		return r, fmt.Errorf("failed to create route: %w: empty courier", ErrInvalidRoute)
+	}
+	if _, err := time.Parse(routeDayLayout, day); err != nil {
+		return r, fmt.Errorf("failed to create route: %w: day %q is not YYYY-MM-DD", ErrInvalidRoute, day)
+	}
+
+	err := s.InTx(func(tx ParcelStore) error {
+		var existing int
+		err := tx.conn().QueryRow("SELECT id FROM route WHERE courier = :courier AND day = :day",
+			sql.Named("courier", r.Courier), sql.Named("day", day)).Scan(&existing)
+		if err == nil {
+			return fmt.Errorf("failed to create route: %w: courier %q already has route %d on %s",
+				ErrInvalidRoute, r.Courier, existing, day)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to look up route of courier %q on %s: %w", r.Courier, day, err)
+		}
+
+		query := "INSERT INTO route (courier, day, created_at) VALUES (:courier, :day, :created_at)"
+		res, err := tx.conn().Exec(query, sql.Named("courier", r.Courier), sql.Named("day", day),
+			sql.Named("created_at", r.CreatedAt))
+		if err != nil {
+			return fmt.Errorf("failed to create route of courier %q on %s: %w", r.Courier, day, err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get id of route of courier %q on %s: %w", r.Courier, day, err)
+		}
+		r.ID = int(id)
+		return nil
+	})
+	return r, err
+}
+
+// GetRoute returns the route with the given id and its stops.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrRouteNotFound (wrapped) if no such route exists.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) GetRoute(id int) (Route, error) {
+	if err := s.check(); err != nil {
+		return Route{}, err
+	}
+
+	r := Route{ID: id}
+	err := s.conn().QueryRow("SELECT courier, day, created_at FROM route WHERE id = :id", sql.Named("id", id)).
+		Scan(&r.Courier, &r.Day, &r.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return r, fmt.Errorf("failed to get route %d: %w", id, ErrRouteNotFound)
+	}
+	if err != nil {
+		return r, fmt.Errorf("failed to scan route row with id %d: %w", id, err)
+	}
+
+	r.Stops, err = s.getRouteStops(id)
+	return r, err
+}
+
+// GetRoutes returns the routes of day with their stops, ordered by
+// courier; an empty day returns every route, latest day first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Wraps and returns any SQL errors from query, scanning, or iteration.
+func (s ParcelStore) GetRoutes(day string) ([]Route, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT id, courier, day, created_at FROM route WHERE :day = '' OR day = :day ORDER BY day DESC, courier"
+	rows, err := s.conn().Query(query, sql.Named("day", day))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for routes on %q: %w", day, err)
+	}
+	defer rows.Close()
+
+	var res []Route
+	for rows.Next() {
+		var r Route
+		if err := rows.Scan(&r.ID, &r.Courier, &r.Day, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan one of route rows: %w", err)
+		}
+		res = append(res, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate route rows: %w", err)
+	}
+	rows.Close()
+
+	for i := range res {
+		if res[i].Stops, err = s.getRouteStops(res[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// AddRouteStop appends the parcel with the given number to the end of
+// the route.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrRouteNotFound (wrapped) if no such route exists.
+//   - Returns sql.ErrNoRows (wrapped) if no such parcel exists.
+//   - Returns ErrRequireSent (wrapped) unless the parcel is ready for
+//     delivery (see NextStatus).
+//   - Returns ErrParcelOnRoute (wrapped) if the parcel is already a stop
+//     of this or another route.
+//   - Returns ErrInvalidRoute (wrapped) if the recipient chose to have the
+//     parcel delivered on another day than that of the route.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) AddRouteStop(route, number int) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	return s.InTx(func(tx ParcelStore) error {
+		r, err := tx.GetRoute(route)
+		if err != nil {
+			return err
+		}
+		parcel, err := tx.Get(number)
+		if err != nil {
+			return err
+		}
+		if !readyForDelivery(parcel) {
+			return fmt.Errorf("failed to add parcel %d to route %d: %w, actual status: %s", number, route, ErrRequireSent,
+				parcel.Status)
+		}
+		if day := parcel.DeliveryWindow.Day; day != "" && day != r.Day {
+			return fmt.Errorf("failed to add parcel %d to route %d: %w: parcel is to be delivered on %s", number, route,
+				ErrInvalidRoute, day)
+		}
+
+		var other int
+		err = tx.conn().QueryRow("SELECT route_id FROM route_stop WHERE parcel_number = :number", sql.Named("number", number)).
+			Scan(&other)
+		if err == nil {
+			return fmt.Errorf("failed to add parcel %d to route %d: %w %d", number, route, ErrParcelOnRoute, other)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to look up route of parcel %d: %w", number, err)
+		}
+
+		query := "INSERT INTO route_stop (route_id, parcel_number, position) VALUES (:route, :number, :position)"
+		_, err = tx.conn().Exec(query, sql.Named("route", route), sql.Named("number", number),
+			sql.Named("position", len(r.Stops)+1))
+		if err != nil {
+			return fmt.Errorf("failed to add parcel %d to route %d: %w", number, route, referenceError(err))
+		}
+		return nil
+	})
+}
+
+// RemoveRouteStop takes the parcel with the given number off the route,
+// closing the gap it leaves. Completed stops cannot be removed.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrRouteNotFound (wrapped) if the route does not exist or
+//     has no such stop.
+//   - Returns ErrInvalidRoute (wrapped) if the stop is completed.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) RemoveRouteStop(route, number int) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	return s.InTx(func(tx ParcelStore) error {
+		stop, err := tx.getRouteStop(route, number)
+		if err != nil {
+			return err
+		}
+		if stop.CompletedAt != "" {
+			return fmt.Errorf("failed to remove parcel %d from route %d: %w: stop completed at %s",
+				number, route, ErrInvalidRoute, stop.CompletedAt)
+		}
+
+		args := []any{sql.Named("route", route), sql.Named("number", number), sql.Named("position", stop.Position)}
+		if _, err := tx.conn().Exec("DELETE FROM route_stop WHERE route_id = :route AND parcel_number = :number", args...); err != nil {
+			return fmt.Errorf("failed to remove parcel %d from route %d: %w", number, route, err)
+		}
+		query := "UPDATE route_stop SET position = position - 1 WHERE route_id = :route AND position > :position"
+		if _, err := tx.conn().Exec(query, args...); err != nil {
+			return fmt.Errorf("failed to renumber stops of route %d: %w", route, err)
+		}
+		return nil
+	})
+}
+
+// ReorderRouteStops puts the stops of the route in the order of numbers,
+// which must list every parcel of the route exactly once.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrRouteNotFound (wrapped) if no such route exists.
+//   - Returns ErrInvalidRoute (wrapped) if numbers is not a permutation
+//     of the route's parcels.
+//   - Wraps and returns any SQL error; on error the order is unchanged.
+func (s ParcelStore) ReorderRouteStops(route int, numbers []int) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	return s.InTx(func(tx ParcelStore) error {
+		r, err := tx.GetRoute(route)
+		if err != nil {
+			return err
+		}
+
+		onRoute := make(map[int]bool, len(r.Stops))
+		for _, stop := range r.Stops {
+			onRoute[stop.Parcel] = true
+		}
+		if len(numbers) != len(r.Stops) {
+			return fmt.Errorf("failed to reorder route %d: %w: %d stops given, route has %d",
+				route, ErrInvalidRoute, len(numbers), len(r.Stops))
+		}
+		for _, n := range numbers {
+			if !onRoute[n] {
+				return fmt.Errorf("failed to reorder route %d: %w: parcel %d is not a stop or is listed twice",
+					route, ErrInvalidRoute, n)
+			}
+			delete(onRoute, n)
+		}
+
+		query := "UPDATE route_stop SET position = :position WHERE route_id = :route AND parcel_number = :number"
+		for i, n := range numbers {
+			_, err := tx.conn().Exec(query, sql.Named("position", i+1), sql.Named("route", route), sql.Named("number", n))
+			if err != nil {
+				return fmt.Errorf("failed to move parcel %d of route %d: %w", n, route, err)
+			}
+		}
+		return nil
+	})
+}
+
+// completeRouteStop records the stop of parcel number on the route as
+// completed at the given time. Completing a completed stop keeps its
+// original time.
+func (s ParcelStore) completeRouteStop(route, number int, at string) error {
+	query := "UPDATE route_stop SET completed_at = :at WHERE route_id = :route AND parcel_number = :number AND completed_at = ''"
+	_, err := s.conn().Exec(query, sql.Named("at", at), sql.Named("route", route), sql.Named("number", number))
+	if err != nil {
+		return fmt.Errorf("failed to complete stop of parcel %d on route %d: %w", number, route, err)
+	}
+	return nil
+}
+
+// getRouteStop returns the stop of parcel number on the route, or
+// ErrRouteNotFound (wrapped) if there is none.
+func (s ParcelStore) getRouteStop(route, number int) (RouteStop, error) {
+	stop := RouteStop{Parcel: number}
+	query := "SELECT position, completed_at FROM route_stop WHERE route_id = :route AND parcel_number = :number"
+	err := s.conn().QueryRow(query, sql.Named("route", route), sql.Named("number", number)).
+		Scan(&stop.Position, &stop.CompletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return stop, fmt.Errorf("failed to get stop of parcel %d: %w: route %d has no such stop", number, ErrRouteNotFound, route)
+	}
+	if err != nil {
+		return stop, fmt.Errorf("failed to scan stop of parcel %d on route %d: %w", number, route, err)
+	}
+	return stop, nil
+}
+
+// getRouteStops returns the stops of the route in delivery order.
+func (s ParcelStore) getRouteStops(route int) ([]RouteStop, error) {
+	query := `SELECT s.parcel_number, s.position, s.completed_at, COALESCE(p.delivery_from, ''), COALESCE(p.delivery_to, '')
+FROM route_stop s LEFT JOIN parcel p ON p.number = s.parcel_number WHERE s.route_id = :route ORDER BY s.position`
+	rows, err := s.conn().Query(query, sql.Named("route", route))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for stops of route %d: %w", route, err)
+	}
+	defer rows.Close()
+
+	var res []RouteStop
+	for rows.Next() {
+		var stop RouteStop
+		if err := rows.Scan(&stop.Parcel, &stop.Position, &stop.CompletedAt, &stop.WindowFrom, &stop.WindowTo); err != nil {
+			return nil, fmt.Errorf("failed to scan one of stop rows of route %d: %w", route, err)
+		}
+		res = append(res, stop)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate stop rows of route %d: %w", route, err)
+	}
+	return res, nil
+}
+
+// CreateRoute creates an empty route for courier on day; see
+// ParcelStore.CreateRoute.
+func (s ParcelService) CreateRoute(courier, day string) (Route, error) {
+	return s.store.CreateRoute(courier, day)
+}
+
+// Route returns the route with the given id.
+func (s ParcelService) Route(id int) (Route, error) {
+	return s.store.GetRoute(id)
+}
+
+// Routes returns the routes of day, or every route if day is empty.
+func (s ParcelService) Routes(day string) ([]Route, error) {
+	return s.store.GetRoutes(day)
+}
+
+// AddRouteStop appends a sent parcel to the route.
+func (s ParcelService) AddRouteStop(route, number int) error {
+	return mapError(s.store.AddRouteStop(route, number))
+}
+
+// RemoveRouteStop takes a parcel that has not been delivered off the route.
+func (s ParcelService) RemoveRouteStop(route, number int) error {
+	return s.store.RemoveRouteStop(route, number)
+}
+
+// ReorderRoute puts the stops of the route in the order of numbers.
+func (s ParcelService) ReorderRoute(route int, numbers []int) error {
+	return s.store.ReorderRouteStops(route, numbers)
+}
+
+// CompleteRouteStop marks the stop of the parcel on the route as
+// completed and delivers the parcel as NextStatus does, publishing
+// EventStatusChanged (and EventPaymentChanged for cash on delivery).
+// A completed stop is left unchanged; a stop whose parcel is not sent
+// returns ErrRequireSent (wrapped).
+func (s ParcelService) CompleteRouteStop(route, number int) error {
+	var res advanced
+
+	err := s.store.InTx(func(tx ParcelStore) error {
+		stop, err := tx.getRouteStop(route, number)
+		if err != nil || stop.CompletedAt != "" {
+			return err
+		}
+		parcel, err := tx.Get(number)
+		if err != nil {
+			return err
+		}
+		if !readyForDelivery(parcel) {
+			return fmt.Errorf("failed to complete stop of parcel %d on route %d: %w, actual status: %s",
+				number, route, ErrRequireSent, parcel.Status)
+		}
+
+		if err := tx.completeRouteStop(route, number, s.timestamp(time.Now())); err != nil {
+			return err
+		}
+		res, err = s.advance(tx, parcel)
+		return err
+	})
+	if err != nil {
+		return mapError(err)
+	}
+
+	s.publishAdvanced(res)
+	return nil
+}
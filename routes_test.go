@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRouteStops verifies adding, reordering and removing route stops.
+func TestRouteStops(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	var sent []int
+	for i := 0; i < 3; i++ {
+		parcel := getTestParcel()
+		parcel.Status = ParcelStatusSent
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		sent = append(sent, id)
+	}
+	registered, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// create
+	route, err := store.CreateRoute(" courier-1 ", "2024-05-01")
+	require.NoError(t, err)
+	assert.Equal(t, "courier-1", route.Courier)
+
+	_, err = store.CreateRoute("courier-1", "2024-05-01")
+	require.ErrorIs(t, err, ErrInvalidRoute)
+	_, err = store.CreateRoute("courier-1", "01.05.2024")
+	require.ErrorIs(t, err, ErrInvalidRoute)
+	other, err := store.CreateRoute("courier-2", "2024-05-01")
+	require.NoError(t, err)
+
+	// add
+	for _, id := range sent {
+		require.NoError(t, store.AddRouteStop(route.ID, id))
+	}
+	require.ErrorIs(t, store.AddRouteStop(route.ID, registered), ErrRequireSent)
+	require.ErrorIs(t, store.AddRouteStop(other.ID, sent[0]), ErrParcelOnRoute)
+	require.ErrorIs(t, store.AddRouteStop(route.ID+100, sent[0]), ErrRouteNotFound)
+
+	// reorder
+	require.ErrorIs(t, store.ReorderRouteStops(route.ID, []int{sent[0], sent[0], sent[1]}), ErrInvalidRoute)
+	require.ErrorIs(t, store.ReorderRouteStops(route.ID, sent[:2]), ErrInvalidRoute)
+	require.NoError(t, store.ReorderRouteStops(route.ID, []int{sent[2], sent[0], sent[1]}))
+
+	// remove
+	require.NoError(t, store.RemoveRouteStop(route.ID, sent[0]))
+	require.ErrorIs(t, store.RemoveRouteStop(route.ID, sent[0]), ErrRouteNotFound)
+
+	// check
+	stored, err := store.GetRoute(route.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []RouteStop{{Parcel: sent[2], Position: 1}, {Parcel: sent[1], Position: 2}}, stored.Stops)
+
+	routes, err := store.GetRoutes("2024-05-01")
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+	assert.Equal(t, route.ID, routes[0].ID)
+	assert.Empty(t, routes[1].Stops)
+
+	routes, err = store.GetRoutes("2024-05-02")
+	require.NoError(t, err)
+	assert.Empty(t, routes)
+}
+
+// TestCompleteRouteStop verifies that completing a stop delivers the
+// parcel and that completing it again changes nothing.
+func TestCompleteRouteStop(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", CashOnDelivery: true})
+	require.NoError(t, err)
+	route, err := service.CreateRoute("courier-1", "2024-05-01")
+	require.NoError(t, err)
+	require.ErrorIs(t, service.AddRouteStop(route.ID, parcel.Number), ErrRequireSent)
+	require.ErrorIs(t, service.AddRouteStop(route.ID, parcel.Number+100), ErrParcelNotFound)
+	require.NoError(t, service.NextStatus(parcel.Number))
+	require.NoError(t, service.AddRouteStop(route.ID, parcel.Number))
+	*published = nil
+
+	// complete
+	require.NoError(t, service.CompleteRouteStop(route.ID, parcel.Number))
+	require.NoError(t, service.CompleteRouteStop(route.ID, parcel.Number))
+
+	// check
+	stored, err := service.Get(parcel.Number)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusDelivered, stored.Status)
+	assert.Equal(t, PaymentPaid, stored.Payment)
+
+	route, err = service.Route(route.ID)
+	require.NoError(t, err)
+	require.Len(t, route.Stops, 1)
+	assert.NotEmpty(t, route.Stops[0].CompletedAt)
+
+	require.Len(t, *published, 2)
+	assert.Equal(t, EventStatusChanged, (*published)[0].Type)
+	assert.Equal(t, ParcelStatusSent, (*published)[0].PrevStatus)
+	assert.Equal(t, EventPaymentChanged, (*published)[1].Type)
+
+	require.ErrorIs(t, service.RemoveRouteStop(route.ID, parcel.Number), ErrInvalidRoute)
+}
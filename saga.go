@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrCompensationFailed indicates a failed unit of work that could not
+	// be undone entirely: a compensation failed too, and what it should
+	// have undone needs attention.
+	ErrCompensationFailed = errors.New("compensation failed")
+	// ErrAfterCommitFailed indicates a unit of work that was committed but
+	// one of whose after-commit steps failed.
+	ErrAfterCommitFailed = errors.New("after-commit step failed")
+)
+
+// UnitOfWork is a workflow of several steps run by ParcelService.Work,
+// such as creating an order with its parcels, booking a courier and
+// notifying the client, which either completes or is undone.
+//
+// The database steps are made with Service in one transaction, so they
+// are committed together or not at all. Steps beyond the database, such
+// as booking with a courier company, register a compensation that undoes
+// them if the work fails later; steps that must not happen unless the
+// work is done, such as notifying, run after the commit.
+//
+// A UnitOfWork is not safe for concurrent use.
+type UnitOfWork struct {
+	// Service makes the database steps in the transaction of the unit.
+	// The events it publishes are held back until the commit and dropped
+	// on rollback. Calling Work on it joins this unit.
+	Service ParcelService
+
+	compensations []workStep
+	afterCommit   []workStep
+}
+
+// workStep is a compensation or an after-commit step of a UnitOfWork.
+type workStep struct {
+	name string
+	fn   func() error
+}
+
+// Compensate registers undo to run if the work fails after this point;
+// name describes it in errors.
+func (u *UnitOfWork) Compensate(name string, undo func() error) {
+	u.compensations = append(u.compensations, workStep{name: name, fn: undo})
+}
+
+// AfterCommit registers fn to run once the work is committed; name
+// describes it in errors.
+func (u *UnitOfWork) AfterCommit(name string, fn func() error) {
+	u.afterCommit = append(u.afterCommit, workStep{name: name, fn: fn})
+}
+
+// Work runs fn as a unit of work; see UnitOfWork.
+//
+// Behaviour:
+//   - Runs fn with a UnitOfWork whose Service is bound to one
+//     transaction, committed if fn returns nil and rolled back otherwise.
+//   - If fn or the commit fails, runs the compensations registered, most
+//     recent first, and returns the error. Every compensation runs even
+//     if one fails; the error then wraps ErrCompensationFailed and the
+//     failures as well.
+//   - Once committed, publishes the events held back, in order, then runs
+//     the after-commit steps, in order. Every step runs even if one
+//     fails; the error then wraps ErrAfterCommitFailed and the failures,
+//     but the work stands.
+//   - Called on the Service of a unit, runs fn in that unit: its steps
+//     commit, compensate and run after commit with those of the unit.
+func (s ParcelService) Work(fn func(u *UnitOfWork) error) error {
+	if s.work != nil {
+		return fn(s.work)
+	}
+
+	var held []Event
+	events := NewEventBus()
+	events.Subscribe(func(e Event) { held = append(held, e) })
+
+	u := &UnitOfWork{}
+	err := s.store.InTx(func(tx ParcelStore) error {
+		u.Service = s
+		u.Service.store = tx
+		u.Service.events = events
+		u.Service.work = u
+		return fn(u)
+	})
+	if err != nil {
+		return u.compensate(err)
+	}
+
+	for _, e := range held {
+		s.events.Publish(e)
+	}
+	var errs []error
+	for _, step := range u.afterCommit {
+		if err := step.fn(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", step.name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrAfterCommitFailed, errors.Join(errs...))
+	}
+	return nil
+}
+
+// compensate runs the compensations of the unit after it failed with
+// err, and returns err with the failures of any.
+func (u *UnitOfWork) compensate(err error) error {
+	var errs []error
+	for i := len(u.compensations) - 1; i >= 0; i-- {
+		step := u.compensations[i]
+		if cerr := step.fn(); cerr != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", step.name, cerr))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w (%w: %w)", err, ErrCompensationFailed, errors.Join(errs...))
+	}
+	return err
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWork verifies that a unit of work commits its steps together,
+// publishes its events only then and runs its after-commit steps.
+func TestWork(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	var notified []int
+	var order Order
+
+	// work
+	err := service.Work(func(u *UnitOfWork) error {
+		var err error
+		order, err = u.Service.CreateOrder(1000)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 3; i++ {
+			p, err := u.Service.Register(1000, "test")
+			if err != nil {
+				return err
+			}
+			if err := u.Service.AddOrderParcel(order.ID, p.Number); err != nil {
+				return err
+			}
+		}
+		assert.Empty(t, *published)
+		u.AfterCommit("notify client", func() error {
+			notified = append(notified, order.ID)
+			return nil
+		})
+		return nil
+	})
+	require.NoError(t, err)
+
+	// check
+	parcels, err := service.GetByOrder(order.ID)
+	require.NoError(t, err)
+	assert.Len(t, parcels, 3)
+	assert.Len(t, *published, 3)
+	assert.Equal(t, []int{order.ID}, notified)
+}
+
+// TestWorkFailure verifies that a failed unit of work is rolled back,
+// compensated most recent step first, and publishes and notifies
+// nothing.
+func TestWorkFailure(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	other, err := service.Register(2000, "test")
+	require.NoError(t, err)
+	*published = nil
+	var undone []string
+	var notified bool
+
+	// work
+	err = service.Work(func(u *UnitOfWork) error {
+		order, err := u.Service.CreateOrder(1000)
+		if err != nil {
+			return err
+		}
+		u.Compensate("cancel courier booking", func() error {
+			undone = append(undone, "courier")
+			return nil
+		})
+		u.AfterCommit("notify client", func() error {
+			notified = true
+			return nil
+		})
+		return u.Service.Work(func(inner *UnitOfWork) error {
+			inner.Compensate("release label", func() error {
+				undone = append(undone, "label")
+				return errors.New("label printer offline")
+			})
+			if _, err := inner.Service.Register(1000, "test"); err != nil {
+				return err
+			}
+			// a parcel of another client does not belong in the order
+			return inner.Service.AddOrderParcel(order.ID, other.Number)
+		})
+	})
+
+	// check
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrCompensationFailed)
+	assert.NotErrorIs(t, err, ErrAfterCommitFailed)
+	assert.Equal(t, []string{"label", "courier"}, undone)
+	assert.False(t, notified)
+	assert.Empty(t, *published)
+	parcels, err := service.ClientParcels(1000)
+	require.NoError(t, err)
+	assert.Empty(t, parcels)
+}
+
+// TestWorkAfterCommitFailure verifies that a failed after-commit step
+// is reported without undoing the work.
+func TestWorkAfterCommitFailure(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	var number int
+	compensated := false
+
+	// work
+	err := service.Work(func(u *UnitOfWork) error {
+		p, err := u.Service.Register(1000, "test")
+		number = p.Number
+		u.Compensate("never", func() error {
+			compensated = true
+			return nil
+		})
+		u.AfterCommit("notify client", func() error { return errors.New("smtp down") })
+		return err
+	})
+
+	// check
+	assert.ErrorIs(t, err, ErrAfterCommitFailed)
+	assert.ErrorContains(t, err, "notify client: smtp down")
+	assert.False(t, compensated)
+	_, err = service.Get(number)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Scan types reported by handheld scanners.
+const (
+	// ScanInbound records arrival at a warehouse; it changes no status.
+	ScanInbound = "inbound"
+	// ScanOutbound records the parcel leaving for delivery; the first one
+	// sends a registered parcel.
+	ScanOutbound = "outbound"
+	// ScanDelivery records the hand-over to the recipient; it delivers a
+	// sent parcel.
+	ScanDelivery = "delivery"
+)
+
+// ErrScanTypeUnrecognised indicates a scan type other than the Scan* constants.
+var ErrScanTypeUnrecognised = newError(CodeUnknownScanType, "unrecognised scan type")
+
+// knownScanType reports whether t is one of the Scan* constants.
+func knownScanType(t string) bool {
+	switch t {
+	case ScanInbound, ScanOutbound, ScanDelivery:
+		return true
+	}
+	return false
+}
+
+// Scan is one scan event of a parcel.
+type Scan struct {
+	Number int
+	Type   string
+	// Warehouse and Description locate the scan as in Location.
+	Warehouse   int
+	Description string
+	// ScannedAt is when the scanner read the parcel, RecordedAt when the
+	// event reached the service; they differ for feeds uploaded in batches.
+	ScannedAt  string
+	RecordedAt string
+	// Device and EventID identify scans synced from a courier device; see
+	// SyncScans. Both are empty for scans recorded online.
+	Device  string
+	EventID string
+}
+
+// AddScan appends sc to the scan events of parcel sc.Number.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrScanTypeUnrecognised (wrapped) for an unknown scan type.
+//   - Wraps and returns any SQL error from the INSERT.
+func (s ParcelStore) AddScan(sc Scan) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	if !knownScanType(sc.Type) {
+		return fmt.Errorf("failed to add scan of parcel %d: %w %q", sc.Number, ErrScanTypeUnrecognised, sc.Type)
+	}
+
+	query := `INSERT INTO scan_event (parcel_number, scan_type, warehouse, description, scanned_at, recorded_at,
+    device, device_event_id)
+VALUES (:number, :type, :warehouse, :description, :scanned_at, :recorded_at, :device, :event_id)`
+	_, err := s.conn().Exec(query, sql.Named("number", sc.Number), sql.Named("type", sc.Type),
+		sql.Named("warehouse", sc.Warehouse), sql.Named("description", sc.Description),
+		sql.Named("scanned_at", sc.ScannedAt), sql.Named("recorded_at", sc.RecordedAt),
+		sql.Named("device", sc.Device), sql.Named("event_id", sc.EventID))
+	if err != nil {
+		return fmt.Errorf("failed to add scan of parcel %d: %w", sc.Number, err)
+	}
+	return nil
+}
+
+// GetScans returns the scan events of a parcel in the order received.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if the parcel has never been scanned.
+//   - Wraps and returns any SQL errors from query, scanning, or iteration.
+func (s ParcelStore) GetScans(number int) ([]Scan, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + scanColumns + " FROM scan_event WHERE parcel_number = :number ORDER BY id"
+	rows, err := s.conn().Query(query, sql.Named("number", number))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for scans of parcel %d: %w", number, err)
+	}
+	defer rows.Close()
+
+	var res []Scan
+	for rows.Next() {
+		sc, err := scanScan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan one of scan rows for parcel %d: %w", number, err)
+		}
+		res = append(res, sc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate scan rows for parcel %d: %w", number, err)
+	}
+	return res, nil
+}
+
+// scanColumns lists the scan_event columns in the order scanScan expects.
+const scanColumns = "parcel_number, scan_type, warehouse, description, scanned_at, recorded_at, device, device_event_id"
+
+// scanScan reads a row of scanColumns into a Scan.
+func scanScan(row rowScanner) (Scan, error) {
+	var sc Scan
+	err := row.Scan(&sc.Number, &sc.Type, &sc.Warehouse, &sc.Description, &sc.ScannedAt, &sc.RecordedAt,
+		&sc.Device, &sc.EventID)
+	return sc, err
+}
+
+// getDeviceScan returns the scan synced from device as event id.
+// Returns sql.ErrNoRows (wrapped) if there is none.
+func (s ParcelStore) getDeviceScan(device, id string) (Scan, error) {
+	query := "SELECT " + scanColumns + " FROM scan_event WHERE device = :device AND device_event_id = :id"
+	sc, err := scanScan(s.conn().QueryRow(query, sql.Named("device", device), sql.Named("id", id)))
+	if err != nil {
+		return sc, fmt.Errorf("failed to get scan %q of device %q: %w", id, device, err)
+	}
+	return sc, nil
+}
+
+// completeRouteStopOf marks the open route stop of the parcel, if any,
+// as completed at the given time.
+func (s ParcelStore) completeRouteStopOf(number int, at string) error {
+	query := "UPDATE route_stop SET completed_at = :at WHERE parcel_number = :number AND completed_at = ''"
+	_, err := s.conn().Exec(query, sql.Named("at", at), sql.Named("number", number))
+	if err != nil {
+		return fmt.Errorf("failed to complete route stop of parcel %d: %w", number, err)
+	}
+	return nil
+}
+
+// RecordScan records a scan of the parcel of type scanType at location
+// (its Warehouse and Description; a scan needs at least one of them) and
+// time at, which defaults to now when zero. The scan is appended to the
+// scan events and the location log, and drives the lifecycle:
+//
+//   - the first ScanOutbound of a registered parcel sends it, subject to
+//     the payment rule of NextStatus;
+//   - a ScanDelivery delivers a sent parcel and completes its route stop,
+//     and returns ErrRequireSent (wrapped) for a registered parcel or an
+//     international one that has not cleared customs;
+//   - scans that would move a parcel backwards or to its current status
+//     are recorded without changing it.
+//
+// Status changes are recorded in the history and published as by NextStatus.
+func (s ParcelService) RecordScan(number int, scanType string, location Location, at time.Time) (Scan, error) {
+	now := time.Now()
+	if at.IsZero() {
+		at = now
+	}
+	sc := Scan{Number: number, Type: scanType, Warehouse: location.Warehouse, Description: strings.TrimSpace(location.Description),
+		ScannedAt: s.timestamp(at), RecordedAt: s.timestamp(now)}
+	var res advanced
+
+	err := s.store.InTx(func(tx ParcelStore) error {
+		var err error
+		res, err = s.recordScan(tx, sc)
+		return err
+	})
+	if err != nil {
+		return sc, mapError(err)
+	}
+
+	s.publishAdvanced(res)
+	return sc, nil
+}
+
+// recordScan records sc within tx and advances the parcel as described
+// for RecordScan, without publishing events.
+func (s ParcelService) recordScan(tx ParcelStore, sc Scan) (advanced, error) {
+	number := sc.Number
+	parcel, err := tx.Get(number)
+	if err != nil {
+		return advanced{}, err
+	}
+	if err := tx.AddScan(sc); err != nil {
+		return advanced{}, err
+	}
+	err = tx.AddLocation(Location{Number: number, Warehouse: sc.Warehouse, Description: sc.Description, ScannedAt: sc.ScannedAt})
+	if err != nil {
+		return advanced{}, err
+	}
+
+	switch {
+	case sc.Type == ScanOutbound && parcel.Status == ParcelStatusRegistered:
+		return s.advance(tx, parcel)
+	case sc.Type == ScanDelivery && readyForDelivery(parcel):
+		if err := tx.completeRouteStopOf(number, sc.ScannedAt); err != nil {
+			return advanced{}, err
+		}
+		return s.advance(tx, parcel)
+	case sc.Type == ScanDelivery && parcel.Status != ParcelStatusDelivered:
+		return advanced{}, fmt.Errorf("failed to record delivery scan of parcel %d: %w, actual status: %s",
+			number, ErrRequireSent, parcel.Status)
+	}
+	return advanced{}, nil
+}
+
+// Scans returns the scan events of the parcel in the order received.
+func (s ParcelService) Scans(number int) ([]Scan, error) {
+	scans, err := s.store.GetScans(number)
+	return scans, mapError(err)
+}
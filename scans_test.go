@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRecordScan verifies that scans drive the parcel lifecycle and are
+// logged as scan events and locations.
+func TestRecordScan(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", Payment: PaymentPaid})
+	require.NoError(t, err)
+	unpaid, err := service.Register(1000, "test")
+	require.NoError(t, err)
+	warehouse, err := service.AddWarehouse(Warehouse{Code: "MSK-1", Name: "Central"})
+	require.NoError(t, err)
+	depot := Location{Warehouse: warehouse.ID}
+	route, err := service.CreateRoute("courier-1", "2024-05-01")
+	require.NoError(t, err)
+	*published = nil
+
+	// scan
+	_, err = service.RecordScan(parcel.Number, "lost", depot, time.Time{})
+	require.ErrorIs(t, err, ErrScanTypeUnrecognised)
+	_, err = service.RecordScan(parcel.Number, ScanDelivery, depot, time.Time{})
+	require.ErrorIs(t, err, ErrRequireSent)
+	_, err = service.RecordScan(unpaid.Number, ScanOutbound, depot, time.Time{})
+	require.ErrorIs(t, err, ErrRequirePaid)
+
+	_, err = service.RecordScan(parcel.Number, ScanInbound, depot, time.Time{})
+	require.NoError(t, err)
+	_, err = service.RecordScan(parcel.Number, ScanOutbound, depot, time.Time{})
+	require.NoError(t, err)
+	_, err = service.RecordScan(parcel.Number, ScanOutbound, Location{Description: "van"}, time.Time{})
+	require.NoError(t, err)
+
+	stored, err := service.Get(parcel.Number)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusSent, stored.Status)
+
+	require.NoError(t, service.AddRouteStop(route.ID, parcel.Number))
+	handover := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	sc, err := service.RecordScan(parcel.Number, ScanDelivery, Location{Description: "recipient"}, handover)
+	require.NoError(t, err)
+	assert.Equal(t, FormatTimestamp(handover, DefaultTimestampPrecision), sc.ScannedAt)
+
+	// check
+	stored, err = service.Get(parcel.Number)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusDelivered, stored.Status)
+
+	scans, err := service.Scans(parcel.Number)
+	require.NoError(t, err)
+	require.Len(t, scans, 4)
+	assert.Equal(t, []string{ScanInbound, ScanOutbound, ScanOutbound, ScanDelivery},
+		[]string{scans[0].Type, scans[1].Type, scans[2].Type, scans[3].Type})
+
+	current, err := service.CurrentLocation(parcel.Number)
+	require.NoError(t, err)
+	assert.Equal(t, "recipient", current.Description)
+
+	route, err = service.Route(route.ID)
+	require.NoError(t, err)
+	assert.Equal(t, sc.ScannedAt, route.Stops[0].CompletedAt)
+
+	require.Len(t, *published, 2)
+	assert.Equal(t, ParcelStatusSent, (*published)[0].Parcel.Status)
+	assert.Equal(t, ParcelStatusDelivered, (*published)[1].Parcel.Status)
+}
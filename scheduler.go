@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrSchedulerStarted indicates that a job was scheduled on, or Start was
+// called for, a scheduler that is already running.
+var ErrSchedulerStarted = errors.New("scheduler already started")
+
+// ErrInvalidInterval indicates that a job was scheduled to run every
+// interval that is not positive.
+var ErrInvalidInterval = errors.New("invalid job interval")
+
+// Job is a unit of periodic background work run by a Scheduler.
+type Job interface {
+	// Name identifies the job in error reports.
+	Name() string
+	// Run performs one execution. ctx is cancelled when the scheduler stops.
+	Run(ctx context.Context) error
+}
+
+// jobFunc adapts a function to the Job interface.
+type jobFunc struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func (j jobFunc) Name() string                  { return j.name }
+func (j jobFunc) Run(ctx context.Context) error { return j.fn(ctx) }
+
+// NewJob returns a Job named name that calls fn.
+func NewJob(name string, fn func(ctx context.Context) error) Job {
+	return jobFunc{name: name, fn: fn}
+}
+
+// OverdueJob returns a Job that flags parcels past their delivery
+// deadline (see ParcelService.FlagOverdue).
+func OverdueJob(service ParcelService) Job {
+	return NewJob("overdue", func(context.Context) error {
+		_, err := service.FlagOverdue()
+		return err
+	})
+}
+
+// DelayJob returns a Job that finds the parcels that missed their
+// estimated delivery time (see ParcelService.DetectDelays).
+func DelayJob(service ParcelService) Job {
+	return NewJob("delays", func(context.Context) error {
+		_, err := service.DetectDelays()
+		return err
+	})
+}
+
+// ActivationJob returns a Job that registers the parcels of the scheduled
+// registrations that are due (see ParcelService.ActivateScheduled).
+func ActivationJob(service ParcelService) Job {
+	return NewJob("activate", func(context.Context) error {
+		_, err := service.ActivateScheduled()
+		return err
+	})
+}
+
+// ArchiveJob returns a Job that archives parcels delivered more than
+// olderThan ago (see ParcelStore.Archive).
+func ArchiveJob(store ParcelStore, olderThan time.Duration) Job {
+	return NewJob("archive", func(context.Context) error {
+		_, err := store.Archive(olderThan)
+		return err
+	})
+}
+
+// AnalyticsJob returns a Job that refreshes the delivery analytics of the
+// last lookback (see ParcelStore.RefreshDeliveryAnalytics), which should
+// cover history entries recorded late.
+func AnalyticsJob(store ParcelStore, lookback time.Duration) Job {
+	return NewJob("analytics", func(context.Context) error {
+		return store.RefreshDeliveryAnalytics(time.Now().Add(-lookback))
+	})
+}
+
+type scheduledJob struct {
+	job      Job
+	interval time.Duration
+	// runs records the executions of the job; see Scheduler.HealthChecks.
+	runs *jobRuns
+}
+
+// jobRuns records the last execution of a job, guarded by Scheduler.mu.
+type jobRuns struct {
+	started, finished time.Time
+	err               error
+}
+
+// Scheduler runs jobs periodically in the background.
+//
+// Each job runs on its own goroutine, first immediately after Start and
+// then every interval; a run that overruns its interval delays the next
+// one instead of overlapping with it. Stop cancels the context passed to
+// running jobs and waits for them to return.
+type Scheduler struct {
+	mu      sync.Mutex
+	jobs    []scheduledJob
+	onError func(job string, err error)
+	cancel  context.CancelFunc
+	stopped bool
+	wg      sync.WaitGroup
+	now     func() time.Time
+}
+
+// NewScheduler returns a stopped Scheduler that reports job failures to
+// onError, which may be nil to ignore them.
+func NewScheduler(onError func(job string, err error)) *Scheduler {
+	return &Scheduler{onError: onError, now: time.Now}
+}
+
+// Every schedules job to run every interval once the scheduler starts.
+//
+// Behaviour:
+//   - Returns ErrInvalidInterval (wrapped) if interval is not positive.
+//   - Returns ErrSchedulerStarted if the scheduler is already running.
+func (s *Scheduler) Every(interval time.Duration, job Job) error {
+	if interval <= 0 {
+		return fmt.Errorf("failed to schedule job %s: %w %s", job.Name(), ErrInvalidInterval, interval)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		return ErrSchedulerStarted
+	}
+	s.jobs = append(s.jobs, scheduledJob{job: job, interval: interval, runs: &jobRuns{}})
+	return nil
+}
+
+// Start launches every scheduled job. Jobs stop when ctx is cancelled or
+// Stop is called.
+func (s *Scheduler) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		return ErrSchedulerStarted
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+
+	for _, sj := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, sj)
+	}
+	return nil
+}
+
+// Stop cancels all jobs and waits for running executions to finish.
+// It is safe to call more than once.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.stopped = true
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, sj scheduledJob) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(sj.interval)
+	defer ticker.Stop()
+
+	for {
+		s.mu.Lock()
+		sj.runs.started = s.now()
+		s.mu.Unlock()
+		err := sj.job.Run(ctx)
+		s.mu.Lock()
+		sj.runs.finished, sj.runs.err = s.now(), err
+		s.mu.Unlock()
+		if err != nil && s.onError != nil && ctx.Err() == nil {
+			s.onError(sj.job.Name(), err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ErrJobStalled indicates a scheduled job that has not started a run for
+// two of its intervals, or whose run has taken that long, so its
+// goroutine is likely stuck.
+var ErrJobStalled = errors.New("scheduled job stalled")
+
+// HealthChecks returns a liveness check per scheduled job, named
+// "job:<name>" (see ParcelService.WithLivenessChecks).
+//
+// Behaviour:
+//   - A check fails if the scheduler is not running, and with
+//     ErrJobStalled (wrapped) if the last run of the job started more than
+//     two intervals ago: runs start every interval unless one overruns.
+//   - A failed run does not fail the check, as the next run may succeed;
+//     its error is reported in the detail instead.
+func (s *Scheduler) HealthChecks() []HealthCheck {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checks := make([]HealthCheck, 0, len(s.jobs))
+	for _, sj := range s.jobs {
+		sj := sj
+		checks = append(checks, HealthCheck{Name: "job:" + sj.job.Name(), Check: func(context.Context) (string, error) {
+			return s.checkJob(sj)
+		}})
+	}
+	return checks
+}
+
+// checkJob implements the check of sj; see HealthChecks.
+func (s *Scheduler) checkJob(sj scheduledJob) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel == nil || s.stopped {
+		return "", errors.New("scheduler not running")
+	}
+	runs := *sj.runs
+	if runs.started.IsZero() {
+		return "not run yet", nil
+	}
+	if age := s.now().Sub(runs.started); age > 2*sj.interval {
+		if runs.finished.Before(runs.started) {
+			return "", fmt.Errorf("%w: run started %s ago has not finished", ErrJobStalled, age.Round(time.Second))
+		}
+		return "", fmt.Errorf("%w: last run started %s ago", ErrJobStalled, age.Round(time.Second))
+	}
+
+	detail := "last run " + FormatTimestamp(runs.started, time.Second)
+	switch {
+	case runs.finished.Before(runs.started):
+		detail += ", running"
+	case runs.err != nil:
+		detail += " failed: " + runs.err.Error()
+	}
+	return detail, nil
+}
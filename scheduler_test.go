@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSchedulerRunsJobsAndStops verifies that jobs run repeatedly, failures
+// are reported, and Stop waits for the running execution.
+func TestSchedulerRunsJobsAndStops(t *testing.T) {
+	// prepare
+	var runs, failures int32
+	var running atomic.Bool
+
+	scheduler := NewScheduler(func(job string, err error) {
+		assert.Equal(t, "failing", job)
+		atomic.AddInt32(&failures, 1)
+	})
+	require.NoError(t, scheduler.Every(5*time.Millisecond, NewJob("counting", func(ctx context.Context) error {
+		running.Store(true)
+		defer running.Store(false)
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})))
+	require.NoError(t, scheduler.Every(5*time.Millisecond, NewJob("failing", func(ctx context.Context) error {
+		return errors.New("boom")
+	})))
+
+	// run
+	require.NoError(t, scheduler.Start(context.Background()))
+	require.ErrorIs(t, scheduler.Start(context.Background()), ErrSchedulerStarted)
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 3 }, time.Second, time.Millisecond)
+	scheduler.Stop()
+	scheduler.Stop()
+
+	// check
+	assert.False(t, running.Load())
+	assert.NotZero(t, atomic.LoadInt32(&failures))
+	after := atomic.LoadInt32(&runs)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, after, atomic.LoadInt32(&runs))
+}
+
+// TestSchedulerEveryWhenIntervalInvalid ensures that jobs cannot be
+// scheduled with an interval the ticker would panic on.
+func TestSchedulerEveryWhenIntervalInvalid(t *testing.T) {
+	// prepare
+	scheduler := NewScheduler(nil)
+	job := NewJob("noop", func(context.Context) error { return nil })
+
+	// check
+	require.ErrorIs(t, scheduler.Every(0, job), ErrInvalidInterval)
+	require.ErrorIs(t, scheduler.Every(-time.Second, job), ErrInvalidInterval)
+	require.NoError(t, scheduler.Start(context.Background()))
+	scheduler.Stop()
+	assert.Empty(t, scheduler.HealthChecks())
+}
+
+// TestOverdueJob ensures that the built-in job flags overdue parcels.
+func TestOverdueJob(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	parcel := getTestParcel()
+	parcel.DueAt = FormatTimestamp(time.Now().Add(-time.Hour), DefaultTimestampPrecision)
+	_, err := service.store.Add(parcel)
+	require.NoError(t, err)
+
+	// run
+	require.NoError(t, OverdueJob(service).Run(context.Background()))
+
+	// check
+	require.Len(t, *published, 1)
+	assert.Equal(t, EventSLABreached, (*published)[0].Type)
+}
+
+// TestSchedulerHealthChecks verifies that job checks report failed runs
+// but fail only for stalled jobs and a scheduler that is not running.
+func TestSchedulerHealthChecks(t *testing.T) {
+	// prepare
+	var clock atomic.Int64
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock.Store(start.UnixNano())
+	scheduler := NewScheduler(nil)
+	scheduler.now = func() time.Time { return time.Unix(0, clock.Load()).UTC() }
+	require.NoError(t, scheduler.Every(time.Hour, NewJob("failing", func(context.Context) error {
+		return errors.New("boom")
+	})))
+	require.NoError(t, scheduler.Every(time.Hour, NewJob("stuck", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})))
+	checks := scheduler.HealthChecks()
+	require.Len(t, checks, 2)
+	assert.Equal(t, "job:failing", checks[0].Name)
+	assert.Equal(t, "job:stuck", checks[1].Name)
+	report := runHealthChecks(context.Background(), checks)
+	assert.False(t, report.Healthy())
+
+	// run
+	require.NoError(t, scheduler.Start(context.Background()))
+	defer scheduler.Stop()
+	require.Eventually(t, func() bool {
+		detail, _ := checks[0].Check(context.Background())
+		return detail != "not run yet"
+	}, time.Second, time.Millisecond)
+
+	// check
+	detail, err := checks[0].Check(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "last run 2024-05-01T12:00:00Z failed: boom", detail)
+	detail, err = checks[1].Check(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "last run 2024-05-01T12:00:00Z, running", detail)
+
+	clock.Store(start.Add(3 * time.Hour).UnixNano())
+	_, err = checks[1].Check(context.Background())
+	require.ErrorIs(t, err, ErrJobStalled)
+	_, err = checks[0].Check(context.Background())
+	require.ErrorIs(t, err, ErrJobStalled)
+
+	scheduler.Stop()
+	clock.Store(start.UnixNano())
+	assert.False(t, runHealthChecks(context.Background(), checks).Healthy())
+}
@@ -0,0 +1,11 @@
+-- Base schema of the tracker database: the "parcel" table every migration
+-- builds on. Statements must be idempotent; see ParcelStore.EnsureSchema.
+CREATE TABLE IF NOT EXISTS "parcel" (
+    number INTEGER PRIMARY KEY AUTOINCREMENT,
+    client INTEGER NOT NULL,
+    status VARCHAR(128) NOT NULL,
+    address VARCHAR(512) NOT NULL,
+    created_at VARCHAR(64) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS parcel_client ON parcel(client);
+CREATE INDEX IF NOT EXISTS parcel_created_at ON parcel(created_at);
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Limits of the number of parcels returned by Search.
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// ErrEmptySearch indicates a search query without any word to look for.
+var ErrEmptySearch = newError(CodeEmptySearch, "search query has no words")
+
+// Search returns the parcels whose address contains every word of query,
+// best match first. Words match case- and diacritic-insensitively, and
+// as prefixes, so "Баум" finds "ул. Баумана".
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrSearchUnavailable (wrapped) if the store encrypts
+//     addresses; see WithFieldEncryption.
+//   - Returns ErrEmptySearch (wrapped) if query has no letters or digits;
+//     any other characters only separate words.
+//   - A limit of zero or less means DefaultSearchLimit; limits above
+//     MaxSearchLimit are lowered to it.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) Search(query string, limit int) ([]Parcel, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	if s.keys != nil {
+		return nil, fmt.Errorf("failed to search parcels for %q: %w", pii(query), ErrSearchUnavailable)
+	}
+
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return nil, fmt.Errorf("failed to search parcels for %q: %w", pii(query), ErrEmptySearch)
+	}
+	// Quoted words cannot be FTS5 operators; the words contain no quotes.
+	terms := make([]string, len(words))
+	for i, w := range words {
+		terms[i] = `"` + w + `"*`
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	limit = min(limit, MaxSearchLimit)
+
+	q := "SELECT " + parcelColumns + ` FROM (
+    SELECT rowid AS match_number, rank AS match_rank FROM parcel_address_fts
+    WHERE parcel_address_fts MATCH :terms ORDER BY rank LIMIT :limit
+) JOIN parcel ON parcel.number = match_number
+ORDER BY match_rank, seq`
+	return s.queryParcels(fmt.Sprintf("search %q", pii(query)), q,
+		sql.Named("terms", strings.Join(terms, " ")), sql.Named("limit", limit))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSearch checks prefix and multi-word matching, and that the index
+// follows address changes and deletions.
+func TestSearch(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	add := func(address string) int {
+		p := getTestParcel()
+		p.Address = address
+		number, err := store.Add(p)
+		require.NoError(t, err)
+		return number
+	}
+	kazan := add("г. Казань, ул. Баумана, 1")
+	moscow := add("г. Москва, ул. Баумана, 12")
+	add("Café Lumière, Paris")
+
+	numbers := func(query string, limit int) []int {
+		parcels, err := store.Search(query, limit)
+		require.NoError(t, err)
+		var res []int
+		for _, p := range parcels {
+			res = append(res, p.Number)
+		}
+		return res
+	}
+
+	// check
+	assert.ElementsMatch(t, []int{kazan, moscow}, numbers("баум", 0))
+	assert.Equal(t, []int{kazan}, numbers("Баумана казан", 0))
+	assert.Len(t, numbers("cafe lumiere", 0), 1)
+	assert.Len(t, numbers("Баумана", 1), 1)
+	assert.Empty(t, numbers("Тверская", 0))
+	assert.Equal(t, []int{kazan}, numbers(`("Казань*`, 0), "syntax characters only separate words")
+
+	require.NoError(t, store.SetAddress(kazan, "г. Казань, ул. Пушкина, 5"))
+	assert.Equal(t, []int{moscow}, numbers("Баумана", 0))
+	assert.Equal(t, []int{kazan}, numbers("пушк", 0))
+
+	require.NoError(t, store.Delete(moscow))
+	assert.Empty(t, numbers("Баумана", 0))
+
+	_, err := store.Search(" ,. ", 0)
+	assert.ErrorIs(t, err, ErrEmptySearch)
+}
+
+// TestSearchHTTP checks /search and that only staff may search.
+func TestSearchHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	_, err := service.RegisterParcel(Parcel{Client: 1000, Address: "г. Казань, ул. Баумана, 1"})
+	require.NoError(t, err)
+	h := NewHTTPHandler(service)
+
+	// check
+	rec := doRequest(t, h, http.MethodGet, "/search?q=%D0%B1%D0%B0%D1%83%D0%BC&limit=5", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var parcels []parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&parcels))
+	require.Len(t, parcels, 1)
+	assert.Equal(t, 1000, parcels[0].Client)
+
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodGet, "/search?q=", "").Code)
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodGet, "/search?q=x&limit=x", "").Code)
+
+	client := NewAuthorizedService(service, Principal{Role: RoleClient, Client: 1000})
+	_, err = client.Search("Баумана", 0)
+	assert.ErrorIs(t, err, ErrForbidden)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DefaultShutdownTimeout is how long Serve waits for in-flight requests
+// to finish unless configured otherwise.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// shutdownKey is the context key of the channel Serve closes when it
+// starts shutting down.
+type shutdownKey struct{}
+
+// shuttingDown returns a channel closed once the server of the request
+// with context ctx starts shutting down, or nil outside Serve.
+func shuttingDown(ctx context.Context) <-chan struct{} {
+	done, _ := ctx.Value(shutdownKey{}).(<-chan struct{})
+	return done
+}
+
+// Serve serves handler on ln until ctx is done, then shuts down
+// gracefully.
+//
+// Behaviour:
+//   - On shutdown, stops accepting connections and waits up to timeout
+//     for in-flight requests to finish; event streams end right away and
+//     /readyz reports the server unavailable meanwhile.
+//   - Requests still running after timeout are cut off and an error
+//     wrapping context.DeadlineExceeded is returned.
+//   - Returns nil after a graceful shutdown, or the error that stopped
+//     the server otherwise.
+func Serve(ctx context.Context, ln net.Listener, handler http.Handler, timeout time.Duration) error {
+	draining := make(chan struct{})
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return context.WithValue(context.Background(), shutdownKey{}, (<-chan struct{})(draining))
+		},
+	}
+	srv.RegisterOnShutdown(func() { close(draining) })
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return fmt.Errorf("failed to drain requests: %w", err)
+	}
+	return nil
+}
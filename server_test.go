@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestServeGracefulShutdown verifies that Serve lets in-flight requests
+// finish, ends event streams and stops accepting connections.
+func TestServeGracefulShutdown(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	api := NewHTTPHandler(service, AllowAnonymous(Principal{Role: RoleAdmin}))
+	started, release := make(chan struct{}), make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.Handle("/", api)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	url := "http://" + ln.Addr().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- Serve(ctx, ln, mux, 5*time.Second) }()
+
+	stream, err := http.Get(url + "/events")
+	require.NoError(t, err)
+	defer stream.Body.Close()
+	require.Equal(t, http.StatusOK, stream.StatusCode)
+
+	slow := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get(url + "/slow")
+		if err == nil {
+			resp.Body.Close()
+		}
+		slow <- resp
+	}()
+	<-started
+
+	// check
+	cancel()
+	// the stream ends once shutdown starts, before the slow request does
+	_, err = bufio.NewReader(stream.Body).ReadString('\x00')
+	assert.Error(t, err)
+	select {
+	case err := <-served:
+		t.Fatalf("Serve returned %v before the request finished", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	resp := <-slow
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.NoError(t, <-served)
+
+	_, err = http.Get(url + "/healthz")
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "refused"), err)
+}
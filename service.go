@@ -0,0 +1,627 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrParcelNotFound indicates that no parcel exists with the requested number.
+var ErrParcelNotFound = newError(CodeParcelNotFound, "parcel not found")
+
+// ErrStatusTransition indicates a requested status that is neither the
+// current status of a parcel nor the next one.
+var ErrStatusTransition = newError(CodeInvalidTransition, "status transition not allowed")
+
+// ParcelService implements the parcel use cases on top of ParcelStore.
+//
+// Each operation runs its store writes (the parcel row and its status
+// history) in one transaction and publishes an Event once the
+// transaction has committed, so transport layers only translate
+// requests and responses. Errors are mapped to service-level sentinels
+// (e.g. ErrParcelNotFound) while keeping the original error in the chain.
+type ParcelService struct {
+	store     ParcelStore
+	events    *EventBus
+	sla       SLAPolicy
+	eta       ETAPolicy
+	precision time.Duration
+	// zones enables pricing at registration when non-nil.
+	zones      ZoneFunc
+	duplicates DuplicatePolicy
+	// currencies converts tariffs; see WithCurrencyConverter.
+	currencies CurrencyConverter
+	// proofs, if set, keeps proof of delivery images; see WithProofStorage.
+	proofs ObjectStorage
+	// contentRules run after RestrictedContents; see WithContentRule.
+	contentRules []ContentRule
+	// liveness are run by Liveness; see WithLivenessChecks.
+	liveness []HealthCheck
+	// retention applies to EraseClientData; see WithRetention.
+	retention RetentionPolicy
+	// deliveryCodes, if on, guards deliveries; see WithDeliveryCodes.
+	deliveryCodes DeliveryCodePolicy
+	// slots are those of Reschedule, DefaultDeliverySlots if nil.
+	slots []DeliverySlot
+	// work is the unit of work the service runs in, if any; see Work.
+	work *UnitOfWork
+}
+
+// NewParcelService returns a ParcelService using store for persistence
+// and publishing to events, which may be nil. Deadlines follow
+// DefaultSLAPolicy unless overridden with WithSLA, and delivery estimates
+// DefaultETAPolicy unless overridden with WithETA.
+func NewParcelService(store ParcelStore, events *EventBus) ParcelService {
+	return ParcelService{store: store, events: events, sla: DefaultSLAPolicy(), eta: DefaultETAPolicy(),
+		precision: DefaultTimestampPrecision}
+}
+
+// WithSLA returns a copy of the service that assigns delivery deadlines
+// according to policy.
+func (s ParcelService) WithSLA(policy SLAPolicy) ParcelService {
+	s.sla = policy
+	return s
+}
+
+// WithRetention returns a copy of the service that keeps the parcels
+// policy retains, anonymised, when erasing the data of a client.
+func (s ParcelService) WithRetention(policy RetentionPolicy) ParcelService {
+	s.retention = policy
+	return s
+}
+
+// WithTimestampPrecision returns a copy of the service that records
+// creation and history timestamps truncated to precision.
+func (s ParcelService) WithTimestampPrecision(precision time.Duration) ParcelService {
+	s.precision = precision
+	return s
+}
+
+// WithPricing returns a copy of the service that charges every parcel at
+// registration according to the tariff of the zone chosen by zones.
+// A nil zones puts every parcel in DefaultZone.
+func (s ParcelService) WithPricing(zones ZoneFunc) ParcelService {
+	if zones == nil {
+		zones = func(Parcel) string { return DefaultZone }
+	}
+	s.zones = zones
+	return s
+}
+
+// WithDuplicatePolicy returns a copy of the service that checks every
+// registration against policy.
+func (s ParcelService) WithDuplicatePolicy(policy DuplicatePolicy) ParcelService {
+	s.duplicates = policy
+	return s
+}
+
+// AllowDuplicates returns a copy of the service that skips the duplicate
+// check, for callers confirming that a repeated registration is intended.
+func (s ParcelService) AllowDuplicates() ParcelService {
+	s.duplicates = DuplicatePolicy{}
+	return s
+}
+
+// timestamp formats t with the service's timestamp precision.
+func (s ParcelService) timestamp(t time.Time) string {
+	return FormatTimestamp(t, s.precision)
+}
+
+// Register creates a new parcel in `registered` status for the client
+// with a deadline from the SLA policy, records the initial history entry
+// and publishes EventParcelRegistered.
+func (s ParcelService) Register(client int, address string) (Parcel, error) {
+	return s.RegisterParcel(Parcel{Client: client, Address: address})
+}
+
+// RegisterParcel registers a parcel like Register, taking the client,
+// address or pickup point, recipient, service class, measurements,
+// declared value, payment terms and attributes from draft. The number,
+// status, creation time and deadline are assigned by the service, the
+// deadline according to the service class (see WithSLA), as are the zone
+// and price when pricing is enabled (see WithPricing and ClassPrice) and
+// the estimated delivery time (see WithETA).
+//
+// A retry with the IdempotencyKey of a parcel the client registered
+// before returns that parcel unchanged and publishes nothing. Other
+// repeats are subject to the duplicate policy (see WithDuplicatePolicy).
+// Parcels whose Contents may not go to their zone are rejected with
+// ErrRestrictedContents (see RestrictedContents and WithContentRule).
+// Invalid drafts are rejected with a *ValidationError before any of
+// that (see Parcel.Validate).
+func (s ParcelService) RegisterParcel(draft Parcel) (Parcel, error) {
+	now := time.Now()
+	parcel, err := s.newParcel(draft, now)
+	if err != nil {
+		return parcel, err
+	}
+
+	replayed := false
+	err = s.store.InTx(func(tx ParcelStore) error {
+		if parcel.IdempotencyKey != "" {
+			existing, err := tx.getByIdempotencyKey(parcel.Client, parcel.IdempotencyKey)
+			if err == nil {
+				parcel, replayed = existing, true
+				return nil
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+
+		if parcel.PickupPoint != 0 {
+			// the point's address is what duplicates and zones are judged by
+			point, err := tx.GetPickupPoint(parcel.PickupPoint)
+			if err != nil {
+				return err
+			}
+			parcel.Address = point.Address
+		}
+		if err := s.checkDuplicate(tx, &parcel, now); err != nil {
+			return err
+		}
+		if s.zones != nil {
+			tariff, err := tx.Quote(s.zones(parcel), parcel.WeightGrams)
+			if err != nil {
+				return err
+			}
+			price, err := s.convert(ClassPrice(tariff.Price, parcel.ServiceClass), DefaultCurrency, parcel.Currency)
+			if err != nil {
+				return fmt.Errorf("failed to price parcel for client %d: %w", pii(parcel.Client), err)
+			}
+			parcel.Zone, parcel.Price = tariff.Zone, price
+		}
+		eta, err := s.estimateDelivery(tx, parcel, now)
+		if err != nil {
+			return err
+		}
+		parcel.EstimatedDeliveryAt = eta
+		if err := s.checkContents(tx, parcel); err != nil {
+			return err
+		}
+
+		id, err := tx.Add(parcel)
+		if err != nil {
+			return err
+		}
+		// re-read to pick up values assigned by the store, e.g. the tracking code
+		parcel, err = tx.Get(id)
+		if err != nil {
+			return err
+		}
+		if err := s.checkAddressFound(tx, parcel); err != nil {
+			return err
+		}
+
+		return tx.AddHistory(StatusChange{Number: id, Status: parcel.Status, ChangedAt: parcel.CreatedAt})
+	})
+	if err != nil {
+		return parcel, mapError(err)
+	}
+
+	if !replayed {
+		s.events.Publish(Event{Type: EventParcelRegistered, Parcel: parcel, At: parcel.CreatedAt})
+	}
+	return parcel, nil
+}
+
+// newParcel returns the parcel draft describes as registered at now,
+// before the store assigns its number and tracking code, and validates
+// it.
+func (s ParcelService) newParcel(draft Parcel, now time.Time) (Parcel, error) {
+	parcel := draft
+	parcel.Number = 0
+	parcel.Status = ParcelStatusRegistered
+	parcel.CreatedAt = s.timestamp(now)
+	if parcel.ServiceClass == "" {
+		parcel.ServiceClass = ServiceStandard
+	}
+	if currency, err := NormaliseCurrency(parcel.Currency); err == nil {
+		parcel.Currency = currency
+	}
+	parcel.DueAt = s.sla.DueAt(now, parcel.ServiceClass)
+	parcel.TrackingCode = ""
+	parcel.Zone, parcel.Price = "", 0
+	parcel.EstimatedDeliveryAt = ""
+	parcel.DuplicateOf = 0
+	return parcel, parcel.Validate()
+}
+
+// Get returns the parcel with the given number, looking in the archive
+// if it is no longer in the active table.
+func (s ParcelService) Get(number int) (Parcel, error) {
+	parcel, err := s.store.Get(number)
+	if errors.Is(err, sql.ErrNoRows) {
+		parcel, err = s.store.GetArchived(number)
+	}
+	return parcel, mapError(err)
+}
+
+// GetByTrackingCode returns the parcel with the given tracking code.
+func (s ParcelService) GetByTrackingCode(code string) (Parcel, error) {
+	parcel, err := s.store.GetByTrackingCode(code)
+	return parcel, mapError(err)
+}
+
+// GetByPublicID returns the parcel with the given public ID.
+func (s ParcelService) GetByPublicID(id string) (Parcel, error) {
+	parcel, err := s.store.GetByPublicID(id)
+	return parcel, mapError(err)
+}
+
+// Track returns the public view of the parcel with the given tracking
+// code; see ParcelStore.GetTrackingView.
+func (s ParcelService) Track(code string) (TrackingView, error) {
+	v, err := s.store.GetTrackingView(code)
+	return v, mapError(err)
+}
+
+// ClientParcels returns the parcels of the client, oldest first.
+func (s ParcelService) ClientParcels(client int) ([]Parcel, error) {
+	parcels, err := s.store.GetByClient(client)
+	return parcels, mapError(err)
+}
+
+// Quote returns the tariff that registering p would apply, without
+// registering it. Pricing need not be enabled; without a ZoneFunc the
+// parcel is quoted in DefaultZone.
+func (s ParcelService) Quote(p Parcel) (Tariff, error) {
+	zone := DefaultZone
+	if s.zones != nil {
+		zone = s.zones(p)
+	}
+	tariff, err := s.store.Quote(zone, p.WeightGrams)
+	return tariff, mapError(err)
+}
+
+// FindParcels returns the parcels matching filter; see ParcelStore.Find.
+func (s ParcelService) FindParcels(filter ParcelFilter) ([]Parcel, error) {
+	parcels, err := s.store.Find(filter)
+	return parcels, mapError(err)
+}
+
+// Nearby returns the undelivered parcels within radius metres of
+// (lat, lon), nearest first; see ParcelStore.GetNearby.
+func (s ParcelService) Nearby(lat, lon, radius float64) ([]Parcel, error) {
+	parcels, err := s.store.GetNearby(lat, lon, radius)
+	return parcels, mapError(err)
+}
+
+// Search returns the parcels whose address matches query, best match
+// first; see ParcelStore.Search.
+func (s ParcelService) Search(query string, limit int) ([]Parcel, error) {
+	parcels, err := s.store.Search(query, limit)
+	return parcels, mapError(err)
+}
+
+// StatusLabels returns the presentation of every status in lang.
+func (s ParcelService) StatusLabels(lang string) ([]StatusLabel, error) {
+	labels, err := s.store.GetStatusLabels(lang)
+	return labels, mapError(err)
+}
+
+// Labels returns the Labels translating statuses into lang, or into
+// DefaultLabelLang if lang is empty.
+func (s ParcelService) Labels(lang string) (Labels, error) {
+	labels, err := s.store.GetLabels(lang)
+	return labels, mapError(err)
+}
+
+// History returns the status history of the parcel, oldest entry first.
+func (s ParcelService) History(number int) ([]StatusChange, error) {
+	if _, err := s.Get(number); err != nil {
+		return nil, err
+	}
+	history, err := s.store.GetHistory(number)
+	return history, mapError(err)
+}
+
+// PrintClientParcels prints the parcels of the client on standard output,
+// with statuses labelled in printLang.
+func (s ParcelService) PrintClientParcels(client int) error {
+	parcels, err := s.store.GetByClient(client)
+	if err != nil {
+		return mapError(err)
+	}
+	labels, err := s.Labels(printLang)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Посылки клиента %d:\n", client)
+	for _, parcel := range parcels {
+		fmt.Printf("Посылка № %d на адрес %s от клиента с идентификатором %d зарегистрирована %s, статус %s\n",
+			parcel.Number, parcel.Address, parcel.Client, parcel.CreatedAt, labels.Name(parcel.Status))
+	}
+	fmt.Println()
+
+	return nil
+}
+
+// NextStatus moves the parcel one step forward in its lifecycle
+// (registered → sent → delivered, with customs_cleared before delivered
+// for international parcels), records the change in the history and
+// publishes EventStatusChanged. Delivered parcels are left unchanged.
+//
+// An international parcel only clears customs once it has a customs
+// declaration (ErrCustomsDeclaration otherwise). A parcel is only sent
+// once paid (ErrRequirePaid otherwise), unless it is cash on delivery;
+// such a parcel becomes paid when it is delivered, which also publishes
+// EventPaymentChanged. A parcel split or merged into others fails with
+// ErrRepacked, and one on hold with ErrParcelHeld.
+func (s ParcelService) NextStatus(number int) error {
+	var res advanced
+
+	err := s.store.InTx(func(tx ParcelStore) error {
+		parcel, err := tx.Get(number)
+		if err != nil {
+			return err
+		}
+		res, err = s.advance(tx, parcel)
+		return err
+	})
+	if err != nil {
+		return mapError(err)
+	}
+
+	s.publishAdvanced(res)
+	return nil
+}
+
+// SetStatus moves the parcel to status, which must be its current status
+// (nothing happens) or the next one (as NextStatus).
+//
+// Behaviour:
+//   - Returns ErrNewStatusUnrecognised (wrapped) for an unknown status.
+//   - Returns ErrStatusTransition (wrapped) for any other status, e.g.
+//     moving a parcel back, skipping "sent", or delivering an
+//     international parcel that has not cleared customs.
+//   - Otherwise fails as NextStatus does.
+func (s ParcelService) SetStatus(number int, status string) error {
+	if !knownStatus(status) {
+		return fmt.Errorf("failed to set status of parcel %d: %w: %q", number, ErrNewStatusUnrecognised, status)
+	}
+
+	var res advanced
+	err := s.store.InTx(func(tx ParcelStore) error {
+		parcel, err := tx.Get(number)
+		if err != nil {
+			return err
+		}
+		if parcel.Status == status {
+			return nil
+		}
+		if nextStatus(parcel) == status {
+			res, err = s.advance(tx, parcel)
+			return err
+		}
+		return fmt.Errorf("failed to set status of parcel %d: %w: %s to %s", number, ErrStatusTransition, parcel.Status, status)
+	})
+	if err != nil {
+		return mapError(err)
+	}
+
+	s.publishAdvanced(res)
+	return nil
+}
+
+// Subscribe registers h for the events the service publishes and returns
+// a function that removes the subscription. Without an event bus h is
+// never called.
+func (s ParcelService) Subscribe(h func(Event)) (unsubscribe func()) {
+	if s.events == nil {
+		return func() {}
+	}
+	return s.events.Subscribe(h)
+}
+
+// advanced is the outcome of advance: the parcel after the change and
+// its previous status and payment status, empty if they did not change.
+type advanced struct {
+	parcel      Parcel
+	prevStatus  string
+	prevPayment string
+	// deliveryCode is the code issued when the parcel was sent, if any.
+	deliveryCode string
+}
+
+// advance moves parcel one step forward within tx as described for
+// NextStatus, without publishing events.
+func (s ParcelService) advance(tx ParcelStore, parcel Parcel) (advanced, error) {
+	res := advanced{parcel: parcel}
+	number := parcel.Number
+	if parcel.Repacked {
+		return res, fmt.Errorf("failed to advance parcel %d: %w", number, ErrRepacked)
+	}
+	if !parcel.Hold.IsZero() {
+		return res, fmt.Errorf("failed to advance parcel %d: %w (%s: %s)", number, ErrParcelHeld, parcel.Hold.Kind,
+			parcel.Hold.Reason)
+	}
+
+	next := nextStatus(parcel)
+	switch next {
+	case "":
+		return res, nil
+	case ParcelStatusSent:
+		if parcel.Payment != PaymentPaid && !parcel.CashOnDelivery {
+			return res, fmt.Errorf("failed to send parcel: %w (parcel %d is %s)", ErrRequirePaid, number, parcel.Payment)
+		}
+	case ParcelStatusCustomsCleared:
+		if parcel.CustomsReference == "" {
+			return res, fmt.Errorf("failed to clear parcel %d through customs: %w", number, ErrCustomsDeclaration)
+		}
+	}
+
+	var note string
+	if next == ParcelStatusDelivered && s.deliveryCodes.MaxAttempts > 0 {
+		var err error
+		if note, err = s.requireDeliveryCode(tx, number); err != nil {
+			return res, err
+		}
+	}
+
+	now := s.timestamp(time.Now())
+	if err := tx.setStatusAt(number, next, now); err != nil {
+		return res, err
+	}
+	if next == ParcelStatusSent && s.deliveryCodes.MaxAttempts > 0 {
+		var err error
+		if res.deliveryCode, err = tx.issueDeliveryCode(number, now); err != nil {
+			return res, err
+		}
+	}
+	if next == ParcelStatusDelivered && parcel.CashOnDelivery && parcel.Payment == PaymentUnpaid {
+		if err := tx.SetPaymentStatus(number, PaymentPaid); err != nil {
+			return res, err
+		}
+		res.prevPayment, res.parcel.Payment = parcel.Payment, PaymentPaid
+	}
+	res.prevStatus, res.parcel.Status = parcel.Status, next
+
+	return res, tx.AddHistory(StatusChange{Number: number, Status: next, ChangedAt: now, Note: note})
+}
+
+// publishAdvanced publishes the events of a committed advance.
+func (s ParcelService) publishAdvanced(res advanced) {
+	now := s.timestamp(time.Now())
+	if res.prevStatus != "" {
+		s.events.Publish(Event{Type: EventStatusChanged, Parcel: res.parcel, PrevStatus: res.prevStatus,
+			DeliveryCode: res.deliveryCode, At: now})
+	}
+	if res.prevPayment != "" {
+		s.events.Publish(Event{Type: EventPaymentChanged, Parcel: res.parcel, PrevPayment: res.prevPayment, At: now})
+	}
+}
+
+// SetPaymentStatus changes the payment status of the parcel (see
+// ParcelStore.SetPaymentStatus) and publishes EventPaymentChanged.
+func (s ParcelService) SetPaymentStatus(number int, status string) error {
+	var parcel Parcel
+	var prevPayment string
+
+	err := s.store.InTx(func(tx ParcelStore) error {
+		var err error
+		parcel, err = tx.Get(number)
+		if err != nil {
+			return err
+		}
+		if err := tx.SetPaymentStatus(number, status); err != nil {
+			return err
+		}
+		prevPayment, parcel.Payment = parcel.Payment, status
+		return nil
+	})
+	if err != nil {
+		return mapError(err)
+	}
+
+	if prevPayment != status {
+		s.events.Publish(Event{Type: EventPaymentChanged, Parcel: parcel, PrevPayment: prevPayment, At: s.timestamp(time.Now())})
+	}
+	return nil
+}
+
+// Unpaid returns the parcels that are still unpaid olderThan after
+// registration, excluding cash-on-delivery parcels.
+func (s ParcelService) Unpaid(olderThan time.Duration) ([]Parcel, error) {
+	parcels, err := s.store.GetUnpaid(time.Now().Add(-olderThan))
+	return parcels, mapError(err)
+}
+
+// ChangeAddress updates the delivery address of a registered parcel, or
+// a sent one if the store's address change policy allows it, and
+// publishes EventAddressChanged.
+func (s ParcelService) ChangeAddress(number int, address string) error {
+	var parcel Parcel
+	var prevAddress string
+
+	err := s.store.InTx(func(tx ParcelStore) error {
+		var err error
+		parcel, err = tx.Get(number)
+		if err != nil {
+			return err
+		}
+		if err := tx.SetAddress(number, address); err != nil {
+			return err
+		}
+		prevAddress = parcel.Address
+		// re-read to pick up the address as normalised by the store
+		if parcel, err = tx.Get(number); err != nil {
+			return err
+		}
+		return s.checkAddressFound(tx, parcel)
+	})
+	if err != nil {
+		return mapError(err)
+	}
+
+	s.events.Publish(Event{Type: EventAddressChanged, Parcel: parcel, PrevAddress: prevAddress, At: s.timestamp(time.Now())})
+	return nil
+}
+
+// Delete removes a registered parcel together with its history and
+// publishes EventParcelDeleted.
+func (s ParcelService) Delete(number int) error {
+	var parcel Parcel
+
+	err := s.store.InTx(func(tx ParcelStore) error {
+		var err error
+		parcel, err = tx.Get(number)
+		if err != nil {
+			return err
+		}
+		return tx.Delete(number)
+	})
+	if err != nil {
+		return mapError(err)
+	}
+
+	s.events.Publish(Event{Type: EventParcelDeleted, Parcel: parcel, At: s.timestamp(time.Now())})
+	return nil
+}
+
+// Label writes the printable shipping label of the parcel to w;
+// see RenderLabel.
+func (s ParcelService) Label(number int, w io.Writer) error {
+	parcel, err := s.Get(number)
+	if err != nil {
+		return err
+	}
+	return RenderLabel(w, parcel)
+}
+
+// Overdue returns the undelivered parcels past their deadline.
+func (s ParcelService) Overdue() ([]Parcel, error) {
+	parcels, err := s.store.GetOverdue(time.Now())
+	return parcels, mapError(err)
+}
+
+// FlagOverdue marks newly overdue parcels in their status history and
+// publishes EventSLABreached for each of them.
+func (s ParcelService) FlagOverdue() ([]Parcel, error) {
+	now := time.Now()
+	flagged, err := s.store.FlagOverdue(now)
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	for _, p := range flagged {
+		s.events.Publish(Event{Type: EventSLABreached, Parcel: p, At: s.timestamp(now)})
+	}
+	return flagged, nil
+}
+
+// mapError translates store errors into service-level sentinels, keeping
+// the original error in the chain. nil is returned unchanged.
+func mapError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) && !errors.Is(err, ErrParcelNotFound) {
+		return fmt.Errorf("%w: %w", ErrParcelNotFound, err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, ErrQueryTimeout) {
+		return fmt.Errorf("%w: %w", ErrQueryTimeout, err)
+	}
+	return referenceError(err)
+}
@@ -0,0 +1,53 @@
+package main
+
+import "time"
+
+// Service classes of a parcel, from fastest to cheapest.
+const (
+	ServiceExpress  = "express"
+	ServiceStandard = "standard"
+	ServiceEconomy  = "economy"
+)
+
+// ErrServiceClassUnrecognised indicates a service class other than the
+// ServiceExpress, ServiceStandard and ServiceEconomy constants.
+var ErrServiceClassUnrecognised = newError(CodeUnknownServiceClass, "unrecognised service class")
+
+// serviceClasses lists the service classes in order of speed.
+var serviceClasses = []string{ServiceExpress, ServiceStandard, ServiceEconomy}
+
+// knownServiceClass reports whether class is one of serviceClasses.
+func knownServiceClass(class string) bool {
+	for _, c := range serviceClasses {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery windows of the service classes in DefaultSLAPolicy.
+const (
+	ExpressDeadline  = 2 * 24 * time.Hour
+	StandardDeadline = 5 * 24 * time.Hour
+	EconomyDeadline  = 10 * 24 * time.Hour
+)
+
+// serviceClassRates is the price of each service class in percent of the
+// tariff, which is quoted for ServiceStandard.
+var serviceClassRates = map[string]int{
+	ServiceExpress:  150,
+	ServiceStandard: 100,
+	ServiceEconomy:  80,
+}
+
+// ClassPrice returns the price of a parcel of the service class whose
+// tariff is price kopecks, rounded to the nearest kopeck; unknown
+// classes pay the tariff.
+func ClassPrice(price int, class string) int {
+	rate, ok := serviceClassRates[class]
+	if !ok {
+		return price
+	}
+	return (price*rate + 50) / 100
+}
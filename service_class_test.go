@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestServiceClassRegistration checks that the service class sets the
+// deadline and the price, and that unknown classes are refused.
+func TestServiceClassRegistration(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	getTestTariffs(t, service.store)
+	service = service.WithPricing(nil)
+
+	register := func(class string) Parcel {
+		p, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", WeightGrams: 2000, ServiceClass: class})
+		require.NoError(t, err)
+		return p
+	}
+	deadline := func(p Parcel) time.Duration {
+		created, err := time.Parse(time.RFC3339, p.CreatedAt)
+		require.NoError(t, err)
+		due, err := time.Parse(time.RFC3339, p.DueAt)
+		require.NoError(t, err)
+		return due.Sub(created)
+	}
+
+	// check
+	standard := register("")
+	assert.Equal(t, ServiceStandard, standard.ServiceClass)
+	assert.Equal(t, StandardDeadline, deadline(standard))
+	assert.Equal(t, 40000, standard.Price)
+
+	express := register(ServiceExpress)
+	assert.Equal(t, ExpressDeadline, deadline(express))
+	assert.Equal(t, 60000, express.Price)
+
+	economy := register(ServiceEconomy)
+	assert.Equal(t, EconomyDeadline, deadline(economy))
+	assert.Equal(t, 32000, economy.Price)
+
+	_, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", ServiceClass: "overnight"})
+	assert.ErrorIs(t, err, ErrServiceClassUnrecognised)
+
+	parcels, err := service.FindParcels(ParcelFilter{ServiceClass: ServiceExpress})
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	assert.Equal(t, express.Number, parcels[0].Number)
+	_, err = service.FindParcels(ParcelFilter{ServiceClass: "overnight"})
+	assert.ErrorIs(t, err, ErrServiceClassUnrecognised)
+}
+
+// TestCountOverdueByClass checks the overdue report per service class.
+func TestCountOverdueByClass(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	now := time.Now()
+	past := FormatTimestamp(now.Add(-time.Hour), DefaultTimestampPrecision)
+	future := FormatTimestamp(now.Add(time.Hour), DefaultTimestampPrecision)
+
+	for _, p := range []struct {
+		class, status, due string
+	}{
+		{ServiceExpress, ParcelStatusSent, past},
+		{ServiceExpress, ParcelStatusRegistered, future},
+		{ServiceExpress, ParcelStatusDelivered, past},
+		{ServiceEconomy, ParcelStatusSent, future},
+	} {
+		parcel := getTestParcel()
+		parcel.ServiceClass, parcel.Status, parcel.DueAt = p.class, p.status, p.due
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// check
+	counts, err := store.CountOverdueByClass(ReportPeriod{}, now)
+	require.NoError(t, err)
+	assert.Equal(t, []ClassOverdue{
+		{Class: ServiceExpress, Open: 2, Overdue: 1},
+		{Class: ServiceStandard},
+		{Class: ServiceEconomy, Open: 1},
+	}, counts)
+
+	records, err := ReportCSV(store, "overdue", ReportPeriod{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"service_class", "open", "overdue"}, records[0])
+	assert.Equal(t, []string{ServiceExpress, "2", "1"}, records[1])
+}
+
+// TestServiceClassHTTP checks registering with a service class and
+// filtering GET /parcels by it.
+func TestServiceClassHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service)
+
+	// check
+	rec := doRequest(t, h, http.MethodPost, "/parcels", `{"client": 1000, "address": "test", "service_class": "express"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var created parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	assert.Equal(t, ServiceExpress, created.ServiceClass)
+
+	rec = doRequest(t, h, http.MethodGet, "/parcels?service_class=express", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var parcels []parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&parcels))
+	require.Len(t, parcels, 1)
+
+	rec = doRequest(t, h, http.MethodPost, "/parcels", `{"client": 1000, "address": "test", "service_class": "overnight"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodGet, "/parcels?service_class=overnight", "").Code)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getTestService returns a service over a fresh test database together
+// with the events it publishes.
+func getTestService(t *testing.T) (ParcelService, *[]Event) {
+	t.Helper()
+	db := getTestDB(t)
+	t.Cleanup(func() { db.Close() })
+
+	var published []Event
+	events := NewEventBus()
+	events.Subscribe(func(e Event) { published = append(published, e) })
+	return NewParcelService(NewParcelStore(db), events), &published
+}
+
+// TestServiceLifecycle verifies that registering and advancing a parcel
+// writes the status history and publishes one event per change.
+func TestServiceLifecycle(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+
+	// register
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", Payment: PaymentPaid})
+	require.NoError(t, err)
+	require.NotEmpty(t, parcel.Number)
+
+	// advance twice, then once more past delivered
+	require.NoError(t, service.NextStatus(parcel.Number))
+	require.NoError(t, service.NextStatus(parcel.Number))
+	require.NoError(t, service.NextStatus(parcel.Number))
+
+	// check
+	history, err := service.History(parcel.Number)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, ParcelStatusRegistered, history[0].Status)
+	assert.Equal(t, ParcelStatusSent, history[1].Status)
+	assert.Equal(t, ParcelStatusDelivered, history[2].Status)
+
+	require.Len(t, *published, 3)
+	assert.Equal(t, EventParcelRegistered, (*published)[0].Type)
+	assert.Equal(t, EventStatusChanged, (*published)[2].Type)
+	assert.Equal(t, ParcelStatusSent, (*published)[2].PrevStatus)
+	assert.Equal(t, ParcelStatusDelivered, (*published)[2].Parcel.Status)
+}
+
+// TestServiceDeleteRemovesHistory ensures that deleting a registered parcel
+// also removes its history and that later lookups map to ErrParcelNotFound.
+func TestServiceDeleteRemovesHistory(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	parcel, err := service.Register(1000, "test")
+	require.NoError(t, err)
+
+	// delete
+	require.NoError(t, service.Delete(parcel.Number))
+
+	// check
+	_, err = service.History(parcel.Number)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	history, err := service.store.GetHistory(parcel.Number)
+	require.NoError(t, err)
+	require.Empty(t, history)
+
+	require.Len(t, *published, 2)
+	assert.Equal(t, EventParcelDeleted, (*published)[1].Type)
+}
+
+// TestServiceChangeAddressWhenSent ensures that a failed change neither
+// modifies the parcel nor publishes an event.
+func TestServiceChangeAddressWhenSent(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", Payment: PaymentPaid})
+	require.NoError(t, err)
+	require.NoError(t, service.NextStatus(parcel.Number))
+
+	// change address
+	err = service.ChangeAddress(parcel.Number, "new test address")
+	require.ErrorIs(t, err, ErrRequireRegistered)
+
+	// check
+	stored, err := service.Get(parcel.Number)
+	require.NoError(t, err)
+	assert.Equal(t, "test", stored.Address)
+	require.Len(t, *published, 2)
+}
+
+// TestServiceSetStatus checks that only the current and the next status
+// can be set.
+func TestServiceSetStatus(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", Payment: PaymentPaid})
+	require.NoError(t, err)
+	*published = nil
+
+	// check
+	require.NoError(t, service.SetStatus(parcel.Number, ParcelStatusRegistered))
+	assert.Empty(t, *published)
+	require.ErrorIs(t, service.SetStatus(parcel.Number, ParcelStatusDelivered), ErrStatusTransition)
+	require.ErrorIs(t, service.SetStatus(parcel.Number, "lost"), ErrNewStatusUnrecognised)
+	require.ErrorIs(t, service.SetStatus(42, ParcelStatusSent), ErrParcelNotFound)
+
+	require.NoError(t, service.SetStatus(parcel.Number, ParcelStatusSent))
+	require.Len(t, *published, 1)
+	assert.Equal(t, EventStatusChanged, (*published)[0].Type)
+	require.ErrorIs(t, service.SetStatus(parcel.Number, ParcelStatusRegistered), ErrStatusTransition)
+}
+
+// TestServiceSentAndDeliveredAt verifies that the transitions record when
+// a parcel was first sent and delivered, as in its status history.
+func TestServiceSentAndDeliveredAt(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test", Payment: PaymentPaid})
+	require.NoError(t, err)
+	assert.Empty(t, parcel.SentAt)
+
+	// advance, then force back and forth
+	require.NoError(t, service.NextStatus(parcel.Number))
+	require.NoError(t, service.NextStatus(parcel.Number))
+	require.NoError(t, service.ForceSetStatus(parcel.Number, ParcelStatusSent, "scanned by mistake", "alice"))
+	require.NoError(t, service.ForceSetStatus(parcel.Number, ParcelStatusDelivered, "delivered after all", "alice"))
+
+	// check
+	history, err := service.History(parcel.Number)
+	require.NoError(t, err)
+	require.Len(t, history, 5)
+	stored, err := service.Get(parcel.Number)
+	require.NoError(t, err)
+	assert.Equal(t, history[1].ChangedAt, stored.SentAt)
+	assert.Equal(t, history[2].ChangedAt, stored.DeliveredAt)
+}
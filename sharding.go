@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+// ErrNoShards indicates a ShardedStore built without any shard.
+var ErrNoShards = errors.New("sharded store needs at least one shard")
+
+// ShardedStore spreads parcels over shards, stores on separate SQLite
+// files, by a hash of their client, so that writes for different clients
+// do not queue for the lock of one database. It implements
+// ParcelStorage; everything else, such as reports and search, runs on
+// each shard on its own.
+//
+// Parcel numbers are global: the parcel numbered n in shard i of N has
+// the number n*N + i, so a number alone says where the parcel is. Its
+// tracking code is that of the global number too.
+//
+// The shards and their order must stay the same for the life of the
+// data: the shard of a client and the numbers of parcels depend on both.
+type ShardedStore struct {
+	shards []ParcelStore
+	// limit bounds the shards queried at once; see fanOut.
+	limit int
+}
+
+var _ ParcelStorage = ShardedStore{}
+
+// NewShardedStore returns a store over shards, which must have their
+// schema (see EnsureSchema). It returns ErrNoShards if there is none.
+func NewShardedStore(shards ...ParcelStore) (ShardedStore, error) {
+	if len(shards) == 0 {
+		return ShardedStore{}, ErrNoShards
+	}
+	return ShardedStore{shards: shards, limit: len(shards)}, nil
+}
+
+// OpenShardedStore opens, and creates if need be, a shard at each of
+// paths with opts (see OpenParcelStore and EnsureSchema), and returns a
+// store over them that owns them: closing it closes them. On error the
+// shards opened so far are closed again.
+func OpenShardedStore(paths []string, opts Options) (ShardedStore, error) {
+	shards := make([]ParcelStore, 0, len(paths))
+	fail := func(err error) (ShardedStore, error) {
+		for _, shard := range shards {
+			shard.Close()
+		}
+		return ShardedStore{}, err
+	}
+	for _, path := range paths {
+		shard, err := OpenParcelStore(path, opts)
+		if err != nil {
+			return fail(err)
+		}
+		shards = append(shards, shard)
+		if err := shard.EnsureSchema(context.Background()); err != nil {
+			return fail(fmt.Errorf("failed to prepare shard %s: %w", path, err))
+		}
+	}
+	return NewShardedStore(shards...)
+}
+
+// Close closes every shard and joins their errors; see ParcelStore.Close.
+func (s ShardedStore) Close() error {
+	var errs []error
+	for _, shard := range s.shards {
+		errs = append(errs, shard.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// ShardOf returns the index of the shard holding the parcels of client.
+func (s ShardedStore) ShardOf(client int) int {
+	h := fnv.New32a()
+	binary.Write(h, binary.BigEndian, int64(client))
+	return int(h.Sum32() % uint32(len(s.shards)))
+}
+
+// global returns the global number of the parcel numbered local in shard.
+func (s ShardedStore) global(shard, local int) int {
+	return local*len(s.shards) + shard
+}
+
+// locate returns the shard of the parcel with the global number and its
+// number there. A number no shard can hold is not found, like any other.
+func (s ShardedStore) locate(number int) (ParcelStore, int, error) {
+	if len(s.shards) == 0 {
+		return ParcelStore{}, 0, ErrNoDBConnection
+	}
+	if number < len(s.shards) {
+		return ParcelStore{}, 0, fmt.Errorf("failed to locate parcel with number %d: %w", number, sql.ErrNoRows)
+	}
+	return s.shards[number%len(s.shards)], number / len(s.shards), nil
+}
+
+// globalise rewrites the numbers of parcels read from shard to global ones.
+func (s ShardedStore) globalise(shard int, parcels []Parcel) []Parcel {
+	for i := range parcels {
+		parcels[i].Number = s.global(shard, parcels[i].Number)
+	}
+	return parcels
+}
+
+// Add adds p to the shard of its client and returns its global number;
+// see ParcelStore.Add. Unless p has a tracking code, it gets the one of
+// the global number.
+func (s ShardedStore) Add(p Parcel) (int, error) {
+	if len(s.shards) == 0 {
+		return 0, ErrNoDBConnection
+	}
+
+	i := s.ShardOf(p.Client)
+	assignCode := p.TrackingCode == ""
+	if p.PublicID == "" {
+		id, err := NewPublicID(time.Now())
+		if err != nil {
+			return 0, err
+		}
+		p.PublicID = id
+	}
+	if assignCode {
+		// a code of the local number could be the code of a global one
+		// already in the shard, so hold the place with the unique public ID
+		p.TrackingCode = p.PublicID
+	}
+	var number int
+	err := s.shards[i].InTx(func(tx ParcelStore) error {
+		local, err := tx.Add(p)
+		if err != nil {
+			return err
+		}
+		number = s.global(i, local)
+		if !assignCode {
+			return nil
+		}
+		stored, err := tx.Get(local)
+		if err != nil {
+			return err
+		}
+		code := NewTrackingCode(trackingYear(stored.CreatedAt), number)
+		query := "UPDATE parcel SET tracking_code = :code WHERE number = :number"
+		if _, err := tx.conn().Exec(query, sql.Named("code", code), sql.Named("number", local)); err != nil {
+			return fmt.Errorf("failed to set tracking code of parcel with number %d: %w", number, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return number, nil
+}
+
+// Get returns the parcel with the global number; see ParcelStore.Get.
+func (s ShardedStore) Get(number int) (Parcel, error) {
+	shard, local, err := s.locate(number)
+	if err != nil {
+		return Parcel{}, err
+	}
+	p, err := shard.Get(local)
+	if err != nil {
+		return Parcel{}, err
+	}
+	p.Number = number
+	return p, nil
+}
+
+// GetByClient returns the parcels of client from its shard; see
+// ParcelStore.GetByClient.
+func (s ShardedStore) GetByClient(client int) ([]Parcel, error) {
+	if len(s.shards) == 0 {
+		return nil, ErrNoDBConnection
+	}
+	i := s.ShardOf(client)
+	parcels, err := s.shards[i].GetByClient(client)
+	if err != nil {
+		return nil, err
+	}
+	return s.globalise(i, parcels), nil
+}
+
+// GetByStatus returns the parcels in status from every shard, queried
+// concurrently, oldest first; see ParcelStore.GetByStatus.
+func (s ShardedStore) GetByStatus(status string) ([]Parcel, error) {
+	if len(s.shards) == 0 {
+		return nil, ErrNoDBConnection
+	}
+	parcels, err := fanOut(len(s.shards), s.limit, func(i int) ([]Parcel, error) {
+		parcels, err := s.shards[i].GetByStatus(status)
+		return s.globalise(i, parcels), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// each shard is in order already; the stable sort keeps ties in shard order
+	sort.SliceStable(parcels, func(i, j int) bool { return parcels[i].CreatedAt < parcels[j].CreatedAt })
+	return parcels, nil
+}
+
+// SetStatus sets the status of the parcel with the global number; see
+// ParcelStore.SetStatus.
+func (s ShardedStore) SetStatus(number int, status string) error {
+	shard, local, err := s.locate(number)
+	if err != nil {
+		return err
+	}
+	return shard.SetStatus(local, status)
+}
+
+// SetAddress sets the address of the parcel with the global number; see
+// ParcelStore.SetAddress.
+func (s ShardedStore) SetAddress(number int, address string) error {
+	shard, local, err := s.locate(number)
+	if err != nil {
+		return err
+	}
+	return shard.SetAddress(local, address)
+}
+
+// Delete deletes the parcel with the global number; see
+// ParcelStore.Delete.
+func (s ShardedStore) Delete(number int) error {
+	shard, local, err := s.locate(number)
+	if err != nil {
+		return err
+	}
+	return shard.Delete(local)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getTestShardedStore returns a store over n in-memory shards.
+func getTestShardedStore(t *testing.T, n int) ShardedStore {
+	t.Helper()
+	shards := make([]ParcelStore, n)
+	for i := range shards {
+		db := getTestDB(t)
+		t.Cleanup(func() { db.Close() })
+		shards[i] = NewParcelStore(db)
+	}
+	store, err := NewShardedStore(shards...)
+	require.NoError(t, err)
+	return store
+}
+
+// TestShardedStoreConformance runs the ParcelStorage contract against a
+// sharded store.
+func TestShardedStoreConformance(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T) ParcelStorage {
+		return getTestShardedStore(t, 3)
+	})
+}
+
+// TestShardedStore verifies that parcels are spread by client, found by
+// their global number alone and listed across shards oldest first.
+func TestShardedStore(t *testing.T) {
+	// prepare
+	store := getTestShardedStore(t, 3)
+	created := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	numbers := map[int]int{}
+	for client := 1; client <= 12; client++ {
+		p := getTestParcel()
+		p.Client = client
+		p.CreatedAt = FormatTimestamp(created.Add(time.Duration(client)*time.Minute), DefaultTimestampPrecision)
+		number, err := store.Add(p)
+		require.NoError(t, err)
+		numbers[client] = number
+	}
+
+	// check
+	used := map[int]bool{}
+	for client, number := range numbers {
+		shard := store.ShardOf(client)
+		used[shard] = true
+		assert.Equal(t, shard, number%3)
+
+		p, err := store.Get(number)
+		require.NoError(t, err)
+		assert.Equal(t, number, p.Number)
+		assert.Equal(t, client, p.Client)
+		assert.Equal(t, NewTrackingCode(2024, number), p.TrackingCode)
+
+		parcels, err := store.GetByClient(client)
+		require.NoError(t, err)
+		require.Len(t, parcels, 1)
+		assert.Equal(t, number, parcels[0].Number)
+	}
+	assert.Len(t, used, 3)
+
+	parcels, err := store.GetByStatus(ParcelStatusRegistered)
+	require.NoError(t, err)
+	require.Len(t, parcels, 12)
+	for i, p := range parcels {
+		assert.Equal(t, numbers[i+1], p.Number)
+	}
+
+	_, err = store.Get(2)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = NewShardedStore()
+	assert.ErrorIs(t, err, ErrNoShards)
+}
+
+// TestOpenShardedStore verifies that shards are created on disk and
+// closed with the store.
+func TestOpenShardedStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenShardedStore([]string{filepath.Join(dir, "a.db"), filepath.Join(dir, "b.db")}, DefaultOptions())
+	require.NoError(t, err)
+	number, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	_, err = store.Get(number)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	_, err = OpenShardedStore([]string{filepath.Join(dir, "c.db")}, Options{JournalMode: "fast"})
+	assert.ErrorIs(t, err, ErrInvalidOption)
+}
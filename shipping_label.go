@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Shipping labels are rendered as 4x6 inch PNG images at 203 dpi, the
+// resolution of common thermal label printers.
+const (
+	labelWidth   = 812
+	labelHeight  = 1218
+	labelMargin  = 40
+	labelBarcode = 260 // barcode height in pixels
+	labelQuiet   = 10  // quiet zone width in barcode modules
+)
+
+var (
+	labelFontsOnce sync.Once
+	labelFonts     struct {
+		title, heading, body font.Face
+		err                  error
+	}
+)
+
+// loadLabelFonts parses the embedded Go fonts once. They cover Latin and
+// Cyrillic, so addresses print as entered.
+func loadLabelFonts() error {
+	labelFontsOnce.Do(func() {
+		regular, err := opentype.Parse(goregular.TTF)
+		if err != nil {
+			labelFonts.err = err
+			return
+		}
+		bold, err := opentype.Parse(gobold.TTF)
+		if err != nil {
+			labelFonts.err = err
+			return
+		}
+
+		face := func(f *opentype.Font, size float64) font.Face {
+			if labelFonts.err != nil {
+				return nil
+			}
+			var ff font.Face
+			ff, labelFonts.err = opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 203, Hinting: font.HintingFull})
+			return ff
+		}
+		labelFonts.title = face(bold, 20)
+		labelFonts.heading = face(bold, 11)
+		labelFonts.body = face(regular, 12)
+	})
+	return labelFonts.err
+}
+
+// RenderLabel writes a printable PNG shipping label for p to w: the
+// tracking code as a Code 128 barcode and in plain text, the delivery
+// address, and the parcel's number, client and registration time.
+//
+// Behaviour:
+//   - Returns ErrInvalidTrackingCode (wrapped) if p has no tracking code.
+//   - Wraps and returns any font loading or encoding error.
+func RenderLabel(w io.Writer, p Parcel) error {
+	if p.TrackingCode == "" {
+		return fmt.Errorf("failed to render label for parcel %d: %w: empty", p.Number, ErrInvalidTrackingCode)
+	}
+	if err := loadLabelFonts(); err != nil {
+		return fmt.Errorf("failed to load label fonts: %w", err)
+	}
+
+	modules, err := encodeCode128(p.TrackingCode)
+	if err != nil {
+		return fmt.Errorf("failed to encode barcode for parcel %d: %w", p.Number, err)
+	}
+
+	img := image.NewGray(image.Rect(0, 0, labelWidth, labelHeight))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	y := labelMargin
+	y = drawText(img, labelFonts.heading, "TRACKING NUMBER", labelMargin, y)
+	y = drawText(img, labelFonts.title, p.TrackingCode, labelMargin, y+10)
+
+	y += 30
+	drawBarcode(img, modules, y)
+	y += labelBarcode
+	y = drawText(img, labelFonts.body, p.TrackingCode, labelMargin, y+10)
+
+	y += 40
+	drawRule(img, y)
+	y = drawText(img, labelFonts.heading, "SHIP TO", labelMargin, y+30)
+	for _, line := range wrapText(labelFonts.body, p.Address, labelWidth-2*labelMargin) {
+		y = drawText(img, labelFonts.body, line, labelMargin, y+10)
+	}
+
+	y += 40
+	drawRule(img, y)
+	y = drawText(img, labelFonts.body, fmt.Sprintf("Parcel № %d   Client %d", p.Number, p.Client), labelMargin, y+30)
+	y = drawText(img, labelFonts.body, "Registered "+p.CreatedAt, labelMargin, y+10)
+	if p.DueAt != "" {
+		drawText(img, labelFonts.body, "Due "+p.DueAt, labelMargin, y+10)
+	}
+
+	if err := png.Encode(w, img); err != nil {
+		return fmt.Errorf("failed to encode label for parcel %d: %w", p.Number, err)
+	}
+	return nil
+}
+
+// drawText draws s with its top at y and returns the y of its bottom.
+func drawText(img draw.Image, face font.Face, s string, x, y int) int {
+	m := face.Metrics()
+	d := font.Drawer{
+		Dst:  img,
+		Src:  image.Black,
+		Face: face,
+		Dot:  fixed.P(x, y+m.Ascent.Ceil()),
+	}
+	d.DrawString(s)
+	return y + m.Height.Ceil()
+}
+
+// drawBarcode draws the modules centred horizontally, with the widest
+// whole-pixel module width that keeps the quiet zones on the label.
+func drawBarcode(img *image.Gray, modules []bool, y int) {
+	total := len(modules) + 2*labelQuiet
+	width := labelWidth / total
+	if width < 1 {
+		width = 1
+	}
+	x := (labelWidth - len(modules)*width) / 2
+
+	for i, bar := range modules {
+		if !bar {
+			continue
+		}
+		r := image.Rect(x+i*width, y, x+(i+1)*width, y+labelBarcode)
+		draw.Draw(img, r, image.Black, image.Point{}, draw.Src)
+	}
+}
+
+// drawRule draws a horizontal separator at y.
+func drawRule(img *image.Gray, y int) {
+	r := image.Rect(labelMargin, y, labelWidth-labelMargin, y+3)
+	draw.Draw(img, r, image.Black, image.Point{}, draw.Src)
+}
+
+// wrapText splits s into lines no wider than width pixels, breaking at
+// spaces; a single word wider than width gets a line of its own.
+func wrapText(face font.Face, s string, width int) []string {
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(s) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && font.MeasureString(face, candidate).Ceil() > width {
+			lines = append(lines, line)
+			candidate = word
+		}
+		line = candidate
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
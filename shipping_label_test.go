@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEncodeCode128 verifies the symbol layout and the check symbol of a
+// set B barcode.
+func TestEncodeCode128(t *testing.T) {
+	modules, err := encodeCode128("PKG")
+	require.NoError(t, err)
+
+	// start + 3 data + check symbols of 11 modules, stop of 13
+	require.Len(t, modules, 5*11+13)
+
+	// check = (104 + 1*'P' + 2*'K' + 3*'G') mod 103, with values ch-32
+	check := (104 + 1*48 + 2*43 + 3*39) % 103
+	assert.Equal(t, modulesOf(code128Patterns[check]), modules[4*11:5*11])
+	assert.Equal(t, modulesOf(code128Patterns[code128StartB]), modules[:11])
+
+	_, err = encodeCode128("ПКГ")
+	require.ErrorIs(t, err, ErrBarcodeCharset)
+}
+
+// modulesOf expands a width pattern into modules.
+func modulesOf(pattern string) []bool {
+	var res []bool
+	bar := true
+	for _, w := range pattern {
+		for n := 0; n < int(w-'0'); n++ {
+			res = append(res, bar)
+		}
+		bar = !bar
+	}
+	return res
+}
+
+// TestRenderLabel ensures that a label renders as a 4x6 inch PNG and that
+// parcels without a tracking code are refused.
+func TestRenderLabel(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	parcel, err := service.Register(1000, "Псков, ул. Пушкина, д. 5")
+	require.NoError(t, err)
+
+	// render
+	var buf bytes.Buffer
+	require.NoError(t, service.Label(parcel.Number, &buf))
+
+	// check
+	img, err := png.Decode(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, labelWidth, img.Bounds().Dx())
+	assert.Equal(t, labelHeight, img.Bounds().Dy())
+
+	err = RenderLabel(&buf, getTestParcel())
+	require.ErrorIs(t, err, ErrInvalidTrackingCode)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// HistoryNoteSLABreached marks the status history entry recorded when a
+// parcel misses its delivery deadline.
+const HistoryNoteSLABreached = "SLA breached"
+
+// SLAPolicy defines how long a parcel may take from registration to
+// delivery. Levels overrides Default for specific service levels; a zero
+// duration means "no deadline".
+type SLAPolicy struct {
+	Default time.Duration
+	Levels  map[string]time.Duration
+}
+
+// DefaultSLAPolicy returns a policy with a deadline for each service
+// class: two days for express, five for standard and ten for economy.
+func DefaultSLAPolicy() SLAPolicy {
+	return SLAPolicy{Default: StandardDeadline, Levels: map[string]time.Duration{
+		ServiceExpress: ExpressDeadline,
+		ServiceEconomy: EconomyDeadline,
+	}}
+}
+
+// Deadline returns the delivery window for the service level, falling
+// back to Default for unknown or empty levels.
+func (p SLAPolicy) Deadline(level string) time.Duration {
+	if d, ok := p.Levels[level]; ok {
+		return d
+	}
+	return p.Default
+}
+
+// DueAt returns the RFC 3339 deadline for a parcel of the given service
+// level created at createdAt, or "" if the level has no deadline.
+func (p SLAPolicy) DueAt(createdAt time.Time, level string) string {
+	d := p.Deadline(level)
+	if d <= 0 {
+		return ""
+	}
+	return FormatTimestamp(createdAt.Add(d), DefaultTimestampPrecision)
+}
+
+// GetOverdue returns the parcels whose deadline is earlier than now and
+// that have not been delivered, most overdue first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Parcels without a deadline are never overdue.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) GetOverdue(now time.Time) ([]Parcel, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + parcelColumns + ` FROM parcel
+WHERE due_at != '' AND due_at < :now AND status != :delivered
+ORDER BY due_at, seq`
+	return s.queryParcels("overdue parcels", query,
+		sql.Named("now", FormatTimestamp(now, DefaultTimestampPrecision)), sql.Named("delivered", ParcelStatusDelivered))
+}
+
+// FlagOverdue records a status history entry noted HistoryNoteSLABreached
+// for every overdue parcel that has not been flagged yet, and returns the
+// parcels flagged by this call.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Each parcel is flagged at most once, so the call is safe to repeat.
+//   - Runs in one transaction; wraps and returns any SQL errors.
+func (s ParcelStore) FlagOverdue(now time.Time) ([]Parcel, error) {
+	var flagged []Parcel
+
+	err := s.InTx(func(tx ParcelStore) error {
+		overdue, err := tx.GetOverdue(now)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range overdue {
+			var alreadyFlagged bool
+			query := `SELECT EXISTS (SELECT 1 FROM parcel_status_history
+WHERE parcel_number = :number AND note = :note)`
+			err := tx.conn().QueryRow(query, sql.Named("number", p.Number),
+				sql.Named("note", HistoryNoteSLABreached)).Scan(&alreadyFlagged)
+			if err != nil {
+				return fmt.Errorf("failed to check SLA flag of parcel with number %d: %w", p.Number, err)
+			}
+			if alreadyFlagged {
+				continue
+			}
+
+			err = tx.AddHistory(StatusChange{
+				Number:    p.Number,
+				Status:    p.Status,
+				ChangedAt: FormatTimestamp(now, DefaultTimestampPrecision),
+				Note:      HistoryNoteSLABreached,
+			})
+			if err != nil {
+				return err
+			}
+			flagged = append(flagged, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return flagged, nil
+}
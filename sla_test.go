@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetOverdueAndFlag verifies that only undelivered parcels past their
+// deadline are reported and that each one is flagged exactly once.
+func TestGetOverdueAndFlag(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	now := time.Now().UTC()
+
+	late, onTime, delivered, noDeadline := getTestParcel(), getTestParcel(), getTestParcel(), getTestParcel()
+	late.DueAt = FormatTimestamp(now.Add(-time.Hour), DefaultTimestampPrecision)
+	onTime.DueAt = FormatTimestamp(now.Add(time.Hour), DefaultTimestampPrecision)
+	delivered.DueAt = late.DueAt
+	delivered.Status = ParcelStatusDelivered
+
+	var lateID int
+	for i, p := range []Parcel{late, onTime, delivered, noDeadline} {
+		id, err := store.Add(p)
+		require.NoError(t, err)
+		if i == 0 {
+			lateID = id
+		}
+	}
+
+	// get
+	overdue, err := store.GetOverdue(now)
+	require.NoError(t, err)
+	require.Len(t, overdue, 1)
+	assert.Equal(t, lateID, overdue[0].Number)
+
+	// flag twice
+	flagged, err := store.FlagOverdue(now)
+	require.NoError(t, err)
+	require.Len(t, flagged, 1)
+
+	flagged, err = store.FlagOverdue(now)
+	require.NoError(t, err)
+	require.Empty(t, flagged)
+
+	// check
+	history, err := store.GetHistory(lateID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, HistoryNoteSLABreached, history[0].Note)
+}
+
+// TestSLAPolicyDueAt verifies per-level deadlines and the "no deadline" case.
+func TestSLAPolicyDueAt(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	policy := SLAPolicy{Default: 48 * time.Hour, Levels: map[string]time.Duration{"express": 24 * time.Hour, "none": 0}}
+
+	assert.Equal(t, "2024-01-03T00:00:00.000Z", policy.DueAt(created, ""))
+	assert.Equal(t, "2024-01-02T00:00:00.000Z", policy.DueAt(created, "express"))
+	assert.Empty(t, policy.DueAt(created, "none"))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BadStatus is a parcel whose status is not one of the lifecycle
+// statuses, written before the database refused them (see migration 47)
+// or by hand.
+type BadStatus struct {
+	Number int
+	Status string
+}
+
+// ListBadStatuses returns the parcels whose status is not a known one,
+// by number; such parcels cannot move on with SetStatus until repaired
+// (see RepairStatuses).
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if every status is known.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) ListBadStatuses() ([]BadStatus, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]any, len(parcelStatuses))
+	for i, status := range parcelStatuses {
+		statuses[i] = status
+	}
+	query, args := selectFrom("parcel", "number, status").
+		Where("status NOT IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(statuses)), ", ")+")", statuses...).
+		OrderBy("number").build()
+	rows, err := s.conn().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for bad statuses: %w", err)
+	}
+	defer rows.Close()
+
+	res := []BadStatus{}
+	for rows.Next() {
+		var b BadStatus
+		if err := rows.Scan(&b.Number, &b.Status); err != nil {
+			return nil, fmt.Errorf("failed to scan one of bad statuses: %w", err)
+		}
+		res = append(res, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate bad statuses: %w", err)
+	}
+	return res, nil
+}
+
+// RepairStatuses sets the status of parcels in each unknown status of
+// fixes to the known status it maps to, e.g. {"shipped": "sent"}, and
+// returns how many parcels it repaired. Each repair is noted in the
+// status history of the parcel.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrNewStatusUnrecognised (wrapped) if a status to repair to
+//     is not a known one, before repairing anything.
+//   - Leaves parcels in a known status alone, even if fixes maps it.
+//   - Repairs everything in one transaction.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) RepairStatuses(fixes map[string]string) (int, error) {
+	if err := s.check(); err != nil {
+		return 0, err
+	}
+	for from, to := range fixes {
+		if !knownStatus(to) {
+			return 0, fmt.Errorf("failed to repair status %q: %w %q", from, ErrNewStatusUnrecognised, to)
+		}
+	}
+
+	repaired := 0
+	err := s.InTx(func(tx ParcelStore) error {
+		bad, err := tx.ListBadStatuses()
+		if err != nil {
+			return err
+		}
+		now := FormatTimestamp(time.Now(), DefaultTimestampPrecision)
+		for _, b := range bad {
+			to, ok := fixes[b.Status]
+			if !ok {
+				continue
+			}
+			if err := tx.setStatusAt(b.Number, to, now); err != nil {
+				return fmt.Errorf("failed to repair status of parcel with number %d: %w", b.Number, err)
+			}
+			note := fmt.Sprintf("repaired from unknown status %q", b.Status)
+			if err := tx.AddHistory(StatusChange{Number: b.Number, Status: to, ChangedAt: now, Note: note}); err != nil {
+				return err
+			}
+			repaired++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return repaired, nil
+}
+
+// parseStatusFixes parses fixes of RepairStatuses written as
+// "from=to,from=to".
+func parseStatusFixes(s string) (map[string]string, error) {
+	res := make(map[string]string)
+	for _, fix := range strings.Split(s, ",") {
+		from, to, ok := strings.Cut(strings.TrimSpace(fix), "=")
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("status fix %q is not from=to", fix)
+		}
+		res[from] = to
+	}
+	return res, nil
+}
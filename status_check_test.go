@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStatusCheck verifies that the database refuses unknown statuses
+// and accepts every known one.
+func TestStatusCheck(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	// check
+	for _, status := range parcelStatuses {
+		p := getTestParcel()
+		p.Status = status
+		_, err := store.Add(p)
+		assert.NoError(t, err, status)
+	}
+	_, err := db.Exec("INSERT INTO parcel (client, status, address, created_at) VALUES (?, ?, ?, ?)",
+		1, "lost", "a", "2024-01-01")
+	assert.ErrorContains(t, err, "unknown parcel status")
+	_, err = db.Exec("UPDATE parcel SET status = ?", "lost")
+	assert.ErrorContains(t, err, "unknown parcel status")
+}
+
+// TestRepairStatuses verifies that parcels written with unknown
+// statuses before the check are listed and repaired.
+func TestRepairStatuses(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	good, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	shipped, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	lost, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	// as written before migration 47
+	_, err = db.Exec("DROP TRIGGER parcel_status_check_update")
+	require.NoError(t, err)
+	for number, status := range map[int]string{shipped: "shipped", lost: "lost"} {
+		_, err = db.Exec("UPDATE parcel SET status = ? WHERE number = ?", status, number)
+		require.NoError(t, err)
+	}
+
+	// check
+	bad, err := store.ListBadStatuses()
+	require.NoError(t, err)
+	assert.Equal(t, []BadStatus{{Number: shipped, Status: "shipped"}, {Number: lost, Status: "lost"}}, bad)
+
+	_, err = store.RepairStatuses(map[string]string{"shipped": "gone"})
+	assert.ErrorIs(t, err, ErrNewStatusUnrecognised)
+	n, err := store.RepairStatuses(map[string]string{"shipped": ParcelStatusSent, ParcelStatusRegistered: ParcelStatusSent})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	p, err := store.Get(shipped)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusSent, p.Status)
+	p, err = store.Get(good)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusRegistered, p.Status)
+	history, err := store.GetHistory(shipped)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, `repaired from unknown status "shipped"`, history[0].Note)
+
+	bad, err = store.ListBadStatuses()
+	require.NoError(t, err)
+	assert.Equal(t, []BadStatus{{Number: lost, Status: "lost"}}, bad)
+
+	fixes, err := parseStatusFixes("shipped=sent, lost=registered")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"shipped": "sent", "lost": "registered"}, fixes)
+	_, err = parseStatusFixes("shipped")
+	assert.Error(t, err)
+}
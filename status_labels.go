@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+)
+
+// DefaultLabelLang is the language used when no label exists for the
+// requested one.
+const DefaultLabelLang = "en"
+
+// ErrInvalidLabel indicates that a StatusLabel failed validation.
+var ErrInvalidLabel = newError(CodeInvalidLabel, "invalid status label")
+
+var labelColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// StatusLabel describes how a parcel status is presented to users in a
+// given language. Labels live in the "status_label" table so that
+// frontends can change wording and colours without a release.
+type StatusLabel struct {
+	Status      string
+	Lang        string
+	DisplayName string
+	Color       string
+	Description string
+}
+
+// SetStatusLabel creates or replaces the label for (l.Status, l.Lang).
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrNewStatusUnrecognised (wrapped) for an unknown status.
+//   - Returns ErrInvalidLabel (wrapped) if the language or display name
+//     is empty, or the colour is neither empty nor "#rrggbb".
+//   - Wraps and returns any SQL error from the upsert.
+func (s ParcelStore) SetStatusLabel(l StatusLabel) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	if !knownStatus(l.Status) {
+		return fmt.Errorf("failed to set status label: %w %q", ErrNewStatusUnrecognised, l.Status)
+	}
+	if l.Lang == "" || l.DisplayName == "" {
+		return fmt.Errorf("failed to set status label for %q: %w: language and display name are required", l.Status, ErrInvalidLabel)
+	}
+	if l.Color != "" && !labelColor.MatchString(l.Color) {
+		return fmt.Errorf("failed to set status label for %q: %w: colour %q", l.Status, ErrInvalidLabel, l.Color)
+	}
+
+	query := `INSERT INTO status_label (status, lang, display_name, color, description)
+VALUES (:status, :lang, :display_name, :color, :description)
+ON CONFLICT (status, lang) DO UPDATE SET
+    display_name = excluded.display_name,
+    color = excluded.color,
+    description = excluded.description`
+	_, err := s.conn().Exec(query, sql.Named("status", l.Status), sql.Named("lang", l.Lang),
+		sql.Named("display_name", l.DisplayName), sql.Named("color", l.Color),
+		sql.Named("description", l.Description))
+	if err != nil {
+		return fmt.Errorf("failed to set status label for %q in %q: %w", l.Status, l.Lang, err)
+	}
+	return nil
+}
+
+// GetStatusLabels returns one label per known status for the requested
+// language, in lifecycle order.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Falls back to DefaultLabelLang for statuses without a label in lang.
+//   - Statuses with no label at all are presented by their raw code.
+//   - Wraps and returns any SQL errors from query, scanning, or iteration.
+func (s ParcelStore) GetStatusLabels(lang string) ([]StatusLabel, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT status, lang, display_name, color, description FROM status_label
+WHERE lang IN (:lang, :fallback)`
+	rows, err := s.conn().Query(query, sql.Named("lang", lang), sql.Named("fallback", DefaultLabelLang))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for status labels in %q: %w", lang, err)
+	}
+	defer rows.Close()
+
+	found := map[string]StatusLabel{}
+	for rows.Next() {
+		var l StatusLabel
+
+		err := rows.Scan(&l.Status, &l.Lang, &l.DisplayName, &l.Color, &l.Description)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan one of status label rows in %q: %w", lang, err)
+		}
+		if prev, ok := found[l.Status]; ok && prev.Lang == lang {
+			continue
+		}
+		found[l.Status] = l
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate status label rows in %q: %w", lang, err)
+	}
+
+	res := make([]StatusLabel, 0, len(parcelStatuses))
+	for _, status := range parcelStatuses {
+		l, ok := found[status]
+		if !ok {
+			l = StatusLabel{Status: status, Lang: lang, DisplayName: status}
+		}
+		res = append(res, l)
+	}
+	return res, nil
+}
+
+// Labels translates status codes into the user-facing labels of one
+// language, so that the codes stored and exchanged with other systems stay
+// stable while the wording shown to people varies. The zero value shows
+// every status by its code.
+type Labels struct {
+	Lang     string
+	byStatus map[string]StatusLabel
+}
+
+// Label returns the label of status; a status without one is presented
+// by its code.
+func (l Labels) Label(status string) StatusLabel {
+	if label, ok := l.byStatus[status]; ok {
+		return label
+	}
+	return StatusLabel{Status: status, Lang: l.Lang, DisplayName: status}
+}
+
+// Name returns the display name of status.
+func (l Labels) Name(status string) string {
+	return l.Label(status).DisplayName
+}
+
+// GetLabels returns the Labels of lang, DefaultLabelLang if empty; see
+// GetStatusLabels for the fallbacks.
+func (s ParcelStore) GetLabels(lang string) (Labels, error) {
+	if lang == "" {
+		lang = DefaultLabelLang
+	}
+	labels, err := s.GetStatusLabels(lang)
+	if err != nil {
+		return Labels{Lang: lang}, err
+	}
+
+	res := Labels{Lang: lang, byStatus: make(map[string]StatusLabel, len(labels))}
+	for _, l := range labels {
+		res.byStatus[l.Status] = l
+	}
+	return res, nil
+}
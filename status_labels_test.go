@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetStatusLabelsFallback verifies that labels missing in the requested
+// language fall back to English and that overrides take effect.
+func TestGetStatusLabelsFallback(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	err := store.SetStatusLabel(StatusLabel{
+		Status:      ParcelStatusSent,
+		Lang:        "de",
+		DisplayName: "Versendet",
+		Color:       "#1E88E5",
+	})
+	require.NoError(t, err)
+
+	// get
+	labels, err := store.GetStatusLabels("de")
+	require.NoError(t, err)
+	require.Len(t, labels, len(parcelStatuses))
+
+	// check
+	assert.Equal(t, ParcelStatusRegistered, labels[0].Status)
+	assert.Equal(t, DefaultLabelLang, labels[0].Lang)
+	assert.Equal(t, "Versendet", labels[1].DisplayName)
+	assert.Equal(t, "de", labels[1].Lang)
+}
+
+// TestSetStatusLabelWhenInvalid ensures that unknown statuses and
+// malformed colours are rejected.
+func TestSetStatusLabelWhenInvalid(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	// set
+	err := store.SetStatusLabel(StatusLabel{Status: "lost", Lang: "en", DisplayName: "Lost"})
+	require.ErrorIs(t, err, ErrNewStatusUnrecognised)
+
+	err = store.SetStatusLabel(StatusLabel{Status: ParcelStatusSent, Lang: "en", DisplayName: "Sent", Color: "blue"})
+	require.ErrorIs(t, err, ErrInvalidLabel)
+}
+
+// TestLabels verifies that Labels translates statuses into one language
+// and presents unknown ones by their code.
+func TestLabels(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	// check
+	labels, err := store.GetLabels("ru")
+	require.NoError(t, err)
+	assert.Equal(t, "ru", labels.Lang)
+	assert.Equal(t, "Доставлена", labels.Name(ParcelStatusDelivered))
+	assert.Equal(t, "#43a047", labels.Label(ParcelStatusDelivered).Color)
+	assert.Equal(t, "lost", labels.Name("lost"))
+
+	labels, err = store.GetLabels("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultLabelLang, labels.Lang)
+	assert.Equal(t, "Customs cleared", labels.Name(ParcelStatusCustomsCleared))
+
+	assert.Equal(t, ParcelStatusSent, Labels{}.Name(ParcelStatusSent))
+}
+
+// TestStatusLabelsHTTP verifies that API responses label statuses in the
+// language of the lang parameter or the Accept-Language header.
+func TestStatusLabelsHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service, AllowAnonymous(Principal{Role: RoleAdmin}))
+	number := getSentParcel(t, service)
+	parcel, err := service.Get(number)
+	require.NoError(t, err)
+
+	get := func(target, acceptLanguage string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept-Language", acceptLanguage)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// check
+	for _, tc := range []struct {
+		target, acceptLanguage, label string
+	}{
+		{fmt.Sprintf("/parcels/%d", number), "", "Sent"},
+		{fmt.Sprintf("/parcels/%d", number), "ru-RU,ru;q=0.9,en;q=0.8", "Отправлена"},
+		{fmt.Sprintf("/parcels/%d?lang=en", number), "ru", "Sent"},
+		{fmt.Sprintf("/parcels/%d", number), "*", "Sent"},
+	} {
+		rec := get(tc.target, tc.acceptLanguage)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var res parcelJSON
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		assert.Equal(t, ParcelStatusSent, res.Status)
+		assert.Equal(t, tc.label, res.StatusLabel, tc)
+	}
+
+	rec := get("/track/"+parcel.TrackingCode, "ru")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var tracking trackingJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&tracking))
+	assert.Equal(t, "Отправлена", tracking.StatusLabel)
+	require.Len(t, tracking.History, 2)
+	assert.Equal(t, ParcelStatusRegistered, tracking.History[0].Status)
+	assert.Equal(t, "Зарегистрирована", tracking.History[0].StatusLabel)
+
+	rec = get("/status-labels", "ru")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var labels []statusLabelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&labels))
+	assert.Equal(t, "ru", labels[0].Lang)
+
+	rec = get("/?code="+parcel.TrackingCode, "ru")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Отправлена")
+
+	code, res := doGraphQL(t, h, `query($number: Int) {
+		parcel(number: $number) { statusLabel(lang: "ru") { displayName } }
+	}`, map[string]any{"number": number})
+	require.Equal(t, http.StatusOK, code)
+	require.Nil(t, res["errors"])
+	assert.Equal(t, map[string]any{"displayName": "Отправлена"},
+		res["data"].(map[string]any)["parcel"].(map[string]any)["statusLabel"])
+}
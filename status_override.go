@@ -0,0 +1,148 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidOverride indicates a status override without a reason or an
+// actor.
+var ErrInvalidOverride = newError(CodeInvalidOverride, "invalid status override")
+
+// StatusOverride is the audit entry of a status set with ForceSetStatus.
+type StatusOverride struct {
+	ID        int
+	Number    int
+	OldStatus string
+	NewStatus string
+	Reason    string
+	// Actor identifies who forced the status, e.g. an administrator name.
+	Actor        string
+	OverriddenAt string
+}
+
+// addStatusOverride records o in the "status_override" audit table and
+// returns its id.
+func (s ParcelStore) addStatusOverride(o StatusOverride) (int, error) {
+	query := `INSERT INTO status_override (parcel_number, old_status, new_status, reason, actor, overridden_at)
+VALUES (:number, :old_status, :new_status, :reason, :actor, :overridden_at)`
+	res, err := s.conn().Exec(query, sql.Named("number", o.Number), sql.Named("old_status", o.OldStatus),
+		sql.Named("new_status", o.NewStatus), sql.Named("reason", o.Reason), sql.Named("actor", o.Actor),
+		sql.Named("overridden_at", o.OverriddenAt))
+	if err != nil {
+		return 0, fmt.Errorf("failed to audit status override of parcel %d: %w", o.Number, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get id of status override of parcel %d: %w", o.Number, err)
+	}
+	return int(id), nil
+}
+
+// ListStatusOverrides returns the status overrides of a parcel, oldest
+// first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if the status was never overridden; the
+//     parcel is not required to exist, as the audit outlives it.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) ListStatusOverrides(number int) ([]StatusOverride, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, old_status, new_status, reason, actor, overridden_at FROM status_override
+WHERE parcel_number = :number ORDER BY id`
+	rows, err := s.conn().Query(query, sql.Named("number", number))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for status overrides of parcel %d: %w", number, err)
+	}
+	defer rows.Close()
+
+	res := []StatusOverride{}
+	for rows.Next() {
+		o := StatusOverride{Number: number}
+		if err := rows.Scan(&o.ID, &o.OldStatus, &o.NewStatus, &o.Reason, &o.Actor, &o.OverriddenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan one of status override rows of parcel %d: %w", number, err)
+		}
+		res = append(res, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate status override rows of parcel %d: %w", number, err)
+	}
+	return res, nil
+}
+
+// ForceSetStatus sets the status of the parcel regardless of the
+// lifecycle, e.g. to move back a parcel scanned as delivered by mistake.
+// The change is written to the status history, noted with the reason,
+// and to the "status_override" audit table in one transaction, and
+// EventStatusChanged is published.
+//
+// Behaviour:
+//   - Returns ErrNewStatusUnrecognised (wrapped) for an unknown status.
+//   - Returns ErrInvalidOverride (wrapped) if reason or actor is blank.
+//   - Returns ErrParcelNotFound (wrapped) if the parcel does not exist.
+//   - Does nothing if the parcel already has the status.
+//   - Unlike NextStatus, has no side effects on the payment status.
+func (s ParcelService) ForceSetStatus(number int, status, reason, actor string) error {
+	if !knownStatus(status) {
+		return fmt.Errorf("failed to force status of parcel %d: %w: %q", number, ErrNewStatusUnrecognised, status)
+	}
+	reason, actor = strings.TrimSpace(reason), strings.TrimSpace(actor)
+	if reason == "" {
+		return fmt.Errorf("failed to force status of parcel %d: %w: a reason is required", number, ErrInvalidOverride)
+	}
+	if actor == "" {
+		return fmt.Errorf("failed to force status of parcel %d: %w: an actor is required", number, ErrInvalidOverride)
+	}
+
+	var parcel Parcel
+	var prevStatus string
+	now := s.timestamp(time.Now())
+	err := s.store.InTx(func(tx ParcelStore) error {
+		var err error
+		parcel, err = tx.Get(number)
+		if err != nil {
+			return err
+		}
+		if parcel.Status == status {
+			return nil
+		}
+
+		if err := tx.setStatusAt(number, status, now); err != nil {
+			return err
+		}
+		note := fmt.Sprintf("forced by %s: %s", actor, reason)
+		if err := tx.AddHistory(StatusChange{Number: number, Status: status, ChangedAt: now, Note: note}); err != nil {
+			return err
+		}
+		_, err = tx.addStatusOverride(StatusOverride{Number: number, OldStatus: parcel.Status, NewStatus: status,
+			Reason: reason, Actor: actor, OverriddenAt: now})
+		if err != nil {
+			return err
+		}
+		prevStatus, parcel.Status = parcel.Status, status
+		return nil
+	})
+	if err != nil {
+		return mapError(err)
+	}
+
+	if prevStatus != "" {
+		s.events.Publish(Event{Type: EventStatusChanged, Parcel: parcel, PrevStatus: prevStatus, At: now})
+	}
+	return nil
+}
+
+// StatusOverrides returns the status overrides of the parcel, oldest
+// first.
+func (s ParcelService) StatusOverrides(number int) ([]StatusOverride, error) {
+	if _, err := s.Get(number); err != nil {
+		return nil, err
+	}
+	return s.store.ListStatusOverrides(number)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestForceSetStatus checks that an override moves a parcel back, is
+// written to the history and the audit, and requires a reason.
+func TestForceSetStatus(t *testing.T) {
+	// prepare
+	service, published := getTestService(t)
+	number := getSentParcel(t, service)
+	require.NoError(t, service.NextStatus(number))
+
+	// check
+	err := service.ForceSetStatus(number, ParcelStatusSent, " ", "admin")
+	assert.ErrorIs(t, err, ErrInvalidOverride)
+	err = service.ForceSetStatus(number, ParcelStatusSent, "mis-scan", "")
+	assert.ErrorIs(t, err, ErrInvalidOverride)
+	err = service.ForceSetStatus(number, "lost", "mis-scan", "admin")
+	assert.ErrorIs(t, err, ErrNewStatusUnrecognised)
+	err = service.ForceSetStatus(999, ParcelStatusSent, "mis-scan", "admin")
+	assert.ErrorIs(t, err, ErrParcelNotFound)
+
+	require.NoError(t, service.ForceSetStatus(number, ParcelStatusSent, "scanned as delivered by mistake", "admin"))
+	parcel, err := service.Get(number)
+	require.NoError(t, err)
+	assert.Equal(t, ParcelStatusSent, parcel.Status)
+	last := (*published)[len(*published)-1]
+	assert.Equal(t, EventStatusChanged, last.Type)
+	assert.Equal(t, ParcelStatusDelivered, last.PrevStatus)
+
+	history, err := service.History(number)
+	require.NoError(t, err)
+	assert.Equal(t, "forced by admin: scanned as delivered by mistake", history[len(history)-1].Note)
+
+	// forcing the current status changes nothing
+	require.NoError(t, service.ForceSetStatus(number, ParcelStatusSent, "again", "admin"))
+	overrides, err := service.StatusOverrides(number)
+	require.NoError(t, err)
+	require.Len(t, overrides, 1)
+	assert.Equal(t, ParcelStatusDelivered, overrides[0].OldStatus)
+	assert.Equal(t, ParcelStatusSent, overrides[0].NewStatus)
+	assert.Equal(t, "admin", overrides[0].Actor)
+}
+
+// TestForceSetStatusHTTP checks /parcels/{number}/status-overrides and
+// that only administrators may force a status.
+func TestForceSetStatusHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test"})
+	require.NoError(t, err)
+	h := NewHTTPHandler(service)
+	path := fmt.Sprintf("/parcels/%d/status-overrides", parcel.Number)
+
+	// check
+	rec := doRequest(t, h, http.MethodPost, path, `{"status": "delivered", "reason": "handed over at the desk", "actor": "Ivan"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var updated parcelJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&updated))
+	assert.Equal(t, ParcelStatusDelivered, updated.Status)
+
+	rec = doRequest(t, h, http.MethodGet, path, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var overrides []statusOverrideJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&overrides))
+	require.Len(t, overrides, 1)
+	assert.Equal(t, "Ivan (admin)", overrides[0].Actor)
+
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodPost, path, `{"status": "sent"}`).Code)
+
+	operator := NewAuthorizedService(service, Principal{Role: RoleOperator})
+	err = operator.ForceSetStatus(parcel.Number, ParcelStatusRegistered, "mis-scan", "")
+	assert.ErrorIs(t, err, ErrForbidden)
+}
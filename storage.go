@@ -0,0 +1,32 @@
+package main
+
+// ParcelStorage is the core of the parcel lifecycle ParcelStore
+// implements. Package storetest checks an implementation against it:
+//
+//   - Add assigns a new positive number, a tracking code and a public ID,
+//     and rejects an invalid parcel with a *ValidationError.
+//   - Get, SetAddress and Delete return sql.ErrNoRows (wrapped) for an
+//     unknown number.
+//   - GetByClient and GetByStatus list parcels oldest first, and return
+//     an empty result, not an error, if nothing matches; GetByStatus
+//     rejects an unknown status with ErrNewStatusUnrecognised.
+//   - SetStatus rejects an unknown status with ErrNewStatusUnrecognised;
+//     the order of statuses is the service's to enforce (see
+//     ParcelService.NextStatus).
+//   - SetAddress and Delete return ErrRequireRegistered (wrapped) once
+//     the parcel has been sent.
+//
+// The tracker is a main package, which cannot be imported, so storetest
+// states the contract on its own Parcel and Storage; a backend written
+// elsewhere implements those to run storetest.Run.
+type ParcelStorage interface {
+	Add(p Parcel) (int, error)
+	Get(number int) (Parcel, error)
+	GetByClient(client int) ([]Parcel, error)
+	GetByStatus(status string) ([]Parcel, error)
+	SetStatus(number int, status string) error
+	SetAddress(number int, address string) error
+	Delete(number int) error
+}
+
+var _ ParcelStorage = ParcelStore{}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Yandex-Practicum/go-db-sql-final/storetest"
+)
+
+// conformingStorage adapts a ParcelStorage to the storage checked by
+// package storetest.
+type conformingStorage struct {
+	storage ParcelStorage
+}
+
+// runStoreConformance runs the storetest suite against the storage
+// factory returns, which must be empty and cleaned up with t.
+func runStoreConformance(t *testing.T, factory func(t *testing.T) ParcelStorage) {
+	storetest.Run(t, storetest.Suite{
+		New: func(t *testing.T) storetest.Storage {
+			return conformingStorage{storage: factory(t)}
+		},
+		ErrUnknownStatus:     ErrNewStatusUnrecognised,
+		ErrRequireRegistered: ErrRequireRegistered,
+	})
+}
+
+func (c conformingStorage) Add(p storetest.Parcel) (int, error) {
+	parcel := getTestParcel()
+	parcel.Client, parcel.Status, parcel.Address, parcel.CreatedAt = p.Client, p.Status, p.Address, p.CreatedAt
+	return c.storage.Add(parcel)
+}
+
+func (c conformingStorage) Get(number int) (storetest.Parcel, error) {
+	p, err := c.storage.Get(number)
+	return conformingParcel(p), err
+}
+
+func (c conformingStorage) GetByClient(client int) ([]storetest.Parcel, error) {
+	parcels, err := c.storage.GetByClient(client)
+	return conformingParcels(parcels), err
+}
+
+func (c conformingStorage) GetByStatus(status string) ([]storetest.Parcel, error) {
+	parcels, err := c.storage.GetByStatus(status)
+	return conformingParcels(parcels), err
+}
+
+func (c conformingStorage) SetStatus(number int, status string) error {
+	return c.storage.SetStatus(number, status)
+}
+
+func (c conformingStorage) SetAddress(number int, address string) error {
+	return c.storage.SetAddress(number, address)
+}
+
+func (c conformingStorage) Delete(number int) error {
+	return c.storage.Delete(number)
+}
+
+func conformingParcel(p Parcel) storetest.Parcel {
+	return storetest.Parcel{Number: p.Number, Client: p.Client, Status: p.Status, Address: p.Address,
+		CreatedAt: p.CreatedAt, TrackingCode: p.TrackingCode, PublicID: p.PublicID}
+}
+
+func conformingParcels(parcels []Parcel) []storetest.Parcel {
+	res := make([]storetest.Parcel, len(parcels))
+	for i, p := range parcels {
+		res[i] = conformingParcel(p)
+	}
+	return res
+}
+
+// TestParcelStoreConformance runs the contract against the store and its
+// cached and encrypting variants.
+func TestParcelStoreConformance(t *testing.T) {
+	store := func(t *testing.T) ParcelStore {
+		db := getTestDB(t)
+		t.Cleanup(func() { db.Close() })
+		return NewParcelStore(db)
+	}
+	variants := map[string]func(t *testing.T) ParcelStorage{
+		"plain": func(t *testing.T) ParcelStorage {
+			return store(t)
+		},
+		"cached": func(t *testing.T) ParcelStorage {
+			return store(t).WithCache(NewParcelCache(100, time.Minute))
+		},
+		"encrypted": func(t *testing.T) ParcelStorage {
+			return store(t).WithFieldEncryption(getTestKeyRing(t, "a"))
+		},
+	}
+	for name, factory := range variants {
+		t.Run(name, func(t *testing.T) {
+			runStoreConformance(t, factory)
+		})
+	}
+}
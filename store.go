@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// querier is the subset of methods shared by *sql.DB and *sql.Tx, so
+// store methods run unchanged inside and outside a transaction; either is
+// adapted with timeoutQuerier.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*stmtRows, error)
+	QueryRow(query string, args ...any) *stmtRow
+}
+
+// storeState holds the mutable resources shared by every copy of a
+// ParcelStore: the prepared statement cache, background workers and
+// the closed flag.
+type storeState struct {
+	mu     sync.Mutex
+	closed bool
+	ownsDB bool
+	stmts  map[string]*sql.Stmt
+
+	// ctx is cancelled by Close to signal background workers to stop.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+}
+
+func newStoreState() *storeState {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &storeState{
+		stmts:  make(map[string]*sql.Stmt),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// OpenParcelStore opens the SQLite database at path with opts applied to
+// every pooled connection and returns a ParcelStore that owns it:
+// closing the store also closes the database.
+func OpenParcelStore(path string, opts Options) (ParcelStore, error) {
+	return openParcelStore(driver, path, opts)
+}
+
+// openParcelStore is OpenParcelStore with the database/sql driver named
+// driverName; see DatabaseConfig.
+func openParcelStore(driverName, path string, opts Options) (ParcelStore, error) {
+	if err := opts.Validate(); err != nil {
+		return ParcelStore{}, err
+	}
+
+	db, err := sql.Open(driverName, opts.DSN(path))
+	if err != nil {
+		return ParcelStore{}, fmt.Errorf("failed to open database %q: %w", path, err)
+	}
+
+	store, err := NewParcelStoreWithOptions(db, opts)
+	if err != nil {
+		db.Close()
+		return ParcelStore{}, err
+	}
+	store.state.ownsDB = true
+	return store, nil
+}
+
+// Close shuts the store down.
+//
+// Behaviour:
+//   - Signals every background worker to stop and waits for it to return.
+//   - Closes all cached prepared statements.
+//   - Closes the underlying *sql.DB if the store owns it
+//     (see OpenParcelStore); a caller-supplied connection is left open.
+//   - Is idempotent: calls after the first one return nil.
+//   - Joins and returns any errors raised while releasing resources.
+func (s ParcelStore) Close() error {
+	if s.state == nil {
+		return nil
+	}
+
+	s.state.mu.Lock()
+	if s.state.closed {
+		s.state.mu.Unlock()
+		return nil
+	}
+	s.state.closed = true
+	s.state.mu.Unlock()
+
+	s.state.cancel()
+	s.state.workers.Wait()
+
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+
+	var errs []error
+	for query, stmt := range s.state.stmts {
+		if err := stmt.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close statement %q: %w", query, err))
+		}
+		delete(s.state.stmts, query)
+	}
+	if s.state.ownsDB && s.db != nil {
+		if err := s.db.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close database: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// check returns ErrNoDBConnection if the store was not built by one of
+// the constructors and ErrStoreClosed if Close has already been called.
+func (s ParcelStore) check() error {
+	if s.db == nil || s.state == nil {
+		return ErrNoDBConnection
+	}
+
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	if s.state.closed {
+		return ErrStoreClosed
+	}
+	return nil
+}
+
+// conn returns the transaction the store is bound to, if any,
+// or the database handle otherwise, timing statements out after the
+// timeout of the store (see WithTimeout) and recording its actor with
+// writes (see WithActor).
+func (s ParcelStore) conn() querier {
+	var q ctxQuerier = s.db
+	if s.tx != nil {
+		q = s.tx
+	}
+	var res querier = timeoutQuerier{q: q, timeout: s.timeout}
+	if !s.actor.IsZero() || (s.recorded != nil && *s.recorded != "") {
+		res = actorQuerier{querier: res, store: s}
+	}
+	return res
+}
+
+// InTx runs fn with a copy of the store bound to a single transaction,
+// committing if fn returns nil and rolling back otherwise. Every store
+// method called on the copy takes part in the transaction.
+//
+// Calling InTx on a store that is already bound to a transaction runs fn
+// in that transaction; the outermost InTx decides commit or rollback.
+// When it ends, cache entries invalidated inside it are invalidated
+// again (see WithCache).
+func (s ParcelStore) InTx(fn func(tx ParcelStore) error) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	txStore := s
+	txStore.tx = tx
+	txStore.recorded = new(string)
+	if s.cache != nil {
+		txStore.touched = new([]CacheKey)
+		defer func() {
+			for _, key := range *txStore.touched {
+				s.cache.Invalidate(key)
+			}
+		}()
+	}
+
+	if err := fn(txStore); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := txStore.clearActor(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// prepare returns a cached prepared statement for query, preparing it
+// on first use. Statements live until Close. Inside a transaction the
+// cached statement is rebound to it.
+func (s ParcelStore) prepare(query string) (*sql.Stmt, error) {
+	stmt, err := s.cachedStmt(query)
+	if err != nil || s.tx == nil {
+		return stmt, err
+	}
+	return s.tx.Stmt(stmt), nil
+}
+
+// cachedStmt returns the database-level prepared statement for query.
+func (s ParcelStore) cachedStmt(query string) (*sql.Stmt, error) {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	if s.state.closed {
+		return nil, ErrStoreClosed
+	}
+	if stmt, ok := s.state.stmts[query]; ok {
+		return stmt, nil
+	}
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	s.state.stmts[query] = stmt
+	return stmt, nil
+}
+
+// startWorker runs fn in a background goroutine. The context passed to
+// fn is cancelled when Close is called, and Close waits for fn to return.
+func (s ParcelStore) startWorker(fn func(ctx context.Context)) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	if s.state.closed {
+		return ErrStoreClosed
+	}
+	s.state.workers.Add(1)
+	go func() {
+		defer s.state.workers.Done()
+		fn(s.state.ctx)
+	}()
+	return nil
+}
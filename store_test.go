@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestCloseStopsWorkersAndIsIdempotent verifies that Close cancels
+// background workers, rejects further calls and can be called twice.
+func TestCloseStopsWorkersAndIsIdempotent(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	stopped := make(chan struct{})
+	err := store.startWorker(func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+	require.NoError(t, err)
+
+	// warm the statement cache
+	_, err = store.Add(getTestParcel())
+	require.NoError(t, err)
+	_, err = store.Get(1)
+	require.NoError(t, err)
+
+	// close
+	require.NoError(t, store.Close())
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("worker was not stopped by Close")
+	}
+	require.NoError(t, store.Close())
+
+	// check
+	_, err = store.Get(1)
+	require.ErrorIs(t, err, ErrStoreClosed)
+	require.ErrorIs(t, store.startWorker(func(context.Context) {}), ErrStoreClosed)
+
+	// a caller-supplied connection stays open
+	require.NoError(t, db.Ping())
+}
+
+// TestCloseOwnedDB ensures that a store opened with OpenParcelStore
+// closes its database.
+func TestCloseOwnedDB(t *testing.T) {
+	// prepare
+	store, err := OpenParcelStore(filepath.Join(t.TempDir(), "tracker.db"), DefaultOptions())
+	require.NoError(t, err)
+
+	// close
+	require.NoError(t, store.Close())
+
+	// check
+	require.Error(t, store.db.Ping())
+}
@@ -0,0 +1,192 @@
+// Package storetest checks parcel storage against the contract of the
+// tracker's ParcelStorage, so that a backend written outside the tracker
+// can be tested the way ParcelStore and ShardedStore are.
+//
+// The tracker itself is a main package, which cannot be imported, so the
+// contract is stated here on its own Parcel and Storage; a backend
+// implements Storage, directly or through an adapter, and calls Run from
+// a test:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, storetest.Suite{
+//			New:                  func(t *testing.T) storetest.Storage { return newStorage(t) },
+//			ErrUnknownStatus:     ErrUnknownStatus,
+//			ErrRequireRegistered: ErrRequireRegistered,
+//		})
+//	}
+package storetest
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Statuses of the parcel lifecycle the contract relies on.
+const (
+	StatusRegistered = "registered"
+	StatusSent       = "sent"
+)
+
+// Parcel holds the fields of a parcel the contract covers.
+type Parcel struct {
+	Number  int
+	Client  int
+	Status  string
+	Address string
+	// CreatedAt is an RFC 3339 timestamp.
+	CreatedAt    string
+	TrackingCode string
+	PublicID     string
+}
+
+// Storage is the core of the parcel lifecycle:
+//
+//   - Add assigns a new positive number, a tracking code and a public ID,
+//     and rejects an unknown status with Suite.ErrUnknownStatus.
+//   - Get, SetAddress and Delete return sql.ErrNoRows (wrapped) for an
+//     unknown number.
+//   - GetByClient and GetByStatus list parcels oldest first, and return
+//     an empty result, not an error, if nothing matches; GetByStatus
+//     rejects an unknown status with Suite.ErrUnknownStatus.
+//   - SetStatus rejects an unknown status with Suite.ErrUnknownStatus;
+//     the order of statuses is not its to enforce.
+//   - SetAddress and Delete return Suite.ErrRequireRegistered (wrapped)
+//     once the parcel has been sent.
+type Storage interface {
+	Add(p Parcel) (int, error)
+	Get(number int) (Parcel, error)
+	GetByClient(client int) ([]Parcel, error)
+	GetByStatus(status string) ([]Parcel, error)
+	SetStatus(number int, status string) error
+	SetAddress(number int, address string) error
+	Delete(number int) error
+}
+
+// Suite describes the storage Run checks.
+type Suite struct {
+	// New returns empty storage, cleaned up with t. It is called once per
+	// subtest.
+	New func(t *testing.T) Storage
+	// ErrUnknownStatus is the error the storage wraps for a status it
+	// does not know.
+	ErrUnknownStatus error
+	// ErrRequireRegistered is the error the storage wraps for a change
+	// only allowed before the parcel is sent.
+	ErrRequireRegistered error
+}
+
+// Run checks that the storage of s satisfies the Storage contract, in a
+// subtest per part of it.
+func Run(t *testing.T, s Suite) {
+	t.Run("AddGet", func(t *testing.T) {
+		storage := s.New(t)
+		parcel := newParcel(time.Now())
+
+		number, err := storage.Add(parcel)
+		require.NoError(t, err)
+		assert.Positive(t, number)
+		other, err := storage.Add(parcel)
+		require.NoError(t, err)
+		assert.NotEqual(t, number, other)
+
+		stored, err := storage.Get(number)
+		require.NoError(t, err)
+		assert.Equal(t, number, stored.Number)
+		assert.Equal(t, parcel.Client, stored.Client)
+		assert.Equal(t, parcel.Address, stored.Address)
+		assert.Equal(t, parcel.Status, stored.Status)
+		assert.Equal(t, parcel.CreatedAt, stored.CreatedAt)
+		assert.NotEmpty(t, stored.TrackingCode)
+		assert.NotEmpty(t, stored.PublicID)
+	})
+
+	t.Run("AddInvalid", func(t *testing.T) {
+		storage := s.New(t)
+		parcel := newParcel(time.Now())
+		parcel.Status = "lost"
+
+		_, err := storage.Add(parcel)
+		assert.ErrorIs(t, err, s.ErrUnknownStatus)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		storage := s.New(t)
+
+		_, err := storage.Get(999)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.ErrorIs(t, storage.SetAddress(999, "test"), sql.ErrNoRows)
+		assert.ErrorIs(t, storage.Delete(999), sql.ErrNoRows)
+
+		parcels, err := storage.GetByClient(1000)
+		require.NoError(t, err)
+		assert.Empty(t, parcels)
+		parcels, err = storage.GetByStatus(StatusSent)
+		require.NoError(t, err)
+		assert.Empty(t, parcels)
+	})
+
+	t.Run("Lists", func(t *testing.T) {
+		storage := s.New(t)
+		older, newer := newParcel(time.Now().Add(-time.Hour)), newParcel(time.Now())
+		newerNumber, err := storage.Add(newer)
+		require.NoError(t, err)
+		olderNumber, err := storage.Add(older)
+		require.NoError(t, err)
+		stranger := newParcel(time.Now())
+		stranger.Client = older.Client + 1
+		_, err = storage.Add(stranger)
+		require.NoError(t, err)
+
+		parcels, err := storage.GetByClient(older.Client)
+		require.NoError(t, err)
+		require.Len(t, parcels, 2)
+		assert.Equal(t, olderNumber, parcels[0].Number)
+		assert.Equal(t, newerNumber, parcels[1].Number)
+
+		require.NoError(t, storage.SetStatus(newerNumber, StatusSent))
+		parcels, err = storage.GetByStatus(StatusSent)
+		require.NoError(t, err)
+		require.Len(t, parcels, 1)
+		assert.Equal(t, newerNumber, parcels[0].Number)
+
+		_, err = storage.GetByStatus("lost")
+		assert.ErrorIs(t, err, s.ErrUnknownStatus)
+	})
+
+	t.Run("Transitions", func(t *testing.T) {
+		storage := s.New(t)
+		number, err := storage.Add(newParcel(time.Now()))
+		require.NoError(t, err)
+
+		require.NoError(t, storage.SetAddress(number, "new"))
+		assert.ErrorIs(t, storage.SetStatus(number, "lost"), s.ErrUnknownStatus)
+		require.NoError(t, storage.SetStatus(number, StatusSent))
+		assert.ErrorIs(t, storage.SetAddress(number, "newer"), s.ErrRequireRegistered)
+		assert.ErrorIs(t, storage.Delete(number), s.ErrRequireRegistered)
+
+		stored, err := storage.Get(number)
+		require.NoError(t, err)
+		assert.Equal(t, StatusSent, stored.Status)
+		assert.Equal(t, "new", stored.Address)
+
+		registered, err := storage.Add(newParcel(time.Now()))
+		require.NoError(t, err)
+		require.NoError(t, storage.Delete(registered))
+		_, err = storage.Get(registered)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+}
+
+// newParcel returns a registered parcel created at, to the millisecond.
+func newParcel(at time.Time) Parcel {
+	return Parcel{
+		Client:    1000,
+		Status:    StatusRegistered,
+		Address:   "test",
+		CreatedAt: at.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+	}
+}
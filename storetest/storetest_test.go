@@ -0,0 +1,126 @@
+package storetest
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+)
+
+var (
+	errUnknownStatus     = errors.New("unknown status")
+	errRequireRegistered = errors.New("parcel is not registered")
+)
+
+// memoryStorage is a Storage kept in a map, a backend written outside the
+// tracker.
+type memoryStorage struct {
+	mu      sync.Mutex
+	parcels map[int]Parcel
+	next    int
+}
+
+func (m *memoryStorage) Add(p Parcel) (int, error) {
+	if !known(p.Status) {
+		return 0, fmt.Errorf("failed to add parcel: %w %q", errUnknownStatus, p.Status)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.next++
+	p.Number = m.next
+	p.TrackingCode, p.PublicID = fmt.Sprintf("PKG-%06d", p.Number), fmt.Sprintf("p%d", p.Number)
+	m.parcels[p.Number] = p
+	return p.Number, nil
+}
+
+func (m *memoryStorage) Get(number int) (Parcel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.parcels[number]
+	if !ok {
+		return Parcel{}, fmt.Errorf("failed to get parcel %d: %w", number, sql.ErrNoRows)
+	}
+	return p, nil
+}
+
+func (m *memoryStorage) GetByClient(client int) ([]Parcel, error) {
+	return m.list(func(p Parcel) bool { return p.Client == client }), nil
+}
+
+func (m *memoryStorage) GetByStatus(status string) ([]Parcel, error) {
+	if !known(status) {
+		return nil, fmt.Errorf("failed to get parcels: %w %q", errUnknownStatus, status)
+	}
+	return m.list(func(p Parcel) bool { return p.Status == status }), nil
+}
+
+func (m *memoryStorage) SetStatus(number int, status string) error {
+	if !known(status) {
+		return fmt.Errorf("failed to set status: %w %q", errUnknownStatus, status)
+	}
+	return m.update(number, false, func(p *Parcel) { p.Status = status })
+}
+
+func (m *memoryStorage) SetAddress(number int, address string) error {
+	return m.update(number, true, func(p *Parcel) { p.Address = address })
+}
+
+func (m *memoryStorage) Delete(number int) error {
+	return m.update(number, true, func(p *Parcel) { delete(m.parcels, p.Number) })
+}
+
+// update applies fn to the parcel with the given number, which must still
+// be registered if registered is set.
+func (m *memoryStorage) update(number int, registered bool, fn func(p *Parcel)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.parcels[number]
+	if !ok {
+		return fmt.Errorf("failed to update parcel %d: %w", number, sql.ErrNoRows)
+	}
+	if registered && p.Status != StatusRegistered {
+		return fmt.Errorf("failed to update parcel %d: %w", number, errRequireRegistered)
+	}
+	fn(&p)
+	if _, ok := m.parcels[number]; ok {
+		m.parcels[number] = p
+	}
+	return nil
+}
+
+// list returns the parcels matching keep, oldest first. Every CreatedAt
+// of the suite has the same precision, so they sort as text.
+func (m *memoryStorage) list(keep func(p Parcel) bool) []Parcel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []Parcel
+	for _, p := range m.parcels {
+		if keep(p) {
+			res = append(res, p)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].CreatedAt != res[j].CreatedAt {
+			return res[i].CreatedAt < res[j].CreatedAt
+		}
+		return res[i].Number < res[j].Number
+	})
+	return res
+}
+
+func known(status string) bool {
+	return status == StatusRegistered || status == StatusSent || status == "delivered"
+}
+
+// TestRun runs the suite against storage implemented outside the tracker.
+func TestRun(t *testing.T) {
+	Run(t, Suite{
+		New: func(t *testing.T) Storage {
+			return &memoryStorage{parcels: map[int]Parcel{}}
+		},
+		ErrUnknownStatus:     errUnknownStatus,
+		ErrRequireRegistered: errRequireRegistered,
+	})
+}
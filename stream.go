@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StreamKeepAlive is how often an idle event stream sends a comment, so
+// that proxies do not close it.
+var StreamKeepAlive = 30 * time.Second
+
+// streamBuffer is the number of events queued for a slow stream client;
+// further events are dropped rather than blocking the publisher.
+const streamBuffer = 16
+
+// statusEventJSON is the data of a "status_changed" event of /events.
+type statusEventJSON struct {
+	Parcel     parcelJSON `json:"parcel"`
+	PrevStatus string     `json:"prev_status"`
+	At         string     `json:"at"`
+}
+
+// serveEvents answers r with a stream of server-sent events until the
+// client disconnects or the server shuts down (see Serve). subscribe
+// registers a handler for bus events, and render returns the event name
+// and data of an event, or ok false to skip it. Errors from subscribe
+// are answered with writeErr before the stream starts.
+func serveEvents(w http.ResponseWriter, r *http.Request,
+	subscribe func(func(Event)) (func(), error),
+	render func(Event) (name string, data []byte, ok bool),
+	writeErr func(http.ResponseWriter, int, error),
+) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeErr(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+
+	events := make(chan Event, streamBuffer)
+	unsubscribe, err := subscribe(func(e Event) {
+		select {
+		case events <- e:
+		default:
+		}
+	})
+	if err != nil {
+		writeErr(w, httpStatus(err), err)
+		return
+	}
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(StreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-shuttingDown(r.Context()):
+			return
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case e := <-events:
+			name, data, ok := render(e)
+			if !ok {
+				continue
+			}
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// events serves /events: a stream of "status_changed" events for the
+// parcels the principal may view, optionally only those of ?client=N.
+func (h apiHandler) events(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	var client int
+	if v := r.URL.Query().Get("client"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("query parameter client must be an integer"))
+			return
+		}
+		client = n
+	}
+
+	labels := h.labels(r)
+	serveEvents(w, r, h.as(r).Subscribe, func(e Event) (string, []byte, bool) {
+		if e.Type != EventStatusChanged || client != 0 && e.Parcel.Client != client {
+			return "", nil, false
+		}
+		data, err := json.Marshal(statusEventJSON{Parcel: toParcelJSON(e.Parcel, labels), PrevStatus: e.PrevStatus, At: e.At})
+		return "status_changed", data, err == nil
+	}, writeError)
+}
+
+// trackEvents serves the public /track/{trackingCode}/events: a stream
+// of "status_changed" events of one parcel, each carrying the same
+// sanitised view as /track/{trackingCode}.
+func (h apiHandler) trackEvents(w http.ResponseWriter, r *http.Request, code string) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if _, err := h.service.Track(code); err != nil {
+		writeTrackError(w, err)
+		return
+	}
+
+	labels := h.labels(r)
+	subscribe := func(handler func(Event)) (func(), error) {
+		return h.service.Subscribe(handler), nil
+	}
+	serveEvents(w, r, subscribe, func(e Event) (string, []byte, bool) {
+		if e.Type != EventStatusChanged || e.Parcel.TrackingCode != code {
+			return "", nil, false
+		}
+		v, err := h.service.Track(code)
+		if err != nil {
+			return "", nil, false
+		}
+		data, err := json.Marshal(toTrackingJSON(v, labels))
+		return "status_changed", data, err == nil
+	}, writeError)
+}
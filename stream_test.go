@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openStream starts a GET of an event stream and returns its lines; the
+// stream is closed when the test ends, before cleanups registered
+// earlier, e.g. closing the server.
+func openStream(t *testing.T, target string) *bufio.Scanner {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	return bufio.NewScanner(resp.Body)
+}
+
+// nextEvent reads the next event of a stream, skipping comments.
+func nextEvent(t *testing.T, lines *bufio.Scanner) (name, data string) {
+	t.Helper()
+	for lines.Scan() {
+		line := lines.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "" && name != "":
+			return name, data
+		}
+	}
+	require.NoError(t, lines.Err())
+	t.Fatal("stream ended")
+	return "", ""
+}
+
+// TestEventsStream checks that /events streams the status changes of the
+// requested client only.
+func TestEventsStream(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	other, err := service.RegisterParcel(Parcel{Client: 2000, Address: "other", Payment: PaymentPaid})
+	require.NoError(t, err)
+	own, err := service.RegisterParcel(Parcel{Client: 1000, Address: "own", Payment: PaymentPaid})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(NewHTTPHandler(service, AllowAnonymous(Principal{Role: RoleAdmin})))
+	t.Cleanup(server.Close) // after the stream closes
+	lines := openStream(t, server.URL+"/events?client=1000")
+
+	// change both parcels
+	require.NoError(t, service.NextStatus(other.Number))
+	require.NoError(t, service.NextStatus(own.Number))
+
+	// check
+	name, data := nextEvent(t, lines)
+	assert.Equal(t, "status_changed", name)
+	var e statusEventJSON
+	require.NoError(t, json.Unmarshal([]byte(data), &e))
+	assert.Equal(t, own.Number, e.Parcel.Number)
+	assert.Equal(t, ParcelStatusSent, e.Parcel.Status)
+	assert.Equal(t, ParcelStatusRegistered, e.PrevStatus)
+	assert.NotEmpty(t, e.At)
+
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, server.Config.Handler, http.MethodGet, "/events?client=x", "").Code)
+}
+
+// TestTrackEventsStream checks the public stream of one parcel: it
+// carries the sanitised tracking view and keeps idle connections alive.
+func TestTrackEventsStream(t *testing.T) {
+	// prepare
+	keepAlive := StreamKeepAlive
+	StreamKeepAlive = 10 * time.Millisecond
+	t.Cleanup(func() { StreamKeepAlive = keepAlive })
+
+	service, _ := getTestService(t)
+	parcel, err := service.RegisterParcel(Parcel{Client: 1000, Address: "г. Казань, ул. Баумана, 1", Payment: PaymentPaid})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(NewHTTPHandler(service))
+	t.Cleanup(server.Close) // after the stream closes
+	lines := openStream(t, server.URL+"/track/"+parcel.TrackingCode+"/events")
+
+	// idle
+	require.True(t, lines.Scan())
+	assert.Equal(t, ": keep-alive", lines.Text())
+
+	// change
+	require.NoError(t, service.NextStatus(parcel.Number))
+
+	// check
+	name, data := nextEvent(t, lines)
+	assert.Equal(t, "status_changed", name)
+	assert.NotContains(t, data, "Баумана")
+	var v trackingJSON
+	require.NoError(t, json.Unmarshal([]byte(data), &v))
+	assert.Equal(t, ParcelStatusSent, v.Status)
+	assert.Equal(t, "Казань", v.City)
+	assert.Len(t, v.History, 2)
+
+	h := server.Config.Handler
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodGet, "/track/PKG-2024-000999-0/events", "").Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodGet, "/track/"+parcel.TrackingCode+"/other", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, doRequest(t, h, http.MethodPost, "/track/"+parcel.TrackingCode+"/events", "").Code)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SummaryCount is a row of the parcel summary: the number of parcels of
+// a client registered on a day that are in a status now.
+type SummaryCount struct {
+	Client int
+	// Day is the registration day (UTC) as YYYY-MM-DD.
+	Day    string
+	Status string
+	Count  int
+}
+
+// GetParcelSummary returns the parcel summary of client, or of every
+// client if client is 0, for the registration days in period, ordered by
+// day, client and status. Triggers keep the summary in step with the
+// parcel table in the transaction of each change, so unlike CountByStatus
+// and the other reports it is read rather than computed, for dashboards
+// polling it often.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - The bounds of period are taken as days (UTC): To excludes its day.
+//   - Combinations without parcels are omitted; archived parcels are not
+//     counted.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) GetParcelSummary(client int, period ReportPeriod) ([]SummaryCount, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	q := selectFrom("parcel_summary", "client, day, status, count")
+	if client != 0 {
+		q = q.Where("client = ?", client)
+	}
+	if !period.From.IsZero() {
+		q = q.Where("day >= ?", period.From.UTC().Format(time.DateOnly))
+	}
+	if !period.To.IsZero() {
+		q = q.Where("day < ?", period.To.UTC().Format(time.DateOnly))
+	}
+	query, args := q.OrderBy("day", "client", "status").build()
+	res := []SummaryCount{}
+	err := s.scanReport("parcel summary", query, args, func(rows *sql.Rows) error {
+		var c SummaryCount
+		if err := rows.Scan(&c.Client, &c.Day, &c.Status, &c.Count); err != nil {
+			return err
+		}
+		res = append(res, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ParcelSummary returns the parcel summary; see
+// ParcelStore.GetParcelSummary.
+func (s ParcelService) ParcelSummary(client int, period ReportPeriod) ([]SummaryCount, error) {
+	return s.store.GetParcelSummary(client, period)
+}
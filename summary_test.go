@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetParcelSummary verifies that the summary follows parcels as they
+// are added, change status and are deleted.
+func TestGetParcelSummary(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	add := func(client int, created string) int {
+		p := getTestParcel()
+		p.Client, p.CreatedAt = client, created
+		number, err := store.Add(p)
+		require.NoError(t, err)
+		return number
+	}
+	first := add(1000, "2024-03-01T10:00:00.000Z")
+	add(1000, "2024-03-01T23:59:59.999Z")
+	deleted := add(1000, "2024-03-02T00:00:00.000Z")
+	add(2000, "2024-03-02T12:00:00.000Z")
+	require.NoError(t, store.SetStatus(first, ParcelStatusSent))
+	require.NoError(t, store.SetStatus(first, ParcelStatusSent))
+	require.NoError(t, store.Delete(deleted))
+
+	// check
+	summary, err := store.GetParcelSummary(0, ReportPeriod{})
+	require.NoError(t, err)
+	assert.Equal(t, []SummaryCount{
+		{Client: 1000, Day: "2024-03-01", Status: ParcelStatusRegistered, Count: 1},
+		{Client: 1000, Day: "2024-03-01", Status: ParcelStatusSent, Count: 1},
+		{Client: 2000, Day: "2024-03-02", Status: ParcelStatusRegistered, Count: 1},
+	}, summary)
+
+	summary, err = store.GetParcelSummary(1000, ReportPeriod{})
+	require.NoError(t, err)
+	assert.Len(t, summary, 2)
+	day := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	summary, err = store.GetParcelSummary(0, ReportPeriod{From: day, To: day.AddDate(0, 0, 1)})
+	require.NoError(t, err)
+	assert.Equal(t, []SummaryCount{{Client: 2000, Day: "2024-03-02", Status: ParcelStatusRegistered, Count: 1}}, summary)
+	summary, err = store.GetParcelSummary(3000, ReportPeriod{})
+	require.NoError(t, err)
+	assert.Empty(t, summary)
+}
+
+// TestParcelSummaryHTTP verifies /summary and that clients only see
+// their own rows.
+func TestParcelSummaryHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	for _, client := range []int{1000, 1000, 2000} {
+		_, err := service.RegisterParcel(Parcel{Client: client, Address: "test"})
+		require.NoError(t, err)
+	}
+	h := NewHTTPHandler(service)
+
+	// check
+	rec := doRequest(t, h, http.MethodGet, "/summary?client=1000", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var rows []summaryJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&rows))
+	require.Len(t, rows, 1)
+	assert.Equal(t, 2, rows[0].Count)
+	assert.Equal(t, ParcelStatusRegistered, rows[0].Status)
+
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodGet, "/summary?from=yesterday", "").Code)
+
+	client := NewAuthorizedService(service, Principal{Role: RoleClient, Client: 2000})
+	counts, err := client.ParcelSummary(0, ReportPeriod{})
+	require.NoError(t, err)
+	require.Len(t, counts, 1)
+	assert.Equal(t, 2000, counts[0].Client)
+	_, err = client.ParcelSummary(1000, ReportPeriod{})
+	assert.ErrorIs(t, err, ErrForbidden)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// DefaultZone is the zone assigned to every parcel when the service is
+// not given a ZoneFunc.
+const DefaultZone = "default"
+
+var (
+	// ErrInvalidTariff indicates that a Tariff failed validation.
+	ErrInvalidTariff = newError(CodeInvalidTariff, "invalid tariff")
+	// ErrNoTariff indicates that no weight band of the zone covers the
+	// weight of a parcel.
+	ErrNoTariff = newError(CodeNoTariff, "no tariff for parcel")
+)
+
+// Tariff is one weight band of a delivery zone: parcels up to
+// MaxWeightGrams (inclusive) cost Price, in minor units of
+// DefaultCurrency. A parcel is charged by the lightest band of its zone
+// that still covers its weight.
+type Tariff struct {
+	Zone           string
+	MaxWeightGrams int
+	Price          int
+}
+
+// ZoneFunc decides the delivery zone of a parcel, typically from its
+// address.
+type ZoneFunc func(p Parcel) string
+
+// SetTariff creates or replaces the band (t.Zone, t.MaxWeightGrams).
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidTariff (wrapped) if the zone is empty, the
+//     weight bound is not positive or the price is negative.
+//   - Wraps and returns any SQL error from the upsert.
+func (s ParcelStore) SetTariff(t Tariff) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	if t.Zone == "" || t.MaxWeightGrams <= 0 || t.Price < 0 {
+		return fmt.Errorf("failed to set tariff: %w: zone %q, up to %d g, price %d", ErrInvalidTariff,
+			t.Zone, t.MaxWeightGrams, t.Price)
+	}
+
+	query := `INSERT INTO tariff (zone, max_weight_grams, price) VALUES (:zone, :max_weight, :price)
+ON CONFLICT (zone, max_weight_grams) DO UPDATE SET price = excluded.price`
+	_, err := s.conn().Exec(query, sql.Named("zone", t.Zone), sql.Named("max_weight", t.MaxWeightGrams),
+		sql.Named("price", t.Price))
+	if err != nil {
+		return fmt.Errorf("failed to set tariff for zone %q up to %d g: %w", t.Zone, t.MaxWeightGrams, err)
+	}
+	return nil
+}
+
+// DeleteTariff removes the band (zone, maxWeightGrams). Deleting a band
+// that does not exist is not an error.
+func (s ParcelStore) DeleteTariff(zone string, maxWeightGrams int) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	query := "DELETE FROM tariff WHERE zone = :zone AND max_weight_grams = :max_weight"
+	_, err := s.conn().Exec(query, sql.Named("zone", zone), sql.Named("max_weight", maxWeightGrams))
+	if err != nil {
+		return fmt.Errorf("failed to delete tariff for zone %q up to %d g: %w", zone, maxWeightGrams, err)
+	}
+	return nil
+}
+
+// GetTariffs returns the bands of every zone, ordered by zone and weight.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if no tariff is configured.
+//   - Wraps and returns any SQL errors from query, scanning, or iteration.
+func (s ParcelStore) GetTariffs() ([]Tariff, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.conn().Query("SELECT zone, max_weight_grams, price FROM tariff ORDER BY zone, max_weight_grams")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for tariffs: %w", err)
+	}
+	defer rows.Close()
+
+	var res []Tariff
+	for rows.Next() {
+		var t Tariff
+		if err := rows.Scan(&t.Zone, &t.MaxWeightGrams, &t.Price); err != nil {
+			return nil, fmt.Errorf("failed to scan one of tariff rows: %w", err)
+		}
+		res = append(res, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate tariff rows: %w", err)
+	}
+	return res, nil
+}
+
+// Quote returns the band of zone that applies to a parcel weighing
+// weightGrams: the lightest band whose bound is at least the weight.
+// An unweighed parcel (0 g) is charged by the lightest band.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrNoTariff (wrapped) if the zone has no band that heavy.
+//   - Wraps and returns any other SQL error.
+func (s ParcelStore) Quote(zone string, weightGrams int) (Tariff, error) {
+	t := Tariff{Zone: zone}
+
+	if err := s.check(); err != nil {
+		return t, err
+	}
+
+	query := `SELECT max_weight_grams, price FROM tariff
+WHERE zone = :zone AND max_weight_grams >= :weight
+ORDER BY max_weight_grams LIMIT 1`
+	err := s.conn().QueryRow(query, sql.Named("zone", zone), sql.Named("weight", weightGrams)).
+		Scan(&t.MaxWeightGrams, &t.Price)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, fmt.Errorf("failed to quote %d g in zone %q: %w", weightGrams, zone, ErrNoTariff)
+	}
+	if err != nil {
+		return t, fmt.Errorf("failed to quote %d g in zone %q: %w", weightGrams, zone, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getTestTariffs configures two weight bands in DefaultZone and one in
+// "far".
+func getTestTariffs(t *testing.T, store ParcelStore) {
+	t.Helper()
+	for _, tariff := range []Tariff{
+		{Zone: DefaultZone, MaxWeightGrams: 1000, Price: 25000},
+		{Zone: DefaultZone, MaxWeightGrams: 5000, Price: 40000},
+		{Zone: "far", MaxWeightGrams: 5000, Price: 90000},
+	} {
+		require.NoError(t, store.SetTariff(tariff))
+	}
+}
+
+// TestQuote verifies that a parcel is charged by the lightest band that
+// covers its weight.
+func TestQuote(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	getTestTariffs(t, store)
+
+	cases := []struct {
+		zone   string
+		weight int
+		price  int
+	}{
+		{DefaultZone, 0, 25000},
+		{DefaultZone, 1000, 25000},
+		{DefaultZone, 1001, 40000},
+		{"far", 200, 90000},
+	}
+
+	// check
+	for _, c := range cases {
+		tariff, err := store.Quote(c.zone, c.weight)
+		require.NoError(t, err)
+		assert.Equal(t, c.price, tariff.Price, "%s %d g", c.zone, c.weight)
+	}
+
+	_, err := store.Quote(DefaultZone, 5001)
+	require.ErrorIs(t, err, ErrNoTariff)
+	_, err = store.Quote("moon", 1)
+	require.ErrorIs(t, err, ErrNoTariff)
+}
+
+// TestSetTariff verifies replacing, listing, deleting and validating
+// tariff bands.
+func TestSetTariff(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	getTestTariffs(t, store)
+
+	// replace
+	require.NoError(t, store.SetTariff(Tariff{Zone: DefaultZone, MaxWeightGrams: 1000, Price: 30000}))
+	require.NoError(t, store.DeleteTariff("far", 5000))
+
+	// check
+	tariffs, err := store.GetTariffs()
+	require.NoError(t, err)
+	assert.Equal(t, []Tariff{
+		{Zone: DefaultZone, MaxWeightGrams: 1000, Price: 30000},
+		{Zone: DefaultZone, MaxWeightGrams: 5000, Price: 40000},
+	}, tariffs)
+
+	for _, invalid := range []Tariff{
+		{Zone: "", MaxWeightGrams: 1000, Price: 1},
+		{Zone: DefaultZone, MaxWeightGrams: 0, Price: 1},
+		{Zone: DefaultZone, MaxWeightGrams: 1000, Price: -1},
+	} {
+		require.ErrorIs(t, store.SetTariff(invalid), ErrInvalidTariff)
+	}
+}
+
+// TestRegisterWithPricing verifies that the service stores the zone and
+// price of the applied tariff, and refuses parcels no tariff covers.
+func TestRegisterWithPricing(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	getTestTariffs(t, service.store)
+	service = service.WithPricing(func(p Parcel) string {
+		if p.Address == "far away" {
+			return "far"
+		}
+		return DefaultZone
+	})
+
+	// register
+	near, err := service.RegisterParcel(Parcel{Client: 1, Address: "near", WeightGrams: 2000})
+	require.NoError(t, err)
+	far, err := service.RegisterParcel(Parcel{Client: 1, Address: "far away", WeightGrams: 2000})
+	require.NoError(t, err)
+
+	// check
+	assert.Equal(t, DefaultZone, near.Zone)
+	assert.Equal(t, 40000, near.Price)
+	assert.Equal(t, "far", far.Zone)
+	assert.Equal(t, 90000, far.Price)
+
+	_, err = service.RegisterParcel(Parcel{Client: 1, Address: "near", WeightGrams: 9000})
+	require.ErrorIs(t, err, ErrNoTariff)
+	parcels, err := service.ClientParcels(1)
+	require.NoError(t, err)
+	assert.Len(t, parcels, 2)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultQueryTimeout is the QueryTimeout of DefaultOptions.
+const DefaultQueryTimeout = 30 * time.Second
+
+// ErrQueryTimeout indicates a statement that did not finish within the
+// timeout of the store, e.g. because another process holds a lock on
+// the database.
+var ErrQueryTimeout = newError(CodeQueryTimeout, "query timed out")
+
+// ctxQuerier is the context-aware counterpart of querier, implemented by
+// both *sql.DB and *sql.Tx.
+type ctxQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// timeoutQuerier runs every statement of q with a deadline timeout away,
+// or without one if timeout is zero. The context of a query is released
+// when its rows are closed or its row is scanned.
+type timeoutQuerier struct {
+	q       ctxQuerier
+	timeout time.Duration
+}
+
+func (t timeoutQuerier) Exec(query string, args ...any) (sql.Result, error) {
+	ctx, cancel := queryContext(t.timeout)
+	defer cancel()
+	res, err := t.q.ExecContext(ctx, query, args...)
+	return res, timeoutError(ctx, err)
+}
+
+func (t timeoutQuerier) Query(query string, args ...any) (*stmtRows, error) {
+	ctx, cancel := queryContext(t.timeout)
+	rows, err := t.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		cancel()
+		return nil, timeoutError(ctx, err)
+	}
+	return &stmtRows{Rows: rows, ctx: ctx, cancel: cancel}, nil
+}
+
+func (t timeoutQuerier) QueryRow(query string, args ...any) *stmtRow {
+	ctx, cancel := queryContext(t.timeout)
+	return &stmtRow{Row: t.q.QueryRowContext(ctx, query, args...), ctx: ctx, cancel: cancel}
+}
+
+// stmtRows is the result of timeoutQuerier.Query: rows that release the
+// context of their statement when closed.
+type stmtRows struct {
+	*sql.Rows
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (r *stmtRows) Err() error {
+	return timeoutError(r.ctx, r.Rows.Err())
+}
+
+func (r *stmtRows) Close() error {
+	defer r.cancel()
+	return r.Rows.Close()
+}
+
+// stmtRow is the result of timeoutQuerier.QueryRow: a row that releases
+// the context of its statement once scanned.
+type stmtRow struct {
+	*sql.Row
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (r *stmtRow) Scan(dest ...any) error {
+	defer r.cancel()
+	return timeoutError(r.ctx, r.Row.Scan(dest...))
+}
+
+// queryContext returns the context a statement runs in, expiring after d
+// unless d is zero, and its cancel function.
+func queryContext(d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), d)
+}
+
+// timeoutError wraps err in ErrQueryTimeout if it is due to the deadline
+// of ctx passing. The driver may report an interrupted statement with an
+// error of its own, so the context is checked too.
+func timeoutError(ctx context.Context, err error) error {
+	if err == nil || errors.Is(err, ErrQueryTimeout) {
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrQueryTimeout, err)
+	}
+	return err
+}
+
+// stmtContext returns the context a prepared statement runs in, with
+// the timeout of the store if it has one, and its cancel function.
+func (s ParcelStore) stmtContext() (context.Context, context.CancelFunc) {
+	return queryContext(s.timeout)
+}
+
+// WithTimeout returns a copy of the store whose statements fail with
+// ErrQueryTimeout (wrapped) unless they finish within d, overriding the
+// QueryTimeout it was opened with; zero lets them run as long as they
+// take. It bounds each statement, not a whole transaction, e.g.
+//
+//	store.WithTimeout(time.Second).Get(number)
+//
+// A statement reading rows must finish reading them within d too.
+// SQLite does not interrupt a statement waiting for a lock, so such a
+// wait is bounded by the busy timeout of the connection instead, which
+// Options caps at the QueryTimeout of the store.
+func (s ParcelStore) WithTimeout(d time.Duration) ParcelStore {
+	s.timeout = d
+	return s
+}
+
+// WithTimeout returns a copy of the service whose store statements time
+// out after d; see ParcelStore.WithTimeout.
+func (s ParcelService) WithTimeout(d time.Duration) ParcelService {
+	s.store = s.store.WithTimeout(d)
+	return s
+}
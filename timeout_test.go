@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestQueryTimeout verifies that statements blocked by a lock another
+// connection holds fail with ErrQueryTimeout after the query timeout,
+// long before the busy timeout, and that WithTimeout ends slow ones.
+func TestQueryTimeout(t *testing.T) {
+	// prepare
+	path := filepath.Join(t.TempDir(), "tracker.db")
+	opts := DefaultOptions()
+	opts.BusyTimeout = time.Minute
+	opts.QueryTimeout = 200 * time.Millisecond
+	store, err := OpenParcelStore(path, opts)
+	require.NoError(t, err)
+	defer store.Close()
+	require.NoError(t, store.EnsureSchema(context.Background()))
+	number, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	other, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer other.Close()
+	lock, err := other.Begin()
+	require.NoError(t, err)
+	defer lock.Rollback()
+	_, err = lock.Exec("UPDATE parcel SET address = address WHERE number = ?", number)
+	require.NoError(t, err)
+
+	// check
+	start := time.Now()
+	err = store.SetStatus(number, ParcelStatusSent)
+	require.ErrorIs(t, err, ErrQueryTimeout)
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	start = time.Now()
+	_, err = store.WithTimeout(50 * time.Millisecond).conn().Exec(
+		"WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT COUNT(*) FROM n")
+	require.ErrorIs(t, err, ErrQueryTimeout)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// reads are not blocked under WAL
+	_, err = store.Get(number)
+	require.NoError(t, err)
+
+	require.NoError(t, lock.Rollback())
+	require.NoError(t, store.SetStatus(number, ParcelStatusSent))
+}
+
+// TestQueryTimeoutService verifies that the service reports timeouts
+// with their code.
+func TestQueryTimeoutService(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	service = service.WithTimeout(time.Nanosecond)
+
+	// check
+	_, err := service.RegisterParcel(Parcel{Client: 1000, Address: "test"})
+	require.ErrorIs(t, err, ErrQueryTimeout)
+	assert.Equal(t, CodeQueryTimeout, ErrorCodeOf(err))
+
+	_, err = service.WithTimeout(0).RegisterParcel(Parcel{Client: 1000, Address: "test"})
+	assert.NoError(t, err)
+}
+
+// TestQueryContextReleased verifies that the context of a query is
+// released once its rows are closed or its row is scanned, not at the
+// deadline.
+func TestQueryContextReleased(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	q := timeoutQuerier{q: db, timeout: time.Hour}
+
+	// check
+	rows, err := q.Query("SELECT 1")
+	require.NoError(t, err)
+	require.True(t, rows.Next())
+	require.NoError(t, rows.ctx.Err())
+	require.NoError(t, rows.Close())
+	assert.ErrorIs(t, rows.ctx.Err(), context.Canceled)
+
+	row := q.QueryRow("SELECT 1")
+	var one int
+	require.NoError(t, row.Scan(&one))
+	assert.ErrorIs(t, row.ctx.Err(), context.Canceled)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// DefaultTimestampPrecision is the precision of timestamps written by the
+// store and the service unless configured otherwise.
+const DefaultTimestampPrecision = time.Millisecond
+
+// FormatTimestamp renders t in UTC as RFC 3339 truncated to precision,
+// with a fixed number of fractional digits (none for a second or more,
+// then 3, 6 or 9). Timestamps of the same precision therefore sort
+// lexicographically in chronological order. Timestamps of different
+// precisions do not ("2024-03-01T10:00:21Z" sorts after
+// "2024-03-01T10:00:21.500Z"), so queries over ones that may differ, such
+// as the creation time of parcels (see
+// ParcelService.WithTimestampPrecision), compare them with julianday.
+func FormatTimestamp(t time.Time, precision time.Duration) string {
+	digits := 0
+	switch {
+	case precision <= 0 || precision < time.Microsecond:
+		digits = 9
+	case precision < time.Millisecond:
+		digits = 6
+	case precision < time.Second:
+		digits = 3
+	}
+
+	layout := "2006-01-02T15:04:05Z07:00"
+	if digits > 0 {
+		layout = "2006-01-02T15:04:05." + strings.Repeat("0", digits) + "Z07:00"
+	}
+	if precision > 0 {
+		t = t.Truncate(precision)
+	}
+	return t.UTC().Format(layout)
+}
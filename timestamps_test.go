@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFormatTimestamp verifies fixed-width fractions for every precision.
+func TestFormatTimestamp(t *testing.T) {
+	ts := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.FixedZone("MSK", 3*60*60))
+
+	assert.Equal(t, "2024-05-06T04:08:09Z", FormatTimestamp(ts, time.Second))
+	assert.Equal(t, "2024-05-06T04:08:09.123Z", FormatTimestamp(ts, time.Millisecond))
+	assert.Equal(t, "2024-05-06T04:08:09.123456Z", FormatTimestamp(ts, time.Microsecond))
+	assert.Equal(t, "2024-05-06T04:08:09.123456789Z", FormatTimestamp(ts, time.Nanosecond))
+	assert.Equal(t, "2024-05-06T04:08:09.000Z", FormatTimestamp(ts.Truncate(time.Second), time.Millisecond))
+}
+
+// TestTimestampPrecisionsOrder verifies that parcels created at different
+// timestamp precisions are listed and filtered in chronological order.
+func TestTimestampPrecisionsOrder(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	later := getTestParcel()
+	later.CreatedAt = "2024-03-01T10:00:21.500Z"
+	laterNumber, err := store.Add(later)
+	require.NoError(t, err)
+
+	// added after, but created earlier at second precision
+	earlier := getTestParcel()
+	earlier.CreatedAt = "2024-03-01T10:00:21Z"
+	earlierNumber, err := store.Add(earlier)
+	require.NoError(t, err)
+
+	// check
+	parcels, err := store.GetByClient(later.Client)
+	require.NoError(t, err)
+	require.Len(t, parcels, 2)
+	assert.Equal(t, []int{earlierNumber, laterNumber}, []int{parcels[0].Number, parcels[1].Number})
+
+	unpaid, err := store.GetUnpaid(time.Date(2024, 3, 1, 10, 0, 21, 250_000_000, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, unpaid, 1)
+	assert.Equal(t, earlierNumber, unpaid[0].Number)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrackingCodePrefix starts every tracking code.
+const TrackingCodePrefix = "PKG"
+
+// ErrInvalidTrackingCode indicates a malformed tracking code or one with
+// a wrong check digit.
+var ErrInvalidTrackingCode = newError(CodeInvalidTrackingCode, "invalid tracking code")
+
+// NewTrackingCode returns the tracking code of the parcel with the given
+// number registered in the given year, e.g. "PKG-2024-000123-7".
+//
+// The last digit is a Luhn check digit over the year and the number, so
+// that most typos are rejected before hitting the database.
+func NewTrackingCode(year, number int) string {
+	body := fmt.Sprintf("%04d%06d", year, number)
+	return fmt.Sprintf("%s-%04d-%06d-%d", TrackingCodePrefix, year, number, luhnDigit(body))
+}
+
+// ParseTrackingCode validates code and returns the year and parcel number
+// it encodes.
+func ParseTrackingCode(code string) (year, number int, err error) {
+	parts := strings.Split(code, "-")
+	if len(parts) != 4 || parts[0] != TrackingCodePrefix || len(parts[1]) != 4 ||
+		len(parts[2]) < 6 || len(parts[3]) != 1 {
+		return 0, 0, fmt.Errorf("%w %q", ErrInvalidTrackingCode, code)
+	}
+
+	year, errYear := strconv.Atoi(parts[1])
+	number, errNumber := strconv.Atoi(parts[2])
+	check, errCheck := strconv.Atoi(parts[3])
+	if errYear != nil || errNumber != nil || errCheck != nil || year < 0 || number < 0 {
+		return 0, 0, fmt.Errorf("%w %q", ErrInvalidTrackingCode, code)
+	}
+	if luhnDigit(parts[1]+parts[2]) != check {
+		return 0, 0, fmt.Errorf("%w %q: check digit mismatch", ErrInvalidTrackingCode, code)
+	}
+	return year, number, nil
+}
+
+// luhnDigit returns the Luhn check digit for a string of decimal digits.
+func luhnDigit(digits string) int {
+	sum := 0
+	double := true
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return (10 - sum%10) % 10
+}
+
+// trackingYear returns the registration year encoded in the tracking
+// code, taken from created_at when it parses and the current year otherwise.
+func trackingYear(createdAt string) int {
+	for _, layout := range []string{time.RFC3339Nano, time.RFC3339} {
+		if t, err := time.Parse(layout, createdAt); err == nil {
+			return t.UTC().Year()
+		}
+	}
+	return time.Now().UTC().Year()
+}
+
+// GetByTrackingCode retrieves a parcel by its customer-facing tracking code.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidTrackingCode (wrapped) for a malformed code or a
+//     wrong check digit, without querying the database.
+//   - Returns sql.ErrNoRows (wrapped) if no parcel has the code.
+//   - Wraps and returns any SQL errors from query execution or scanning.
+func (s ParcelStore) GetByTrackingCode(code string) (Parcel, error) {
+	if err := s.check(); err != nil {
+		return Parcel{}, err
+	}
+
+	if _, _, err := ParseTrackingCode(code); err != nil {
+		return Parcel{}, err
+	}
+
+	query, args := selectFrom("parcel", parcelColumns).Where("tracking_code = ?", code).build()
+	p, err := scanParcel(s.conn().QueryRow(query, args...))
+	if err != nil {
+		return p, fmt.Errorf("failed to scan parcel row with tracking code %q: %w", code, err)
+	}
+	return s.openParcel(p)
+}
+
+// backfillTrackingCodes assigns tracking codes to parcels created before
+// tracking codes existed.
+func backfillTrackingCodes(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT number, created_at FROM parcel WHERE tracking_code = ''")
+	if err != nil {
+		return fmt.Errorf("failed to get cursor for tracking code backfill: %w", err)
+	}
+	defer rows.Close()
+
+	codes := map[int]string{}
+	for rows.Next() {
+		var number int
+		var createdAt string
+		if err := rows.Scan(&number, &createdAt); err != nil {
+			return fmt.Errorf("failed to scan one of parcel rows for tracking code backfill: %w", err)
+		}
+		codes[number] = NewTrackingCode(trackingYear(createdAt), number)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate parcel rows for tracking code backfill: %w", err)
+	}
+	rows.Close()
+
+	for number, code := range codes {
+		query := "UPDATE parcel SET tracking_code = :code WHERE number = :number"
+		if _, err := tx.Exec(query, sql.Named("code", code), sql.Named("number", number)); err != nil {
+			return fmt.Errorf("failed to backfill tracking code for parcel with number %d: %w", number, err)
+		}
+	}
+	return nil
+}
+
+// TrackingView is the sanitised view of a parcel shown to anyone holding
+// its tracking code: no client, no full address.
+type TrackingView struct {
+	Code   string
+	Status string
+	// City is the destination city as found by AddressCity; may be empty.
+	City    string
+	History []TrackingEvent
+	// EstimatedDeliveryAt is when the parcel is expected; empty once it
+	// is delivered or if there is no estimate.
+	EstimatedDeliveryAt string
+	// Delayed is set while the parcel is late; see Parcel.Delays.
+	Delayed bool
+	// DeliveryWindow is the window the recipient chose, zero if none.
+	DeliveryWindow DeliveryWindow
+}
+
+// TrackingEvent is a status change in a TrackingView.
+type TrackingEvent struct {
+	Status string
+	At     string
+}
+
+// GetTrackingView returns the public view of the parcel with the given
+// tracking code. Internal history entries, such as SLA breach flags, are
+// left out.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidTrackingCode (wrapped) for a malformed code.
+//   - Returns sql.ErrNoRows (wrapped) if no parcel has the code.
+//   - Wraps and returns any SQL errors.
+func (s ParcelStore) GetTrackingView(code string) (TrackingView, error) {
+	v := TrackingView{Code: code}
+
+	if err := s.check(); err != nil {
+		return v, err
+	}
+	if _, _, err := ParseTrackingCode(code); err != nil {
+		return v, err
+	}
+
+	var number int
+	var address string
+	var delays int
+	query := `SELECT number, status, address, delivery_day, delivery_from, delivery_to, estimated_delivery_at, delays
+FROM parcel WHERE tracking_code = :code`
+	err := s.conn().QueryRow(query, sql.Named("code", code)).Scan(&number, &v.Status, &address,
+		&v.DeliveryWindow.Day, &v.DeliveryWindow.From, &v.DeliveryWindow.To, &v.EstimatedDeliveryAt, &delays)
+	if err != nil {
+		return v, fmt.Errorf("failed to scan parcel row with tracking code %q: %w", code, err)
+	}
+	if address, err = s.open(address, purposeAddress); err != nil {
+		return v, fmt.Errorf("failed to read parcel with tracking code %q: %w", code, err)
+	}
+	v.City = AddressCity(address)
+	if v.Status == ParcelStatusDelivered {
+		v.EstimatedDeliveryAt = ""
+	} else {
+		v.Delayed = delays > 0
+	}
+
+	history, err := s.GetHistory(number)
+	if err != nil {
+		return v, err
+	}
+	for _, c := range history {
+		if c.Note == "" {
+			v.History = append(v.History, TrackingEvent{Status: c.Status, At: c.ChangedAt})
+		}
+	}
+	return v, nil
+}
+
+// streetMarkers are words that mark an address part as a street rather
+// than a city.
+var streetMarkers = []string{"ул.", "улица", "пр.", "проспект", "пер.", "переулок", "ш.", "шоссе", "наб.",
+	"street", "st.", "avenue", "ave", "road", "rd.", "lane", "boulevard"}
+
+// AddressCity guesses the city of a free-text address: the part
+// following "г." or "город" if there is one, otherwise the first
+// comma-separated part with no digits and no street marker. It returns
+// "" if no part qualifies.
+func AddressCity(address string) string {
+	parts := strings.Split(address, ",")
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		for _, prefix := range []string{"г.", "город "} {
+			if city, ok := strings.CutPrefix(part, prefix); ok && strings.TrimSpace(city) != "" {
+				return strings.TrimSpace(city)
+			}
+		}
+	}
+
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" || strings.ContainsAny(part, "0123456789") {
+			continue
+		}
+		lower := strings.ToLower(part)
+		street := false
+		for _, word := range strings.Fields(lower) {
+			for _, marker := range streetMarkers {
+				if word == marker {
+					street = true
+				}
+			}
+		}
+		if !street {
+			return part
+		}
+	}
+	return ""
+}
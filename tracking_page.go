@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+)
+
+var trackingTemplate = template.Must(template.New("tracking").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<title>Parcel tracking</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 2em auto; }
+.status { display: inline-block; padding: .2em .6em; border-radius: .3em; color: #fff; }
+table { border-collapse: collapse; margin-top: 1em; }
+td { padding: .2em 1em .2em 0; }
+.error { color: #c62828; }
+</style>
+</head>
+<body>
+<h1>Parcel tracking</h1>
+<form action="/" method="get">
+<input name="code" value="{{.Code}}" placeholder="PKG-2024-000123-7" size="24" required>
+<input type="hidden" name="lang" value="{{.Lang}}">
+<button type="submit">Track</button>
+</form>
+{{with .Error}}<p class="error">{{.}}</p>{{end}}
+{{with .Result}}
+<h2>{{.Code}}</h2>
+<p><span class="status" style="background: {{.Status.Color}}">{{.Status.DisplayName}}</span></p>
+<p>{{.Status.Description}}</p>
+<table>
+{{range .History}}<tr><td>{{.ChangedAt}}</td><td>{{.DisplayName}}</td></tr>
+{{end}}</table>
+<script>
+new EventSource("/track/" + encodeURIComponent({{.Code}}) + "/events")
+  .addEventListener("status_changed", function () { location.reload(); });
+</script>
+{{end}}
+</body>
+</html>
+`))
+
+// trackingEntry is one status history row shown on the tracking page.
+type trackingEntry struct {
+	ChangedAt   string
+	DisplayName string
+}
+
+// trackingResult is what the tracking page reveals about a parcel: its
+// status and status history, never the client or the address.
+type trackingResult struct {
+	Code    string
+	Status  StatusLabel
+	History []trackingEntry
+}
+
+type trackingView struct {
+	Lang   string
+	Code   string
+	Error  string
+	Result *trackingResult
+}
+
+// trackingPage serves the public HTML tracking page at "/". A page
+// showing a parcel reloads itself when the parcel changes status, using
+// /track/{trackingCode}/events.
+type trackingPage struct {
+	service ParcelService
+}
+
+func newTrackingPage(service ParcelService) http.Handler {
+	return trackingPage{service: service}
+}
+
+func (p trackingPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	view := trackingView{Lang: requestLang(r), Code: r.URL.Query().Get("code")}
+
+	code := http.StatusOK
+	if view.Code != "" {
+		result, err := p.lookup(view.Code, view.Lang)
+		switch {
+		case err == nil:
+			view.Result = result
+		case errors.Is(err, ErrParcelNotFound), errors.Is(err, ErrInvalidTrackingCode):
+			code = http.StatusNotFound
+			view.Error = "No parcel found with this tracking number."
+		default:
+			code = http.StatusInternalServerError
+			view.Error = "Tracking is temporarily unavailable."
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	trackingTemplate.Execute(w, view)
+}
+
+// lookup builds the tracking result for code with labels in lang.
+func (p trackingPage) lookup(code, lang string) (*trackingResult, error) {
+	parcel, err := p.service.GetByTrackingCode(code)
+	if err != nil {
+		return nil, err
+	}
+	history, err := p.service.History(parcel.Number)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := p.service.Labels(lang)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &trackingResult{Code: parcel.TrackingCode, Status: labels.Label(parcel.Status)}
+	for _, c := range history {
+		result.History = append(result.History, trackingEntry{ChangedAt: c.ChangedAt, DisplayName: labels.Name(c.Status)})
+	}
+	return result, nil
+}
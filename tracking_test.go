@@ -0,0 +1,130 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTrackingCodeRoundTrip verifies the format and that the check digit
+// catches a mistyped digit.
+func TestTrackingCodeRoundTrip(t *testing.T) {
+	code := NewTrackingCode(2024, 123)
+	assert.Regexp(t, `^PKG-2024-000123-\d$`, code)
+
+	year, number, err := ParseTrackingCode(code)
+	require.NoError(t, err)
+	assert.Equal(t, 2024, year)
+	assert.Equal(t, 123, number)
+
+	typo := []byte(code)
+	typo[len("PKG-2024-0001")] = '9'
+	_, _, err = ParseTrackingCode(string(typo))
+	require.ErrorIs(t, err, ErrInvalidTrackingCode)
+
+	_, _, err = ParseTrackingCode("PKG-2024-abc-1")
+	require.ErrorIs(t, err, ErrInvalidTrackingCode)
+}
+
+// TestGetByTrackingCode verifies that Add assigns a unique tracking code
+// usable for lookups.
+func TestGetByTrackingCode(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+
+	// add
+	first, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	second, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// get by tracking code
+	stored, err := store.Get(second)
+	require.NoError(t, err)
+	require.NotEmpty(t, stored.TrackingCode)
+
+	byCode, err := store.GetByTrackingCode(stored.TrackingCode)
+	require.NoError(t, err)
+	assert.Equal(t, stored, byCode)
+
+	// check
+	_, err = store.GetByTrackingCode(NewTrackingCode(2000, first))
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	duplicate := getTestParcel()
+	duplicate.TrackingCode = stored.TrackingCode
+	_, err = store.Add(duplicate)
+	require.Error(t, err)
+}
+
+// TestMigrateBackfillsTrackingCodes ensures that parcels created before
+// the tracking code migration receive one.
+func TestMigrateBackfillsTrackingCodes(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(testSchema)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO parcel (client, status, address, created_at)
+VALUES (1, 'sent', 'test', '2023-06-01T10:00:00Z')`)
+	require.NoError(t, err)
+
+	// migrate
+	store := NewParcelStore(db)
+	require.NoError(t, store.Migrate())
+
+	// check
+	stored, err := store.GetByTrackingCode(NewTrackingCode(2023, 1))
+	require.NoError(t, err)
+	assert.Equal(t, 1, stored.Number)
+}
+
+// TestAddressCity checks the city heuristic on typical address layouts.
+func TestAddressCity(t *testing.T) {
+	cases := map[string]string{
+		"г. Москва, ул. Ленина, д. 1":      "Москва",
+		"101000, Москва, ул. Ленина, д. 1": "Москва",
+		"ул. Ленина, д. 1, Казань":         "Казань",
+		"221B Baker Street, London, UK":    "London",
+		"Main st. 1, Springfield":          "Springfield",
+		"test":                             "test",
+		"Flat 2, 10 Downing Street":        "",
+	}
+	for address, city := range cases {
+		assert.Equal(t, city, AddressCity(address), address)
+	}
+}
+
+// TestGetTrackingView verifies that the view leaves out internal history
+// entries.
+func TestGetTrackingView(t *testing.T) {
+	// prepare
+	db := getTestDB(t)
+	defer db.Close()
+	store := NewParcelStore(db)
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	parcel, err := store.Get(id)
+	require.NoError(t, err)
+	require.NoError(t, store.AddHistory(StatusChange{Number: id, Status: parcel.Status, ChangedAt: parcel.CreatedAt}))
+	require.NoError(t, store.AddHistory(StatusChange{Number: id, Status: parcel.Status, ChangedAt: parcel.CreatedAt,
+		Note: HistoryNoteSLABreached}))
+
+	// check
+	view, err := store.GetTrackingView(parcel.TrackingCode)
+	require.NoError(t, err)
+	assert.Equal(t, TrackingView{
+		Code:    parcel.TrackingCode,
+		Status:  ParcelStatusRegistered,
+		City:    "test",
+		History: []TrackingEvent{{Status: ParcelStatusRegistered, At: parcel.CreatedAt}},
+	}, view)
+
+	_, err = store.GetTrackingView(NewTrackingCode(2024, 999))
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
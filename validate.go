@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxCreatedAtSkew is how far in the future CreatedAt may be, to allow for
+// clocks of other writers running ahead of ours.
+const maxCreatedAtSkew = 24 * time.Hour
+
+// FieldError is a rejected field of a Parcel.
+type FieldError struct {
+	// Field is the name of the field in the API, such as "weight_grams".
+	Field string
+	// Err wraps the sentinel error of the field, such as ErrInvalidAddress.
+	Err error
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+// ValidationError lists every rejected field of a Parcel, in the order
+// Parcel.Validate checks them.
+//
+// It unwraps to the errors of its fields, so errors.Is matches the
+// sentinel of any of them and ErrorCodeOf returns the code of the first.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Error())
+	}
+	return "invalid parcel fields: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the errors of the fields.
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		errs = append(errs, f.Err)
+	}
+	return errs
+}
+
+// Validate checks the fields of p that do not depend on the store, so API
+// layers can reject bad input, field by field, before it reaches Add.
+//
+// Behaviour:
+//   - Returns nil if p is valid, or a *ValidationError listing every
+//     rejected field otherwise.
+//   - Client must be positive.
+//   - Address must be non-empty and at most 512 characters, unless
+//     PickupPoint is set: the point's address replaces it then.
+//   - CreatedAt must be an RFC 3339 timestamp at most a day in the future.
+//   - Status must be a lifecycle status; Payment and ServiceClass must be
+//     known if set, as empty ones are defaulted by Add.
+//   - Weight, declared value and price must not be negative, and
+//     dimensions must have all sides positive or none set.
+//   - Recipient, Contents, Coordinates and the customs fields are checked
+//     as Add checks them.
+//   - Store-level checks, such as the store's AddressValidator and
+//     attribute definitions, are left to Add.
+func (p Parcel) Validate() error {
+	var fields []FieldError
+	reject := func(field string, err error) {
+		fields = append(fields, FieldError{Field: field, Err: err})
+	}
+
+	if p.Client <= 0 {
+		reject("client", fmt.Errorf("%w: client %d is not positive", ErrInvalidParcel, pii(p.Client)))
+	}
+	if p.PickupPoint == 0 {
+		switch {
+		case strings.TrimSpace(p.Address) == "":
+			reject("address", fmt.Errorf("%w: empty", ErrInvalidAddress))
+		case utf8.RuneCountInString(p.Address) > maxAddressLength:
+			reject("address", fmt.Errorf("%w: longer than %d characters", ErrInvalidAddress, maxAddressLength))
+		}
+	}
+	if created, err := time.Parse(time.RFC3339, p.CreatedAt); err != nil {
+		reject("created_at", fmt.Errorf("%w: created_at %q is not an RFC 3339 timestamp", ErrInvalidParcel,
+			p.CreatedAt))
+	} else if created.After(time.Now().Add(maxCreatedAtSkew)) {
+		reject("created_at", fmt.Errorf("%w: created_at %q is in the future", ErrInvalidParcel, p.CreatedAt))
+	}
+	if !knownStatus(p.Status) {
+		reject("status", fmt.Errorf("%w %q", ErrNewStatusUnrecognised, p.Status))
+	}
+	if p.Payment != "" && !knownPayment(p.Payment) {
+		reject("payment", fmt.Errorf("%w %q", ErrPaymentStatusUnrecognised, p.Payment))
+	}
+	if p.ServiceClass != "" && !knownServiceClass(p.ServiceClass) {
+		reject("service_class", fmt.Errorf("%w %q", ErrServiceClassUnrecognised, p.ServiceClass))
+	}
+
+	if p.WeightGrams < 0 {
+		reject("weight_grams", fmt.Errorf("%w: negative weight %d g", ErrInvalidParcel, p.WeightGrams))
+	}
+	if p.DeclaredValue < 0 {
+		reject("declared_value", fmt.Errorf("%w: negative declared value %d", ErrInvalidParcel, p.DeclaredValue))
+	}
+	if p.Price < 0 {
+		reject("price", fmt.Errorf("%w: negative price %d", ErrInvalidParcel, p.Price))
+	}
+	if _, err := NormaliseCurrency(p.Currency); err != nil {
+		reject("currency", err)
+	}
+	if d := p.Dimensions; !d.IsZero() && (d.LengthMM <= 0 || d.WidthMM <= 0 || d.HeightMM <= 0) {
+		reject("dimensions", fmt.Errorf("%w: dimensions %dx%dx%d must all be positive", ErrInvalidParcel,
+			d.LengthMM, d.WidthMM, d.HeightMM))
+	}
+
+	if _, err := p.Recipient.normalise(p.phoneCountry()); err != nil {
+		reject("recipient", err)
+	}
+	if _, err := normaliseContents(p.Contents); err != nil {
+		reject("contents", err)
+	}
+	if p.Coordinates != nil && !p.Coordinates.valid() {
+		reject("coordinates", fmt.Errorf("%w %v", ErrInvalidCoordinates, pii(*p.Coordinates)))
+	}
+
+	country, err := normaliseCountry(p.Country)
+	if err != nil {
+		reject("country", err)
+	} else if p.International && country == "" {
+		reject("country", fmt.Errorf("%w: international parcels require a country", ErrInvalidCustoms))
+	}
+	hsCodes, err := normaliseHSCodes(p.HSCodes)
+	if err != nil {
+		reject("hs_codes", err)
+	}
+	reference := strings.TrimSpace(p.CustomsReference)
+	if len(reference) > MaxCustomsReferenceLength {
+		reject("customs_reference", fmt.Errorf("%w: declaration reference is longer than %d characters",
+			ErrInvalidCustoms, MaxCustomsReferenceLength))
+	}
+	if !p.International && (reference != "" || len(hsCodes) > 0) {
+		reject("international", fmt.Errorf("%w: customs declarations apply to international parcels only",
+			ErrInvalidCustoms))
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestValidate verifies that Validate reports every rejected field and
+// that its error matches the sentinels of the fields.
+func TestValidate(t *testing.T) {
+	// check
+	require.NoError(t, getTestParcel().Validate())
+
+	parcel := getTestParcel()
+	parcel.Address, parcel.PickupPoint = "", 1
+	require.NoError(t, parcel.Validate())
+
+	for _, tc := range []struct {
+		field  string
+		change func(p *Parcel)
+		target error
+	}{
+		{"client", func(p *Parcel) { p.Client = 0 }, ErrInvalidParcel},
+		{"address", func(p *Parcel) { p.Address = " " }, ErrInvalidAddress},
+		{"address", func(p *Parcel) { p.Address = strings.Repeat("a", maxAddressLength+1) }, ErrInvalidAddress},
+		{"created_at", func(p *Parcel) { p.CreatedAt = "yesterday" }, ErrInvalidParcel},
+		{"created_at", func(p *Parcel) {
+			p.CreatedAt = FormatTimestamp(time.Now().Add(48*time.Hour), DefaultTimestampPrecision)
+		}, ErrInvalidParcel},
+		{"status", func(p *Parcel) { p.Status = "lost" }, ErrNewStatusUnrecognised},
+		{"payment", func(p *Parcel) { p.Payment = "gift" }, ErrPaymentStatusUnrecognised},
+		{"service_class", func(p *Parcel) { p.ServiceClass = "teleport" }, ErrServiceClassUnrecognised},
+		{"weight_grams", func(p *Parcel) { p.WeightGrams = -1 }, ErrInvalidParcel},
+		{"dimensions", func(p *Parcel) { p.Dimensions = Dimensions{LengthMM: 10} }, ErrInvalidParcel},
+		{"recipient", func(p *Parcel) { p.Recipient = Recipient{Name: "Ann"} }, ErrInvalidRecipient},
+		{"contents", func(p *Parcel) { p.Contents = []string{"plutonium"} }, ErrContentCategoryUnrecognised},
+		{"coordinates", func(p *Parcel) { p.Coordinates = &Coordinates{Lat: 91} }, ErrInvalidCoordinates},
+		{"country", func(p *Parcel) { p.International = true }, ErrInvalidCustoms},
+		{"international", func(p *Parcel) { p.CustomsReference = "CN23-1" }, ErrInvalidCustoms},
+	} {
+		parcel := getTestParcel()
+		tc.change(&parcel)
+		err := parcel.Validate()
+		require.ErrorIs(t, err, tc.target, tc.field)
+		var verr *ValidationError
+		require.ErrorAs(t, err, &verr)
+		require.Len(t, verr.Fields, 1, tc.field)
+		assert.Equal(t, tc.field, verr.Fields[0].Field)
+	}
+
+	parcel = getTestParcel()
+	parcel.Client, parcel.Address, parcel.Price = -1, "", -5
+	err := parcel.Validate()
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	fields := make([]string, 0, len(verr.Fields))
+	for _, f := range verr.Fields {
+		fields = append(fields, f.Field)
+	}
+	assert.Equal(t, []string{"client", "address", "price"}, fields)
+	assert.Equal(t, CodeInvalidParcel, ErrorCodeOf(err))
+
+	// Add validates too
+	db := getTestDB(t)
+	defer db.Close()
+	_, err = NewParcelStore(db).Add(parcel)
+	require.ErrorAs(t, err, &verr)
+	assert.Len(t, verr.Fields, 3)
+}
+
+// TestValidationErrorHTTP verifies that rejected registrations list their
+// fields in the error response.
+func TestValidationErrorHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	h := NewHTTPHandler(service)
+
+	// check
+	body := `{"client": 1000, "address": " ", "weight_grams": -1, "service_class": "teleport"}`
+	rec := doRequest(t, h, http.MethodPost, "/parcels", body)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	var res errorJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	assert.Equal(t, CodeInvalidAddress, res.Code)
+	require.Len(t, res.Fields, 3)
+	assert.Equal(t, fieldErrorJSON{Field: "address", Code: CodeInvalidAddress, Error: "invalid address: empty"},
+		res.Fields[0])
+	assert.Equal(t, "service_class", res.Fields[1].Field)
+	assert.Equal(t, CodeUnknownServiceClass, res.Fields[1].Code)
+	assert.Equal(t, "weight_grams", res.Fields[2].Field)
+	assert.Equal(t, CodeInvalidParcel, res.Fields[2].Code)
+
+	code, gql := doGraphQL(t, h, `mutation { register(client: 0, address: "test") { number } }`, nil)
+	require.Equal(t, http.StatusOK, code)
+	errs := gql["errors"].([]any)
+	require.Len(t, errs, 1)
+	extensions := errs[0].(map[string]any)["extensions"].(map[string]any)
+	assert.Equal(t, string(CodeInvalidParcel), extensions["code"])
+	assert.Len(t, extensions["fields"], 1)
+}
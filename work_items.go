@@ -0,0 +1,317 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kinds of WorkItem.
+const (
+	// WorkItemDelayed is a parcel stuck on the way: it missed EscalateAfter
+	// estimated delivery times; see DetectDelays.
+	WorkItemDelayed = "delayed"
+	// WorkItemAddressInvalid is a parcel whose address the geocoder could
+	// not find (see WithGeocoder), so a courier may not either.
+	WorkItemAddressInvalid = "address_invalid"
+	// WorkItemClaimFiled is a claim filed against a parcel, to be
+	// investigated before it is settled.
+	WorkItemClaimFiled = "claim_filed"
+)
+
+// workItemKinds lists the WorkItem kinds.
+var workItemKinds = []string{WorkItemDelayed, WorkItemAddressInvalid, WorkItemClaimFiled}
+
+// States of WorkItem. An item is queued open, in progress once assigned
+// to an operator, and closed as resolved or dismissed.
+const (
+	WorkItemOpen       = "open"
+	WorkItemInProgress = "in_progress"
+	WorkItemResolved   = "resolved"
+	WorkItemDismissed  = "dismissed"
+)
+
+var (
+	// ErrWorkItemNotFound indicates that no work item exists with the
+	// requested id.
+	ErrWorkItemNotFound = newError(CodeWorkItemNotFound, "work item not found")
+	// ErrInvalidWorkItem indicates a work item of an unknown kind or
+	// without a detail, an assignment without an operator, or a resolution
+	// to a state other than resolved and dismissed.
+	ErrInvalidWorkItem = newError(CodeInvalidWorkItem, "invalid work item")
+	// ErrWorkItemTransition indicates a change of a work item that is
+	// already closed.
+	ErrWorkItemTransition = newError(CodeWorkItemTransition, "work item state transition not allowed")
+)
+
+// WorkItem is an exception in the ops queue: a parcel someone in
+// operations needs to look at.
+type WorkItem struct {
+	ID     int
+	Number int
+	// Kind is one of the WorkItem kind constants.
+	Kind   string
+	Detail string
+	// State is one of the WorkItem state constants.
+	State string
+	// Assignee is the operator working on the item, empty while open.
+	Assignee string
+	// Resolution is the note given when the item was closed.
+	Resolution string
+	CreatedAt  string
+	UpdatedAt  string
+	// ResolvedAt is empty until the item is closed.
+	ResolvedAt string
+}
+
+// closed reports whether the item was resolved or dismissed.
+func (w WorkItem) closed() bool {
+	return w.State == WorkItemResolved || w.State == WorkItemDismissed
+}
+
+// WorkItemFilter selects work items. Zero-valued fields do not restrict
+// the selection.
+type WorkItemFilter struct {
+	// Open selects the items that are open or in progress; it is ignored
+	// if State is set.
+	Open     bool
+	State    string
+	Kind     string
+	Assignee string
+	Number   int
+}
+
+// workItemColumns lists the columns scanned by scanWorkItem, in order.
+const workItemColumns = "id, parcel_number, kind, detail, state, assignee, resolution, created_at, updated_at, resolved_at"
+
+// scanWorkItem scans a row of workItemColumns.
+func scanWorkItem(row interface{ Scan(...any) error }) (WorkItem, error) {
+	var w WorkItem
+	err := row.Scan(&w.ID, &w.Number, &w.Kind, &w.Detail, &w.State, &w.Assignee, &w.Resolution, &w.CreatedAt,
+		&w.UpdatedAt, &w.ResolvedAt)
+	return w, err
+}
+
+// AddWorkItem queues w, open, and returns its id.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrInvalidWorkItem (wrapped) for an unknown kind.
+//   - Wraps and returns any SQL error from the INSERT.
+func (s ParcelStore) AddWorkItem(w WorkItem) (int, error) {
+	if err := s.check(); err != nil {
+		return 0, err
+	}
+	if !knownWorkItemKind(w.Kind) {
+		return 0, fmt.Errorf("failed to add work item of parcel %d: %w: unknown kind %q", w.Number, ErrInvalidWorkItem, w.Kind)
+	}
+
+	query := `INSERT INTO work_item (parcel_number, kind, detail, state, created_at, updated_at)
+VALUES (:number, :kind, :detail, :state, :created_at, :created_at)`
+	res, err := s.conn().Exec(query, sql.Named("number", w.Number), sql.Named("kind", w.Kind),
+		sql.Named("detail", w.Detail), sql.Named("state", WorkItemOpen), sql.Named("created_at", w.CreatedAt))
+	if err != nil {
+		return 0, fmt.Errorf("failed to add %s work item of parcel %d: %w", w.Kind, w.Number, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get id of %s work item of parcel %d: %w", w.Kind, w.Number, err)
+	}
+	return int(id), nil
+}
+
+// knownWorkItemKind reports whether kind is one of workItemKinds.
+func knownWorkItemKind(kind string) bool {
+	for _, k := range workItemKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// updateWorkItem stores the state, assignee and resolution of w.
+func (s ParcelStore) updateWorkItem(w WorkItem) error {
+	query := `UPDATE work_item SET state = :state, assignee = :assignee, resolution = :resolution,
+    updated_at = :updated_at, resolved_at = :resolved_at WHERE id = :id`
+	_, err := s.conn().Exec(query, sql.Named("state", w.State), sql.Named("assignee", w.Assignee),
+		sql.Named("resolution", w.Resolution), sql.Named("updated_at", w.UpdatedAt),
+		sql.Named("resolved_at", w.ResolvedAt), sql.Named("id", w.ID))
+	if err != nil {
+		return fmt.Errorf("failed to update work item %d: %w", w.ID, err)
+	}
+	return nil
+}
+
+// GetWorkItem returns the work item with the given id.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns ErrWorkItemNotFound (wrapped) if no such item exists.
+//   - Wraps and returns any SQL error.
+func (s ParcelStore) GetWorkItem(id int) (WorkItem, error) {
+	if err := s.check(); err != nil {
+		return WorkItem{}, err
+	}
+
+	query := "SELECT " + workItemColumns + " FROM work_item WHERE id = :id"
+	w, err := scanWorkItem(s.conn().QueryRow(query, sql.Named("id", id)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return w, fmt.Errorf("failed to get work item %d: %w", id, ErrWorkItemNotFound)
+	}
+	if err != nil {
+		return w, fmt.Errorf("failed to scan work item row with id %d: %w", id, err)
+	}
+	return w, nil
+}
+
+// ListWorkItems returns the work items f selects, oldest first.
+//
+// Behaviour:
+//   - Returns ErrNoDBConnection if the store is not initialised.
+//   - Returns an empty slice if none match.
+//   - Wraps and returns any SQL errors from query, row scanning, or iteration.
+func (s ParcelStore) ListWorkItems(f WorkItemFilter) ([]WorkItem, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	q := selectFrom("work_item", workItemColumns)
+	switch {
+	case f.State != "":
+		q = q.Where("state = ?", f.State)
+	case f.Open:
+		q = q.WhereIn("state", WorkItemOpen, WorkItemInProgress)
+	}
+	if f.Kind != "" {
+		q = q.Where("kind = ?", f.Kind)
+	}
+	if f.Assignee != "" {
+		q = q.Where("assignee = ?", f.Assignee)
+	}
+	if f.Number != 0 {
+		q = q.Where("parcel_number = ?", f.Number)
+	}
+	query, args := q.OrderBy("id").build()
+	rows, err := s.conn().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor for work items: %w", err)
+	}
+	defer rows.Close()
+
+	res := []WorkItem{}
+	for rows.Next() {
+		w, err := scanWorkItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan one of work item rows: %w", err)
+		}
+		res = append(res, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate work item rows: %w", err)
+	}
+	return res, nil
+}
+
+// ReportWorkItem queues a work item of kind about the parcel, e.g. one a
+// courier reported, and returns it. Surrounding white space is trimmed
+// from detail.
+//
+// Behaviour:
+//   - Returns ErrInvalidWorkItem (wrapped) for an unknown kind or an
+//     empty detail.
+//   - Returns ErrParcelNotFound (wrapped) if the parcel does not exist.
+func (s ParcelService) ReportWorkItem(number int, kind, detail string) (WorkItem, error) {
+	now := s.timestamp(time.Now())
+	w := WorkItem{Number: number, Kind: kind, Detail: strings.TrimSpace(detail), State: WorkItemOpen,
+		CreatedAt: now, UpdatedAt: now}
+	if w.Detail == "" {
+		return w, fmt.Errorf("failed to report work item of parcel %d: %w: detail is required", number, ErrInvalidWorkItem)
+	}
+
+	err := s.store.InTx(func(tx ParcelStore) error {
+		if _, err := tx.getStatus(number); err != nil {
+			return err
+		}
+		var err error
+		w.ID, err = tx.AddWorkItem(w)
+		return err
+	})
+	return w, mapError(err)
+}
+
+// WorkItem returns the work item with the given id.
+func (s ParcelService) WorkItem(id int) (WorkItem, error) {
+	return s.store.GetWorkItem(id)
+}
+
+// WorkItems returns the work items f selects, oldest first.
+func (s ParcelService) WorkItems(f WorkItemFilter) ([]WorkItem, error) {
+	return s.store.ListWorkItems(f)
+}
+
+// AssignWorkItem assigns the work item to operator, taking it over from
+// whoever had it, and returns it in progress.
+//
+// Behaviour:
+//   - Returns ErrWorkItemNotFound (wrapped) if the item does not exist.
+//   - Returns ErrInvalidWorkItem (wrapped) if operator is blank.
+//   - Returns ErrWorkItemTransition (wrapped) if the item is closed.
+func (s ParcelService) AssignWorkItem(id int, operator string) (WorkItem, error) {
+	operator = strings.TrimSpace(operator)
+	if operator == "" {
+		return WorkItem{}, fmt.Errorf("failed to assign work item %d: %w: an operator is required", id, ErrInvalidWorkItem)
+	}
+	return s.changeWorkItem(id, func(w *WorkItem) {
+		w.State, w.Assignee = WorkItemInProgress, operator
+	})
+}
+
+// ResolveWorkItem closes the work item as state, WorkItemResolved or
+// WorkItemDismissed, with the resolution note, and returns it.
+//
+// Behaviour:
+//   - Returns ErrWorkItemNotFound (wrapped) if the item does not exist.
+//   - Returns ErrInvalidWorkItem (wrapped) for another state.
+//   - Returns ErrWorkItemTransition (wrapped) if the item is closed.
+func (s ParcelService) ResolveWorkItem(id int, state, resolution string) (WorkItem, error) {
+	if state != WorkItemResolved && state != WorkItemDismissed {
+		return WorkItem{}, fmt.Errorf("failed to resolve work item %d: %w: cannot resolve to %q", id, ErrInvalidWorkItem, state)
+	}
+	return s.changeWorkItem(id, func(w *WorkItem) {
+		w.State, w.Resolution, w.ResolvedAt = state, strings.TrimSpace(resolution), w.UpdatedAt
+	})
+}
+
+// changeWorkItem applies change to the work item, which must not be
+// closed.
+func (s ParcelService) changeWorkItem(id int, change func(w *WorkItem)) (WorkItem, error) {
+	var w WorkItem
+	err := s.store.InTx(func(tx ParcelStore) error {
+		var err error
+		if w, err = tx.GetWorkItem(id); err != nil {
+			return err
+		}
+		if w.closed() {
+			return fmt.Errorf("failed to update work item %d: %w: item is %s", id, ErrWorkItemTransition, w.State)
+		}
+		w.UpdatedAt = s.timestamp(time.Now())
+		change(&w)
+		return tx.updateWorkItem(w)
+	})
+	return w, err
+}
+
+// checkAddressFound queues a WorkItemAddressInvalid for parcel if the
+// store geocodes addresses and could not find its address; parcels going
+// to a pickup point are left alone.
+func (s ParcelService) checkAddressFound(tx ParcelStore, parcel Parcel) error {
+	if tx.geocoder == nil || parcel.Coordinates != nil || parcel.PickupPoint != 0 {
+		return nil
+	}
+	_, err := tx.AddWorkItem(WorkItem{Number: parcel.Number, Kind: WorkItemAddressInvalid,
+		Detail: "address not found by the geocoder", CreatedAt: s.timestamp(time.Now())})
+	return err
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWorkItemLifecycle checks reporting, assigning and resolving work
+// items and the queries for open ones.
+func TestWorkItemLifecycle(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	parcel, err := service.Register(1000, "test")
+	require.NoError(t, err)
+
+	// check
+	_, err = service.ReportWorkItem(parcel.Number, "lost", "gone")
+	assert.ErrorIs(t, err, ErrInvalidWorkItem)
+	_, err = service.ReportWorkItem(parcel.Number, WorkItemDelayed, "  ")
+	assert.ErrorIs(t, err, ErrInvalidWorkItem)
+	_, err = service.ReportWorkItem(999, WorkItemDelayed, "stuck at the depot")
+	assert.ErrorIs(t, err, ErrParcelNotFound)
+
+	stuck, err := service.ReportWorkItem(parcel.Number, WorkItemDelayed, " stuck at the depot ")
+	require.NoError(t, err)
+	assert.Equal(t, "stuck at the depot", stuck.Detail)
+	assert.Equal(t, WorkItemOpen, stuck.State)
+	other, err := service.ReportWorkItem(parcel.Number, WorkItemAddressInvalid, "no such street")
+	require.NoError(t, err)
+
+	_, err = service.AssignWorkItem(stuck.ID, " ")
+	assert.ErrorIs(t, err, ErrInvalidWorkItem)
+	_, err = service.AssignWorkItem(999, "alice")
+	assert.ErrorIs(t, err, ErrWorkItemNotFound)
+	stuck, err = service.AssignWorkItem(stuck.ID, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, WorkItemInProgress, stuck.State)
+	assert.Equal(t, "alice", stuck.Assignee)
+
+	mine, err := service.WorkItems(WorkItemFilter{Open: true, Assignee: "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, []WorkItem{stuck}, mine)
+
+	_, err = service.ResolveWorkItem(stuck.ID, WorkItemOpen, "")
+	assert.ErrorIs(t, err, ErrInvalidWorkItem)
+	stuck, err = service.ResolveWorkItem(stuck.ID, WorkItemResolved, "found on the wrong shelf")
+	require.NoError(t, err)
+	assert.Equal(t, WorkItemResolved, stuck.State)
+	assert.NotEmpty(t, stuck.ResolvedAt)
+	_, err = service.AssignWorkItem(stuck.ID, "bob")
+	assert.ErrorIs(t, err, ErrWorkItemTransition)
+	_, err = service.ResolveWorkItem(stuck.ID, WorkItemDismissed, "")
+	assert.ErrorIs(t, err, ErrWorkItemTransition)
+
+	open, err := service.WorkItems(WorkItemFilter{Open: true})
+	require.NoError(t, err)
+	assert.Equal(t, []WorkItem{other}, open)
+	stored, err := service.WorkItem(stuck.ID)
+	require.NoError(t, err)
+	assert.Equal(t, stuck, stored)
+	all, err := service.WorkItems(WorkItemFilter{Number: parcel.Number})
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+}
+
+// TestWorkItemsQueued verifies that filed claims and addresses the
+// geocoder cannot find are queued for ops.
+func TestWorkItemsQueued(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	service.store = service.store.WithGeocoder(testGeocoder)
+
+	// check
+	found, err := service.Register(1000, "Red Square")
+	require.NoError(t, err)
+	unknown, err := service.Register(1000, "Nowhere Lane")
+	require.NoError(t, err)
+	require.NoError(t, service.ChangeAddress(found.Number, "Nowhere Lane"))
+	require.NoError(t, service.ChangeAddress(unknown.Number, "Gorky Park"))
+
+	items, err := service.WorkItems(WorkItemFilter{Kind: WorkItemAddressInvalid})
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, unknown.Number, items[0].Number)
+	assert.Equal(t, found.Number, items[1].Number)
+
+	parcel := getClaimableParcel(t, service)
+	claim, err := service.FileClaim(parcel.Number, ClaimLost, 100, "never arrived")
+	require.NoError(t, err)
+	items, err = service.WorkItems(WorkItemFilter{Kind: WorkItemClaimFiled, Open: true})
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, parcel.Number, items[0].Number)
+	assert.Contains(t, items[0].Detail, fmt.Sprintf("claim %d", claim.ID))
+}
+
+// TestWorkItemsHTTP checks the /work-items endpoints and that only
+// operators and admins reach the queue.
+func TestWorkItemsHTTP(t *testing.T) {
+	// prepare
+	service, _ := getTestService(t)
+	parcel, err := service.Register(1000, "test")
+	require.NoError(t, err)
+	h := NewHTTPHandler(service)
+
+	// check
+	body := fmt.Sprintf(`{"parcel": %d, "kind": "delayed", "detail": "stuck at the depot"}`, parcel.Number)
+	rec := doRequest(t, h, http.MethodPost, "/work-items", body)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var item workItemJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&item))
+	assert.Equal(t, fmt.Sprintf("/work-items/%d", item.ID), rec.Header().Get("Location"))
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodPost, "/work-items", `{"kind": "lost"}`).Code)
+
+	path := fmt.Sprintf("/work-items/%d", item.ID)
+	rec = doRequest(t, h, http.MethodPost, path+"/assign", `{"assignee": "alice"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequest(t, h, http.MethodGet, fmt.Sprintf("/work-items?assignee=alice&parcel=%d", parcel.Number), "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var open []workItemJSON
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&open))
+	require.Len(t, open, 1)
+	assert.Equal(t, WorkItemInProgress, open[0].State)
+
+	rec = doRequest(t, h, http.MethodPost, path+"/resolve", `{"state": "dismissed", "resolution": "duplicate"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, http.StatusConflict, doRequest(t, h, http.MethodPost, path+"/assign", `{"assignee": "bob"}`).Code)
+	rec = doRequest(t, h, http.MethodGet, "/work-items", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&open))
+	assert.Empty(t, open)
+	assert.Equal(t, http.StatusOK, doRequest(t, h, http.MethodGet, path, "").Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodGet, "/work-items/999", "").Code)
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodGet, "/work-items?parcel=x", "").Code)
+
+	client := NewAuthorizedService(service, Principal{Role: RoleClient, Client: parcel.Client})
+	_, err = client.WorkItems(WorkItemFilter{Open: true})
+	assert.ErrorIs(t, err, ErrForbidden)
+	courier := NewAuthorizedService(service, Principal{Role: RoleCourier})
+	_, err = courier.AssignWorkItem(item.ID, "carol")
+	assert.ErrorIs(t, err, ErrForbidden)
+}